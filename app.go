@@ -1,13 +1,21 @@
 package rdiff
 
 import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
 	"crypto/md5" // nolint
-	"encoding/gob"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"math"
+	"net/http"
 	"os"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff/rollsum"
 )
 
 const (
@@ -21,105 +29,564 @@ const (
 // It exposes the public API and allows for IO interactions.
 type App struct {
 	diffEngine *rDiff
+	// mmap means the input files are mapped in memory, instead of streamed
+	mmap bool
+	// skipUnchanged means Delta doesn't write the delta of a source which equals the target, see WithSkipUnchanged
+	skipUnchanged bool
+	// signingKey signs the signatures and the deltas written, nil means they're not signed, see WithSigningKey
+	signingKey ed25519.PrivateKey
+	// verifyKey verifies the signatures and the deltas read, nil means they're not verified, see WithVerifyKey
+	verifyKey ed25519.PublicKey
+	// passphrase encrypts the deltas written, and decrypts the ones read, nil means no passphrase, see
+	// WithPassphrase
+	passphrase []byte
+	// recipient encrypts the deltas written, nil means they're not encrypted to a key, see WithRecipient
+	recipient *ecdh.PublicKey
+	// identity decrypts the deltas read, encrypted to its public key, see WithIdentity
+	identity *ecdh.PrivateKey
+	// gzip means Signature and Delta diff the uncompressed content of the gzip files, see WithGzip
+	gzip bool
+	// fileHash means the signatures record the hash of the whole target, used by Delta to detect an identical
+	// source, see WithFileHash
+	fileHash bool
+	// readAhead is the number of buffers read ahead from the streamed input files, 0 means no read ahead
+	readAhead int
+	// progress receives the progress of the calls, if not nil
+	progress func(Progress)
+	// metrics receives the measurements of the calls, if not nil, see WithMetrics
+	metrics func(Metrics)
+	// traceCtx is the context of the span in progress, the one configured when no call is in progress, nil means the
+	// calls are not traced, see WithTraceContext
+	traceCtx context.Context
+	// format is the serialization of the signature and delta outputs
+	format Format
+	// filter selects the files of the tree operations, nil means every file
+	filter *pathFilter
+	// attrs are the file attributes recorded and restored by the tree operations
+	attrs FileAttrs
+	// symlinks is the handling of the symbolic links by the tree operations
+	symlinks SymlinkMode
+	// renames means DeltaDir detects the new source files renamed from deleted target files
+	renames bool
+	// dirConcurrency is the number of files of a directory processed concurrently, values <= 1 mean sequentially
+	dirConcurrency int
+	// checkpointPath is the file the Signature and Delta calls save their state to, every checkpointInterval bytes
+	// of input, see WithCheckpoint
+	checkpointPath     string
+	checkpointInterval int64
+	// limiter limits the bandwidth of the input reads and of the output writes, nil means unlimited
+	limiter *rate.Limiter
+	// client fetches the signatures located by URLs, http.DefaultClient if nil
+	client *http.Client
+	// signatureCache holds the signatures computed by Signature, nil means they're not cached, see
+	// WithSignatureCache
+	signatureCache *SignatureCache
+	// outputMode is the permission bits of the output files, 0 means the default ones, see WithOutputMode
+	outputMode fs.FileMode
+	// targetAttrs are the attributes of the target file copied by Patch to the output, see WithTargetAttrs
+	targetAttrs FileAttrs
+	// basisCheck is the check of the target against the signature at basisSignaturePath, before a delta is applied
+	// to it, see WithBasisCheck
+	basisCheck         BasisCheck
+	basisSignaturePath string
 }
 
 // New constructs the RDiff app instance and returns a pointer to it.
 // It accepts a blockSize as input, representing the size, in bytes, for splitting the target in blocks,
 // in order to compute the target's signature.
 // A blockSize <=0 means the size, in bytes, ii computed dynamically.
-func New(blockSize int) *App {
-	return &App{
+// The opts allow further customization of the instance, see the With* functions.
+func New(blockSize int, opts ...Option) *App {
+	a := &App{
 		// nolint
-		diffEngine: newRDiff(blockSize, newAdler32RollingHash(), md5.New()),
+		diffEngine: newRDiff(blockSize, rollsum.NewAdler32(), md5.New()),
+		attrs:      FileAttrMode | FileAttrModTime,
+		renames:    true,
+	}
+	a.diffEngine.blockSizePinned = blockSize > 0
+	for _, opt := range opts {
+		opt(a)
 	}
+
+	return a
+}
+
+// Reset releases the memory retained by the instance between calls and clears the stats of the last Delta and Patch calls.
+// The buffers used during a call are pooled and shared by all the instances, so calling Reset is only useful
+// for long-lived instances which are not going to be used for a while.
+func (a *App) Reset() {
+	a.diffEngine.Reset()
 }
 
 // Signature computes the signature of a target file(targetFilePath) and writes it to an output file(outputFilePath)
 // The target file(targetFileName) must exist, otherwise it returns an appropriate non-nil error.
 // If the output file(outputFilePath) already exists, it returns an appropriate non-nil error.
-// The content written to outputFilePath is serialized using gob encoding.
-func (a *App) Signature(targetFilePath string, signatureFilePath string) error {
-	targetFile, err := os.Open(targetFilePath)
+// The output is written to a temporary file, in the same directory, renamed once complete, so a failed call doesn't
+// leave a partial output behind. If the target is modified while it's read, a non-nil error matching ErrModified is
+// returned.
+// The content written to outputFilePath is serialized using the configured format, gob by default, which can be read
+// using ReadSignature, see WithFormat.
+func (a *App) Signature(targetFilePath string, signatureFilePath string) (err error) {
+	call := a.startCall("signature")
+	defer func() { call.done(a.diffEngine, err) }()
+	span := a.startCallSpan("signature")
+	defer func() { span.done(a.diffEngine, err) }()
+	if a.checkpointed() {
+		cp := &checkpoint{
+			Op: checkpointSignature, Input: targetFilePath, Output: signatureFilePath, Interval: a.checkpointInterval,
+		}
+		return a.checkpointedSignature(a.checkpointPath, cp, false)
+	}
+	err = a.checkSignatureHashers()
 	if err != nil {
 		return err
 	}
-	tfInfo, err := targetFile.Stat()
+	targetFile, err := openSequential(targetFilePath)
 	if err != nil {
 		return err
 	}
-	targetFileSize := tfInfo.Size()
+	snapshot, err := newInputSnapshot(targetFile)
+	if err != nil {
+		return errors.Join(err, targetFile.Close())
+	}
+	targetFileSize := snapshot.info.Size()
 	if targetFileSize <= 0 {
-		return errors.New("the target file is empty")
+		return errors.Join(errors.New("the target file is empty"), targetFile.Close())
 	}
+	call.input(targetFileSize)
+	span.input(targetFileSize)
 
-	a.diffEngine.blockSize, err = decideBlockSize(a.diffEngine.blockSize, targetFileSize)
+	signatureFile, err := a.createOutputFile(signatureFilePath, nil)
 	if err != nil {
-		return err
+		return errors.Join(err, targetFile.Close())
+	}
+	header, signature, err := a.cachedSignature(targetFile, snapshot)
+	if err == nil {
+		err = a.writeSignature(call.output(signatureFile), header, signature)
+	}
+	err = errors.Join(err, targetFile.Close())
+
+	return a.closeOutput(signatureFile, err)
+}
+
+// cachedSignature returns the header and the blocks of the signature of the target file, which has the snapshot, from
+// the cache if the App is configured using WithSignatureCache, and it holds the signature of the file as it is,
+// otherwise it computes it, and caches it.
+func (a *App) cachedSignature(f *os.File, snapshot *inputSnapshot) (SignatureHeader, signatureTable, error) {
+	var key signatureCacheKey
+	if a.signatureCache != nil {
+		key = a.signatureCacheKey(f.Name(), snapshot.info)
+		header, signature, ok := a.signatureCache.get(key)
+		if ok {
+			a.diffEngine.blockSize = header.BlockSize
+			return header, signature, nil
+		}
 	}
+	size := snapshot.info.Size()
+	hashedSize, compute := a.signatureFunc(f, size)
+	var err error
+	a.diffEngine.blockSize, err = decideBlockSize(a.diffEngine.blockSize, hashedSize)
+	if err != nil {
+		return SignatureHeader{}, signatureTable{}, err
+	}
+	target, release := a.inputReader(f, size)
+	target = a.withReadProgress(snapshot.reader(target), "signature", size)
+	header, signature, err := compute(target, hashedSize)
+	if err == nil {
+		err = snapshot.check()
+	}
+	err = errors.Join(err, release())
+	if err != nil {
+		return SignatureHeader{}, signatureTable{}, err
+	}
+	if a.signatureCache != nil {
+		a.signatureCache.put(key, header, signature)
+	}
+
+	return header, signature, nil
+}
 
-	signatureFile, err := os.OpenFile(signatureFilePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+// SignatureAt computes the signature of a target, which has the given size, and writes it to output, the same
+// way Signature does for a file. The target is read by offset, so it's hashed concurrently by the workers
+// configured using WithConcurrency, and it can be any random access storage (ex: a remote object read by ranges).
+func (a *App) SignatureAt(target io.ReaderAt, targetSize int64, output io.Writer) (err error) {
+	call := a.startCall("signature")
+	defer func() { call.done(a.diffEngine, err) }()
+	span := a.startCallSpan("signature")
+	defer func() { span.done(a.diffEngine, err) }()
+	err = a.checkSignatureHashers()
 	if err != nil {
 		return err
 	}
+	call.input(targetSize)
+	span.input(targetSize)
+	if targetSize <= 0 {
+		return errors.New("the target is empty")
+	}
+	a.diffEngine.blockSize, err = decideBlockSize(a.diffEngine.blockSize, targetSize)
+	if err != nil {
+		return err
+	}
+	header, signature, err := a.computeSignatureAt(target, targetSize)
+	if err != nil {
+		return err
+	}
+
+	return a.writeSignature(call.output(output), header, signature)
+}
 
-	err = a.signature(targetFile, signatureFile)
-	err1 := targetFile.Close()
-	err2 := signatureFile.Close()
+// computeSignatureAt hashes the target, which has the given size, by offset, and returns the header and the blocks
+// of its signature.
+func (a *App) computeSignatureAt(target io.ReaderAt, targetSize int64) (header SignatureHeader, signature signatureTable, err error) {
+	span := a.startSpan("signature")
+	defer func() { span.end(err) }()
+	signature, err = a.diffEngine.ComputeSignatureAt(target, targetSize)
+	if err != nil {
+		return header, signature, err
+	}
+	header = a.diffEngine.signatureHeader()
+	header.TargetSize = targetSize
+	header.FileHash, err = a.fileHashAt(target, targetSize)
+	if err != nil {
+		return header, signature, err
+	}
+	header.SecondPass, err = a.diffEngine.secondPassAt(target, targetSize)
 
-	return errors.Join(err, err1, err2)
+	return header, signature, err
 }
 
 // Delta computes the instruction list(operations list) in order for the target
 // to be able to update its content to match the source.
 // The signature file(signatureFilePath) and the source file(sourceFilePath) must exist,
 // otherwise a non-nil error is returned.
-// The delta file(deltaFilePath) must not exist, otherwise a non-nil error is returned.
-// The content written to deltaFilePath is serialized using gob encoding.
-func (a *App) Delta(signatureFilePath string, sourceFilePath string, deltaFilePath string) error {
-	signatureFile, err := os.Open(signatureFilePath)
+// The signatureFilePath can be an http:// or https:// URL, in which case the signature is streamed from the response
+// of a GET request, sent using the configured HTTP client(see WithHTTPClient), so it's not staged locally. A 404 Not
+// Found status matches fs.ErrNotExist, using errors.Is, and the block size of an Rdiff-Block-Size response header,
+// like the one of the rdiffhttp package, is adopted.
+// The delta file(deltaFilePath) must not exist, otherwise a non-nil error is returned. It's written to a temporary
+// file, in the same directory, renamed once complete, so a failed call doesn't leave a partial delta behind.
+// If the source is modified while it's read, a non-nil error matching ErrModified is returned.
+// If the source equals the target, and the App is configured using WithSkipUnchanged, the delta file is not written,
+// and ErrNoChanges is returned.
+// The signature's hash algorithms must match the configured ones(if any), otherwise a non-nil error is returned.
+// The same goes for the signature's block size, which is adopted if the App was constructed with a block size <= 0.
+// The content written to deltaFilePath is serialized using the configured format, by default a gob encoded DeltaHeader,
+// followed by a sequence of gob encoded operations, which can be read using ReadDelta, see WithFormat.
+func (a *App) Delta(signatureFilePath string, sourceFilePath string, deltaFilePath string) (err error) {
+	call := a.startCall("delta")
+	defer func() { call.done(a.diffEngine, err) }()
+	span := a.startCallSpan("delta")
+	defer func() { span.done(a.diffEngine, err) }()
+	if a.checkpointed() {
+		cp := &checkpoint{
+			Op: checkpointDelta, Signature: signatureFilePath, Input: sourceFilePath, Output: deltaFilePath,
+			Interval: a.checkpointInterval,
+		}
+		return a.checkpointedDelta(a.checkpointPath, cp, false)
+	}
+	err = a.diffEngine.checkHashers()
 	if err != nil {
 		return err
 	}
-	sourceFile, err := os.Open(sourceFilePath)
+	signatureFile, err := a.openSignature(signatureFilePath)
 	if err != nil {
 		return err
 	}
-	deltaFile, err := os.OpenFile(deltaFilePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	sourceFile, err := openSequential(sourceFilePath)
+	if err != nil {
+		return errors.Join(err, signatureFile.Close())
+	}
+	snapshot, err := newInputSnapshot(sourceFile)
+	if err != nil {
+		return errors.Join(err, signatureFile.Close(), sourceFile.Close())
+	}
+	deltaFile, err := a.createOutputFile(deltaFilePath, nil)
+	if err != nil {
+		return errors.Join(err, signatureFile.Close(), sourceFile.Close())
+	}
+
+	call.input(snapshot.info.Size())
+	span.input(snapshot.info.Size())
+	source, release := a.inputReader(sourceFile, snapshot.info.Size())
+	err = a.sourceFileDelta(signatureFile, snapshot, source, call.output(deltaFile))
+	if err == nil {
+		err = snapshot.check()
+	}
+	if err == nil {
+		err = a.checkUnchanged()
+	}
+	err = errors.Join(err, release(), signatureFile.Close(), sourceFile.Close())
+
+	return a.closeOutput(deltaFile, err)
+}
+
+// checkUnchanged returns ErrNoChanges if the delta computed is a no-op, and the App is configured to skip it.
+func (a *App) checkUnchanged() error {
+	if a.skipUnchanged && a.diffEngine.stats.Unchanged {
+		return ErrNoChanges
+	}
+
+	return nil
+}
+
+// DeltaStream computes the delta of a source, which has the given size, against a signature, and writes it to
+// output, the same way Delta does for files, so the signature and the source can be streamed(ex: over a network).
+// The signature's hash algorithms must match the configured ones(if any), otherwise a non-nil error is returned.
+func (a *App) DeltaStream(signature io.Reader, source io.Reader, sourceSize int64, output io.Writer) (err error) {
+	call := a.startCall("delta")
+	defer func() { call.done(a.diffEngine, err) }()
+	span := a.startCallSpan("delta")
+	defer func() { span.done(a.diffEngine, err) }()
+	err = a.diffEngine.checkHashers()
 	if err != nil {
 		return err
 	}
+	call.input(sourceSize)
+	span.input(sourceSize)
 
-	err = a.delta(signatureFile, sourceFile, deltaFile)
-	err1 := signatureFile.Close()
-	err2 := sourceFile.Close()
-	err3 := deltaFile.Close()
+	return a.delta(signature, a.withReadProgress(source, "delta", sourceSize), DeltaHeader{SourceSize: sourceSize}, call.output(output))
+}
+
+// checkSignatureHashers returns a non-nil error if the configured hash algorithms are unknown, or if they can't
+// be serialized using the configured format.
+func (a *App) checkSignatureHashers() error {
+	if a.format == FormatLibrsync {
+		err := a.diffEngine.useLibrsyncHashes()
+		if err != nil {
+			return err
+		}
+	}
 
-	return errors.Join(err, err1, err2, err3)
+	return a.diffEngine.checkHashers()
 }
 
 // delta is the lower layer that performs the delta computation and data serialization.
-func (a *App) delta(signature, source io.Reader, output io.Writer) error {
-	var blockList []Block
-	err := gob.NewDecoder(signature).Decode(&blockList)
+func (a *App) delta(signature, source io.Reader, deltaHeader DeltaHeader, output io.Writer) error {
+	header, sig, err := a.readSignature(signature)
+	if err != nil {
+		return err
+	}
+
+	return a.encodeDelta(header, deltaHeader, output, func(emit func(Operation) error) error {
+		return a.diffEngine.ComputeDeltaFunc(source, header, sig, emit)
+	})
+}
+
+// sourceFileDelta is the delta of a source file, which has the snapshot, and is read using source. If the source is the
+// same as the target of the signature, see WithFileHash, the delta keeps all the target blocks, without being
+// computed. The uncompressed content of a gzip source is diffed against the signature of an uncompressed target, see
+// WithGzip.
+func (a *App) sourceFileDelta(signature io.Reader, snapshot *inputSnapshot, source io.Reader, output io.Writer) error {
+	sourceSize := snapshot.info.Size()
+	header, sig, err := a.readSignature(signature)
+	if err != nil {
+		return err
+	}
+	if header.Gunzipped {
+		gz, gunzip := a.gzipInput(snapshot.f, sourceSize)
+		if gunzip {
+			return a.gunzippedDelta(header, sig, gz, a.withReadProgress(snapshot.reader(source), "delta", sourceSize), output)
+		}
+	}
+	same, err := a.sameSource(header, snapshot.f, sourceSize)
+	if err != nil {
+		return err
+	}
+	compute := func(emit func(Operation) error) error {
+		return a.diffEngine.keepAll(header, sig, emit)
+	}
+	if !same {
+		source = a.withReadProgress(snapshot.reader(source), "delta", sourceSize)
+		compute = func(emit func(Operation) error) error {
+			return a.diffEngine.ComputeDeltaFunc(source, header, sig, emit)
+		}
+	}
+
+	return a.encodeDelta(header, DeltaHeader{SourceSize: sourceSize}, output, compute)
+}
+
+// encodeDelta serializes the delta computed by compute, against a signature having the header, using the
+// configured format, and signs it, see WithSigningKey.
+func (a *App) encodeDelta(header SignatureHeader, deltaHeader DeltaHeader, output io.Writer, compute func(func(Operation) error) error) (err error) {
+	span := a.startSpan("encode")
+	defer func() { span.end(err) }()
+	// the block size is negotiated before the encoders of the formats which need it are configured
+	negotiated, err := a.diffEngine.negotiated(header)
+	if err != nil {
+		return err
+	}
+	deltaHeader, err = a.completeDeltaHeader(header, negotiated.blockSize, deltaHeader)
+	if err != nil {
+		return err
+	}
+	// the delta is written while it's computed, so the match runs within the encoding
+	match := compute
+	compute = func(emit func(Operation) error) (err error) {
+		span := a.startSpan("match")
+		defer func() { span.end(err) }()
+
+		return match(emit)
+	}
+	protected, finish, err := a.protectedOutput(output)
 	if err != nil {
 		return err
 	}
-	delta, err := a.diffEngine.ComputeDelta(source, blockList)
+	err = a.writeDeltaFormat(header, deltaHeader, negotiated.blockSize, protected, compute)
 	if err != nil {
 		return err
 	}
 
-	return gob.NewEncoder(output).Encode(delta)
+	return finish()
+}
+
+// protectedOutput returns the writer of a delta written to output, encrypted, then signed, if the App is configured
+// to, and the function completing it.
+func (a *App) protectedOutput(output io.Writer) (io.Writer, func() error, error) {
+	signed, sign := a.signedOutput(output)
+	encrypted, seal, err := a.encryptedOutput(signed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encrypted, func() error {
+		err := seal()
+		if err != nil {
+			return err
+		}
+
+		return sign()
+	}, nil
+}
+
+// writeDeltaFormat writes the delta computed by compute, against a signature having the header, and blocks of
+// blockSize bytes, using the configured format.
+func (a *App) writeDeltaFormat(
+	header SignatureHeader, deltaHeader DeltaHeader, blockSize int, output io.Writer, compute func(func(Operation) error) error,
+) error {
+	switch a.format {
+	case FormatGob:
+		return writeDelta(output, gobEncoder, deltaHeader, compute)
+	case FormatJSON:
+		return writeDelta(output, jsonEncoder, deltaHeader, compute)
+	case FormatVCDIFF:
+		layout := targetLayout{size: header.TargetSize, blockSize: blockSize, partSize: deltaHeader.SecondPassBlockSize}
+		return writeDeltaVCDIFF(output, layout, compute)
+	case FormatLibrsync:
+		return writeDeltaLibrsync(output, blockSize, deltaHeader.SourceSize, compute)
+	default:
+		return fmt.Errorf("unknown format: %v", a.format)
+	}
+}
+
+// completeDeltaHeader completes the delta header with the properties of the target the delta is computed against:
+// its block size, negotiated with the signature, the block size of its second pass, and whether its uncompressed
+// content was hashed, which only the gob and JSON formats record.
+func (a *App) completeDeltaHeader(header SignatureHeader, blockSize int, deltaHeader DeltaHeader) (DeltaHeader, error) {
+	if header.Gunzipped && a.format != FormatGob && a.format != FormatJSON {
+		return deltaHeader, fmt.Errorf("the %v format can't record the delta of a gunzipped target", a.format)
+	}
+	if a.diffEngine.secondPass > 0 && header.SecondPass != nil {
+		deltaHeader.SecondPassBlockSize = header.SecondPass.BlockSize
+	}
+	deltaHeader.GunzippedTarget = header.Gunzipped
+	deltaHeader.TargetBlockSize = blockSize
+
+	return deltaHeader, nil
+}
+
+// readSignature reads a signature written using the configured format, which is a gob signature, except
+// for the librsync format. A librsync signature records its block size, which is adopted by the engine.
+// The signature is verified first, see WithVerifyKey.
+func (a *App) readSignature(r io.Reader) (header SignatureHeader, sig signatureTable, err error) {
+	span := a.startSpan("read")
+	defer func() { span.end(err) }()
+	verified, release, err := a.verifiedArtifact(r)
+	if err != nil {
+		return SignatureHeader{}, signatureTable{}, err
+	}
+	defer func() { err = errors.Join(err, release()) }()
+	if a.format != FormatLibrsync {
+		return readSignature(verified, a.diffEngine.limits)
+	}
+	header, sig, blockSize, err := readSignatureLibrsync(verified, a.diffEngine.limits)
+	if err != nil {
+		return SignatureHeader{}, signatureTable{}, err
+	}
+	a.diffEngine.blockSize = blockSize
+
+	return header, sig, nil
 }
 
 // signature is the lower layer that performs the signature computation and data serialization.
-func (a *App) signature(target io.Reader, output io.Writer) error {
-	signature, err := a.diffEngine.ComputeSignature(target)
+func (a *App) signature(target io.Reader, targetSize int64, output io.Writer) error {
+	header, signature, err := a.computeSignature(target, targetSize)
+	if err != nil {
+		return err
+	}
+
+	return a.writeSignature(output, header, signature)
+}
+
+// computeSignature hashes the target, which has the given size, and returns the header and the blocks of its
+// signature.
+func (a *App) computeSignature(target io.Reader, targetSize int64) (header SignatureHeader, signature signatureTable, err error) {
+	span := a.startSpan("signature")
+	defer func() { span.end(err) }()
+	fileHasher, err := a.fileHasher()
+	if err != nil {
+		return header, signature, err
+	}
+	if fileHasher != nil {
+		target = io.TeeReader(target, fileHasher)
+	}
+	secondPass, err := a.diffEngine.newSecondPassSigner()
+	if err != nil {
+		return header, signature, err
+	}
+	if secondPass != nil {
+		target = io.TeeReader(target, secondPass)
+	}
+	signature, err = a.diffEngine.ComputeSignature(target)
+	if err != nil {
+		return header, signature, err
+	}
+	header = a.diffEngine.signatureHeader()
+	header.TargetSize = targetSize
+	if fileHasher != nil {
+		header.FileHash = fileHasher.Sum(nil)
+	}
+	if secondPass != nil {
+		header.SecondPass = secondPass.signature()
+	}
+
+	return header, signature, nil
+}
+
+// writeSignature serializes the signature using the configured format, and signs it, see WithSigningKey.
+func (a *App) writeSignature(w io.Writer, header SignatureHeader, signature signatureTable) (err error) {
+	span := a.startSpan("encode")
+	defer func() { span.end(err) }()
+	signed, sign := a.signedOutput(w)
+	err = a.encodeSignature(signed, header, signature)
 	if err != nil {
 		return err
 	}
 
-	return gob.NewEncoder(output).Encode(signature)
+	return sign()
+}
+
+// encodeSignature serializes the signature using the configured format.
+func (a *App) encodeSignature(w io.Writer, header SignatureHeader, signature signatureTable) error {
+	switch a.format {
+	case FormatGob:
+		return writeSignature(w, header, signature)
+	case FormatJSON:
+		return writeSignatureJSON(w, header, signature)
+	case FormatLibrsync:
+		return writeSignatureLibrsync(w, a.diffEngine.blockSize, header, signature)
+	default:
+		return fmt.Errorf("the %v format can't encode a signature", a.format)
+	}
 }
 
 // computeDynamicBlockSize is the actual rsync algorithm for computing the dynamic block size, based on the file length.
@@ -155,7 +622,7 @@ func computeDynamicBlockSize(fLen int64) int64 {
 func decideBlockSize(blockSize int, fileSize int64) (int, error) {
 	// if provided blockSize, validate against min nr of chunks
 	if blockSize > 0 {
-		nrOfChunks := int(math.Ceil(float64(fileSize) / float64(blockSize)))
+		nrOfChunks := int64(math.Ceil(float64(fileSize) / float64(blockSize)))
 		// check that the diff makes sense - at least 2 blocks for the signature file
 		if nrOfChunks < 2 {
 			return 0, fmt.Errorf(
@@ -169,7 +636,7 @@ func decideBlockSize(blockSize int, fileSize int64) (int, error) {
 	}
 	// if not provided blockSize, switch to dynamic and adjust if block size is too small
 	blockSize = int(computeDynamicBlockSize(fileSize))
-	nrOfChunks := int(math.Ceil(float64(fileSize) / float64(blockSize)))
+	nrOfChunks := int64(math.Ceil(float64(fileSize) / float64(blockSize)))
 	// ensure a min of 2 chunks for the dynamically computed size
 	if nrOfChunks < 2 {
 		blockSize = int(math.Floor(float64(fileSize) / 2))
@@ -177,3 +644,11 @@ func decideBlockSize(blockSize int, fileSize int64) (int, error) {
 
 	return blockSize, nil
 }
+
+// DynamicBlockSize returns the block size of the signature of a target of the given size, computed by an App
+// constructed with a block size <= 0, so a peer receiving the signature can compute the deltas against it.
+func DynamicBlockSize(targetSize int64) int {
+	blockSize, _ := decideBlockSize(0, targetSize)
+
+	return blockSize
+}
@@ -1,6 +1,15 @@
 package rdiff
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/silviutanasa/rdiff/rollsum"
+)
 
 var testsComputeDynBlSize = []struct {
 	in  int64
@@ -79,3 +88,273 @@ func Test_decideBlockSize(t *testing.T) {
 		}
 	}
 }
+
+func TestDynamicBlockSize(t *testing.T) {
+	for _, tt := range testsDecideBlSize {
+		if tt.in.blSize > 0 {
+			continue
+		}
+		if got := DynamicBlockSize(tt.in.fSize); got != tt.out {
+			t.Errorf("DynamicBlockSize(%v) = %v, want %v", tt.in.fSize, got, tt.out)
+		}
+	}
+}
+
+var testsAppHashNegotiation = []struct {
+	signatureOpts []Option
+	deltaOpts     []Option
+	wantErr       bool
+}{
+	{},
+	{signatureOpts: []Option{WithWeakHash(WeakHashRabin)}},
+	{signatureOpts: []Option{WithStrongHash(StrongHashSHA256)}, deltaOpts: []Option{WithWeakHash(WeakHashAdler32)}},
+	{signatureOpts: []Option{WithWeakHash(WeakHashRabin)}, deltaOpts: []Option{WithWeakHash(WeakHashRabin)}},
+	{signatureOpts: []Option{WithWeakHash(WeakHashRabin)}, deltaOpts: []Option{WithWeakHash(WeakHashBuzhash)}, wantErr: true},
+	{signatureOpts: []Option{WithStrongHash(StrongHashSHA1)}, deltaOpts: []Option{WithStrongHash(StrongHashMD5)}, wantErr: true},
+	{signatureOpts: []Option{WithStrongHashKey([]byte("k1"))}, deltaOpts: []Option{WithStrongHashKey([]byte("k2"))}, wantErr: true},
+	{deltaOpts: []Option{WithStrongHash(StrongHashType(255))}, wantErr: true},
+	{signatureOpts: []Option{WithRollingHash(rollsum.NewRabin())}, deltaOpts: []Option{WithRollingHash(rollsum.NewRabin())}},
+	{signatureOpts: []Option{WithRollingHash(rollsum.NewRabin())}, wantErr: true},
+	{deltaOpts: []Option{WithRollingHash(nil)}, wantErr: true},
+}
+
+func TestApp_Delta_HashNegotiation(t *testing.T) {
+	for i, tt := range testsAppHashNegotiation {
+		dir := t.TempDir()
+		target, source := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+		sig, delta := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+		if err := os.WriteFile(target, []byte{1, 2, 3, 4, 5, 6, 7}, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(source, []byte{0, 1, 2, 3, 4, 5, 6, 7}, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := New(3, tt.signatureOpts...).Signature(target, sig); err != nil {
+			t.Fatalf("%v: Signature() error = %v", i, err)
+		}
+		err := New(3, tt.deltaOpts...).Delta(sig, source, delta)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: Delta() error = %v, wantErr %v", i, err, tt.wantErr)
+		}
+	}
+}
+
+func TestApp_Delta_BlockSizeNegotiation(t *testing.T) {
+	dir := t.TempDir()
+	target, source, sig := filepath.Join(dir, "target"), filepath.Join(dir, "source"), filepath.Join(dir, "signature")
+	if err := os.WriteFile(target, []byte{1, 2, 3, 4, 5, 6, 7}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(source, []byte{0, 1, 2, 3, 4, 5, 6, 7}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(3).Signature(target, sig); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		blockSize int
+		wantErr   error
+	}{
+		{blockSize: 3},
+		// the block size is adopted from the signature
+		{blockSize: 0},
+		{blockSize: 4, wantErr: ErrVerification},
+	}
+	for i, tt := range tests {
+		delta := filepath.Join(dir, "delta"+strconv.Itoa(i))
+		err := New(tt.blockSize).Delta(sig, source, delta)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Delta(block size %v) error = %v, want %v", tt.blockSize, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Delta(block size %v) error = %v", tt.blockSize, err)
+		}
+		output := filepath.Join(dir, "output"+strconv.Itoa(i))
+		if err := New(3).Patch(target, delta, output); err != nil {
+			t.Fatalf("Patch() error = %v", err)
+		}
+		if got, _ := os.ReadFile(output); !bytes.Equal(got, []byte{0, 1, 2, 3, 4, 5, 6, 7}) {
+			t.Errorf("Delta(block size %v) rebuilds %v", tt.blockSize, got)
+		}
+	}
+}
+
+func TestApp_Delta_KeepsConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	if err := os.WriteFile(path("target"), randomBytes(1, 4096), 0666); err != nil {
+		t.Fatal(err)
+	}
+	pinned := New(16, WithWeakHash(WeakHashRabinKarp), WithStrongHash(StrongHashSHA1))
+	if err := pinned.Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(0).Signature(path("target"), path("want")); err != nil {
+		t.Fatal(err)
+	}
+	// the Delta call adopts the signature's hashes and block size, but the later calls don't
+	app := New(0)
+	if err := app.Delta(path("signature"), path("target"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Signature(path("target"), path("got")); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(path("got"))
+	want, _ := os.ReadFile(path("want"))
+	if !bytes.Equal(got, want) {
+		t.Error("Signature() after Delta() differs from the signature of a new App")
+	}
+}
+
+func TestApp_LastStats(t *testing.T) {
+	dir := t.TempDir()
+	target, source := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	sig, delta, output := filepath.Join(dir, "signature"), filepath.Join(dir, "delta"), filepath.Join(dir, "output")
+	if err := os.WriteFile(target, []byte{1, 2, 3, 4, 5, 6, 7}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(source, []byte{0, 1, 2, 3, 4, 5, 6, 7}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	app := New(3)
+	if err := app.Signature(target, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(sig, source, delta); err != nil {
+		t.Fatal(err)
+	}
+	got := app.LastDeltaStats()
+	if got.SearchListMemory <= 0 {
+		t.Errorf("LastDeltaStats().SearchListMemory = %v, want > 0", got.SearchListMemory)
+	}
+	if got.MapSearchListMemory <= 0 {
+		t.Errorf("LastDeltaStats().MapSearchListMemory = %v, want > 0", got.MapSearchListMemory)
+	}
+	if got.MatchedBlocks != 3 || got.LiteralBytes != 1 {
+		t.Errorf("LastDeltaStats() = %+v, want 3 matched blocks and 1 literal byte", got)
+	}
+	if err := app.Patch(target, delta, output); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := app.LastPatchStats(), (PatchStats{CopiedBlocks: 3, CopiedBytes: 7, LiteralBytes: 1}); got != want {
+		t.Errorf("LastPatchStats() = %+v, want %+v", got, want)
+	}
+	app.Reset()
+	if got := app.LastPatchStats(); got != (PatchStats{}) {
+		t.Errorf("LastPatchStats() after Reset = %+v, want zero", got)
+	}
+}
+
+func TestApp_Delta_SkipUnchanged(t *testing.T) {
+	target := []byte{1, 2, 3, 4, 5, 6, 7}
+	dir := t.TempDir()
+	targetPath, sig := filepath.Join(dir, "target"), filepath.Join(dir, "signature")
+	if err := os.WriteFile(targetPath, target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(3).Signature(targetPath, sig); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		source    []byte
+		unchanged bool
+	}{
+		{name: "same", source: target, unchanged: true},
+		{name: "edited", source: []byte{1, 2, 3, 4, 0, 6, 7}},
+		{name: "appended", source: []byte{1, 2, 3, 4, 5, 6, 7, 8}},
+		{name: "truncated", source: []byte{1, 2, 3, 4, 5, 6}},
+		{name: "reordered", source: []byte{4, 5, 6, 1, 2, 3, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := filepath.Join(t.TempDir(), "source")
+			if err := os.WriteFile(source, tt.source, 0666); err != nil {
+				t.Fatal(err)
+			}
+			app := New(3)
+			if err := app.Delta(sig, source, source+".delta"); err != nil {
+				t.Fatal(err)
+			}
+			if got := app.LastDeltaStats().Unchanged; got != tt.unchanged {
+				t.Errorf("LastDeltaStats().Unchanged = %v, want %v", got, tt.unchanged)
+			}
+
+			app = New(3, WithSkipUnchanged(true))
+			err := app.Delta(sig, source, source+".skipped")
+			if tt.unchanged != errors.Is(err, ErrNoChanges) || (!tt.unchanged && err != nil) {
+				t.Errorf("Delta() with WithSkipUnchanged error = %v, unchanged %v", err, tt.unchanged)
+			}
+			if _, err := os.Stat(source + ".skipped"); tt.unchanged != errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Delta() with WithSkipUnchanged wrote the delta: %v, unchanged %v", err == nil, tt.unchanged)
+			}
+		})
+	}
+}
+
+func TestApp_SignatureAt(t *testing.T) {
+	target := []byte{1, 2, 3, 4, 5, 6, 7}
+	dir := t.TempDir()
+	targetPath, sig := filepath.Join(dir, "target"), filepath.Join(dir, "signature")
+	if err := os.WriteFile(targetPath, target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(3).Signature(targetPath, sig); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err = New(3, WithConcurrency(2)).SignatureAt(bytes.NewReader(target), int64(len(target)), &got); err != nil {
+		t.Fatalf("SignatureAt() error = %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("SignatureAt() = %v, want %v", got.Bytes(), want)
+	}
+	if err = New(3).SignatureAt(bytes.NewReader(nil), 0, &got); err == nil {
+		t.Errorf("SignatureAt() error = nil, want an error for an empty target")
+	}
+}
+
+func TestApp_DeltaStream(t *testing.T) {
+	target, source := []byte{1, 2, 3, 4, 5, 6, 7}, []byte{9, 1, 2, 3, 7}
+	dir := t.TempDir()
+	targetPath, sourcePath := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	sig, delta := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	for p, content := range map[string][]byte{targetPath: target, sourcePath: source} {
+		if err := os.WriteFile(p, content, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := New(3).Signature(targetPath, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(3).Delta(sig, sourcePath, delta); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigData, err := os.ReadFile(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err = New(3).DeltaStream(bytes.NewReader(sigData), bytes.NewReader(source), int64(len(source)), &got); err != nil {
+		t.Fatalf("DeltaStream() error = %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("DeltaStream() = %v, want %v", got.Bytes(), want)
+	}
+	err = New(3, WithWeakHash(WeakHashRabin)).DeltaStream(bytes.NewReader(sigData), bytes.NewReader(source), int64(len(source)), &got)
+	if !errors.Is(err, ErrVerification) {
+		t.Errorf("DeltaStream() error = %v, want a %v error for another weak hash", err, ErrVerification)
+	}
+}
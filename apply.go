@@ -0,0 +1,304 @@
+package rdiff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Apply rebuilds the source from the target, which has the given size, and the delta, as written by Delta,
+// and writes it to output. The target is read by offset, so it can be any random access storage (ex: a file,
+// a memory buffer, a remote object read by ranges), while the output is written in a single pass, in order, so it
+// can be streamed(ex: to a network connection, or a pipe).
+// The block size is the one recorded by the delta header, see DeltaHeader, which must be the configured one, if
+// explicitly configured, otherwise a non-nil error matching ErrVerification is returned. The deltas which don't
+// record it are applied using the configured block size, or, if none, the one of a signature of the target.
+// It returns a non-nil error if the delta is not valid for the target, including when the rebuilt source
+// doesn't have the size recorded in the delta header.
+// With FormatLibrsync, the delta is a librsync delta, which doesn't depend on the block size.
+// An encrypted delta is decrypted while it's read, see WithPassphrase and WithIdentity.
+func (a *App) Apply(target io.ReaderAt, targetSize int64, delta io.Reader, output io.Writer) (err error) {
+	call := a.startCall("patch")
+	defer func() { call.done(a.diffEngine, err) }()
+	span := a.startCallSpan("patch")
+	defer func() { span.done(a.diffEngine, err) }()
+	span.input(targetSize)
+	err = a.checkBasis(target, targetSize)
+	if err != nil {
+		return err
+	}
+	verified, release, err := a.verifiedArtifact(delta)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, release()) }()
+	decrypted, err := a.decryptedInput(verified)
+	if err != nil {
+		return err
+	}
+	if a.format == FormatLibrsync {
+		return a.applyLibrsync(target, targetSize, decrypted, output)
+	}
+	d, err := a.readDeltaHeader(decrypted)
+	if err != nil {
+		return err
+	}
+
+	return a.apply(target, targetSize, d, output)
+}
+
+// Patch rebuilds the source from the target file(targetFilePath) and the delta file(deltaFilePath), as written
+// by Delta, and writes it to a new output file(outputFilePath).
+// The target and delta files must exist, and the output file must not exist, otherwise a non-nil error is returned.
+// The output file is preallocated to the source size, recorded in the delta header, before applying the delta,
+// which avoids its fragmentation, and fails early if there is not enough disk space.
+// With FormatLibrsync, the delta is a librsync delta, which doesn't record the source size, so the output file
+// is not preallocated.
+// If the target is modified while it's read, a non-nil error matching ErrModified is returned.
+// The output file has the default permissions, unless configured using WithOutputMode, or WithTargetAttrs.
+// A failure once the output file is created, ex: an IO error, or an output which doesn't have the source size,
+// removes the output file, so a failed patch leaves no partial output, and returns an *ApplyError.
+// The target can be checked against the signature the delta was computed against first, see WithBasisCheck, in which
+// case a target which doesn't match creates no output file.
+// The target is only read: it's opened read-only, and it's never written, renamed, nor are its attributes changed,
+// whether the patch succeeds or not, so it can be the running version of an A/B update, patched to the other slot.
+func (a *App) Patch(targetFilePath string, deltaFilePath string, outputFilePath string) (err error) {
+	call := a.startCall("patch")
+	defer func() { call.done(a.diffEngine, err) }()
+	span := a.startCallSpan("patch")
+	defer func() { span.done(a.diffEngine, err) }()
+	targetFile, err := openSequential(targetFilePath)
+	if err != nil {
+		return err
+	}
+	snapshot, err := newInputSnapshot(targetFile)
+	if err != nil {
+		return errors.Join(err, targetFile.Close())
+	}
+	span.input(snapshot.info.Size())
+	deltaFile, err := os.Open(deltaFilePath)
+	if err != nil {
+		return errors.Join(err, targetFile.Close())
+	}
+	verified, release, err := a.verifiedArtifact(deltaFile)
+	if err != nil {
+		return errors.Join(err, targetFile.Close(), deltaFile.Close())
+	}
+	delta, err := a.decryptedInput(verified)
+	if err != nil {
+		return errors.Join(err, targetFile.Close(), release(), deltaFile.Close())
+	}
+	var d *deltaDecoder
+	if a.format != FormatLibrsync {
+		d, err = a.readDeltaHeader(delta)
+		if err != nil {
+			return errors.Join(err, targetFile.Close(), release(), deltaFile.Close())
+		}
+	}
+	err = a.checkBasis(targetFile, snapshot.info.Size())
+	if err != nil {
+		return errors.Join(err, targetFile.Close(), release(), deltaFile.Close())
+	}
+	outputFile, err := a.createOutputFile(outputFilePath, snapshot.info)
+	if err != nil {
+		return errors.Join(err, targetFile.Close(), release(), deltaFile.Close())
+	}
+
+	err = a.patchOutput(snapshot, delta, d, outputFile.File)
+	err = errors.Join(err, targetFile.Close(), release(), deltaFile.Close())
+
+	return a.closeOutput(outputFile, err)
+}
+
+// patchOutput applies the delta to the target file of the snapshot, writing the output file, and checks the target
+// wasn't modified meanwhile. A failure returns an *ApplyError, so the output file is discarded, see closeOutput.
+func (a *App) patchOutput(snapshot *inputSnapshot, delta io.Reader, d *deltaDecoder, outputFile *os.File) error {
+	err := a.patch(snapshot.f, snapshot.info.Size(), delta, d, outputFile)
+	if err == nil {
+		err = snapshot.check()
+	}
+	if err == nil {
+		return nil
+	}
+	size := int64(-1)
+	if d != nil && d.header.SourceGzip == nil {
+		size = d.header.SourceSize
+	}
+	written, _ := outputFile.Seek(0, io.SeekCurrent)
+
+	return &ApplyError{Written: written, Size: size, Err: err}
+}
+
+// patch applies the delta to the target and writes the output file, the delta being decoded by d, or, for a nil d,
+// being a librsync delta.
+func (a *App) patch(target io.ReaderAt, targetSize int64, delta io.Reader, d *deltaDecoder, outputFile *os.File) error {
+	if d == nil {
+		return a.applyLibrsync(target, targetSize, delta, a.withWriteProgress(a.limitWriter(outputFile), "patch", 0))
+	}
+	if d.header.SourceGzip != nil {
+		// the output is compressed, so its size is unknown
+		return a.apply(target, targetSize, d, a.withWriteProgress(a.limitWriter(outputFile), "patch", 0))
+	}
+	output := a.withWriteProgress(a.limitWriter(outputFile), "patch", d.header.SourceSize)
+	if a.diffEngine.sparse {
+		// the zero runs are left as holes, so the file is not preallocated
+		return a.apply(target, targetSize, d, &sparseWriter{f: outputFile, bw: bufio.NewWriter(output)})
+	}
+	err := preallocate(outputFile, d.header.SourceSize)
+	if err != nil {
+		return err
+	}
+
+	return a.apply(target, targetSize, d, output)
+}
+
+// readDeltaHeader reads the header of a delta, and returns the decoder of its operations.
+func (a *App) readDeltaHeader(delta io.Reader) (d *deltaDecoder, err error) {
+	span := a.startSpan("read")
+	defer func() { span.end(err) }()
+
+	return newDeltaDecoder(delta, a.diffEngine.limits)
+}
+
+// applyLibrsync applies the librsync delta to the target, and writes the output.
+func (a *App) applyLibrsync(target io.ReaderAt, targetSize int64, delta io.Reader, output io.Writer) (err error) {
+	span := a.startSpan("apply")
+	defer func() { span.end(err) }()
+
+	return a.diffEngine.applyLibrsync(target, targetSize, delta, output)
+}
+
+// apply is the lower layer that applies the operations decoded by d and checks the output size. The target of a delta
+// of its uncompressed content is decompressed first, and the output of a delta of a gzip source is compressed, see
+// WithGzip.
+func (a *App) apply(target io.ReaderAt, targetSize int64, d *deltaDecoder, output io.Writer) (err error) {
+	span := a.startSpan("apply")
+	defer func() { span.end(err) }()
+	content, contentSize := target, targetSize
+	if d.header.GunzippedTarget {
+		var release func() error
+		content, contentSize, release, err = gunzipTemp(target, targetSize)
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, release()) }()
+	}
+	if d.header.SourceGzip == nil {
+		return a.applyOperations(content, contentSize, d, output)
+	}
+	zw, err := d.header.SourceGzip.newWriter(output)
+	if err != nil {
+		return err
+	}
+	err = a.applyOperations(content, contentSize, d, zw)
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// applyOperations applies the operations decoded by d and checks the output size.
+// A sparseWriter output is buffered by itself, so it receives the zero runs.
+func (a *App) applyOperations(target io.ReaderAt, targetSize int64, d *deltaDecoder, output io.Writer) error {
+	var bw interface {
+		io.Writer
+		Flush() error
+	}
+	bw, ok := output.(*sparseWriter)
+	if !ok {
+		bw = bufio.NewWriter(output)
+	}
+	blockSize, err := a.diffEngine.deltaBlockSize(d.header, targetSize)
+	if err != nil {
+		return err
+	}
+	cw := &countingWriter{w: bw}
+	blockBuf := getBuffer(blockSize)
+	defer putBuffer(blockBuf)
+	a.diffEngine.patchStats = PatchStats{}
+	layout := targetLayout{size: targetSize, blockSize: blockSize, partSize: d.header.SecondPassBlockSize}
+	err = d.forEach(func(op Operation) error {
+		return a.diffEngine.applyOperation(target, layout, op, *blockBuf, cw)
+	})
+	if err != nil {
+		return err
+	}
+	if cw.n != d.header.SourceSize {
+		return markError(
+			ErrVerification,
+			fmt.Errorf("the delta rebuilt %v bytes, but the source has %v bytes", cw.n, d.header.SourceSize),
+		)
+	}
+
+	return bw.Flush()
+}
+
+// applyOperation writes the part of the source described by op: its literal data, followed by the target block,
+// if it's kept, updated, copied, or a second pass part, or its zero run. The block is located by the layout, and read
+// from the target into blockBuf, which must have the block size.
+func (r *rDiff) applyOperation(target io.ReaderAt, layout targetLayout, op Operation, blockBuf []byte, output io.Writer) error {
+	if layout.blockSize <= 0 {
+		return fmt.Errorf("invalid block size: %v", layout.blockSize)
+	}
+	if op.Type > OpBlockPart {
+		return markError(ErrCorrupt, fmt.Errorf("invalid operation type: %v", op.Type))
+	}
+	if op.Type == OpBlockZero {
+		return r.applyZeros(op, output)
+	}
+	_, err := output.Write(op.Data)
+	if err != nil {
+		return err
+	}
+	r.patchStats.LiteralBytes += int64(len(op.Data))
+	if !op.Type.copiesBlock() && op.Type != OpBlockPart {
+		return nil
+	}
+
+	off, length, ok := layout.extent(op)
+	if !ok || length > int64(len(blockBuf)) {
+		return markError(ErrCorrupt, fmt.Errorf("invalid block index: %v, the target has %v bytes", op.BlockIndex, layout.size))
+	}
+	block := blockBuf[:length]
+	n, err := target.ReadAt(block, off)
+	if n < len(block) {
+		if err == nil || errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("reading the target block %v: %w", op.BlockIndex, err)
+	}
+	_, err = output.Write(block)
+	if err != nil {
+		return err
+	}
+	r.patchStats.CopiedBlocks++
+	r.patchStats.CopiedBytes += int64(len(block))
+
+	return nil
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err
+}
+
+// WriteZeros writes n zero bytes to w, see writeZeros.
+func (cw *countingWriter) WriteZeros(n int64) error {
+	err := writeZeros(cw.w, n)
+	if err == nil {
+		cw.n += n
+	}
+
+	return err
+}
@@ -0,0 +1,246 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApp_Apply(t *testing.T) {
+	for _, tt := range rDiffE2ETests {
+		if tt.in.blockSize <= 0 {
+			continue
+		}
+		a := &App{diffEngine: newTestRDiff(tt.in.blockSize, rDiffE2EConfig{})}
+		var got bytes.Buffer
+		err := a.Apply(bytes.NewReader(tt.in.target), int64(len(tt.in.target)), bytes.NewReader(deltaBytes(t, DeltaHeader{SourceSize: int64(len(tt.in.source))}, tt.out)), &got)
+		if err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if !bytes.Equal(got.Bytes(), tt.in.source) {
+			t.Errorf("Apply() = %v, want %v", got.Bytes(), tt.in.source)
+		}
+	}
+}
+
+func TestRDiff_ApplyOperation_SourceOrder(t *testing.T) {
+	target := []byte("aaaabbbbccccdddd")
+	// the new data is before, in between and after the target blocks, and a run reaches the memory budget
+	source := []byte("new1aaaabbbbnew data reaching the budgetccccnew2dddd0new3")
+	a := New(4, WithMaxMemory(8))
+	r := a.diffEngine
+	sig, err := r.ComputeSignature(bytes.NewReader(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := r.ComputeDelta(bytes.NewReader(source), r.signatureHeader(), sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every operation extends the output, which is always a prefix of the source, so it can be streamed
+	var got bytes.Buffer
+	block := make([]byte, 4)
+	for i, op := range ops {
+		if err := r.applyOperation(bytes.NewReader(target), targetLayout{size: int64(len(target)), blockSize: 4}, op, block, &got); err != nil {
+			t.Fatalf("applyOperation(%+v) error = %v", op, err)
+		}
+		if !bytes.HasPrefix(source, got.Bytes()) {
+			t.Fatalf("the output after the operation %v(%+v) = %q, not a prefix of the source %q", i, op, got.Bytes(), source)
+		}
+	}
+	if !bytes.Equal(got.Bytes(), source) {
+		t.Errorf("the output = %q, want %q", got.Bytes(), source)
+	}
+}
+
+func TestApp_Apply_Invalid(t *testing.T) {
+	target := []byte{1, 2, 3, 4, 5, 6, 7}
+	for _, tt := range []struct {
+		name       string
+		blockSize  int
+		targetSize int64
+		sourceSize int64
+		// targetBlockSize is the block size recorded by the delta header
+		targetBlockSize int
+		delta           []Operation
+		// kind is the Err* sentinel matched by the error, if any
+		kind error
+	}{
+		{name: "unknown type", blockSize: 3, targetSize: 7, delta: []Operation{{Type: 9}}, kind: ErrCorrupt},
+		{name: "negative index", blockSize: 3, targetSize: 7, delta: []Operation{{Type: OpBlockKeep, BlockIndex: -1}}, kind: ErrCorrupt},
+		{name: "index after the target", blockSize: 3, targetSize: 7, delta: []Operation{{Type: OpBlockUpdate, BlockIndex: 3}}, kind: ErrCorrupt},
+		{name: "target shorter than its size", blockSize: 3, targetSize: 9, delta: []Operation{{Type: OpBlockKeep, BlockIndex: 2}}},
+		{name: "invalid block size", blockSize: 3, targetSize: 7, sourceSize: 3, targetBlockSize: -1, delta: []Operation{{Type: OpBlockKeep}}, kind: ErrCorrupt},
+		{name: "block size mismatch", blockSize: 3, targetSize: 7, sourceSize: 4, targetBlockSize: 4, delta: []Operation{{Type: OpBlockKeep}}, kind: ErrVerification},
+		{name: "source size mismatch", blockSize: 3, targetSize: 7, sourceSize: 4, delta: []Operation{{Type: OpBlockKeep}}, kind: ErrVerification},
+	} {
+		a := &App{diffEngine: newTestRDiff(tt.blockSize, rDiffE2EConfig{})}
+		a.diffEngine.blockSizePinned = true
+		header := DeltaHeader{SourceSize: tt.sourceSize, TargetBlockSize: tt.targetBlockSize}
+		var got bytes.Buffer
+		err := a.Apply(bytes.NewReader(target), tt.targetSize, bytes.NewReader(deltaBytes(t, header, tt.delta)), &got)
+		if err == nil {
+			t.Errorf("%v: Apply() error = nil, want an error", tt.name)
+		}
+		if tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Errorf("%v: Apply() error = %v, want a %v error", tt.name, err, tt.kind)
+		}
+	}
+}
+
+func TestApp_DynamicBlockSize(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := randomBytes(1, 100<<10)
+	source := append(bytes.Clone(target[:40<<10]), randomBytes(2, 10<<10)...)
+	source = append(source, target[50<<10:]...)
+	for name, data := range map[string][]byte{"target": target, "source": source, "inplace": target} {
+		if err := os.WriteFile(path(name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// every step uses its own App, so the block size is only known from the signature, then from the delta
+	if err := New(0).Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(0).Delta(path("signature"), path("source"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(0).Patch(path("target"), path("delta"), path("output")); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	checkFile(t, path("output"), source, "Patch()")
+	delta, err := os.ReadFile(path("delta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var applied bytes.Buffer
+	if err := New(0).Apply(bytes.NewReader(target), int64(len(target)), bytes.NewReader(delta), &applied); err != nil || !bytes.Equal(applied.Bytes(), source) {
+		t.Errorf("Apply() doesn't rebuild the source, error = %v", err)
+	}
+	out := make([]byte, len(source))
+	if _, err := New(0).ApplyAt(bytes.NewReader(target), int64(len(target)), bytes.NewReader(delta), writerAt(out), 0); err != nil || !bytes.Equal(out, source) {
+		t.Errorf("ApplyAt() doesn't rebuild the source, error = %v", err)
+	}
+	if err := New(0).PatchInPlace(path("inplace"), path("delta"), path("journal")); err != nil {
+		t.Fatalf("PatchInPlace() error = %v", err)
+	}
+	checkFile(t, path("inplace"), source, "PatchInPlace()")
+	// a configured block size must be the one of the delta
+	if err := New(1024).Patch(path("target"), path("delta"), path("output2")); !errors.Is(err, ErrVerification) {
+		t.Errorf("Patch() using another block size error = %v, want %v", err, ErrVerification)
+	}
+}
+
+func TestApp_Patch(t *testing.T) {
+	for _, tt := range rDiffE2ETests {
+		if len(tt.in.target) < 2*tt.in.blockSize || tt.in.blockSize <= 0 {
+			continue
+		}
+		dir := t.TempDir()
+		target, source := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+		sig, delta, output := filepath.Join(dir, "signature"), filepath.Join(dir, "delta"), filepath.Join(dir, "output")
+		if err := os.WriteFile(target, tt.in.target, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(source, tt.in.source, 0666); err != nil {
+			t.Fatal(err)
+		}
+		app := New(tt.in.blockSize)
+		if err := app.Signature(target, sig); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.Delta(sig, source, delta); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.Patch(target, delta, output); err != nil {
+			t.Fatalf("Patch() error = %v", err)
+		}
+		got, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, tt.in.source) {
+			t.Errorf("Patch() output = %v, want %v", got, tt.in.source)
+		}
+		if err = app.Patch(target, delta, output); err == nil {
+			t.Errorf("Patch() error = nil, want an error for an existing output")
+		}
+	}
+}
+
+func TestApp_Patch_Failed(t *testing.T) {
+	dir := t.TempDir()
+	target, delta, output := filepath.Join(dir, "target"), filepath.Join(dir, "delta"), filepath.Join(dir, "output")
+	if err := os.WriteFile(target, []byte("0123456789"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	// the delta writes literal data, then copies a block beyond the end of the target
+	ops := []Operation{{Type: OpBlockNew, Data: []byte("abc")}, {Type: OpBlockKeep, BlockIndex: 9}}
+	if err := os.WriteFile(delta, deltaBytes(t, DeltaHeader{SourceSize: 8}, ops), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	err := New(5).Patch(target, delta, output)
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) || !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Patch() error = %v, want an *ApplyError matching %v", err, ErrCorrupt)
+	}
+	if !applyErr.RolledBack || applyErr.RollbackErr != nil || applyErr.Size != 8 {
+		t.Errorf("Patch() error = %+v, want a rolled back patch of 8 bytes", applyErr)
+	}
+	if _, err := os.Stat(output); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Patch() left the output file, %v", err)
+	}
+}
+
+// TestApp_Patch_ReadOnlyTarget patches a read-only target, in a read-only directory, as the running version of an
+// A/B update, to the other slot, and checks it's left as it was, whether the patch succeeds or not.
+func TestApp_Patch_ReadOnlyTarget(t *testing.T) {
+	const blockSize = 32
+	slotA, slotB := t.TempDir(), t.TempDir()
+	target := randomBytes(1, 20*blockSize)
+	source := append(bytes.Clone(target[blockSize:]), "new"...)
+	targetPath, deltaPath, corruptPath := filepath.Join(slotA, "app"), filepath.Join(slotB, "delta"), filepath.Join(slotB, "corrupt")
+	if err := os.WriteFile(targetPath, target, 0555); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(deltaPath, testDelta(t, New(blockSize), target, source), 0666); err != nil {
+		t.Fatal(err)
+	}
+	ops := []Operation{{Type: OpBlockNew, Data: []byte("abc")}, {Type: OpBlockKeep, BlockIndex: 99}}
+	if err := os.WriteFile(corruptPath, deltaBytes(t, DeltaHeader{SourceSize: 8}, ops), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(slotA, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(slotA, 0777) })
+	before, err := os.Stat(targetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := New(blockSize, WithTargetAttrs(FileAttrMode))
+	if err := app.Patch(targetPath, deltaPath, filepath.Join(slotB, "app")); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	checkFile(t, filepath.Join(slotB, "app"), source, "Patch()")
+	if err := app.Patch(targetPath, corruptPath, filepath.Join(slotB, "failed")); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Patch() of a corrupt delta error = %v, want %v", err, ErrCorrupt)
+	}
+	checkFile(t, targetPath, target, "the target")
+	after, err := os.Stat(targetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Mode() != before.Mode() || !after.ModTime().Equal(before.ModTime()) || after.Size() != before.Size() {
+		t.Errorf("the target info = %v, %v, %v, want %v, %v, %v",
+			after.Mode(), after.ModTime(), after.Size(), before.Mode(), before.ModTime(), before.Size())
+	}
+	if names := dirNames(t, slotA); len(names) != 1 {
+		t.Errorf("the target directory holds %v, want only the target", names)
+	}
+}
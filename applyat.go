@@ -0,0 +1,90 @@
+package rdiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ApplyAt rebuilds the source from the target, which has the given size, and the delta, as Apply does, and writes it
+// to output at offset, the byte i of the source being written at offset+i, so the output can be any storage written
+// by offset, ex: a partition, a disk image, or a block device opened for writing, without an intermediate file.
+// The zero runs of the delta are written, not skipped, so the source replaces whatever the output held, while the
+// bytes of the output following the end of the source are left as they are.
+// The output must not overlap the target, otherwise a target block may be overwritten before it's copied.
+// It returns the number of bytes written, and a non-nil error as Apply does.
+func (a *App) ApplyAt(target io.ReaderAt, targetSize int64, delta io.Reader, output io.WriterAt, offset int64) (int64, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid output offset: %v", offset)
+	}
+	w := io.NewOffsetWriter(output, offset)
+	err := a.Apply(target, targetSize, delta, w)
+	n, _ := w.Seek(0, io.SeekCurrent)
+
+	return n, err
+}
+
+// PatchDevice rebuilds the source from the target file(targetFilePath) and the delta file(deltaFilePath), as Patch
+// does, and writes it over the start of the output(outputPath), which must exist, ex: the inactive partition of an
+// A/B update, written from the active one. The output is neither created, nor truncated, nor preallocated, and it's
+// synced before PatchDevice returns. The target and the output can be block devices, whose size is found by seeking
+// to their end, and they must not be the same file.
+// If the target is a regular file modified while it's read, a non-nil error matching ErrModified is returned.
+func (a *App) PatchDevice(targetFilePath string, deltaFilePath string, outputPath string) (err error) {
+	target, err := os.Open(targetFilePath)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, target.Close()) }()
+	snapshot, err := newInputSnapshot(target)
+	if err != nil {
+		return err
+	}
+	targetSize, err := deviceSize(target, snapshot.info)
+	if err != nil {
+		return err
+	}
+	delta, err := os.Open(deltaFilePath)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, delta.Close()) }()
+	output, err := os.OpenFile(outputPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, output.Close()) }()
+	outputInfo, err := output.Stat()
+	if err != nil {
+		return err
+	}
+	if os.SameFile(snapshot.info, outputInfo) {
+		return fmt.Errorf("the output %v is the target", outputPath)
+	}
+
+	_, err = a.ApplyAt(target, targetSize, delta, output, 0)
+	if err == nil && snapshot.info.Mode().IsRegular() {
+		err = snapshot.check()
+	}
+	if err != nil {
+		return err
+	}
+
+	return output.Sync()
+}
+
+// deviceSize returns the size of f, which has the given info: the size of a regular file, or the size found by
+// seeking to the end of a device, whose info reports no size.
+func deviceSize(f *os.File, info os.FileInfo) (int64, error) {
+	if info.Mode().IsRegular() {
+		return info.Size(), nil
+	}
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+
+	return size, err
+}
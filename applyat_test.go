@@ -0,0 +1,112 @@
+package rdiff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writerAt is an io.WriterAt over a fixed size buffer, as a partition.
+type writerAt []byte
+
+func (w writerAt) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > int64(len(w)) {
+		return 0, os.ErrInvalid
+	}
+
+	return copy(w[off:], p), nil
+}
+
+// testDelta returns the delta of source against target, computed by app.
+func testDelta(t *testing.T, app *App, target, source []byte) []byte {
+	t.Helper()
+	var signature, delta bytes.Buffer
+	if err := app.SignatureAt(bytes.NewReader(target), int64(len(target)), &signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.DeltaStream(&signature, bytes.NewReader(source), int64(len(source)), &delta); err != nil {
+		t.Fatal(err)
+	}
+
+	return delta.Bytes()
+}
+
+func TestApp_ApplyAt(t *testing.T) {
+	const blockSize = 32
+	target := randomBytes(1, 40*blockSize)
+	// the source moves blocks around, and has a zero run the output must receive
+	source := append(append(bytes.Clone(target[20*blockSize:]), make([]byte, 4*blockSize)...), target[:10*blockSize+5]...)
+	delta := testDelta(t, New(blockSize, WithSparse(true)), target, source)
+
+	tests := []struct {
+		name    string
+		size    int
+		offset  int64
+		wantErr bool
+	}{
+		{name: "at the start", size: len(source), offset: 0},
+		{name: "at an offset, before trailing data", size: len(source) + 3*blockSize, offset: blockSize},
+		{name: "too small", size: len(source) - 1, offset: 0, wantErr: true},
+		{name: "negative offset", size: len(source), offset: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := writerAt(bytes.Repeat([]byte{0xAA}, tt.size))
+			n, err := New(blockSize).ApplyAt(bytes.NewReader(target), int64(len(target)), bytes.NewReader(delta), out, tt.offset)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("ApplyAt() error = nil, want non-nil")
+				}
+				return
+			}
+			if err != nil || n != int64(len(source)) {
+				t.Fatalf("ApplyAt() = %v, %v, want %v bytes written", n, err, len(source))
+			}
+			if !bytes.Equal(out[tt.offset:tt.offset+n], source) {
+				t.Error("ApplyAt() didn't write the source at the offset")
+			}
+			untouched := append(bytes.Clone(out[:tt.offset]), out[tt.offset+n:]...)
+			if !bytes.Equal(untouched, bytes.Repeat([]byte{0xAA}, len(untouched))) {
+				t.Error("ApplyAt() wrote outside of the source")
+			}
+		})
+	}
+}
+
+func TestApp_PatchDevice(t *testing.T) {
+	const blockSize = 32
+	dir := t.TempDir()
+	target := randomBytes(1, 30*blockSize)
+	source := append([]byte("header"), target[:25*blockSize]...)
+	targetPath, deltaPath, outputPath := filepath.Join(dir, "target"), filepath.Join(dir, "delta"), filepath.Join(dir, "output")
+	if err := os.WriteFile(targetPath, target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(deltaPath, testDelta(t, New(blockSize), target, source), 0666); err != nil {
+		t.Fatal(err)
+	}
+	app := New(blockSize)
+	if err := app.PatchDevice(targetPath, deltaPath, outputPath); err == nil {
+		t.Error("PatchDevice() of a missing output error = nil, want non-nil")
+	}
+	if err := app.PatchDevice(targetPath, deltaPath, targetPath); err == nil {
+		t.Error("PatchDevice() over the target error = nil, want non-nil")
+	}
+
+	// the output is overwritten, and keeps its bytes following the source
+	partition := bytes.Repeat([]byte{0xAA}, len(source)+100)
+	if err := os.WriteFile(outputPath, partition, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.PatchDevice(targetPath, deltaPath, outputPath); err != nil {
+		t.Fatalf("PatchDevice() error = %v", err)
+	}
+	got, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(bytes.Clone(source), partition[len(source):]...); !bytes.Equal(got, want) {
+		t.Error("PatchDevice() output doesn't hold the source, followed by the previous bytes")
+	}
+}
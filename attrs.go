@@ -0,0 +1,91 @@
+package rdiff
+
+import (
+	"io/fs"
+	"os"
+	"time"
+)
+
+// FileAttrs is a set of file attributes, recorded by DeltaDir in the directory delta, and restored by PatchDir.
+type FileAttrs uint8
+
+const (
+	// FileAttrMode is the permission bits of the file, including the setuid, setgid and sticky bits.
+	FileAttrMode FileAttrs = 1 << iota
+	// FileAttrModTime is the modification time of the file.
+	FileAttrModTime
+	// FileAttrOwner is the user and group ids of the file, it's only recorded on Unix, and restoring it usually
+	// requires elevated privileges.
+	FileAttrOwner
+
+	// fileAttrsAll is the set of all the file attributes
+	fileAttrsAll = FileAttrMode | FileAttrModTime | FileAttrOwner
+	// fileModeBits are the mode bits recorded by FileAttrMode
+	fileModeBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+)
+
+// recordAttrs records the configured attributes of the source file into its directory delta entry.
+func (a *App) recordAttrs(entry *fileDeltaEntry, info fs.FileInfo) {
+	if a.attrs&FileAttrMode != 0 {
+		entry.Attrs |= FileAttrMode
+		entry.Mode = info.Mode() & fileModeBits
+	}
+	if a.attrs&FileAttrModTime != 0 {
+		entry.Attrs |= FileAttrModTime
+		entry.ModTime = info.ModTime().UnixNano()
+	}
+	if a.attrs&FileAttrOwner != 0 {
+		if uid, gid, ok := fileOwner(info); ok {
+			entry.Attrs |= FileAttrOwner
+			entry.UID, entry.GID = uid, gid
+		}
+	}
+}
+
+// restoreAttrs restores the attributes of a rebuilt file, which are both recorded in its entry and configured.
+// The owner is restored first, as changing it may clear the setuid and setgid bits, and the modification time
+// last, so it's not changed by the other updates.
+func (a *App) restoreAttrs(path string, entry fileDeltaEntry) error {
+	attrs := entry.Attrs & a.attrs
+	if attrs&FileAttrOwner != 0 {
+		err := os.Chown(path, entry.UID, entry.GID)
+		if err != nil {
+			return err
+		}
+	}
+	if attrs&FileAttrMode != 0 {
+		err := os.Chmod(path, entry.Mode)
+		if err != nil {
+			return err
+		}
+	}
+	if attrs&FileAttrModTime != 0 {
+		// the zero access time is left unchanged
+		return os.Chtimes(path, time.Time{}, time.Unix(0, entry.ModTime))
+	}
+
+	return nil
+}
+
+// setOutputAttrs sets the attributes of the output file, before any data is written to it: the ones of the target
+// file, if its info isn't nil, configured using WithTargetAttrs, then the mode configured using WithOutputMode.
+// The owner is set first, as changing it may clear the setuid and setgid bits.
+func (a *App) setOutputAttrs(f *os.File, target fs.FileInfo) error {
+	mode := a.outputMode
+	if target != nil && a.targetAttrs&FileAttrOwner != 0 {
+		if uid, gid, ok := fileOwner(target); ok {
+			err := f.Chown(uid, gid)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if target != nil && a.targetAttrs&FileAttrMode != 0 && mode == 0 {
+		mode = target.Mode() & fileModeBits
+	}
+	if mode == 0 {
+		return nil
+	}
+
+	return f.Chmod(mode)
+}
@@ -0,0 +1,204 @@
+package rdiff
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// patchDirAttrs rebuilds the source directory, using the app, and returns the rebuilt directory and the file deltas.
+func patchDirAttrs(t *testing.T, app *App, target, source string) (string, []FileDelta) {
+	t.Helper()
+	dir := t.TempDir()
+	signature, delta, output := filepath.Join(dir, "signature"), filepath.Join(dir, "delta"), filepath.Join(dir, "output")
+	if err := app.SignatureDir(target, signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.DeltaDir(signature, source, delta); err != nil {
+		t.Fatalf("DeltaDir() error = %v", err)
+	}
+	if err := app.PatchDir(target, delta, output); err != nil {
+		t.Fatalf("PatchDir() error = %v", err)
+	}
+	f, err := os.Open(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, files, err := ReadDirDelta(f)
+	if err != nil {
+		t.Fatalf("ReadDirDelta() error = %v", err)
+	}
+
+	return output, files
+}
+
+func TestApp_PatchDir_FileAttrs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the permission bits are not supported")
+	}
+	target, source := t.TempDir(), t.TempDir()
+	content := []byte("#!/bin/sh\necho rdiff\n")
+	writeTree(t, target, map[string][]byte{"same.sh": content, "changed.sh": content})
+	writeTree(t, source, map[string][]byte{"same.sh": content, "changed.sh": append(content, "exit 0\n"...), "new.sh": content})
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	for _, name := range []string{"same.sh", "changed.sh", "new.sh"} {
+		p := filepath.Join(source, name)
+		if err := os.Chmod(p, 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name      string
+		attrs     FileAttrs
+		wantMode  bool
+		wantMtime bool
+	}{
+		{name: "default", attrs: FileAttrMode | FileAttrModTime, wantMode: true, wantMtime: true},
+		{name: "mode", attrs: FileAttrMode, wantMode: true},
+		{name: "none", attrs: 0},
+		{name: "all", attrs: FileAttrMode | FileAttrModTime | FileAttrOwner, wantMode: true, wantMtime: true},
+	} {
+		output, files := patchDirAttrs(t, New(4, WithFileAttrs(tt.attrs)), target, source)
+		for _, file := range files {
+			if file.Attrs != tt.attrs {
+				t.Errorf("%v: ReadDirDelta() %v attributes = %v, want %v", tt.name, file.Path, file.Attrs, tt.attrs)
+			}
+			info, err := os.Stat(filepath.Join(output, file.Path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.Mode().Perm() == 0750; got != tt.wantMode {
+				t.Errorf("%v: PatchDir() %v mode = %v, want it restored: %v", tt.name, file.Path, info.Mode(), tt.wantMode)
+			}
+			if got := info.ModTime().Equal(modTime); got != tt.wantMtime {
+				t.Errorf("%v: PatchDir() %v mtime = %v, want it restored: %v", tt.name, file.Path, info.ModTime(), tt.wantMtime)
+			}
+		}
+	}
+}
+
+func TestApp_PatchDir_RecordedFileAttrs(t *testing.T) {
+	target, source := t.TempDir(), t.TempDir()
+	writeTree(t, source, map[string][]byte{"new": []byte("content")})
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(source, "new"), modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	signature, delta, output := filepath.Join(dir, "signature"), filepath.Join(dir, "delta"), filepath.Join(dir, "output")
+	if err := New(4).SignatureDir(target, signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(4).DeltaDir(signature, source, delta); err != nil {
+		t.Fatal(err)
+	}
+	// the recorded modification time is not restored, as it's not configured
+	if err := New(4, WithFileAttrs(FileAttrMode)).PatchDir(target, delta, output); err != nil {
+		t.Fatalf("PatchDir() error = %v", err)
+	}
+	info, err := os.Stat(filepath.Join(output, "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ModTime().Equal(modTime) {
+		t.Errorf("PatchDir() restored the modification time, want it left as is")
+	}
+}
+
+func TestApp_OutputAttrs(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the permission bits are not supported")
+	}
+	const blockSize = 32
+	tests := []struct {
+		name string
+		opts []Option
+		// wantSig is the mode of the signature and the delta, and wantOutput the one of the patch output, 0 meaning
+		// the default one
+		wantSig, wantOutput os.FileMode
+	}{
+		{name: "default"},
+		{name: "output mode", opts: []Option{WithOutputMode(0660)}, wantSig: 0660, wantOutput: 0660},
+		{name: "target mode", opts: []Option{WithTargetAttrs(FileAttrMode)}, wantOutput: 0751},
+		{name: "output mode overriding the target's", opts: []Option{WithTargetAttrs(FileAttrMode | FileAttrOwner), WithOutputMode(0700)}, wantSig: 0700, wantOutput: 0700},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target, source := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+			sig, delta, output := filepath.Join(dir, "signature"), filepath.Join(dir, "delta"), filepath.Join(dir, "output")
+			if err := os.WriteFile(target, randomBytes(1, 10*blockSize), 0666); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(target, 0751); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(source, randomBytes(2, 10*blockSize), 0666); err != nil {
+				t.Fatal(err)
+			}
+			app := New(blockSize, tt.opts...)
+			if err := app.Signature(target, sig); err != nil {
+				t.Fatal(err)
+			}
+			if err := app.Delta(sig, source, delta); err != nil {
+				t.Fatal(err)
+			}
+			if err := app.Patch(target, delta, output); err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range map[string]os.FileMode{sig: tt.wantSig, delta: tt.wantSig, output: tt.wantOutput} {
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want == 0 {
+					want = 0666 &^ umask(t)
+				}
+				if got := info.Mode().Perm(); got != want {
+					t.Errorf("%v has the mode %v, want %v", filepath.Base(path), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApp_createOutputFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the permission bits are not supported")
+	}
+	o, err := New(0, WithOutputMode(0600)).createOutputFile(filepath.Join(t.TempDir(), "output"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.discard()
+	// the partial output has the mode before any data is written to it
+	info, err := o.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Mode().Perm(); got != 0600 {
+		t.Errorf("the partial output has the mode %v, want %v", got, os.FileMode(0600))
+	}
+}
+
+// umask returns the process umask, as applied to the files created.
+func umask(t *testing.T) os.FileMode {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "umask")
+	if err := os.WriteFile(path, nil, 0777); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return 0777 &^ info.Mode().Perm()
+}
@@ -0,0 +1,155 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BasisCheck is the check of the target against the signature a delta was computed against, before the delta is
+// applied to it, see WithBasisCheck.
+type BasisCheck byte
+
+const (
+	// BasisCheckNone applies the delta without checking the target, and it's the default check.
+	BasisCheckNone BasisCheck = iota
+	// BasisCheckSpot checks the target has the size of the signature's one, and hashes a sample of its blocks, spread
+	// over it, so it reads a few blocks only, but it misses the changes of the blocks not sampled.
+	BasisCheckSpot
+	// BasisCheckFull hashes every target block, as Verify does.
+	BasisCheckFull
+)
+
+// basisSpotBlocks is the number of target blocks hashed by BasisCheckSpot, at most.
+const basisSpotBlocks = 16
+
+// String returns the name of the check.
+func (c BasisCheck) String() string {
+	switch c {
+	case BasisCheckNone:
+		return "none"
+	case BasisCheckSpot:
+		return "spot"
+	case BasisCheckFull:
+		return "full"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler, using the name of the check.
+func (c BasisCheck) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, it accepts the names returned by String,
+// and returns a non-nil error for an unknown name.
+func (c *BasisCheck) UnmarshalText(text []byte) error {
+	for _, check := range []BasisCheck{BasisCheckNone, BasisCheckSpot, BasisCheckFull} {
+		if string(text) == check.String() {
+			*c = check
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown basis check: %q", text)
+}
+
+// checkBasis checks the target, which has the given size, matches the signature configured using WithBasisCheck, if
+// any, the signature's hash algorithms and block size being adopted, as Verify does. The uncompressed content of a
+// gzip target is checked against the signature of an uncompressed target, see WithGzip. A target which doesn't match
+// returns a non-nil error matching ErrVerification.
+func (a *App) checkBasis(target io.ReaderAt, targetSize int64) (err error) {
+	if a.basisCheck == BasisCheckNone {
+		return nil
+	}
+	span := a.startSpan("check")
+	defer func() { span.end(err) }()
+	header, sig, err := a.loadSignature(a.basisSignaturePath)
+	if err != nil {
+		return err
+	}
+	r, err := a.diffEngine.negotiated(header)
+	if err != nil {
+		return err
+	}
+	if r.blockSize <= 0 {
+		return errors.New("the signature doesn't record its block size, it must be configured")
+	}
+	if header.Gunzipped {
+		var release func() error
+		target, targetSize, release, err = gunzipTemp(target, targetSize)
+		if err != nil {
+			return err
+		}
+		defer func() { err = errors.Join(err, release()) }()
+	}
+	err = a.basisMismatch(r, target, targetSize, header, &sig)
+	if err != nil {
+		return fmt.Errorf("checking the target against the signature %v: %w", a.basisSignaturePath, err)
+	}
+
+	return nil
+}
+
+// basisMismatch returns a non-nil error matching ErrVerification if the target doesn't match the signature having
+// the header, using the configured check, and the engine r, negotiated against the signature, and a non-nil error if
+// the target can't be read.
+func (a *App) basisMismatch(r *rDiff, target io.ReaderAt, targetSize int64, header SignatureHeader, sig *signatureTable) error {
+	blockSize := int64(r.blockSize)
+	if (header.TargetSize > 0 && header.TargetSize != targetSize) || int64(sig.len()) != (targetSize+blockSize-1)/blockSize {
+		err := fmt.Errorf("the target has %v bytes, but the signature has %v blocks of %v bytes", targetSize, sig.len(), blockSize)
+		return markError(ErrVerification, err)
+	}
+	if a.basisCheck == BasisCheckSpot {
+		return spotMismatch(r, target, sig)
+	}
+	t, err := r.ComputeSignatureAt(target, targetSize)
+	if err != nil {
+		return err
+	}
+	if mismatches := mismatchedBlocks(sig, &t); len(mismatches) > 0 {
+		err = fmt.Errorf("%v blocks don't match, the first one being the block %v", len(mismatches), mismatches[0])
+		return markError(ErrVerification, err)
+	}
+
+	return nil
+}
+
+// spotMismatch hashes the target blocks sampled by BasisCheckSpot, see spotBlocks, and returns a non-nil error matching
+// ErrVerification for the first one which doesn't match the signature, which has the target's number of blocks, using
+// the engine r, negotiated against the signature.
+func spotMismatch(r *rDiff, target io.ReaderAt, sig *signatureTable) error {
+	block := make([]byte, r.blockSize)
+	for _, i := range spotBlocks(sig.len()) {
+		n, err := target.ReadAt(block, int64(i)*int64(len(block)))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		t := r.hashBlocks(block[:n])
+		if t.len() != 1 || t.WeakHashes[0] != sig.WeakHashes[i] || !bytes.Equal(t.strongHash(0), sig.strongHash(i)) {
+			return markError(ErrVerification, fmt.Errorf("the block %v doesn't match", i))
+		}
+	}
+
+	return nil
+}
+
+// spotBlocks returns the indices of the blocks hashed by BasisCheckSpot, out of n blocks: the first one, the last
+// one, and the ones evenly spread between them, basisSpotBlocks at most, ascending.
+func spotBlocks(n int) []int {
+	if n <= basisSpotBlocks {
+		out := make([]int, n)
+		for i := range out {
+			out[i] = i
+		}
+		return out
+	}
+	out := make([]int, basisSpotBlocks)
+	for i := range out {
+		out[i] = i * (n - 1) / (basisSpotBlocks - 1)
+	}
+
+	return out
+}
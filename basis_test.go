@@ -0,0 +1,135 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestApp_Patch_BasisCheck(t *testing.T) {
+	const blockSize = 32
+	dir := t.TempDir()
+	target := randomBytes(1, 40*blockSize+5)
+	source := append([]byte("header"), target[:30*blockSize]...)
+	targetPath, sigPath, deltaPath := filepath.Join(dir, "target"), filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	if err := os.WriteFile(targetPath, target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(blockSize).Signature(targetPath, sigPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(deltaPath, testDelta(t, New(blockSize), target, source), 0666); err != nil {
+		t.Fatal(err)
+	}
+	// the block 0 is sampled by the spot check, while the block 1 isn't
+	sampled, unsampled := bytes.Clone(target), bytes.Clone(target)
+	sampled[3]++
+	unsampled[blockSize+3]++
+
+	tests := []struct {
+		name    string
+		target  []byte
+		check   BasisCheck
+		wantErr error
+	}{
+		{name: "no check, modified", target: sampled, check: BasisCheckNone},
+		{name: "spot, unchanged", target: target, check: BasisCheckSpot},
+		{name: "spot, sampled block modified", target: sampled, check: BasisCheckSpot, wantErr: ErrVerification},
+		{name: "spot, unsampled block modified", target: unsampled, check: BasisCheckSpot},
+		{name: "spot, truncated", target: target[:39*blockSize], check: BasisCheckSpot, wantErr: ErrVerification},
+		{name: "full, unchanged", target: target, check: BasisCheckFull},
+		{name: "full, unsampled block modified", target: unsampled, check: BasisCheckFull, wantErr: ErrVerification},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(targetPath, tt.target, 0666); err != nil {
+				t.Fatal(err)
+			}
+			outputPath := filepath.Join(t.TempDir(), "output")
+			app := New(blockSize, WithBasisCheck(sigPath, tt.check))
+			err := app.Patch(targetPath, deltaPath, outputPath)
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
+				t.Fatalf("Patch() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if _, err := os.Stat(outputPath); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("Patch() of a mismatched target created the output, %v", err)
+				}
+			} else if bytes.Equal(tt.target, target) {
+				checkFile(t, outputPath, source, "Patch()")
+			}
+
+			// Apply checks the target the same way
+			delta, err := os.ReadFile(deltaPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			err = app.Apply(bytes.NewReader(tt.target), int64(len(tt.target)), bytes.NewReader(delta), &out)
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
+				t.Errorf("Apply() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil && out.Len() != 0 {
+				t.Errorf("Apply() of a mismatched target wrote %v bytes", out.Len())
+			}
+		})
+	}
+}
+
+func TestApp_PatchInPlace_BasisCheck(t *testing.T) {
+	const blockSize = 32
+	target, sources := inPlaceVersions(blockSize)
+	targetPath, deltaPath, journalPath := writeInPlaceFiles(t, blockSize, target, sources["changed"])
+	sigPath := filepath.Join(t.TempDir(), "signature")
+	if err := New(blockSize).Signature(targetPath, sigPath); err != nil {
+		t.Fatal(err)
+	}
+	modified := bytes.Clone(target)
+	modified[0]++
+	if err := os.WriteFile(targetPath, modified, 0666); err != nil {
+		t.Fatal(err)
+	}
+	err := New(blockSize, WithBasisCheck(sigPath, BasisCheckSpot)).PatchInPlace(targetPath, deltaPath, journalPath)
+	if !errors.Is(err, ErrVerification) {
+		t.Fatalf("PatchInPlace() of a modified target error = %v, want %v", err, ErrVerification)
+	}
+	checkFile(t, targetPath, modified, "PatchInPlace() of a modified target")
+	if _, err := os.Stat(journalPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("PatchInPlace() of a modified target created the journal, %v", err)
+	}
+}
+
+func TestSpotBlocks(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []int
+	}{
+		{n: 0, want: []int{}},
+		{n: 3, want: []int{0, 1, 2}},
+		{n: basisSpotBlocks, want: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+		{n: 40, want: []int{0, 2, 5, 7, 10, 13, 15, 18, 20, 23, 26, 28, 31, 33, 36, 39}},
+	}
+	for _, tt := range tests {
+		if got := spotBlocks(tt.n); !cmp.Equal(got, tt.want) {
+			t.Errorf("spotBlocks(%v) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestBasisCheck_UnmarshalText(t *testing.T) {
+	for _, want := range []BasisCheck{BasisCheckNone, BasisCheckSpot, BasisCheckFull} {
+		var got BasisCheck
+		if err := got.UnmarshalText([]byte(want.String())); err != nil || got != want {
+			t.Errorf("UnmarshalText(%q) = %v, %v, want %v", want, got, err, want)
+		}
+	}
+	var c BasisCheck
+	if err := c.UnmarshalText([]byte("partial")); err == nil {
+		t.Error("UnmarshalText() of an unknown check error = nil, want non-nil")
+	}
+}
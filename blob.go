@@ -0,0 +1,188 @@
+package rdiff
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// blobSkipMax is the max gap, in bytes, between two reads of a blob target which is skipped by reading the current
+// range, instead of requesting a new one.
+const blobSkipMax = 256 << 10
+
+// BlobStore is an object storage(ex: S3, GCS or Azure Blob Storage) holding the inputs and outputs of the
+// SignatureBlob, DeltaBlob and PatchBlob calls, which are identified by their keys. The implementations must be safe
+// for concurrent use, and the errors for a missing object should match fs.ErrNotExist, using errors.Is.
+type BlobStore interface {
+	// Get returns the content of the object, and its size.
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	// GetRange returns the content of the object starting at offset, up to length bytes, ex: using an HTTP range
+	// request.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Put stores the content read from r, until io.EOF, as the object, replacing any object with the same key.
+	// It must not store the object if r returns another error, as the content is incomplete.
+	Put(ctx context.Context, key string, r io.Reader) error
+}
+
+// SignatureBlob computes the signature of the target object(targetKey) of the store, and stores it as the signature
+// object(signatureKey), the same way Signature does for files, the target being streamed, and the signature being
+// stored while it's computed, so neither of them is staged locally.
+func (a *App) SignatureBlob(ctx context.Context, store BlobStore, targetKey, signatureKey string) error {
+	err := a.checkSignatureHashers()
+	if err != nil {
+		return err
+	}
+	target, size, err := store.Get(ctx, targetKey)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	if size <= 0 {
+		return errors.New("the target is empty")
+	}
+	a.diffEngine.blockSize, err = decideBlockSize(a.diffEngine.blockSize, size)
+	if err != nil {
+		return err
+	}
+
+	return putBlob(ctx, store, signatureKey, func(w io.Writer) error {
+		return a.signature(a.withReadProgress(target, "signature", size), size, w)
+	})
+}
+
+// DeltaBlob computes the delta of the source object(sourceKey) of the store against the signature object
+// (signatureKey), and stores it as the delta object(deltaKey), the same way Delta does for files, the signature and
+// the source being streamed, and the delta being stored while it's computed.
+func (a *App) DeltaBlob(ctx context.Context, store BlobStore, signatureKey, sourceKey, deltaKey string) error {
+	err := a.diffEngine.checkHashers()
+	if err != nil {
+		return err
+	}
+	signature, _, err := store.Get(ctx, signatureKey)
+	if err != nil {
+		return err
+	}
+	defer signature.Close()
+	source, size, err := store.Get(ctx, sourceKey)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	return putBlob(ctx, store, deltaKey, func(w io.Writer) error {
+		return a.delta(signature, a.withReadProgress(source, "delta", size), DeltaHeader{SourceSize: size}, w)
+	})
+}
+
+// PatchBlob rebuilds the source from the target object(targetKey) of the store and the delta object(deltaKey), and
+// stores it as the output object(outputKey), the same way Apply does. The target blocks are fetched using range
+// requests, the reads of the blocks which follow each other, as the delta operations are sorted, sharing a request,
+// so the target is not staged locally.
+func (a *App) PatchBlob(ctx context.Context, store BlobStore, targetKey, deltaKey, outputKey string) error {
+	target, size, err := store.Get(ctx, targetKey)
+	if err != nil {
+		return err
+	}
+	ra := &blobReaderAt{ctx: ctx, store: store, key: targetKey, size: size, rc: target}
+	defer ra.close()
+	delta, _, err := store.Get(ctx, deltaKey)
+	if err != nil {
+		return err
+	}
+	defer delta.Close()
+
+	return putBlob(ctx, store, outputKey, func(w io.Writer) error {
+		return a.Apply(ra, size, bufio.NewReader(delta), w)
+	})
+}
+
+// putBlob stores the content written by fn as the object(key) of the store, while fn runs.
+// A failure of fn makes the store discard the object.
+func putBlob(ctx context.Context, store BlobStore, key string, fn func(w io.Writer) error) error {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := store.Put(ctx, key, pr)
+		// a failed Put makes the writes fail, instead of blocking
+		pr.CloseWithError(errors.Join(err, io.ErrClosedPipe))
+		done <- err
+	}()
+	bw := bufio.NewWriter(pw)
+	err := fn(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	pw.CloseWithError(err)
+	putErr := <-done
+	if err != nil {
+		return err
+	}
+
+	return putErr
+}
+
+// blobReaderAt reads an object of a store by offset, using range requests. A read starting at, or shortly after,
+// the end of the previous one reuses its range, which extends to the end of the object.
+type blobReaderAt struct {
+	ctx   context.Context
+	store BlobStore
+	key   string
+	size  int64
+
+	mu sync.Mutex
+	// rc is the current range, nil if there's none, pos being the offset of its next byte
+	rc  io.ReadCloser
+	pos int64
+}
+
+func (b *blobReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= b.size {
+		return 0, io.EOF
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.seek(off)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(b.rc, p[:min(int64(len(p)), b.size-off)])
+	b.pos += int64(n)
+	if err != nil {
+		b.close()
+		return n, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// seek positions the current range at off, skipping a short gap, or requesting a new range.
+func (b *blobReaderAt) seek(off int64) error {
+	if b.rc != nil && off >= b.pos && off-b.pos <= blobSkipMax {
+		_, err := io.CopyN(io.Discard, b.rc, off-b.pos)
+		if err == nil {
+			b.pos = off
+			return nil
+		}
+	}
+	b.close()
+	rc, err := b.store.GetRange(b.ctx, b.key, off, b.size-off)
+	if err != nil {
+		return err
+	}
+	b.rc, b.pos = rc, off
+
+	return nil
+}
+
+// close closes the current range, if any.
+func (b *blobReaderAt) close() {
+	if b.rc != nil {
+		b.rc.Close()
+		b.rc = nil
+	}
+}
@@ -0,0 +1,194 @@
+package rdiff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// memBlobStore is a BlobStore holding the objects in memory, and counting the range requests.
+type memBlobStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	ranges  int
+	// putErr fails the Put calls, after reading the content
+	putErr error
+}
+
+func newMemBlobStore(objects map[string][]byte) *memBlobStore {
+	if objects == nil {
+		objects = make(map[string][]byte)
+	}
+
+	return &memBlobStore{objects: objects}
+}
+
+func (s *memBlobStore) object(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%v: %w", key, fs.ErrNotExist)
+	}
+
+	return obj, nil
+}
+
+func (s *memBlobStore) Get(_ context.Context, key string) (io.ReadCloser, int64, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return io.NopCloser(bytes.NewReader(obj)), int64(len(obj)), nil
+}
+
+func (s *memBlobStore) GetRange(_ context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	obj, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.ranges++
+	s.mu.Unlock()
+	end := min(offset+length, int64(len(obj)))
+
+	return io.NopCloser(bytes.NewReader(obj[offset:end])), nil
+}
+
+func (s *memBlobStore) Put(_ context.Context, key string, r io.Reader) error {
+	obj, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if s.putErr != nil {
+		return s.putErr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = obj
+
+	return nil
+}
+
+func TestApp_Blob(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	target := make([]byte, 1<<20)
+	rnd.Read(target)
+	source := append([]byte(nil), target...)
+	// a few changes, the rest of the source matches the target blocks, in order
+	copy(source[1000:], "a change")
+	copy(source[500000:], "another change")
+	source = append(source, "appended"...)
+	store := newMemBlobStore(map[string][]byte{"target": target, "source": source})
+
+	app := New(1024)
+	if err := app.SignatureBlob(context.Background(), store, "target", "signature"); err != nil {
+		t.Fatalf("SignatureBlob() error = %v", err)
+	}
+	var want bytes.Buffer
+	if err := New(1024).SignatureAt(bytes.NewReader(target), int64(len(target)), &want); err != nil {
+		t.Fatal(err)
+	}
+	if sig, _ := store.object("signature"); !bytes.Equal(sig, want.Bytes()) {
+		t.Errorf("SignatureBlob() stored %v bytes, different from the SignatureAt() output", len(sig))
+	}
+	if err := app.DeltaBlob(context.Background(), store, "signature", "source", "delta"); err != nil {
+		t.Fatalf("DeltaBlob() error = %v", err)
+	}
+	if err := app.PatchBlob(context.Background(), store, "target", "delta", "output"); err != nil {
+		t.Fatalf("PatchBlob() error = %v", err)
+	}
+	if got, _ := store.object("output"); !bytes.Equal(got, source) {
+		t.Errorf("PatchBlob() stored %v bytes, different from the source", len(got))
+	}
+	// the target blocks are read in order, without a range request per block
+	if store.ranges > 2 {
+		t.Errorf("PatchBlob() made %v range requests, want at most 2", store.ranges)
+	}
+}
+
+func TestApp_Blob_Errors(t *testing.T) {
+	var signature bytes.Buffer
+	if err := New(4).SignatureAt(bytes.NewReader([]byte("the target content")), 18, &signature); err != nil {
+		t.Fatal(err)
+	}
+	errPut := errors.New("put failed")
+	for _, tt := range []struct {
+		name string
+		call func(s *memBlobStore) error
+		// put fails the Put calls
+		put  bool
+		want error
+	}{
+		{name: "missing target", call: func(s *memBlobStore) error {
+			return New(4).SignatureBlob(context.Background(), s, "missing", "output")
+		}, want: fs.ErrNotExist},
+		{name: "missing signature", call: func(s *memBlobStore) error {
+			return New(4).DeltaBlob(context.Background(), s, "missing", "target", "output")
+		}, want: fs.ErrNotExist},
+		{name: "missing delta", call: func(s *memBlobStore) error {
+			return New(4).PatchBlob(context.Background(), s, "target", "missing", "output")
+		}, want: fs.ErrNotExist},
+		{name: "corrupt signature", call: func(s *memBlobStore) error {
+			return New(4).DeltaBlob(context.Background(), s, "target", "target", "output")
+		}, want: ErrCorrupt},
+		{name: "corrupt delta", call: func(s *memBlobStore) error {
+			return New(4).PatchBlob(context.Background(), s, "target", "target", "output")
+		}, want: ErrCorrupt},
+		{name: "failed put", call: func(s *memBlobStore) error {
+			return New(4).DeltaBlob(context.Background(), s, "signature", "target", "output")
+		}, put: true, want: errPut},
+	} {
+		store := newMemBlobStore(map[string][]byte{"target": []byte("the target content"), "signature": signature.Bytes()})
+		if tt.put {
+			store.putErr = errPut
+		}
+		err := tt.call(store)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%v: error = %v, want %v", tt.name, err, tt.want)
+		}
+		if _, err := store.object("output"); err == nil {
+			t.Errorf("%v: the output is stored", tt.name)
+		}
+	}
+}
+
+func TestBlobReaderAt(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), blobSkipMax/5)
+	for _, tt := range []struct {
+		name    string
+		offsets []int64
+		ranges  int
+	}{
+		{name: "in order", offsets: []int64{0, 10, 20, 1000}, ranges: 0},
+		{name: "large gap", offsets: []int64{0, blobSkipMax + 100}, ranges: 1},
+		{name: "backwards", offsets: []int64{1000, 10}, ranges: 1},
+		{name: "last bytes", offsets: []int64{int64(len(content)) - 5}, ranges: 1},
+	} {
+		store := newMemBlobStore(map[string][]byte{"object": content})
+		rc, size, err := store.Get(context.Background(), "object")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ra := &blobReaderAt{ctx: context.Background(), store: store, key: "object", size: size, rc: rc}
+		for _, off := range tt.offsets {
+			p := make([]byte, 10)
+			n, err := ra.ReadAt(p, off)
+			want := content[off:min(off+10, size)]
+			if !bytes.Equal(p[:n], want) || (n < len(p)) != errors.Is(err, io.EOF) {
+				t.Errorf("%v: ReadAt(%v) = %q, %v, want %q", tt.name, off, p[:n], err, want)
+			}
+		}
+		ra.close()
+		if store.ranges != tt.ranges {
+			t.Errorf("%v: range requests = %v, want %v", tt.name, store.ranges, tt.ranges)
+		}
+	}
+}
@@ -0,0 +1,574 @@
+package rdiff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// blockIndexMetaFile holds the parameters of a block index, its files and its segments
+	blockIndexMetaFile = "index.json"
+	// maxIndexSegments is the number of segments beyond which they're merged in a single one, bounding the lookups of
+	// a weak hash
+	maxIndexSegments = 8
+)
+
+// IndexedFile is a file of a block index, in the state it was indexed in.
+type IndexedFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// IndexCommand is a command of a delta computed against a block index, see BlockIndex.Delta: the copy of a range of
+// the indexed file at Path, or a literal, whose Path is empty.
+type IndexCommand struct {
+	Path string `json:",omitempty"`
+	Command
+}
+
+// blockIndexMeta is the content of the meta file of a block index.
+type blockIndexMeta struct {
+	BlockSize      int
+	WeakHash       WeakHashType
+	StrongHash     StrongHashType
+	StrongHashSize int
+	// StrongHashKeyID identifies the key of a keyed strong hash, so the key itself is never stored
+	StrongHashKeyID []byte `json:",omitempty"`
+	// Files are the indexed files, by identifier, NextFile being the identifier of the next one
+	Files    map[uint32]IndexedFile
+	NextFile uint32
+	// Segments are the names of the segment files, the oldest first, NextSegment numbering the next one
+	Segments    []string
+	NextSegment int
+}
+
+// BlockIndex is a persistent index of the blocks of a corpus of files, mapping their weak and strong hashes to
+// the file and the block holding them, so the delta of a new file is computed against all of them, instead of
+// a single target, see BlockIndex.Delta. It's stored in a directory, see OpenBlockIndex.
+//
+// The blocks of every file added are written to a new segment file, sorted by weak hash, and looked up by a binary
+// search, the bloom filters of the segments being kept in memory, so the rolling match loop reads the segments only
+// for the likely matches. The segments are merged once there are more than 8 of them, dropping the blocks of the
+// removed files.
+// It's safe for concurrent use, but not by several processes.
+type BlockIndex struct {
+	dir  string
+	opts []Option
+	// mu guards the meta and the segments: the deltas hold it for reading, while the updates hold it for writing
+	mu       sync.RWMutex
+	meta     blockIndexMeta
+	segments []*indexSegment
+	// paths maps the paths of the indexed files to their identifiers
+	paths map[string]uint32
+}
+
+// OpenBlockIndex opens the block index in dir, creating it if it doesn't exist. The files are split in blocks of
+// blockSize bytes, > 0, hashed using the hashes configured by the opts, see New. An existing index must have been
+// created with the same block size and hashes, otherwise a non-nil error is returned, while a blockSize <= 0 adopts
+// its block size. A custom weak hash can't be used, as it can't be recorded.
+// The index must be closed, see BlockIndex.Close.
+func OpenBlockIndex(dir string, blockSize int, opts ...Option) (*BlockIndex, error) {
+	ix := &BlockIndex{dir: dir, opts: opts, paths: make(map[string]uint32)}
+	created, err := ix.loadMeta()
+	if err != nil {
+		return nil, err
+	}
+	err = ix.checkMeta(blockSize)
+	if err == nil && created {
+		// a new index records its block size, and its hashes, right away
+		err = ix.commit()
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range ix.meta.Segments {
+		s, err := openIndexSegment(filepath.Join(dir, name), ix.meta.StrongHashSize)
+		if err != nil {
+			return nil, errors.Join(err, ix.Close())
+		}
+		s.name = name
+		ix.segments = append(ix.segments, s)
+	}
+	for id, f := range ix.meta.Files {
+		ix.paths[f.Path] = id
+	}
+
+	return ix, nil
+}
+
+// loadMeta reads the meta file of the index, if it exists, otherwise it creates the index directory, and returns
+// true.
+func (ix *BlockIndex) loadMeta() (bool, error) {
+	data, err := os.ReadFile(filepath.Join(ix.dir, blockIndexMetaFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		ix.meta.Files = make(map[uint32]IndexedFile)
+		return true, os.MkdirAll(ix.dir, 0777)
+	}
+	if err != nil {
+		return false, err
+	}
+	err = json.Unmarshal(data, &ix.meta)
+	if err != nil {
+		return false, markError(ErrCorrupt, fmt.Errorf("reading the block index: %w", err))
+	}
+	if ix.meta.Files == nil {
+		ix.meta.Files = make(map[uint32]IndexedFile)
+	}
+
+	return false, nil
+}
+
+// checkMeta checks the block size, and the hashes, configured for the index against the ones of the existing index,
+// or records them in the meta of a new index.
+func (ix *BlockIndex) checkMeta(blockSize int) error {
+	if blockSize <= 0 {
+		blockSize = ix.meta.BlockSize
+	}
+	if blockSize <= 0 || blockSize > MaxBlockSize {
+		return fmt.Errorf("invalid block index block size: %v", blockSize)
+	}
+	r := New(blockSize, ix.opts...).diffEngine
+	if r.weakHashType == WeakHashCustom {
+		return errors.New("a block index can't use a custom weak hash")
+	}
+	if ix.meta.BlockSize == 0 {
+		ix.meta.BlockSize, ix.meta.WeakHash, ix.meta.StrongHash = blockSize, r.weakHashType, r.strongHashType
+		ix.meta.StrongHashSize, ix.meta.StrongHashKeyID = r.effectiveStrongHashSize(), strongHashKeyID(r.strongHashKey)
+		return nil
+	}
+	if !ix.meta.matches(r) {
+		return markError(ErrVerification, fmt.Errorf(
+			"the block index was created using the block size %v, and the hashes %v/%v, which differ from the configured ones",
+			ix.meta.BlockSize, ix.meta.WeakHash, ix.meta.StrongHash,
+		))
+	}
+
+	return nil
+}
+
+// matches reports whether the engine r computes the hashes recorded by the meta.
+func (m *blockIndexMeta) matches(r *rDiff) bool {
+	return r.blockSize == m.BlockSize && r.weakHashType == m.WeakHash && r.strongHashType == m.StrongHash &&
+		r.effectiveStrongHashSize() == m.StrongHashSize && bytes.Equal(strongHashKeyID(r.strongHashKey), m.StrongHashKeyID)
+}
+
+// Close closes the segments of the index.
+func (ix *BlockIndex) Close() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	var err error
+	for _, s := range ix.segments {
+		err = errors.Join(err, s.f.Close())
+	}
+	ix.segments = nil
+
+	return err
+}
+
+// Files returns the indexed files, sorted by path.
+func (ix *BlockIndex) Files() []IndexedFile {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	files := make([]IndexedFile, 0, len(ix.meta.Files))
+	for _, f := range ix.meta.Files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	return files
+}
+
+// newEngine returns an engine computing the hashes of the index.
+func (ix *BlockIndex) newEngine() *rDiff {
+	return New(ix.meta.BlockSize, ix.opts...).diffEngine
+}
+
+// Add indexes the blocks of the file at p, replacing its previous ones, if it's already indexed. Only the full blocks
+// are indexed, so a file smaller than the block size is recorded without any block.
+// If the file is modified while it's read, a non-nil error matching ErrModified is returned.
+func (ix *BlockIndex) Add(p string) error {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(abs)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	snapshot, err := newInputSnapshot(f)
+	if err != nil {
+		return err
+	}
+	// the blocks are hashed before taking the lock, so the deltas aren't held by the hashing
+	signature, err := ix.newEngine().ComputeSignature(snapshot.reader(bufio.NewReader(f)))
+	if err == nil {
+		err = snapshot.check()
+	}
+	if err != nil {
+		return err
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	id := ix.meta.NextFile
+	err = ix.writeSegment(signatureIndexRecords(signature, id, ix.meta.BlockSize, snapshot.info.Size()))
+	if err != nil {
+		return err
+	}
+	if old, ok := ix.paths[abs]; ok {
+		delete(ix.meta.Files, old)
+	}
+	ix.meta.Files[id] = IndexedFile{Path: abs, Size: snapshot.info.Size(), ModTime: snapshot.info.ModTime()}
+	ix.meta.NextFile++
+	ix.paths[abs] = id
+
+	return ix.commit()
+}
+
+// signatureIndexRecords returns the records of the full blocks of the signature of a file, which has the given size,
+// sorted by weak hash.
+func signatureIndexRecords(signature signatureTable, file uint32, blockSize int, size int64) []indexRecord {
+	n := int(size / int64(blockSize))
+	strongSize := signature.strongHashSize()
+	records := make([]indexRecord, n)
+	for i := range records {
+		records[i] = indexRecord{
+			weak:   signature.WeakHashes[i],
+			file:   file,
+			block:  uint32(i),
+			strong: signature.StrongHashes[i*strongSize : (i+1)*strongSize],
+		}
+	}
+	slices.SortFunc(records, compareIndexRecords)
+
+	return records
+}
+
+// writeSegment writes the records to a new segment, and adds it to the index. The caller must hold the lock.
+func (ix *BlockIndex) writeSegment(records []indexRecord) error {
+	name := fmt.Sprintf("segment-%06d.idx", ix.meta.NextSegment)
+	p := filepath.Join(ix.dir, name)
+	w, err := newSegmentWriter(p, int64(len(records)))
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		err = w.write(r)
+		if err != nil {
+			break
+		}
+	}
+	err = errors.Join(err, w.close())
+	if err == nil {
+		err = ix.addSegment(name)
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(p))
+	}
+
+	return nil
+}
+
+// addSegment opens the new segment, and adds it to the index. The caller must hold the lock.
+func (ix *BlockIndex) addSegment(name string) error {
+	s, err := openIndexSegment(filepath.Join(ix.dir, name), ix.meta.StrongHashSize)
+	if err != nil {
+		return err
+	}
+	s.name = name
+	ix.segments = append(ix.segments, s)
+	ix.meta.Segments = append(ix.meta.Segments, name)
+	ix.meta.NextSegment++
+
+	return nil
+}
+
+// Remove removes the file at p from the index, its blocks being dropped when the segments are merged. Removing
+// a file which is not indexed does nothing.
+func (ix *BlockIndex) Remove(p string) error {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return err
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	id, ok := ix.paths[abs]
+	if !ok {
+		return nil
+	}
+	delete(ix.meta.Files, id)
+	delete(ix.paths, abs)
+
+	return ix.commit()
+}
+
+// commit merges the segments, if there are too many of them, then writes the meta file, replacing it atomically.
+// The caller must hold the lock.
+func (ix *BlockIndex) commit() error {
+	if len(ix.segments) > maxIndexSegments {
+		err := ix.compact()
+		if err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(ix.meta)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(ix.dir, blockIndexMetaFile+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	err = errors.Join(err, tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(ix.dir, blockIndexMetaFile))
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(tmp.Name()))
+	}
+	ix.removeStaleSegments()
+
+	return nil
+}
+
+// compact merges the segments in a new one, dropping the blocks of the removed files. The merged segments are
+// removed once the meta file no longer lists them. The caller must hold the lock.
+func (ix *BlockIndex) compact() error {
+	var n int64
+	for _, s := range ix.segments {
+		n += s.count
+	}
+	name := fmt.Sprintf("segment-%06d.idx", ix.meta.NextSegment)
+	p := filepath.Join(ix.dir, name)
+	w, err := newSegmentWriter(p, n)
+	if err != nil {
+		return err
+	}
+	err = mergeSegments(ix.segments, w, func(r indexRecord) bool {
+		_, ok := ix.meta.Files[r.file]
+		return ok
+	})
+	err = errors.Join(err, w.close())
+	if err != nil {
+		return errors.Join(err, os.Remove(p))
+	}
+	merged := ix.segments
+	ix.segments, ix.meta.Segments = nil, nil
+	err = ix.addSegment(name)
+	for _, s := range merged {
+		err = errors.Join(err, s.f.Close())
+	}
+
+	return err
+}
+
+// removeStaleSegments removes the segment files which are not listed by the meta, ex: the merged ones, the failures
+// being ignored, as the stale segments are removed by the next call.
+func (ix *BlockIndex) removeStaleSegments() {
+	matches, _ := filepath.Glob(filepath.Join(ix.dir, "segment-*.idx"))
+	for _, m := range matches {
+		if !slices.Contains(ix.meta.Segments, filepath.Base(m)) {
+			_ = os.Remove(m)
+		}
+	}
+}
+
+// lookup returns the file and the block of an indexed block whose hashes are weak, and the strong hash of the window,
+// computed by strong only if the weak hash is found, or false if there isn't any. The caller must hold the lock.
+func (ix *BlockIndex) lookup(weak uint64, strong func() []byte, buf []byte) (IndexedFile, uint32, bool, error) {
+	var file IndexedFile
+	var block uint32
+	var sum []byte
+	found := false
+	// the newest segments first, as they hold the latest versions of the files
+	for i := len(ix.segments) - 1; i >= 0 && !found; i-- {
+		err := ix.segments[i].find(weak, buf, func(r indexRecord) bool {
+			f, ok := ix.meta.Files[r.file]
+			if !ok {
+				return true
+			}
+			if sum == nil {
+				sum = strong()
+			}
+			if bytes.Equal(sum, r.strong) {
+				file, block, found = f, r.block, true
+			}
+			return !found
+		})
+		if err != nil {
+			return IndexedFile{}, 0, false, err
+		}
+	}
+
+	return file, block, found, nil
+}
+
+// Delta computes the commands rebuilding the source from the indexed files: the source blocks found in any of them
+// are copies of their ranges, the adjacent ones being merged, while the rest of the source is literal data. The
+// commands are held in memory, literal data included, and they're applied by BlockIndex.Apply.
+func (ix *BlockIndex) Delta(source io.Reader) ([]IndexCommand, error) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	d := &indexDelta{ix: ix, r: ix.newEngine(), source: bufio.NewReader(source)}
+	err := d.run()
+	if err != nil {
+		return nil, err
+	}
+
+	return d.flushLiteral(), nil
+}
+
+// indexDelta is the rolling match loop of a delta computed against a block index.
+type indexDelta struct {
+	ix      *BlockIndex
+	r       *rDiff
+	source  *bufio.Reader
+	cmds    []IndexCommand
+	literal []byte
+	window  []byte
+	sum     []byte
+}
+
+// run matches the windows of the source, a block at a time after a match, or rolling a byte at a time otherwise.
+func (d *indexDelta) run() error {
+	bs := d.ix.meta.BlockSize
+	block := make([]byte, bs)
+	buf := make([]byte, indexRecordHeader+d.ix.meta.StrongHashSize)
+	for {
+		n, err := io.ReadFull(d.source, block)
+		if err != nil {
+			d.literal = append(d.literal, block[:n]...)
+			return ignoreEOF(err)
+		}
+		d.r.weakHasher.WriteAll(block)
+		for {
+			file, index, ok, err := d.ix.lookup(d.r.weakHasher.Sum(), d.strongSum, buf)
+			if err != nil {
+				return err
+			}
+			if ok {
+				d.copyBlock(file.Path, int64(index)*int64(bs), int64(bs))
+				break
+			}
+			b, err := d.source.ReadByte()
+			if err != nil {
+				d.literal = d.r.weakHasher.AppendWindowContent(d.literal)
+				return ignoreEOF(err)
+			}
+			d.literal = append(d.literal, d.r.weakHasher.Roll(b))
+		}
+	}
+}
+
+// ignoreEOF returns nil for the end of the source, which is not a failure, and err otherwise.
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+
+	return err
+}
+
+// strongSum returns the strong hash of the window.
+func (d *indexDelta) strongSum() []byte {
+	d.window = d.r.weakHasher.AppendWindowContent(d.window[:0])
+	d.sum = d.r.appendStrongSum(d.sum[:0], d.window)
+
+	return d.sum
+}
+
+// copyBlock appends the copy of length bytes of the file at p, at off, after the pending literal, merging it with
+// the previous copy if it's the preceding range of the same file.
+func (d *indexDelta) copyBlock(p string, off, length int64) {
+	d.cmds = d.flushLiteral()
+	if n := len(d.cmds); n > 0 && d.cmds[n-1].Path == p && d.cmds[n-1].Offset+d.cmds[n-1].Length == off {
+		d.cmds[n-1].Length += length
+		return
+	}
+	d.cmds = append(d.cmds, IndexCommand{Path: p, Command: Command{Type: CommandCopy, Offset: off, Length: length}})
+}
+
+// flushLiteral returns the commands, followed by the pending literal, if any.
+func (d *indexDelta) flushLiteral() []IndexCommand {
+	if len(d.literal) == 0 {
+		return d.cmds
+	}
+	cmds := append(d.cmds, IndexCommand{Command: Command{Type: CommandLiteral, Data: d.literal}})
+	d.literal = nil
+
+	return cmds
+}
+
+// Apply rebuilds the source from the commands, as returned by BlockIndex.Delta, reading the copied ranges from the
+// indexed files, and writes it to output. A copied file which is no longer indexed, or which changed since it was
+// indexed, returns a non-nil error matching ErrModified, as its ranges may not be the indexed ones.
+func (ix *BlockIndex) Apply(cmds []IndexCommand, output io.Writer) error {
+	files := make(map[string]*os.File)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for i, cmd := range cmds {
+		var target *os.File
+		var size int64
+		if cmd.Type == CommandCopy {
+			var err error
+			target, size, err = ix.indexedTarget(files, cmd.Path)
+			if err != nil {
+				return err
+			}
+		}
+		err := applyCommand(target, size, cmd.Command, output)
+		if err != nil {
+			return fmt.Errorf("the command %v: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// indexedTarget returns the indexed file at p, and its size, opening it, and checking it's unchanged since it was
+// indexed, unless it's already in files, to which it's added.
+func (ix *BlockIndex) indexedTarget(files map[string]*os.File, p string) (*os.File, int64, error) {
+	ix.mu.RLock()
+	id, ok := ix.paths[p]
+	indexed := ix.meta.Files[id]
+	ix.mu.RUnlock()
+	if !ok {
+		return nil, 0, markError(ErrModified, fmt.Errorf("%v is not indexed", p))
+	}
+	if f, ok := files[p]; ok {
+		return f, indexed.Size, nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err == nil && (info.Size() != indexed.Size || !info.ModTime().Equal(indexed.ModTime)) {
+		err = markError(ErrModified, fmt.Errorf("%v changed since it was indexed", p))
+	}
+	if err != nil {
+		return nil, 0, errors.Join(err, f.Close())
+	}
+	files[p] = f
+
+	return f, indexed.Size, nil
+}
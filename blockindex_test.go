@@ -0,0 +1,253 @@
+package rdiff
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// randomBytes returns n pseudo random bytes, the same ones for a seed.
+func randomBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+
+	return b
+}
+
+// indexDeltaRoundTrip computes the delta of source against the index, checks it's rebuilt by Apply, and returns the
+// commands.
+func indexDeltaRoundTrip(t *testing.T, ix *BlockIndex, source []byte) []IndexCommand {
+	t.Helper()
+	cmds, err := ix.Delta(bytes.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := ix.Apply(cmds, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), source) {
+		t.Fatalf("Apply() rebuilt %v bytes, which differ from the %v source bytes", out.Len(), len(source))
+	}
+
+	return cmds
+}
+
+// copiedFiles returns the number of bytes copied from every file by the commands.
+func copiedFiles(cmds []IndexCommand) map[string]int64 {
+	copied := make(map[string]int64)
+	for _, cmd := range cmds {
+		if cmd.Type == CommandCopy {
+			copied[cmd.Path] += cmd.Length
+		}
+	}
+
+	return copied
+}
+
+func TestBlockIndex(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	a, b := randomBytes(1, 4096), randomBytes(2, 4096+10)
+	if err := os.WriteFile(path("a"), a, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("b"), b, 0666); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := OpenBlockIndex(path("index"), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := ix.Add(path(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the source mixes unaligned ranges of both files with new data
+	source := append(append(append([]byte("new data"), a[100:1100]...), randomBytes(3, 50)...), b[1000:3000]...)
+
+	cmds := indexDeltaRoundTrip(t, ix, source)
+	copied := copiedFiles(cmds)
+	if copied[path("a")] < 900 || copied[path("b")] < 1900 {
+		t.Errorf("copied %v, want most of the a and b ranges", copied)
+	}
+	if len(cmds) > 8 {
+		t.Errorf("Delta() returned %v commands, want the adjacent copies merged", len(cmds))
+	}
+	if err := ix.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the index persists, and adopts the recorded block size
+	ix, err = OpenBlockIndex(path("index"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	if files := ix.Files(); len(files) != 2 || files[0].Path != path("a") || files[1].Size != int64(len(b)) {
+		t.Errorf("Files() = %+v, want a and b", files)
+	}
+	cmds = indexDeltaRoundTrip(t, ix, source)
+	if got := copiedFiles(cmds); fmt.Sprint(got) != fmt.Sprint(copied) {
+		t.Errorf("copied %v after reopening the index, want %v", got, copied)
+	}
+	if err := ix.Remove(path("a")); err != nil {
+		t.Fatal(err)
+	}
+	cmds = indexDeltaRoundTrip(t, ix, source)
+	if got := copiedFiles(cmds); got[path("a")] != 0 {
+		t.Errorf("copied %v bytes of a after removing it, want 0", got[path("a")])
+	}
+}
+
+func TestBlockIndex_Compaction(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	ix, err := OpenBlockIndex(path("index"), 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	for i := 0; i < 2*maxIndexSegments; i++ {
+		name := path(fmt.Sprint("file", i))
+		if err := os.WriteFile(name, randomBytes(int64(i), 1024), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := ix.Add(name); err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 1 {
+			if err := ix.Remove(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	segments, err := filepath.Glob(path("index/segment-*.idx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) > maxIndexSegments || len(segments) != len(ix.segments) {
+		t.Errorf("%v segment files, %v segments, want up to %v", len(segments), len(ix.segments), maxIndexSegments)
+	}
+	for i := 0; i < 2*maxIndexSegments; i++ {
+		source := randomBytes(int64(i), 1024)
+		cmds := indexDeltaRoundTrip(t, ix, source)
+		want := int64(len(source))
+		if i%2 == 1 {
+			want = 0
+		}
+		if got := copiedFiles(cmds)[path(fmt.Sprint("file", i))]; got != want {
+			t.Errorf("copied %v bytes of file%v, want %v", got, i, want)
+		}
+	}
+}
+
+func TestOpenBlockIndex_Errors(t *testing.T) {
+	dir := t.TempDir()
+	ix, err := OpenBlockIndex(dir, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Add(filepath.Join(dir, blockIndexMetaFile+".missing")); err == nil {
+		t.Error("Add() of a missing file error = nil, want non-nil")
+	}
+	if err := ix.Remove("missing"); err != nil {
+		t.Errorf("Remove() of a file which is not indexed error = %v, want nil", err)
+	}
+	ix.Close()
+
+	tests := []struct {
+		name      string
+		blockSize int
+		opts      []Option
+		wantErr   error
+	}{
+		{name: "block size", blockSize: 32, wantErr: ErrVerification},
+		{name: "weak hash", blockSize: 64, opts: []Option{WithWeakHash(WeakHashRabinKarp)}, wantErr: ErrVerification},
+		{name: "strong hash", blockSize: 64, opts: []Option{WithStrongHash(StrongHashSHA1)}, wantErr: ErrVerification},
+		{name: "strong hash key", blockSize: 64, opts: []Option{WithStrongHashKey([]byte("key"))}, wantErr: ErrVerification},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := OpenBlockIndex(dir, tt.blockSize, tt.opts...); !errors.Is(err, tt.wantErr) {
+				t.Errorf("OpenBlockIndex() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if err := os.WriteFile(filepath.Join(dir, blockIndexMetaFile), []byte("{"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenBlockIndex(dir, 64); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("OpenBlockIndex() of a corrupt index error = %v, want %v", err, ErrCorrupt)
+	}
+	if _, err := OpenBlockIndex(t.TempDir(), 0); err == nil {
+		t.Error("OpenBlockIndex() of a new index without a block size error = nil, want non-nil")
+	}
+}
+
+func TestOpenBlockIndex_StrongHashKey(t *testing.T) {
+	dir := t.TempDir()
+	key := []byte("a secret strong hash key")
+	ix, err := OpenBlockIndex(dir, 64, WithStrongHashKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, randomBytes(1, 1024), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Add(path); err != nil {
+		t.Fatal(err)
+	}
+	ix.Close()
+	meta, err := os.ReadFile(filepath.Join(dir, blockIndexMetaFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(meta, key) || bytes.Contains(meta, []byte(base64.StdEncoding.EncodeToString(key))) {
+		t.Errorf("the block index meta %s holds the strong hash key", meta)
+	}
+	ix, err = OpenBlockIndex(dir, 64, WithStrongHashKey(key))
+	if err != nil {
+		t.Fatalf("OpenBlockIndex() using the same key error = %v, want nil", err)
+	}
+	ix.Close()
+	if _, err := OpenBlockIndex(dir, 64, WithStrongHashKey([]byte("other"))); !errors.Is(err, ErrVerification) {
+		t.Errorf("OpenBlockIndex() using another key error = %v, want %v", err, ErrVerification)
+	}
+}
+
+func TestBlockIndex_ApplyModified(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "target")
+	target := randomBytes(1, 1024)
+	if err := os.WriteFile(path, target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	ix, err := OpenBlockIndex(filepath.Join(dir, "index"), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	if err := ix.Add(path); err != nil {
+		t.Fatal(err)
+	}
+	cmds, err := ix.Delta(bytes.NewReader(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Apply(cmds, new(bytes.Buffer)); !errors.Is(err, ErrModified) {
+		t.Errorf("Apply() error = %v, want %v", err, ErrModified)
+	}
+}
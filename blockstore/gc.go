@@ -0,0 +1,123 @@
+package blockstore
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// GCOptions configures a garbage collection, see Store.GC.
+type GCOptions struct {
+	// DryRun reports the blocks which would be removed, without removing them
+	DryRun bool
+	// MinAge protects the unreferenced blocks written, or reused, less than MinAge ago, as they may belong to
+	// a version being ingested, whose recipe is not written yet, so it must exceed the duration of the ingestions
+	// running concurrently with the collection
+	MinAge time.Duration
+}
+
+// GCStats is the outcome of a garbage collection.
+type GCStats struct {
+	// Versions is the number of versions retained, and Blocks the number of blocks stored, Bytes being their size
+	Versions int
+	Blocks   int
+	Bytes    int64
+	// Unreferenced is the number of blocks no retained version lists, and UnreferencedBytes their size, the
+	// blocks protected by GCOptions.MinAge excluded, which are the blocks removed, or the ones which would be removed
+	// by a dry run, along with the leftover temporary files
+	Unreferenced      int
+	UnreferencedBytes int64
+}
+
+// Delete removes the version, whose blocks are removed by the next garbage collection, unless other versions list
+// them, see GC. A missing version returns a non-nil error matching fs.ErrNotExist.
+func (s *Store) Delete(version string) error {
+	p, err := s.recipePath(version)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(p)
+}
+
+// GC removes the blocks which are not listed by the recipe of any version, once versions are deleted, see Delete:
+// it marks the blocks listed by all the recipes, then it sweeps the other ones, unless they're younger than
+// opts.MinAge. A dry run only reports the space it would reclaim.
+// A recipe which can't be read aborts the collection, with a non-nil error, before removing any block, as its
+// blocks would be lost.
+func (s *Store) GC(opts GCOptions) (GCStats, error) {
+	start := time.Now()
+	versions, err := s.Versions()
+	if err != nil {
+		return GCStats{}, err
+	}
+	marked := make(map[string]bool)
+	for _, v := range versions {
+		_, blocks, err := s.readRecipe(v)
+		if errors.Is(err, fs.ErrNotExist) {
+			// deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return GCStats{}, err
+		}
+		for _, b := range blocks {
+			marked[hex.EncodeToString(b.StrongHash)] = true
+		}
+	}
+	sw := &sweeper{marked: marked, deadline: start.Add(-opts.MinAge), dryRun: opts.DryRun}
+	sw.stats.Versions = len(versions)
+	err = filepath.WalkDir(filepath.Join(s.dir, blocksDir), func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		return sw.sweep(p, d)
+	})
+
+	return sw.stats, err
+}
+
+// sweeper is the sweep phase of a garbage collection.
+type sweeper struct {
+	// marked are the names of the blocks listed by the recipes
+	marked map[string]bool
+	// deadline is the modification time after which the blocks are protected
+	deadline time.Time
+	dryRun   bool
+	stats    GCStats
+}
+
+// sweep counts the block file p, and removes it, unless it's marked, or it was modified after the deadline, or
+// it's a dry run. A file which is removed concurrently is ignored.
+func (sw *sweeper) sweep(p string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// the temporary files of the blocks being written start with a dot, like no block
+	if !strings.HasPrefix(d.Name(), ".") {
+		sw.stats.Blocks++
+		sw.stats.Bytes += info.Size()
+	}
+	if sw.marked[d.Name()] || info.ModTime().After(sw.deadline) {
+		return nil
+	}
+	sw.stats.Unreferenced++
+	sw.stats.UnreferencedBytes += info.Size()
+	if sw.dryRun {
+		return nil
+	}
+	err = os.Remove(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,86 @@
+package blockstore
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+func TestStore_GC(t *testing.T) {
+	dir := t.TempDir()
+	rnd := rand.New(rand.NewSource(1))
+	v1 := make([]byte, 10*testBlockSize)
+	rnd.Read(v1)
+	// v2 shares the first 8 blocks of v1, and has 2 of its own
+	v2 := append(bytes.Clone(v1[:8*testBlockSize]), make([]byte, 2*testBlockSize)...)
+	rnd.Read(v2[8*testBlockSize:])
+	s, err := Open(dir, testBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{"v1": v1, "v2": v2} {
+		if err := s.Ingest(name, bytes.NewReader(data), int64(len(data))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a leftover of an interrupted ingestion
+	if err := os.WriteFile(filepath.Join(dir, blocksDir, ".tmp-1"), []byte("partial"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("v1"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Delete() of a deleted version error = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	if got, err := s.GC(GCOptions{DryRun: true, MinAge: time.Hour}); err != nil || got.Unreferenced != 0 {
+		t.Errorf("GC() of the young blocks = %+v, %v, want no unreferenced block", got, err)
+	}
+	want := GCStats{
+		Versions:          1,
+		Blocks:            12,
+		Bytes:             12 * testBlockSize,
+		Unreferenced:      3,
+		UnreferencedBytes: 2*testBlockSize + int64(len("partial")),
+	}
+	got, err := s.GC(GCOptions{DryRun: true})
+	if err != nil || got != want {
+		t.Errorf("GC() dry run = %+v, %v, want %+v", got, err, want)
+	}
+	if n := countBlocks(t, dir); n != 12 {
+		t.Errorf("the store holds %v blocks after a dry run, want 12", n)
+	}
+	got, err = s.GC(GCOptions{})
+	if err != nil || got != want {
+		t.Errorf("GC() = %+v, %v, want %+v", got, err, want)
+	}
+	if n := countBlocks(t, dir); n != 10 {
+		t.Errorf("the store holds %v blocks after GC(), want 10", n)
+	}
+	var restored bytes.Buffer
+	if err := s.Restore("v2", &restored); err != nil || !bytes.Equal(restored.Bytes(), v2) {
+		t.Errorf("Restore() after GC() error = %v, equal %v", err, bytes.Equal(restored.Bytes(), v2))
+	}
+
+	// a recipe which can't be read aborts the collection
+	if err := os.WriteFile(filepath.Join(dir, recipesDir, "broken"), []byte("not a recipe"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("v2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GC(GCOptions{}); !errors.Is(err, rdiff.ErrCorrupt) {
+		t.Errorf("GC() with a corrupt recipe error = %v, want %v", err, rdiff.ErrCorrupt)
+	}
+	if n := countBlocks(t, dir); n != 10 {
+		t.Errorf("the store holds %v blocks after an aborted GC(), want 10", n)
+	}
+}
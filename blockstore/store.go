@@ -0,0 +1,276 @@
+// Package blockstore stores the versions of files as content-addressed blocks: a file ingested is split in the
+// blocks of its rdiff signature, every block being stored once, under its SHA-256 hash, and the signature is kept
+// as the recipe of the version, listing its blocks in order. The versions sharing blocks, ex: the successive
+// versions of a file, or the copies of a file, share their storage, and any stored version can be rebuilt:
+//
+//	s, err := blockstore.Open("/srv/store", 4096)
+//	...
+//	err = s.Ingest("backup-2024-06-01", f, size)
+//	...
+//	err = s.Restore("backup-2024-06-01", w)
+//
+// The recipe of a version is an rdiff signature, so it's also the signature a delta of a new version of the file
+// can be computed against, see Recipe.
+//
+// The blocks of the deleted versions are kept until a garbage collection removes the ones no other version lists:
+//
+//	err = s.Delete("backup-2024-06-01")
+//	...
+//	stats, err := s.GC(blockstore.GCOptions{MinAge: time.Hour})
+package blockstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+const (
+	blocksDir  = "blocks"
+	recipesDir = "recipes"
+)
+
+// ErrInvalidVersion is matched by the errors of the version names which are not valid file names.
+var ErrInvalidVersion = errors.New("invalid version name")
+
+// Store is a directory holding the blocks and the recipes of the versions ingested, see Open.
+// It's safe for concurrent use, including by several processes, as every block and recipe is written to a temporary
+// file, which is then renamed, or linked, so a failed call doesn't leave a partial one behind.
+type Store struct {
+	dir       string
+	blockSize int
+	opts      []rdiff.Option
+}
+
+// Open opens the store in dir, creating it if it doesn't exist. The files are split in blocks of blockSize bytes,
+// the same block size for all the versions making their blocks shareable, a blockSize <= 0 meaning it's computed
+// from the size of every file, see rdiff.New.
+// The opts configure the signatures computed, except for the strong hash, the blocks being addressed by their
+// SHA-256 hash, and for the format, the recipes being gob signatures.
+func Open(dir string, blockSize int, opts ...rdiff.Option) (*Store, error) {
+	for _, d := range []string{blocksDir, recipesDir} {
+		err := os.MkdirAll(filepath.Join(dir, d), 0777)
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts = append(slices.Clone(opts),
+		rdiff.WithStrongHashKey(nil),
+		rdiff.WithStrongHash(rdiff.StrongHashSHA256),
+		rdiff.WithStrongHashSize(0),
+		rdiff.WithFormat(rdiff.FormatGob),
+	)
+
+	return &Store{dir: dir, blockSize: blockSize, opts: opts}, nil
+}
+
+// Ingest stores the file, which has the given size, as the version, which must be a valid file name, and must not
+// exist, otherwise a non-nil error, matching fs.ErrExist, is returned. Only the blocks the store doesn't hold yet are
+// written. The file must not be empty, and it must not be modified while it's ingested, otherwise a non-nil error,
+// matching rdiff.ErrModified, is returned.
+func (s *Store) Ingest(version string, file io.ReaderAt, size int64) error {
+	recipePath, err := s.recipePath(version)
+	if err != nil {
+		return err
+	}
+	var recipe bytes.Buffer
+	err = rdiff.New(s.blockSize, s.opts...).SignatureAt(file, size, &recipe)
+	if err != nil {
+		return err
+	}
+	_, blocks, err := rdiff.ReadSignature(bytes.NewReader(recipe.Bytes()))
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	for i, b := range blocks {
+		buf = slices.Grow(buf[:0], b.Length)[:b.Length]
+		_, err = file.ReadAt(buf, b.Offset)
+		if err != nil && !(errors.Is(err, io.EOF) && b.Offset+int64(b.Length) == size) {
+			return err
+		}
+		err = s.putBlock(b.StrongHash, buf)
+		if err != nil {
+			return fmt.Errorf("block %v: %w", i, err)
+		}
+	}
+
+	// the recipe is written last, so a recipe always lists blocks which are stored
+	return writeNew(recipePath, recipe.Bytes())
+}
+
+// Restore rebuilds the version, and writes it to w. Every block is verified against its hash, a missing or altered
+// block making it return a non-nil error, matching rdiff.ErrCorrupt, once the blocks before it are written.
+// A missing version returns a non-nil error matching fs.ErrNotExist.
+func (s *Store) Restore(version string, w io.Writer) error {
+	header, blocks, err := s.readRecipe(version)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for i, b := range blocks {
+		data, err := s.getBlock(b.StrongHash, b.Length)
+		if err != nil {
+			return fmt.Errorf("block %v: %w", i, err)
+		}
+		_, err = w.Write(data)
+		if err != nil {
+			return err
+		}
+		n += int64(len(data))
+	}
+	if n != header.TargetSize {
+		return fmt.Errorf("%w: the version has %v bytes, the recipe lists %v", rdiff.ErrCorrupt, n, header.TargetSize)
+	}
+
+	return nil
+}
+
+// Recipe opens the recipe of the version, the signature of the file it stores, as written by rdiff.App.Signature.
+// A missing version returns a non-nil error matching fs.ErrNotExist.
+func (s *Store) Recipe(version string) (io.ReadCloser, error) {
+	p, err := s.recipePath(version)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(p)
+}
+
+// Versions returns the names of the versions stored, sorted.
+func (s *Store) Versions() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, recipesDir))
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, e := range entries {
+		// the temporary files of the recipes being written start with a dot, like no valid version
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			versions = append(versions, e.Name())
+		}
+	}
+
+	return versions, nil
+}
+
+// readRecipe reads the recipe of the version, and validates it, so its blocks are the full SHA-256 ones.
+func (s *Store) readRecipe(version string) (rdiff.SignatureHeader, []rdiff.Block, error) {
+	f, err := s.Recipe(version)
+	if err != nil {
+		return rdiff.SignatureHeader{}, nil, err
+	}
+	defer f.Close()
+	header, blocks, err := rdiff.ReadSignature(f)
+	if err != nil {
+		return rdiff.SignatureHeader{}, nil, err
+	}
+	if header.StrongHash != rdiff.StrongHashSHA256 || header.StrongHashSize != sha256.Size || header.StrongHashKeyID != nil {
+		return rdiff.SignatureHeader{}, nil, fmt.Errorf("%w: the recipe of %q doesn't address its blocks", rdiff.ErrCorrupt, version)
+	}
+	err = rdiff.ValidateSignature(blocks, header)
+	if err != nil {
+		return rdiff.SignatureHeader{}, nil, err
+	}
+
+	return header, blocks, nil
+}
+
+// putBlock stores the data of a block, if it's not stored yet, after checking it has the hash listed by the recipe.
+func (s *Store) putBlock(hash, data []byte) error {
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], hash) {
+		return fmt.Errorf("%w: the block changed since the file was hashed", rdiff.ErrModified)
+	}
+	p := s.blockPath(hash)
+	// a stored block is touched, so a garbage collection doesn't remove it before the recipe listing it is written,
+	// see GCOptions.MinAge
+	now := time.Now()
+	err := os.Chtimes(p, now, now)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0777)
+	if err != nil {
+		return err
+	}
+	tmp, err := writeTemp(filepath.Dir(p), data)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, p)
+	if err != nil {
+		return errors.Join(err, os.Remove(tmp))
+	}
+
+	return nil
+}
+
+// getBlock reads the block having the hash, which must have the given length.
+func (s *Store) getBlock(hash []byte, length int) ([]byte, error) {
+	data, err := os.ReadFile(s.blockPath(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: missing block %x", rdiff.ErrCorrupt, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); len(data) != length || !bytes.Equal(sum[:], hash) {
+		return nil, fmt.Errorf("%w: altered block %x", rdiff.ErrCorrupt, hash)
+	}
+
+	return data, nil
+}
+
+// blockPath returns the path of the block having the hash, the blocks being spread over subdirectories named after
+// the first byte of their hash, so no directory holds too many of them.
+func (s *Store) blockPath(hash []byte) string {
+	name := hex.EncodeToString(hash)
+
+	return filepath.Join(s.dir, blocksDir, name[:2], name)
+}
+
+// recipePath returns the path of the recipe of the version, or a non-nil error if it's not a valid file name.
+func (s *Store) recipePath(version string) (string, error) {
+	if version == "" || strings.HasPrefix(version, ".") || strings.ContainsAny(version, `/\`) || !filepath.IsLocal(version) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidVersion, version)
+	}
+
+	return filepath.Join(s.dir, recipesDir, version), nil
+}
+
+// writeNew writes data to the new file p, using a temporary file, linked as p once complete. It returns a non-nil
+// error matching fs.ErrExist if p exists.
+func writeNew(p string, data []byte) error {
+	tmp, err := writeTemp(filepath.Dir(p), data)
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(os.Link(tmp, p), os.Remove(tmp))
+}
+
+// writeTemp writes data to a new temporary file of dir, and returns its path.
+func writeTemp(dir string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	err = errors.Join(err, f.Sync(), f.Close())
+	if err != nil {
+		return "", errors.Join(err, os.Remove(f.Name()))
+	}
+
+	return f.Name(), nil
+}
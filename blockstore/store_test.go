@@ -0,0 +1,117 @@
+package blockstore
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+const testBlockSize = 64
+
+// countBlocks returns the number of blocks stored in dir.
+func countBlocks(t *testing.T, dir string) int {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, blocksDir, "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(paths)
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	rnd := rand.New(rand.NewSource(1))
+	v1 := make([]byte, 10*testBlockSize+5)
+	rnd.Read(v1)
+	// v2 changes the 4th block, and appends a block
+	v2 := append(bytes.Clone(v1[:len(v1)-5]), make([]byte, testBlockSize)...)
+	v2[3*testBlockSize] ^= 0xFF
+	s, err := Open(dir, testBlockSize, rdiff.WithStrongHash(rdiff.StrongHashMD5), rdiff.WithStrongHashSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		name string
+		data []byte
+	}{{"v2", v2}, {"v1", v1}, {"copy", v1}} {
+		if err := s.Ingest(v.name, bytes.NewReader(v.data), int64(len(v.data))); err != nil {
+			t.Fatalf("Ingest(%v) error = %v", v.name, err)
+		}
+	}
+	// v1 has 11 blocks, v2 shares 9 of them, and has 2 of its own, the copy shares all of them
+	if got := countBlocks(t, dir); got != 13 {
+		t.Errorf("the store holds %v blocks, want 13", got)
+	}
+	versions, err := s.Versions()
+	if err != nil || !reflect.DeepEqual(versions, []string{"copy", "v1", "v2"}) {
+		t.Errorf("Versions() = %v, %v, want [copy v1 v2]", versions, err)
+	}
+	for name, want := range map[string][]byte{"v1": v1, "v2": v2, "copy": v1} {
+		var got bytes.Buffer
+		if err := s.Restore(name, &got); err != nil || !bytes.Equal(got.Bytes(), want) {
+			t.Errorf("Restore(%v) error = %v, equal %v", name, err, bytes.Equal(got.Bytes(), want))
+		}
+	}
+
+	// the recipe is the signature a delta of a new version is computed against
+	recipe, err := s.Recipe("v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recipe.Close()
+	var delta, rebuilt bytes.Buffer
+	if err := rdiff.New(0).DeltaStream(recipe, bytes.NewReader(v2), int64(len(v2)), &delta); err != nil {
+		t.Fatal(err)
+	}
+	if err := rdiff.New(testBlockSize).Apply(bytes.NewReader(v1), int64(len(v1)), &delta, &rebuilt); err != nil || !bytes.Equal(rebuilt.Bytes(), v2) {
+		t.Errorf("the delta against the recipe doesn't rebuild the new version, error = %v", err)
+	}
+}
+
+func TestStore_Errors(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 8)
+	s, err := Open(dir, testBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ingest("v", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", ".", "..", ".hidden", "a/b", `a\b`} {
+		if err := s.Ingest(name, bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrInvalidVersion) {
+			t.Errorf("Ingest(%q) error = %v, want %v", name, err, ErrInvalidVersion)
+		}
+	}
+	if err := s.Ingest("v", bytes.NewReader(data), int64(len(data))); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Ingest() of an existing version error = %v, want %v", err, fs.ErrExist)
+	}
+	if err := s.Restore("missing", &bytes.Buffer{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Restore() of a missing version error = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	// both blocks of the version are the same, so altering the stored one alters both
+	paths, err := filepath.Glob(filepath.Join(dir, blocksDir, "*", "*"))
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("the store holds the blocks %v, error = %v, want 1 block", paths, err)
+	}
+	if err := os.WriteFile(paths[0], data[:testBlockSize-1], 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restore("v", &bytes.Buffer{}); !errors.Is(err, rdiff.ErrCorrupt) {
+		t.Errorf("Restore() of an altered block error = %v, want %v", err, rdiff.ErrCorrupt)
+	}
+	if err := os.Remove(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restore("v", &bytes.Buffer{}); !errors.Is(err, rdiff.ErrCorrupt) {
+		t.Errorf("Restore() of a missing block error = %v, want %v", err, rdiff.ErrCorrupt)
+	}
+}
@@ -0,0 +1,578 @@
+package rdiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// the operations of a checkpoint
+const (
+	checkpointSignature = "signature"
+	checkpointDelta     = "delta"
+)
+
+// checkpointBlocksSuffix is appended to the checkpoint path to name the file holding the blocks of a checkpointed
+// signature, as the signature is only serialized once complete.
+const checkpointBlocksSuffix = ".blocks"
+
+// checkpoint is the state of a Signature or Delta call, saved periodically to the file configured using WithCheckpoint,
+// so App.Resume can continue the call after an interruption.
+type checkpoint struct {
+	Op string
+	// Input is the target of a signature, or the source of a delta, and InputSize and InputModTime identify the
+	// version of it being processed, so a call is not resumed over a changed input
+	Input        string
+	InputSize    int64
+	InputModTime time.Time
+	// Signature is the signature file of a delta, and Output is the file written by the call
+	Signature string
+	Output    string
+	// Header holds the hash parameters of a signature
+	Header    SignatureHeader
+	BlockSize int
+	// Interval is the number of input bytes processed between checkpoints
+	Interval int64
+	// Offset is the number of input bytes processed, and Records is the number of output records written for them:
+	// the operations following the delta header, or the blocks of a signature
+	Offset  int64
+	Records int64
+	// Next is the next target block of a delta, and Stats its statistics so far
+	Next  int64
+	Stats DeltaStats
+}
+
+// checkpointHook resumes a sequential computation of the engine, and receives its checkpoints.
+type checkpointHook struct {
+	// offset is the input offset the computation resumes from, the input being read from there
+	offset int64
+	// table holds the signature blocks computed before offset
+	table signatureTable
+	// next is the next target block of the delta computed before offset, and stats are its statistics
+	next  int64
+	stats DeltaStats
+	// signature receives the signature computed so far, after every block, and delta receives the next target block,
+	// after every match, with the input offset, and the stats of the delta computed so far
+	signature func(offset int64, table signatureTable) error
+	delta     func(offset int64, next int64, stats DeltaStats) error
+}
+
+// signatureStart returns the signature blocks and the input offset a signature computation starts from.
+func (h *checkpointHook) signatureStart() (signatureTable, int64) {
+	if h == nil {
+		return signatureTable{}, 0
+	}
+
+	return h.table, h.offset
+}
+
+// saveSignature passes the signature computed so far to the hook, if any.
+func (h *checkpointHook) saveSignature(offset int64, table signatureTable) error {
+	if h == nil || h.signature == nil {
+		return nil
+	}
+
+	return h.signature(offset, table)
+}
+
+// resumeDelta sets the state a delta computation starts from, and hooks the emitter to the checkpoints, if any.
+func (h *checkpointHook) resumeDelta(sl *searchList, emitter *deltaEmitter, stats *DeltaStats) {
+	if h == nil {
+		return
+	}
+	sl.next, emitter.next, emitter.offset = int(h.next), h.next, h.offset
+	if h.delta != nil {
+		emitter.checkpoint = func(offset int64, next int64) error {
+			return h.delta(offset, next, *stats)
+		}
+	}
+	memory, mapMemory := stats.SearchListMemory, stats.MapSearchListMemory
+	*stats = h.stats
+	stats.SearchListMemory, stats.MapSearchListMemory = memory, mapMemory
+}
+
+// checkpointed reports whether the Signature and Delta calls are checkpointed.
+func (a *App) checkpointed() bool {
+	return a.checkpointPath != "" && a.checkpointInterval > 0
+}
+
+// checkCheckpointFormat returns a non-nil error if the configured format can't be checkpointed.
+func (a *App) checkCheckpointFormat() error {
+	if a.format != FormatGob {
+		return fmt.Errorf("the %v format can't be checkpointed", a.format)
+	}
+	if a.signingKey != nil || a.verifyKey != nil || a.passphrase != nil || a.recipient != nil {
+		return errors.New("the signed or encrypted artifacts can't be checkpointed")
+	}
+
+	return nil
+}
+
+// Resume continues the Signature or Delta call which saved the checkpointPath file, configured using WithCheckpoint,
+// from its last checkpoint. The App must use the hash algorithms of the interrupted call, and the checkpoints keep
+// being saved to the same file, at the same interval, until the call succeeds.
+// If the input changed since the checkpoint, a non-nil error matching ErrVerification is returned, and if the
+// output written so far is missing or damaged, the error matches ErrCorrupt: the call must be started over.
+func (a *App) Resume(checkpointPath string) error {
+	cp, err := readCheckpoint(checkpointPath)
+	if err != nil {
+		return err
+	}
+	switch cp.Op {
+	case checkpointSignature:
+		return a.checkpointedSignature(checkpointPath, cp, true)
+	case checkpointDelta:
+		return a.checkpointedDelta(checkpointPath, cp, true)
+	default:
+		return markError(ErrCorrupt, fmt.Errorf("unknown checkpoint operation: %q", cp.Op))
+	}
+}
+
+// checkpointedSignature computes the signature described by cp, from its offset, if resumed.
+func (a *App) checkpointedSignature(checkpointPath string, cp *checkpoint, resumed bool) error {
+	target, err := openCheckpointInput(cp, resumed)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	err = a.prepareSignatureCheckpoint(cp, resumed)
+	if err != nil {
+		return err
+	}
+	output, err := createCheckpointOutput(cp.Output, resumed)
+	if err != nil {
+		return err
+	}
+	blocks, table, err := openSignatureBlocks(checkpointPath+checkpointBlocksSuffix, cp, resumed)
+	if err != nil {
+		return errors.Join(err, output.Close())
+	}
+	if !resumed {
+		err = writeCheckpoint(checkpointPath, cp)
+	}
+	if err == nil {
+		table, err = a.computeCheckpointedSignature(checkpointPath, cp, target, blocks, table)
+	}
+	if err == nil {
+		header := cp.Header
+		header.TargetSize = cp.InputSize
+		err = a.writeSignature(output, header, table)
+	}
+	err = errors.Join(err, blocks.Close(), output.Close())
+	if err != nil {
+		return err
+	}
+
+	return removeCheckpoint(checkpointPath)
+}
+
+// computeCheckpointedSignature computes the signature of the target, from the offset of cp, table holding the
+// blocks before it, and appends the blocks to the blocks file, at every checkpoint.
+func (a *App) computeCheckpointedSignature(
+	checkpointPath string, cp *checkpoint, target, blocks *os.File, table signatureTable,
+) (signatureTable, error) {
+	a.diffEngine.checkpoint = &checkpointHook{
+		offset: cp.Offset,
+		table:  table,
+		signature: func(offset int64, t signatureTable) error {
+			if offset-cp.Offset < cp.Interval {
+				return nil
+			}
+			err := appendSignatureBlocks(blocks, t, int(cp.Records))
+			if err != nil {
+				return err
+			}
+			cp.Offset, cp.Records = offset, int64(t.len())
+
+			return writeCheckpoint(checkpointPath, cp)
+		},
+	}
+	defer func() { a.diffEngine.checkpoint = nil }()
+	reader, release, err := a.checkpointInputReader(target, cp, checkpointSignature)
+	if err != nil {
+		return signatureTable{}, err
+	}
+	table, err = a.diffEngine.ComputeSignature(reader)
+
+	return table, errors.Join(err, release())
+}
+
+// prepareSignatureCheckpoint configures the engine for the signature described by cp, recording its parameters
+// in cp for a new call.
+func (a *App) prepareSignatureCheckpoint(cp *checkpoint, resumed bool) error {
+	err := a.checkCheckpointFormat()
+	if err == nil {
+		err = a.checkSignatureHashers()
+	}
+	if err != nil {
+		return err
+	}
+	if resumed {
+		a.diffEngine.blockSize = cp.BlockSize
+		return a.diffEngine.negotiateSignatureHeader(cp.Header)
+	}
+	if cp.InputSize <= 0 {
+		return errors.New("the target file is empty")
+	}
+	a.diffEngine.blockSize, err = decideBlockSize(a.diffEngine.blockSize, cp.InputSize)
+	cp.Header, cp.BlockSize = a.diffEngine.signatureHeader(), a.diffEngine.blockSize
+
+	return err
+}
+
+// checkpointedDelta computes the delta described by cp, from its offset, if resumed.
+func (a *App) checkpointedDelta(checkpointPath string, cp *checkpoint, resumed bool) error {
+	err := a.prepareDeltaCheckpoint(cp, resumed)
+	if err != nil {
+		return err
+	}
+	signatureFile, err := a.openSignature(cp.Signature)
+	if err != nil {
+		return err
+	}
+	header, sig, err := readSignature(bufio.NewReader(signatureFile), a.diffEngine.limits)
+	err = errors.Join(err, signatureFile.Close())
+	if err != nil {
+		return err
+	}
+	cp.BlockSize = a.diffEngine.blockSize
+	if cp.BlockSize <= 0 {
+		// the block size is adopted from the signature, and recorded by the delta header
+		cp.BlockSize = header.BlockSize
+	}
+	source, err := openCheckpointInput(cp, resumed)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	output, err := openDeltaOutput(cp, resumed)
+	if err != nil {
+		return err
+	}
+	// the delta saved by a new call is its header, while a resumed one is rewritten, so it's checkpointed before
+	// continuing
+	err = output.sync()
+	if err == nil {
+		err = writeCheckpoint(checkpointPath, cp)
+	}
+	if err == nil {
+		err = a.computeCheckpointedDelta(checkpointPath, cp, source, signatureInput{header, sig}, output)
+	}
+	err = errors.Join(err, output.f.Close())
+	if err != nil {
+		return err
+	}
+
+	return removeCheckpoint(checkpointPath)
+}
+
+// prepareDeltaCheckpoint configures the engine for the delta described by cp, using its block size if resumed.
+func (a *App) prepareDeltaCheckpoint(cp *checkpoint, resumed bool) error {
+	err := a.checkCheckpointFormat()
+	if err != nil {
+		return err
+	}
+	if resumed {
+		a.diffEngine.blockSize = cp.BlockSize
+	}
+
+	return a.diffEngine.checkHashers()
+}
+
+// computeCheckpointedDelta computes the delta of the source against the signature, from the offset of cp, and
+// writes its operations to the output, which is synced at every checkpoint.
+func (a *App) computeCheckpointedDelta(
+	checkpointPath string, cp *checkpoint, source *os.File, sig signatureInput, output *deltaOutput,
+) error {
+	records := cp.Records
+	a.diffEngine.checkpoint = &checkpointHook{
+		offset: cp.Offset,
+		next:   cp.Next,
+		stats:  cp.Stats,
+		delta: func(offset int64, next int64, stats DeltaStats) error {
+			if offset-cp.Offset < cp.Interval {
+				return nil
+			}
+			err := output.sync()
+			if err != nil {
+				return err
+			}
+			cp.Offset, cp.Records, cp.Next, cp.Stats = offset, records, next, stats
+
+			return writeCheckpoint(checkpointPath, cp)
+		},
+	}
+	defer func() { a.diffEngine.checkpoint = nil }()
+	reader, release, err := a.checkpointInputReader(source, cp, checkpointDelta)
+	if err != nil {
+		return err
+	}
+	err = a.diffEngine.ComputeDeltaFunc(reader, sig.header, sig.table, func(op Operation) error {
+		records++
+		return output.enc.Encode(op)
+	})
+	err = errors.Join(err, release())
+	if err != nil {
+		return err
+	}
+
+	return output.bw.Flush()
+}
+
+// signatureInput is the signature a delta is computed against.
+type signatureInput struct {
+	header SignatureHeader
+	table  signatureTable
+}
+
+// deltaOutput is the buffered delta file of a checkpointed Delta call, with the encoder of its operations.
+type deltaOutput struct {
+	f   *os.File
+	bw  *bufio.Writer
+	enc *gob.Encoder
+}
+
+// sync flushes the delta to the storage.
+func (o *deltaOutput) sync() error {
+	err := o.bw.Flush()
+	if err != nil {
+		return err
+	}
+
+	return o.f.Sync()
+}
+
+// openDeltaOutput creates the delta file of cp.
+// A resumed delta is rewritten from the operations saved by the checkpoint, as a gob stream can't be continued by
+// another encoder than the one which started it. It replaces the saved delta once synced, so an interruption
+// leaves either of them, both starting with the saved operations.
+func openDeltaOutput(cp *checkpoint, resumed bool) (*deltaOutput, error) {
+	if !resumed {
+		f, err := os.OpenFile(cp.Output, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if err != nil {
+			return nil, err
+		}
+		o := &deltaOutput{f: f, bw: bufio.NewWriter(f)}
+		o.enc = gob.NewEncoder(o.bw)
+		err = o.enc.Encode(DeltaHeader{SourceSize: cp.InputSize, TargetBlockSize: cp.BlockSize})
+		if err != nil {
+			return nil, closeOnError(f, err)
+		}
+
+		return o, nil
+	}
+	saved, err := os.Open(cp.Output)
+	if err != nil {
+		return nil, markError(ErrCorrupt, err)
+	}
+	f, err := os.CreateTemp(filepath.Dir(cp.Output), "."+filepath.Base(cp.Output)+".*")
+	if err != nil {
+		return nil, closeOnError(saved, err)
+	}
+	o := &deltaOutput{f: f, bw: bufio.NewWriter(f)}
+	o.enc, err = copyDeltaPrefix(o.bw, saved, cp.Records)
+	err = errors.Join(err, saved.Close())
+	if err == nil {
+		err = o.sync()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), cp.Output)
+	}
+	if err != nil {
+		return nil, errors.Join(err, f.Close(), os.Remove(f.Name()))
+	}
+
+	return o, nil
+}
+
+// copyDeltaPrefix writes the header and the first n operations of the saved delta to w, and returns the encoder
+// of the following operations.
+func copyDeltaPrefix(w io.Writer, saved io.Reader, n int64) (*gob.Encoder, error) {
+	d, err := newDeltaDecoder(bufio.NewReader(saved), DecodeLimits{})
+	if err != nil {
+		return nil, err
+	}
+	enc := gob.NewEncoder(w)
+	err = enc.Encode(d.header)
+	for i := int64(0); i < n && err == nil; i++ {
+		var op Operation
+		err = d.dec.Decode(&op)
+		if err != nil {
+			return nil, markError(ErrCorrupt, fmt.Errorf("reading the delta operation %v: %w", i, err))
+		}
+		err = enc.Encode(op)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return enc, nil
+}
+
+// closeOnError closes f if err is not nil, and returns err.
+func closeOnError(f *os.File, err error) error {
+	if err != nil {
+		return errors.Join(err, f.Close())
+	}
+
+	return nil
+}
+
+// openCheckpointInput opens the input of cp, recording its identity for a new call, or checking it didn't change
+// for a resumed one.
+func openCheckpointInput(cp *checkpoint, resumed bool) (*os.File, error) {
+	f, err := openSequential(cp.Input)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, closeOnError(f, err)
+	}
+	if !resumed {
+		cp.InputSize, cp.InputModTime = info.Size(), info.ModTime()
+		return f, nil
+	}
+	if info.Size() != cp.InputSize || !info.ModTime().Equal(cp.InputModTime) || cp.Offset > cp.InputSize {
+		return nil, closeOnError(f, markError(ErrVerification, fmt.Errorf("%v changed since the checkpoint", cp.Input)))
+	}
+
+	return f, nil
+}
+
+// createCheckpointOutput creates the output file of a signature, which must not exist for a new call, while it's
+// truncated for a resumed one.
+func createCheckpointOutput(name string, resumed bool) (*os.File, error) {
+	if !resumed {
+		return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	}
+
+	return os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// checkpointInputReader returns the reader of the input f, from the offset of cp, limited by the configured rate
+// limiter, and reporting its progress.
+func (a *App) checkpointInputReader(f *os.File, cp *checkpoint, phase string) (io.Reader, func() error, error) {
+	_, err := f.Seek(cp.Offset, io.SeekStart)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, release := a.fileReader(f, cp.InputSize)
+	switch r := r.(type) {
+	case *holeReader:
+		r.off = cp.Offset
+	case io.Seeker:
+		_, err = r.Seek(cp.Offset, io.SeekStart)
+	}
+	if err != nil {
+		return nil, nil, errors.Join(err, release())
+	}
+	r = a.withReadProgress(a.limitReader(r), phase, cp.InputSize)
+	if pr, ok := r.(*progressReader); ok {
+		pr.progress.Done = cp.Offset
+	}
+
+	return r, release, nil
+}
+
+// openSignatureBlocks opens the blocks file of a checkpointed signature, and returns the blocks saved by the
+// checkpoint, for a resumed call, the file being truncated after them.
+// Every block is a big endian weak hash, followed by the strong hash.
+func openSignatureBlocks(name string, cp *checkpoint, resumed bool) (*os.File, signatureTable, error) {
+	if !resumed {
+		f, err := os.Create(name)
+		return f, signatureTable{}, err
+	}
+	f, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, signatureTable{}, markError(ErrCorrupt, err)
+	}
+	record := 8 + cp.Header.StrongHashSize
+	n := int(cp.Records)
+	data := make([]byte, n*record)
+	_, err = io.ReadFull(f, data)
+	if err == nil {
+		_, err = f.Seek(int64(len(data)), io.SeekStart)
+	}
+	if err == nil {
+		err = f.Truncate(int64(len(data)))
+	}
+	if err != nil {
+		return nil, signatureTable{}, closeOnError(f, markError(ErrCorrupt, err))
+	}
+	t := signatureTable{WeakHashes: make([]uint64, 0, n), StrongHashes: make([]byte, 0, n*cp.Header.StrongHashSize)}
+	for p := data; len(p) > 0; p = p[record:] {
+		t.WeakHashes = append(t.WeakHashes, binary.BigEndian.Uint64(p))
+		t.StrongHashes = append(t.StrongHashes, p[8:record]...)
+	}
+
+	return f, t, nil
+}
+
+// appendSignatureBlocks appends the blocks of t, from the index from, to the blocks file f, and syncs it.
+func appendSignatureBlocks(f *os.File, t signatureTable, from int) error {
+	var buf []byte
+	for i := from; i < t.len(); i++ {
+		buf = binary.BigEndian.AppendUint64(buf, t.WeakHashes[i])
+		buf = append(buf, t.strongHash(i)...)
+	}
+	_, err := f.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// readCheckpoint reads a checkpoint written by writeCheckpoint.
+func readCheckpoint(name string) (*checkpoint, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cp checkpoint
+	err = gob.NewDecoder(bufio.NewReader(f)).Decode(&cp)
+	if err != nil {
+		return nil, markError(ErrCorrupt, fmt.Errorf("reading the checkpoint: %w", err))
+	}
+
+	return &cp, nil
+}
+
+// writeCheckpoint replaces the checkpoint file with cp, atomically, so an interruption leaves the previous one.
+func writeCheckpoint(name string, cp *checkpoint) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(tmp).Encode(cp)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	err = errors.Join(err, tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(tmp.Name()))
+	}
+
+	return nil
+}
+
+// removeCheckpoint removes the checkpoint file, and the blocks file of a signature, once the call succeeded.
+func removeCheckpoint(name string) error {
+	err := os.Remove(name + checkpointBlocksSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+
+	return errors.Join(err, os.Remove(name))
+}
@@ -0,0 +1,289 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// errInterrupted is the panic value simulating the interruption of a checkpointed call.
+var errInterrupted = errors.New("interrupted")
+
+// interruptAfter returns a progress function interrupting the call once it processed n bytes.
+func interruptAfter(n int64) func(Progress) {
+	return func(p Progress) {
+		if p.Done >= n {
+			panic(errInterrupted)
+		}
+	}
+}
+
+// interrupted runs fn, which must be interrupted by interruptAfter.
+func interrupted(t *testing.T, fn func() error) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != errInterrupted {
+			t.Fatalf("recover() = %v, want %v", r, errInterrupted)
+		}
+	}()
+	err := fn()
+	t.Fatalf("the call was not interrupted, it returned %v", err)
+}
+
+// checkpointFiles writes a target and a source, which is the target with a few edits, and returns their paths.
+func checkpointFiles(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	rnd := rand.New(rand.NewSource(1))
+	target := make([]byte, 1<<20)
+	rnd.Read(target)
+	// a zero region, for the sparse computations
+	clear(target[300<<10 : 400<<10])
+	source := append([]byte(nil), target[:5000]...)
+	source = append(source, []byte("inserted")...)
+	source = append(source, target[5000:600000]...)
+	source = append(source, target[601000:]...)
+	source = append(source, []byte("appended")...)
+	targetPath, sourcePath := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	if err := os.WriteFile(targetPath, target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sourcePath, source, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	return targetPath, sourcePath
+}
+
+func TestApp_Resume_Signature(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		// interrupts are the bytes processed before every interruption
+		interrupts []int64
+	}{
+		{name: "streamed", interrupts: []int64{100 << 10}},
+		{name: "interrupted twice", interrupts: []int64{100 << 10, 700 << 10}},
+		{name: "before the first checkpoint", interrupts: []int64{1 << 10}},
+		{name: "mmap", opts: []Option{WithMmap(true)}, interrupts: []int64{500 << 10}},
+		{name: "read ahead", opts: []Option{WithReadAhead(2)}, interrupts: []int64{500 << 10}},
+		{name: "sparse", opts: []Option{WithSparse(true)}, interrupts: []int64{350 << 10}},
+		{name: "parallel", opts: []Option{WithConcurrency(4)}, interrupts: []int64{500 << 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target, _ := checkpointFiles(t, dir)
+			want := filepath.Join(dir, "want")
+			if err := New(512, tt.opts...).Signature(target, want); err != nil {
+				t.Fatal(err)
+			}
+
+			sig, cp := filepath.Join(dir, "signature"), filepath.Join(dir, "checkpoint")
+			opts := append([]Option{WithCheckpoint(cp, 32<<10), WithProgress(interruptAfter(tt.interrupts[0]))}, tt.opts...)
+			interrupted(t, func() error { return New(512, opts...).Signature(target, sig) })
+			for _, n := range tt.interrupts[1:] {
+				app := New(0, append([]Option{WithProgress(interruptAfter(n))}, tt.opts...)...)
+				interrupted(t, func() error { return app.Resume(cp) })
+			}
+			if err := New(0, tt.opts...).Resume(cp); err != nil {
+				t.Fatal(err)
+			}
+
+			assertSameFile(t, sig, want)
+			assertNoCheckpoint(t, cp)
+		})
+	}
+}
+
+func TestApp_Resume_Delta(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		interrupts []int64
+	}{
+		{name: "streamed", interrupts: []int64{300 << 10}},
+		{name: "interrupted twice", interrupts: []int64{300 << 10, 800 << 10}},
+		{name: "before the first checkpoint", interrupts: []int64{1}},
+		{name: "mmap", opts: []Option{WithMmap(true)}, interrupts: []int64{500 << 10}},
+		{name: "sparse", opts: []Option{WithSparse(true)}, interrupts: []int64{350 << 10}},
+		{name: "memory budget", opts: []Option{WithMaxMemory(100)}, interrupts: []int64{700 << 10}},
+		{name: "min match", opts: []Option{WithMinMatch(3), WithCoalesceLiterals(true), WithMaxMemory(100)}, interrupts: []int64{700 << 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target, source := checkpointFiles(t, dir)
+			sig, want := filepath.Join(dir, "signature"), filepath.Join(dir, "want")
+			if err := New(512, tt.opts...).Signature(target, sig); err != nil {
+				t.Fatal(err)
+			}
+			app := New(512, tt.opts...)
+			if err := app.Delta(sig, source, want); err != nil {
+				t.Fatal(err)
+			}
+			wantStats := app.LastDeltaStats()
+
+			delta, cp := filepath.Join(dir, "delta"), filepath.Join(dir, "checkpoint")
+			opts := append([]Option{WithCheckpoint(cp, 32<<10), WithProgress(interruptAfter(tt.interrupts[0]))}, tt.opts...)
+			interrupted(t, func() error { return New(512, opts...).Delta(sig, source, delta) })
+			for _, n := range tt.interrupts[1:] {
+				app := New(0, append([]Option{WithProgress(interruptAfter(n))}, tt.opts...)...)
+				interrupted(t, func() error { return app.Resume(cp) })
+			}
+			app = New(0, tt.opts...)
+			if err := app.Resume(cp); err != nil {
+				t.Fatal(err)
+			}
+
+			assertSameDelta(t, delta, want)
+			if got := app.LastDeltaStats(); got != wantStats {
+				t.Errorf("LastDeltaStats() = %+v, want %+v", got, wantStats)
+			}
+			assertNoCheckpoint(t, cp)
+			output := filepath.Join(dir, "output")
+			if err := New(512).Patch(target, delta, output); err != nil {
+				t.Fatal(err)
+			}
+			assertSameFile(t, output, source)
+		})
+	}
+}
+
+func TestApp_Resume_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		// change changes the files of the interrupted signature
+		change  func(t *testing.T, target, cp string)
+		wantErr error
+	}{
+		{
+			name: "changed target",
+			change: func(t *testing.T, target, _ string) {
+				if err := os.WriteFile(target, []byte("changed"), 0666); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrVerification,
+		},
+		{
+			name: "missing blocks",
+			change: func(t *testing.T, _, cp string) {
+				if err := os.Truncate(cp+checkpointBlocksSuffix, 10); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrCorrupt,
+		},
+		{
+			name: "corrupt checkpoint",
+			change: func(t *testing.T, _, cp string) {
+				if err := os.WriteFile(cp, []byte("corrupt"), 0666); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrCorrupt,
+		},
+		{
+			name: "missing checkpoint",
+			change: func(t *testing.T, _, cp string) {
+				if err := os.Remove(cp); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: os.ErrNotExist,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			target, _ := checkpointFiles(t, dir)
+			sig, cp := filepath.Join(dir, "signature"), filepath.Join(dir, "checkpoint")
+			app := New(512, WithCheckpoint(cp, 32<<10), WithProgress(interruptAfter(500<<10)))
+			interrupted(t, func() error { return app.Signature(target, sig) })
+			tt.change(t, target, cp)
+
+			if err := New(0).Resume(cp); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Resume() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApp_Resume_HashMismatch(t *testing.T) {
+	dir := t.TempDir()
+	target, _ := checkpointFiles(t, dir)
+	sig, cp := filepath.Join(dir, "signature"), filepath.Join(dir, "checkpoint")
+	app := New(512, WithCheckpoint(cp, 32<<10), WithProgress(interruptAfter(500<<10)))
+	interrupted(t, func() error { return app.Signature(target, sig) })
+
+	if err := New(0, WithStrongHash(StrongHashBLAKE2b)).Resume(cp); !errors.Is(err, ErrVerification) {
+		t.Errorf("Resume() with another strong hash = %v, want %v", err, ErrVerification)
+	}
+	if err := New(0, WithFormat(FormatJSON)).Resume(cp); err == nil {
+		t.Error("Resume() with the JSON format = nil, want an error")
+	}
+	if err := New(0).Resume(cp); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApp_Signature_CheckpointFormat(t *testing.T) {
+	dir := t.TempDir()
+	target, _ := checkpointFiles(t, dir)
+	cp := filepath.Join(dir, "checkpoint")
+	app := New(512, WithCheckpoint(cp, 32<<10), WithFormat(FormatJSON))
+	if err := app.Signature(target, filepath.Join(dir, "signature")); err == nil {
+		t.Fatal("Signature() with the JSON format = nil, want an error")
+	}
+	if _, err := os.Stat(cp); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("the checkpoint was written: %v", err)
+	}
+}
+
+func assertSameFile(t *testing.T, got, want string) {
+	t.Helper()
+	gotData, err := os.ReadFile(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantData, err := os.ReadFile(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotData, wantData) {
+		t.Errorf("%v differs from %v", got, want)
+	}
+}
+
+// assertSameDelta compares the decoded deltas, as the gob encoding of a resumed delta may differ.
+func assertSameDelta(t *testing.T, got, want string) {
+	t.Helper()
+	read := func(name string) []Operation {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		_, ops, err := ReadDelta(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ops
+	}
+	if gotOps, wantOps := read(got), read(want); !reflect.DeepEqual(gotOps, wantOps) {
+		t.Errorf("the delta has %v operations, which differ from the %v wanted ones", len(gotOps), len(wantOps))
+	}
+}
+
+func assertNoCheckpoint(t *testing.T, cp string) {
+	t.Helper()
+	for _, name := range []string{cp, cp + checkpointBlocksSuffix} {
+		if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%v was not removed: %v", name, err)
+		}
+	}
+}
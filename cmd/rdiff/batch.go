@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// batchRun is a run of the batch command, on the files listed by a manifest line.
+type batchRun struct {
+	// line is the manifest line number, starting at 1
+	line  int
+	files []string
+	err   error
+	// written is the size of the output file, in bytes
+	written int64
+}
+
+// batch runs a command over the file tuples listed by a manifest, with a concurrency limit, then prints a summary.
+// If any of the runs failed, it returns the exit code of the first failed run, in the manifest order.
+func batch(args []string, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rdiff batch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: rdiff batch [flags] -manifest <manifest> <command>")
+		fmt.Fprintln(stderr, "every manifest line holds the files of a command run, separated by spaces or tabs,")
+		fmt.Fprintln(stderr, "the empty lines and the ones starting with # are skipped")
+		fs.PrintDefaults()
+	}
+	af := newAppFlags(fs)
+	eo := newErrorOutput(fs, stderr)
+	manifest := fs.String("manifest", "", `the manifest file, "-" means stdin`)
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "the max number of manifest lines processed concurrently")
+	if ok, code := parse(fs, args, 1); !ok {
+		return code
+	}
+	cmd, ok := findCommand(fs.Arg(0))
+	if !ok {
+		fmt.Fprintf(stderr, "rdiff batch: unknown command %q\n", fs.Arg(0))
+		return exitUsage
+	}
+	if *manifest == "" {
+		fmt.Fprintln(stderr, "rdiff batch: the -manifest flag is required")
+		fs.Usage()
+		return exitUsage
+	}
+
+	runs, err := readManifestFile(*manifest, len(cmd.args))
+	if err != nil {
+		return eo.report(err)
+	}
+	start := time.Now()
+	runBatch(runs, max(*jobs, 1), func(r *batchRun) {
+		r.err = af.prepareOutput(r.files)
+		if r.err == nil {
+			r.err = cmd.run(af.newApp(), r.files)
+		}
+	})
+
+	return batchSummary(eo, cmd.name, runs, time.Since(start))
+}
+
+// readManifestFile reads the manifest at path, "-" meaning stdin.
+func readManifestFile(path string, nargs int) ([]*batchRun, error) {
+	if path == "-" {
+		return readManifest(os.Stdin, nargs)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readManifest(f, nargs)
+}
+
+// readManifest returns a run for every manifest line, which must hold nargs files.
+// The empty lines and the comments(lines starting with #) are skipped.
+func readManifest(r io.Reader, nargs int) ([]*batchRun, error) {
+	var runs []*batchRun
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		files := strings.Fields(text)
+		if len(files) != nargs {
+			return nil, fmt.Errorf("manifest line %v: expected %v files, got %v", line, nargs, len(files))
+		}
+		runs = append(runs, &batchRun{line: line, files: files})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("the manifest is empty")
+	}
+
+	return runs, nil
+}
+
+// runBatch calls do for every run, on the given number of workers, then records the size of the runs outputs.
+func runBatch(runs []*batchRun, workers int, do func(*batchRun)) {
+	pending := make(chan *batchRun)
+	var wg sync.WaitGroup
+	for i := 0; i < min(workers, len(runs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range pending {
+				do(r)
+				if r.err != nil {
+					continue
+				}
+				if info, err := os.Stat(r.files[len(r.files)-1]); err == nil {
+					r.written = info.Size()
+				}
+			}
+		}()
+	}
+	for _, r := range runs {
+		pending <- r
+	}
+	close(pending)
+	wg.Wait()
+}
+
+// batchSummary prints the failed runs, in the manifest order, and the totals, then returns the exit code.
+// The totals are not printed with -error-format json, so every line is a JSON error.
+func batchSummary(eo *errorOutput, name string, runs []*batchRun, elapsed time.Duration) int {
+	code := exitOK
+	var failed int
+	var written int64
+	for _, r := range runs {
+		if r.err != nil {
+			e := eo.newError(r.err)
+			e.Command, e.Line = eo.command+" "+name, r.line
+			eo.print(e)
+			if failed == 0 {
+				code = e.ExitCode
+			}
+			failed++
+		}
+		written += r.written
+	}
+	if eo.json {
+		return code
+	}
+	fmt.Fprintf(
+		eo.w,
+		"rdiff batch %v: %v succeeded, %v failed, %.1f MiB written in %v\n",
+		name,
+		len(runs)-failed,
+		failed,
+		float64(written)/(1<<20),
+		elapsed.Round(time.Millisecond),
+	)
+
+	return code
+}
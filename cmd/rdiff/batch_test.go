@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadManifest(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		nargs   int
+		out     [][]string
+		wantErr bool
+	}{
+		{in: "t1 s1\n\n# comment\n  t2\ts2  \n", nargs: 2, out: [][]string{{"t1", "s1"}, {"t2", "s2"}}},
+		{in: "t1 s1 o1\n", nargs: 3, out: [][]string{{"t1", "s1", "o1"}}},
+		{in: "t1 s1\nt2\n", nargs: 2, wantErr: true},
+		{in: "# only a comment\n", nargs: 2, wantErr: true},
+	} {
+		runs, err := readManifest(strings.NewReader(tt.in), tt.nargs)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("readManifest(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		var got [][]string
+		for _, r := range runs {
+			got = append(got, r.files)
+		}
+		if diff := cmp.Diff(got, tt.out); diff != "" {
+			t.Errorf("readManifest(%q) files differ, \nDIFF: %v", tt.in, diff)
+		}
+	}
+}
+
+func TestRun_Batch(t *testing.T) {
+	dir := t.TempDir()
+	path := func(format string, a ...any) string { return filepath.Join(dir, fmt.Sprintf(format, a...)) }
+	var sigManifest, deltaManifest, patchManifest strings.Builder
+	var sources [][]byte
+	for i := 0; i < 5; i++ {
+		target := bytes.Repeat([]byte{byte(i), 1, 2, 3, 4, 5, 6, 7, 8, 9}, 100+i)
+		source := append([]byte("new data"), target[100:]...)
+		sources = append(sources, source)
+		if err := os.WriteFile(path("target%v", i), target, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path("source%v", i), source, 0666); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(&sigManifest, "%v %v\n", path("target%v", i), path("signature%v", i))
+		fmt.Fprintf(&deltaManifest, "%v %v %v\n", path("signature%v", i), path("source%v", i), path("delta%v", i))
+		fmt.Fprintf(&patchManifest, "%v %v %v\n", path("target%v", i), path("delta%v", i), path("output%v", i))
+	}
+	// the last line fails, the output exists
+	fmt.Fprintf(&patchManifest, "%v %v %v\n", path("target0"), path("delta0"), path("output0"))
+	for name, content := range map[string]string{
+		"signature": sigManifest.String(),
+		"delta":     deltaManifest.String(),
+		"patch":     patchManifest.String(),
+		"invalid":   "a b c d\n",
+	} {
+		if err := os.WriteFile(path("%v.txt", name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		args       []string
+		want       int
+		wantStderr string
+	}{
+		{args: []string{"batch", "-h"}, want: exitOK},
+		{args: []string{"batch", "signature"}, want: exitUsage},
+		{args: []string{"batch", "-manifest", path("signature.txt")}, want: exitUsage},
+		{args: []string{"batch", "-manifest", path("signature.txt"), "unknown"}, want: exitUsage},
+		{args: []string{"batch", "-manifest", path("missing.txt"), "signature"}, want: exitIO},
+		{args: []string{"batch", "-manifest", path("invalid.txt"), "signature"}, want: exitError},
+		{
+			args:       []string{"batch", "-block-size", "10", "-jobs", "2", "-manifest", path("signature.txt"), "signature"},
+			want:       exitOK,
+			wantStderr: "5 succeeded, 0 failed",
+		},
+		{
+			args:       []string{"batch", "-block-size", "10", "-manifest", path("delta.txt"), "delta"},
+			want:       exitOK,
+			wantStderr: "5 succeeded, 0 failed",
+		},
+		{
+			args:       []string{"batch", "-block-size", "10", "-jobs", "3", "-manifest", path("patch.txt"), "patch"},
+			want:       exitIO,
+			wantStderr: "5 succeeded, 1 failed",
+		},
+	} {
+		var stderr bytes.Buffer
+		if got := run(tt.args, io.Discard, &stderr); got != tt.want {
+			t.Errorf("run(%q) = %v, want %v, stderr: %v", tt.args, got, tt.want, stderr.String())
+		}
+		if !strings.Contains(stderr.String(), tt.wantStderr) {
+			t.Errorf("run(%q) stderr = %q, want it to contain %q", tt.args, stderr.String(), tt.wantStderr)
+		}
+	}
+	for i, source := range sources {
+		got, err := os.ReadFile(path("output%v", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, source) {
+			t.Errorf("the patched output%v differs from the source", i)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/rdiffdaemon"
+)
+
+// daemon runs the signature, delta and patch jobs sent by the local processes over a Unix socket, using the
+// rdiffdaemon protocol, until it's interrupted, so they don't run a rdiff process per call, and the signatures of the
+// unchanged targets are cached.
+func daemon(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rdiff daemon", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: rdiff daemon [flags] -socket <path>")
+		fs.PrintDefaults()
+	}
+	socket := fs.String("socket", "", "the Unix socket to listen on, only accessible by the user")
+	blockSize := fs.Int("block-size", rdiff.DefaultBlockSize, "the block size, in bytes, of the jobs, unless the request sets one")
+	jobs := fs.Int("jobs", runtime.GOMAXPROCS(0), "the max number of jobs run at once, the other ones wait their turn")
+	cacheSize := fs.Int("cache-size", rdiffdaemon.DefaultCacheSize>>20, "the size, in MiB, of the signature cache, 0 disables it")
+	eo := newErrorOutput(fs, stderr)
+	if ok, code := parse(fs, args, 0); !ok {
+		return code
+	}
+	if *socket == "" || *blockSize <= 0 || *jobs <= 0 || *cacheSize < 0 {
+		fmt.Fprintln(stderr, "rdiff daemon: the -socket flag is required, the block size and the jobs must be > 0, and the cache size >= 0")
+		fs.Usage()
+		return exitUsage
+	}
+
+	server := rdiffdaemon.NewServer(*blockSize, *jobs)
+	server.Cache = signatureCache(*cacheSize)
+	l, err := listenUnix(*socket)
+	if err == nil {
+		err = serveListener(ctx, l, server.Serve, stdout)
+	}
+	if err != nil {
+		return eo.report(err)
+	}
+
+	return exitOK
+}
+
+// signatureCache returns a signature cache of mib MiB, or nil for 0, meaning the signatures are not cached.
+func signatureCache(mib int) *rdiff.SignatureCache {
+	if mib <= 0 {
+		return nil
+	}
+
+	return rdiff.NewSignatureCache(int64(mib) << 20)
+}
+
+// listenUnix listens on the Unix socket at path, which only the user can connect to, as the jobs read and write
+// the user's files. A socket left behind by a daemon which didn't exit cleanly is replaced, while one a daemon still
+// listens on returns a non-nil error.
+func listenUnix(path string) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		conn, dialErr := net.Dial("unix", path)
+		if dialErr == nil {
+			conn.Close()
+			return nil, fmt.Errorf("a daemon is already listening on %v", path)
+		}
+		if os.Remove(path) == nil {
+			l, err = net.Listen("unix", path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		return nil, errors.Join(err, l.Close())
+	}
+
+	return l, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/silviutanasa/rdiff/rdiffdaemon"
+)
+
+func TestRun_DaemonUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"daemon"},
+		{"daemon", "-socket", "s", "-jobs", "0"},
+		{"daemon", "-socket", "s", "-block-size", "0"},
+		{"daemon", "-socket", "s", "-cache-size", "-1"},
+		{"daemon", "-socket", "s", "extra"},
+	} {
+		if got := run(args, io.Discard, io.Discard); got != exitUsage {
+			t.Errorf("run(%q) = %v, want %v", args, got, exitUsage)
+		}
+	}
+}
+
+// testSocketPath returns the path of a Unix socket in a new directory, short enough for the socket paths limit.
+func testSocketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "rdiffd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return filepath.Join(dir, "sock")
+}
+
+func TestDaemon(t *testing.T) {
+	dir := t.TempDir()
+	target := bytes.Repeat([]byte("0123456789abcdef"), 256)
+	if err := os.WriteFile(filepath.Join(dir, "target"), target, 0600); err != nil {
+		t.Fatal(err)
+	}
+	socket := testSocketPath(t)
+	// a socket left behind is replaced
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stdout syncBuffer
+	done := make(chan int)
+	go func() {
+		done <- daemon(ctx, []string{"-socket", socket, "-block-size", "64", "-jobs", "1"}, &stdout, io.Discard)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(stdout.String(), "\n") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("the socket mode = %v, %v, want %v", info.Mode().Perm(), err, os.FileMode(0600))
+	}
+	if got := run([]string{"daemon", "-socket", socket}, io.Discard, io.Discard); got == exitOK {
+		t.Error("a second daemon listens on the socket")
+	}
+
+	c, err := rdiffdaemon.Dial(context.Background(), socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Signature(context.Background(), filepath.Join(dir, "target"), filepath.Join(dir, "signature")); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := c.Status(context.Background()); err != nil || st.MaxJobs != 1 || st.CachedSignatures != 1 {
+		t.Errorf("Status() = %+v, %v, want 1 max job, and 1 cached signature", st, err)
+	}
+	cancel()
+	if got := <-done; got != exitOK {
+		t.Errorf("daemon() = %v, want %v", got, exitOK)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("the socket is not removed, error = %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// errorKinds names the kinds of errors, by exit code, for -error-format json.
+var errorKinds = map[int]string{
+	exitError:        "error",
+	exitUsage:        "usage",
+	exitCorrupt:      "corrupt",
+	exitVerification: "verification",
+	exitIO:           "io",
+	exitModified:     "modified",
+}
+
+// usageError is an invalid command line found once the flags are parsed, ex: an output which is one of the inputs.
+type usageError struct {
+	error
+}
+
+func (e usageError) Unwrap() error {
+	return e.error
+}
+
+// exitCode returns the exit code of a command which failed with err.
+// The IO errors take precedence, as a failed read can make an input look corrupt.
+func exitCode(err error) int {
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+	switch {
+	case errors.As(err, &pathErr), errors.As(err, &linkErr), errors.As(err, &syscallErr):
+		return exitIO
+	case errors.As(err, new(usageError)):
+		return exitUsage
+	case errors.Is(err, rdiff.ErrCorrupt):
+		return exitCorrupt
+	case errors.Is(err, rdiff.ErrVerification):
+		return exitVerification
+	case errors.Is(err, rdiff.ErrModified):
+		return exitModified
+	default:
+		return exitError
+	}
+}
+
+// jsonError is an error printed by -error-format json, as a single line.
+type jsonError struct {
+	Command  string `json:"command"`
+	Error    string `json:"error"`
+	Kind     string `json:"kind"`
+	ExitCode int    `json:"exit_code"`
+	// Line is the manifest line of a batch run, 0 for the other commands
+	Line int `json:"line,omitempty"`
+	// Path is the file of a watch update, if any
+	Path string `json:"path,omitempty"`
+}
+
+// errorOutput prints the errors of a command, in the format selected by -error-format.
+type errorOutput struct {
+	w       io.Writer
+	command string
+	json    bool
+}
+
+// newErrorOutput defines the -error-format flag on fs, and returns the output printing the errors to w.
+func newErrorOutput(fs *flag.FlagSet, w io.Writer) *errorOutput {
+	eo := &errorOutput{w: w, command: strings.TrimPrefix(fs.Name(), "rdiff ")}
+	fs.Func("error-format", "the format of the errors printed to stderr: text(the default), or json(an object per line)", func(s string) error {
+		switch s {
+		case "text", "json":
+			eo.json = s == "json"
+			return nil
+		default:
+			return fmt.Errorf("unknown error format: %q", s)
+		}
+	})
+
+	return eo
+}
+
+// report prints err, and returns the exit code matching it.
+func (eo *errorOutput) report(err error) int {
+	e := eo.newError(err)
+	eo.print(e)
+
+	return e.ExitCode
+}
+
+// newError describes err, failing the command.
+func (eo *errorOutput) newError(err error) jsonError {
+	code := exitCode(err)
+
+	return jsonError{Command: eo.command, Error: err.Error(), Kind: errorKinds[code], ExitCode: code}
+}
+
+// print prints e, as JSON or as a text line, the line and path, if any, prefixing the text message.
+func (eo *errorOutput) print(e jsonError) {
+	if eo.json {
+		// a failed write to stderr can't be reported
+		_ = json.NewEncoder(eo.w).Encode(e)
+		return
+	}
+	prefix := "rdiff " + e.Command + ": "
+	if e.Line > 0 {
+		prefix += fmt.Sprintf("manifest line %v: ", e.Line)
+	}
+	if e.Path != "" {
+		prefix += e.Path + ": "
+	}
+	fmt.Fprintln(eo.w, prefix+e.Error)
+}
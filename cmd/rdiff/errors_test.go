@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/silviutanasa/rdiff"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want int
+	}{
+		{err: errors.New("failed"), want: exitError},
+		{err: &fs.PathError{Op: "open", Path: "file", Err: fs.ErrNotExist}, want: exitIO},
+		{err: &os.LinkError{Op: "rename", Old: "a", New: "b", Err: fs.ErrPermission}, want: exitIO},
+		{err: fmt.Errorf("reading: %w", rdiff.ErrCorrupt), want: exitCorrupt},
+		{err: fmt.Errorf("checking: %w", rdiff.ErrVerification), want: exitVerification},
+		{err: fmt.Errorf("reading: %w", rdiff.ErrModified), want: exitModified},
+		{err: fmt.Errorf("preparing: %w", usageError{errors.New("invalid")}), want: exitUsage},
+		// a failed read makes the input look corrupt
+		{err: errors.Join(rdiff.ErrCorrupt, &fs.PathError{Op: "read", Path: "file", Err: fs.ErrClosed}), want: exitIO},
+	} {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRun_ErrorFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	if err := os.WriteFile(path("delta"), []byte("not a delta"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	args := []string{"patch", "-quiet", "-error-format", "json", path("delta"), path("delta"), path("output")}
+	if got := run(args, &bytes.Buffer{}, &stderr); got != exitCorrupt {
+		t.Fatalf("run(%q) = %v, want %v", args, got, exitCorrupt)
+	}
+	var got jsonError
+	if err := json.Unmarshal(stderr.Bytes(), &got); err != nil {
+		t.Fatalf("run(%q) stderr = %q: %v", args, stderr.String(), err)
+	}
+	got.Error = ""
+	want := jsonError{Command: "patch", Kind: "corrupt", ExitCode: exitCorrupt}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("run(%q) error \nDIFF: %v", args, diff)
+	}
+
+	for _, args := range [][]string{
+		{"inspect", "-error-format", "xml", path("delta")},
+		{"signature", "-error-format", "", path("delta"), path("signature")},
+	} {
+		if got := run(args, &bytes.Buffer{}, &bytes.Buffer{}); got != exitUsage {
+			t.Errorf("run(%q) = %v, want %v", args, got, exitUsage)
+		}
+	}
+}
+
+func TestErrorOutput_Text(t *testing.T) {
+	var buf bytes.Buffer
+	eo := &errorOutput{w: &buf, command: "batch"}
+	eo.print(jsonError{Command: "batch delta", Error: "failed", Line: 3})
+	eo.print(jsonError{Command: "watch", Error: "failed", Path: "file"})
+	want := "rdiff batch delta: manifest line 3: failed\nrdiff watch: file: failed\n"
+	if buf.String() != want {
+		t.Errorf("print() = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// inspect prints the description of a signature or a delta file, detecting which of them it is, and optionally
+// every delta operation, to stdout.
+func inspect(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rdiff inspect", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: rdiff inspect [flags] <file>")
+		fs.PrintDefaults()
+	}
+	eo := newErrorOutput(fs, stderr)
+	ops := fs.Bool("ops", false, "list every delta operation")
+	if ok, code := parse(fs, args, 1); !ok {
+		return code
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return eo.report(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(stdout)
+	var fn func(rdiff.Operation) error
+	if *ops {
+		fmt.Fprintln(w, "operations:")
+		fn = func(op rdiff.Operation) error {
+			return printOperation(w, op)
+		}
+	}
+	dump, err := rdiff.DumpArtifact(f, fn)
+	if err == nil {
+		printDump(w, dump)
+	}
+	err = errors.Join(err, w.Flush())
+	if err != nil {
+		return eo.report(err)
+	}
+
+	return exitOK
+}
+
+func printOperation(w io.Writer, op rdiff.Operation) error {
+	if op.Type == rdiff.OpBlockZero {
+		_, err := fmt.Fprintf(w, "  %-6v %-12v zeros %v bytes\n", op.Type, "", op.Zeros)
+		return err
+	}
+	block := ""
+	if op.Type != rdiff.OpBlockNew {
+		block = fmt.Sprintf("block %v", op.BlockIndex)
+	}
+	_, err := fmt.Fprintf(w, "  %-6v %-12v data %v bytes\n", op.Type, block, len(op.Data))
+
+	return err
+}
+
+func printDump(w io.Writer, dump rdiff.Dump) {
+	fmt.Fprintf(w, "type: %v\n", dump.Type)
+	if dump.Type == rdiff.ArtifactSignature {
+		h := dump.SignatureHeader
+		keyID := "none"
+		if h.StrongHashKeyID != nil {
+			keyID = hex.EncodeToString(h.StrongHashKeyID)
+		}
+		fmt.Fprintf(w, "weak hash: %v\n", h.WeakHash)
+		fmt.Fprintf(w, "strong hash: %v, %v bytes\n", h.StrongHash, h.StrongHashSize)
+		fmt.Fprintf(w, "strong hash key id: %v\n", keyID)
+		fmt.Fprintf(w, "target size: %v\n", h.TargetSize)
+		fmt.Fprintf(w, "block size: %v\n", h.BlockSize)
+		fmt.Fprintf(w, "blocks: %v\n", dump.Blocks)
+		return
+	}
+
+	var total int64
+	for _, n := range dump.Operations {
+		total += n
+	}
+	fmt.Fprintf(w, "source size: %v\n", dump.DeltaHeader.SourceSize)
+	fmt.Fprintf(w, "operations: %v\n", total)
+	for t, n := range dump.Operations {
+		// only the sparse deltas have zero runs, only the ones reusing the blocks have copies, and only the ones
+		// running a second pass have parts
+		if rdiff.OpType(t) >= rdiff.OpBlockZero && n == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "  %-6v %v\n", rdiff.OpType(t), n)
+	}
+	fmt.Fprintf(w, "literal bytes: %v\n", dump.LiteralBytes)
+	if dump.ZeroBytes > 0 {
+		fmt.Fprintf(w, "zero bytes: %v\n", dump.ZeroBytes)
+	}
+}
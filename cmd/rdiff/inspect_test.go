@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRun_Inspect(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	if err := os.WriteFile(path("target"), []byte{1, 2, 3, 4, 5, 6, 7}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("source"), []byte{0, 1, 2, 3, 7, 8}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"signature", "-quiet", "-block-size", "3", "-strong-hash", "sha256", path("target"), path("signature")},
+		{"delta", "-quiet", "-block-size", "3", path("signature"), path("source"), path("delta")},
+	} {
+		if got := run(args, io.Discard, io.Discard); got != exitOK {
+			t.Fatalf("run(%q) = %v, want %v", args, got, exitOK)
+		}
+	}
+
+	for _, tt := range []struct {
+		args       []string
+		want       int
+		wantStdout string
+	}{
+		{args: []string{"inspect"}, want: exitUsage},
+		{args: []string{"inspect", path("missing")}, want: exitIO},
+		{args: []string{"inspect", path("source")}, want: exitCorrupt},
+		{
+			args: []string{"inspect", path("signature")},
+			want: exitOK,
+			wantStdout: `type: signature
+weak hash: adler32
+strong hash: sha256, 32 bytes
+strong hash key id: none
+target size: 7
+block size: 3
+blocks: 3
+`,
+		},
+		{
+			args: []string{"inspect", "-ops", path("delta")},
+			want: exitOK,
+			wantStdout: `operations:
+  update block 0      data 1 bytes
+  remove block 1      data 0 bytes
+  remove block 2      data 0 bytes
+  new                 data 2 bytes
+type: delta
+source size: 6
+operations: 4
+  keep   0
+  update 1
+  remove 2
+  new    1
+literal bytes: 3
+`,
+		},
+	} {
+		var stdout, stderr bytes.Buffer
+		if got := run(tt.args, &stdout, &stderr); got != tt.want {
+			t.Errorf("run(%q) = %v, want %v, stderr: %v", tt.args, got, tt.want, stderr.String())
+		}
+		if diff := cmp.Diff(stdout.String(), tt.wantStdout); diff != "" {
+			t.Errorf("run(%q) stdout differs, \nDIFF: %v", tt.args, diff)
+		}
+	}
+}
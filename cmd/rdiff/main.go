@@ -0,0 +1,350 @@
+// Command rdiff exposes the rdiff package operations from the command line:
+//
+//	rdiff signature [flags] <target> <signature>
+//	rdiff delta [flags] <signature> <source> <delta>
+//	rdiff patch [flags] <target> <delta> <output>
+//	rdiff batch [flags] -manifest <manifest> <command>
+//	rdiff inspect [flags] <file>
+//	rdiff watch [flags] <dir> -sig-dir <dir>
+//	rdiff serve [flags] -stdio|-listen <addr> <dir>
+//	rdiff daemon [flags] -socket <path>
+//
+// The block size must be the same for all the subcommands run on the same target.
+//
+// The exit code is 0 on success, 2 for an invalid command line, 3 for a corrupt signature or delta, 4 for an input
+// which doesn't verify(ex: a signature computed with another key), 5 for an IO error, and 1 for the other errors.
+// The -error-format json flag prints the errors as JSON objects, one per line, instead of text.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// The exit codes are stable, so the scripts can react to specific failures.
+const (
+	exitOK = 0
+	// exitError is a failure which has no specific exit code
+	exitError = 1
+	// exitUsage is an invalid command line
+	exitUsage = 2
+	// exitCorrupt is a malformed signature or delta, see rdiff.ErrCorrupt
+	exitCorrupt = 3
+	// exitVerification is an input which doesn't verify, see rdiff.ErrVerification
+	exitVerification = 4
+	// exitIO is a failed file system operation, ex: a missing input file
+	exitIO = 5
+	// exitModified is an input modified while it was read, see rdiff.ErrModified, so the command can be retried
+	exitModified = 6
+)
+
+// command is a rdiff subcommand, its arguments are file paths, the last one being the output.
+type command struct {
+	name string
+	args []string
+	run  func(app *rdiff.App, args []string) error
+	// stats returns the stats of a successful run, for -stats-json, nil if the command doesn't support it
+	stats func(app *rdiff.App, args []string, elapsed time.Duration) (commandStats, error)
+	// flags defines the flags of the command, not shared with the other commands, on fs, and returns the function
+	// returning the options they configure once parsed, nil if the command has no flags of its own
+	flags func(fs *flag.FlagSet) func() ([]rdiff.Option, error)
+}
+
+var commands = []command{
+	{
+		name: "signature",
+		args: []string{"target", "signature"},
+		run: func(app *rdiff.App, args []string) error {
+			return app.Signature(args[0], args[1])
+		},
+	},
+	{
+		name: "delta",
+		args: []string{"signature", "source", "delta"},
+		run: func(app *rdiff.App, args []string) error {
+			return app.Delta(args[0], args[1], args[2])
+		},
+		stats: deltaStats,
+	},
+	{
+		name: "patch",
+		args: []string{"target", "delta", "output"},
+		run: func(app *rdiff.App, args []string) error {
+			return app.Patch(args[0], args[1], args[2])
+		},
+		stats: patchStats,
+		flags: patchFlags,
+	},
+}
+
+// patchFlags defines the flags of the patch command: the check of the target against the signature the delta was
+// computed against, see rdiff.WithBasisCheck.
+func patchFlags(fs *flag.FlagSet) func() ([]rdiff.Option, error) {
+	check := rdiff.BasisCheckNone
+	fs.TextVar(&check, "check", rdiff.BasisCheckNone,
+		"check the target matches the -signature before patching it: none, spot(its size and a sample of its blocks), or full")
+	signature := fs.String("signature", "", "the signature the delta was computed against, required by -check")
+
+	return func() ([]rdiff.Option, error) {
+		if check == rdiff.BasisCheckNone {
+			return nil, nil
+		}
+		if *signature == "" {
+			return nil, fmt.Errorf("-check %v requires -signature", check)
+		}
+		return []rdiff.Option{rdiff.WithBasisCheck(*signature, check)}, nil
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the subcommand named by the first argument and returns the process exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "batch":
+		return batch(args[1:], stderr)
+	case "inspect":
+		return inspect(args[1:], stdout, stderr)
+	case "watch":
+		return watch(context.Background(), args[1:], stdout, stderr)
+	case "serve":
+		return serve(context.Background(), args[1:], os.Stdin, stdout, stderr)
+	case "daemon":
+		return daemon(context.Background(), args[1:], stdout, stderr)
+	}
+	if cmd, ok := findCommand(args[0]); ok {
+		return cmd.exec(args[1:], stdout, stderr)
+	}
+	fmt.Fprintf(stderr, "rdiff: unknown command %q\n", args[0])
+	usage(stderr)
+
+	return exitUsage
+}
+
+// findCommand returns the command with the given name, if any.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: rdiff <command> [flags] <files>")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "\trdiff %v [flags] <%v>\n", cmd.name, strings.Join(cmd.args, "> <"))
+	}
+	fmt.Fprintln(w, "\trdiff batch [flags] -manifest <manifest> <command>")
+	fmt.Fprintln(w, "\trdiff inspect [flags] <file>")
+	fmt.Fprintln(w, "\trdiff watch [flags] <dir> -sig-dir <dir>")
+	fmt.Fprintln(w, "\trdiff serve [flags] -stdio|-listen <addr> <dir>")
+	fmt.Fprintln(w, "\trdiff daemon [flags] -socket <path>")
+	fmt.Fprintln(w, `run "rdiff <command> -h" for the command flags`)
+}
+
+// appFlags are the flags configuring the rdiff.App, shared by all the commands.
+type appFlags struct {
+	fs         *flag.FlagSet
+	blockSize  *int
+	weakHash   rdiff.WeakHashType
+	strongHash rdiff.StrongHashType
+	format     rdiff.Format
+	overwrite  *bool
+	sparse     *bool
+}
+
+// newAppFlags defines the flags configuring the rdiff.App on fs.
+func newAppFlags(fs *flag.FlagSet) *appFlags {
+	f := &appFlags{
+		fs:         fs,
+		blockSize:  fs.Int("block-size", rdiff.DefaultBlockSize, "the block size, in bytes, <= 0 means adopted from the signature, or the delta, or computed from the target size"),
+		weakHash:   rdiff.WeakHashAdler32,
+		strongHash: rdiff.StrongHashMD5,
+		format:     rdiff.FormatGob,
+	}
+	fs.TextVar(&f.weakHash, "weak-hash", rdiff.WeakHashAdler32,
+		"the rolling hash: adler32, rabin, buzhash, adler64, crc32c, librsync or rabinkarp, delta uses the signature's by default")
+	fs.TextVar(&f.strongHash, "strong-hash", rdiff.StrongHashMD5,
+		"the strong hash: md5, sha1, sha256, md4 or blake2b, delta uses the signature's by default")
+	fs.TextVar(&f.format, "format", rdiff.FormatGob, "the output format: gob, json, librsync, or vcdiff(delta only)")
+	fs.Func("compat", "read and write the files of another tool: librsync, the same as -format librsync", func(s string) error {
+		if s != "librsync" {
+			return fmt.Errorf("unknown compat mode: %q", s)
+		}
+		f.format = rdiff.FormatLibrsync
+		return nil
+	})
+	f.overwrite = fs.Bool("overwrite", false, "overwrite the output file, if it exists")
+	f.sparse = fs.Bool("sparse", false, "skip the holes of the inputs, send the zero blocks as zero runs, and write them as holes")
+
+	return f
+}
+
+// newApp returns an app configured by the flags, and the extra options.
+func (f *appFlags) newApp(opts ...rdiff.Option) *rdiff.App {
+	opts = append(opts, rdiff.WithFormat(f.format), rdiff.WithSparse(*f.sparse))
+	opts = append(opts, hashOptions(f.fs, f.weakHash, f.strongHash)...)
+
+	return rdiff.New(*f.blockSize, opts...)
+}
+
+// prepareOutput removes the output file, the last of the files, if -overwrite is given, so the command can create it.
+// An output which is one of the inputs, ex: the target of a patch, is never removed, so a patch can't destroy the
+// running version of an A/B update, and a usageError is returned instead.
+func (f *appFlags) prepareOutput(files []string) error {
+	if !*f.overwrite {
+		return nil
+	}
+	path := files[len(files)-1]
+	// a symbolic link is removed, not the file it points to
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, input := range files[:len(files)-1] {
+		inputInfo, err := os.Stat(input)
+		if err == nil && os.SameFile(info, inputInfo) {
+			return usageError{fmt.Errorf("the output %v is the input %v, it can't be overwritten", path, input)}
+		}
+	}
+
+	return os.Remove(path)
+}
+
+// parse parses the command line of a command taking nargs arguments, it returns false, and the exit code, if the
+// command must not run(ex: invalid flags, or -h).
+func parse(fs *flag.FlagSet, args []string, nargs int) (bool, int) {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return false, exitOK
+	}
+	if err != nil {
+		return false, exitUsage
+	}
+	if fs.NArg() != nargs {
+		fmt.Fprintf(fs.Output(), "%v: expected %v arguments, got %v\n", fs.Name(), nargs, fs.NArg())
+		fs.Usage()
+		return false, exitUsage
+	}
+
+	return true, exitOK
+}
+
+// exec parses the flags and the arguments of the command, then runs it.
+func (cmd command) exec(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rdiff "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: rdiff %v [flags] <%v>\n", cmd.name, strings.Join(cmd.args, "> <"))
+		fs.PrintDefaults()
+	}
+	af := newAppFlags(fs)
+	eo := newErrorOutput(fs, stderr)
+	quiet := fs.Bool("quiet", false, "don't display the progress")
+	noTTY := fs.Bool("no-tty", false, "display the progress as plain lines, instead of a bar, it's the default when stderr is not a terminal")
+	var statsPath *string
+	if cmd.stats != nil {
+		statsPath = fs.String("stats-json", "", `write the run stats, as JSON, to the given file, "-" means stdout`)
+	}
+	options := cmd.defineFlags(fs)
+	if ok, code := parse(fs, args, len(cmd.args)); !ok {
+		return code
+	}
+	opts, err := options()
+	if err != nil {
+		fmt.Fprintf(stderr, "%v: %v\n", fs.Name(), err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	files := fs.Args()
+	err = af.prepareOutput(files)
+	if err != nil {
+		return eo.report(err)
+	}
+	var pb *progressBar
+	if !*quiet {
+		pb = newProgressBar(stderr, !*noTTY && isTerminal(stderr))
+		opts = append(opts, rdiff.WithProgress(pb.update))
+	}
+	app := af.newApp(opts...)
+	start := time.Now()
+	err = cmd.run(app, files)
+	if pb != nil {
+		pb.finish()
+	}
+	if err == nil && statsPath != nil && *statsPath != "" {
+		err = cmd.writeStats(app, files, time.Since(start), *statsPath, stdout)
+	}
+	if err != nil {
+		return eo.report(err)
+	}
+
+	return exitOK
+}
+
+// defineFlags defines the flags of the command of its own, if any, on fs, and returns the function returning the options
+// they configure.
+func (cmd command) defineFlags(fs *flag.FlagSet) func() ([]rdiff.Option, error) {
+	if cmd.flags == nil {
+		return func() ([]rdiff.Option, error) { return nil, nil }
+	}
+
+	return cmd.flags(fs)
+}
+
+// writeStats writes the stats of a successful run to path, "-" meaning stdout.
+func (cmd command) writeStats(app *rdiff.App, files []string, elapsed time.Duration, path string, stdout io.Writer) error {
+	stats, err := cmd.stats(app, files, elapsed)
+	if err != nil {
+		return err
+	}
+
+	return writeStats(path, stdout, stats)
+}
+
+// hashOptions returns the options pinning the hash algorithms given on the command line, the ones not given are
+// left to the defaults, or adopted from the signature by delta.
+func hashOptions(fs *flag.FlagSet, weakHash rdiff.WeakHashType, strongHash rdiff.StrongHashType) []rdiff.Option {
+	var opts []rdiff.Option
+	if isFlagSet(fs, "weak-hash") {
+		opts = append(opts, rdiff.WithWeakHash(weakHash))
+	}
+	if isFlagSet(fs, "strong-hash") {
+		opts = append(opts, rdiff.WithStrongHash(strongHash))
+	}
+
+	return opts
+}
+
+// isFlagSet reports whether the flag was given on the command line.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+
+	return set
+}
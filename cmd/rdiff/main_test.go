@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := bytes.Repeat([]byte("0123456789"), 100)
+	source := append([]byte("new data"), target[100:]...)
+	if err := os.WriteFile(path("target"), target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("source"), source, 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		args []string
+		want int
+	}{
+		{args: nil, want: exitUsage},
+		{args: []string{"unknown"}, want: exitUsage},
+		{args: []string{"signature", "-h"}, want: exitOK},
+		{args: []string{"signature", "-unknown"}, want: exitUsage},
+		{args: []string{"signature", path("target")}, want: exitUsage},
+		{args: []string{"signature", "-strong-hash", "crc", path("target"), path("signature")}, want: exitUsage},
+		{args: []string{"signature", "-block-size", "10", "-strong-hash", "sha256", path("target"), path("signature")}, want: exitOK},
+		// the output exists
+		{args: []string{"signature", "-block-size", "10", path("target"), path("signature")}, want: exitIO},
+		{args: []string{"signature", "-block-size", "10", "-strong-hash", "sha256", "-overwrite", path("target"), path("signature")}, want: exitOK},
+		{args: []string{"signature", "-weak-hash", "custom", path("target"), path("signature")}, want: exitUsage},
+		{args: []string{"signature", "-format", "xdelta", path("target"), path("signature")}, want: exitUsage},
+		// the vcdiff format only encodes deltas
+		{args: []string{"signature", "--format", "vcdiff", path("target"), path("signature.vcdiff")}, want: exitError},
+		{args: []string{"signature", "--block-size", "10", "--weak-hash", "rabin", "--format", "json", path("target"), path("signature.json")}, want: exitOK},
+		// the signature's weak hash is pinned to another one
+		{args: []string{"delta", "-block-size", "10", "-weak-hash", "rabin", path("signature"), path("source"), path("delta")}, want: exitVerification},
+		// the signature's strong hash is pinned to another one
+		{args: []string{"delta", "-block-size", "10", "-strong-hash", "md5", path("signature"), path("source"), path("delta2")}, want: exitVerification},
+		{args: []string{"delta", "-block-size", "10", "-overwrite", path("signature"), path("source"), path("delta")}, want: exitOK},
+		{args: []string{"delta", "-block-size", "10", "-format", "vcdiff", path("signature"), path("source"), path("delta.vcdiff")}, want: exitOK},
+		{args: []string{"patch", "-block-size", "10", path("target"), path("delta"), path("output")}, want: exitOK},
+		{args: []string{"patch", "-block-size", "10", path("missing"), path("delta"), path("output2")}, want: exitIO},
+		// -overwrite doesn't remove the target, which the later commands read
+		{args: []string{"patch", "-block-size", "10", "-overwrite", path("target"), path("delta"), path("target")}, want: exitUsage},
+		{args: []string{"patch", "-block-size", "10", "-check", "spot", path("target"), path("delta"), path("output2")}, want: exitUsage},
+		{args: []string{"patch", "-check", "partial", "-signature", path("signature"), path("target"), path("delta"), path("output2")}, want: exitUsage},
+		{args: []string{"patch", "-block-size", "10", "-check", "full", "-signature", path("signature"), path("target"), path("delta"), path("output2")}, want: exitOK},
+		// the source isn't the target the delta was computed against
+		{args: []string{"patch", "-block-size", "10", "-check", "spot", "-signature", path("signature"), path("source"), path("delta"), path("output3")}, want: exitVerification},
+		{args: []string{"signature", "-compat", "xdelta", path("target"), path("signature.librsync")}, want: exitUsage},
+		{args: []string{"signature", "--compat=librsync", "-block-size", "64", path("target"), path("signature.librsync")}, want: exitOK},
+		{args: []string{"delta", "--compat=librsync", path("signature.librsync"), path("source"), path("delta.librsync")}, want: exitOK},
+		// a gob delta is not a librsync delta, the failed patch removes the output file
+		{args: []string{"patch", "--compat=librsync", path("target"), path("delta"), path("output.librsync")}, want: exitCorrupt},
+		{args: []string{"patch", "--compat=librsync", "-overwrite", path("target"), path("delta.librsync"), path("output.librsync")}, want: exitOK},
+	} {
+		var stderr bytes.Buffer
+		if got := run(tt.args, io.Discard, &stderr); got != tt.want {
+			t.Errorf("run(%q) = %v, want %v, stderr: %v", tt.args, got, tt.want, stderr.String())
+		}
+	}
+	got, err := os.ReadFile(path("output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, source) {
+		t.Errorf("the patched output differs from the source")
+	}
+	got, err = os.ReadFile(path("output.librsync"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, source) {
+		t.Errorf("the librsync patched output differs from the source")
+	}
+}
+
+func TestRun_DynamicBlockSize(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := bytes.Repeat([]byte("0123456789abcdef"), 8<<10)
+	source := append([]byte("new data"), target[1000:]...)
+	if err := os.WriteFile(path("target"), target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("source"), source, 0666); err != nil {
+		t.Fatal(err)
+	}
+	// every command computes, or adopts, the block size
+	for _, args := range [][]string{
+		{"signature", "-quiet", "-block-size", "0", path("target"), path("signature")},
+		{"delta", "-quiet", "-block-size", "0", path("signature"), path("source"), path("delta")},
+		{"patch", "-quiet", "-block-size", "0", path("target"), path("delta"), path("output")},
+	} {
+		var stderr bytes.Buffer
+		if got := run(args, io.Discard, &stderr); got != exitOK {
+			t.Fatalf("run(%q) = %v, want %v, stderr: %v", args, got, exitOK, stderr.String())
+		}
+	}
+	got, err := os.ReadFile(path("output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, source) {
+		t.Error("the patched output differs from the source")
+	}
+}
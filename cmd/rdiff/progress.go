@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+const (
+	// progressBarWidth is the number of characters of the bar, without the stats
+	progressBarWidth = 30
+	// progressRedrawInterval throttles the terminal redraws
+	progressRedrawInterval = 100 * time.Millisecond
+	// progressLineStep is the percentage step between two progress lines, when the output is not a terminal
+	progressLineStep = 10
+)
+
+// progressBar renders the library progress, as a bar redrawn in place on a terminal, or as a line every
+// progressLineStep percents otherwise (ex: CI logs).
+type progressBar struct {
+	w   io.Writer
+	tty bool
+	now func() time.Time
+	// start is the time of the first update, the throughput is computed from it
+	start    time.Time
+	lastDraw time.Time
+	// lastStep is the last percentage step printed, when the output is not a terminal
+	lastStep int
+	last     rdiff.Progress
+}
+
+func newProgressBar(w io.Writer, tty bool) *progressBar {
+	return &progressBar{w: w, tty: tty, now: time.Now, lastStep: -1}
+}
+
+// isTerminal reports whether w is a terminal, so the progress bar can be redrawn in place.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (pb *progressBar) update(p rdiff.Progress) {
+	now := pb.now()
+	if pb.start.IsZero() {
+		pb.start = now
+	}
+	pb.last = p
+	if !pb.tty {
+		if step := percent(p) / progressLineStep * progressLineStep; step > pb.lastStep {
+			pb.lastStep = step
+			fmt.Fprintln(pb.w, pb.line(now))
+		}
+		return
+	}
+	if now.Sub(pb.lastDraw) >= progressRedrawInterval || p.Done == p.Total {
+		pb.lastDraw = now
+		fmt.Fprintf(pb.w, "\r%v", pb.line(now))
+	}
+}
+
+// finish ends the bar line, on a terminal.
+func (pb *progressBar) finish() {
+	if pb.tty && !pb.start.IsZero() {
+		fmt.Fprintln(pb.w)
+	}
+}
+
+// line formats the last progress, with its throughput and ETA.
+func (pb *progressBar) line(now time.Time) string {
+	p := pb.last
+	pct := percent(p)
+	elapsed := now.Sub(pb.start).Seconds()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(p.Done) / elapsed
+	}
+	eta := "--"
+	if rate > 0 {
+		eta = time.Duration(float64(p.Total-p.Done) / rate * float64(time.Second)).Round(time.Second).String()
+	}
+	filled := pct * progressBarWidth / 100
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+
+	return fmt.Sprintf("%-9v [%v] %3d%% %8.1f MiB/s ETA %v", p.Phase, bar, pct, rate/(1<<20), eta)
+}
+
+// percent returns the progress percentage, an empty input being complete.
+func percent(p rdiff.Progress) int {
+	if p.Total <= 0 {
+		return 100
+	}
+
+	return int(min(p.Done*100/p.Total, 100))
+}
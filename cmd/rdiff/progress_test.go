@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+func TestProgressBar(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		tty     bool
+		updates []int64
+		want    string
+	}{
+		{
+			name:    "lines",
+			updates: []int64{0, 5 << 20, 6 << 20, 10 << 20},
+			want: "delta     [                              ]   0%      0.0 MiB/s ETA --\n" +
+				"delta     [===============               ]  50%      5.0 MiB/s ETA 1s\n" +
+				"delta     [==================            ]  60%      3.0 MiB/s ETA 1s\n" +
+				"delta     [==============================] 100%      3.3 MiB/s ETA 0s\n",
+		},
+		{
+			name:    "terminal",
+			tty:     true,
+			updates: []int64{0, 5 << 20, 10 << 20},
+			want: "\rdelta     [                              ]   0%      0.0 MiB/s ETA --" +
+				"\rdelta     [===============               ]  50%      5.0 MiB/s ETA 1s" +
+				"\rdelta     [==============================] 100%      5.0 MiB/s ETA 0s\n",
+		},
+	} {
+		var out bytes.Buffer
+		pb := newProgressBar(&out, tt.tty)
+		// every update is a second after the previous one
+		now := time.Unix(0, 0)
+		pb.now = func() time.Time {
+			defer func() { now = now.Add(time.Second) }()
+			return now
+		}
+		for _, done := range tt.updates {
+			pb.update(rdiff.Progress{Phase: "delta", Done: done, Total: 10 << 20})
+		}
+		pb.finish()
+		if got := out.String(); got != tt.want {
+			t.Errorf("%v: progress bar output = \n%q, want \n%q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRun_Quiet(t *testing.T) {
+	var stderr bytes.Buffer
+	args := []string{"signature", "-quiet", "-block-size", "2", "main.go", t.TempDir() + "/signature"}
+	if got := run(args, io.Discard, &stderr); got != exitOK || strings.Contains(stderr.String(), "signature [") {
+		t.Errorf("run(%q) = %v, stderr: %q, want %v and no progress", args, got, stderr.String(), exitOK)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/rdifftcp"
+)
+
+// serve serves the files under a directory, using the rdifftcp protocol: a single operation on the standard input
+// and output(-stdio), which is how the rdiffssh transport runs it on the remote hosts, or the connections accepted
+// on a TCP address(-listen), until it's interrupted.
+func serve(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rdiff serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: rdiff serve [flags] -stdio|-listen <addr> <dir>")
+		fs.PrintDefaults()
+	}
+	blockSize := fs.Int("block-size", rdiff.DefaultBlockSize, "the block size, in bytes, of the signatures, unless the client proposes one")
+	stdio := fs.Bool("stdio", false, "serve a single operation on the standard input and output")
+	listen := fs.String("listen", "", "serve the TCP connections accepted on the address, ex: :7373")
+	bwlimit := fs.Int("bwlimit", 0, "the max bandwidth, in KiB per second, shared by the connections, 0 means unlimited")
+	eo := newErrorOutput(fs, stderr)
+	dirs, ok, code := parseInterspersed(fs, args, 1)
+	if !ok {
+		return code
+	}
+	if *stdio == (*listen != "") || *blockSize <= 0 || *bwlimit < 0 {
+		fmt.Fprintln(stderr, "rdiff serve: exactly one of -stdio and -listen is required, the block size must be > 0, and the bandwidth >= 0")
+		fs.Usage()
+		return exitUsage
+	}
+	info, err := os.Stat(dirs[0])
+	if err == nil && !info.IsDir() {
+		err = fmt.Errorf("%v is not a directory", dirs[0])
+	}
+	if err != nil {
+		return eo.report(err)
+	}
+
+	server := rdifftcp.NewServer(dirs[0], *blockSize)
+	server.Limiter = bandwidthLimiter(*bwlimit)
+	if *stdio {
+		// the failure is reported to the client as well
+		err = server.ServeStream(stdin, stdout)
+	} else {
+		err = serveTCP(ctx, server, *listen, stdout)
+	}
+	if err != nil {
+		return eo.report(err)
+	}
+
+	return exitOK
+}
+
+// bandwidthLimiter returns the limiter of a bandwidth of kib KiB per second, allowing bursts of 1/10 of a second,
+// of at least 32KiB, or nil for a bandwidth of 0, meaning unlimited.
+func bandwidthLimiter(kib int) *rate.Limiter {
+	if kib <= 0 {
+		return nil
+	}
+	bytes := kib << 10
+
+	return rate.NewLimiter(rate.Limit(bytes), max(bytes/10, 32<<10))
+}
+
+// serveTCP serves the connections accepted on addr, until it's interrupted, printing the address to stdout.
+func serveTCP(ctx context.Context, server *rdifftcp.Server, addr string, stdout io.Writer) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return serveListener(ctx, l, server.Serve, stdout)
+}
+
+// serveListener serves the connections accepted on l, until it's interrupted, then closes it, printing its address
+// to stdout.
+func serveListener(ctx context.Context, l net.Listener, serve func(net.Listener) error, stdout io.Writer) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() { l.Close() })
+	fmt.Fprintf(stdout, "serving on %v\n", l.Addr())
+	err := serve(l)
+	if ctx.Err() != nil && errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+
+	return err
+}
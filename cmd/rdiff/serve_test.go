@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff/rdifftcp"
+)
+
+func TestRun_ServeUsage(t *testing.T) {
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"serve", dir},
+		{"serve", "-stdio", "-listen", ":0", dir},
+		{"serve", "-stdio", "-block-size", "0", dir},
+		{"serve", "-stdio", "-bwlimit", "-1", dir},
+		{"serve", "-stdio"},
+	} {
+		if got := run(args, io.Discard, io.Discard); got != exitUsage {
+			t.Errorf("run(%q) = %v, want %v", args, got, exitUsage)
+		}
+	}
+	if got := run([]string{"serve", "-stdio", filepath.Join(dir, "missing")}, io.Discard, io.Discard); got != exitIO {
+		t.Errorf("run() with a missing directory = %v, want %v", got, exitIO)
+	}
+}
+
+// stdioConn is a client connection to a serve -stdio run, over pipes.
+type stdioConn struct {
+	io.Reader
+	io.WriteCloser
+	code chan int
+}
+
+func (c *stdioConn) Close() error {
+	c.WriteCloser.Close()
+	<-c.code
+	return nil
+}
+
+func TestServe_Stdio(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("the remote content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var code int
+	c := &rdifftcp.Client{Dial: func(ctx context.Context, _ string) (io.ReadWriteCloser, error) {
+		stdout, serverW := io.Pipe()
+		stdin, clientW := io.Pipe()
+		conn := &stdioConn{Reader: stdout, WriteCloser: clientW, code: make(chan int, 1)}
+		go func() {
+			code = serve(ctx, []string{"-stdio", "-block-size", "4", dir}, stdin, serverW, io.Discard)
+			serverW.Close()
+			conn.code <- code
+		}()
+		return conn, nil
+	}}
+	local := filepath.Join(t.TempDir(), "local")
+	if err := os.WriteFile(local, []byte("the local content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Pull(context.Background(), "", "file", local); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != "the remote content" {
+		t.Errorf("the local content after Pull() = %q", got)
+	}
+	if code != exitOK {
+		t.Errorf("serve() = %v, want %v", code, exitOK)
+	}
+}
+
+func TestServe_Listen(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("the remote content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var stdout syncBuffer
+	done := make(chan int)
+	go func() {
+		done <- serve(ctx, []string{"-listen", "127.0.0.1:0", dir}, nil, &stdout, io.Discard)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(stdout.String(), "\n") && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	addr := strings.TrimSpace(strings.TrimPrefix(stdout.String(), "serving on "))
+
+	local := filepath.Join(t.TempDir(), "local")
+	if err := os.WriteFile(local, []byte("the local content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := rdifftcp.Pull(context.Background(), addr, "file", local); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	cancel()
+	if got := <-done; got != exitOK {
+		t.Errorf("serve() = %v, want %v", got, exitOK)
+	}
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	if l := bandwidthLimiter(0); l != nil {
+		t.Errorf("bandwidthLimiter(0) = %v, want nil", l)
+	}
+	for _, tt := range []struct {
+		kib       int
+		wantLimit rate.Limit
+		wantBurst int
+	}{
+		{kib: 1, wantLimit: 1 << 10, wantBurst: 32 << 10},
+		{kib: 1 << 20, wantLimit: 1 << 30, wantBurst: 1 << 30 / 10},
+	} {
+		l := bandwidthLimiter(tt.kib)
+		if l.Limit() != tt.wantLimit || l.Burst() != tt.wantBurst {
+			t.Errorf("bandwidthLimiter(%v) = %v/s, burst %v, want %v/s, burst %v", tt.kib, l.Limit(), l.Burst(), tt.wantLimit, tt.wantBurst)
+		}
+	}
+}
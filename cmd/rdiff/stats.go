@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// commandStats is the machine-readable summary of a delta or patch run, written by -stats-json.
+type commandStats struct {
+	Command string `json:"command"`
+	// SourceSize is the size of the source, in bytes, which, for patch, is the size of the output
+	SourceSize int64 `json:"source_size"`
+	DeltaSize  int64 `json:"delta_size"`
+	// MatchedBlocks is the number of target blocks reused by the delta
+	MatchedBlocks int64 `json:"matched_blocks"`
+	// MatchedBytes is the number of source bytes found in the target
+	MatchedBytes int64 `json:"matched_bytes"`
+	// LiteralBytes is the number of source bytes carried by the delta
+	LiteralBytes int64 `json:"literal_bytes"`
+	// MatchRatio is MatchedBytes/SourceSize, 1 for an empty source
+	MatchRatio float64 `json:"match_ratio"`
+	// DeltaRatio is DeltaSize/SourceSize, 0 for an empty source
+	DeltaRatio float64 `json:"delta_ratio"`
+	// Unchanged means the source equals the target, so the delta is a no-op, delta only
+	Unchanged      bool    `json:"unchanged,omitempty"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+// deltaStats returns the stats of a delta run on the files: signature, source and delta.
+func deltaStats(app *rdiff.App, files []string, elapsed time.Duration) (commandStats, error) {
+	ds := app.LastDeltaStats()
+	stats := commandStats{Command: "delta", MatchedBlocks: ds.MatchedBlocks, LiteralBytes: ds.LiteralBytes, Unchanged: ds.Unchanged}
+	var err error
+	stats.SourceSize, err = fileSize(files[1])
+	if err != nil {
+		return stats, err
+	}
+	stats.DeltaSize, err = fileSize(files[2])
+	stats.MatchedBytes = stats.SourceSize - stats.LiteralBytes - ds.ZeroBytes
+
+	return stats.withRatios(elapsed), err
+}
+
+// patchStats returns the stats of a patch run on the files: target, delta and output.
+func patchStats(app *rdiff.App, files []string, elapsed time.Duration) (commandStats, error) {
+	ps := app.LastPatchStats()
+	stats := commandStats{
+		Command:       "patch",
+		SourceSize:    ps.CopiedBytes + ps.LiteralBytes + ps.ZeroBytes,
+		MatchedBlocks: ps.CopiedBlocks,
+		MatchedBytes:  ps.CopiedBytes,
+		LiteralBytes:  ps.LiteralBytes,
+	}
+	var err error
+	stats.DeltaSize, err = fileSize(files[1])
+
+	return stats.withRatios(elapsed), err
+}
+
+func (s commandStats) withRatios(elapsed time.Duration) commandStats {
+	s.MatchRatio = 1
+	if s.SourceSize > 0 {
+		s.MatchRatio = float64(s.MatchedBytes) / float64(s.SourceSize)
+		s.DeltaRatio = float64(s.DeltaSize) / float64(s.SourceSize)
+	}
+	s.ElapsedSeconds = elapsed.Seconds()
+
+	return s
+}
+
+// writeStats writes the stats as a JSON object to path, "-" meaning stdout.
+func writeStats(path string, stdout io.Writer, stats commandStats) error {
+	if path == "-" {
+		return encodeStats(stdout, stats)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = encodeStats(f, stats)
+
+	return errors.Join(err, f.Close())
+}
+
+func encodeStats(w io.Writer, stats commandStats) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(stats)
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun_StatsJSON(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := bytes.Repeat([]byte("0123456789"), 100)
+	source := append([]byte("new data"), target[100:]...)
+	if err := os.WriteFile(path("target"), target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("source"), source, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if got := run([]string{"signature", "-quiet", "-block-size", "10", path("target"), path("signature")}, io.Discard, io.Discard); got != exitOK {
+		t.Fatalf("signature = %v, want %v", got, exitOK)
+	}
+	// signature doesn't support -stats-json
+	if got := run([]string{"signature", "-stats-json", "-", path("target"), path("signature2")}, io.Discard, io.Discard); got != exitUsage {
+		t.Errorf("signature -stats-json = %v, want %v", got, exitUsage)
+	}
+
+	var stdout bytes.Buffer
+	args := []string{"delta", "-quiet", "-block-size", "10", "-stats-json", "-", path("signature"), path("source"), path("delta")}
+	if got := run(args, &stdout, io.Discard); got != exitOK {
+		t.Fatalf("run(%q) = %v, want %v", args, got, exitOK)
+	}
+	var delta commandStats
+	if err := json.Unmarshal(stdout.Bytes(), &delta); err != nil {
+		t.Fatal(err)
+	}
+	deltaSize, _ := fileSize(path("delta"))
+	// the source keeps the last 90 target blocks
+	if delta.Command != "delta" || delta.SourceSize != int64(len(source)) || delta.DeltaSize != deltaSize ||
+		delta.MatchedBlocks != 90 || delta.MatchedBytes != 900 || delta.LiteralBytes != 8 {
+		t.Errorf("delta stats = %+v", delta)
+	}
+	if want := 900 / float64(len(source)); delta.MatchRatio != want {
+		t.Errorf("delta stats MatchRatio = %v, want %v", delta.MatchRatio, want)
+	}
+	if want := float64(deltaSize) / float64(len(source)); delta.DeltaRatio != want {
+		t.Errorf("delta stats DeltaRatio = %v, want %v", delta.DeltaRatio, want)
+	}
+
+	args = []string{"patch", "-quiet", "-block-size", "10", "-stats-json", path("stats.json"), path("target"), path("delta"), path("output")}
+	if got := run(args, io.Discard, io.Discard); got != exitOK {
+		t.Fatalf("run(%q) = %v, want %v", args, got, exitOK)
+	}
+	data, err := os.ReadFile(path("stats.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patch commandStats
+	if err = json.Unmarshal(data, &patch); err != nil {
+		t.Fatal(err)
+	}
+	delta.Command, delta.ElapsedSeconds, patch.ElapsedSeconds = "patch", 0, 0
+	if patch != delta {
+		t.Errorf("patch stats = %+v, want %+v", patch, delta)
+	}
+
+	// the delta of the target itself is a no-op
+	stdout.Reset()
+	args = []string{"delta", "-quiet", "-block-size", "10", "-stats-json", "-", path("signature"), path("target"), path("noop")}
+	if got := run(args, &stdout, io.Discard); got != exitOK {
+		t.Fatalf("run(%q) = %v, want %v", args, got, exitOK)
+	}
+	var noop commandStats
+	if err := json.Unmarshal(stdout.Bytes(), &noop); err != nil {
+		t.Fatal(err)
+	}
+	if !noop.Unchanged || delta.Unchanged {
+		t.Errorf("delta stats Unchanged = %v, of the target itself = %v, want false and true", delta.Unchanged, noop.Unchanged)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// watch keeps the signatures of the files of a directory up to date, until it's interrupted, printing every
+// signature update to stdout, and the failed ones to stderr.
+func watch(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rdiff watch", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: rdiff watch [flags] <dir> -sig-dir <dir>")
+		fmt.Fprintln(stderr, "the signature of every file under <dir> is written to the same path under -sig-dir")
+		fs.PrintDefaults()
+	}
+	af := newAppFlags(fs)
+	eo := newErrorOutput(fs, stderr)
+	sigDir := fs.String("sig-dir", "", "the directory of the signatures")
+	dirs, ok, code := parseInterspersed(fs, args, 1)
+	if !ok {
+		return code
+	}
+	if *sigDir == "" {
+		fmt.Fprintln(stderr, "rdiff watch: the -sig-dir flag is required")
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := af.newApp().Watch(ctx, dirs[0], *sigDir, func(ev rdiff.WatchEvent) {
+		printWatchEvent(stdout, eo, ev)
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		return eo.report(err)
+	}
+
+	return exitOK
+}
+
+func printWatchEvent(stdout io.Writer, eo *errorOutput, ev rdiff.WatchEvent) {
+	switch {
+	case ev.Err != nil:
+		e := eo.newError(ev.Err)
+		e.Path = ev.Path
+		eo.print(e)
+	case ev.Removed:
+		fmt.Fprintf(stdout, "removed %v\n", ev.Path)
+	default:
+		fmt.Fprintf(stdout, "updated %v\n", ev.Path)
+	}
+}
+
+// parseInterspersed is parse for a command accepting the flags after its arguments as well, it returns the arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string, nargs int) ([]string, bool, int) {
+	var positional []string
+	for {
+		err := fs.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, false, exitOK
+		}
+		if err != nil {
+			return nil, false, exitUsage
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != nargs {
+		fmt.Fprintf(fs.Output(), "%v: expected %v arguments, got %v\n", fs.Name(), nargs, len(positional))
+		fs.Usage()
+		return nil, false, exitUsage
+	}
+
+	return positional, true, exitOK
+}
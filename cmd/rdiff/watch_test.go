@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRun_WatchUsage(t *testing.T) {
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"watch"},
+		{"watch", dir},
+		{"watch", dir, dir, "-sig-dir", dir},
+		{"watch", "-unknown", dir},
+	} {
+		if got := run(args, io.Discard, io.Discard); got != exitUsage {
+			t.Errorf("run(%q) = %v, want %v", args, got, exitUsage)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	sigDir := filepath.Join(t.TempDir(), "signatures")
+	if err := os.WriteFile(filepath.Join(dir, "file"), []byte("some content"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var stdout syncBuffer
+	done := make(chan int)
+	go func() {
+		// the flags are accepted after the directory
+		done <- watch(ctx, []string{dir, "-sig-dir", sigDir, "-block-size", "4"}, &stdout, io.Discard)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for stdout.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if got := <-done; got != exitOK {
+		t.Errorf("watch() = %v, want %v", got, exitOK)
+	}
+	if got, want := stdout.String(), "updated file\n"; got != want {
+		t.Errorf("watch() stdout = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(sigDir, "file")); err != nil {
+		t.Errorf("watch(): %v", err)
+	}
+}
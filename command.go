@@ -0,0 +1,140 @@
+package rdiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CommandType identifies the kind of a Command.
+type CommandType byte
+
+const (
+	// CommandCopy copies Length bytes of the target, starting at Offset.
+	CommandCopy CommandType = iota
+	// CommandLiteral writes Data, which is not found in the target.
+	CommandLiteral
+	// CommandZero writes a run of Length zero bytes, it's only converted from the OpBlockZero of a sparse delta.
+	CommandZero
+)
+
+// String returns the name of the command type.
+func (t CommandType) String() string {
+	switch t {
+	case CommandCopy:
+		return "copy"
+	case CommandLiteral:
+		return "literal"
+	case CommandZero:
+		return "zero"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// Command is an instruction of the offset based delta representation, like the librsync delta commands: the source
+// is rebuilt by running the commands in order, every one of them appending its bytes to the output.
+// Unlike the operations, the commands don't refer to the target blocks, so a copy can be of any target range, in any
+// order, ex: a moved or a duplicated range.
+type Command struct {
+	Type CommandType
+	// Offset is the target offset of a CommandCopy
+	Offset int64 `json:",omitempty"`
+	// Length is the number of bytes of a CommandCopy, or of a CommandZero
+	Length int64 `json:",omitempty"`
+	// Data is the literal data of a CommandLiteral
+	Data []byte `json:",omitempty"`
+}
+
+// DeltaCommands converts the operations of a delta, computed against a target of targetSize bytes, split in blocks
+// of blockSize bytes, to commands: the literal data of an operation is a literal, and its target block, if it's
+// kept, updated or copied, is a copy, the adjacent copies being merged. The literal data is not copied, so the commands
+// share it with the operations.
+// It returns a non-nil error matching ErrCorrupt if an operation is not valid for the target, including the second pass
+// parts, which are located by the delta header, see WithSecondPass.
+func DeltaCommands(ops []Operation, blockSize int, targetSize int64) ([]Command, error) {
+	var cmds []Command
+	for _, op := range ops {
+		if op.Type > OpBlockCopy {
+			return nil, markError(ErrCorrupt, fmt.Errorf("invalid operation type: %v", op.Type))
+		}
+		if op.Type == OpBlockZero {
+			cmds = append(cmds, Command{Type: CommandZero, Length: op.Zeros})
+			continue
+		}
+		if len(op.Data) > 0 {
+			cmds = append(cmds, Command{Type: CommandLiteral, Data: op.Data})
+		}
+		if !op.Type.copiesBlock() {
+			continue
+		}
+		off, ok := blockOffset(op.BlockIndex, blockSize, targetSize)
+		if !ok {
+			return nil, markError(ErrCorrupt, fmt.Errorf("invalid block index: %v, the target has %v bytes", op.BlockIndex, targetSize))
+		}
+		cmds = appendCopy(cmds, off, min(int64(blockSize), targetSize-off))
+	}
+
+	return cmds, nil
+}
+
+// appendCopy appends the copy of length target bytes at off to cmds, merging it with the last command, if it's
+// the copy of the preceding range.
+func appendCopy(cmds []Command, off, length int64) []Command {
+	if n := len(cmds); n > 0 && cmds[n-1].Type == CommandCopy && cmds[n-1].Offset+cmds[n-1].Length == off {
+		cmds[n-1].Length += length
+		return cmds
+	}
+
+	return append(cmds, Command{Type: CommandCopy, Offset: off, Length: length})
+}
+
+// ApplyCommands rebuilds the source from the target, which has the given size, and the commands, as returned by
+// DeltaCommands, and writes it to output. The target is read by offset, while the output is written in a single
+// pass, in order.
+// It returns a non-nil error matching ErrCorrupt if a command is not valid for the target.
+func ApplyCommands(target io.ReaderAt, targetSize int64, cmds []Command, output io.Writer) error {
+	for i, cmd := range cmds {
+		err := applyCommand(target, targetSize, cmd, output)
+		if err != nil {
+			return fmt.Errorf("the command %v: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// applyCommand writes the bytes of cmd to output.
+func applyCommand(target io.ReaderAt, targetSize int64, cmd Command, output io.Writer) error {
+	switch cmd.Type {
+	case CommandCopy:
+		return applyCopy(target, targetSize, cmd, output)
+	case CommandLiteral:
+		_, err := output.Write(cmd.Data)
+		return err
+	case CommandZero:
+		if cmd.Length < 0 {
+			return markError(ErrCorrupt, errors.New("a negative zero run"))
+		}
+		return writeZeros(output, cmd.Length)
+	default:
+		return markError(ErrCorrupt, fmt.Errorf("invalid command type: %v", cmd.Type))
+	}
+}
+
+// applyCopy writes the target range of a CommandCopy to output.
+func applyCopy(target io.ReaderAt, targetSize int64, cmd Command, output io.Writer) error {
+	if cmd.Offset < 0 || cmd.Length < 0 || cmd.Offset > targetSize || cmd.Length > targetSize-cmd.Offset {
+		err := fmt.Errorf("the copy of %v bytes at %v is out of the target size(%v)", cmd.Length, cmd.Offset, targetSize)
+		return markError(ErrCorrupt, err)
+	}
+	n, err := io.Copy(output, io.NewSectionReader(target, cmd.Offset, cmd.Length))
+	if err == nil && n < cmd.Length {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return fmt.Errorf("copying the target bytes at %v: %w", cmd.Offset, err)
+	}
+
+	return nil
+}
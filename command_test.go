@@ -0,0 +1,114 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDeltaCommands(t *testing.T) {
+	// the target blocks are 123, 456, 123 and 78
+	target := []byte{1, 2, 3, 4, 5, 6, 1, 2, 3, 7, 8}
+	tests := []struct {
+		name    string
+		ops     []Operation
+		want    []Command
+		wantErr bool
+	}{
+		{
+			name: "merged copies",
+			ops: []Operation{
+				{Type: OpBlockUpdate, BlockIndex: 0, Data: []byte{11, 5, 22}},
+				{Type: OpBlockKeep, BlockIndex: 1},
+				{Type: OpBlockKeep, BlockIndex: 2},
+				{Type: OpBlockRemove, BlockIndex: 3},
+				{Type: OpBlockNew, BlockIndex: -1, Data: []byte{9, 10}},
+			},
+			want: []Command{
+				{Type: CommandLiteral, Data: []byte{11, 5, 22}},
+				{Type: CommandCopy, Offset: 0, Length: 9},
+				{Type: CommandLiteral, Data: []byte{9, 10}},
+			},
+		},
+		{
+			name: "removed block in between, short last block, and zero run",
+			ops: []Operation{
+				{Type: OpBlockKeep, BlockIndex: 0},
+				{Type: OpBlockRemove, BlockIndex: 1},
+				{Type: OpBlockZero, BlockIndex: -1, Zeros: 5},
+				{Type: OpBlockKeep, BlockIndex: 2},
+				{Type: OpBlockUpdate, BlockIndex: 3, Data: []byte{0}},
+			},
+			want: []Command{
+				{Type: CommandCopy, Offset: 0, Length: 3},
+				{Type: CommandZero, Length: 5},
+				{Type: CommandCopy, Offset: 6, Length: 3},
+				{Type: CommandLiteral, Data: []byte{0}},
+				{Type: CommandCopy, Offset: 9, Length: 2},
+			},
+		},
+		{name: "block index out of the target", ops: []Operation{{Type: OpBlockKeep, BlockIndex: 4}}, wantErr: true},
+		{name: "invalid operation type", ops: []Operation{{Type: OpBlockCopy + 1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DeltaCommands(tt.ops, 3, int64(len(target)))
+			if tt.wantErr != (err != nil) || (err != nil && !errors.Is(err, ErrCorrupt)) {
+				t.Fatalf("DeltaCommands() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("DeltaCommands() = %v, want %v\nDIFF: %v", got, tt.want, diff)
+			}
+		})
+	}
+}
+
+func TestApplyCommands(t *testing.T) {
+	for _, tt := range rDiffE2ETests {
+		if tt.in.blockSize <= 0 {
+			continue
+		}
+		cmds, err := DeltaCommands(tt.out, tt.in.blockSize, int64(len(tt.in.target)))
+		if err != nil {
+			t.Fatalf("DeltaCommands() error = %v", err)
+		}
+		var got bytes.Buffer
+		if err := ApplyCommands(bytes.NewReader(tt.in.target), int64(len(tt.in.target)), cmds, &got); err != nil {
+			t.Fatalf("ApplyCommands() error = %v", err)
+		}
+		if !bytes.Equal(got.Bytes(), tt.in.source) {
+			t.Errorf("ApplyCommands() = %v, want %v", got.Bytes(), tt.in.source)
+		}
+	}
+
+	// the copies can move, and duplicate, the target ranges
+	target := []byte("0123456789")
+	cmds := []Command{
+		{Type: CommandCopy, Offset: 5, Length: 5},
+		{Type: CommandLiteral, Data: []byte("-")},
+		{Type: CommandCopy, Offset: 0, Length: 5},
+		{Type: CommandZero, Length: 2},
+		{Type: CommandCopy, Offset: 0, Length: 5},
+	}
+	var got bytes.Buffer
+	if err := ApplyCommands(bytes.NewReader(target), int64(len(target)), cmds, &got); err != nil {
+		t.Fatalf("ApplyCommands() error = %v", err)
+	}
+	if want := "56789-01234\x00\x0001234"; got.String() != want {
+		t.Errorf("ApplyCommands() = %q, want %q", got.String(), want)
+	}
+
+	for _, cmd := range []Command{
+		{Type: CommandCopy, Offset: 8, Length: 3},
+		{Type: CommandCopy, Offset: -1, Length: 1},
+		{Type: CommandCopy, Offset: 1, Length: -1},
+		{Type: CommandZero, Length: -1},
+		{Type: CommandZero + 1},
+	} {
+		if err := ApplyCommands(bytes.NewReader(target), int64(len(target)), []Command{cmd}, &got); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("ApplyCommands(%+v) error = %v, want %v", cmd, err, ErrCorrupt)
+		}
+	}
+}
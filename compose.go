@@ -0,0 +1,90 @@
+package rdiff
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ComposeCommands squashes the commands of a chain of deltas, as returned by DeltaCommands, in a single delta:
+// the commands of chain[0] apply to the target, and the commands of every following delta apply to the output of
+// the previous one, while the returned commands rebuild the output of the last delta from the target, so a long
+// chain of versions is restored by a single pass over the first one. The copies of the intermediate outputs are
+// resolved to the ranges of the target, the literals and the zero runs they cover, the literal data being shared
+// with the chain.
+// It returns a non-nil error matching ErrCorrupt if a delta copies a range beyond the output of the previous one.
+func ComposeCommands(chain ...[]Command) ([]Command, error) {
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	cmds := chain[0]
+	for i, next := range chain[1:] {
+		var err error
+		cmds, err = composeCommands(cmds, next)
+		if err != nil {
+			return nil, fmt.Errorf("the delta %v: %w", i+1, err)
+		}
+	}
+
+	return cmds, nil
+}
+
+// composeCommands returns the commands rebuilding the output of second from the target of first, second applying
+// to the output of first.
+func composeCommands(first, second []Command) ([]Command, error) {
+	// ends holds the output offset following every command of first
+	ends := make([]int64, len(first))
+	var size int64
+	for i, cmd := range first {
+		if cmd.Type > CommandZero || commandLength(cmd) < 0 {
+			return nil, markError(ErrCorrupt, fmt.Errorf("invalid command %v of the previous delta", i))
+		}
+		size += commandLength(cmd)
+		ends[i] = size
+	}
+	var out []Command
+	for i, cmd := range second {
+		if cmd.Type != CommandCopy {
+			out = append(out, cmd)
+			continue
+		}
+		if cmd.Offset < 0 || cmd.Length < 0 || cmd.Offset > size || cmd.Length > size-cmd.Offset {
+			err := fmt.Errorf("the command %v copies %v bytes at %v, out of the previous output size(%v)", i, cmd.Length, cmd.Offset, size)
+			return nil, markError(ErrCorrupt, err)
+		}
+		out = appendRange(out, first, ends, cmd.Offset, cmd.Length)
+	}
+
+	return out, nil
+}
+
+// appendRange appends the commands of first writing length bytes of its output at off, ends holding the output
+// offset following every command, to out.
+func appendRange(out, first []Command, ends []int64, off, length int64) []Command {
+	pos, end := off, off+length
+	// the first command ending after off
+	for j := sort.Search(len(ends), func(j int) bool { return ends[j] > off }); pos < end; j++ {
+		cmd := first[j]
+		skip := pos - (ends[j] - commandLength(cmd))
+		n := min(end, ends[j]) - pos
+		switch cmd.Type {
+		case CommandCopy:
+			out = appendCopy(out, cmd.Offset+skip, n)
+		case CommandLiteral:
+			out = append(out, Command{Type: CommandLiteral, Data: cmd.Data[skip : skip+n]})
+		default:
+			out = append(out, Command{Type: CommandZero, Length: n})
+		}
+		pos += n
+	}
+
+	return out
+}
+
+// commandLength returns the number of output bytes of the command.
+func commandLength(cmd Command) int64 {
+	if cmd.Type == CommandLiteral {
+		return int64(len(cmd.Data))
+	}
+
+	return cmd.Length
+}
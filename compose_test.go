@@ -0,0 +1,128 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestComposeCommands(t *testing.T) {
+	// the first delta outputs 0123 zz 4567 ab, the target being 01234567
+	first := []Command{
+		{Type: CommandCopy, Offset: 0, Length: 4},
+		{Type: CommandZero, Length: 2},
+		{Type: CommandCopy, Offset: 4, Length: 4},
+		{Type: CommandLiteral, Data: []byte("ab")},
+	}
+	tests := []struct {
+		name    string
+		second  []Command
+		want    []Command
+		wantErr bool
+	}{
+		{
+			name:   "identity",
+			second: []Command{{Type: CommandCopy, Offset: 0, Length: 12}},
+			want:   first,
+		},
+		{
+			name: "ranges spanning several commands",
+			second: []Command{
+				{Type: CommandCopy, Offset: 2, Length: 6},
+				{Type: CommandLiteral, Data: []byte("x")},
+				{Type: CommandCopy, Offset: 9, Length: 2},
+			},
+			want: []Command{
+				{Type: CommandCopy, Offset: 2, Length: 2},
+				{Type: CommandZero, Length: 2},
+				{Type: CommandCopy, Offset: 4, Length: 2},
+				{Type: CommandLiteral, Data: []byte("x")},
+				{Type: CommandCopy, Offset: 7, Length: 1},
+				{Type: CommandLiteral, Data: []byte("a")},
+			},
+		},
+		{
+			name:   "adjacent target ranges merged",
+			second: []Command{{Type: CommandCopy, Offset: 0, Length: 2}, {Type: CommandCopy, Offset: 2, Length: 2}},
+			want:   []Command{{Type: CommandCopy, Offset: 0, Length: 4}},
+		},
+		{
+			name:    "copy beyond the previous output",
+			second:  []Command{{Type: CommandCopy, Offset: 10, Length: 3}},
+			wantErr: true,
+		},
+		{
+			name:    "negative copy",
+			second:  []Command{{Type: CommandCopy, Offset: -1, Length: 1}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ComposeCommands(first, tt.second)
+			if tt.wantErr {
+				if !errors.Is(err, ErrCorrupt) {
+					t.Errorf("ComposeCommands() error = %v, want %v", err, ErrCorrupt)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("ComposeCommands() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestComposeCommands_Chain(t *testing.T) {
+	const blockSize = 32
+	rnd := rand.New(rand.NewSource(1))
+	versions := [][]byte{make([]byte, 40*blockSize+3)}
+	rnd.Read(versions[0])
+	for i := 1; i < 5; i++ {
+		// every version moves a range, alters a byte, and inserts some
+		prev := versions[i-1]
+		v := append(bytes.Clone(prev[len(prev)/2:]), prev[:len(prev)/2]...)
+		v[rnd.Intn(len(v))] ^= 0xFF
+		at := rnd.Intn(len(v))
+		v = append(v[:at], append([]byte("inserted"), v[at:]...)...)
+		versions = append(versions, v)
+	}
+	var chain [][]Command
+	for i := 1; i < len(versions); i++ {
+		target, source := versions[i-1], versions[i]
+		var signature, delta bytes.Buffer
+		if err := New(blockSize).SignatureAt(bytes.NewReader(target), int64(len(target)), &signature); err != nil {
+			t.Fatal(err)
+		}
+		if err := New(blockSize).DeltaStream(&signature, bytes.NewReader(source), int64(len(source)), &delta); err != nil {
+			t.Fatal(err)
+		}
+		_, ops, err := ReadDelta(&delta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmds, err := DeltaCommands(ops, blockSize, int64(len(target)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, cmds)
+	}
+
+	cmds, err := ComposeCommands(chain...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := ApplyCommands(bytes.NewReader(versions[0]), int64(len(versions[0])), cmds, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), versions[len(versions)-1]) {
+		t.Error("the composed commands don't rebuild the last version from the first one")
+	}
+}
@@ -0,0 +1,205 @@
+package rdiff
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// DedupFile is the deduplication summary of a file of a DedupReport.
+type DedupFile struct {
+	Name string
+	// Blocks is the number of blocks of the file, and Bytes their size
+	Blocks int
+	Bytes  int64
+	// SharedBlocks is the number of blocks of the file found in any other file, and SharedBytes their size
+	SharedBlocks int
+	SharedBytes  int64
+}
+
+// DedupPair is the number of blocks shared by two files of a DedupReport, A being added before B, every block being
+// counted as many times as it's found in both files, like Similarity does.
+type DedupPair struct {
+	A, B         string
+	SharedBlocks int
+	SharedBytes  int64
+}
+
+// DedupReport is the shared block statistics of a set of files, see DedupAnalyzer.
+type DedupReport struct {
+	// Files are the files, in the order they were added
+	Files []DedupFile
+	// Pairs are the pairs of files sharing any block, the ones sharing the most bytes first
+	Pairs []DedupPair
+	// Blocks is the number of blocks of all the files, and Bytes their size, while DistinctBlocks and DistinctBytes
+	// count every block content once, so they're the storage of the deduplicated files
+	Blocks         int
+	Bytes          int64
+	DistinctBlocks int
+	DistinctBytes  int64
+}
+
+// Candidates returns the pairs including the file name, the ones sharing the most bytes first, so the first one is
+// the best basis of a delta for it.
+func (r *DedupReport) Candidates(name string) []DedupPair {
+	var pairs []DedupPair
+	for _, p := range r.Pairs {
+		if p.A == name || p.B == name {
+			pairs = append(pairs, p)
+		}
+	}
+
+	return pairs
+}
+
+// dedupEntry is the number of blocks of a file having the same content.
+type dedupEntry struct {
+	file  int
+	count int
+}
+
+// dedupBlock is the content of a block found in any of the files: its size, and its files, in the order they were
+// added.
+type dedupBlock struct {
+	length  int64
+	entries []dedupEntry
+}
+
+// DedupAnalyzer collects the blocks of the signatures of many files, as returned by ReadSignature, and reports the
+// blocks they share, see DedupAnalyzer.Report, so the storage of the deduplicated files is planned, and the best
+// delta basis of every file is picked, without computing any delta.
+// The signatures must be computed with the same hashes, and block size. The block sizes are the lengths of the
+// blocks, if they're recorded, or the block size of the signature otherwise, the short last block being counted
+// as a full one.
+type DedupAnalyzer struct {
+	header SignatureHeader
+	files  []DedupFile
+	blocks map[blockKey]*dedupBlock
+}
+
+// NewDedupAnalyzer constructs a DedupAnalyzer without any file, and returns a pointer to it.
+func NewDedupAnalyzer() *DedupAnalyzer {
+	return &DedupAnalyzer{blocks: make(map[blockKey]*dedupBlock)}
+}
+
+// Add adds the blocks of the file name, whose signature has the header, to the analysis.
+// It returns a non-nil error if the signature can't be compared with the ones already added, see App.Similarity, or
+// if its block sizes are unknown.
+func (d *DedupAnalyzer) Add(name string, header SignatureHeader, blocks []Block) error {
+	if len(d.files) > 0 {
+		err := checkComparable(d.header, header)
+		if err != nil {
+			return fmt.Errorf("the signature of %v: %w", name, err)
+		}
+	} else {
+		d.header = header
+	}
+	if header.BlockSize <= 0 && len(blocks) > 0 && blocks[0].Length == 0 {
+		return fmt.Errorf("the signature of %v doesn't record its block size", name)
+	}
+	file := DedupFile{Name: name, Blocks: len(blocks)}
+	id := len(d.files)
+	for _, bl := range blocks {
+		length := int64(bl.Length)
+		if length == 0 {
+			length = int64(header.BlockSize)
+		}
+		file.Bytes += length
+		d.addBlock(blockKey{weak: bl.WeakHash, strong: string(bl.StrongHash)}, id, length)
+	}
+	d.files = append(d.files, file)
+
+	return nil
+}
+
+// addBlock counts a block of the file id, whose content has the key.
+func (d *DedupAnalyzer) addBlock(key blockKey, id int, length int64) {
+	b, ok := d.blocks[key]
+	if !ok {
+		b = &dedupBlock{length: length}
+		d.blocks[key] = b
+	}
+	// the blocks of a file are added together, so its entry is the last one, if any
+	if n := len(b.entries); n > 0 && b.entries[n-1].file == id {
+		b.entries[n-1].count++
+		return
+	}
+	b.entries = append(b.entries, dedupEntry{file: id, count: 1})
+}
+
+// Report returns the shared block statistics of the files added. The pairs are counted for every block content,
+// so a block found in n files costs n*(n-1)/2 updates, ex: the zeroed blocks of sparse files.
+func (d *DedupAnalyzer) Report() DedupReport {
+	r := DedupReport{Files: append([]DedupFile(nil), d.files...), DistinctBlocks: len(d.blocks)}
+	pairs := make(map[[2]int]*DedupPair)
+	for _, b := range d.blocks {
+		r.DistinctBytes += b.length
+		if len(b.entries) < 2 {
+			continue
+		}
+		for i, e := range b.entries {
+			r.Files[e.file].SharedBlocks += e.count
+			r.Files[e.file].SharedBytes += int64(e.count) * b.length
+			for _, other := range b.entries[i+1:] {
+				d.countPair(pairs, e, other, b.length)
+			}
+		}
+	}
+	for _, f := range r.Files {
+		r.Blocks += f.Blocks
+		r.Bytes += f.Bytes
+	}
+	for _, p := range pairs {
+		r.Pairs = append(r.Pairs, *p)
+	}
+	sort.Slice(r.Pairs, func(i, j int) bool {
+		if r.Pairs[i].SharedBytes != r.Pairs[j].SharedBytes {
+			return r.Pairs[i].SharedBytes > r.Pairs[j].SharedBytes
+		}
+		if r.Pairs[i].A != r.Pairs[j].A {
+			return r.Pairs[i].A < r.Pairs[j].A
+		}
+		return r.Pairs[i].B < r.Pairs[j].B
+	})
+
+	return r
+}
+
+// countPair adds the blocks of a content shared by the files of the entries a and b, a being added first, to their
+// pair.
+func (d *DedupAnalyzer) countPair(pairs map[[2]int]*DedupPair, a, b dedupEntry, length int64) {
+	key := [2]int{a.file, b.file}
+	p, ok := pairs[key]
+	if !ok {
+		p = &DedupPair{A: d.files[a.file].Name, B: d.files[b.file].Name}
+		pairs[key] = p
+	}
+	shared := min(a.count, b.count)
+	p.SharedBlocks += shared
+	p.SharedBytes += int64(shared) * length
+}
+
+// DedupReport returns the shared block statistics of the files whose signature files, as written by Signature, in
+// the configured format, are signaturePaths, the files being named by their signature paths, see DedupAnalyzer.
+// The block size configured for the App is used by the signatures which don't record theirs.
+func (a *App) DedupReport(signaturePaths ...string) (DedupReport, error) {
+	if len(signaturePaths) == 0 {
+		return DedupReport{}, errors.New("no signature to analyze")
+	}
+	d := NewDedupAnalyzer()
+	for _, p := range signaturePaths {
+		header, sig, err := a.loadSignature(p)
+		if err != nil {
+			return DedupReport{}, err
+		}
+		if header.BlockSize <= 0 {
+			header.BlockSize = a.diffEngine.blockSize
+		}
+		err = d.Add(p, header, sig.blocks(header))
+		if err != nil {
+			return DedupReport{}, err
+		}
+	}
+
+	return d.Report(), nil
+}
@@ -0,0 +1,106 @@
+package rdiff
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupAnalyzer(t *testing.T) {
+	block := func(weak uint64, length int) Block {
+		return Block{WeakHash: weak, StrongHash: []byte{byte(weak)}, Length: length}
+	}
+	header := SignatureHeader{BlockSize: 4}
+	d := NewDedupAnalyzer()
+	for _, f := range []struct {
+		name   string
+		blocks []Block
+	}{
+		{name: "a", blocks: []Block{block(1, 4), block(2, 4), block(2, 4), block(3, 2)}},
+		{name: "b", blocks: []Block{block(2, 4), block(3, 2), block(4, 4)}},
+		{name: "c", blocks: []Block{block(1, 4), block(2, 4), block(2, 4)}},
+		{name: "d", blocks: []Block{block(5, 4)}},
+	} {
+		if err := d.Add(f.name, header, f.blocks); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := d.Report()
+
+	wantFiles := []DedupFile{
+		{Name: "a", Blocks: 4, Bytes: 14, SharedBlocks: 4, SharedBytes: 14},
+		{Name: "b", Blocks: 3, Bytes: 10, SharedBlocks: 2, SharedBytes: 6},
+		{Name: "c", Blocks: 3, Bytes: 12, SharedBlocks: 3, SharedBytes: 12},
+		{Name: "d", Blocks: 1, Bytes: 4},
+	}
+	if fmt.Sprint(r.Files) != fmt.Sprint(wantFiles) {
+		t.Errorf("Files = %+v, want %+v", r.Files, wantFiles)
+	}
+	wantPairs := []DedupPair{
+		{A: "a", B: "c", SharedBlocks: 3, SharedBytes: 12},
+		{A: "a", B: "b", SharedBlocks: 2, SharedBytes: 6},
+		{A: "b", B: "c", SharedBlocks: 1, SharedBytes: 4},
+	}
+	if fmt.Sprint(r.Pairs) != fmt.Sprint(wantPairs) {
+		t.Errorf("Pairs = %+v, want %+v", r.Pairs, wantPairs)
+	}
+	if r.Blocks != 11 || r.Bytes != 40 || r.DistinctBlocks != 5 || r.DistinctBytes != 18 {
+		t.Errorf("totals = %v blocks, %v bytes, %v distinct blocks, %v distinct bytes, want 11, 40, 5, 18",
+			r.Blocks, r.Bytes, r.DistinctBlocks, r.DistinctBytes)
+	}
+	if got := r.Candidates("b"); fmt.Sprint(got) != fmt.Sprint(wantPairs[1:]) {
+		t.Errorf("Candidates(b) = %+v, want %+v", got, wantPairs[1:])
+	}
+	if got := r.Candidates("d"); len(got) != 0 {
+		t.Errorf("Candidates(d) = %+v, want none", got)
+	}
+
+	if err := d.Add("e", SignatureHeader{BlockSize: 4, StrongHashSize: 8}, nil); err == nil {
+		t.Error("Add() of a signature with other hashes error = nil, want non-nil")
+	}
+	if err := NewDedupAnalyzer().Add("f", SignatureHeader{}, []Block{{WeakHash: 1}}); err == nil {
+		t.Error("Add() of a signature without block sizes error = nil, want non-nil")
+	}
+}
+
+func TestApp_DedupReport(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	shared := bytes.Repeat([]byte("0123456789abcdef"), 8)
+	files := map[string][]byte{
+		"a": append(append([]byte{}, shared...), randomBytes(1, 64)...),
+		"b": append(randomBytes(2, 64), shared...),
+		"c": randomBytes(3, 100),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(path(name), content, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := New(16).Signature(path(name), path(name+".sig")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := New(32).Signature(path("c"), path("c.sig32")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(16).DedupReport(path("a.sig"), path("b.sig"), path("c.sig"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DedupPair{{A: path("a.sig"), B: path("b.sig"), SharedBlocks: 8, SharedBytes: 128}}
+	if fmt.Sprint(r.Pairs) != fmt.Sprint(want) {
+		t.Errorf("Pairs = %+v, want %+v", r.Pairs, want)
+	}
+	if r.Bytes != 100+2*192 || r.Files[2].Blocks != 7 {
+		t.Errorf("Bytes = %v, the blocks of c = %v, want %v, 7", r.Bytes, r.Files[2].Blocks, 100+2*192)
+	}
+	if _, err := New(16).DedupReport(path("a.sig"), path("c.sig32")); err == nil {
+		t.Error("DedupReport() of signatures with different block sizes error = nil, want non-nil")
+	}
+	if _, err := New(16).DedupReport(); err == nil {
+		t.Error("DedupReport() without signatures error = nil, want non-nil")
+	}
+}
@@ -0,0 +1,98 @@
+package rdiff
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// writeDelta writes the header, then computes the delta using compute, and serializes its operations as they are
+// emitted, every operation being an encoded value, so the delta is never entirely in memory.
+func writeDelta(w io.Writer, newEncoder func(io.Writer) valueEncoder, header DeltaHeader, compute func(emit func(Operation) error) error) error {
+	bw := bufio.NewWriter(w)
+	enc := newEncoder(bw)
+	err := enc.Encode(header)
+	if err != nil {
+		return err
+	}
+	err = compute(func(op Operation) error {
+		return enc.Encode(op)
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// ReadDelta reads a delta, as written by App.Delta, and returns its header and operations.
+// It returns a non-nil error if the content is not a valid delta, or if it exceeds the default DecodeLimits.
+func ReadDelta(r io.Reader) (DeltaHeader, []Operation, error) {
+	d, err := newDeltaDecoder(r, DecodeLimits{})
+	if err != nil {
+		return DeltaHeader{}, nil, err
+	}
+	var delta []Operation
+	err = d.forEach(func(op Operation) error {
+		delta = append(delta, op)
+		return nil
+	})
+	if err != nil {
+		return DeltaHeader{}, nil, err
+	}
+
+	return d.header, delta, nil
+}
+
+// deltaDecoder reads a delta written by writeDelta: the header first, then the operations, one at a time, within
+// the limits.
+type deltaDecoder struct {
+	header DeltaHeader
+	dec    *gob.Decoder
+	limits DecodeLimits
+}
+
+// newDeltaDecoder reads the delta header and returns a decoder for the operations following it, within the limits.
+func newDeltaDecoder(r io.Reader, limits DecodeLimits) (*deltaDecoder, error) {
+	d := &deltaDecoder{dec: gob.NewDecoder(limits.deltaReader(r)), limits: limits}
+	err := d.dec.Decode(&d.header)
+	if err != nil {
+		return nil, markError(ErrCorrupt, fmt.Errorf("reading the delta header: %w", err))
+	}
+	if d.header.SourceSize < 0 {
+		return nil, markError(ErrCorrupt, fmt.Errorf("invalid delta source size: %v", d.header.SourceSize))
+	}
+	if d.header.SecondPassBlockSize < 0 || d.header.SecondPassBlockSize > MaxBlockSize {
+		return nil, markError(ErrCorrupt, fmt.Errorf("invalid delta second pass block size: %v", d.header.SecondPassBlockSize))
+	}
+	if gz := d.header.SourceGzip; gz != nil && (gz.Level < gzip.HuffmanOnly || gz.Level > gzip.BestCompression) {
+		return nil, markError(ErrCorrupt, fmt.Errorf("invalid delta source compression level: %v", gz.Level))
+	}
+
+	return d, nil
+}
+
+// forEach reads the operations and passes them to fn, stopping at the first non-nil error returned by fn.
+func (d *deltaDecoder) forEach(fn func(Operation) error) error {
+	for n := int64(1); ; n++ {
+		var op Operation
+		err := d.dec.Decode(&op)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return markError(ErrCorrupt, err)
+		}
+		err = d.limits.checkOperation(n, op)
+		if err != nil {
+			return err
+		}
+		err = fn(op)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// rebuild rebuilds the source from the target and the delta: for every operation, its data followed by the target
+// block, if it's kept, updated or copied.
+func rebuild(target []byte, blockSize int, delta []Operation) []byte {
+	var source []byte
+	for _, op := range delta {
+		source = append(source, op.Data...)
+		if op.Type.copiesBlock() {
+			start := int(op.BlockIndex) * blockSize
+			source = append(source, target[start:min(start+blockSize, len(target))]...)
+		}
+	}
+
+	return source
+}
+
+// deltaBytes serializes the header and the operations, as written by App.Delta.
+func deltaBytes(t testing.TB, header DeltaHeader, delta []Operation) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	err := writeDelta(&buf, gobEncoder, header, func(emit func(Operation) error) error {
+		for _, op := range delta {
+			if err := emit(op); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestReadDelta(t *testing.T) {
+	for _, tt := range rDiffE2ETests {
+		header := DeltaHeader{SourceSize: int64(len(tt.in.source))}
+		gotHeader, got, err := ReadDelta(bytes.NewReader(deltaBytes(t, header, tt.out)))
+		if err != nil {
+			t.Fatalf("ReadDelta() error = %v", err)
+		}
+		if gotHeader != header {
+			t.Errorf("ReadDelta() header = %v, want %v", gotHeader, header)
+		}
+		if diff := cmp.Diff(got, tt.out, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("ReadDelta() got = %v, want %v, \nDIFF: %v", got, tt.out, diff)
+		}
+	}
+	if _, _, err := ReadDelta(bytes.NewReader([]byte("not a delta"))); err == nil {
+		t.Errorf("ReadDelta() error = nil, want an error for invalid content")
+	}
+}
+
+func TestRDiff_ComputeDelta_MaxMemory(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	target := make([]byte, 10000)
+	rnd.Read(target)
+	source := make([]byte, 3000)
+	rnd.Read(source)
+	source = append(source, target[:5000]...)
+	source = append(source, make([]byte, 2500)...)
+	source = append(source, target[5000:]...)
+	for _, tt := range []struct {
+		maxMemory   int
+		concurrency int
+	}{
+		{maxMemory: 0},
+		{maxMemory: 1},
+		{maxMemory: 1000},
+		{maxMemory: 1000, concurrency: 2},
+	} {
+		r := newTestRDiff(100, rDiffE2EConfig{})
+		r.maxMemory, r.concurrency = tt.maxMemory, tt.concurrency
+		sig, err := r.ComputeSignature(bytes.NewReader(target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		delta, err := r.ComputeDelta(bytes.NewReader(source), r.signatureHeader(), sig)
+		if err != nil {
+			t.Fatalf("ComputeDelta(%+v) error = %v", tt, err)
+		}
+		if got := rebuild(target, 100, delta); !bytes.Equal(got, source) {
+			t.Errorf("ComputeDelta(%+v) doesn't rebuild the source", tt)
+		}
+		for _, op := range delta {
+			if tt.maxMemory > 0 && op.Type == OpBlockNew && len(op.Data) > tt.maxMemory && tt.concurrency <= 1 {
+				t.Errorf("ComputeDelta(%+v) literal size = %v, want <= %v", tt, len(op.Data), tt.maxMemory)
+			}
+		}
+	}
+}
+
+func TestRDiff_ComputeDelta_BlockReuse(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const blockSize = 1000
+	// the target spans 2 segments, and it has no short block
+	target := make([]byte, (parallelSegmentSize/blockSize+10)*blockSize)
+	rnd.Read(target)
+	// the source repeats the first blocks, after the last one, and moves a block backwards
+	source := append(bytes.Clone(target), target[:5*blockSize]...)
+	source = append(source, target[3*blockSize:4*blockSize]...)
+	for _, tt := range []struct {
+		name        string
+		blockReuse  bool
+		concurrency int
+		wantReused  int64
+	}{
+		{name: "no reuse"},
+		{name: "reuse", blockReuse: true, wantReused: 6},
+		{name: "parallel reuse", blockReuse: true, concurrency: 3, wantReused: 6},
+	} {
+		r := newTestRDiff(blockSize, rDiffE2EConfig{weakHash: WeakHashAdler32})
+		r.blockReuse, r.concurrency = tt.blockReuse, tt.concurrency
+		sig, err := r.ComputeSignature(bytes.NewReader(target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		delta, err := r.ComputeDelta(bytes.NewReader(source), r.signatureHeader(), sig)
+		if err != nil {
+			t.Fatalf("%v: ComputeDelta() error = %v", tt.name, err)
+		}
+		if got := rebuild(target, blockSize, delta); !bytes.Equal(got, source) {
+			t.Errorf("%v: ComputeDelta() doesn't rebuild the source", tt.name)
+		}
+		header := r.signatureHeader()
+		header.TargetSize = int64(len(target))
+		if err := ValidateDelta(delta, header); err != nil {
+			t.Errorf("%v: ValidateDelta() error = %v", tt.name, err)
+		}
+		stats := r.stats
+		if stats.ReusedBlocks != tt.wantReused {
+			t.Errorf("%v: ReusedBlocks = %v, want %v", tt.name, stats.ReusedBlocks, tt.wantReused)
+		}
+		if wantLiteral := int64(6*blockSize) - tt.wantReused*blockSize; stats.LiteralBytes != wantLiteral {
+			t.Errorf("%v: LiteralBytes = %v, want %v", tt.name, stats.LiteralBytes, wantLiteral)
+		}
+	}
+}
+
+// FuzzReadDelta checks a malformed delta is reported as corrupt, without panicking.
+func FuzzReadDelta(f *testing.F) {
+	for _, tt := range rDiffE2ETests {
+		f.Add(deltaBytes(f, DeltaHeader{SourceSize: int64(len(tt.in.source))}, tt.out))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, _, err := ReadDelta(bytes.NewReader(data)); err != nil && !errors.Is(err, ErrCorrupt) {
+			t.Errorf("ReadDelta() error = %v, want %v", err, ErrCorrupt)
+		}
+	})
+}
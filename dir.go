@@ -0,0 +1,436 @@
+package rdiff
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DirSignatureHeader starts a directory signature, as written by App.SignatureDir.
+// Its fields differ from the SignatureHeader and DeltaHeader ones, so the artifacts can't be mistaken for each other.
+type DirSignatureHeader struct {
+	// Files is the number of file signatures following the header
+	Files int
+}
+
+// FileSignature is the signature of a file of a directory signature.
+type FileSignature struct {
+	// Path is the path of the file, relative to the directory, using forward slashes
+	Path string
+	// BlockSize is the block size of the file's signature, it's decided per file, if it's dynamic, 0 for a link
+	BlockSize int
+	Header    SignatureHeader
+	Blocks    []Block
+	// Link is the target of a symbolic link, which has no blocks, empty for a regular file
+	Link string
+	// HardLink is the path of the first file, in lexical order, sharing the file's inode, which has the blocks
+	// of both, empty if it's the first one or the file has a single link
+	HardLink string
+}
+
+// dirSignatureEntry is serialized in front of every file signature table of a directory signature.
+type dirSignatureEntry struct {
+	Path      string
+	BlockSize int
+	Header    SignatureHeader
+	Link      string
+	HardLink  string
+}
+
+// SignatureDir computes the signatures of the regular files under the root directory(rootPath), and writes them
+// to an output file(outputPath), as a directory signature, which can be read using ReadDirSignature.
+// The files are visited in lexical order, and every file is recorded at its path relative to rootPath.
+// The files and directories excluded by the configured patterns are skipped, see WithExclude.
+// The block size is decided per file, if it's dynamic, and a file smaller than 2 blocks has a single block, while
+// an empty one has no blocks. The symbolic links are recorded as links, by default, see WithSymlinks, and the other
+// file types are skipped. The files sharing an inode are recorded as hard links to the first of them, which is the
+// only one holding the blocks.
+// The root directory must exist, and the output file must not exist, otherwise a non-nil error is returned.
+// The directory signature is gob encoded, so the other formats return a non-nil error.
+func (a *App) SignatureDir(rootPath string, outputPath string) error {
+	if a.format != FormatGob {
+		return fmt.Errorf("the %v format can't encode a directory signature", a.format)
+	}
+	err := a.checkSignatureHashers()
+	if err != nil {
+		return err
+	}
+	err = a.checkFilter()
+	if err != nil {
+		return err
+	}
+	files, total, err := listDirFiles(rootPath, outputPath, a.filter, a.symlinks)
+	if err != nil {
+		return err
+	}
+	output, err := os.OpenFile(outputPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	err = a.signatureDir(rootPath, files, total, output)
+
+	return errors.Join(err, output.Close())
+}
+
+// signatureDir serializes the header, then the entry and the signature table of every file.
+func (a *App) signatureDir(rootPath string, files []dirFile, total int64, output io.Writer) error {
+	bw := bufio.NewWriter(output)
+	enc := gob.NewEncoder(bw)
+	err := enc.Encode(DirSignatureHeader{Files: len(files)})
+	if err != nil {
+		return err
+	}
+	dp := newDirProgress(a.progress, "signature", total)
+	workers := a.dirWorkers(dp)
+	if workers == nil {
+		progress := Progress{Phase: "signature", Total: total}
+		for _, file := range files {
+			r, err := a.fileSignature(enc, rootPath, file, &progress)
+			if err != nil {
+				return err
+			}
+			err = r.write()
+			if err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	}
+
+	err = forEachFile(len(files), workers, func(w *App, i int) (dirResult, error) {
+		r, err := w.fileSignature(enc, rootPath, files[i], &Progress{Phase: "signature", Total: total})
+		dp.finish(w, files[i].size)
+		return r, err
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// fileSignatureResult is the signature of a file of the directory, to be serialized to enc.
+type fileSignatureResult struct {
+	enc   recordEncoder
+	entry dirSignatureEntry
+	table signatureTable
+}
+
+func (r *fileSignatureResult) write() error {
+	err := r.enc.Encode(r.entry)
+	if err != nil {
+		return err
+	}
+
+	return r.enc.Encode(r.table)
+}
+
+func (r *fileSignatureResult) release() {}
+
+// fileSignature computes the signature of a file of the directory, to be serialized to enc, the links have no blocks.
+func (a *App) fileSignature(enc recordEncoder, rootPath string, file dirFile, progress *Progress) (dirResult, error) {
+	r := &fileSignatureResult{enc: enc, entry: dirSignatureEntry{Path: file.path, Link: file.link, HardLink: file.hardLink}}
+	if file.link != "" || file.hardLink != "" {
+		return r, nil
+	}
+	var err error
+	r.entry, r.table, err = a.dirFileSignature(rootPath, file.path, progress)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", file.path, err)
+	}
+
+	return r, nil
+}
+
+// dirFileSignature computes the signature of a file of the directory, using its own block size, and adds its size
+// to the progress.
+func (a *App) dirFileSignature(rootPath, name string, progress *Progress) (dirSignatureEntry, signatureTable, error) {
+	f, err := openSequential(filepath.Join(rootPath, filepath.FromSlash(name)))
+	if err != nil {
+		return dirSignatureEntry{}, signatureTable{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return dirSignatureEntry{}, signatureTable{}, err
+	}
+
+	blockSize := a.diffEngine.blockSize
+	defer func() { a.diffEngine.blockSize = blockSize }()
+	if blockSize <= 0 {
+		a.diffEngine.blockSize = int(computeDynamicBlockSize(info.Size()))
+	}
+	entry := dirSignatureEntry{Path: name, BlockSize: a.diffEngine.blockSize, Header: a.diffEngine.signatureHeader()}
+	entry.Header.TargetSize = info.Size()
+
+	target, release := a.inputReader(f, info.Size())
+	if a.progress != nil {
+		target = &progressReader{r: target, progress: *progress, fn: a.progress}
+	}
+	t, err := a.diffEngine.ComputeSignature(target)
+	err = errors.Join(err, release())
+	progress.Done += info.Size()
+
+	return entry, t, err
+}
+
+// dirFile is a file of a directory, listed by listDirFiles.
+type dirFile struct {
+	// path is relative to the directory, using forward slashes
+	path string
+	size int64
+	// link is the target of a recorded symbolic link, empty for a regular file
+	link string
+	// id is the id of a file with more than one hard link, if hasID
+	id    fileID
+	hasID bool
+	// hardLink is the path of the first file sharing the file's id, empty if it's the first one
+	hardLink string
+}
+
+// fileID identifies the file of a hard link, by its device and inode numbers.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// listDirFiles returns the regular files under root, at their paths relative to it, using forward slashes, sorted
+// by path, and their total size. The skip file, if it's under root, is not listed, and neither are the files and
+// directories excluded by the filter. The symbolic links are listed as links, followed or skipped, depending on the
+// symlinks mode. The files sharing an id are listed as hard links to the first of them, and counted once in the
+// total size.
+func listDirFiles(root, skip string, filter *pathFilter, symlinks SymlinkMode) ([]dirFile, int64, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !info.IsDir() {
+		return nil, 0, fmt.Errorf("%v is not a directory", root)
+	}
+	skipAbs, err := filepath.Abs(skip)
+	if err != nil {
+		return nil, 0, err
+	}
+	l := &dirLister{skip: skipAbs, filter: filter, symlinks: symlinks}
+	err = l.walk(root, "", []fs.FileInfo{info})
+	if err != nil {
+		return nil, 0, err
+	}
+	slices.SortFunc(l.files, func(a, b dirFile) int { return strings.Compare(a.path, b.path) })
+	l.linkHardLinks()
+
+	return l.files, l.total, nil
+}
+
+// linkHardLinks links the sorted files sharing an id to the first of them.
+func (l *dirLister) linkHardLinks() {
+	first := make(map[fileID]string)
+	for i := range l.files {
+		f := &l.files[i]
+		if !f.hasID {
+			continue
+		}
+		if p, ok := first[f.id]; ok {
+			f.hardLink = p
+			l.total -= f.size
+			continue
+		}
+		first[f.id] = f.path
+	}
+}
+
+// dirLister collects the files of a directory tree, see listDirFiles.
+type dirLister struct {
+	// skip is the absolute path of the file which is not listed
+	skip     string
+	filter   *pathFilter
+	symlinks SymlinkMode
+	files    []dirFile
+	total    int64
+}
+
+// walk lists the directory at p, whose relative path is rel. The ancestors are the directories being listed, from
+// the root to p, so a followed symbolic link to any of them, which is a loop, is skipped.
+func (l *dirLister) walk(p, rel string, ancestors []fs.FileInfo) error {
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return err
+	}
+	for _, d := range entries {
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		childPath, childRel := filepath.Join(p, d.Name()), path.Join(rel, d.Name())
+		if info.Mode()&fs.ModeSymlink != 0 {
+			err = l.visitSymlink(childPath, childRel, ancestors)
+		} else {
+			err = l.visit(childPath, childRel, info, ancestors)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// visitSymlink lists the symbolic link at p as a link, or the file or directory it points to, or skips it.
+func (l *dirLister) visitSymlink(p, rel string, ancestors []fs.FileInfo) error {
+	switch l.symlinks {
+	case SymlinkRecord:
+		if l.filter.excluded(rel, false) {
+			return nil
+		}
+		link, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		l.files = append(l.files, dirFile{path: rel, link: link})
+		return nil
+	case SymlinkFollow:
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		return l.visit(p, rel, info, ancestors)
+	default:
+		return nil
+	}
+}
+
+// visit lists the regular file at p, or walks the directory at p, unless it's excluded or it's one of the ancestors.
+func (l *dirLister) visit(p, rel string, info fs.FileInfo, ancestors []fs.FileInfo) error {
+	if l.filter.excluded(rel, info.IsDir()) {
+		return nil
+	}
+	if info.IsDir() {
+		if slices.ContainsFunc(ancestors, func(a fs.FileInfo) bool { return os.SameFile(a, info) }) {
+			return nil
+		}
+		return l.walk(p, rel, append(slices.Clip(ancestors), info))
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	if abs, err := filepath.Abs(p); err != nil || abs == l.skip {
+		return err
+	}
+	id, hasID := hardLinkID(info)
+	l.files = append(l.files, dirFile{path: rel, size: info.Size(), id: id, hasID: hasID})
+	l.total += info.Size()
+
+	return nil
+}
+
+// checkFilter returns the error of the invalid include and exclude patterns, if any.
+func (a *App) checkFilter() error {
+	if a.filter == nil {
+		return nil
+	}
+
+	return a.filter.err
+}
+
+// ReadDirSignature reads a directory signature, as written by App.SignatureDir, and returns its file signatures.
+// It returns a non-nil error if the content is not a valid directory signature, or if it exceeds the default
+// DecodeLimits.
+func ReadDirSignature(r io.Reader) ([]FileSignature, error) {
+	var files []FileSignature
+	err := readDirSignature(r, DecodeLimits{}, func(entry dirSignatureEntry, t signatureTable) error {
+		files = append(files, FileSignature{
+			Path:      entry.Path,
+			BlockSize: entry.BlockSize,
+			Header:    entry.Header,
+			Blocks:    t.blocks(entry.Header),
+			Link:      entry.Link,
+			HardLink:  entry.HardLink,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// readDirSignature deserializes a directory signature, passing every file entry and signature table to fn, and
+// stops at the first non-nil error returned by fn. The signature tables are bounded by the limits.
+func readDirSignature(r io.Reader, limits DecodeLimits, fn func(dirSignatureEntry, signatureTable) error) error {
+	dec := gob.NewDecoder(limits.signatureReader(bufio.NewReader(r)))
+	var header DirSignatureHeader
+	err := dec.Decode(&header)
+	if err != nil {
+		return markError(ErrCorrupt, fmt.Errorf("reading the directory signature header: %w", err))
+	}
+	if header.Files < 0 {
+		return markError(ErrCorrupt, fmt.Errorf("invalid directory signature files count: %v", header.Files))
+	}
+	for i := 0; i < header.Files; i++ {
+		var entry dirSignatureEntry
+		err = dec.Decode(&entry)
+		if err != nil {
+			return markError(ErrCorrupt, fmt.Errorf("reading the directory signature file %v: %w", i, err))
+		}
+		err = validateDirSignatureEntry(entry)
+		if err != nil {
+			return markError(ErrCorrupt, err)
+		}
+		t, err := readSignatureTable(dec, entry.Header, limits)
+		if err != nil {
+			return fmt.Errorf("%v: %w", entry.Path, err)
+		}
+		if (entry.Link != "" || entry.HardLink != "") && t.len() != 0 {
+			return markError(ErrCorrupt, fmt.Errorf("%v: invalid directory signature link with blocks", entry.Path))
+		}
+		err = fn(entry, t)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateDirSignatureEntry checks the entry path stays inside the directory, and the block size is valid, unless
+// the entry is a link.
+func validateDirSignatureEntry(entry dirSignatureEntry) error {
+	if !validDirPath(entry.Path) {
+		return fmt.Errorf("invalid directory signature file path: %q", entry.Path)
+	}
+	if entry.HardLink != "" {
+		return validateHardLink(entry.Path, entry.HardLink, entry.Link)
+	}
+	if entry.Link != "" {
+		return nil
+	}
+	if entry.BlockSize <= 0 || entry.BlockSize > MaxBlockSize {
+		return fmt.Errorf("%v: invalid block size: %v", entry.Path, entry.BlockSize)
+	}
+
+	return nil
+}
+
+// validateHardLink checks the first file of a hard link is a valid path preceding the hard link, which is not
+// a symbolic link.
+func validateHardLink(name, hardLink, link string) error {
+	if !validDirPath(hardLink) || hardLink >= name || link != "" {
+		return fmt.Errorf("%v: invalid hard link: %q", name, hardLink)
+	}
+
+	return nil
+}
+
+// validDirPath reports whether p is a clean relative path, using forward slashes, which stays inside its directory.
+func validDirPath(p string) bool {
+	return p != "." && path.Clean(p) == p && filepath.IsLocal(filepath.FromSlash(p))
+}
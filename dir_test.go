@@ -0,0 +1,196 @@
+package rdiff
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// writeTree creates the files, by relative path, under dir.
+func writeTree(t testing.TB, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, content, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readDirSignatureFile reads the directory signature at path.
+func readDirSignatureFile(t *testing.T, path string) []FileSignature {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	files, err := ReadDirSignature(f)
+	if err != nil {
+		t.Fatalf("ReadDirSignature() error = %v", err)
+	}
+
+	return files
+}
+
+func TestApp_SignatureDir(t *testing.T) {
+	root := t.TempDir()
+	large := bytes.Repeat([]byte("0123456789"), 10)
+	writeTree(t, root, map[string][]byte{
+		"a":         large,
+		"sub/b":     []byte("small"),
+		"sub/empty": nil,
+	})
+	if err := os.Symlink("a", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	// the output, inside the root, is not part of the signature, and neither is the skipped link
+	output := filepath.Join(root, "signature")
+	if err := New(16, WithSymlinks(SymlinkSkip)).SignatureDir(root, output); err != nil {
+		t.Fatalf("SignatureDir() error = %v", err)
+	}
+
+	var want bytes.Buffer
+	if err := New(16).SignatureAt(bytes.NewReader(large), int64(len(large)), &want); err != nil {
+		t.Fatal(err)
+	}
+	wantHeader, wantBlocks, err := ReadSignature(&want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readDirSignatureFile(t, output)
+	if len(got) != 3 {
+		t.Fatalf("SignatureDir() files = %+v, want 3 files", got)
+	}
+	if diff := cmp.Diff(FileSignature{Path: "a", BlockSize: 16, Header: wantHeader, Blocks: wantBlocks}, got[0]); diff != "" {
+		t.Errorf("SignatureDir() file a \nDIFF: %v", diff)
+	}
+	for i, want := range []struct {
+		path   string
+		size   int64
+		blocks int
+	}{
+		{path: "sub/b", size: 5, blocks: 1},
+		{path: "sub/empty", size: 0, blocks: 0},
+	} {
+		f := got[i+1]
+		if f.Path != want.path || f.Header.TargetSize != want.size || len(f.Blocks) != want.blocks {
+			t.Errorf("SignatureDir() file = {%v %v bytes %v blocks}, want %+v", f.Path, f.Header.TargetSize, len(f.Blocks), want)
+		}
+	}
+}
+
+func TestApp_SignatureDir_DynamicBlockSize(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string][]byte{"large": make([]byte, 2000000), "small": make([]byte, 10)})
+	output := filepath.Join(t.TempDir(), "signature")
+	if err := New(0).SignatureDir(root, output); err != nil {
+		t.Fatalf("SignatureDir() error = %v", err)
+	}
+	got := readDirSignatureFile(t, output)
+	for i, want := range []int{int(computeDynamicBlockSize(2000000)), DefaultBlockSize} {
+		if got[i].BlockSize != want {
+			t.Errorf("SignatureDir() %v block size = %v, want %v", got[i].Path, got[i].BlockSize, want)
+		}
+	}
+}
+
+func TestApp_SignatureDir_Filter(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string][]byte{
+		"main.go":        []byte("package main"),
+		"main.o":         []byte("object"),
+		"keep.o":         []byte("object"),
+		".git/HEAD":      []byte("ref"),
+		"build/out":      []byte("binary"),
+		"sub/build/file": []byte("content"),
+		"cache/a/b":      []byte("cached"),
+	})
+	app := New(4, WithInclude("keep.o"), WithExclude("*.o", ".git/", "/build/", "cache/**"))
+	output := filepath.Join(t.TempDir(), "signature")
+	if err := app.SignatureDir(root, output); err != nil {
+		t.Fatalf("SignatureDir() error = %v", err)
+	}
+	var got []string
+	for _, f := range readDirSignatureFile(t, output) {
+		got = append(got, f.Path)
+	}
+	if diff := cmp.Diff([]string{"keep.o", "main.go", "sub/build/file"}, got); diff != "" {
+		t.Errorf("SignatureDir() files \nDIFF: %v", diff)
+	}
+}
+
+func TestApp_SignatureDir_Invalid(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string][]byte{"file": []byte("content")})
+	out := t.TempDir()
+	writeTree(t, out, map[string][]byte{"existing": nil})
+	for _, tt := range []struct {
+		name   string
+		app    *App
+		root   string
+		output string
+	}{
+		{name: "missing root", app: New(4), root: filepath.Join(root, "missing"), output: filepath.Join(out, "signature")},
+		{name: "root file", app: New(4), root: filepath.Join(root, "file"), output: filepath.Join(out, "signature")},
+		{name: "existing output", app: New(4), root: root, output: filepath.Join(out, "existing")},
+		{name: "json format", app: New(4, WithFormat(FormatJSON)), root: root, output: filepath.Join(out, "signature")},
+		{name: "invalid pattern", app: New(4, WithExclude("[a")), root: root, output: filepath.Join(out, "signature")},
+	} {
+		if err := tt.app.SignatureDir(tt.root, tt.output); err == nil {
+			t.Errorf("%v: SignatureDir() error = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestReadDirSignature_Invalid(t *testing.T) {
+	encode := func(values ...any) []byte {
+		var buf bytes.Buffer
+		enc := gob.NewEncoder(&buf)
+		for _, v := range values {
+			if err := enc.Encode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf.Bytes()
+	}
+	entry := func(path string, blockSize int) dirSignatureEntry {
+		return dirSignatureEntry{Path: path, BlockSize: blockSize, Header: SignatureHeader{StrongHashSize: 16}}
+	}
+	for name, data := range map[string][]byte{
+		"empty":           nil,
+		"negative files":  encode(DirSignatureHeader{Files: -1}),
+		"missing file":    encode(DirSignatureHeader{Files: 1}),
+		"parent path":     encode(DirSignatureHeader{Files: 1}, entry("../file", 4), signatureTable{}),
+		"absolute path":   encode(DirSignatureHeader{Files: 1}, entry("/file", 4), signatureTable{}),
+		"unclean path":    encode(DirSignatureHeader{Files: 1}, entry("sub/../file", 4), signatureTable{}),
+		"zero block size": encode(DirSignatureHeader{Files: 1}, entry("file", 0), signatureTable{}),
+		"malformed table": encode(DirSignatureHeader{Files: 1}, entry("file", 4), signatureTable{WeakHashes: []uint64{1}}),
+		"hard link order": encode(DirSignatureHeader{Files: 1}, dirSignatureEntry{Path: "a", HardLink: "b"}, signatureTable{}),
+		"link blocks": encode(DirSignatureHeader{Files: 1}, dirSignatureEntry{Path: "link", Link: "file", Header: SignatureHeader{StrongHashSize: 1}},
+			signatureTable{WeakHashes: []uint64{1}, StrongHashes: []byte{1}}),
+	} {
+		if _, err := ReadDirSignature(bytes.NewReader(data)); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%v: ReadDirSignature() error = %v, want a %v error", name, err, ErrCorrupt)
+		}
+	}
+}
+
+// FuzzReadDirSignature checks a malformed directory signature is reported as corrupt, without panicking.
+func FuzzReadDirSignature(f *testing.F) {
+	signature, _ := fuzzDirArtifacts(f)
+	f.Add(signature)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, err := ReadDirSignature(bytes.NewReader(data)); err != nil && !errors.Is(err, ErrCorrupt) {
+			t.Errorf("ReadDirSignature() error = %v, want %v", err, ErrCorrupt)
+		}
+	})
+}
@@ -0,0 +1,643 @@
+package rdiff
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// dirLiteralSize is the max size of the literal operations holding the content of a new file, in a directory delta.
+const dirLiteralSize = 1 << 16
+
+// FileChange is the change of a file, between the target and the source directories of a directory delta.
+type FileChange byte
+
+const (
+	// FileUnchanged means the file has the same content in the target and in the source.
+	FileUnchanged FileChange = iota
+	// FileChanged means the file content changed, the file delta holds the operations rebuilding it from the target's.
+	FileChanged
+	// FileNew means the file only exists in the source, the file delta holds its content as OpBlockNew operations.
+	FileNew
+	// FileDeleted means the file only exists in the target.
+	FileDeleted
+	// FileRenamed means the file only exists in the source, and it's similar to a deleted target file, the file delta
+	// holds the operations rebuilding it from the target file it was renamed from.
+	FileRenamed
+)
+
+// String returns the name of the file change.
+func (c FileChange) String() string {
+	switch c {
+	case FileUnchanged:
+		return "unchanged"
+	case FileChanged:
+		return "changed"
+	case FileNew:
+		return "new"
+	case FileDeleted:
+		return "deleted"
+	case FileRenamed:
+		return "renamed"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
+// DirDeltaHeader starts a directory delta, as written by App.DeltaDir.
+// Its fields differ from the other headers ones, so the artifacts can't be mistaken for each other.
+type DirDeltaHeader struct {
+	// SourceFiles is the number of files of the source directory, which is the number of non deleted file deltas
+	SourceFiles int
+	// SourceBytes is the total size of the source files, in bytes, the hard links being counted once
+	SourceBytes int64
+}
+
+// FileDelta is the delta of a file of a directory delta.
+type FileDelta struct {
+	// Path is the path of the file, relative to the directory, using forward slashes
+	Path   string
+	Change FileChange
+	// SourceSize is the size of the file in the source, in bytes, 0 for a deleted file
+	SourceSize int64
+	// BlockSize is the block size of the file's signature, used by the operations of a changed or renamed file
+	BlockSize int
+	// RenamedFrom is the path of the target file a renamed file is rebuilt from, empty for the other changes
+	RenamedFrom string
+	// Attrs are the file attributes recorded for the source file, none for a deleted file, see WithFileAttrs
+	Attrs FileAttrs
+	// Mode is the permission bits of the source file, if Attrs has FileAttrMode
+	Mode fs.FileMode
+	// ModTime is the modification time of the source file, if Attrs has FileAttrModTime
+	ModTime time.Time
+	// UID and GID are the user and group ids of the source file, if Attrs has FileAttrOwner
+	UID int
+	GID int
+	// Link is the target of a symbolic link, which has no operations nor attributes, empty for a regular file
+	Link string
+	// HardLink is the path of the first file, in lexical order, sharing the file's inode, which has no operations
+	// nor attributes, empty if it's the first one or the file has a single link
+	HardLink string
+	// Operations rebuild the file, the same way as the operations of a file delta, for a changed, renamed or new file
+	Operations []Operation
+}
+
+// fileDeltaEntry is the serialized FileDelta, its operations are serialized separately, following it.
+type fileDeltaEntry struct {
+	Path        string
+	Change      FileChange
+	SourceSize  int64
+	BlockSize   int
+	RenamedFrom string
+	Attrs       FileAttrs
+	Mode        fs.FileMode
+	// ModTime is the modification time, in nanoseconds since the Unix epoch
+	ModTime  int64
+	UID      int
+	GID      int
+	Link     string
+	HardLink string
+}
+
+// hasOperations reports whether the entry is followed by operations, which is the case of a changed, renamed or new
+// file, unless it's a link.
+func (e *fileDeltaEntry) hasOperations() bool {
+	return (e.Change == FileChanged || e.Change == FileRenamed || e.Change == FileNew) && e.Link == "" && e.HardLink == ""
+}
+
+// targetPath returns the path of the target file a changed or renamed file is rebuilt from.
+func (e *fileDeltaEntry) targetPath() string {
+	if e.Change == FileRenamed {
+		return e.RenamedFrom
+	}
+
+	return e.Path
+}
+
+// dirDeltaRecord is a value of a directory delta, following the header: a file entry, or an operation of the last
+// file entry.
+type dirDeltaRecord struct {
+	Entry *fileDeltaEntry
+	Op    *Operation
+}
+
+// DeltaDir computes the delta between the directory signature of a target directory(dirSignatureFilePath), as
+// written by SignatureDir, and a source directory(sourceRootPath), and writes it to a delta file(deltaFilePath),
+// which can be read using ReadDirDelta, and applied using PatchDir.
+// The directory delta holds every source file, in lexical order, as unchanged, changed, with the operations
+// rebuilding it from the target file, or new, with its content, followed by the target files which no longer
+// exist in the source, as deleted, so it holds everything needed to rebuild the source directory from the target one.
+// A new file similar to a deleted one is recorded as renamed, with the operations rebuilding it from the deleted
+// file, see WithRenameDetection.
+// The files are compared using the block size and the hashes of their signatures, and the symbolic links using their
+// targets, a link replacing a file being recorded as new, as well as a file replacing a link, unless it's renamed. The files sharing an inode
+// are recorded as hard links to the first of them, which is the only one holding operations.
+// The symbolic links are recorded as links, by default, see WithSymlinks, and the other file types are skipped.
+// The files and directories excluded by the configured patterns are skipped, and the excluded target files are left
+// out of the delta, instead of being recorded as deleted, see WithExclude.
+// Every source file, except the links, records its attributes configured by WithFileAttrs, the mode and
+// modification time by default.
+// The signature file and the source directory must exist, and the delta file must not exist, otherwise a non-nil
+// error is returned. The directory delta is gob encoded, so the other formats return a non-nil error.
+func (a *App) DeltaDir(dirSignatureFilePath string, sourceRootPath string, deltaFilePath string) error {
+	if a.format != FormatGob {
+		return fmt.Errorf("the %v format can't encode a directory delta", a.format)
+	}
+	err := a.checkFilter()
+	if err != nil {
+		return err
+	}
+	signatures, err := readDirSignatureMap(dirSignatureFilePath, a.diffEngine.limits)
+	if err != nil {
+		return err
+	}
+	files, total, err := listDirFiles(sourceRootPath, deltaFilePath, a.filter, a.symlinks)
+	if err != nil {
+		return err
+	}
+	deltaFile, err := os.OpenFile(deltaFilePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(deltaFile)
+	err = a.deltaDir(signatures, sourceRootPath, files, total, gob.NewEncoder(bw))
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	return errors.Join(err, deltaFile.Close())
+}
+
+// dirSignatureFile is a file signature of a directory signature.
+type dirSignatureFile struct {
+	entry dirSignatureEntry
+	table signatureTable
+}
+
+// readDirSignatureMap reads the directory signature at path, and returns its file signatures by path, the hard links
+// having the signature of their first file.
+func readDirSignatureMap(path string, limits DecodeLimits) (map[string]dirSignatureFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	signatures := make(map[string]dirSignatureFile)
+	err = readDirSignature(f, limits, func(entry dirSignatureEntry, t signatureTable) error {
+		if entry.HardLink == "" {
+			signatures[entry.Path] = dirSignatureFile{entry: entry, table: t}
+			return nil
+		}
+		// a hard link has the signature of its first file
+		first, ok := signatures[entry.HardLink]
+		if !ok || first.entry.Link != "" || first.entry.HardLink != "" {
+			return markError(ErrCorrupt, fmt.Errorf("%v: invalid hard link: %q", entry.Path, entry.HardLink))
+		}
+		entry.BlockSize, entry.Header = first.entry.BlockSize, first.entry.Header
+		signatures[entry.Path] = dirSignatureFile{entry: entry, table: first.table}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return signatures, nil
+}
+
+// deltaDir serializes the header, then the delta of every source file, then the deleted files.
+func (a *App) deltaDir(signatures map[string]dirSignatureFile, sourceRoot string, files []dirFile, total int64, enc *gob.Encoder) error {
+	err := enc.Encode(DirDeltaHeader{SourceFiles: len(files), SourceBytes: total})
+	if err != nil {
+		return err
+	}
+	deleted := make([]string, 0, len(signatures))
+	for name := range signatures {
+		_, ok := slices.BinarySearchFunc(files, name, func(f dirFile, name string) int { return strings.Compare(f.path, name) })
+		if !ok && !a.filter.excludedPath(name) {
+			deleted = append(deleted, name)
+		}
+	}
+	slices.Sort(deleted)
+
+	target := &dirTarget{signatures: signatures, renames: a.renameCandidates(signatures, deleted)}
+	err = a.sourceFileDeltas(enc, sourceRoot, files, target, total)
+	if err != nil {
+		return err
+	}
+	for _, name := range deleted {
+		err = enc.Encode(dirDeltaRecord{Entry: &fileDeltaEntry{Path: name, Change: FileDeleted}})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sourceFileDeltas serializes the deltas of the source files, in order, computing them concurrently, if configured.
+func (a *App) sourceFileDeltas(enc *gob.Encoder, sourceRoot string, files []dirFile, target *dirTarget, total int64) error {
+	dp := newDirProgress(a.progress, "delta", total)
+	workers := a.dirWorkers(dp)
+	if workers == nil {
+		progress := Progress{Phase: "delta", Total: total}
+		for _, file := range files {
+			err := a.fileDelta(enc, sourceRoot, file, target, &progress)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return forEachFile(len(files), workers, func(w *App, i int) (dirResult, error) {
+		spool := &dirDeltaSpool{out: enc}
+		err := w.fileDelta(spool, sourceRoot, files[i], target, &Progress{Phase: "delta", Total: total})
+		dp.finish(w, files[i].size)
+		if err != nil {
+			spool.release()
+			return nil, err
+		}
+		return spool, nil
+	})
+}
+
+// fileDelta serializes the delta of a source file, a symbolic link, or a hard link.
+func (a *App) fileDelta(enc recordEncoder, sourceRoot string, file dirFile, target *dirTarget, progress *Progress) error {
+	var err error
+	switch {
+	case file.link != "":
+		err = linkDelta(enc, file, target.signatures)
+	case file.hardLink != "":
+		err = hardLinkDelta(enc, file, target.signatures)
+	default:
+		err = a.dirFileDelta(enc, filepath.Join(sourceRoot, filepath.FromSlash(file.path)), file.path, target, progress)
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %w", file.path, err)
+	}
+
+	return nil
+}
+
+// dirTarget is the target directory of a directory delta, described by its signature.
+type dirTarget struct {
+	signatures map[string]dirSignatureFile
+	// renames are the deleted target files a new source file may be renamed from
+	renames []dirSignatureFile
+}
+
+// dirFileDelta serializes the delta of a source file, against its target signature, if any, or the signature of
+// the deleted target file it was renamed from, if any, and adds the file size to the progress.
+func (a *App) dirFileDelta(enc recordEncoder, path, name string, target *dirTarget, progress *Progress) error {
+	f, err := openSequential(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	entry := fileDeltaEntry{Path: name, Change: FileNew, SourceSize: info.Size()}
+	a.recordAttrs(&entry, info)
+	sig, ok := target.signatures[name]
+	if ok && sig.entry.Link == "" {
+		entry.Change = FileChanged
+	} else {
+		sig, ok, err = a.findRename(f, info.Size(), target.renames)
+		if err != nil {
+			return err
+		}
+		if ok {
+			entry.Change, entry.RenamedFrom = FileRenamed, sig.entry.Path
+		}
+	}
+
+	source, release := a.inputReader(f, info.Size())
+	if a.progress != nil {
+		source = &progressReader{r: source, progress: *progress, fn: a.progress}
+	}
+	if ok {
+		err = a.changedFileDelta(enc, source, entry, sig)
+	} else {
+		err = writeNewFileDelta(enc, source, entry)
+	}
+	progress.Done += info.Size()
+
+	return errors.Join(err, release())
+}
+
+// linkDelta serializes the entry of a symbolic link, as unchanged if the target has the same link, changed if it has
+// a link to another path, and new otherwise.
+func linkDelta(enc recordEncoder, file dirFile, signatures map[string]dirSignatureFile) error {
+	entry := fileDeltaEntry{Path: file.path, Change: FileNew, Link: file.link}
+	if sig, ok := signatures[file.path]; ok && sig.entry.Link != "" {
+		entry.Change = FileChanged
+		if sig.entry.Link == file.link {
+			entry.Change = FileUnchanged
+		}
+	}
+
+	return enc.Encode(dirDeltaRecord{Entry: &entry})
+}
+
+// hardLinkDelta serializes the entry of a hard link, as unchanged if the target file is a hard link to the same
+// first file, changed if it's another file, and new otherwise.
+func hardLinkDelta(enc recordEncoder, file dirFile, signatures map[string]dirSignatureFile) error {
+	entry := fileDeltaEntry{Path: file.path, Change: FileNew, SourceSize: file.size, HardLink: file.hardLink}
+	if sig, ok := signatures[file.path]; ok && sig.entry.Link == "" {
+		entry.Change = FileChanged
+		if sig.entry.HardLink == file.hardLink {
+			entry.Change = FileUnchanged
+		}
+	}
+
+	return enc.Encode(dirDeltaRecord{Entry: &entry})
+}
+
+// changedFileDelta serializes the delta of a source file against a target file, as unchanged if the file is not
+// renamed, and the delta only keeps every target block, in place.
+func (a *App) changedFileDelta(enc recordEncoder, source io.Reader, entry fileDeltaEntry, sig dirSignatureFile) error {
+	blockSize := a.diffEngine.blockSize
+	defer func() { a.diffEngine.blockSize = blockSize }()
+	a.diffEngine.blockSize = sig.entry.BlockSize
+
+	entry.BlockSize = sig.entry.BlockSize
+	w := &fileDeltaWriter{enc: enc, entry: entry}
+	err := a.diffEngine.ComputeDeltaFunc(source, sig.entry.Header, sig.table, w.emit)
+	if err != nil {
+		return err
+	}
+	if w.started {
+		return nil
+	}
+	if entry.Change == FileRenamed || w.kept != int64(sig.table.len()) || entry.SourceSize != sig.entry.Header.TargetSize {
+		return w.start()
+	}
+	w.entry.Change = FileUnchanged
+
+	return enc.Encode(dirDeltaRecord{Entry: &w.entry})
+}
+
+// fileDeltaWriter serializes the operations of a changed file, it holds back the leading operations keeping the
+// target blocks in place, until it finds out the file changed.
+type fileDeltaWriter struct {
+	enc   recordEncoder
+	entry fileDeltaEntry
+	// kept is the number of leading target blocks kept in place
+	kept int64
+	// started means the entry was serialized
+	started bool
+}
+
+func (w *fileDeltaWriter) emit(op Operation) error {
+	if !w.started {
+		if op.Type == OpBlockKeep && op.BlockIndex == w.kept && len(op.Data) == 0 {
+			w.kept++
+			return nil
+		}
+		err := w.start()
+		if err != nil {
+			return err
+		}
+	}
+
+	return w.enc.Encode(dirDeltaRecord{Op: &op})
+}
+
+// start serializes the entry, as changed or renamed, followed by the operations held back.
+func (w *fileDeltaWriter) start() error {
+	w.started = true
+	err := w.enc.Encode(dirDeltaRecord{Entry: &w.entry})
+	if err != nil {
+		return err
+	}
+	for i := int64(0); i < w.kept; i++ {
+		err = w.enc.Encode(dirDeltaRecord{Op: &Operation{Type: OpBlockKeep, BlockIndex: i}})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeNewFileDelta serializes the entry of a new file, followed by its content, as OpBlockNew operations.
+func writeNewFileDelta(enc recordEncoder, source io.Reader, entry fileDeltaEntry) error {
+	err := enc.Encode(dirDeltaRecord{Entry: &entry})
+	if err != nil {
+		return err
+	}
+	bufp := getBuffer(dirLiteralSize)
+	defer putBuffer(bufp)
+	for {
+		n, err := io.ReadFull(source, *bufp)
+		if n > 0 {
+			encErr := enc.Encode(dirDeltaRecord{Op: &Operation{Type: OpBlockNew, BlockIndex: -1, Data: (*bufp)[:n]}})
+			if encErr != nil {
+				return encErr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ReadDirDelta reads a directory delta, as written by App.DeltaDir, and returns its header and file deltas.
+// It returns a non-nil error if the content is not a valid directory delta, or if it exceeds the default
+// DecodeLimits.
+func ReadDirDelta(r io.Reader) (DirDeltaHeader, []FileDelta, error) {
+	var files []FileDelta
+	header, err := readDirDelta(r, DecodeLimits{}, func(entry fileDeltaEntry) (func(Operation) error, error) {
+		files = append(files, FileDelta{
+			Path:        entry.Path,
+			Change:      entry.Change,
+			SourceSize:  entry.SourceSize,
+			BlockSize:   entry.BlockSize,
+			RenamedFrom: entry.RenamedFrom,
+			Attrs:       entry.Attrs,
+			Mode:        entry.Mode,
+			UID:         entry.UID,
+			GID:         entry.GID,
+			Link:        entry.Link,
+			HardLink:    entry.HardLink,
+		})
+		file := &files[len(files)-1]
+		if entry.Attrs&FileAttrModTime != 0 {
+			file.ModTime = time.Unix(0, entry.ModTime)
+		}
+		return func(op Operation) error {
+			file.Operations = append(file.Operations, op)
+			return nil
+		}, nil
+	})
+	if err != nil {
+		return DirDeltaHeader{}, nil, err
+	}
+
+	return header, files, nil
+}
+
+// readDirDelta deserializes a directory delta, passing every file entry to entryFn, and the operations of a changed
+// or new file to the function returned for its entry. It stops at the first non-nil error returned by the functions.
+// The operations are bounded by the limits.
+func readDirDelta(r io.Reader, limits DecodeLimits, entryFn func(fileDeltaEntry) (func(Operation) error, error)) (DirDeltaHeader, error) {
+	dec := gob.NewDecoder(limits.deltaReader(bufio.NewReader(r)))
+	var header DirDeltaHeader
+	err := dec.Decode(&header)
+	if err != nil {
+		return DirDeltaHeader{}, markError(ErrCorrupt, fmt.Errorf("reading the directory delta header: %w", err))
+	}
+	dr := &dirDeltaReader{entryFn: entryFn, limits: limits}
+	for {
+		var rec dirDeltaRecord
+		err = dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return DirDeltaHeader{}, markError(ErrCorrupt, fmt.Errorf("reading the directory delta: %w", err))
+		}
+		err = dr.record(rec)
+		if err != nil {
+			return DirDeltaHeader{}, err
+		}
+	}
+	if dr.files != header.SourceFiles {
+		err = fmt.Errorf("the directory delta has %v source files, but its header records %v", dr.files, header.SourceFiles)
+		return DirDeltaHeader{}, markError(ErrCorrupt, err)
+	}
+
+	return header, nil
+}
+
+// dirDeltaReader dispatches the records of a directory delta.
+type dirDeltaReader struct {
+	entryFn func(fileDeltaEntry) (func(Operation) error, error)
+	// opFn receives the operations of the last entry, nil if the entry has no operations
+	opFn func(Operation) error
+	// files is the number of source files read so far
+	files int
+	// ops is the number of operations read so far, bounded by limits
+	ops    int64
+	limits DecodeLimits
+}
+
+// record validates a record, and passes it to the entry or operation function.
+func (dr *dirDeltaReader) record(rec dirDeltaRecord) error {
+	switch {
+	case rec.Entry != nil && rec.Op == nil:
+		err := validateFileDeltaEntry(*rec.Entry)
+		if err != nil {
+			return markError(ErrCorrupt, err)
+		}
+		if rec.Entry.Change != FileDeleted {
+			dr.files++
+		}
+		dr.opFn, err = dr.entryFn(*rec.Entry)
+		if !rec.Entry.hasOperations() {
+			dr.opFn = nil
+		}
+		return err
+	case rec.Op != nil && rec.Entry == nil && dr.opFn != nil:
+		dr.ops++
+		err := dr.limits.checkOperation(dr.ops, *rec.Op)
+		if err != nil {
+			return err
+		}
+		return dr.opFn(*rec.Op)
+	default:
+		return markError(ErrCorrupt, errors.New("invalid directory delta record"))
+	}
+}
+
+// validateFileDeltaEntry checks the entry path stays inside the directory, and its fields are valid for its change.
+func validateFileDeltaEntry(entry fileDeltaEntry) error {
+	if !validDirPath(entry.Path) {
+		return fmt.Errorf("invalid directory delta file path: %q", entry.Path)
+	}
+	if entry.Change > FileRenamed {
+		return fmt.Errorf("%v: invalid file change: %v", entry.Path, entry.Change)
+	}
+	err := validateRenamedFrom(entry)
+	if err != nil {
+		return err
+	}
+	if entry.Link != "" || entry.HardLink != "" {
+		return validateLinkEntry(entry)
+	}
+	err = validateFileDeltaSizes(entry)
+	if err != nil {
+		return err
+	}
+
+	return validateFileDeltaAttrs(entry)
+}
+
+// validateRenamedFrom checks a renamed file, which is not a link, is renamed from another valid path, while the other
+// files are not renamed.
+func validateRenamedFrom(entry fileDeltaEntry) error {
+	if entry.Change != FileRenamed {
+		if entry.RenamedFrom != "" {
+			return fmt.Errorf("%v: invalid %v file renamed from %q", entry.Path, entry.Change, entry.RenamedFrom)
+		}
+		return nil
+	}
+	if !validDirPath(entry.RenamedFrom) || entry.RenamedFrom == entry.Path || entry.Link != "" || entry.HardLink != "" {
+		return fmt.Errorf("%v: invalid renamed file: %q", entry.Path, entry.RenamedFrom)
+	}
+
+	return nil
+}
+
+// validateFileDeltaSizes checks the source size, and the block size of a changed or renamed file.
+func validateFileDeltaSizes(entry fileDeltaEntry) error {
+	if entry.SourceSize < 0 || (entry.Change == FileDeleted && entry.SourceSize != 0) {
+		return fmt.Errorf("%v: invalid source size: %v", entry.Path, entry.SourceSize)
+	}
+	if (entry.Change == FileChanged || entry.Change == FileRenamed) && (entry.BlockSize <= 0 || entry.BlockSize > MaxBlockSize) {
+		return fmt.Errorf("%v: invalid block size: %v", entry.Path, entry.BlockSize)
+	}
+
+	return nil
+}
+
+// validateFileDeltaAttrs checks the recorded attributes are known, and a deleted file has none.
+func validateFileDeltaAttrs(entry fileDeltaEntry) error {
+	if entry.Attrs&^fileAttrsAll != 0 || (entry.Change == FileDeleted && entry.Attrs != 0) {
+		return fmt.Errorf("%v: invalid file attributes: %v", entry.Path, entry.Attrs)
+	}
+	if entry.Mode&^fileModeBits != 0 {
+		return fmt.Errorf("%v: invalid file mode: %v", entry.Path, entry.Mode)
+	}
+
+	return nil
+}
+
+// validateLinkEntry checks the entry of a symbolic or hard link has no attributes, and it's not deleted, while
+// a symbolic link has no size either.
+func validateLinkEntry(entry fileDeltaEntry) error {
+	if entry.Change == FileDeleted || entry.Attrs != 0 || entry.SourceSize < 0 {
+		return fmt.Errorf("%v: invalid link entry", entry.Path)
+	}
+	if entry.HardLink != "" {
+		return validateHardLink(entry.Path, entry.HardLink, entry.Link)
+	}
+	if entry.SourceSize != 0 {
+		return fmt.Errorf("%v: invalid symbolic link size: %v", entry.Path, entry.SourceSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,301 @@
+package rdiff
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+// readTree returns the content of the regular files under dir, by relative path.
+func readTree(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files := make(map[string][]byte)
+	list, _, err := listDirFiles(dir, "", nil, SymlinkSkip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range list {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(file.path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.path] = content
+	}
+
+	return files
+}
+
+// dirDeltaTrees returns a target and a source tree, covering every file change.
+func dirDeltaTrees() (target, source map[string][]byte) {
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog "), 20)
+	large := bytes.Repeat([]byte("0123456789abcdef"), dirLiteralSize/8)
+	target = map[string][]byte{
+		"same":          text,
+		"edited":        text,
+		"appended":      text,
+		"gone":          []byte("deleted content"),
+		"sub/gone":      nil,
+		"sub/same":      []byte("x"),
+		"sub/emptied":   text,
+		"sub/was empty": nil,
+	}
+	source = map[string][]byte{
+		"same":          text,
+		"edited":        append(append([]byte("prefix "), text[:300]...), text[320:]...),
+		"appended":      append(append([]byte{}, text...), "suffix"...),
+		"new":           large,
+		"sub/same":      []byte("x"),
+		"sub/emptied":   nil,
+		"sub/was empty": []byte("filled"),
+		"sub/new/empty": nil,
+	}
+
+	return target, source
+}
+
+// fuzzDirArtifacts returns a small directory signature and delta, the fuzzing being slow for big inputs.
+func fuzzDirArtifacts(tb testing.TB) (signature, delta []byte) {
+	tb.Helper()
+	targetFiles := map[string][]byte{"same": []byte("same content"), "edited": []byte("the content"), "gone": nil}
+	sourceFiles := map[string][]byte{"same": []byte("same content"), "edited": []byte("the new content"), "new": []byte("new")}
+	target, source, dir := tb.TempDir(), tb.TempDir(), tb.TempDir()
+	writeTree(tb, target, targetFiles)
+	writeTree(tb, source, sourceFiles)
+	signaturePath, deltaPath := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	if err := New(4).SignatureDir(target, signaturePath); err != nil {
+		tb.Fatal(err)
+	}
+	if err := New(0).DeltaDir(signaturePath, source, deltaPath); err != nil {
+		tb.Fatal(err)
+	}
+	signature, err := os.ReadFile(signaturePath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	delta, err = os.ReadFile(deltaPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return signature, delta
+}
+
+func TestApp_DeltaDir(t *testing.T) {
+	targetFiles, sourceFiles := dirDeltaTrees()
+	target, source, dir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTree(t, target, targetFiles)
+	writeTree(t, source, sourceFiles)
+	signature, delta := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	if err := New(16).SignatureDir(target, signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(0).DeltaDir(signature, source, delta); err != nil {
+		t.Fatalf("DeltaDir() error = %v", err)
+	}
+
+	f, err := os.Open(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	header, files, err := ReadDirDelta(f)
+	if err != nil {
+		t.Fatalf("ReadDirDelta() error = %v", err)
+	}
+	var sourceBytes int64
+	for _, content := range sourceFiles {
+		sourceBytes += int64(len(content))
+	}
+	if want := (DirDeltaHeader{SourceFiles: len(sourceFiles), SourceBytes: sourceBytes}); header != want {
+		t.Errorf("ReadDirDelta() header = %+v, want %+v", header, want)
+	}
+	changes := make(map[string]FileChange)
+	for _, file := range files {
+		changes[file.Path] = file.Change
+		if file.Change == FileUnchanged && len(file.Operations) != 0 {
+			t.Errorf("ReadDirDelta() unchanged %v has %v operations", file.Path, len(file.Operations))
+		}
+	}
+	want := map[string]FileChange{
+		"same":          FileUnchanged,
+		"edited":        FileChanged,
+		"appended":      FileChanged,
+		"new":           FileNew,
+		"gone":          FileDeleted,
+		"sub/gone":      FileDeleted,
+		"sub/same":      FileUnchanged,
+		"sub/emptied":   FileChanged,
+		"sub/was empty": FileChanged,
+		"sub/new/empty": FileNew,
+	}
+	if diff := cmp.Diff(want, changes); diff != "" {
+		t.Errorf("ReadDirDelta() changes \nDIFF: %v", diff)
+	}
+
+	output := filepath.Join(dir, "output")
+	if err := New(0).PatchDir(target, delta, output); err != nil {
+		t.Fatalf("PatchDir() error = %v", err)
+	}
+	if diff := cmp.Diff(sourceFiles, readTree(t, output), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("PatchDir() output differs from the source \nDIFF: %v", diff)
+	}
+	if diff := cmp.Diff(targetFiles, readTree(t, target), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("PatchDir() changed the target \nDIFF: %v", diff)
+	}
+}
+
+func TestApp_DeltaDir_Filter(t *testing.T) {
+	target, source, dir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTree(t, target, map[string][]byte{"main.go": []byte("package main"), "main.o": []byte("object")})
+	writeTree(t, source, map[string][]byte{"main.go": []byte("package main"), "cache/a": []byte("cached")})
+	signature, delta := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	if err := New(4).SignatureDir(target, signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(4, WithExclude("*.o", "cache/")).DeltaDir(signature, source, delta); err != nil {
+		t.Fatalf("DeltaDir() error = %v", err)
+	}
+
+	f, err := os.Open(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, files, err := ReadDirDelta(f)
+	if err != nil {
+		t.Fatalf("ReadDirDelta() error = %v", err)
+	}
+	// the excluded target file is not deleted, and the excluded source file is not new
+	if len(files) != 1 || files[0].Path != "main.go" || files[0].Change != FileUnchanged {
+		t.Errorf("ReadDirDelta() files = %+v, want main.go unchanged", files)
+	}
+}
+
+func TestApp_DeltaDir_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string][]byte{"root/file": []byte("content"), "existing": nil, "not a signature": []byte("x")})
+	if err := New(4).SignatureDir(filepath.Join(dir, "root"), filepath.Join(dir, "signature")); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name      string
+		app       *App
+		signature string
+		source    string
+		delta     string
+	}{
+		{name: "missing signature", app: New(4), signature: "missing", source: "root", delta: "delta"},
+		{name: "invalid signature", app: New(4), signature: "not a signature", source: "root", delta: "delta"},
+		{name: "missing source", app: New(4), signature: "signature", source: "missing", delta: "delta"},
+		{name: "existing delta", app: New(4), signature: "signature", source: "root", delta: "existing"},
+		{name: "json format", app: New(4, WithFormat(FormatJSON)), signature: "signature", source: "root", delta: "delta"},
+		{name: "invalid pattern", app: New(4, WithInclude("[a")), signature: "signature", source: "root", delta: "delta"},
+	} {
+		err := tt.app.DeltaDir(filepath.Join(dir, tt.signature), filepath.Join(dir, tt.source), filepath.Join(dir, tt.delta))
+		if err == nil {
+			t.Errorf("%v: DeltaDir() error = nil, want an error", tt.name)
+		}
+	}
+}
+
+func TestApp_PatchDir_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	target, source := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	writeTree(t, target, map[string][]byte{"same": []byte("same content"), "edited": []byte("edited content")})
+	writeTree(t, source, map[string][]byte{"same": []byte("same content"), "edited": []byte("content edited")})
+	signature, delta := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	if err := New(4).SignatureDir(target, signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(4).DeltaDir(signature, source, delta); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := New(4).PatchDir(target, delta, target); err == nil {
+		t.Errorf("PatchDir() to an existing output error = nil, want an error")
+	}
+	if err := New(4).PatchDir(target, filepath.Join(dir, "missing"), filepath.Join(dir, "output1")); err == nil {
+		t.Errorf("PatchDir() of a missing delta error = nil, want an error")
+	}
+	// the unchanged file no longer matches the delta
+	writeTree(t, target, map[string][]byte{"same": []byte("changed since the signature")})
+	if err := New(4).PatchDir(target, delta, filepath.Join(dir, "output2")); !errors.Is(err, ErrVerification) {
+		t.Errorf("PatchDir() error = %v, want a %v error", err, ErrVerification)
+	}
+}
+
+func TestReadDirDelta_Invalid(t *testing.T) {
+	encode := func(values ...any) []byte {
+		var buf bytes.Buffer
+		enc := gob.NewEncoder(&buf)
+		for _, v := range values {
+			if err := enc.Encode(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf.Bytes()
+	}
+	entry := func(path string, change FileChange) dirDeltaRecord {
+		return dirDeltaRecord{Entry: &fileDeltaEntry{Path: path, Change: change, BlockSize: 4}}
+	}
+	op := dirDeltaRecord{Op: &Operation{Type: OpBlockNew, BlockIndex: -1, Data: []byte{1}}}
+	header := DirDeltaHeader{SourceFiles: 1}
+	for name, data := range map[string][]byte{
+		"empty":                nil,
+		"missing file":         encode(header),
+		"extra file":           encode(header, entry("a", FileNew), entry("b", FileNew)),
+		"operation first":      encode(header, op, entry("a", FileNew)),
+		"unchanged operations": encode(header, entry("a", FileUnchanged), op),
+		"deleted operations":   encode(DirDeltaHeader{}, entry("a", FileDeleted), op),
+		"empty record":         encode(header, entry("a", FileNew), dirDeltaRecord{}),
+		"parent path":          encode(header, entry("../a", FileNew)),
+		"unknown change":       encode(header, entry("a", FileChange(9))),
+		"zero block size":      encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileChanged}}),
+		"deleted source size":  encode(DirDeltaHeader{}, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileDeleted, SourceSize: 1}}),
+		"deleted attributes":   encode(DirDeltaHeader{}, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileDeleted, Attrs: FileAttrMode}}),
+		"unknown attributes":   encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileNew, Attrs: 1 << 7}}),
+		"invalid mode":         encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileNew, Mode: os.ModeDir}}),
+		"deleted link":         encode(DirDeltaHeader{}, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileDeleted, Link: "b"}}),
+		"link source size":     encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileNew, SourceSize: 1, Link: "b"}}),
+		"link operations":      encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileNew, Link: "b"}}, op),
+		"renamed from none":    encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileRenamed, BlockSize: 4}}),
+		"renamed from itself":  encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileRenamed, BlockSize: 4, RenamedFrom: "a"}}),
+		"changed renamed from": encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileChanged, BlockSize: 4, RenamedFrom: "b"}}),
+		"renamed link":         encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileRenamed, RenamedFrom: "b", Link: "c"}}),
+		"hard link order":      encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "a", Change: FileNew, HardLink: "b"}}),
+		"hard link operations": encode(header, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "b", Change: FileNew, HardLink: "a"}}, op),
+		"deleted hard link":    encode(DirDeltaHeader{}, dirDeltaRecord{Entry: &fileDeltaEntry{Path: "b", Change: FileDeleted, HardLink: "a"}}),
+	} {
+		if _, _, err := ReadDirDelta(bytes.NewReader(data)); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%v: ReadDirDelta() error = %v, want a %v error", name, err, ErrCorrupt)
+		}
+	}
+}
+
+func TestFileChange_String(t *testing.T) {
+	for c, want := range map[FileChange]string{
+		FileUnchanged: "unchanged", FileChanged: "changed", FileNew: "new", FileDeleted: "deleted", FileRenamed: "renamed",
+		FileChange(9): "unknown(9)",
+	} {
+		if got := c.String(); got != want {
+			t.Errorf("String() = %v, want %v", got, want)
+		}
+	}
+}
+
+// FuzzReadDirDelta checks a malformed directory delta is reported as corrupt, without panicking.
+func FuzzReadDirDelta(f *testing.F) {
+	_, delta := fuzzDirArtifacts(f)
+	f.Add(delta)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, _, err := ReadDirDelta(bytes.NewReader(data)); err != nil && !errors.Is(err, ErrCorrupt) {
+			t.Errorf("ReadDirDelta() error = %v, want %v", err, ErrCorrupt)
+		}
+	})
+}
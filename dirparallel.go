@@ -0,0 +1,292 @@
+package rdiff
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// dirSpoolMemory is the max size of the operations data of a file delta kept in memory, by a worker, until it's
+// written to the directory delta, the larger file deltas are spooled to a temporary file.
+const dirSpoolMemory = 1 << 20
+
+// errDirStopped is the result of the files skipped by the workers, after a failure.
+var errDirStopped = errors.New("the directory processing stopped")
+
+// recordEncoder serializes the records of a directory artifact, it's implemented by gob.Encoder and dirDeltaSpool.
+type recordEncoder interface {
+	Encode(e any) error
+}
+
+// dirResult is the result of a file processed by a worker, which is written to the output, in the files order.
+type dirResult interface {
+	// write writes the result to the output, and releases it
+	write() error
+	// release releases the result, without writing it, after a failure
+	release()
+}
+
+// dirWorkers returns the apps processing the files of a directory concurrently, one per worker, every one with its
+// own engine, reporting the progress to p. It returns nil if the files are processed sequentially, which is also
+// the case of a custom weak hash, as it can't be constructed for every worker.
+func (a *App) dirWorkers(p *dirProgress) []*App {
+	if a.dirConcurrency <= 1 || a.diffEngine.weakHashType == WeakHashCustom {
+		return nil
+	}
+	workers := make([]*App, a.dirConcurrency)
+	for i := range workers {
+		e, err := a.diffEngine.clone()
+		if err != nil {
+			// the sequential processing reports the invalid hashers
+			return nil
+		}
+		e.weakHashPinned, e.strongHashPinned = a.diffEngine.weakHashPinned, a.diffEngine.strongHashPinned
+		e.blockSizePinned = a.diffEngine.blockSizePinned
+		e.maxMemory, e.concurrency, e.sparse = a.diffEngine.maxMemory, a.diffEngine.concurrency, a.diffEngine.sparse
+		e.minMatch, e.coalesceLiterals = a.diffEngine.minMatch, a.diffEngine.coalesceLiterals
+		e.literalChunkSize, e.secondPass = a.diffEngine.literalChunkSize, a.diffEngine.secondPass
+		e.limits = a.diffEngine.limits
+		w := *a
+		w.diffEngine = e
+		w.progress = p.reporter(&w)
+		workers[i] = &w
+	}
+
+	return workers
+}
+
+// dirJob is a file processed by a worker, which sends its outcome on the buffered done channel.
+type dirJob struct {
+	i    int
+	done chan dirOutcome
+}
+
+// dirOutcome is the result of a file processed by a worker, or its error.
+type dirOutcome struct {
+	result dirResult
+	err    error
+}
+
+// forEachFile calls work for the files 0..n-1, on the workers, and writes the results in the files order, from the
+// calling goroutine, so at most 2 results per worker are pending at a time. It stops at the first non-nil error.
+func forEachFile(n int, workers []*App, work func(w *App, i int) (dirResult, error)) error {
+	jobs := make(chan dirJob)
+	pending := make(chan dirJob, len(workers))
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		wg.Add(1)
+		go func(w *App) {
+			defer wg.Done()
+			for j := range jobs {
+				select {
+				case <-stop:
+					j.done <- dirOutcome{err: errDirStopped}
+				default:
+					r, err := work(w, j.i)
+					j.done <- dirOutcome{result: r, err: err}
+				}
+			}
+		}(w)
+	}
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		for i := 0; i < n; i++ {
+			j := dirJob{i: i, done: make(chan dirOutcome, 1)}
+			select {
+			case jobs <- j:
+			case <-stop:
+				return
+			}
+			// the job is sent, so it's always pending, to be released after a failure
+			pending <- j
+		}
+	}()
+
+	err := writeResults(pending, stop)
+	wg.Wait()
+
+	return err
+}
+
+// writeResults writes the results of the pending jobs, in order, until the first failure, then it stops the workers,
+// by closing stop, and releases the remaining results.
+func writeResults(pending <-chan dirJob, stop chan struct{}) error {
+	var err error
+	for j := range pending {
+		outcome := <-j.done
+		if err != nil {
+			if outcome.result != nil {
+				outcome.result.release()
+			}
+			continue
+		}
+		err = outcome.err
+		if err == nil {
+			err = outcome.result.write()
+		}
+		if err != nil {
+			close(stop)
+		}
+	}
+
+	return err
+}
+
+// dirProgress aggregates the progress of the files processed concurrently, so the configured progress function
+// is called from a single goroutine at a time.
+type dirProgress struct {
+	mu       sync.Mutex
+	progress Progress
+	fn       func(Progress)
+	// files holds, for every worker, the bytes of its current file processed so far
+	files map[*App]int64
+}
+
+// newDirProgress returns the progress of the phase, nil if there's no progress function.
+func newDirProgress(fn func(Progress), phase string, total int64) *dirProgress {
+	if fn == nil {
+		return nil
+	}
+
+	return &dirProgress{progress: Progress{Phase: phase, Total: total}, fn: fn, files: make(map[*App]int64)}
+}
+
+// reporter returns the progress function of the worker w, which receives the progress of its current file.
+func (p *dirProgress) reporter(w *App) func(Progress) {
+	if p == nil {
+		return nil
+	}
+
+	return func(fp Progress) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.files[w] = fp.Done
+		done := p.progress.Done
+		for _, n := range p.files {
+			done += n
+		}
+		p.fn(Progress{Phase: p.progress.Phase, Done: done, Total: p.progress.Total})
+	}
+}
+
+// finish adds the size of the current file of the worker w to the progress.
+func (p *dirProgress) finish(w *App, size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files[w] = 0
+	p.progress.Done += size
+}
+
+// dirDeltaSpool holds the records of a file delta, computed by a worker, until they're written to the directory
+// delta: in memory, while their operations data is under dirSpoolMemory bytes, then in a temporary file.
+type dirDeltaSpool struct {
+	out     *gob.Encoder
+	records []dirDeltaRecord
+	size    int
+	file    *os.File
+	// remove closes and removes the file
+	remove func() error
+	bw     *bufio.Writer
+	enc    *gob.Encoder
+}
+
+// Encode spools a dirDeltaRecord, copying it, as the operations data is reused by the delta computation.
+func (s *dirDeltaSpool) Encode(e any) error {
+	rec, ok := e.(dirDeltaRecord)
+	if !ok {
+		return errors.New("the directory delta spool only holds records")
+	}
+	if s.enc != nil {
+		return s.enc.Encode(rec)
+	}
+	if rec.Entry != nil {
+		entry := *rec.Entry
+		rec.Entry = &entry
+	}
+	if rec.Op != nil {
+		op := *rec.Op
+		op.Data = append([]byte(nil), op.Data...)
+		rec.Op = &op
+		s.size += len(op.Data)
+	}
+	s.records = append(s.records, rec)
+	if s.size > dirSpoolMemory {
+		return s.spill()
+	}
+
+	return nil
+}
+
+// spill moves the records to a temporary file, which receives the next records, as well.
+func (s *dirDeltaSpool) spill() error {
+	f, remove, err := createSpool("rdiff-spool-*")
+	if err != nil {
+		return err
+	}
+	s.file, s.remove, s.bw = f, remove, bufio.NewWriter(f)
+	s.enc = gob.NewEncoder(s.bw)
+	for _, rec := range s.records {
+		err = s.enc.Encode(rec)
+		if err != nil {
+			return err
+		}
+	}
+	s.records, s.size = nil, 0
+
+	return nil
+}
+
+// write writes the spooled records to the directory delta, and releases the spool.
+func (s *dirDeltaSpool) write() error {
+	defer s.release()
+	for _, rec := range s.records {
+		err := s.out.Encode(rec)
+		if err != nil {
+			return err
+		}
+	}
+	if s.file == nil {
+		return nil
+	}
+	err := s.bw.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	dec := gob.NewDecoder(bufio.NewReader(s.file))
+	for {
+		var rec dirDeltaRecord
+		err = dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = s.out.Encode(rec)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// release removes the temporary file, if any.
+func (s *dirDeltaSpool) release() {
+	s.records = nil
+	if s.file != nil {
+		_ = s.remove()
+		s.file, s.remove = nil, nil
+	}
+}
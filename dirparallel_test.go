@@ -0,0 +1,156 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// parallelTrees returns a target and a source tree of many files, including a large new file, which is spooled.
+func parallelTrees() (target, source map[string][]byte) {
+	rnd := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+		return b
+	}
+	target, source = make(map[string][]byte), make(map[string][]byte)
+	for i := 0; i < 40; i++ {
+		content := random(rnd.Intn(20000))
+		name := fmt.Sprintf("dir%v/file%v", i%3, i)
+		target[name] = content
+		switch i % 4 {
+		case 0:
+			source[name] = content
+		case 1:
+			source[name] = append(random(100), content...)
+		case 2:
+			source[name+".new"] = random(rnd.Intn(20000))
+		}
+	}
+	source["large"] = random(dirSpoolMemory + dirSpoolMemory/2)
+
+	return target, source
+}
+
+func TestApp_DirConcurrency(t *testing.T) {
+	targetFiles, sourceFiles := parallelTrees()
+	target, source := t.TempDir(), t.TempDir()
+	writeTree(t, target, targetFiles)
+	writeTree(t, source, sourceFiles)
+
+	run := func(app *App) (signature, delta []byte) {
+		dir := t.TempDir()
+		signaturePath, deltaPath := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+		if err := app.SignatureDir(target, signaturePath); err != nil {
+			t.Fatalf("SignatureDir() error = %v", err)
+		}
+		if err := app.DeltaDir(signaturePath, source, deltaPath); err != nil {
+			t.Fatalf("DeltaDir() error = %v", err)
+		}
+		signature, err := os.ReadFile(signaturePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		delta, err = os.ReadFile(deltaPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature, delta
+	}
+	wantSignature, wantDelta := run(New(0))
+	var mu sync.Mutex
+	var last Progress
+	progress := func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		if p.Phase == last.Phase && p.Done < last.Done {
+			t.Errorf("progress Done = %v, after %v", p.Done, last.Done)
+		}
+		if p.Done > p.Total {
+			t.Errorf("progress Done = %v, over Total %v", p.Done, p.Total)
+		}
+		last = p
+	}
+	for _, workers := range []int{2, 8} {
+		signature, delta := run(New(0, WithDirConcurrency(workers), WithProgress(progress)))
+		if !bytes.Equal(signature, wantSignature) {
+			t.Errorf("%v workers: SignatureDir() differs from the sequential signature", workers)
+		}
+		if !bytes.Equal(delta, wantDelta) {
+			t.Errorf("%v workers: DeltaDir() differs from the sequential delta", workers)
+		}
+	}
+}
+
+func TestApp_DirConcurrency_Error(t *testing.T) {
+	targetFiles, sourceFiles := parallelTrees()
+	target, source, dir := t.TempDir(), t.TempDir(), t.TempDir()
+	writeTree(t, target, targetFiles)
+	writeTree(t, source, sourceFiles)
+	signature := filepath.Join(dir, "signature")
+	if err := New(0).SignatureDir(target, signature); err != nil {
+		t.Fatal(err)
+	}
+	// the pinned weak hash doesn't match the signature's
+	err := New(0, WithDirConcurrency(4), WithWeakHash(WeakHashRabin)).DeltaDir(signature, source, filepath.Join(dir, "delta"))
+	if !errors.Is(err, ErrVerification) {
+		t.Errorf("DeltaDir() error = %v, want a %v error", err, ErrVerification)
+	}
+}
+
+// testResult records the order of the written results, and counts the released ones.
+type testResult struct {
+	i        int
+	written  *[]int
+	released *atomic.Int64
+}
+
+func (r *testResult) write() error {
+	*r.written = append(*r.written, r.i)
+	return nil
+}
+
+func (r *testResult) release() {
+	r.released.Add(1)
+}
+
+func TestForEachFile(t *testing.T) {
+	workers := []*App{New(4), New(4), New(4)}
+	for _, failAt := range []int{-1, 0, 50} {
+		var written []int
+		var created, released atomic.Int64
+		err := forEachFile(100, workers, func(_ *App, i int) (dirResult, error) {
+			if i == failAt {
+				return nil, errors.New("failure")
+			}
+			created.Add(1)
+			return &testResult{i: i, written: &written, released: &released}, nil
+		})
+		if (err != nil) != (failAt >= 0) {
+			t.Errorf("failing at %v: forEachFile() error = %v", failAt, err)
+		}
+		want := 100
+		if failAt >= 0 {
+			want = failAt
+		}
+		if len(written) != want {
+			t.Fatalf("failing at %v: forEachFile() wrote %v results, want %v", failAt, len(written), want)
+		}
+		for i, n := range written {
+			if i != n {
+				t.Fatalf("failing at %v: forEachFile() wrote %v as result %v", failAt, n, i)
+			}
+		}
+		// every result is either written or released
+		if got := int64(len(written)) + released.Load(); got != created.Load() {
+			t.Errorf("failing at %v: forEachFile() wrote or released %v results, of %v", failAt, got, created.Load())
+		}
+	}
+}
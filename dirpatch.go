@@ -0,0 +1,299 @@
+package rdiff
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// PatchDir applies a directory delta(deltaFilePath), as written by DeltaDir, to the target directory(targetRootPath),
+// writing the rebuilt source directory to an output directory(outputRootPath), so the target directory is left
+// untouched: the unchanged files are copied from the target, the changed ones are rebuilt from the target's, the
+// renamed ones from the target files they were renamed from, the new ones are written from the delta, the symbolic
+// and hard links are recreated, and the deleted ones are left out.
+// The rebuilt files get the attributes recorded in the delta, which are also configured by WithFileAttrs, the mode
+// and modification time by default.
+// The target directory and the delta file must exist, and the output directory must not exist, otherwise a non-nil
+// error is returned. A target file which doesn't match the delta makes it return a non-nil error, as well.
+func (a *App) PatchDir(targetRootPath string, deltaFilePath string, outputRootPath string) error {
+	deltaFile, err := os.Open(deltaFilePath)
+	if err != nil {
+		return err
+	}
+	defer deltaFile.Close()
+	err = os.Mkdir(outputRootPath, 0777)
+	if err != nil {
+		return err
+	}
+
+	p := &dirPatcher{
+		app:        a,
+		targetRoot: targetRootPath,
+		outputRoot: outputRootPath,
+		links:      make(map[string]bool),
+		files:      make(map[string]bool),
+	}
+	_, err = readDirDelta(deltaFile, a.diffEngine.limits, p.entry)
+	if err != nil {
+		return errors.Join(err, p.close())
+	}
+
+	return p.finish()
+}
+
+// dirPatcher rebuilds the files of a directory delta, one at a time.
+type dirPatcher struct {
+	app        *App
+	targetRoot string
+	outputRoot string
+	// file is the file being rebuilt, nil if none
+	file *dirPatchFile
+	// done is the size of the files rebuilt so far, for the progress
+	done int64
+	// links are the paths of the symbolic links created so far
+	links map[string]bool
+	// files are the paths of the regular files created so far, which the hard links can link to
+	files map[string]bool
+}
+
+// dirPatchFile is an output file being rebuilt, from its target file, if it's changed.
+type dirPatchFile struct {
+	entry      fileDeltaEntry
+	target     *os.File
+	targetSize int64
+	output     *os.File
+	bw         *bufio.Writer
+	cw         *countingWriter
+	blockBuf   *[]byte
+}
+
+// entry finishes the previous file and starts rebuilding the entry's file, it returns the function applying
+// the entry operations.
+func (p *dirPatcher) entry(entry fileDeltaEntry) (func(Operation) error, error) {
+	err := p.finish()
+	if err != nil {
+		return nil, err
+	}
+	if p.underLink(entry.Path) {
+		return nil, markError(ErrCorrupt, fmt.Errorf("%v: the file is under a symbolic link", entry.Path))
+	}
+	switch {
+	case entry.Change == FileDeleted:
+		return nil, nil
+	case entry.Link != "":
+		return nil, p.symlink(entry)
+	case entry.HardLink != "":
+		return nil, p.hardLink(entry)
+	case entry.Change == FileUnchanged:
+		return nil, p.copyFile(entry)
+	default:
+		return p.apply, p.start(entry)
+	}
+}
+
+// underLink reports whether any parent directory of the relative path is a symbolic link created by the patch, so
+// a crafted delta can't write outside the output directory through it.
+func (p *dirPatcher) underLink(name string) bool {
+	for i, c := range name {
+		if c == '/' && p.links[name[:i]] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// symlink creates the symbolic link of the entry, and its parent directories.
+func (p *dirPatcher) symlink(entry fileDeltaEntry) error {
+	path := p.outputPath(entry.Path)
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+	err = os.Symlink(entry.Link, path)
+	if err != nil {
+		return err
+	}
+	p.links[entry.Path] = true
+
+	return nil
+}
+
+// hardLink creates the hard link of the entry, to its first file, which must be a regular file created before,
+// and its parent directories.
+func (p *dirPatcher) hardLink(entry fileDeltaEntry) error {
+	if !p.files[entry.HardLink] {
+		return markError(ErrCorrupt, fmt.Errorf("%v: the hard link's first file %v was not rebuilt", entry.Path, entry.HardLink))
+	}
+	path := p.outputPath(entry.Path)
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+
+	return os.Link(p.outputPath(entry.HardLink), path)
+}
+
+// start creates the output file of a changed, renamed or new file, and opens its target file, unless it's new.
+func (p *dirPatcher) start(entry fileDeltaEntry) error {
+	f := &dirPatchFile{entry: entry}
+	if entry.Change != FileNew {
+		target, err := os.Open(p.targetPath(entry.targetPath()))
+		if err != nil {
+			return err
+		}
+		f.target = target
+		info, err := target.Stat()
+		if err != nil {
+			return errors.Join(err, target.Close())
+		}
+		f.targetSize = info.Size()
+		f.blockBuf = getBuffer(entry.BlockSize)
+	}
+	output, err := p.createOutput(entry.Path)
+	if err != nil {
+		return errors.Join(err, f.close())
+	}
+	p.files[entry.Path] = true
+	f.output = output
+	f.bw = bufio.NewWriter(p.app.withDirProgress(output, p.done))
+	f.cw = &countingWriter{w: f.bw}
+	p.file = f
+
+	return nil
+}
+
+// apply applies an operation of the file being rebuilt.
+func (p *dirPatcher) apply(op Operation) error {
+	f := p.file
+	if f.target == nil {
+		if op.Type != OpBlockNew {
+			return markError(ErrCorrupt, fmt.Errorf("%v: invalid operation type for a new file: %v", f.entry.Path, op.Type))
+		}
+		_, err := f.cw.Write(op.Data)
+		return err
+	}
+	layout := targetLayout{size: f.targetSize, blockSize: f.entry.BlockSize}
+	err := p.app.diffEngine.applyOperation(f.target, layout, op, *f.blockBuf, f.cw)
+	if err != nil {
+		return fmt.Errorf("%v: %w", f.entry.Path, err)
+	}
+
+	return nil
+}
+
+// finish flushes and closes the file being rebuilt, if any, and checks its size.
+func (p *dirPatcher) finish() error {
+	f := p.file
+	if f == nil {
+		return nil
+	}
+	p.file = nil
+	p.done += f.cw.n
+	err := f.bw.Flush()
+	err = errors.Join(err, f.close())
+	if err != nil {
+		return err
+	}
+	if f.cw.n != f.entry.SourceSize {
+		return markError(ErrVerification, fmt.Errorf(
+			"%v: the delta rebuilt %v bytes, but the source has %v bytes", f.entry.Path, f.cw.n, f.entry.SourceSize,
+		))
+	}
+
+	return p.restoreAttrs(f.entry)
+}
+
+// close closes the file being rebuilt, if any, without checking it, after a failure.
+func (p *dirPatcher) close() error {
+	if p.file == nil {
+		return nil
+	}
+	err := p.file.close()
+	p.file = nil
+
+	return err
+}
+
+// copyFile copies an unchanged file from the target to the output, and checks its size.
+func (p *dirPatcher) copyFile(entry fileDeltaEntry) error {
+	target, err := openSequential(p.targetPath(entry.Path))
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	output, err := p.createOutput(entry.Path)
+	if err != nil {
+		return err
+	}
+	p.files[entry.Path] = true
+	n, err := io.Copy(p.app.withDirProgress(output, p.done), target)
+	err = errors.Join(err, output.Close())
+	p.done += n
+	if err != nil {
+		return err
+	}
+	if n != entry.SourceSize {
+		return markError(ErrVerification, fmt.Errorf(
+			"%v: the unchanged target file has %v bytes, but the source has %v bytes", entry.Path, n, entry.SourceSize,
+		))
+	}
+
+	return p.restoreAttrs(entry)
+}
+
+// restoreAttrs restores the recorded attributes of a rebuilt file.
+func (p *dirPatcher) restoreAttrs(entry fileDeltaEntry) error {
+	err := p.app.restoreAttrs(p.outputPath(entry.Path), entry)
+	if err != nil {
+		return fmt.Errorf("%v: restoring the file attributes: %w", entry.Path, err)
+	}
+
+	return nil
+}
+
+// createOutput creates the output file at the relative path, and its parent directories.
+func (p *dirPatcher) createOutput(name string) (*os.File, error) {
+	path := p.outputPath(name)
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+}
+
+func (p *dirPatcher) targetPath(name string) string {
+	return filepath.Join(p.targetRoot, filepath.FromSlash(name))
+}
+
+func (p *dirPatcher) outputPath(name string) string {
+	return filepath.Join(p.outputRoot, filepath.FromSlash(name))
+}
+
+// close closes the target and the output files, and gives back the block buffer.
+func (f *dirPatchFile) close() error {
+	var err error
+	if f.target != nil {
+		err = f.target.Close()
+		putBuffer(f.blockBuf)
+	}
+	if f.output != nil {
+		err = errors.Join(err, f.output.Close())
+	}
+
+	return err
+}
+
+// withDirProgress returns w reporting its writes, after the done bytes, to the configured progress function, if any.
+// The total is unknown, as the progress is reported while the directory delta is read.
+func (a *App) withDirProgress(w io.Writer, done int64) io.Writer {
+	if a.progress == nil {
+		return w
+	}
+
+	return &progressWriter{w: w, progress: Progress{Phase: "patch", Done: done}, fn: a.progress}
+}
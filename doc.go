@@ -6,7 +6,7 @@
 Package rdiff provides file diff between a source and a target, expressed as a collection of operations to be applied
 to the target in order to update its content to match the source.
 
-The public API exposes 3 operations: New, Signature and Delta
+The public API exposes 4 operations: New, Signature, Delta and Patch
 
 		// usage example:
 		//
@@ -27,6 +27,13 @@ The public API exposes 3 operations: New, Signature and Delta
 		if err != nil {
 			...
 		}
+		// target_file_path and delta_file_path must exist prior to this call
+		// output_file_path must not exist prior to this call
+		// output_file_path content will be the same as source_file_path content
+		err = rd.Patch("target_file_path", "delta_file_path", "output_file_path")
+		if err != nil {
+			...
+		}
 		...
 */
 package rdiff
@@ -0,0 +1,110 @@
+package rdiff
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ArtifactType identifies the content of a file written by the package.
+type ArtifactType byte
+
+const (
+	// ArtifactSignature is a signature, as written by App.Signature
+	ArtifactSignature ArtifactType = iota
+	// ArtifactDelta is a delta, as written by App.Delta
+	ArtifactDelta
+)
+
+// String returns the name of the artifact type.
+func (t ArtifactType) String() string {
+	switch t {
+	case ArtifactSignature:
+		return "signature"
+	case ArtifactDelta:
+		return "delta"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// Dump describes a signature or a delta, for inspection.
+type Dump struct {
+	Type ArtifactType
+	// SignatureHeader is the header of a signature, the zero value for a delta
+	SignatureHeader SignatureHeader
+	// Blocks is the number of blocks of a signature
+	Blocks int64
+	// DeltaHeader is the header of a delta, the zero value for a signature
+	DeltaHeader DeltaHeader
+	// Operations is the number of operations of a delta, indexed by their type
+	Operations [OpBlockPart + 1]int64
+	// LiteralBytes is the number of bytes of literal data carried by the operations of a delta
+	LiteralBytes int64
+	// ZeroBytes is the number of zero bytes of the zero runs of a delta
+	ZeroBytes int64
+}
+
+// DumpArtifact reads a signature or a delta, as written by App.Signature or App.Delta using the gob format,
+// detects which of them it is, and returns its description.
+// The delta operations are read one at a time and passed to fn, if not nil, in the delta order, so a delta is never
+// entirely in memory; the first non-nil error returned by fn is returned.
+// It returns a non-nil error if the content is neither a signature nor a delta, or if it's not valid, or if it exceeds
+// the default DecodeLimits.
+func DumpArtifact(r io.ReadSeeker, fn func(Operation) error) (Dump, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return Dump{}, err
+	}
+	// the gob type of the header tells the artifact type, a header of the other type doesn't decode
+	dec := gob.NewDecoder(DecodeLimits{}.signatureReader(bufio.NewReader(r)))
+	var header SignatureHeader
+	if dec.Decode(&header) == nil {
+		return dumpSignature(dec, header)
+	}
+	_, err = r.Seek(start, io.SeekStart)
+	if err != nil {
+		return Dump{}, err
+	}
+	d, err := newDeltaDecoder(bufio.NewReader(r), DecodeLimits{})
+	if err != nil {
+		return Dump{}, markError(ErrCorrupt, errors.New("the content is neither a signature nor a delta"))
+	}
+
+	return dumpDelta(d, fn)
+}
+
+// dumpSignature reads the table following the signature header.
+func dumpSignature(dec *gob.Decoder, header SignatureHeader) (Dump, error) {
+	t, err := readSignatureTable(dec, header, DecodeLimits{})
+	if err != nil {
+		return Dump{}, fmt.Errorf("reading the signature blocks: %w", err)
+	}
+
+	return Dump{Type: ArtifactSignature, SignatureHeader: header, Blocks: int64(t.len())}, nil
+}
+
+// dumpDelta reads the delta operations, counting them, and passes them to fn, if not nil.
+func dumpDelta(d *deltaDecoder, fn func(Operation) error) (Dump, error) {
+	dump := Dump{Type: ArtifactDelta, DeltaHeader: d.header}
+	err := d.forEach(func(op Operation) error {
+		if op.Type > OpBlockPart {
+			return markError(ErrCorrupt, fmt.Errorf("invalid operation type: %v", op.Type))
+		}
+		dump.Operations[op.Type]++
+		dump.LiteralBytes += int64(len(op.Data))
+		dump.ZeroBytes += op.Zeros
+		if fn == nil {
+			return nil
+		}
+
+		return fn(op)
+	})
+	if err != nil {
+		return Dump{}, err
+	}
+
+	return dump, nil
+}
@@ -0,0 +1,110 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDumpArtifact(t *testing.T) {
+	dir := t.TempDir()
+	target, source := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	sig, delta := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	if err := os.WriteFile(target, []byte{1, 2, 3, 4, 5, 6, 7}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(source, []byte{0, 1, 2, 3, 7, 8}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	app := New(3, WithStrongHash(StrongHashSHA1))
+	if err := app.Signature(target, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(sig, source, delta); err != nil {
+		t.Fatal(err)
+	}
+	sigData, _ := os.ReadFile(sig)
+	deltaData, _ := os.ReadFile(delta)
+
+	var ops []Operation
+	collect := func(op Operation) error {
+		ops = append(ops, op)
+		return nil
+	}
+	errFn := errors.New("fn error")
+	for _, tt := range []struct {
+		name    string
+		in      []byte
+		fn      func(Operation) error
+		out     Dump
+		outOps  []Operation
+		wantErr error
+	}{
+		{
+			name: "signature",
+			in:   sigData,
+			fn:   collect,
+			out: Dump{
+				Type:            ArtifactSignature,
+				SignatureHeader: SignatureHeader{StrongHash: StrongHashSHA1, StrongHashSize: 20, TargetSize: 7, BlockSize: 3},
+				Blocks:          3,
+			},
+		},
+		{
+			name: "delta",
+			in:   deltaData,
+			fn:   collect,
+			out: Dump{
+				Type:         ArtifactDelta,
+				DeltaHeader:  DeltaHeader{SourceSize: 6, TargetBlockSize: 3},
+				Operations:   [OpBlockPart + 1]int64{OpBlockUpdate: 1, OpBlockRemove: 2, OpBlockNew: 1},
+				LiteralBytes: 3,
+			},
+			outOps: []Operation{
+				{Type: OpBlockUpdate, BlockIndex: 0, Data: []byte{0}},
+				{Type: OpBlockRemove, BlockIndex: 1},
+				{Type: OpBlockRemove, BlockIndex: 2},
+				{Type: OpBlockNew, BlockIndex: -1, Data: []byte{7, 8}},
+			},
+		},
+		{name: "delta without fn", in: deltaData, out: Dump{
+			Type:         ArtifactDelta,
+			DeltaHeader:  DeltaHeader{SourceSize: 6, TargetBlockSize: 3},
+			Operations:   [OpBlockPart + 1]int64{OpBlockUpdate: 1, OpBlockRemove: 2, OpBlockNew: 1},
+			LiteralBytes: 3,
+		}},
+		{name: "fn error", in: deltaData, fn: func(Operation) error { return errFn }, wantErr: errFn},
+		{name: "truncated signature", in: sigData[:len(sigData)-5], wantErr: errAny},
+		{name: "unknown", in: []byte("not an artifact"), wantErr: errAny},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ops = nil
+			// the artifact doesn't start at the beginning of the reader
+			r := bytes.NewReader(append([]byte("prefix"), tt.in...))
+			_, _ = r.Seek(int64(len("prefix")), 0)
+			got, err := DumpArtifact(r, tt.fn)
+			if tt.wantErr != nil {
+				if err == nil || (tt.wantErr != errAny && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("DumpArtifact() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DumpArtifact() error = %v", err)
+			}
+			if diff := cmp.Diff(got, tt.out); diff != "" {
+				t.Errorf("DumpArtifact() differs, \nDIFF: %v", diff)
+			}
+			if diff := cmp.Diff(ops, tt.outOps); diff != "" {
+				t.Errorf("DumpArtifact() operations differ, \nDIFF: %v", diff)
+			}
+		})
+	}
+}
+
+// errAny matches any non-nil error.
+var errAny = errors.New("any error")
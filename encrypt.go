@@ -0,0 +1,322 @@
+package rdiff
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// encryptionPassphrase and encryptionX25519 identify how the key of an encrypted delta is derived: from a
+	// passphrase, using scrypt, or from the X25519 key agreement of an ephemeral key and the recipient's key
+	encryptionPassphrase byte = 1
+	encryptionX25519     byte = 2
+	// encryptionChunkSize is the size of the plaintext chunks sealed one at a time, so the deltas are encrypted, and
+	// decrypted, while they're streamed
+	encryptionChunkSize = 64 << 10
+	// scryptLogN is the scrypt cost of the passphrases, and maxScryptLogN is the highest one accepted when decrypting,
+	// so a crafted delta can't exhaust the memory
+	scryptLogN    = 16
+	maxScryptLogN = 22
+	saltSize      = 16
+)
+
+// encryptionMagic starts every encrypted delta, followed by the version of the container.
+var encryptionMagic = []byte("rdiffenc\x01")
+
+// encryptionInfo binds the keys derived from the X25519 key agreement to their use.
+var encryptionInfo = []byte("rdiff delta encryption")
+
+// encryptedOutput returns the writer of a delta written to w, and the function completing it, encrypting it if the
+// App is configured using WithRecipient, or WithPassphrase. Otherwise, it returns w, and a no-op function.
+func (a *App) encryptedOutput(w io.Writer) (io.Writer, func() error, error) {
+	var header []byte
+	var key []byte
+	var err error
+	switch {
+	case a.recipient != nil:
+		header, key, err = x25519EncryptionKey(a.recipient)
+	case a.passphrase != nil:
+		header, key, err = passphraseEncryptionKey(a.passphrase)
+	default:
+		return w, func() error { return nil }, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newDeltaAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = w.Write(append(bytes.Clone(encryptionMagic), header...))
+	if err != nil {
+		return nil, nil, err
+	}
+	ew := &encryptingWriter{w: w, aead: aead}
+
+	return ew, ew.close, nil
+}
+
+// x25519EncryptionKey returns the header of a delta encrypted to the recipient, holding an ephemeral public key, and
+// the key derived from its agreement with the recipient's key.
+func x25519EncryptionKey(recipient *ecdh.PublicKey) ([]byte, []byte, error) {
+	if recipient.Curve() != ecdh.X25519() {
+		return nil, nil, errors.New("the recipient key is not an X25519 key")
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	public := ephemeral.PublicKey().Bytes()
+	key, err := deriveX25519Key(shared, public, recipient.Bytes())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return append([]byte{encryptionX25519}, public...), key, nil
+}
+
+// deriveX25519Key derives the key of a delta from the shared secret of the ephemeral and the recipient's keys.
+func deriveX25519Key(shared, ephemeral, recipient []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, shared, append(bytes.Clone(ephemeral), recipient...), encryptionInfo), key)
+
+	return key, err
+}
+
+// passphraseEncryptionKey returns the header of a delta encrypted using the passphrase, holding the scrypt cost and
+// a random salt, and the key derived from the passphrase.
+func passphraseEncryptionKey(passphrase []byte) ([]byte, []byte, error) {
+	header := make([]byte, 2+saltSize)
+	header[0], header[1] = encryptionPassphrase, scryptLogN
+	_, err := rand.Read(header[2:])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := scrypt.Key(passphrase, header[2:], 1<<scryptLogN, 8, 1, 32)
+
+	return header, key, err
+}
+
+// newDeltaAEAD returns the AES-256-GCM cipher sealing the chunks of a delta.
+func newDeltaAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce returns the nonce of the chunk n of a delta: its big endian index, followed by a byte flagging the last
+// chunk, so the chunks can't be reordered, dropped, or truncated.
+func chunkNonce(aead cipher.AEAD, n uint64, last bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], n)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+
+	return nonce
+}
+
+// encryptingWriter seals the delta written to it in chunks of encryptionChunkSize bytes, the last one, which may be
+// shorter, or empty, being sealed by close.
+type encryptingWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+}
+
+// Write buffers p, and seals the complete chunks, except for the last one, which may be the last chunk of the delta.
+func (e *encryptingWriter) Write(p []byte) (int, error) {
+	e.buf = append(e.buf, p...)
+	for len(e.buf) > encryptionChunkSize {
+		err := e.seal(e.buf[:encryptionChunkSize], false)
+		if err != nil {
+			return 0, err
+		}
+		e.buf = append(e.buf[:0], e.buf[encryptionChunkSize:]...)
+	}
+
+	return len(p), nil
+}
+
+// close seals the last chunk.
+func (e *encryptingWriter) close() error {
+	err := e.seal(e.buf, true)
+	e.buf = nil
+
+	return err
+}
+
+// seal encrypts the chunk, and writes it.
+func (e *encryptingWriter) seal(chunk []byte, last bool) error {
+	_, err := e.w.Write(e.aead.Seal(nil, chunkNonce(e.aead, e.counter, last), chunk, nil))
+	e.counter++
+
+	return err
+}
+
+// decryptedInput returns the reader of the delta r, decrypting it if it's encrypted, using the key configured by
+// WithIdentity, or by WithPassphrase. An encrypted delta which can't be decrypted using it returns a non-nil error
+// matching ErrVerification, and so does a delta which is not encrypted, if a key is configured, so a delta can't
+// skip the authentication by being sent in clear.
+// The magic is read without reading ahead, so the delta is read as it is if it's not encrypted, and no key is
+// configured.
+func (a *App) decryptedInput(r io.Reader) (io.Reader, error) {
+	magic := make([]byte, len(encryptionMagic))
+	n, err := io.ReadFull(r, magic)
+	encrypted := err == nil && bytes.Equal(magic, encryptionMagic)
+	if !encrypted && (a.identity != nil || a.passphrase != nil) {
+		return nil, markError(ErrVerification, errors.New("the delta is not encrypted, and a decryption key is configured"))
+	}
+	if !encrypted {
+		return io.MultiReader(bytes.NewReader(magic[:n]), &errReader{err: err, r: r}), nil
+	}
+	br := bufio.NewReader(r)
+	key, err := a.decryptionKey(br)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newDeltaAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptingReader{r: br, aead: aead, chunk: make([]byte, encryptionChunkSize+aead.Overhead())}, nil
+}
+
+// decryptionKey reads the header of an encrypted delta, following its magic, and derives its key.
+func (a *App) decryptionKey(r io.Reader) ([]byte, error) {
+	mode := make([]byte, 1)
+	_, err := io.ReadFull(r, mode)
+	if err != nil {
+		return nil, markError(ErrCorrupt, fmt.Errorf("reading the encryption header: %w", err))
+	}
+	switch {
+	case mode[0] == encryptionX25519 && a.identity != nil:
+		return a.x25519DecryptionKey(r)
+	case mode[0] == encryptionPassphrase && a.passphrase != nil:
+		return a.passphraseDecryptionKey(r)
+	case mode[0] == encryptionX25519 || mode[0] == encryptionPassphrase:
+		return nil, markError(ErrVerification, errors.New("the delta is encrypted, and its key is not configured"))
+	default:
+		return nil, markError(ErrCorrupt, fmt.Errorf("unknown delta encryption: %v", mode[0]))
+	}
+}
+
+// x25519DecryptionKey reads the ephemeral public key of a delta encrypted to the identity's public key, and derives
+// its key.
+func (a *App) x25519DecryptionKey(r io.Reader) ([]byte, error) {
+	public := make([]byte, 32)
+	_, err := io.ReadFull(r, public)
+	if err != nil {
+		return nil, markError(ErrCorrupt, fmt.Errorf("reading the encryption header: %w", err))
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(public)
+	if err != nil {
+		return nil, markError(ErrCorrupt, err)
+	}
+	shared, err := a.identity.ECDH(ephemeral)
+	if err != nil {
+		return nil, markError(ErrVerification, err)
+	}
+
+	return deriveX25519Key(shared, public, a.identity.PublicKey().Bytes())
+}
+
+// passphraseDecryptionKey reads the scrypt cost and the salt of a delta encrypted using the passphrase, and derives
+// its key.
+func (a *App) passphraseDecryptionKey(r io.Reader) ([]byte, error) {
+	header := make([]byte, 1+saltSize)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, markError(ErrCorrupt, fmt.Errorf("reading the encryption header: %w", err))
+	}
+	if header[0] == 0 || header[0] > maxScryptLogN {
+		return nil, markError(ErrCorrupt, fmt.Errorf("invalid scrypt cost: %v", header[0]))
+	}
+
+	return scrypt.Key(a.passphrase, header[1:], 1<<header[0], 8, 1, 32)
+}
+
+// errReader returns the error of the read of a delta's magic, if any, otherwise it reads the rest of the delta from r.
+type errReader struct {
+	err error
+	r   io.Reader
+}
+
+// Read reads from r, unless the magic couldn't be read: its error is returned, io.ErrUnexpectedEOF standing for
+// io.EOF, as the delta ends before its magic.
+func (e *errReader) Read(p []byte) (int, error) {
+	switch {
+	case e.err == nil:
+		return e.r.Read(p)
+	case errors.Is(e.err, io.ErrUnexpectedEOF):
+		return 0, io.EOF
+	default:
+		return 0, e.err
+	}
+}
+
+// decryptingReader opens the chunks of an encrypted delta, as they're read.
+type decryptingReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	chunk   []byte
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+// Read returns the plaintext of the chunks, which are authenticated before any of their content is returned.
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		err := d.open()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+
+	return n, nil
+}
+
+// open reads and authenticates the next chunk, which is the last one if the delta ends after it.
+func (d *decryptingReader) open() error {
+	n, err := io.ReadFull(d.r, d.chunk)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	_, peekErr := d.r.Peek(1)
+	last := errors.Is(peekErr, io.EOF)
+	plain, err := d.aead.Open(d.chunk[:0], chunkNonce(d.aead, d.counter, last), d.chunk[:n], nil)
+	if err != nil {
+		return markError(ErrVerification, fmt.Errorf("decrypting the chunk %v of the delta: %w", d.counter, err))
+	}
+	d.counter++
+	d.plain, d.done = plain, last
+
+	return nil
+}
@@ -0,0 +1,167 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testIdentity returns the X25519 key derived from the seed byte.
+func testIdentity(t *testing.T, seed byte) *ecdh.PrivateKey {
+	t.Helper()
+	key, err := ecdh.X25519().NewPrivateKey(bytes.Repeat([]byte{seed}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestEncryptingWriter(t *testing.T) {
+	for _, size := range []int{0, 1, encryptionChunkSize, encryptionChunkSize + 1, 3 * encryptionChunkSize} {
+		data := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(data)
+		var buf bytes.Buffer
+		app := New(64, WithRecipient(testIdentity(t, 1).PublicKey()), WithIdentity(testIdentity(t, 1)))
+		w, seal, err := app.encryptedOutput(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the writes straddle the chunks
+		for p := data; len(p) > 0; p = p[min(len(p), 1000):] {
+			if _, err := w.Write(p[:min(len(p), 1000)]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := seal(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := app.decryptedInput(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got bytes.Buffer
+		if _, err := got.ReadFrom(r); err != nil || !bytes.Equal(got.Bytes(), data) {
+			t.Errorf("size %v: the decrypted data differs, error = %v", size, err)
+		}
+	}
+}
+
+func TestApp_WithPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := make([]byte, 200<<10)
+	rand.New(rand.NewSource(1)).Read(target)
+	secret := []byte("a secret change")
+	source := append(bytes.Clone(target[:100<<10]), secret...)
+	source = append(source, target[100<<10:]...)
+	for name, data := range map[string][]byte{"target": target, "source": source} {
+		if err := os.WriteFile(path(name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := New(1024).Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	signatureBytes, err := os.ReadFile(path("signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity := testIdentity(t, 1)
+	signingKey := testSigningKey(1)
+
+	tests := []struct {
+		name   string
+		writer *App
+		reader *App
+	}{
+		{name: "passphrase", writer: New(1024, WithPassphrase("secret")), reader: New(1024, WithPassphrase("secret"))},
+		{name: "recipient", writer: New(1024, WithRecipient(identity.PublicKey())), reader: New(1024, WithIdentity(identity))},
+		{
+			name:   "signed",
+			writer: New(1024, WithPassphrase("secret"), WithSigningKey(signingKey)),
+			reader: New(1024, WithPassphrase("secret"), WithVerifyKey(signingKey.Public().(ed25519.PublicKey))),
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, out := path(tt.name+".delta"), path(tt.name+".out")
+			if err := tt.writer.Delta(path("signature"), path("source"), delta); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.reader.Patch(path("target"), delta, out); err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(out); !bytes.Equal(got, source) {
+				t.Error("Patch() doesn't rebuild the source")
+			}
+			encrypted, err := os.ReadFile(delta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(encrypted, secret) {
+				t.Error("the delta holds the plaintext")
+			}
+			var applied bytes.Buffer
+			if err := tt.reader.Apply(bytes.NewReader(target), int64(len(target)), bytes.NewReader(encrypted), &applied); err != nil || !bytes.Equal(applied.Bytes(), source) {
+				t.Errorf("Apply() doesn't rebuild the source, error = %v", err)
+			}
+			// nor apply a delta which is not encrypted
+			var plain bytes.Buffer
+			if err := New(1024).DeltaStream(bytes.NewReader(signatureBytes), bytes.NewReader(source), int64(len(source)), &plain); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.reader.Apply(bytes.NewReader(target), int64(len(target)), &plain, &bytes.Buffer{}); !errors.Is(err, ErrVerification) {
+				t.Errorf("Apply() of a delta which is not encrypted error = %v, want %v", err, ErrVerification)
+			}
+			// the other configurations can't decrypt it
+			other := tests[(i+1)%len(tests)].reader
+			if err := other.Apply(bytes.NewReader(target), int64(len(target)), bytes.NewReader(encrypted), &bytes.Buffer{}); !errors.Is(err, ErrVerification) {
+				t.Errorf("Apply() using another key error = %v, want %v", err, ErrVerification)
+			}
+		})
+	}
+}
+
+func TestApp_WithPassphrase_Errors(t *testing.T) {
+	target := make([]byte, 200<<10)
+	rand.New(rand.NewSource(1)).Read(target)
+	var signature, delta bytes.Buffer
+	if err := New(1024).SignatureAt(bytes.NewReader(target), int64(len(target)), &signature); err != nil {
+		t.Fatal(err)
+	}
+	app := New(1024, WithPassphrase("secret"))
+	if err := app.DeltaStream(&signature, bytes.NewReader(target), int64(len(target)), &delta); err != nil {
+		t.Fatal(err)
+	}
+	header := len(encryptionMagic) + 2 + saltSize
+
+	tests := []struct {
+		name  string
+		app   *App
+		delta []byte
+		want  error
+	}{
+		{name: "wrong passphrase", app: New(1024, WithPassphrase("other")), delta: delta.Bytes(), want: ErrVerification},
+		{name: "no key", app: New(1024), delta: delta.Bytes(), want: ErrVerification},
+		{name: "truncated", app: app, delta: delta.Bytes()[:delta.Len()-1], want: ErrVerification},
+		{name: "truncated header", app: app, delta: delta.Bytes()[:header-1], want: ErrCorrupt},
+		{name: "altered", app: app, delta: func() []byte {
+			d := bytes.Clone(delta.Bytes())
+			d[header] ^= 0xFF
+			return d
+		}(), want: ErrVerification},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.app.Apply(bytes.NewReader(target), int64(len(target)), bytes.NewReader(tt.delta), &bytes.Buffer{})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Apply() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
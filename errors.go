@@ -0,0 +1,86 @@
+package rdiff
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCorrupt is matched, using errors.Is, by the errors caused by a malformed signature or delta: a truncated
+	// content, an unknown encoding, or values which are out of range, ex: a block index beyond the target size.
+	ErrCorrupt = errors.New("corrupt input")
+	// ErrVerification is matched, using errors.Is, by the errors caused by an input which is well formed, but
+	// doesn't verify: a signature computed using other hash algorithms, or another key, than the configured ones,
+	// a patch output which doesn't have the size recorded by the delta, or a target which doesn't match the signature
+	// the delta was computed against, see WithBasisCheck.
+	ErrVerification = errors.New("verification failed")
+	// ErrModified is matched, using errors.Is, by the errors of a Signature, Delta or Patch call whose input file
+	// was modified while it was read, so its output is useless: the size or the modification time of the file
+	// changed, or the number of bytes read doesn't match its size.
+	ErrModified = errors.New("input modified")
+	// ErrNoChanges is returned by a Delta call configured using WithSkipUnchanged, for a source which equals the
+	// target, instead of writing a delta which is a no-op.
+	ErrNoChanges = errors.New("no changes")
+)
+
+// kindError classifies err as one of the Err* sentinels, keeping its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+// markError returns err classified as kind, or nil if err is nil.
+func markError(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &kindError{kind: kind, err: err}
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// ApplyError is returned by a patch which failed once it started writing its output, ex: on an IO error, or on an
+// output which doesn't verify, it records how far the patch got, and whether the output was restored to its state
+// before the patch: a new output file is removed, and a target patched in place is rolled back using its journal.
+// It matches the error failing the patch, using errors.Is and errors.As.
+type ApplyError struct {
+	// Written is the number of output bytes written before the failure
+	Written int64
+	// Size is the size of the complete output, -1 if it's unknown, ex: for a librsync delta
+	Size int64
+	// RolledBack means the output was restored to its state before the patch
+	RolledBack bool
+	// RollbackErr is the error restoring the output, or removing the journal once it's restored, if any, a journal
+	// which is kept being recovered by RollForwardPatch or RollBackPatch
+	RollbackErr error
+	// Err is the error failing the patch
+	Err error
+	// inPlace means the output is a target patched in place, so it existed before the patch
+	inPlace bool
+}
+
+func (e *ApplyError) Error() string {
+	msg := fmt.Sprintf("the patch failed after writing %v bytes: %v", e.Written, e.Err)
+	switch {
+	case e.RollbackErr != nil:
+		msg += fmt.Sprintf(", restoring the output failed: %v", e.RollbackErr)
+	case e.RolledBack && e.inPlace:
+		msg += ", the target was rolled back"
+	case e.RolledBack && e.Written > 0:
+		// a new output didn't exist before the patch, so it's not restored, its partial content is removed
+		msg += ", the partial output was removed"
+	}
+
+	return msg
+}
+
+func (e *ApplyError) Unwrap() []error {
+	return []error{e.Err, e.RollbackErr}
+}
@@ -0,0 +1,91 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/silviutanasa/rdiff/rollsum"
+)
+
+func TestMarkError(t *testing.T) {
+	if err := markError(ErrCorrupt, nil); err != nil {
+		t.Errorf("markError(nil) = %v, want nil", err)
+	}
+	err := markError(ErrCorrupt, io.ErrUnexpectedEOF)
+	if err.Error() != io.ErrUnexpectedEOF.Error() {
+		t.Errorf("markError() message = %q, want %q", err.Error(), io.ErrUnexpectedEOF.Error())
+	}
+	if !errors.Is(err, ErrCorrupt) || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("markError() must match both the kind and the error")
+	}
+	if errors.Is(err, ErrVerification) {
+		t.Errorf("markError() must match only its kind")
+	}
+}
+
+func TestApplyError_Error(t *testing.T) {
+	failed := errors.New("failed")
+	for _, tt := range []struct {
+		err  *ApplyError
+		want string
+	}{
+		{err: &ApplyError{Err: failed, RolledBack: true}, want: "the patch failed after writing 0 bytes: failed"},
+		{err: &ApplyError{Written: 3, Err: failed, RolledBack: true}, want: "the patch failed after writing 3 bytes: failed, the partial output was removed"},
+		{err: &ApplyError{Err: failed, RolledBack: true, inPlace: true}, want: "the patch failed after writing 0 bytes: failed, the target was rolled back"},
+		{err: &ApplyError{Written: 3, Err: failed, RollbackErr: io.ErrClosedPipe}, want: "the patch failed after writing 3 bytes: failed, restoring the output failed: io: read/write on closed pipe"},
+	} {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	delta := deltaBytes(t, DeltaHeader{SourceSize: 3}, []Operation{{Type: OpBlockNew, BlockIndex: -1, Data: []byte{1, 2, 3}}})
+	var signature bytes.Buffer
+	if err := writeSignature(&signature, SignatureHeader{StrongHashSize: md5.Size}, signatureTable{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		fn   func() error
+		kind error
+	}{
+		{name: "empty signature", fn: func() error {
+			_, _, err := ReadSignature(bytes.NewReader(nil))
+			return err
+		}, kind: ErrCorrupt},
+		{name: "truncated signature", fn: func() error {
+			_, _, err := ReadSignature(bytes.NewReader(signature.Bytes()[:signature.Len()-1]))
+			return err
+		}, kind: ErrCorrupt},
+		{name: "truncated delta", fn: func() error {
+			_, _, err := ReadDelta(bytes.NewReader(delta[:len(delta)-1]))
+			return err
+		}, kind: ErrCorrupt},
+		{name: "librsync signature magic", fn: func() error {
+			_, _, _, err := readSignatureLibrsync(bytes.NewReader([]byte{0, 0, 0, 1, 0, 0, 0, 8, 0, 0, 0, 8}), DecodeLimits{})
+			return err
+		}, kind: ErrCorrupt},
+		{name: "librsync delta magic", fn: func() error {
+			return newRDiff(3, rollsum.NewAdler32(), md5.New()).applyLibrsync(bytes.NewReader(nil), 0, bytes.NewReader([]byte{0, 0, 0, 1}), io.Discard)
+		}, kind: ErrCorrupt},
+		{name: "signature key", fn: func() error {
+			r := newRDiff(3, rollsum.NewAdler32(), md5.New())
+			return r.negotiateSignatureHeader(SignatureHeader{StrongHashSize: md5.Size, StrongHashKeyID: strongHashKeyID([]byte("secret"))})
+		}, kind: ErrVerification},
+		{name: "pinned weak hash", fn: func() error {
+			r := newRDiff(3, rollsum.NewAdler32(), md5.New())
+			r.weakHashPinned = true
+			return r.negotiateSignatureHeader(SignatureHeader{WeakHash: WeakHashRabin, StrongHashSize: md5.Size})
+		}, kind: ErrVerification},
+	} {
+		err := tt.fn()
+		if !errors.Is(err, tt.kind) {
+			t.Errorf("%v: error = %v, want a %v error", tt.name, err, tt.kind)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package rdiff
+
+import (
+	"errors"
+	"io"
+)
+
+// DeltaEstimate is the projection of the delta of a source, computed by EstimateDelta.
+type DeltaEstimate struct {
+	DeltaStats
+	// SourceSize is the size of the source, in bytes
+	SourceSize int64
+	// DeltaSize is the size of the delta, in bytes, in the configured format
+	DeltaSize int64
+}
+
+// MatchRatio returns the fraction of the source bytes found in the target, 1 for an empty source.
+func (e DeltaEstimate) MatchRatio() float64 {
+	if e.SourceSize <= 0 {
+		return 1
+	}
+
+	return float64(e.SourceSize-e.LiteralBytes-e.ZeroBytes) / float64(e.SourceSize)
+}
+
+// DeltaRatio returns the delta size relative to the source size, 0 for an empty source, so a value close to, or
+// above, 1 means the full transfer of the source is cheaper than the delta.
+func (e DeltaEstimate) DeltaRatio() float64 {
+	if e.SourceSize <= 0 {
+		return 0
+	}
+
+	return float64(e.DeltaSize) / float64(e.SourceSize)
+}
+
+// EstimateDelta computes the delta of the source file(sourceFilePath) against the signature file(signaturePath),
+// the same way Delta does, but the delta is only counted, instead of being written, so a sync can decide between
+// the delta and the full transfer, before writing and shipping anything. The estimate is exact, the memory used
+// being the same as Delta's, see WithMaxMemory.
+// The checkpoints are not used, and LastDeltaStats reports the estimate's stats.
+func (a *App) EstimateDelta(signaturePath string, sourceFilePath string) (DeltaEstimate, error) {
+	err := a.diffEngine.checkHashers()
+	if err != nil {
+		return DeltaEstimate{}, err
+	}
+	signatureFile, err := a.openSignature(signaturePath)
+	if err != nil {
+		return DeltaEstimate{}, err
+	}
+	defer signatureFile.Close()
+	sourceFile, err := openSequential(sourceFilePath)
+	if err != nil {
+		return DeltaEstimate{}, err
+	}
+	snapshot, err := newInputSnapshot(sourceFile)
+	if err != nil {
+		return DeltaEstimate{}, errors.Join(err, sourceFile.Close())
+	}
+
+	sourceSize := snapshot.info.Size()
+	source, release := a.inputReader(sourceFile, sourceSize)
+	source = a.withReadProgress(snapshot.reader(source), "estimate", sourceSize)
+	cw := &countingWriter{w: io.Discard}
+	err = a.delta(signatureFile, source, DeltaHeader{SourceSize: sourceSize}, cw)
+	if err == nil {
+		err = snapshot.check()
+	}
+	err = errors.Join(err, release(), sourceFile.Close())
+	if err != nil {
+		return DeltaEstimate{}, err
+	}
+
+	return DeltaEstimate{DeltaStats: a.diffEngine.stats, SourceSize: sourceSize, DeltaSize: cw.n}, nil
+}
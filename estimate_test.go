@@ -0,0 +1,78 @@
+package rdiff
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApp_EstimateDelta(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	rnd := rand.New(rand.NewSource(1))
+	target := make([]byte, 10000)
+	rnd.Read(target)
+	source := append(append([]byte{}, target[:6000]...), make([]byte, 2000)...)
+	rnd.Read(source[6000:])
+	for name, content := range map[string][]byte{"target": target, "source": source, "empty": nil} {
+		if err := os.WriteFile(path(name), content, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		source string
+		format Format
+	}{
+		{name: "gob", source: "source", format: FormatGob},
+		{name: "json", source: "source", format: FormatJSON},
+		{name: "vcdiff", source: "source", format: FormatVCDIFF},
+		{name: "empty source", source: "empty", format: FormatGob},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, delta := path(tt.name+".sig"), path(tt.name+".delta")
+			if err := New(100).Signature(path("target"), sig); err != nil {
+				t.Fatal(err)
+			}
+			app := New(100, WithFormat(tt.format))
+			if err := app.Delta(sig, path(tt.source), delta); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(delta)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := New(100, WithFormat(tt.format)).EstimateDelta(sig, path(tt.source))
+			if err != nil {
+				t.Fatalf("EstimateDelta() error = %v", err)
+			}
+			want := DeltaEstimate{DeltaStats: app.LastDeltaStats(), SourceSize: int64(len(source)), DeltaSize: info.Size()}
+			if tt.source == "empty" {
+				want.SourceSize = 0
+			}
+			if got != want {
+				t.Errorf("EstimateDelta() = %+v, want %+v", got, want)
+			}
+		})
+	}
+
+	got, err := New(100).EstimateDelta(path("gob.sig"), path("source"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ratio := got.MatchRatio(); ratio != 0.75 {
+		t.Errorf("MatchRatio() = %v, want 0.75", ratio)
+	}
+	if ratio := got.DeltaRatio(); ratio <= 0.25 || ratio >= 0.5 {
+		t.Errorf("DeltaRatio() = %v, want in (0.25, 0.5)", ratio)
+	}
+	if ratio := (DeltaEstimate{}).MatchRatio(); ratio != 1 {
+		t.Errorf("MatchRatio() of an empty source = %v, want 1", ratio)
+	}
+	if _, err := New(100).EstimateDelta(path("missing"), path("source")); err == nil {
+		t.Errorf("EstimateDelta() of a missing signature error = nil, want an error")
+	}
+}
@@ -1,7 +1,6 @@
 package rdiff_test
 
 import (
-	"encoding/gob"
 	"fmt"
 	"log"
 	"os"
@@ -43,10 +42,12 @@ func ExampleNew() {
 	defer os.Remove("test_delta")
 	defer delta.Close()
 
-	var ops []rdiff.Operation
-	gob.NewDecoder(delta).Decode(&ops)
+	_, ops, err := rdiff.ReadDelta(delta)
+	if err != nil {
+		log.Fatal(err)
+	}
 	fmt.Println(ops)
 
 	// Output:
-	// [{1 0 [12 32]} {0 1 []} {2 2 []} {3 -1 [7 8]}]
+	// [{update 0 [12 32] 0} {keep 1 [] 0} {remove 2 [] 0} {new -1 [7 8] 0}]
 }
@@ -0,0 +1,73 @@
+package rdiff
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// ExpvarName is the name of the expvar variable published by PublishExpvar.
+const ExpvarName = "rdiff"
+
+var (
+	expvarOnce    sync.Once
+	expvarEnabled atomic.Bool
+	// the counters published by PublishExpvar, shared by all the Apps
+	expvarFiles     expvar.Int
+	expvarBytesRead expvar.Int
+	expvarDeltas    expvar.Int
+	expvarErrors    expvar.Map
+)
+
+// PublishExpvar publishes the cumulative counters of the Signature, SignatureAt, Delta, DeltaStream, Patch and Apply
+// calls of all the Apps, from now on, as the expvar map variable ExpvarName, served by the /debug/vars handler of the
+// expvar package, so a service embedding rdiff gets basic diagnostics without any dependency:
+//   - files_processed: the number of calls, successful or not
+//   - bytes_read: the bytes of the targets hashed by the signatures, of the sources hashed by the deltas, and of the
+//     targets copied by the patches
+//   - deltas_produced: the number of deltas written, a delta skipped as unchanged not being one
+//   - errors: the number of failed calls, by type: "corrupt", "verification" and "modified", for the errors matching
+//     ErrCorrupt, ErrVerification and ErrModified, and "other"
+//
+// It can be called more than once, the counters being published once. It panics if another variable is published
+// as ExpvarName. By default, the calls are not counted.
+func PublishExpvar() {
+	expvarOnce.Do(func() {
+		m := expvar.NewMap(ExpvarName)
+		m.Set("files_processed", &expvarFiles)
+		m.Set("bytes_read", &expvarBytesRead)
+		m.Set("deltas_produced", &expvarDeltas)
+		m.Set("errors", expvarErrors.Init())
+		expvarEnabled.Store(true)
+	})
+}
+
+// countExpvar adds the metrics of a call to the counters published by PublishExpvar.
+func countExpvar(m Metrics) {
+	expvarFiles.Add(1)
+	expvarBytesRead.Add(m.InputBytes)
+	switch {
+	case m.Err == nil:
+		if m.Op == "delta" {
+			expvarDeltas.Add(1)
+		}
+	case errors.Is(m.Err, ErrNoChanges):
+	default:
+		expvarErrors.Add(errorType(m.Err), 1)
+	}
+}
+
+// errorType returns the type of err, the errors counter it's added to.
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, ErrCorrupt):
+		return "corrupt"
+	case errors.Is(err, ErrVerification):
+		return "verification"
+	case errors.Is(err, ErrModified):
+		return "modified"
+	default:
+		return "other"
+	}
+}
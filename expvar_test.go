@@ -0,0 +1,66 @@
+package rdiff
+
+import (
+	"bytes"
+	"expvar"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	for name, data := range map[string][]byte{"target": target, "corrupt": []byte("not a delta")} {
+		if err := os.WriteFile(path(name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	PublishExpvar()
+	PublishExpvar()
+	counters := func() map[string]int64 {
+		m := expvar.Get(ExpvarName).(*expvar.Map)
+		out := make(map[string]int64)
+		m.Do(func(kv expvar.KeyValue) {
+			out[kv.Key], _ = strconv.ParseInt(kv.Value.String(), 10, 64)
+		})
+		m.Get("errors").(*expvar.Map).Do(func(kv expvar.KeyValue) {
+			out["errors."+kv.Key], _ = strconv.ParseInt(kv.Value.String(), 10, 64)
+		})
+		return out
+	}
+	before := counters()
+
+	app := New(64, WithSkipUnchanged(true))
+	if err := app.Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(64).Delta(path("signature"), path("target"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(path("signature"), path("target"), path("unchanged")); err == nil {
+		t.Fatal("Delta() of an unchanged source error = nil, want ErrNoChanges")
+	}
+	if err := app.Patch(path("target"), path("corrupt"), path("out")); err == nil {
+		t.Fatal("Patch() of a corrupt delta error = nil, want an error")
+	}
+	if err := app.Delta(path("signature"), path("missing"), path("delta2")); err == nil {
+		t.Fatal("Delta() of a missing source error = nil, want an error")
+	}
+
+	after := counters()
+	for k, want := range map[string]int64{
+		"files_processed":     5,
+		"bytes_read":          3 * int64(len(target)),
+		"deltas_produced":     1,
+		"errors.corrupt":      1,
+		"errors.other":        1,
+		"errors.verification": 0,
+	} {
+		if got := after[k] - before[k]; got != want {
+			t.Errorf("the counter %v increased by %v, want %v", k, got, want)
+		}
+	}
+}
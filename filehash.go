@@ -0,0 +1,76 @@
+package rdiff
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// fileHasher returns the strong hasher of the whole target, or nil if the App is not configured using WithFileHash.
+func (a *App) fileHasher() (hash.Hash, error) {
+	if !a.fileHash {
+		return nil, nil
+	}
+
+	return newStrongHash(a.diffEngine.strongHashType, a.diffEngine.strongHashKey)
+}
+
+// fileHashAt returns the strong hash of the whole target, which has the given size, or nil if the App is not
+// configured using WithFileHash.
+func (a *App) fileHashAt(target io.ReaderAt, targetSize int64) ([]byte, error) {
+	h, err := a.fileHasher()
+	if err != nil || h == nil {
+		return nil, err
+	}
+	_, err = io.Copy(h, io.NewSectionReader(target, 0, targetSize))
+	if err != nil {
+		return nil, fmt.Errorf("hashing the target: %w", err)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// sameSource reports whether the source file, of sourceSize bytes, has the content of the target described by the
+// signature header, by hashing it whole, if the App is configured using WithFileHash, and the header records the
+// target hash and size. The source is read by offset, so the delta computation can read it again, from its start.
+func (a *App) sameSource(header SignatureHeader, source *os.File, sourceSize int64) (bool, error) {
+	if !a.fileHash || len(header.FileHash) == 0 || header.TargetSize != sourceSize {
+		return false, nil
+	}
+	h, err := newStrongHash(header.StrongHash, a.diffEngine.strongHashKey)
+	if err != nil {
+		return false, err
+	}
+	reader := a.withReadProgress(io.NewSectionReader(source, 0, sourceSize), "delta", sourceSize)
+	n, err := io.Copy(h, reader)
+	if err != nil {
+		return false, fmt.Errorf("hashing the source: %w", err)
+	}
+	if n != sourceSize {
+		return false, markError(ErrModified, fmt.Errorf("%v was modified while it was read", source.Name()))
+	}
+
+	return bytes.Equal(h.Sum(nil), header.FileHash), nil
+}
+
+// keepAll passes to emit the delta of a source equal to the target of the signature: every target block is kept.
+// The header is negotiated first, and the stats are updated, the same way ComputeDeltaFunc does.
+func (r *rDiff) keepAll(header SignatureHeader, signature signatureTable, emit func(Operation) error) error {
+	_, err := r.negotiated(header)
+	if err != nil {
+		return err
+	}
+	r.stats = DeltaStats{}
+	emit = r.countingEmit(emit)
+	for i := 0; i < signature.len(); i++ {
+		err = emit(Operation{Type: OpBlockKeep, BlockIndex: int64(i)})
+		if err != nil {
+			return err
+		}
+	}
+	r.stats.Unchanged = r.stats.unchanged(int64(signature.len()))
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/md5"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApp_WithFileHash(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	changed := bytes.Clone(content)
+	changed[100] = 'x'
+	for name, data := range map[string][]byte{"target": content, "same": content, "changed": changed} {
+		if err := os.WriteFile(path(name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := New(64, WithFileHash(true)).Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(64).Signature(path("target"), path("no_hash")); err != nil {
+		t.Fatal(err)
+	}
+	var sigAt bytes.Buffer
+	if err := New(64, WithFileHash(true)).SignatureAt(bytes.NewReader(content), int64(len(content)), &sigAt); err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(content)
+	sigData, err := os.ReadFile(path("signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sig := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "Signature", data: sigData},
+		{name: "SignatureAt", data: sigAt.Bytes()},
+	} {
+		header, _, err := ReadSignature(bytes.NewReader(sig.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(header.FileHash, sum[:]) {
+			t.Errorf("%v() file hash = %x, want %x", sig.name, header.FileHash, sum)
+		}
+	}
+
+	for _, tt := range []struct {
+		name, signature, source string
+		wantSkipped             bool
+	}{
+		{name: "same", signature: "signature", source: "same", wantSkipped: true},
+		{name: "changed", signature: "signature", source: "changed"},
+		{name: "not recorded", signature: "no_hash", source: "same"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			delta, output := path(tt.name+".delta"), path(tt.name+".output")
+			app := New(64, WithFileHash(true))
+			if err := app.Delta(path(tt.signature), path(tt.source), delta); err != nil {
+				t.Fatalf("Delta() error = %v", err)
+			}
+			// the rolling match builds the search list, the fast path doesn't
+			stats := app.LastDeltaStats()
+			if skipped := stats.SearchListMemory == 0; skipped != tt.wantSkipped {
+				t.Errorf("Delta() skipped the rolling match = %v, want %v", skipped, tt.wantSkipped)
+			}
+			if stats.Unchanged != (tt.source == "same") {
+				t.Errorf("Delta() unchanged = %v, want %v", stats.Unchanged, tt.source == "same")
+			}
+			if err := New(64).Patch(path("target"), delta, output); err != nil {
+				t.Fatal(err)
+			}
+			assertSameFile(t, output, path(tt.source))
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package rdiff
+
+import "math/bits"
+
+const (
+	// weakHashFilterBitsPerBlock is the filter size per signature block, with 2 hash functions it gives
+	// a false positive rate of ~5%
+	weakHashFilterBitsPerBlock = 8
+	// weakHashFilterMinBits is the minimum filter size, 8KB, which fits the L1 cache of most CPUs
+	weakHashFilterMinBits = 1 << 16
+	// multipliers used to derive the 2 filter indexes from a weak hash(Fibonacci hashing)
+	weakHashFilterMul1 = 0x9E3779B97F4A7C15
+	weakHashFilterMul2 = 0xC2B2AE3D27D4EB4F
+)
+
+// weakHashFilter is a bloom filter of the signature weak hashes.
+// During the delta computation the weak hash is looked up for every source byte, and most lookups are misses,
+// so rejecting them with a couple of multiplications and bit tests, instead of a map lookup, speeds up the delta
+// computation for big signatures. It has no false negatives, but it has false positives, so a positive answer
+// must be confirmed by a lookup.
+type weakHashFilter struct {
+	bits []uint64
+	// shift extracts the index of a bit from the top of a mixed weak hash
+	shift uint
+}
+
+// newWeakHashFilter constructs a filter containing the weakHashes.
+func newWeakHashFilter(weakHashes []uint64) weakHashFilter {
+	size := max(weakHashFilterMinBits, weakHashFilterBitsPerBlock*len(weakHashes))
+	// round up to a power of 2, so an index is just the top bits of a mixed hash
+	log2 := bits.Len(uint(size - 1))
+	f := weakHashFilter{
+		bits:  make([]uint64, 1<<log2/64),
+		shift: uint(64 - log2),
+	}
+	for _, weakHash := range weakHashes {
+		f.add(weakHash)
+	}
+
+	return f
+}
+
+func (f weakHashFilter) add(weakHash uint64) {
+	i1, i2 := f.indexes(weakHash)
+	f.bits[i1/64] |= 1 << (i1 % 64)
+	f.bits[i2/64] |= 1 << (i2 % 64)
+}
+
+// mayContain returns false if the weakHash is for sure not in the filter.
+func (f weakHashFilter) mayContain(weakHash uint64) bool {
+	i1, i2 := f.indexes(weakHash)
+
+	return f.bits[i1/64]&(1<<(i1%64)) != 0 && f.bits[i2/64]&(1<<(i2%64)) != 0
+}
+
+func (f weakHashFilter) indexes(weakHash uint64) (uint64, uint64) {
+	return (weakHash * weakHashFilterMul1) >> f.shift, (weakHash * weakHashFilterMul2) >> f.shift
+}
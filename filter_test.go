@@ -0,0 +1,55 @@
+package rdiff
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestWeakHashFilter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, blocks := range []int{0, 1, 1000, 100000} {
+		weakHashes := make([]uint64, blocks)
+		for i := range weakHashes {
+			weakHashes[i] = uint64(rnd.Uint32())
+		}
+		f := newWeakHashFilter(weakHashes)
+		for _, weakHash := range weakHashes {
+			if !f.mayContain(weakHash) {
+				t.Fatalf("%v blocks: false negative for 0x%x", blocks, weakHash)
+			}
+		}
+
+		const probes = 100000
+		falsePositives := 0
+		for i := 0; i < probes; i++ {
+			if f.mayContain(uint64(rnd.Uint32())) {
+				falsePositives++
+			}
+		}
+		if rate := float64(falsePositives) / probes; rate > 0.1 {
+			t.Errorf("%v blocks: false positive rate = %v, want < 0.1", blocks, rate)
+		}
+	}
+}
+
+func BenchmarkWeakHashFilter_Miss(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	weakHashes := make([]uint64, 1<<20)
+	sl := make(map[uint64][]int, len(weakHashes))
+	for i := range weakHashes {
+		weakHashes[i] = uint64(rnd.Uint32())
+		sl[weakHashes[i]] = nil
+	}
+	f := newWeakHashFilter(weakHashes)
+
+	b.Run("filter", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			f.mayContain(uint64(i))
+		}
+	})
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = sl[uint64(i)]
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package rdiff
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Format identifies the serialization of the signature and delta outputs.
+type Format byte
+
+const (
+	// FormatGob is the gob encoding, and it's the default format. It's the only format read by ReadSignature and
+	// ReadDelta, and the format of the signatures and deltas read by Delta and Patch, except for FormatLibrsync.
+	FormatGob Format = iota
+	// FormatJSON is the JSON lines encoding: the header on the first line, followed by a line for every Block,
+	// or for every Operation. It's meant to be read by other tools.
+	FormatJSON
+	// FormatVCDIFF is the RFC 3284 VCDIFF encoding, for deltas only, so the delta can be applied by the
+	// VCDIFF decoders (ex: xdelta3, open-vcdiff), the target being the source file of the decoder.
+	FormatVCDIFF
+	// FormatLibrsync is the librsync signature and delta format, so the files can be exchanged with librsync and
+	// its rdiff command. With this format, Delta reads librsync signatures, adopting their block size, and Patch
+	// and Apply read librsync deltas. The signatures use the RabinKarp weak hash and the BLAKE2b strong hash,
+	// unless configured otherwise, the librsync rolling checksum and MD4 being the other supported hashes.
+	FormatLibrsync
+)
+
+// String returns the name of the format.
+func (f Format) String() string {
+	switch f {
+	case FormatGob:
+		return "gob"
+	case FormatJSON:
+		return "json"
+	case FormatVCDIFF:
+		return "vcdiff"
+	case FormatLibrsync:
+		return "librsync"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(f))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler, using the name of the format.
+func (f Format) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, it accepts the names returned by String,
+// and returns a non-nil error for an unknown name.
+func (f *Format) UnmarshalText(text []byte) error {
+	for _, format := range []Format{FormatGob, FormatJSON, FormatVCDIFF, FormatLibrsync} {
+		if string(text) == format.String() {
+			*f = format
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown format: %q", text)
+}
+
+// valueEncoder serializes a value at a time, it's implemented by the gob and json encoders.
+type valueEncoder interface {
+	Encode(v any) error
+}
+
+func gobEncoder(w io.Writer) valueEncoder {
+	return gob.NewEncoder(w)
+}
+
+func jsonEncoder(w io.Writer) valueEncoder {
+	return json.NewEncoder(w)
+}
+
+// writeSignatureJSON serializes the header and the blocks as JSON lines.
+func writeSignatureJSON(w io.Writer, header SignatureHeader, t signatureTable) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := enc.Encode(header)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < t.len(); i++ {
+		err = enc.Encode(t.block(i, header))
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
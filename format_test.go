@@ -0,0 +1,115 @@
+package rdiff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestFormat_UnmarshalText(t *testing.T) {
+	for _, f := range []Format{FormatGob, FormatJSON, FormatVCDIFF, FormatLibrsync} {
+		text, _ := f.MarshalText()
+		var got Format
+		if err := got.UnmarshalText(text); err != nil || got != f {
+			t.Errorf("UnmarshalText(%q) = %v, error = %v, want %v", text, got, err, f)
+		}
+	}
+	var got Format
+	if err := got.UnmarshalText([]byte("xdelta")); err == nil {
+		t.Errorf("UnmarshalText(%q) error = nil, want an error", "xdelta")
+	}
+}
+
+// readJSONLines decodes the first line of data into header, and the following lines using next.
+func readJSONLines(t *testing.T, data []byte, header any, next func(dec *json.Decoder) error) {
+	t.Helper()
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for i := 0; s.Scan(); i++ {
+		dec := json.NewDecoder(bytes.NewReader(s.Bytes()))
+		var err error
+		if i == 0 {
+			err = dec.Decode(header)
+		} else {
+			err = next(dec)
+		}
+		if err != nil {
+			t.Fatalf("line %v: %v", i, err)
+		}
+	}
+}
+
+func TestApp_WithFormat_JSON(t *testing.T) {
+	dir := t.TempDir()
+	target, source := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	gobSig, sig, delta := filepath.Join(dir, "gob_signature"), filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	if err := os.WriteFile(target, []byte{1, 2, 3, 4, 5, 6, 7}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(source, []byte{0, 1, 2, 3, 4, 5, 6, 7}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(3).Signature(target, gobSig); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(3, WithFormat(FormatJSON)).Signature(target, sig); err != nil {
+		t.Fatalf("Signature() error = %v", err)
+	}
+	if err := New(3, WithFormat(FormatJSON)).Delta(gobSig, source, delta); err != nil {
+		t.Fatalf("Delta() error = %v", err)
+	}
+
+	gobData, _ := os.ReadFile(gobSig)
+	wantHeader, wantBlocks, err := ReadSignature(bytes.NewReader(gobData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigData, _ := os.ReadFile(sig)
+	var header SignatureHeader
+	var blocks []Block
+	readJSONLines(t, sigData, &header, func(dec *json.Decoder) error {
+		var b Block
+		err := dec.Decode(&b)
+		blocks = append(blocks, b)
+		return err
+	})
+	if diff := cmp.Diff(header, wantHeader, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("JSON signature header differs, \nDIFF: %v", diff)
+	}
+	if diff := cmp.Diff(blocks, wantBlocks); diff != "" {
+		t.Errorf("JSON signature blocks differ, \nDIFF: %v", diff)
+	}
+	if n := len(blocks); n != 3 || blocks[n-1].Offset != 6 || blocks[n-1].Length != 1 {
+		t.Errorf("JSON signature blocks = %+v, want 3 blocks, the last one of 1 byte at 6", blocks)
+	}
+
+	deltaData, _ := os.ReadFile(delta)
+	var deltaHeader DeltaHeader
+	var ops []Operation
+	readJSONLines(t, deltaData, &deltaHeader, func(dec *json.Decoder) error {
+		var op Operation
+		err := dec.Decode(&op)
+		ops = append(ops, op)
+		return err
+	})
+	wantOps := []Operation{
+		{Type: OpBlockUpdate, BlockIndex: 0, Data: []byte{0}},
+		{Type: OpBlockKeep, BlockIndex: 1},
+		{Type: OpBlockKeep, BlockIndex: 2},
+	}
+	if deltaHeader.SourceSize != 8 {
+		t.Errorf("JSON delta header = %+v, want a source size of 8", deltaHeader)
+	}
+	if diff := cmp.Diff(ops, wantOps, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("JSON delta operations differ, \nDIFF: %v", diff)
+	}
+
+	if err = New(3, WithFormat(FormatVCDIFF)).Signature(target, filepath.Join(dir, "vcdiff")); err == nil {
+		t.Errorf("Signature() error = nil, want an error for the vcdiff format")
+	}
+}
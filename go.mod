@@ -2,4 +2,21 @@ module github.com/silviutanasa/rdiff
 
 go 1.21
 
-require github.com/google/go-cmp v0.6.0
+require (
+	github.com/coder/websocket v1.8.12
+	github.com/fsnotify/fsnotify v1.8.0
+	github.com/google/go-cmp v0.6.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+	golang.org/x/crypto v0.31.0
+	golang.org/x/sys v0.28.0
+	golang.org/x/time v0.5.0
+	google.golang.org/grpc v1.65.0
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240528184218-531527333157 // indirect
+)
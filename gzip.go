@@ -0,0 +1,187 @@
+package rdiff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	// gzipXFLBest and gzipXFLFast are the extra flags of the gzip header written by the compressors using their best
+	// compression, and their fastest one
+	gzipXFLBest = 2
+	gzipXFLFast = 4
+	// rsyncableSpacing is the number of compressed bytes per sync marker under which a gzip stream is rsyncable:
+	// gzip --rsyncable and pigz --rsyncable flush the compressor every few KiB of input, while the other compressors
+	// don't flush, except for the streams written in pieces, which flush much less often
+	rsyncableSpacing = 64 << 10
+)
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b, 8}
+
+// syncMarker is the empty stored deflate block written by a flush, aligning the compressed stream to a byte boundary,
+// after which the compressor starts over, so the compressed bytes following it only depend on the input following it.
+const syncMarker = 0x0000ffff
+
+// GzipFraming holds the gzip header of a compressed source, recorded by the delta of its uncompressed content, so the
+// rebuilt source is compressed using the same header, see WithGzip.
+type GzipFraming struct {
+	Name    string
+	Comment string
+	Extra   []byte
+	ModTime time.Time
+	OS      byte
+	// Level is the compression level, guessed from the extra flags of the header: the best compression, the best
+	// speed, or the default compression
+	Level int
+}
+
+// newWriter returns a gzip writer compressing to w using the framing.
+func (f *GzipFraming) newWriter(w io.Writer) (*gzip.Writer, error) {
+	zw, err := gzip.NewWriterLevel(w, f.Level)
+	if err != nil {
+		return nil, err
+	}
+	zw.Header = gzip.Header{Name: f.Name, Comment: f.Comment, Extra: f.Extra, ModTime: f.ModTime, OS: f.OS}
+
+	return zw, nil
+}
+
+// gzipInfo describes a gzip file, see scanGzip.
+type gzipInfo struct {
+	framing GzipFraming
+	// size is the size of the uncompressed content
+	size int64
+	// rsyncable means the compressed stream resynchronizes often enough to be diffed as it is
+	rsyncable bool
+}
+
+// gzipInput scans the input file, which has the given size, if the App is configured to decompress the gzip files,
+// and if the format can record it, see WithGzip. It returns false if the file is not a valid gzip file, or if its
+// content is empty, so it's diffed as it is.
+func (a *App) gzipInput(f io.ReaderAt, size int64) (gzipInfo, bool) {
+	if !a.gzip || (a.format != FormatGob && a.format != FormatJSON) {
+		return gzipInfo{}, false
+	}
+	info, err := scanGzip(f, size)
+	if err != nil || info.size == 0 {
+		return gzipInfo{}, false
+	}
+
+	return info, true
+}
+
+// scanGzip decompresses the gzip file r, which has the given size, and returns its description. It returns a non-nil
+// error if r is not a valid gzip file.
+func scanGzip(r io.ReaderAt, size int64) (gzipInfo, error) {
+	head := make([]byte, 10)
+	_, err := r.ReadAt(head, 0)
+	if err != nil || !bytes.HasPrefix(head, gzipMagic) {
+		return gzipInfo{}, errors.Join(errors.New("not a gzip file"), err)
+	}
+	markers := &syncCounter{last: ^uint32(0)}
+	zr, err := gzip.NewReader(io.TeeReader(io.NewSectionReader(r, 0, size), markers))
+	if err != nil {
+		return gzipInfo{}, err
+	}
+	n, err := io.Copy(io.Discard, zr)
+	if err != nil {
+		return gzipInfo{}, err
+	}
+	info := gzipInfo{
+		framing: GzipFraming{
+			Name: zr.Name, Comment: zr.Comment, Extra: zr.Extra, ModTime: zr.ModTime, OS: zr.OS,
+			Level: gzip.DefaultCompression,
+		},
+		size:      n,
+		rsyncable: markers.n > 0 && markers.n >= size/rsyncableSpacing,
+	}
+	switch head[8] {
+	case gzipXFLBest:
+		info.framing.Level = gzip.BestCompression
+	case gzipXFLFast:
+		info.framing.Level = gzip.BestSpeed
+	}
+
+	return info, nil
+}
+
+// syncCounter counts the sync markers of the compressed stream written to it.
+type syncCounter struct {
+	// last holds the last 4 bytes written
+	last uint32
+	n    int64
+}
+
+// Write counts the sync markers of p, including the ones starting in the previous writes.
+func (c *syncCounter) Write(p []byte) (int, error) {
+	for _, b := range p {
+		c.last = c.last<<8 | uint32(b)
+		if c.last == syncMarker {
+			c.n++
+		}
+	}
+
+	return len(p), nil
+}
+
+// signatureFunc returns the size of the content of the target file, which has the given size, hashed by Signature,
+// and the function computing its signature: the uncompressed content of a gzip target is hashed, unless it's
+// rsyncable, see WithGzip.
+func (a *App) signatureFunc(f io.ReaderAt, size int64) (int64, func(io.Reader, int64) (SignatureHeader, signatureTable, error)) {
+	info, ok := a.gzipInput(f, size)
+	if !ok || info.rsyncable {
+		return size, a.computeSignature
+	}
+
+	return info.size, a.computeGunzippedSignature
+}
+
+// computeGunzippedSignature hashes the uncompressed content of the gzip target, which has the given size, and
+// returns the header and the blocks of its signature.
+func (a *App) computeGunzippedSignature(target io.Reader, size int64) (SignatureHeader, signatureTable, error) {
+	zr, err := gzip.NewReader(target)
+	if err != nil {
+		return SignatureHeader{}, signatureTable{}, fmt.Errorf("decompressing the target: %w", err)
+	}
+	header, signature, err := a.computeSignature(zr, size)
+	header.Gunzipped = true
+
+	return header, signature, err
+}
+
+// gunzippedDelta computes the delta of the uncompressed content of the gzip source, described by info, against a
+// signature of an uncompressed target, and writes it to output, recording the framing of the source.
+func (a *App) gunzippedDelta(header SignatureHeader, sig signatureTable, info gzipInfo, source io.Reader, output io.Writer) error {
+	zr, err := gzip.NewReader(source)
+	if err != nil {
+		return fmt.Errorf("decompressing the source: %w", err)
+	}
+
+	return a.encodeDelta(header, DeltaHeader{SourceSize: info.size, SourceGzip: &info.framing}, output, func(emit func(Operation) error) error {
+		return a.diffEngine.ComputeDeltaFunc(zr, header, sig, emit)
+	})
+}
+
+// gunzipTemp decompresses the gzip target, which has the given size, to a temporary file, so its blocks are read by
+// offset, and returns the file, its size, and a function removing it.
+func gunzipTemp(target io.ReaderAt, targetSize int64) (io.ReaderAt, int64, func() error, error) {
+	zr, err := gzip.NewReader(io.NewSectionReader(target, 0, targetSize))
+	if err != nil {
+		return nil, 0, nil, markError(ErrVerification, fmt.Errorf("decompressing the target: %w", err))
+	}
+	f, release, err := createSpool("rdiff-gunzip-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	n, err := io.Copy(f, zr)
+	if err != nil {
+		return nil, 0, nil, errors.Join(fmt.Errorf("decompressing the target: %w", err), release())
+	}
+
+	return f, n, release, nil
+}
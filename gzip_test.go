@@ -0,0 +1,180 @@
+package rdiff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// gzipTestData compresses data under the name, flushing the compressor every flush bytes of input, if flush > 0.
+func gzipTestData(t *testing.T, data []byte, name string, flush int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Name, zw.ModTime = name, time.Unix(1700000000, 0)
+	for len(data) > 0 {
+		n := len(data)
+		if flush > 0 {
+			n = min(n, flush)
+		}
+		if _, err := zw.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		if flush > 0 {
+			if err := zw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		data = data[n:]
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// textTestData returns n lines of random words, compressible like a log file.
+func textTestData(n int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	words := []string{"alpha", "beta", "gamma", "delta", "epsilon", "zeta", "eta", "theta"}
+	var buf bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "%d %s %s %d\n", i, words[rnd.Intn(len(words))], words[rnd.Intn(len(words))], rnd.Intn(1000))
+	}
+	return buf.Bytes()
+}
+
+func TestScanGzip(t *testing.T) {
+	data := textTestData(20000)
+	tests := []struct {
+		name          string
+		file          []byte
+		wantErr       bool
+		wantRsyncable bool
+	}{
+		{name: "gzip", file: gzipTestData(t, data, "a", 0)},
+		{name: "flushed every 4KiB", file: gzipTestData(t, data, "a", 4096), wantRsyncable: true},
+		{name: "not gzip", file: data, wantErr: true},
+		{name: "truncated", file: gzipTestData(t, data, "a", 0)[:1000], wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := scanGzip(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scanGzip() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if info.size != int64(len(data)) || info.rsyncable != tt.wantRsyncable || info.framing.Name != "a" {
+				t.Errorf("scanGzip() = %+v, want size %v, rsyncable %v", info, len(data), tt.wantRsyncable)
+			}
+		})
+	}
+}
+
+func TestApp_WithGzip(t *testing.T) {
+	target := textTestData(20000)
+	source := bytes.Clone(target)
+	copy(source[len(source)/2:], "a change in the middle of the file")
+	tests := []struct {
+		name          string
+		target        []byte
+		source        []byte
+		wantGunzipped bool
+	}{
+		{name: "gzip", target: gzipTestData(t, target, "v1", 0), source: gzipTestData(t, source, "v2", 0), wantGunzipped: true},
+		{name: "uncompressed source", target: gzipTestData(t, target, "v1", 0), source: source, wantGunzipped: true},
+		{name: "rsyncable target", target: gzipTestData(t, target, "v1", 4096), source: gzipTestData(t, source, "v2", 4096)},
+		{name: "uncompressed target", target: target, source: gzipTestData(t, source, "v2", 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := func(name string) string { return filepath.Join(dir, name) }
+			for name, data := range map[string][]byte{"target": tt.target, "source": tt.source} {
+				if err := os.WriteFile(path(name), data, 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			app := New(1024, WithGzip(true))
+			if err := app.Signature(path("target"), path("signature")); err != nil {
+				t.Fatal(err)
+			}
+			if err := app.Delta(path("signature"), path("source"), path("delta")); err != nil {
+				t.Fatal(err)
+			}
+			if err := app.Patch(path("target"), path("delta"), path("out")); err != nil {
+				t.Fatal(err)
+			}
+			// the sources compressed by this package are compressed back byte for byte
+			if got, _ := os.ReadFile(path("out")); !bytes.Equal(got, tt.source) {
+				t.Error("Patch() doesn't rebuild the source")
+			}
+			delta, err := os.ReadFile(path("delta"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var applied bytes.Buffer
+			if err := app.Apply(bytes.NewReader(tt.target), int64(len(tt.target)), bytes.NewReader(delta), &applied); err != nil || !bytes.Equal(applied.Bytes(), tt.source) {
+				t.Errorf("Apply() doesn't rebuild the source, error = %v", err)
+			}
+
+			sig, err := os.Open(path("signature"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sig.Close()
+			header, _, err := ReadSignature(sig)
+			if err != nil || header.Gunzipped != tt.wantGunzipped {
+				t.Errorf("the signature is gunzipped: %v, error = %v, want %v", header.Gunzipped, err, tt.wantGunzipped)
+			}
+			if tt.wantGunzipped && len(delta) > len(tt.source)/10 {
+				t.Errorf("the delta has %v bytes, the source %v", len(delta), len(tt.source))
+			}
+		})
+	}
+}
+
+func TestApp_WithGzip_Errors(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	data := textTestData(5000)
+	for name, content := range map[string][]byte{"target": gzipTestData(t, data, "v1", 0), "other": data} {
+		if err := os.WriteFile(path(name), content, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := New(1024, WithGzip(true))
+	if err := app.Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(path("signature"), path("target"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		fn   func() error
+		want error
+	}{
+		{name: "vcdiff delta", fn: func() error {
+			return New(1024, WithGzip(true), WithFormat(FormatVCDIFF)).Delta(path("signature"), path("target"), path("d1"))
+		}},
+		{name: "uncompressed target", fn: func() error { return app.Patch(path("other"), path("delta"), path("o1")) }, want: ErrVerification},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fn()
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
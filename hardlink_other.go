@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package rdiff
+
+import "io/fs"
+
+// hardLinkID never finds the id, so the hard links are recorded as separate files.
+func hardLinkID(_ fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
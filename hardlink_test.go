@@ -0,0 +1,109 @@
+package rdiff
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// linkTree creates the hard links, by path, to the first files, by path, under dir.
+func linkTree(t *testing.T, dir string, links map[string]string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the hard links are not detected")
+	}
+	for link, first := range links {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, link)), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Link(filepath.Join(dir, first), filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestApp_SignatureDir_HardLinks(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string][]byte{"b": []byte("shared content"), "single": []byte("content")})
+	linkTree(t, root, map[string]string{"a/link": "b", "c": "b"})
+	output := filepath.Join(t.TempDir(), "signature")
+	if err := New(4).SignatureDir(root, output); err != nil {
+		t.Fatalf("SignatureDir() error = %v", err)
+	}
+	got := make(map[string]string)
+	for _, f := range readDirSignatureFile(t, output) {
+		got[f.Path] = f.HardLink
+		if f.HardLink != "" && len(f.Blocks) != 0 {
+			t.Errorf("SignatureDir() hard link %v has %v blocks, want none", f.Path, len(f.Blocks))
+		}
+	}
+	// the first file, in lexical order, holds the blocks
+	if diff := cmp.Diff(map[string]string{"a/link": "", "b": "a/link", "c": "a/link", "single": ""}, got); diff != "" {
+		t.Errorf("SignatureDir() hard links \nDIFF: %v", diff)
+	}
+}
+
+func TestApp_PatchDir_HardLinks(t *testing.T) {
+	target, source := t.TempDir(), t.TempDir()
+	content := bytes.Repeat([]byte("hard link content "), 10)
+	writeTree(t, target, map[string][]byte{"x": content, "xw": content})
+	linkTree(t, target, map[string]string{"y": "x"})
+	writeTree(t, source, map[string][]byte{"x": append(append([]byte{}, content...), "changed"...)})
+	linkTree(t, source, map[string]string{"y": "x", "z": "x", "xw": "x"})
+
+	output, files := patchDirAttrs(t, New(4), target, source)
+	changes := make(map[string]FileChange)
+	for _, file := range files {
+		changes[file.Path] = file.Change
+	}
+	// xw was a separate file
+	want := map[string]FileChange{"x": FileChanged, "xw": FileChanged, "y": FileUnchanged, "z": FileNew}
+	if diff := cmp.Diff(want, changes); diff != "" {
+		t.Errorf("ReadDirDelta() changes \nDIFF: %v", diff)
+	}
+	first, err := os.Stat(filepath.Join(output, "x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"xw", "y", "z"} {
+		info, err := os.Stat(filepath.Join(output, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(first, info) {
+			t.Errorf("PatchDir() %v is not a hard link to x", name)
+		}
+	}
+	if got, err := os.ReadFile(filepath.Join(output, "xw")); err != nil || !bytes.HasSuffix(got, []byte("changed")) {
+		t.Errorf("PatchDir() xw = %q, %v, want the changed content", got, err)
+	}
+}
+
+func TestApp_PatchDir_InvalidHardLink(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range []any{
+		DirDeltaHeader{SourceFiles: 1},
+		// the first file is not part of the delta
+		dirDeltaRecord{Entry: &fileDeltaEntry{Path: "b", Change: FileNew, HardLink: "a"}},
+	} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	delta := filepath.Join(dir, "delta")
+	if err := os.WriteFile(delta, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	err := New(4).PatchDir(t.TempDir(), delta, filepath.Join(dir, "output"))
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("PatchDir() error = %v, want a %v error", err, ErrCorrupt)
+	}
+}
@@ -0,0 +1,172 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// SignatureHeader holds the parameters used to compute a signature.
+// It is serialized in front of the signature's block list, so the delta computation can use the same parameters.
+type SignatureHeader struct {
+	// WeakHash is the rolling hash algorithm used for every Block.WeakHash
+	WeakHash WeakHashType
+	// StrongHash is the hash algorithm used for every Block.StrongHash
+	StrongHash StrongHashType
+	// StrongHashSize is the number of bytes stored for every Block.StrongHash
+	StrongHashSize int
+	// StrongHashKeyID identifies the HMAC key of the strong hash, without revealing it, nil if the strong hash is not keyed
+	StrongHashKeyID []byte
+	// TargetSize is the size of the target, in bytes, 0 if unknown
+	TargetSize int64
+	// BlockSize is the size of the target blocks, in bytes, 0 if unknown, ex: for the signatures written by the
+	// versions which didn't record it
+	BlockSize int
+	// FileHash is the strong hash of the whole target, nil if it's not recorded, see WithFileHash
+	FileHash []byte
+	// SecondPass holds the hashes of the target split in smaller blocks, nil if they're not recorded, see
+	// WithSecondPass
+	SecondPass *SecondPassSignature
+	// Gunzipped means the target is a gzip file whose uncompressed content was hashed, see WithGzip
+	Gunzipped bool
+}
+
+// SecondPassSignature holds the hashes of the target split in blocks of BlockSize bytes, smaller than the signature's
+// ones, in columnar form: the weak hash of every block, and its strong hash, of the signature's strong hash size,
+// all of them concatenated. The literal regions of a delta are matched against them, see WithSecondPass.
+type SecondPassSignature struct {
+	BlockSize    int
+	WeakHashes   []uint64
+	StrongHashes []byte
+}
+
+// DeltaHeader holds the properties of the source a delta was computed for.
+// It is serialized in front of the delta's operations, so the output can be prepared before applying them.
+type DeltaHeader struct {
+	// SourceSize is the size of the source, in bytes, which is the size of the output of applying the delta
+	SourceSize int64
+	// TargetBlockSize is the size of the target blocks the operations refer to, 0 if it's not recorded, in which case
+	// the configured block size is used
+	TargetBlockSize int
+	// SecondPassBlockSize is the size of the target blocks of the OpBlockPart operations, 0 if the delta was
+	// computed without a second pass, see WithSecondPass
+	SecondPassBlockSize int
+	// GunzippedTarget means the operations copy the blocks of the uncompressed content of the gzip target, see WithGzip
+	GunzippedTarget bool
+	// SourceGzip is the framing of the gzip source whose uncompressed content the delta rebuilds, so the output is
+	// compressed using it, nil if the source is not compressed
+	SourceGzip *GzipFraming
+}
+
+// signatureHeader returns the header describing the signatures computed by the engine.
+func (r *rDiff) signatureHeader() SignatureHeader {
+	return SignatureHeader{
+		WeakHash:        r.weakHashType,
+		StrongHash:      r.strongHashType,
+		StrongHashSize:  r.effectiveStrongHashSize(),
+		StrongHashKeyID: strongHashKeyID(r.strongHashKey),
+		BlockSize:       r.blockSize,
+	}
+}
+
+// negotiated returns a copy of the engine configured to use the parameters of the signature having the header, see
+// negotiateSignatureHeader. The engine itself is left unchanged, so a call computing against a signature doesn't
+// change the parameters of the later calls, ex: a Signature call following a Delta one.
+func (r *rDiff) negotiated(h SignatureHeader) (*rDiff, error) {
+	c := *r
+	err := c.negotiateSignatureHeader(h)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// negotiateSignatureHeader validates the header against the engine configuration and configures the engine
+// to use the header's parameters, it's run on a copy of the engine of the App, see negotiated.
+// A hash algorithm explicitly configured on the engine(pinned) must be the same as the signature's one,
+// otherwise the delta would silently be computed against meaningless hashes, so a non-nil error is returned.
+// A hash algorithm not explicitly configured is adopted from the signature.
+func (r *rDiff) negotiateSignatureHeader(h SignatureHeader) error {
+	if h.WeakHash != r.weakHashType {
+		if r.weakHashPinned {
+			return markError(
+				ErrVerification,
+				fmt.Errorf("the signature weak hash(%v) differs from the configured one(%v)", h.WeakHash, r.weakHashType),
+			)
+		}
+		weakHasher, err := newRollingHash(h.WeakHash)
+		if err != nil {
+			return err
+		}
+		r.weakHasher, r.weakHashType = weakHasher, h.WeakHash
+	}
+	if h.StrongHash != r.strongHashType {
+		if r.strongHashPinned {
+			return markError(
+				ErrVerification,
+				fmt.Errorf("the signature strong hash(%v) differs from the configured one(%v)", h.StrongHash, r.strongHashType),
+			)
+		}
+		strongHasher, err := newStrongHash(h.StrongHash, r.strongHashKey)
+		if err != nil {
+			return err
+		}
+		r.strongHasher, r.strongHashType = strongHasher, h.StrongHash
+	}
+	if !bytes.Equal(h.StrongHashKeyID, strongHashKeyID(r.strongHashKey)) {
+		return markError(ErrVerification, errors.New("the signature strong hash key doesn't match the configured one"))
+	}
+	if h.StrongHashSize <= 0 || h.StrongHashSize > r.strongHasher.Size() {
+		return markError(ErrCorrupt, fmt.Errorf(
+			"the signature strong hash size(%v) is out of the supported range [1, %v]",
+			h.StrongHashSize,
+			r.strongHasher.Size(),
+		))
+	}
+	r.strongHashSize = h.StrongHashSize
+
+	return r.negotiateBlockSize(h)
+}
+
+// negotiateBlockSize validates the header block size against the engine configuration and configures the engine
+// to use it. A block size explicitly configured on the engine(pinned) must be the same as the signature's one,
+// otherwise the delta would be computed against blocks of another size, matching nothing, so a non-nil error is
+// returned. A block size not explicitly configured is adopted from the signature, if it records it.
+func (r *rDiff) negotiateBlockSize(h SignatureHeader) error {
+	switch {
+	case h.BlockSize < 0 || h.BlockSize > MaxBlockSize:
+		return markError(ErrCorrupt, fmt.Errorf("invalid signature block size: %v", h.BlockSize))
+	case h.BlockSize == 0 || h.BlockSize == r.blockSize:
+		return nil
+	case r.blockSizePinned:
+		return markError(
+			ErrVerification,
+			fmt.Errorf("the signature block size(%v) differs from the configured one(%v)", h.BlockSize, r.blockSize),
+		)
+	}
+	r.blockSize = h.BlockSize
+
+	return nil
+}
+
+// deltaBlockSize returns the size of the target blocks the operations of the delta having the header refer to, the
+// target having targetSize bytes: the one recorded by the header, which must be the configured one if it's pinned,
+// otherwise the configured one, or, if none, the one a signature of the target has by default, see decideBlockSize.
+func (r *rDiff) deltaBlockSize(h DeltaHeader, targetSize int64) (int, error) {
+	switch {
+	case h.TargetBlockSize < 0 || h.TargetBlockSize > MaxBlockSize:
+		return 0, markError(ErrCorrupt, fmt.Errorf("invalid delta block size: %v", h.TargetBlockSize))
+	case h.TargetBlockSize > 0 && r.blockSizePinned && h.TargetBlockSize != r.blockSize:
+		return 0, markError(
+			ErrVerification,
+			fmt.Errorf("the delta block size(%v) differs from the configured one(%v)", h.TargetBlockSize, r.blockSize),
+		)
+	case h.TargetBlockSize > 0:
+		return h.TargetBlockSize, nil
+	case r.blockSize > 0:
+		return r.blockSize, nil
+	default:
+		return decideBlockSize(0, targetSize)
+	}
+}
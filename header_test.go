@@ -0,0 +1,73 @@
+package rdiff
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/silviutanasa/rdiff/rollsum"
+)
+
+var testsNegotiateSignatureHeader = []struct {
+	key     []byte
+	pinned  bool
+	in      SignatureHeader
+	wantErr bool
+}{
+	{in: SignatureHeader{StrongHashSize: md5.Size, BlockSize: 3}},
+	{in: SignatureHeader{StrongHashSize: md5.Size, BlockSize: 5}},
+	{in: SignatureHeader{StrongHashSize: md5.Size, BlockSize: -1}, wantErr: true},
+	{in: SignatureHeader{StrongHashSize: md5.Size, BlockSize: MaxBlockSize + 1}, wantErr: true},
+	{pinned: true, in: SignatureHeader{StrongHashSize: md5.Size, BlockSize: 3}},
+	{pinned: true, in: SignatureHeader{StrongHashSize: md5.Size, BlockSize: 5}, wantErr: true},
+	{in: SignatureHeader{StrongHashSize: md5.Size}},
+	{in: SignatureHeader{StrongHashSize: 1}},
+	{in: SignatureHeader{StrongHashSize: 0}, wantErr: true},
+	{in: SignatureHeader{StrongHashSize: -1}, wantErr: true},
+	{in: SignatureHeader{StrongHashSize: md5.Size + 1}, wantErr: true},
+	{in: SignatureHeader{WeakHash: WeakHashRabin, StrongHashSize: md5.Size}},
+	{in: SignatureHeader{WeakHash: WeakHashType(255), StrongHashSize: md5.Size}, wantErr: true},
+	{
+		key: []byte("secret"),
+		in:  SignatureHeader{StrongHashSize: md5.Size, StrongHashKeyID: strongHashKeyID([]byte("secret"))},
+	},
+	{
+		key:     []byte("secret"),
+		in:      SignatureHeader{StrongHashSize: md5.Size, StrongHashKeyID: strongHashKeyID([]byte("other"))},
+		wantErr: true,
+	},
+	{
+		in:      SignatureHeader{StrongHashSize: md5.Size, StrongHashKeyID: strongHashKeyID([]byte("secret"))},
+		wantErr: true,
+	},
+	{key: []byte("secret"), in: SignatureHeader{StrongHashSize: md5.Size}, wantErr: true},
+	{in: SignatureHeader{StrongHash: StrongHashSHA256, StrongHashSize: sha256.Size}},
+	{in: SignatureHeader{StrongHash: StrongHashSHA1, StrongHashSize: sha256.Size}, wantErr: true},
+	{in: SignatureHeader{StrongHash: StrongHashType(255), StrongHashSize: md5.Size}, wantErr: true},
+	{pinned: true, in: SignatureHeader{StrongHashSize: md5.Size}},
+	{pinned: true, in: SignatureHeader{WeakHash: WeakHashRabin, StrongHashSize: md5.Size}, wantErr: true},
+	{pinned: true, in: SignatureHeader{StrongHash: StrongHashSHA256, StrongHashSize: sha256.Size}, wantErr: true},
+}
+
+func TestRDiff_negotiateSignatureHeader(t *testing.T) {
+	for _, tt := range testsNegotiateSignatureHeader {
+		strongHasher, _ := newStrongHash(StrongHashMD5, tt.key)
+		r := newRDiff(3, rollsum.NewAdler32(), strongHasher)
+		r.strongHashKey = tt.key
+		r.weakHashPinned, r.strongHashPinned, r.blockSizePinned = tt.pinned, tt.pinned, tt.pinned
+		err := r.negotiateSignatureHeader(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("negotiateSignatureHeader(%+v) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		// a signature which doesn't record its block size keeps the configured one
+		want := tt.in
+		if want.BlockSize == 0 {
+			want.BlockSize = 3
+		}
+		if diff := cmp.Diff(r.signatureHeader(), want); err == nil && diff != "" {
+			t.Errorf("negotiateSignatureHeader(%+v) adopted %+v, \nDIFF: %v", tt.in, r.signatureHeader(), diff)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package rdiff
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+const (
+	// indexRecordHeader is the size of the fixed part of an index record: the weak hash, the file and the block index,
+	// followed by the strong hash
+	indexRecordHeader = 16
+	// indexSegmentHeader is the size of the segment header: the magic, the number of records, and the size of the
+	// bloom filter following them
+	indexSegmentHeader = 24
+	// bloomBitsPerRecord and bloomProbes size the bloom filters of the segments for a false positive rate of about 1%
+	bloomBitsPerRecord = 10
+	bloomProbes        = 7
+)
+
+// indexSegmentMagic starts every segment file of a block index.
+var indexSegmentMagic = []byte("rdiffix1")
+
+// indexRecord is a block of an indexed file: its weak hash, and its strong hash, which is a slice of the segment
+// buffer it was read from, or written to.
+type indexRecord struct {
+	weak   uint64
+	file   uint32
+	block  uint32
+	strong []byte
+}
+
+// compareIndexRecords orders the records of a segment by weak hash, then by file, and by block.
+func compareIndexRecords(a, b indexRecord) int {
+	switch {
+	case a.weak != b.weak:
+		return cmpUint64(a.weak, b.weak)
+	case a.file != b.file:
+		return cmpUint64(uint64(a.file), uint64(b.file))
+	default:
+		return cmpUint64(uint64(a.block), uint64(b.block))
+	}
+}
+
+// cmpUint64 returns -1, 0 or 1 as a is lower, equal or greater than b.
+func cmpUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// bloomFilter tells whether a weak hash may be in a segment, so the rolling match loop doesn't read the segments
+// for every source byte.
+type bloomFilter []uint64
+
+// newBloomFilter returns a bloom filter sized for n records.
+func newBloomFilter(n int64) bloomFilter {
+	return make(bloomFilter, max(1, (n*bloomBitsPerRecord+63)/64))
+}
+
+// bloomBits returns the first bit, and the step, of the probes of a weak hash, derived from it by the splitmix64
+// finalizer, as the weak hashes of the blocks aren't uniformly distributed.
+func bloomBits(weak uint64) (uint64, uint64) {
+	h := weak + 0x9e3779b97f4a7c15
+	h = (h ^ h>>30) * 0xbf58476d1ce4e5b9
+	h = (h ^ h>>27) * 0x94d049bb133111eb
+	h ^= h >> 31
+
+	return h, h>>32 | 1
+}
+
+func (f bloomFilter) add(weak uint64) {
+	h, step := bloomBits(weak)
+	n := uint64(len(f)) * 64
+	for i := 0; i < bloomProbes; i++ {
+		bit := h % n
+		f[bit/64] |= 1 << (bit % 64)
+		h += step
+	}
+}
+
+func (f bloomFilter) has(weak uint64) bool {
+	h, step := bloomBits(weak)
+	n := uint64(len(f)) * 64
+	for i := 0; i < bloomProbes; i++ {
+		bit := h % n
+		if f[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+		h += step
+	}
+
+	return true
+}
+
+// indexSegment is an immutable file of a block index, holding records sorted by weak hash, looked up by a binary
+// search, and the bloom filter of their weak hashes, which is kept in memory.
+type indexSegment struct {
+	name  string
+	f     *os.File
+	count int64
+	// strongSize is the size of the strong hashes of the records
+	strongSize int
+	bloom      bloomFilter
+}
+
+// recordSize returns the size of a record of the segment.
+func (s *indexSegment) recordSize() int {
+	return indexRecordHeader + s.strongSize
+}
+
+// openIndexSegment opens the segment file at p, holding strong hashes of strongSize bytes, and loads its bloom
+// filter. A malformed segment returns a non-nil error matching ErrCorrupt.
+func openIndexSegment(p string, strongSize int) (*indexSegment, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	s, err := readIndexSegment(f, strongSize)
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("the index segment %v: %w", p, err), f.Close())
+	}
+
+	return s, nil
+}
+
+// readIndexSegment reads the header and the bloom filter of the segment file f.
+func readIndexSegment(f *os.File, strongSize int) (*indexSegment, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, indexSegmentHeader)
+	_, err = f.ReadAt(header, 0)
+	if err != nil || !bytes.Equal(header[:8], indexSegmentMagic) {
+		return nil, markError(ErrCorrupt, errors.New("not an index segment"))
+	}
+	s := &indexSegment{f: f, strongSize: strongSize, count: int64(binary.BigEndian.Uint64(header[8:]))}
+	bloomSize := int64(binary.BigEndian.Uint64(header[16:]))
+	records := s.count * int64(s.recordSize())
+	if s.count < 0 || bloomSize <= 0 || bloomSize%8 != 0 || info.Size() != indexSegmentHeader+records+bloomSize {
+		return nil, markError(ErrCorrupt, errors.New("the index segment size doesn't match its header"))
+	}
+	raw := make([]byte, bloomSize)
+	_, err = f.ReadAt(raw, indexSegmentHeader+records)
+	if err != nil {
+		return nil, err
+	}
+	s.bloom = make(bloomFilter, bloomSize/8)
+	for i := range s.bloom {
+		s.bloom[i] = binary.BigEndian.Uint64(raw[i*8:])
+	}
+
+	return s, nil
+}
+
+// find calls fn for the records of the weak hash, until it returns false.
+func (s *indexSegment) find(weak uint64, buf []byte, fn func(indexRecord) bool) error {
+	if !s.bloom.has(weak) {
+		return nil
+	}
+	buf = buf[:s.recordSize()]
+	lo, err := s.search(weak, buf)
+	if err != nil {
+		return err
+	}
+	for ; lo < s.count; lo++ {
+		r, err := s.readRecord(lo, buf)
+		if err != nil {
+			return err
+		}
+		if r.weak != weak || !fn(r) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// search returns the index of the first record whose weak hash is >= weak.
+func (s *indexSegment) search(weak uint64, buf []byte) (int64, error) {
+	lo, hi := int64(0), s.count
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		r, err := s.readRecord(mid, buf)
+		if err != nil {
+			return 0, err
+		}
+		if r.weak < weak {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo, nil
+}
+
+// readRecord reads the record i into buf, which must have the record size.
+func (s *indexSegment) readRecord(i int64, buf []byte) (indexRecord, error) {
+	_, err := s.f.ReadAt(buf, indexSegmentHeader+i*int64(len(buf)))
+	if err != nil {
+		return indexRecord{}, err
+	}
+
+	return decodeIndexRecord(buf), nil
+}
+
+// decodeIndexRecord decodes the record b, the strong hash being a slice of b.
+func decodeIndexRecord(b []byte) indexRecord {
+	return indexRecord{
+		weak:   binary.BigEndian.Uint64(b),
+		file:   binary.BigEndian.Uint32(b[8:]),
+		block:  binary.BigEndian.Uint32(b[12:]),
+		strong: b[indexRecordHeader:],
+	}
+}
+
+// appendIndexRecord appends the encoding of r to dst.
+func appendIndexRecord(dst []byte, r indexRecord) []byte {
+	dst = binary.BigEndian.AppendUint64(dst, r.weak)
+	dst = binary.BigEndian.AppendUint32(dst, r.file)
+	dst = binary.BigEndian.AppendUint32(dst, r.block)
+
+	return append(dst, r.strong...)
+}
+
+// segmentWriter writes the records of a new segment, in order, to a file, then its bloom filter, sized for up to
+// n records, and its header, holding the number of records written.
+type segmentWriter struct {
+	f     *os.File
+	w     *bufio.Writer
+	bloom bloomFilter
+	count int64
+	buf   []byte
+}
+
+// newSegmentWriter creates the segment file at p, for up to n records.
+func newSegmentWriter(p string, n int64) (*segmentWriter, error) {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	w := &segmentWriter{f: f, w: bufio.NewWriter(f), bloom: newBloomFilter(n)}
+	// the header is written once the records are counted
+	_, err = w.w.Write(make([]byte, indexSegmentHeader))
+	if err != nil {
+		return nil, errors.Join(err, f.Close())
+	}
+
+	return w, nil
+}
+
+func (w *segmentWriter) write(r indexRecord) error {
+	w.buf = appendIndexRecord(w.buf[:0], r)
+	w.bloom.add(r.weak)
+	w.count++
+	_, err := w.w.Write(w.buf)
+
+	return err
+}
+
+// close writes the bloom filter and the header, syncs the segment, and closes it.
+func (w *segmentWriter) close() error {
+	for _, word := range w.bloom {
+		w.buf = binary.BigEndian.AppendUint64(w.buf[:0], word)
+		_, err := w.w.Write(w.buf)
+		if err != nil {
+			return errors.Join(err, w.f.Close())
+		}
+	}
+	header := append(slices.Clone(indexSegmentMagic), make([]byte, 16)...)
+	binary.BigEndian.PutUint64(header[8:], uint64(w.count))
+	binary.BigEndian.PutUint64(header[16:], uint64(len(w.bloom)*8))
+	err := w.w.Flush()
+	if err == nil {
+		_, err = w.f.WriteAt(header, 0)
+	}
+	if err == nil {
+		err = w.f.Sync()
+	}
+
+	return errors.Join(err, w.f.Close())
+}
+
+// segmentCursor reads the records of a segment in order, for a merge.
+type segmentCursor struct {
+	r   *bufio.Reader
+	buf []byte
+	rec indexRecord
+}
+
+// next reads the next record, it returns false at the end of the segment.
+func (c *segmentCursor) next() (bool, error) {
+	_, err := io.ReadFull(c.r, c.buf)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	c.rec = decodeIndexRecord(c.buf)
+
+	return true, nil
+}
+
+// cursorHeap orders the cursors of a merge by their current record.
+type cursorHeap []*segmentCursor
+
+func (h cursorHeap) Len() int           { return len(h) }
+func (h cursorHeap) Less(i, j int) bool { return compareIndexRecords(h[i].rec, h[j].rec) < 0 }
+func (h cursorHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *cursorHeap) Push(x any)        { *h = append(*h, x.(*segmentCursor)) }
+
+func (h *cursorHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return last
+}
+
+// mergeSegments writes the records of the segments, for which keep returns true, in order, to w.
+func mergeSegments(segments []*indexSegment, w *segmentWriter, keep func(indexRecord) bool) error {
+	h := make(cursorHeap, 0, len(segments))
+	for _, s := range segments {
+		records := io.NewSectionReader(s.f, indexSegmentHeader, s.count*int64(s.recordSize()))
+		c := &segmentCursor{r: bufio.NewReader(records), buf: make([]byte, s.recordSize())}
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+	for h.Len() > 0 {
+		c := h[0]
+		if keep(c.rec) {
+			err := w.write(c.rec)
+			if err != nil {
+				return err
+			}
+		}
+		ok, err := c.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// PatchInPlace rebuilds the source from the target file(targetFilePath) and the delta file(deltaFilePath), as Patch
+// does, and writes it over the target, so there is no room needed for a second copy of the file.
+// The writes are journaled first: the journal file(journalPath), which must not exist, records the new bytes of every
+// changed target range, along with its old ones, and is synced before the target is modified, then the target is
+// written, synced, and the journal is removed. A patch interrupted by a crash is then recovered, on restart, by
+// RollForwardPatch, which completes it, or by RollBackPatch, which undoes it, both leaving the target in a known state,
+// whichever point the crash happened at. The target ranges kept in place by the delta are neither journaled nor
+// written, so the journal holds about twice the changed bytes only.
+// The delta can't be a librsync delta, nor be computed with WithSecondPass or WithGzip, otherwise a non-nil error is
+// returned, and the target is left unchanged, as it is on any error happening before the journal is committed. Once
+// the target is written, the bytes written are read back, and a failure, ex: an IO error, or a target changed by
+// another writer meanwhile, rolls the target back, and returns an *ApplyError.
+func (a *App) PatchInPlace(targetFilePath string, deltaFilePath string, journalPath string) (err error) {
+	call := a.startCall("patch")
+	defer func() { call.done(a.diffEngine, err) }()
+	span := a.startCallSpan("patch")
+	defer func() { span.done(a.diffEngine, err) }()
+	if a.format == FormatLibrsync {
+		return errors.New("a librsync delta can't be applied in place")
+	}
+	if _, err = os.Lstat(journalPath); err == nil {
+		return &fs.PathError{Op: "open", Path: journalPath, Err: fs.ErrExist}
+	}
+	target, err := os.Open(targetFilePath)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, target.Close()) }()
+	snapshot, err := newInputSnapshot(target)
+	if err != nil {
+		return err
+	}
+	span.input(snapshot.info.Size())
+	err = a.checkBasis(target, snapshot.info.Size())
+	if err != nil {
+		return err
+	}
+	h, cmds, err := a.readInPlaceDelta(deltaFilePath, snapshot.info.Size())
+	if err != nil {
+		return err
+	}
+
+	err = journalPatch(target, h, cmds, journalPath)
+	if err == nil {
+		err = snapshot.check()
+	}
+	if err != nil {
+		return err
+	}
+
+	return applyJournal(targetFilePath, journalPath, h.sourceSize)
+}
+
+// applyJournal rolls the committed journal forward, and removes it. A failure rolls the journal back, and returns an
+// *ApplyError, the journal being kept if the roll back fails too.
+func applyJournal(targetFilePath, journalPath string, sourceSize int64) error {
+	journal, err := os.Open(journalPath)
+	if err != nil {
+		return err
+	}
+	written, err := replayJournal(targetFilePath, journal, true)
+	var rollbackErr error
+	if err != nil {
+		_, rollbackErr = replayJournal(targetFilePath, journal, false)
+	}
+	// the journal is only read, and it's closed before it's removed
+	_ = journal.Close()
+	switch {
+	case err == nil:
+		return os.Remove(journalPath)
+	case rollbackErr != nil:
+		return &ApplyError{Written: written, Size: sourceSize, Err: err, RollbackErr: rollbackErr, inPlace: true}
+	default:
+		return &ApplyError{
+			Written: written, Size: sourceSize, RolledBack: true, Err: err, RollbackErr: os.Remove(journalPath), inPlace: true,
+		}
+	}
+}
+
+// readInPlaceDelta reads the delta file, and returns the header of its journal, and its commands, as applied to the
+// target of targetSize bytes.
+func (a *App) readInPlaceDelta(deltaFilePath string, targetSize int64) (journalHeader, []Command, error) {
+	f, err := os.Open(deltaFilePath)
+	if err != nil {
+		return journalHeader{}, nil, err
+	}
+	defer f.Close()
+	verified, release, err := a.verifiedArtifact(f)
+	if err != nil {
+		return journalHeader{}, nil, err
+	}
+	defer release()
+	delta, err := a.decryptedInput(verified)
+	if err != nil {
+		return journalHeader{}, nil, err
+	}
+	d, err := a.readDeltaHeader(delta)
+	if err != nil {
+		return journalHeader{}, nil, err
+	}
+	if d.header.SecondPassBlockSize != 0 || d.header.GunzippedTarget || d.header.SourceGzip != nil {
+		return journalHeader{}, nil, errors.New("a delta computed with a second pass, or of gzip files, can't be applied in place")
+	}
+	blockSize, err := a.diffEngine.deltaBlockSize(d.header, targetSize)
+	if err != nil {
+		return journalHeader{}, nil, err
+	}
+	var ops []Operation
+	err = d.forEach(func(op Operation) error {
+		ops = append(ops, op)
+		return nil
+	})
+	if err != nil {
+		return journalHeader{}, nil, err
+	}
+	cmds, err := DeltaCommands(ops, blockSize, targetSize)
+	if err != nil {
+		return journalHeader{}, nil, err
+	}
+
+	return journalHeader{targetSize: targetSize, sourceSize: d.header.SourceSize}, cmds, nil
+}
+
+// journalPatch writes the journal of the commands applied in place to the target, and commits it, the journal being
+// removed on error.
+func journalPatch(target io.ReaderAt, h journalHeader, cmds []Command, journalPath string) error {
+	j, err := createJournal(journalPath, h)
+	if err != nil {
+		return err
+	}
+	p := &inPlacePlan{target: target, targetSize: h.targetSize, j: j}
+	for i, cmd := range cmds {
+		err = p.add(cmd)
+		if err != nil {
+			return errors.Join(fmt.Errorf("the command %v: %w", i, err), j.abort())
+		}
+	}
+	if p.pos != h.sourceSize {
+		err = fmt.Errorf("the delta rebuilt %v bytes, but the source has %v bytes", p.pos, h.sourceSize)
+		return errors.Join(markError(ErrVerification, err), j.abort())
+	}
+	// the end of a target which shrank is journaled too, so it's restored by a roll back
+	err = p.chunks(h.targetSize-p.pos, func(off, length int64) error {
+		old, err := p.read(p.pos+off, length)
+		if err != nil {
+			return err
+		}
+		return j.write(journalRecord{offset: p.pos + off, old: old})
+	})
+	if err != nil {
+		return errors.Join(err, j.abort())
+	}
+
+	return j.commit()
+}
+
+// inPlacePlan journals the writes of the commands applied in place to the target, in order, every command writing
+// its bytes at pos, unless they're already there.
+type inPlacePlan struct {
+	target     io.ReaderAt
+	targetSize int64
+	j          *journalWriter
+	// pos is the source offset of the next command
+	pos int64
+}
+
+// add journals the writes of cmd.
+func (p *inPlacePlan) add(cmd Command) error {
+	switch cmd.Type {
+	case CommandCopy:
+		return p.addCopy(cmd)
+	case CommandLiteral:
+		return p.chunks(int64(len(cmd.Data)), func(off, length int64) error {
+			return p.write(cmd.Data[off : off+length])
+		})
+	case CommandZero:
+		if cmd.Length < 0 {
+			return markError(ErrCorrupt, errors.New("a negative zero run"))
+		}
+		return zeroChunks(cmd.Length, p.write)
+	default:
+		return markError(ErrCorrupt, fmt.Errorf("invalid command type: %v", cmd.Type))
+	}
+}
+
+// addCopy journals the writes of a CommandCopy, unless it keeps its target range in place.
+func (p *inPlacePlan) addCopy(cmd Command) error {
+	if cmd.Offset < 0 || cmd.Length < 0 || cmd.Offset > p.targetSize || cmd.Length > p.targetSize-cmd.Offset {
+		err := fmt.Errorf("the copy of %v bytes at %v is out of the target size(%v)", cmd.Length, cmd.Offset, p.targetSize)
+		return markError(ErrCorrupt, err)
+	}
+	if cmd.Offset == p.pos {
+		p.pos += cmd.Length
+		return nil
+	}
+
+	return p.chunks(cmd.Length, func(off, length int64) error {
+		data, err := p.read(cmd.Offset+off, length)
+		if err != nil {
+			return err
+		}
+		return p.write(data)
+	})
+}
+
+// write journals the write of data at pos, unless the target already holds it, and advances pos.
+func (p *inPlacePlan) write(data []byte) error {
+	old, err := p.read(p.pos, min(int64(len(data)), max(p.targetSize-p.pos, 0)))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(old, data) {
+		err = p.j.write(journalRecord{offset: p.pos, old: old, new: data})
+		if err != nil {
+			return err
+		}
+	}
+	p.pos += int64(len(data))
+
+	return nil
+}
+
+// read returns length target bytes at off.
+func (p *inPlacePlan) read(off, length int64) ([]byte, error) {
+	data := make([]byte, length)
+	_, err := p.target.ReadAt(data, off)
+	if err != nil && !(errors.Is(err, io.EOF) && off+length == p.targetSize) {
+		return nil, fmt.Errorf("reading the target bytes at %v: %w", off, err)
+	}
+
+	return data, nil
+}
+
+// chunks splits n bytes in chunks of journalChunkSize bytes at most, and passes their offsets and lengths to fn,
+// stopping at the first non-nil error.
+func (p *inPlacePlan) chunks(n int64, fn func(off, length int64) error) error {
+	for off := int64(0); off < n; off += journalChunkSize {
+		err := fn(off, min(n-off, journalChunkSize))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
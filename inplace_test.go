@@ -0,0 +1,233 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// inPlaceVersions returns a target, and the sources derived from it by the in-place tests.
+func inPlaceVersions(blockSize int) (target []byte, sources map[string][]byte) {
+	target = randomBytes(1, 40*blockSize+7)
+	changed := bytes.Clone(target)
+	copy(changed[10*blockSize:], "changed")
+
+	return target, map[string][]byte{
+		"unchanged": target,
+		"changed":   changed,
+		"grown":     append(bytes.Clone(target), randomBytes(2, 5*blockSize)...),
+		"shrunk":    target[:25*blockSize+3],
+		"moved":     append(bytes.Clone(target[20*blockSize:]), target[:20*blockSize]...),
+		"zeros":     append(make([]byte, 3*blockSize), target[3*blockSize:]...),
+	}
+}
+
+// writeInPlaceFiles writes the target and the delta of source to dir, and returns their paths, and the journal's.
+func writeInPlaceFiles(t *testing.T, blockSize int, target, source []byte) (targetPath, deltaPath, journalPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	targetPath, deltaPath, journalPath = filepath.Join(dir, "target"), filepath.Join(dir, "delta"), filepath.Join(dir, "journal")
+	if err := os.WriteFile(targetPath, target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(deltaPath, testDelta(t, New(blockSize, WithSparse(true)), target, source), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	return targetPath, deltaPath, journalPath
+}
+
+// checkFile checks the file at path holds want.
+func checkFile(t *testing.T, path string, want []byte, msg string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%v: the file has %v bytes, want %v bytes, equal %v", msg, len(got), len(want), bytes.Equal(got, want))
+	}
+}
+
+func TestApp_PatchInPlace(t *testing.T) {
+	const blockSize = 32
+	target, sources := inPlaceVersions(blockSize)
+	for name, source := range sources {
+		t.Run(name, func(t *testing.T) {
+			targetPath, deltaPath, journalPath := writeInPlaceFiles(t, blockSize, target, source)
+			if err := New(blockSize).PatchInPlace(targetPath, deltaPath, journalPath); err != nil {
+				t.Fatalf("PatchInPlace() error = %v", err)
+			}
+			checkFile(t, targetPath, source, "PatchInPlace()")
+			if _, err := os.Stat(journalPath); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("PatchInPlace() left the journal, %v", err)
+			}
+		})
+	}
+}
+
+// TestApp_PatchInPlace_Recovery simulates the crashes of an in-place patch, at every point of its target writes, and
+// recovers it both ways.
+func TestApp_PatchInPlace_Recovery(t *testing.T) {
+	const blockSize = 32
+	target, sources := inPlaceVersions(blockSize)
+	for _, name := range []string{"changed", "grown", "shrunk", "moved"} {
+		source := sources[name]
+		t.Run(name, func(t *testing.T) {
+			targetPath, deltaPath, journalPath := writeInPlaceFiles(t, blockSize, target, source)
+			app := New(blockSize)
+			h, cmds, err := app.readInPlaceDelta(deltaPath, int64(len(target)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := journalPatch(bytes.NewReader(target), h, cmds, journalPath); err != nil {
+				t.Fatal(err)
+			}
+			journal, err := os.ReadFile(journalPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var records []journalRecord
+			if _, committed, err := scanJournal(bytes.NewReader(journal), func(rec journalRecord) error {
+				records = append(records, rec)
+				return nil
+			}); err != nil || !committed {
+				t.Fatalf("scanJournal() = %v, %v, want a committed journal", committed, err)
+			}
+
+			for crash := 0; crash <= len(records); crash++ {
+				for _, forward := range []bool{true, false} {
+					crashed := bytes.Clone(target)
+					for _, rec := range records[:crash] {
+						crashed = append(crashed, make([]byte, max(0, int(rec.offset)+len(rec.new)-len(crashed)))...)
+						copy(crashed[rec.offset:], rec.new)
+					}
+					if err := os.WriteFile(targetPath, crashed, 0666); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(journalPath, journal, 0666); err != nil {
+						t.Fatal(err)
+					}
+					if !forward {
+						if err := RollBackPatch(targetPath, journalPath); err != nil {
+							t.Fatalf("RollBackPatch() error = %v", err)
+						}
+						checkFile(t, targetPath, target, "RollBackPatch()")
+						continue
+					}
+					if applied, err := RollForwardPatch(targetPath, journalPath); err != nil || !applied {
+						t.Fatalf("RollForwardPatch() = %v, %v, want true", applied, err)
+					}
+					checkFile(t, targetPath, source, "RollForwardPatch()")
+				}
+			}
+		})
+	}
+}
+
+func TestRollForwardPatch_Uncommitted(t *testing.T) {
+	const blockSize = 32
+	target, sources := inPlaceVersions(blockSize)
+	targetPath, deltaPath, journalPath := writeInPlaceFiles(t, blockSize, target, sources["changed"])
+	if _, err := RollForwardPatch(targetPath, journalPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("RollForwardPatch() without a journal error = %v, want %v", err, fs.ErrNotExist)
+	}
+	h, cmds, err := New(blockSize).readInPlaceDelta(deltaPath, int64(len(target)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := journalPatch(bytes.NewReader(target), h, cmds, journalPath); err != nil {
+		t.Fatal(err)
+	}
+	journal, err := os.ReadFile(journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journal) > 4*blockSize+100 {
+		t.Errorf("the journal of a changed block has %v bytes", len(journal))
+	}
+	if err := New(blockSize).PatchInPlace(targetPath, deltaPath, journalPath); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("PatchInPlace() with an existing journal error = %v, want %v", err, fs.ErrExist)
+	}
+
+	// a journal torn before its commit record leaves the target as it is
+	if err := os.WriteFile(journalPath, journal[:len(journal)-3], 0666); err != nil {
+		t.Fatal(err)
+	}
+	if applied, err := RollForwardPatch(targetPath, journalPath); err != nil || applied {
+		t.Errorf("RollForwardPatch() of a torn journal = %v, %v, want false", applied, err)
+	}
+	checkFile(t, targetPath, target, "RollForwardPatch() of a torn journal")
+	if _, err := os.Stat(journalPath); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("RollForwardPatch() left the journal, %v", err)
+	}
+
+	if err := os.WriteFile(journalPath, []byte("not a journal"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := RollBackPatch(targetPath, journalPath); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("RollBackPatch() of an invalid journal error = %v, want %v", err, ErrCorrupt)
+	}
+}
+
+// failJournalWrites makes the journal writes fail, the i-th one failing if fail(i) is true, until the test ends.
+func failJournalWrites(t *testing.T, fail func(i int) bool) {
+	t.Helper()
+	writeAt := journalWriteAt
+	t.Cleanup(func() { journalWriteAt = writeAt })
+	i := 0
+	journalWriteAt = func(f *os.File, p []byte, off int64) (int, error) {
+		i++
+		if fail(i - 1) {
+			return 0, errors.New("write failure")
+		}
+		return writeAt(f, p, off)
+	}
+}
+
+func TestApp_PatchInPlace_Rollback(t *testing.T) {
+	const blockSize = 32
+	target, sources := inPlaceVersions(blockSize)
+	source := sources["moved"]
+	tests := []struct {
+		name string
+		// fail tells whether the i-th journal write fails
+		fail           func(i int) bool
+		wantRolledBack bool
+	}{
+		{name: "rolled back", fail: func(i int) bool { return i == 1 }, wantRolledBack: true},
+		{name: "failed roll back", fail: func(i int) bool { return i >= 1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targetPath, deltaPath, journalPath := writeInPlaceFiles(t, blockSize, target, source)
+			writeAt := journalWriteAt
+			failJournalWrites(t, tt.fail)
+			err := New(blockSize).PatchInPlace(targetPath, deltaPath, journalPath)
+			var applyErr *ApplyError
+			if !errors.As(err, &applyErr) {
+				t.Fatalf("PatchInPlace() error = %v, want an *ApplyError", err)
+			}
+			if applyErr.RolledBack != tt.wantRolledBack || (applyErr.RollbackErr == nil) != tt.wantRolledBack {
+				t.Errorf("PatchInPlace() error = %+v, want rolled back %v", applyErr, tt.wantRolledBack)
+			}
+			if applyErr.Written <= 0 || applyErr.Size != int64(len(source)) {
+				t.Errorf("PatchInPlace() wrote %v bytes out of %v, want some out of %v", applyErr.Written, applyErr.Size, len(source))
+			}
+			if !tt.wantRolledBack {
+				// the journal is kept, so the patch is rolled back once the writes succeed again
+				journalWriteAt = writeAt
+				if err := RollBackPatch(targetPath, journalPath); err != nil {
+					t.Fatalf("RollBackPatch() error = %v", err)
+				}
+			}
+			checkFile(t, targetPath, target, "PatchInPlace()")
+			if _, err := os.Stat(journalPath); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("the journal is left, %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Package ratelimit limits the bandwidth of readers and writers using a token bucket, every byte consuming a token,
+// so the streams sharing a rate.Limiter share its bandwidth.
+package ratelimit
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// Reader returns r limited by l, the reads waiting for their bytes' tokens until ctx is done.
+// A nil l means r is not limited, and it's returned as is.
+func Reader(ctx context.Context, r io.Reader, l *rate.Limiter) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &reader{ctx: ctx, r: r, l: l}
+}
+
+// Writer returns w limited by l, the writes waiting for their bytes' tokens until ctx is done.
+// A nil l means w is not limited, and it's returned as is.
+func Writer(ctx context.Context, w io.Writer, l *rate.Limiter) io.Writer {
+	if l == nil {
+		return w
+	}
+
+	return &writer{ctx: ctx, w: w, l: l}
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *rate.Limiter
+}
+
+// Read reads at most a burst of bytes, and waits for their tokens, so the bytes received are paced, as the
+// sender is slowed down by the transport flow control.
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p[:chunk(r.l, len(p))])
+	if n > 0 {
+		if werr := r.l.WaitN(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+type writer struct {
+	ctx context.Context
+	w   io.Writer
+	l   *rate.Limiter
+}
+
+// Write writes p a burst of bytes at a time, every one after waiting for its tokens.
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := chunk(w.l, len(p))
+		err := w.l.WaitN(w.ctx, n)
+		if err != nil {
+			return written, err
+		}
+		n, err = w.w.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// chunk returns the number of bytes, out of n, transferred at a time, which is at most the burst of l, as
+// rate.Limiter.WaitN fails for more tokens than the burst. A limiter without a limit doesn't split the transfers.
+func chunk(l *rate.Limiter, n int) int {
+	if l.Limit() == rate.Inf || l.Burst() <= 0 {
+		return n
+	}
+
+	return min(n, l.Burst())
+}
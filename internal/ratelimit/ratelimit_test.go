@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// recordingWriter records the size of every write.
+type recordingWriter struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+
+	return w.Buffer.Write(p)
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name       string
+		limiter    *rate.Limiter
+		size       int
+		wantWrites int
+		// minDuration is the time the tokens of the bytes exceeding the burst take
+		minDuration time.Duration
+	}{
+		{name: "unlimited", size: 10 << 10, wantWrites: 1},
+		{name: "infinite rate", limiter: rate.NewLimiter(rate.Inf, 0), size: 10 << 10, wantWrites: 1},
+		{name: "burst", limiter: rate.NewLimiter(1<<20, 1<<10), size: 10 << 10, wantWrites: 10, minDuration: 8 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got recordingWriter
+			data := bytes.Repeat([]byte{1}, tt.size)
+			start := time.Now()
+			n, err := Writer(context.Background(), &got, tt.limiter).Write(data)
+			if err != nil || n != tt.size {
+				t.Fatalf("Write() = %v, %v, want %v, nil", n, err, tt.size)
+			}
+			if elapsed := time.Since(start); elapsed < tt.minDuration {
+				t.Errorf("Write() took %v, want at least %v", elapsed, tt.minDuration)
+			}
+			if len(got.writes) != tt.wantWrites || !bytes.Equal(got.Bytes(), data) {
+				t.Errorf("Write() wrote %v bytes in %v writes, want %v bytes in %v", got.Len(), len(got.writes), tt.size, tt.wantWrites)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, 10<<10)
+	l := rate.NewLimiter(1<<20, 1<<10)
+	start := time.Now()
+	r := Reader(context.Background(), bytes.NewReader(data), l)
+	buf := make([]byte, 4<<10)
+	n, err := r.Read(buf)
+	if err != nil || n != 1<<10 {
+		t.Fatalf("Read() = %v, %v, want a burst of %v bytes", n, err, 1<<10)
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := append(buf[:n], rest...); !bytes.Equal(got, data) {
+		t.Errorf("read %v bytes, want %v", len(got), len(data))
+	}
+	if elapsed, want := time.Since(start), 8*time.Millisecond; elapsed < want {
+		t.Errorf("reading took %v, want at least %v", elapsed, want)
+	}
+}
+
+func TestLimitCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l := rate.NewLimiter(1, 1)
+	if _, err := Writer(ctx, io.Discard, l).Write([]byte{1, 2}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Write() with a canceled context = %v, want %v", err, context.Canceled)
+	}
+	if _, err := Reader(ctx, bytes.NewReader([]byte{1, 2}), l).Read(make([]byte, 2)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read() with a canceled context = %v, want %v", err, context.Canceled)
+	}
+}
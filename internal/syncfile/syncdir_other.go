@@ -0,0 +1,8 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package syncfile
+
+// syncDir does nothing, as the directories can't be synced on this platform.
+func syncDir(_ string) error {
+	return nil
+}
@@ -0,0 +1,18 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package syncfile
+
+import (
+	"errors"
+	"os"
+)
+
+// syncDir syncs the directory at p, so the entries renamed into it survive a crash.
+func syncDir(p string) error {
+	d, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(d.Sync(), d.Close())
+}
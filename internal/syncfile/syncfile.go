@@ -0,0 +1,84 @@
+// Package syncfile holds the file operations of the sync endpoints: resolving the paths requested under a root
+// directory, opening the files, and replacing them by the outputs of the deltas, atomically.
+package syncfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+var (
+	// ErrInvalidPath is matched by the errors of the requested paths which are not relative paths under the root.
+	ErrInvalidPath = errors.New("invalid file path")
+	// ErrNotRegular is matched by the errors of the requested paths which are not regular files, ex: a directory.
+	ErrNotRegular = errors.New("not a regular file")
+)
+
+// Resolve returns the path of the file identified by the requested path, relative to root, using forward slashes,
+// a leading slash being ignored. The requested path must be clean, and it can't escape root.
+func Resolve(root, requested string) (string, error) {
+	rel := strings.TrimPrefix(requested, "/")
+	if rel == "" || path.Clean(rel) != rel || !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPath, requested)
+	}
+
+	return filepath.Join(root, filepath.FromSlash(rel)), nil
+}
+
+// Open opens the regular file at p, and returns it along with its size.
+func Open(p string) (*os.File, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, errors.Join(err, f.Close())
+	}
+	if !info.Mode().IsRegular() {
+		return nil, 0, errors.Join(fmt.Errorf("%v: %w", filepath.Base(p), ErrNotRegular), f.Close())
+	}
+
+	return f, info.Size(), nil
+}
+
+// Apply applies the delta to the file at p, using app, writing the rebuilt source to a temporary file, in the
+// same directory, which then replaces the file, keeping its permissions, so the file is never partially rebuilt.
+// The temporary file is synced before the rename, and the directory after it, so a crash can't leave the file
+// holding data which was lost, nor lose the replacement once Apply returned.
+func Apply(p string, delta io.Reader, app *rdiff.App) error {
+	f, size, err := Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), "."+filepath.Base(p)+".rdiff-*")
+	if err != nil {
+		return err
+	}
+	err = app.Apply(f, size, delta, tmp)
+	err = errors.Join(err, tmp.Chmod(info.Mode().Perm()))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	err = errors.Join(err, tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(tmp.Name()))
+	}
+
+	return syncDir(filepath.Dir(p))
+}
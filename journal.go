@@ -0,0 +1,320 @@
+package rdiff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// journalMagic starts the journal of an in-place patch.
+var journalMagic = []byte("rdiff journal 1\n")
+
+// journalChunkSize is the maximum number of bytes of a journal record, so a record is held in memory.
+const journalChunkSize = 1 << 20
+
+// The kinds of the journal records.
+const (
+	// journalWrite is the write of a target range, recording its new bytes and its old ones
+	journalWrite = 'w'
+	// journalCommit ends a complete journal, so the target writes can start
+	journalCommit = 'c'
+)
+
+// journalHeader starts the journal: the size of the target before the patch, and after it.
+type journalHeader struct {
+	targetSize int64
+	sourceSize int64
+}
+
+// journalRecord is the write of a target range, at offset: the bytes of the target before the patch, which are
+// missing for the range following the end of the target, and the ones after it, which are missing for the range
+// following the end of the source.
+type journalRecord struct {
+	offset   int64
+	old, new []byte
+}
+
+// journalWriter appends the records of a journal to its file, every record ending with its CRC, so a record torn
+// by a crash is detected.
+type journalWriter struct {
+	f       *os.File
+	bw      *bufio.Writer
+	records int64
+}
+
+// createJournal creates the journal file at path, which must not exist, and writes its header.
+func createJournal(path string, h journalHeader) (*journalWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	j := &journalWriter{f: f, bw: bufio.NewWriter(f)}
+	buf := append(append([]byte(nil), journalMagic...), make([]byte, 16)...)
+	binary.BigEndian.PutUint64(buf[len(journalMagic):], uint64(h.targetSize))
+	binary.BigEndian.PutUint64(buf[len(journalMagic)+8:], uint64(h.sourceSize))
+	err = j.writeChecked(buf)
+	if err != nil {
+		return nil, errors.Join(err, f.Close())
+	}
+
+	return j, nil
+}
+
+// write appends the record of a target write.
+func (j *journalWriter) write(rec journalRecord) error {
+	buf := make([]byte, 25, 25+len(rec.old)+len(rec.new))
+	buf[0] = journalWrite
+	binary.BigEndian.PutUint64(buf[1:], uint64(rec.offset))
+	binary.BigEndian.PutUint64(buf[9:], uint64(len(rec.old)))
+	binary.BigEndian.PutUint64(buf[17:], uint64(len(rec.new)))
+	j.records++
+
+	return j.writeChecked(append(append(buf, rec.old...), rec.new...))
+}
+
+// commit appends the commit record, syncs the journal and closes it. The target can be written once it returns.
+func (j *journalWriter) commit() error {
+	buf := make([]byte, 9)
+	buf[0] = journalCommit
+	binary.BigEndian.PutUint64(buf[1:], uint64(j.records))
+	err := j.writeChecked(buf)
+	if err == nil {
+		err = j.bw.Flush()
+	}
+	if err == nil {
+		err = j.f.Sync()
+	}
+
+	return errors.Join(err, j.f.Close())
+}
+
+// abort closes the journal, which is not committed, and removes it.
+func (j *journalWriter) abort() error {
+	return errors.Join(j.f.Close(), os.Remove(j.f.Name()))
+}
+
+// writeChecked writes p followed by its CRC.
+func (j *journalWriter) writeChecked(p []byte) error {
+	_, err := j.bw.Write(binary.BigEndian.AppendUint32(p, crc32.ChecksumIEEE(p)))
+
+	return err
+}
+
+// scanJournal reads the journal from r, and returns its header, and whether it's committed, calling fn, if not nil,
+// for its write records, in order. The records following a torn or corrupt one are ignored, as the journal wasn't
+// committed, while a corrupt header returns a non-nil error matching ErrCorrupt.
+func scanJournal(r io.Reader, fn func(journalRecord) error) (journalHeader, bool, error) {
+	br := bufio.NewReader(r)
+	buf := make([]byte, len(journalMagic)+16)
+	err := readChecked(br, buf)
+	if err != nil || string(buf[:len(journalMagic)]) != string(journalMagic) {
+		return journalHeader{}, false, markError(ErrCorrupt, errors.New("not a patch journal"))
+	}
+	h := journalHeader{
+		targetSize: int64(binary.BigEndian.Uint64(buf[len(journalMagic):])),
+		sourceSize: int64(binary.BigEndian.Uint64(buf[len(journalMagic)+8:])),
+	}
+	var records int64
+	for {
+		rec, committed, err := readJournalRecord(br, records)
+		if err != nil || committed {
+			return h, committed, nil
+		}
+		records++
+		if fn == nil {
+			continue
+		}
+		err = fn(rec)
+		if err != nil {
+			return h, true, err
+		}
+	}
+}
+
+// readJournalRecord reads the next record, it returns true for the commit record, if it counts the records read
+// before it, and a non-nil error for a torn or corrupt record.
+func readJournalRecord(br *bufio.Reader, records int64) (journalRecord, bool, error) {
+	kind, err := br.Peek(1)
+	if err != nil {
+		return journalRecord{}, false, err
+	}
+	if kind[0] == journalCommit {
+		buf := make([]byte, 9)
+		err = readChecked(br, buf)
+		if err != nil || int64(binary.BigEndian.Uint64(buf[1:])) != records {
+			return journalRecord{}, false, errors.New("invalid commit record")
+		}
+		return journalRecord{}, true, nil
+	}
+	head, err := br.Peek(25)
+	if err != nil || head[0] != journalWrite {
+		return journalRecord{}, false, errors.New("invalid write record")
+	}
+	oldLen, newLen := binary.BigEndian.Uint64(head[9:]), binary.BigEndian.Uint64(head[17:])
+	if oldLen > journalChunkSize || newLen > journalChunkSize {
+		return journalRecord{}, false, errors.New("invalid write record")
+	}
+	buf := make([]byte, 25+oldLen+newLen)
+	err = readChecked(br, buf)
+	if err != nil {
+		return journalRecord{}, false, err
+	}
+
+	return journalRecord{
+		offset: int64(binary.BigEndian.Uint64(buf[1:])),
+		old:    buf[25 : 25+oldLen],
+		new:    buf[25+oldLen:],
+	}, false, nil
+}
+
+// readChecked fills p, and checks the CRC following it.
+func readChecked(r io.Reader, p []byte) error {
+	_, err := io.ReadFull(r, p)
+	if err != nil {
+		return err
+	}
+	var crc [4]byte
+	_, err = io.ReadFull(r, crc[:])
+	if err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(crc[:]) != crc32.ChecksumIEEE(p) {
+		return errors.New("CRC mismatch")
+	}
+
+	return nil
+}
+
+// RollForwardPatch completes the in-place patch of the target file(targetFilePath) interrupted by a crash, see
+// PatchInPlace, using its journal(journalPath), and removes the journal. It returns true if the patch is complete,
+// and false if it was interrupted before its journal was committed, in which case the target is unchanged, and the
+// patch must be run again. A failure, including a target which doesn't hold the journaled bytes once written,
+// matching ErrVerification, keeps the journal, so the patch can be rolled back.
+// It can be run again if it's interrupted too, and it returns a non-nil error matching fs.ErrNotExist if the journal
+// doesn't exist, so there is no patch to recover.
+func RollForwardPatch(targetFilePath, journalPath string) (bool, error) {
+	return recoverPatch(targetFilePath, journalPath, true)
+}
+
+// RollBackPatch undoes the in-place patch of the target file(targetFilePath) interrupted by a crash, see PatchInPlace,
+// using its journal(journalPath), and removes the journal, so the target is left as it was before the patch.
+// It can be run again if it's interrupted too, and it returns a non-nil error matching fs.ErrNotExist if the journal
+// doesn't exist, so there is no patch to recover.
+func RollBackPatch(targetFilePath, journalPath string) error {
+	_, err := recoverPatch(targetFilePath, journalPath, false)
+
+	return err
+}
+
+// recoverPatch rolls the patch journaled at journalPath forward, or back, and removes the journal. It returns whether
+// the patch is applied.
+func recoverPatch(targetFilePath, journalPath string, forward bool) (bool, error) {
+	journal, err := os.Open(journalPath)
+	if err != nil {
+		return false, err
+	}
+	_, committed, err := scanJournal(journal, nil)
+	if err == nil && committed {
+		_, err = replayJournal(targetFilePath, journal, forward)
+	}
+	// the journal is only read, and it's closed before it's removed
+	_ = journal.Close()
+	if err != nil {
+		return false, err
+	}
+
+	return committed && forward, os.Remove(journalPath)
+}
+
+// journalWriteAt writes the journaled bytes to the target, it's replaced by the tests simulating write failures.
+var journalWriteAt = (*os.File).WriteAt
+
+// replayJournal writes the new bytes of every record of the committed journal to the target, and sets it to the
+// source size, if forward, otherwise it writes the old bytes, and sets it to its size before the patch. The target
+// is synced once it's written, so the journal can be removed, and it's checked after a roll forward, by reading back
+// the bytes written, so a target changed by another writer meanwhile returns a non-nil error matching ErrVerification.
+// The read back is served from the page cache, so it doesn't prove the bytes reached the storage, the sync does.
+// It returns the number of bytes written.
+func replayJournal(targetFilePath string, journal io.ReadSeeker, forward bool) (int64, error) {
+	target, err := os.OpenFile(targetFilePath, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	written, err := replayRecords(target, journal, forward)
+	if err == nil && forward {
+		err = verifyJournal(target, journal)
+	}
+	if err != nil {
+		return written, errors.Join(fmt.Errorf("replaying the patch journal: %w", err), target.Close())
+	}
+
+	return written, target.Close()
+}
+
+// replayRecords writes the records of the journal to the target, sets its size, and syncs it, see replayJournal.
+func replayRecords(target *os.File, journal io.ReadSeeker, forward bool) (int64, error) {
+	_, err := journal.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	var written int64
+	h, _, err := scanJournal(journal, func(rec journalRecord) error {
+		data := rec.old
+		if forward {
+			data = rec.new
+		}
+		n, err := journalWriteAt(target, data, rec.offset)
+		written += int64(n)
+		return err
+	})
+	if err != nil {
+		return written, err
+	}
+	size := h.targetSize
+	if forward {
+		size = h.sourceSize
+	}
+	err = target.Truncate(size)
+	if err != nil {
+		return written, err
+	}
+
+	return written, target.Sync()
+}
+
+// verifyJournal reads back the new bytes of every record of the journal from the target, and checks the target has
+// the source size. It checks what the target holds now, as seen through the page cache, not what the storage holds.
+func verifyJournal(target *os.File, journal io.ReadSeeker) error {
+	_, err := journal.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	h, _, err := scanJournal(journal, func(rec journalRecord) error {
+		data := make([]byte, len(rec.new))
+		_, err := target.ReadAt(data, rec.offset)
+		if err != nil {
+			return fmt.Errorf("reading back the target bytes at %v: %w", rec.offset, err)
+		}
+		if !bytes.Equal(data, rec.new) {
+			return markError(ErrVerification, fmt.Errorf("the target bytes at %v don't match the ones written", rec.offset))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	info, err := target.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != h.sourceSize {
+		return markError(ErrVerification, fmt.Errorf("the patched target has %v bytes, but the source has %v bytes", info.Size(), h.sourceSize))
+	}
+
+	return nil
+}
@@ -0,0 +1,420 @@
+package rdiff
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"slices"
+
+	"github.com/silviutanasa/rdiff/rollsum"
+)
+
+// the librsync magic numbers, the first 4 bytes, big endian, of its signature and delta files
+const (
+	librsyncDeltaMagic       = 0x72730236
+	librsyncMD4SigMagic      = 0x72730136
+	librsyncBLAKE2SigMagic   = 0x72730137
+	librsyncRKMD4SigMagic    = 0x72730146
+	librsyncRKBLAKE2SigMagic = 0x72730147
+)
+
+// the librsync delta commands
+const (
+	librsyncOpEnd = 0x00
+	// librsyncOpLiteral1 is a literal of 1 byte, up to librsyncOpLiteral1+librsyncMaxImmediate-1, for 64 bytes
+	librsyncOpLiteral1 = 0x01
+	// librsyncOpLiteralN1 is a literal with its length in the following byte, followed by the commands for
+	// the 2, 4 and 8 bytes lengths
+	librsyncOpLiteralN1 = 0x41
+	// librsyncOpCopyN1N1 is a copy with its offset and length in the following 2 bytes, followed by the commands
+	// for the other offset and length sizes: librsyncOpCopyN1N1 + 4*offset size index + length size index
+	librsyncOpCopyN1N1 = 0x45
+	// librsyncOpReserved is the first command without a meaning
+	librsyncOpReserved = 0x55
+	// librsyncMaxImmediate is the max literal length encoded in the command
+	librsyncMaxImmediate = 64
+)
+
+// librsyncSignatureHashes identifies the hash algorithms of the librsync signatures with the given magic.
+type librsyncSignatureHashes struct {
+	magic  uint32
+	weak   WeakHashType
+	strong StrongHashType
+}
+
+// librsyncSignatureMagics lists the librsync signature magics.
+var librsyncSignatureMagics = []librsyncSignatureHashes{
+	{magic: librsyncMD4SigMagic, weak: WeakHashLibrsync, strong: StrongHashMD4},
+	{magic: librsyncBLAKE2SigMagic, weak: WeakHashLibrsync, strong: StrongHashBLAKE2b},
+	{magic: librsyncRKMD4SigMagic, weak: WeakHashRabinKarp, strong: StrongHashMD4},
+	{magic: librsyncRKBLAKE2SigMagic, weak: WeakHashRabinKarp, strong: StrongHashBLAKE2b},
+}
+
+// useLibrsyncHashes configures the hash algorithms not configured explicitly to the librsync defaults: RabinKarp
+// and BLAKE2b. It returns a non-nil error if the configuration can't be written as a librsync signature.
+func (r *rDiff) useLibrsyncHashes() error {
+	if !r.weakHashPinned {
+		r.weakHashType, r.weakHasher = WeakHashRabinKarp, rollsum.NewRabinKarp()
+	}
+	if !r.strongHashPinned {
+		r.strongHashType = StrongHashBLAKE2b
+		r.strongHasher, _ = newStrongHash(StrongHashBLAKE2b, r.strongHashKey)
+	}
+	if len(r.strongHashKey) > 0 {
+		return errors.New("the librsync format doesn't support a keyed strong hash")
+	}
+	_, err := librsyncSignatureMagic(r.weakHashType, r.strongHashType)
+
+	return err
+}
+
+// librsyncSignatureMagic returns the magic of the librsync signatures using the given hash algorithms.
+func librsyncSignatureMagic(weak WeakHashType, strong StrongHashType) (uint32, error) {
+	for _, m := range librsyncSignatureMagics {
+		if m.weak == weak && m.strong == strong {
+			return m.magic, nil
+		}
+	}
+
+	return 0, fmt.Errorf(
+		"the librsync format doesn't support the %v weak hash with the %v strong hash, it supports %v or %v, with %v or %v",
+		weak, strong, WeakHashRabinKarp, WeakHashLibrsync, StrongHashBLAKE2b, StrongHashMD4,
+	)
+}
+
+// writeSignatureLibrsync serializes the signature as a librsync signature: the magic, the block size and
+// the strong hash size, followed by the weak hash and the strong hash of every block, the integers being
+// 4 bytes big endian.
+func writeSignatureLibrsync(w io.Writer, blockSize int, header SignatureHeader, t signatureTable) error {
+	magic, err := librsyncSignatureMagic(header.WeakHash, header.StrongHash)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	buf = binary.BigEndian.AppendUint32(buf, magic)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(blockSize))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(header.StrongHashSize))
+	for i := 0; i < t.len(); i++ {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(t.WeakHashes[i]))
+		buf = append(buf, t.strongHash(i)...)
+		_, err = bw.Write(buf)
+		if err != nil {
+			return err
+		}
+		buf = buf[:0]
+	}
+	_, err = bw.Write(buf)
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// readSignatureLibrsync deserializes a librsync signature, written by writeSignatureLibrsync or by librsync,
+// and returns its header, table and block size. Its blocks are bounded by the limits.
+func readSignatureLibrsync(r io.Reader, limits DecodeLimits) (SignatureHeader, signatureTable, int, error) {
+	br := bufio.NewReader(r)
+	var params [3]uint32
+	err := binary.Read(br, binary.BigEndian, &params)
+	if err != nil {
+		err = fmt.Errorf("reading the librsync signature header: %w", err)
+		return SignatureHeader{}, signatureTable{}, 0, markError(ErrCorrupt, err)
+	}
+	header, blockSize, err := parseLibrsyncSignatureHeader(params[0], params[1], params[2])
+	if err != nil {
+		return SignatureHeader{}, signatureTable{}, 0, markError(ErrCorrupt, err)
+	}
+
+	var t signatureTable
+	block := make([]byte, 4+header.StrongHashSize)
+	for {
+		_, err = io.ReadFull(br, block)
+		if errors.Is(err, io.EOF) {
+			return header, t, blockSize, nil
+		}
+		if err != nil {
+			err = fmt.Errorf("reading the librsync signature blocks: %w", err)
+			return SignatureHeader{}, signatureTable{}, 0, markError(ErrCorrupt, err)
+		}
+		err = limits.checkBlocks(len(t.WeakHashes) + 1)
+		if err != nil {
+			return SignatureHeader{}, signatureTable{}, 0, err
+		}
+		t.WeakHashes = append(t.WeakHashes, uint64(binary.BigEndian.Uint32(block)))
+		t.StrongHashes = append(t.StrongHashes, block[4:]...)
+	}
+}
+
+// parseLibrsyncSignatureHeader validates the librsync signature header fields and returns the equivalent header,
+// and the block size.
+func parseLibrsyncSignatureHeader(magic, blockSize, strongHashSize uint32) (SignatureHeader, int, error) {
+	i := slices.IndexFunc(librsyncSignatureMagics, func(m librsyncSignatureHashes) bool { return m.magic == magic })
+	if i < 0 {
+		return SignatureHeader{}, 0, fmt.Errorf("unknown librsync signature magic: %#x", magic)
+	}
+	if blockSize == 0 || blockSize > MaxBlockSize {
+		return SignatureHeader{}, 0, fmt.Errorf("invalid librsync signature block size: %v", blockSize)
+	}
+	header := SignatureHeader{
+		WeakHash:       librsyncSignatureMagics[i].weak,
+		StrongHash:     librsyncSignatureMagics[i].strong,
+		StrongHashSize: int(strongHashSize),
+	}
+	strongHasher, _ := newStrongHash(header.StrongHash, nil)
+	if strongHashSize == 0 || int(strongHashSize) > strongHasher.Size() {
+		return SignatureHeader{}, 0, fmt.Errorf(
+			"the librsync signature strong hash size(%v) is out of the supported range [1, %v]",
+			strongHashSize,
+			strongHasher.Size(),
+		)
+	}
+
+	return header, int(blockSize), nil
+}
+
+// librsyncDeltaWriter serializes the delta operations as librsync delta commands: the literal data of an operation
+// is a literal command, and its target block is a copy command, the adjacent copies being merged, as librsync does.
+type librsyncDeltaWriter struct {
+	w          *bufio.Writer
+	blockSize  int
+	sourceSize int64
+	// encoded is the number of source bytes encoded so far
+	encoded int64
+	// the pending copy, which is extended by the following adjacent blocks
+	copyOff, copyLen int64
+}
+
+// writeDeltaLibrsync computes the delta using compute, and serializes its operations as they are emitted, as
+// a librsync delta: the magic, followed by the commands, and the end command.
+// The librsync signatures don't record the target size, so the size of the last target block, which may be
+// shorter than the block size, is deduced from the source size: a short block is only matched by the end
+// of the source.
+func writeDeltaLibrsync(w io.Writer, blockSize int, sourceSize int64, compute func(emit func(Operation) error) error) error {
+	dw := &librsyncDeltaWriter{w: bufio.NewWriter(w), blockSize: blockSize, sourceSize: sourceSize}
+	err := binary.Write(dw.w, binary.BigEndian, uint32(librsyncDeltaMagic))
+	if err != nil {
+		return err
+	}
+	err = compute(dw.operation)
+	if err != nil {
+		return err
+	}
+	err = dw.flushCopy()
+	if err != nil {
+		return err
+	}
+	err = dw.w.WriteByte(librsyncOpEnd)
+	if err != nil {
+		return err
+	}
+
+	return dw.w.Flush()
+}
+
+func (dw *librsyncDeltaWriter) operation(op Operation) error {
+	if op.Type == OpBlockZero {
+		// the format has no zero runs, so they're sent as literal data
+		err := dw.flushCopy()
+		if err != nil {
+			return err
+		}
+		return zeroChunks(op.Zeros, dw.literal)
+	}
+	if len(op.Data) > 0 {
+		err := dw.flushCopy()
+		if err != nil {
+			return err
+		}
+		err = dw.literal(op.Data)
+		if err != nil {
+			return err
+		}
+	}
+	if !op.Type.copiesBlock() {
+		return nil
+	}
+
+	off := int64(op.BlockIndex) * int64(dw.blockSize)
+	length := min(int64(dw.blockSize), dw.sourceSize-dw.encoded)
+	if op.BlockIndex < 0 || length <= 0 {
+		return fmt.Errorf("the block %v is out of the source size(%v)", op.BlockIndex, dw.sourceSize)
+	}
+	dw.encoded += length
+	if dw.copyLen > 0 && dw.copyOff+dw.copyLen == off {
+		dw.copyLen += length
+		return nil
+	}
+	err := dw.flushCopy()
+	dw.copyOff, dw.copyLen = off, length
+
+	return err
+}
+
+// literal writes a literal command, followed by data.
+func (dw *librsyncDeltaWriter) literal(data []byte) error {
+	var cmd []byte
+	if len(data) <= librsyncMaxImmediate {
+		cmd = append(cmd, byte(librsyncOpLiteral1+len(data)-1))
+	} else {
+		size := librsyncIntSize(int64(len(data)))
+		cmd = append(cmd, byte(librsyncOpLiteralN1+librsyncIntSizeIndex(size)))
+		cmd = appendLibrsyncInt(cmd, int64(len(data)), size)
+	}
+	_, err := dw.w.Write(cmd)
+	if err != nil {
+		return err
+	}
+	_, err = dw.w.Write(data)
+	dw.encoded += int64(len(data))
+
+	return err
+}
+
+// flushCopy writes the pending copy command, if any.
+func (dw *librsyncDeltaWriter) flushCopy() error {
+	if dw.copyLen == 0 {
+		return nil
+	}
+	offSize, lenSize := librsyncIntSize(dw.copyOff), librsyncIntSize(dw.copyLen)
+	cmd := []byte{byte(librsyncOpCopyN1N1 + 4*librsyncIntSizeIndex(offSize) + librsyncIntSizeIndex(lenSize))}
+	cmd = appendLibrsyncInt(cmd, dw.copyOff, offSize)
+	cmd = appendLibrsyncInt(cmd, dw.copyLen, lenSize)
+	dw.copyLen = 0
+	_, err := dw.w.Write(cmd)
+
+	return err
+}
+
+// applyLibrsync applies the commands of a librsync delta, written by writeDeltaLibrsync or by librsync, copying
+// the target ranges and the literal data to output.
+func (r *rDiff) applyLibrsync(target io.ReaderAt, targetSize int64, delta io.Reader, output io.Writer) error {
+	br := bufio.NewReader(delta)
+	var magic uint32
+	err := binary.Read(br, binary.BigEndian, &magic)
+	if err != nil {
+		return markError(ErrCorrupt, fmt.Errorf("reading the librsync delta header: %w", err))
+	}
+	if magic != librsyncDeltaMagic {
+		return markError(ErrCorrupt, fmt.Errorf("unknown librsync delta magic: %#x", magic))
+	}
+	r.patchStats = PatchStats{}
+	bw := bufio.NewWriter(output)
+	for {
+		cmd, err := br.ReadByte()
+		if err != nil {
+			return markError(ErrCorrupt, fmt.Errorf("reading the librsync delta commands: %w", noEOF(err)))
+		}
+		switch {
+		case cmd == librsyncOpEnd:
+			return bw.Flush()
+		case cmd < librsyncOpCopyN1N1:
+			err = r.applyLibrsyncLiteral(br, cmd, bw)
+		case cmd < librsyncOpReserved:
+			err = r.applyLibrsyncCopy(br, cmd, target, targetSize, bw)
+		default:
+			err = markError(ErrCorrupt, fmt.Errorf("invalid librsync delta command: %#x", cmd))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *rDiff) applyLibrsyncLiteral(br *bufio.Reader, cmd byte, output io.Writer) error {
+	length := int64(cmd - librsyncOpLiteral1 + 1)
+	if cmd >= librsyncOpLiteralN1 {
+		var err error
+		length, err = readLibrsyncInt(br, 1<<(cmd-librsyncOpLiteralN1))
+		if err != nil {
+			return err
+		}
+	}
+	n, err := io.CopyN(output, br, length)
+	r.patchStats.LiteralBytes += n
+	if err != nil {
+		return markError(ErrCorrupt, fmt.Errorf("reading the librsync delta literal: %w", noEOF(err)))
+	}
+
+	return nil
+}
+
+func (r *rDiff) applyLibrsyncCopy(br *bufio.Reader, cmd byte, target io.ReaderAt, targetSize int64, output io.Writer) error {
+	idx := cmd - librsyncOpCopyN1N1
+	off, err := readLibrsyncInt(br, 1<<(idx/4))
+	if err != nil {
+		return err
+	}
+	length, err := readLibrsyncInt(br, 1<<(idx%4))
+	if err != nil {
+		return err
+	}
+	// the 8 bytes integers may be negative
+	if off < 0 || length < 0 || off > targetSize || length > targetSize-off {
+		err = fmt.Errorf("the copy of %v bytes at %v is out of the target size(%v)", length, off, targetSize)
+		return markError(ErrCorrupt, err)
+	}
+	_, err = io.Copy(output, io.NewSectionReader(target, off, length))
+	if err != nil {
+		return fmt.Errorf("copying the target bytes at %v: %w", off, err)
+	}
+	r.patchStats.CopiedBlocks++
+	r.patchStats.CopiedBytes += length
+
+	return nil
+}
+
+// librsyncIntSize returns the smallest size, in bytes, of the librsync integers(1, 2, 4 or 8) able to hold v.
+func librsyncIntSize(v int64) int {
+	switch {
+	case v <= 0xff:
+		return 1
+	case v <= 0xffff:
+		return 2
+	case v <= 0xffffffff:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// librsyncIntSizeIndex returns the index of an integer size in the sequence 1, 2, 4, 8.
+func librsyncIntSizeIndex(size int) int {
+	return bits.TrailingZeros(uint(size))
+}
+
+// appendLibrsyncInt appends v as a big endian integer of the given size.
+func appendLibrsyncInt(b []byte, v int64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		b = append(b, byte(v>>(8*i)))
+	}
+
+	return b
+}
+
+// readLibrsyncInt reads a big endian integer of the given size.
+func readLibrsyncInt(br *bufio.Reader, size int) (int64, error) {
+	var v int64
+	for i := 0; i < size; i++ {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, markError(ErrCorrupt, fmt.Errorf("reading the librsync delta command parameters: %w", noEOF(err)))
+		}
+		v = v<<8 | int64(b)
+	}
+
+	return v, nil
+}
+
+// noEOF converts io.EOF to io.ErrUnexpectedEOF, for the reads which can't end the input.
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,278 @@
+package rdiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/silviutanasa/rdiff/rollsum"
+	"golang.org/x/crypto/blake2b"
+)
+
+// TestWriteSignatureLibrsync checks the signature layout against the librsync definition.
+func TestWriteSignatureLibrsync(t *testing.T) {
+	target := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	r := newTestRDiff(16, rDiffE2EConfig{weakHash: WeakHashRabinKarp, strongHash: StrongHashBLAKE2b, strongHashSize: 8})
+	sig, err := r.ComputeSignature(bytes.NewReader(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bytes.Buffer
+	if err = writeSignatureLibrsync(&got, 16, r.signatureHeader(), sig); err != nil {
+		t.Fatalf("writeSignatureLibrsync() error = %v", err)
+	}
+
+	want := []byte{0x72, 0x73, 0x01, 0x47, 0, 0, 0, 16, 0, 0, 0, 8}
+	for _, block := range [][]byte{target[:16], target[16:32], target[32:]} {
+		weak := rollsum.NewRabinKarp()
+		weak.WriteAll(block)
+		strong := blake2b.Sum256(block)
+		want = binary.BigEndian.AppendUint32(want, weak.Sum32())
+		want = append(want, strong[:8]...)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("writeSignatureLibrsync() = %x, want %x", got.Bytes(), want)
+	}
+
+	header, gotSig, blockSize, err := readSignatureLibrsync(&got, DecodeLimits{})
+	if err != nil {
+		t.Fatalf("readSignatureLibrsync() error = %v", err)
+	}
+	wantHeader := SignatureHeader{WeakHash: WeakHashRabinKarp, StrongHash: StrongHashBLAKE2b, StrongHashSize: 8}
+	if diff := cmp.Diff(header, wantHeader); blockSize != 16 || diff != "" {
+		t.Errorf("readSignatureLibrsync() block size = %v, want 16, header differs, \nDIFF: %v", blockSize, diff)
+	}
+	if diff := cmp.Diff(gotSig, sig); diff != "" {
+		t.Errorf("readSignatureLibrsync() table differs, \nDIFF: %v", diff)
+	}
+}
+
+func TestReadSignatureLibrsync_Invalid(t *testing.T) {
+	header := func(magic, blockSize, strongHashSize uint32) []byte {
+		return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, magic), blockSize), strongHashSize)
+	}
+	for _, in := range [][]byte{
+		{0x72, 0x73},
+		header(librsyncDeltaMagic, 16, 8),
+		header(librsyncRKBLAKE2SigMagic, 0, 8),
+		header(librsyncRKBLAKE2SigMagic, MaxBlockSize+1, 8),
+		header(librsyncRKMD4SigMagic, 16, 17),
+		header(librsyncRKBLAKE2SigMagic, 16, 0),
+		// a truncated block
+		append(header(librsyncMD4SigMagic, 16, 8), 1, 2, 3, 4, 5),
+	} {
+		if _, _, _, err := readSignatureLibrsync(bytes.NewReader(in), DecodeLimits{}); err == nil {
+			t.Errorf("readSignatureLibrsync(%x) error = nil, want an error", in)
+		}
+	}
+}
+
+func TestWriteDeltaLibrsync(t *testing.T) {
+	long := bytes.Repeat([]byte{7}, 300)
+	ops := []Operation{
+		{Type: OpBlockUpdate, BlockIndex: 0, Data: []byte{1, 2}},
+		// adjacent to the previous block, so the copies are merged
+		{Type: OpBlockKeep, BlockIndex: 1},
+		{Type: OpBlockRemove, BlockIndex: 2},
+		{Type: OpBlockKeep, BlockIndex: 300},
+		// the last block is shorter than the block size
+		{Type: OpBlockUpdate, BlockIndex: 301, Data: long},
+	}
+	var got bytes.Buffer
+	err := writeDeltaLibrsync(&got, 100, 2+100+100+100+300+50, func(emit func(Operation) error) error {
+		for _, op := range ops {
+			if err := emit(op); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("writeDeltaLibrsync() error = %v", err)
+	}
+	want := []byte{0x72, 0x73, 0x02, 0x36}
+	// the literal of 2 bytes, then the copy of 200 bytes at 0: 1 byte offset and 1 byte length
+	want = append(want, 0x02, 1, 2, 0x45, 0, 200)
+	// the copy of 100 bytes at 30000: 2 bytes offset and 1 byte length
+	want = append(want, 0x49, 0x75, 0x30, 100)
+	// the literal of 300 bytes, with its length in 2 bytes
+	want = append(append(want, 0x42, 0x01, 0x2c), long...)
+	// the copy of the last 50 bytes at 30100, and the end
+	want = append(want, 0x49, 0x75, 0x94, 50, 0)
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("writeDeltaLibrsync() = %x, want %x", got.Bytes(), want)
+	}
+}
+
+func TestRDiff_ApplyLibrsync(t *testing.T) {
+	target := make([]byte, 70000)
+	for i := range target {
+		target[i] = byte(i)
+	}
+	magic := []byte{0x72, 0x73, 0x02, 0x36}
+	cmds := func(cmds ...[]byte) []byte {
+		return bytes.Join(append([][]byte{magic}, cmds...), nil)
+	}
+	literal := bytes.Repeat([]byte{9}, 65)
+	for _, tt := range []struct {
+		name    string
+		in      []byte
+		out     []byte
+		wantErr bool
+	}{
+		{name: "empty", in: cmds([]byte{0}), out: []byte{}},
+		{
+			name: "all the commands sizes",
+			in: cmds(
+				[]byte{0x03, 'a', 'b', 'c'},
+				append([]byte{0x41, 65}, literal...),
+				// copy, 1 byte offset, 8 bytes length
+				[]byte{0x48, 10, 0, 0, 0, 0, 0, 0, 0, 5},
+				// copy, 4 bytes offset, 2 bytes length
+				[]byte{0x4e, 0, 1, 0x11, 0x6d, 0, 3},
+				// copy, 8 bytes offset, 4 bytes length
+				[]byte{0x53, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 2},
+				[]byte{0x00},
+				// ignored, after the end
+				[]byte{0xff},
+			),
+			out: bytes.Join([][]byte{[]byte("abc"), literal, target[10:15], target[70000-3 : 70000], target[1:3]}, nil),
+		},
+		{name: "invalid magic", in: []byte{0x72, 0x73, 0x01, 0x36, 0}, wantErr: true},
+		{name: "no end", in: cmds([]byte{0x01, 'a'}), wantErr: true},
+		{name: "truncated literal", in: cmds([]byte{0x03, 'a'}), wantErr: true},
+		{name: "truncated copy", in: cmds([]byte{0x49, 0}), wantErr: true},
+		{name: "reserved command", in: cmds([]byte{0x55, 0}), wantErr: true},
+		{name: "copy out of the target", in: cmds([]byte{0x4d, 0, 1, 0x11, 0x6d, 4, 0}), wantErr: true},
+		{name: "negative copy offset", in: cmds([]byte{0x51, 0xff, 0, 0, 0, 0, 0, 0, 0, 1, 0}), wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bytes.Buffer
+			err := newTestRDiff(16, rDiffE2EConfig{}).applyLibrsync(bytes.NewReader(target), int64(len(target)), bytes.NewReader(tt.in), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyLibrsync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !bytes.Equal(got.Bytes(), tt.out) {
+				t.Errorf("applyLibrsync() = %v, want %v", got.Bytes(), tt.out)
+			}
+		})
+	}
+}
+
+// TestLibrsyncE2E runs the E2E suite through the librsync signature and delta formats, for every librsync hash pair,
+// checking the delta rebuilds the source.
+func TestLibrsyncE2E(t *testing.T) {
+	for _, m := range librsyncSignatureMagics {
+		for _, tt := range rDiffE2ETests {
+			inp := tt.in
+			if tt.wantErr || inp.blockSize <= 0 {
+				continue
+			}
+			r := newTestRDiff(inp.blockSize, rDiffE2EConfig{weakHash: m.weak, strongHash: m.strong})
+			sig, err := r.ComputeSignature(bytes.NewReader(inp.target))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sigBuf, deltaBuf, got bytes.Buffer
+			if err = writeSignatureLibrsync(&sigBuf, inp.blockSize, r.signatureHeader(), sig); err != nil {
+				t.Fatal(err)
+			}
+			header, sig, blockSize, err := readSignatureLibrsync(&sigBuf, DecodeLimits{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := newTestRDiff(blockSize, rDiffE2EConfig{})
+			err = writeDeltaLibrsync(&deltaBuf, blockSize, int64(len(inp.source)), func(emit func(Operation) error) error {
+				return d.ComputeDeltaFunc(bytes.NewReader(inp.source), header, sig, emit)
+			})
+			if err != nil {
+				t.Fatalf("writeDeltaLibrsync() error = %v", err)
+			}
+			err = d.applyLibrsync(bytes.NewReader(inp.target), int64(len(inp.target)), &deltaBuf, &got)
+			if err != nil {
+				t.Fatalf("applyLibrsync() error = %v", err)
+			}
+			if !bytes.Equal(got.Bytes(), inp.source) {
+				t.Errorf("librsync E2E(%#x) = %v, want %v", m.magic, got.Bytes(), inp.source)
+			}
+		}
+	}
+}
+
+func TestRDiff_UseLibrsyncHashes(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		opts    []Option
+		weak    WeakHashType
+		strong  StrongHashType
+		wantErr bool
+	}{
+		{name: "defaults", weak: WeakHashRabinKarp, strong: StrongHashBLAKE2b},
+		{name: "pinned", opts: []Option{WithWeakHash(WeakHashLibrsync), WithStrongHash(StrongHashMD4)}, weak: WeakHashLibrsync, strong: StrongHashMD4},
+		{name: "unsupported weak hash", opts: []Option{WithWeakHash(WeakHashAdler32)}, wantErr: true},
+		{name: "unsupported strong hash", opts: []Option{WithStrongHash(StrongHashSHA256)}, wantErr: true},
+		{name: "keyed", opts: []Option{WithStrongHashKey([]byte("key"))}, wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := New(16, tt.opts...).diffEngine
+			err := r.useLibrsyncHashes()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("useLibrsyncHashes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (r.weakHashType != tt.weak || r.strongHashType != tt.strong) {
+				t.Errorf("useLibrsyncHashes() = %v, %v, want %v, %v", r.weakHashType, r.strongHashType, tt.weak, tt.strong)
+			}
+		})
+	}
+}
+
+func TestApp_WithFormat_Librsync(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	// the last target block is shorter than the block size
+	target := make([]byte, 10500)
+	rand.New(rand.NewSource(1)).Read(target)
+	source := bytes.Join([][]byte{[]byte("new data"), target[2000:7005], target[:1003], target[10000:]}, nil)
+	if err := os.WriteFile(path("target"), target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("source"), source, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(1000, WithFormat(FormatLibrsync)).Signature(path("target"), path("signature")); err != nil {
+		t.Fatalf("Signature() error = %v", err)
+	}
+	// the block size is adopted from the signature
+	if err := New(7, WithFormat(FormatLibrsync), WithConcurrency(2)).Delta(path("signature"), path("source"), path("delta")); err != nil {
+		t.Fatalf("Delta() error = %v", err)
+	}
+	app := New(7, WithFormat(FormatLibrsync))
+	if err := app.Patch(path("target"), path("delta"), path("output")); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	got, err := os.ReadFile(path("output"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, source) {
+		t.Errorf("the patched output differs from the source")
+	}
+	if stats := app.LastPatchStats(); stats.CopiedBytes+stats.LiteralBytes != int64(len(source)) {
+		t.Errorf("LastPatchStats() = %+v, want a total of %v bytes", stats, len(source))
+	}
+
+	// the gob signature is not a librsync signature
+	if err = New(1000).Signature(path("target"), path("gob_signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err = New(1000, WithFormat(FormatLibrsync)).Delta(path("gob_signature"), path("source"), path("delta2")); err == nil {
+		t.Errorf("Delta() error = nil, want an error for a gob signature")
+	}
+	if err = New(1000, WithFormat(FormatLibrsync), WithStrongHash(StrongHashMD5)).Signature(path("target"), path("signature2")); err == nil {
+		t.Errorf("Signature() error = nil, want an error for the md5 strong hash")
+	}
+}
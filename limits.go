@@ -0,0 +1,156 @@
+package rdiff
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	// DefaultMaxBlocks is the default max number of blocks of a decoded signature, ex: the signature of a 64GiB
+	// target, using 4KiB blocks.
+	DefaultMaxBlocks = 1 << 24
+	// DefaultMaxOperations is the default max number of operations of a decoded delta.
+	DefaultMaxOperations = 1 << 30
+	// DefaultMaxLiteral is the default max length, in bytes, of the literal data of a decoded delta operation.
+	DefaultMaxLiteral = 64 << 20
+)
+
+// maxBlockRecord is the max size, in bytes, of a gob encoded block of a signature table: a weak hash, and a strong
+// hash of at most maxStrongHashSize bytes.
+const maxBlockRecord = 9 + maxStrongHashSize
+
+// maxRecordOverhead is the max size, in bytes, of the fields of a gob message besides its blocks or literal data.
+const maxRecordOverhead = 4 << 10
+
+// DecodeLimits bounds the signatures and deltas decoded, so a crafted artifact can't demand gigabytes of
+// allocations: the decoding fails as soon as a limit is exceeded, before the memory is allocated, with an error
+// matching ErrCorrupt. A field <= 0 means its default limit, see WithDecodeLimits.
+type DecodeLimits struct {
+	// MaxBlocks is the max number of blocks of a signature, or of a file of a directory signature,
+	// DefaultMaxBlocks by default
+	MaxBlocks int
+	// MaxOperations is the max number of operations of a delta, or of a directory delta, DefaultMaxOperations by
+	// default
+	MaxOperations int64
+	// MaxLiteral is the max length, in bytes, of the literal data of a delta operation, DefaultMaxLiteral by
+	// default. The deltas computed split the longer literal runs, so they don't exceed it.
+	MaxLiteral int
+}
+
+// withDefaults returns the limits, the ones <= 0 being replaced by their defaults.
+func (l DecodeLimits) withDefaults() DecodeLimits {
+	if l.MaxBlocks <= 0 {
+		l.MaxBlocks = DefaultMaxBlocks
+	}
+	if l.MaxOperations <= 0 {
+		l.MaxOperations = DefaultMaxOperations
+	}
+	if l.MaxLiteral <= 0 {
+		l.MaxLiteral = DefaultMaxLiteral
+	}
+
+	return l
+}
+
+// signatureReader returns r, failing the reads of a gob message larger than the biggest signature table allowed.
+func (l DecodeLimits) signatureReader(r io.Reader) io.Reader {
+	l = l.withDefaults()
+
+	return &gobLimitReader{r: r, max: uint64(l.MaxBlocks)*maxBlockRecord + maxRecordOverhead}
+}
+
+// deltaReader returns r, failing the reads of a gob message larger than the biggest delta operation allowed.
+func (l DecodeLimits) deltaReader(r io.Reader) io.Reader {
+	l = l.withDefaults()
+
+	return &gobLimitReader{r: r, max: uint64(l.MaxLiteral) + maxRecordOverhead}
+}
+
+// checkBlocks returns a non-nil error if the number of blocks of a signature exceeds the limit.
+func (l DecodeLimits) checkBlocks(blocks int) error {
+	if limit := l.withDefaults().MaxBlocks; blocks > limit {
+		return markError(ErrCorrupt, fmt.Errorf("the signature has %v blocks, more than the limit of %v", blocks, limit))
+	}
+
+	return nil
+}
+
+// checkOperation returns a non-nil error if the operation, which is the n-th one of a delta, counting from 1,
+// exceeds the limits.
+func (l DecodeLimits) checkOperation(n int64, op Operation) error {
+	l = l.withDefaults()
+	if n > l.MaxOperations {
+		return markError(ErrCorrupt, fmt.Errorf("the delta has more operations than the limit of %v", l.MaxOperations))
+	}
+	if len(op.Data) > l.MaxLiteral {
+		err := fmt.Errorf("the delta operation %v has %v literal bytes, more than the limit of %v", n, len(op.Data), l.MaxLiteral)
+		return markError(ErrCorrupt, err)
+	}
+
+	return nil
+}
+
+// gobLimitReader reads a gob stream, failing the read of a message length larger than max, so the gob decoder
+// doesn't allocate the buffer of the message. Every gob message is preceded by its length, an unsigned integer,
+// which is either a byte < 128 holding it, or the negated count of the big endian bytes following it.
+type gobLimitReader struct {
+	r   io.Reader
+	max uint64
+	// remaining is the number of bytes of the current message not read yet
+	remaining uint64
+	// length is the message length being read, and lengthBytes the number of its bytes not read yet
+	length      uint64
+	lengthBytes int
+	err         error
+}
+
+// Read reads from the stream, and returns an error, without any byte, if the data read holds a message length
+// larger than max, so the decoder doesn't receive the length.
+func (r *gobLimitReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.r.Read(p)
+	for i := 0; i < n; {
+		if r.remaining > 0 {
+			skip := min(r.remaining, uint64(n-i))
+			r.remaining -= skip
+			i += int(skip)
+			continue
+		}
+		r.err = r.readLength(p[i])
+		if r.err != nil {
+			return 0, r.err
+		}
+		i++
+	}
+
+	return n, err
+}
+
+// readLength reads the byte b of a message length.
+func (r *gobLimitReader) readLength(b byte) error {
+	switch {
+	case r.lengthBytes > 0:
+		r.length = r.length<<8 | uint64(b)
+		r.lengthBytes--
+		if r.lengthBytes > 0 {
+			return nil
+		}
+	case b < 0x80:
+		r.length = uint64(b)
+	default:
+		r.length, r.lengthBytes = 0, 256-int(b)
+		if r.lengthBytes > 8 {
+			return markError(ErrCorrupt, fmt.Errorf("invalid gob message length prefix: %#x", b))
+		}
+		return nil
+	}
+	if r.length > r.max {
+		err := fmt.Errorf("a message of %v bytes exceeds the decode limit of %v bytes, see WithDecodeLimits", r.length, r.max)
+		return markError(ErrCorrupt, err)
+	}
+	r.remaining = r.length
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"math/rand"
+	"runtime"
+	"testing"
+)
+
+// testSignatureBytes serializes a signature of n blocks.
+func testSignatureBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	table := signatureTable{WeakHashes: make([]uint64, n), StrongHashes: make([]byte, n*md5.Size)}
+	var buf bytes.Buffer
+	if err := writeSignature(&buf, SignatureHeader{StrongHashSize: md5.Size}, table); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDecodeLimits(t *testing.T) {
+	delta := deltaBytes(t, DeltaHeader{SourceSize: 150}, []Operation{
+		{Type: OpBlockNew, BlockIndex: -1, Data: make([]byte, 50)},
+		{Type: OpBlockNew, BlockIndex: -1, Data: make([]byte, 100)},
+	})
+	tests := []struct {
+		name   string
+		limits DecodeLimits
+		read   func(limits DecodeLimits) error
+		fail   bool
+	}{
+		{name: "signature within the limits", limits: DecodeLimits{MaxBlocks: 10}, read: func(l DecodeLimits) error {
+			_, _, err := readSignature(bytes.NewReader(testSignatureBytes(t, 10)), l)
+			return err
+		}},
+		{name: "signature blocks", limits: DecodeLimits{MaxBlocks: 9}, fail: true, read: func(l DecodeLimits) error {
+			_, _, err := readSignature(bytes.NewReader(testSignatureBytes(t, 10)), l)
+			return err
+		}},
+		{name: "signature message size", limits: DecodeLimits{MaxBlocks: 1}, fail: true, read: func(l DecodeLimits) error {
+			_, _, err := readSignature(bytes.NewReader(testSignatureBytes(t, 1000)), l)
+			return err
+		}},
+		{name: "delta within the limits", limits: DecodeLimits{MaxOperations: 2, MaxLiteral: 100}, read: func(l DecodeLimits) error {
+			return readTestDelta(delta, l)
+		}},
+		{name: "delta operations", limits: DecodeLimits{MaxOperations: 1}, fail: true, read: func(l DecodeLimits) error {
+			return readTestDelta(delta, l)
+		}},
+		{name: "delta literal", limits: DecodeLimits{MaxLiteral: 99}, fail: true, read: func(l DecodeLimits) error {
+			return readTestDelta(delta, l)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.read(tt.limits)
+			if tt.fail != (err != nil) || (err != nil && !errors.Is(err, ErrCorrupt)) {
+				t.Errorf("the decoding error = %v, want a failure %v, matching %v", err, tt.fail, ErrCorrupt)
+			}
+		})
+	}
+}
+
+// readTestDelta decodes all the operations of the delta.
+func readTestDelta(delta []byte, limits DecodeLimits) error {
+	d, err := newDeltaDecoder(bytes.NewReader(delta), limits)
+	if err != nil {
+		return err
+	}
+
+	return d.forEach(func(Operation) error { return nil })
+}
+
+// TestDecodeLimits_MessageLength checks a crafted message length, of almost 1GiB, fails before its buffer is
+// allocated.
+func TestDecodeLimits_MessageLength(t *testing.T) {
+	crafted := []byte{0xfc, 0x3f, 0xff, 0xff, 0xff}
+	for _, tt := range []struct {
+		name string
+		read func() error
+	}{
+		{name: "signature", read: func() error {
+			_, _, err := ReadSignature(bytes.NewReader(crafted))
+			return err
+		}},
+		{name: "delta", read: func() error {
+			_, _, err := ReadDelta(bytes.NewReader(crafted))
+			return err
+		}},
+		{name: "directory delta", read: func() error {
+			_, _, err := ReadDirDelta(bytes.NewReader(crafted))
+			return err
+		}},
+	} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		err := tt.read()
+		runtime.ReadMemStats(&after)
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%v: the decoding error = %v, want %v", tt.name, err, ErrCorrupt)
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("%v: the decoding allocated %v bytes, want at most 1MiB", tt.name, allocated)
+		}
+	}
+}
+
+func TestRDiff_ComputeDelta_MaxLiteral(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	target := make([]byte, 1000)
+	rnd.Read(target)
+	source := make([]byte, 750)
+	rnd.Read(source)
+	source = append(source, target[:500]...)
+	source = append(source, make([]byte, 250)...)
+	source = append(source, target[500:]...)
+	source = append(source, make([]byte, 330)...)
+	for _, concurrency := range []int{0, 2} {
+		r := newTestRDiff(10, rDiffE2EConfig{})
+		r.concurrency, r.limits = concurrency, DecodeLimits{MaxLiteral: 100}
+		sig, err := r.ComputeSignature(bytes.NewReader(target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		delta, err := r.ComputeDelta(bytes.NewReader(source), r.signatureHeader(), sig)
+		if err != nil {
+			t.Fatalf("ComputeDelta() error = %v", err)
+		}
+		if got := rebuild(target, 10, delta); !bytes.Equal(got, source) {
+			t.Errorf("ComputeDelta(), concurrency %v, doesn't rebuild the source", concurrency)
+		}
+		for _, op := range delta {
+			if len(op.Data) > 100 {
+				t.Errorf("ComputeDelta(), concurrency %v, literal size = %v, want <= 100", concurrency, len(op.Data))
+			}
+		}
+	}
+}
+
+func TestRDiff_ComputeDelta_LiteralChunkSize(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	target := make([]byte, 1000)
+	rnd.Read(target)
+	// the source has nothing in common with the target
+	source := make([]byte, 10000)
+	rnd.Read(source)
+	for _, tt := range []struct {
+		chunkSize   int
+		maxLiteral  int
+		concurrency int
+		want        int
+	}{
+		{chunkSize: 1024, want: 1024},
+		{chunkSize: 1024, concurrency: 2, want: 1024},
+		{chunkSize: 1024, maxLiteral: 100, want: 100},
+	} {
+		r := newTestRDiff(10, rDiffE2EConfig{})
+		r.literalChunkSize, r.concurrency, r.limits = tt.chunkSize, tt.concurrency, DecodeLimits{MaxLiteral: tt.maxLiteral}
+		sig, err := r.ComputeSignature(bytes.NewReader(target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		delta, err := r.ComputeDelta(bytes.NewReader(source), r.signatureHeader(), sig)
+		if err != nil {
+			t.Fatalf("ComputeDelta(%+v) error = %v", tt, err)
+		}
+		if got := rebuild(target, 10, delta); !bytes.Equal(got, source) {
+			t.Errorf("ComputeDelta(%+v) doesn't rebuild the source", tt)
+		}
+		news := 0
+		for _, op := range delta {
+			if len(op.Data) > tt.want {
+				t.Errorf("ComputeDelta(%+v) literal size = %v, want <= %v", tt, len(op.Data), tt.want)
+			}
+			if op.Type == OpBlockNew {
+				news++
+			}
+		}
+		if want := (len(source) + tt.want - 1) / tt.want; news != want {
+			t.Errorf("ComputeDelta(%+v) has %v new blocks, want %v", tt, news, want)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package rdiff
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// windowsMaxPath is the length from which a path is given in its extended-length form, see longPath. It's under
+// MAX_PATH(260), as the Windows API limits the directory paths to 248 characters, leaving room for a file name.
+const windowsMaxPath = 248
+
+// longPath returns the extended-length form of the path, prefixed with \\?\, if it's too long for the Windows API,
+// so the files of deep trees can be opened by the calls which, unlike the os ones, don't convert the paths.
+// Windows doesn't normalize the extended-length paths, so the path is made absolute, and cleaned, first. The short
+// paths, the ones already prefixed, and the ones failing to be made absolute, are returned unchanged.
+func longPath(path string) string {
+	if len(path) < windowsMaxPath || strings.HasPrefix(path, `\\?\`) || strings.HasPrefix(path, `\\.\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// a UNC path, \\server\share\..., has its own prefix
+		return `\\?\UNC\` + abs[2:]
+	}
+
+	return `\\?\` + abs
+}
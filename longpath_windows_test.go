@@ -0,0 +1,51 @@
+package rdiff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	long := strings.Repeat("d", windowsMaxPath)
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "short", path: `C:\dir\file`, want: `C:\dir\file`},
+		{name: "long", path: `C:\` + long + `\.\file`, want: `\\?\C:\` + long + `\file`},
+		{name: "long, with forward slashes", path: `C:/` + long + `/file`, want: `\\?\C:\` + long + `\file`},
+		{name: "long UNC", path: `\\server\share\` + long, want: `\\?\UNC\server\share\` + long},
+		{name: "already prefixed", path: `\\?\C:\` + long, want: `\\?\C:\` + long},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := longPath(tt.path); got != tt.want {
+				t.Errorf("longPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenSequential_LongPath(t *testing.T) {
+	dir := t.TempDir()
+	for len(dir) < 2*windowsMaxPath {
+		dir = filepath.Join(dir, strings.Repeat("d", 50))
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "file")
+	if err := os.WriteFile(path, []byte("content"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openSequential(path)
+	if err != nil {
+		t.Fatalf("openSequential() of a long path error = %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
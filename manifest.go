@@ -0,0 +1,224 @@
+package rdiff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DirManifest describes the files of a directory, as written by App.ManifestDir, so two hosts can compare their
+// trees, using InSync, before computing any signature or delta.
+type DirManifest struct {
+	// StrongHash is the hash of the file contents, and of the tree
+	StrongHash StrongHashType
+	// StrongHashKeyID identifies the key of a keyed strong hash, empty if the hash is not keyed
+	StrongHashKeyID []byte
+	// Files are sorted by path
+	Files []ManifestFile
+	// Root is the hash of the tree: every directory hashes the names, types and hashes of its entries, so the root
+	// changes with any file, link or path of the tree
+	Root []byte
+}
+
+// ManifestFile is a file of a directory manifest.
+type ManifestFile struct {
+	// Path is the path of the file, relative to the directory, using forward slashes
+	Path string
+	Size int64
+	// Hash is the strong hash of the file content, empty for a link
+	Hash []byte
+	// Link is the target of a symbolic link, empty for a regular file
+	Link string
+	// HardLink is the path of the first file, in lexical order, sharing the file's inode, which has the hash
+	// of both, empty if it's the first one or the file has a single link
+	HardLink string
+}
+
+// InSync reports whether the manifest describes the same tree as the other one, by comparing their roots, which is
+// only meaningful if they're computed using the same strong hash, and key.
+func (m *DirManifest) InSync(other *DirManifest) bool {
+	return m.StrongHash == other.StrongHash && bytes.Equal(m.StrongHashKeyID, other.StrongHashKeyID) &&
+		len(m.Root) != 0 && bytes.Equal(m.Root, other.Root)
+}
+
+// ManifestDir computes the manifest of the files under the root directory(rootPath), and writes it to an output
+// file(outputPath), so it can be published alongside the directory signature, and read using ReadDirManifest.
+// The files are listed the same way as by SignatureDir, and every regular file is hashed using the configured strong
+// hash, and key, see WithStrongHash.
+// The root directory must exist, and the output file must not exist, otherwise a non-nil error is returned.
+// The manifest is gob encoded, so the other formats return a non-nil error.
+func (a *App) ManifestDir(rootPath string, outputPath string) error {
+	if a.format != FormatGob {
+		return fmt.Errorf("the %v format can't encode a directory manifest", a.format)
+	}
+	newHash, err := a.manifestHash()
+	if err != nil {
+		return err
+	}
+	err = a.checkFilter()
+	if err != nil {
+		return err
+	}
+	files, total, err := listDirFiles(rootPath, outputPath, a.filter, a.symlinks)
+	if err != nil {
+		return err
+	}
+	output, err := os.OpenFile(outputPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	err = a.manifestDir(rootPath, files, total, newHash, output)
+
+	return errors.Join(err, output.Close())
+}
+
+// manifestHash returns the constructor of the configured strong hash, or a non-nil error if it's unknown.
+func (a *App) manifestHash() (func() hash.Hash, error) {
+	t, key := a.diffEngine.strongHashType, a.diffEngine.strongHashKey
+	_, err := newStrongHash(t, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() hash.Hash {
+		h, _ := newStrongHash(t, key)
+		return h
+	}, nil
+}
+
+// manifestDir hashes the files, then the tree, and serializes the manifest.
+func (a *App) manifestDir(rootPath string, files []dirFile, total int64, newHash func() hash.Hash, output io.Writer) error {
+	m := DirManifest{
+		StrongHash:      a.diffEngine.strongHashType,
+		StrongHashKeyID: strongHashKeyID(a.diffEngine.strongHashKey),
+		Files:           make([]ManifestFile, len(files)),
+	}
+	h := newHash()
+	progress := Progress{Phase: "manifest", Total: total}
+	for i, file := range files {
+		m.Files[i] = ManifestFile{Path: file.path, Size: file.size, Link: file.link, HardLink: file.hardLink}
+		if file.link != "" || file.hardLink != "" {
+			continue
+		}
+		var err error
+		m.Files[i].Size, m.Files[i].Hash, err = a.manifestFileHash(h, rootPath, file.path, &progress)
+		if err != nil {
+			return fmt.Errorf("%v: %w", file.path, err)
+		}
+	}
+	m.Root = manifestTreeHash(newHash, m.Files, "")
+
+	bw := bufio.NewWriter(output)
+	err := gob.NewEncoder(bw).Encode(m)
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// manifestFileHash returns the size and the hash of a file of the directory, and adds its size to the progress.
+func (a *App) manifestFileHash(h hash.Hash, rootPath, name string, progress *Progress) (int64, []byte, error) {
+	f, err := openSequential(filepath.Join(rootPath, filepath.FromSlash(name)))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, nil, err
+	}
+	r, release := a.inputReader(f, info.Size())
+	if a.progress != nil {
+		r = &progressReader{r: r, progress: *progress, fn: a.progress}
+	}
+	h.Reset()
+	n, err := io.Copy(h, r)
+	err = errors.Join(err, release())
+	progress.Done += info.Size()
+
+	return n, h.Sum(nil), err
+}
+
+// manifestTreeHash returns the hash of the directory at prefix, holding the files, sorted by path, whose entries are
+// its files and links, hashed by manifestEntryHash, and its subdirectories, hashed the same way, recursively.
+func manifestTreeHash(newHash func() hash.Hash, files []ManifestFile, prefix string) []byte {
+	h := newHash()
+	for len(files) > 0 {
+		name, _, isDir := strings.Cut(strings.TrimPrefix(files[0].Path, prefix), "/")
+		if !isDir {
+			kind, digest := manifestEntryHash(newHash, files[0])
+			writeTreeEntry(h, name, kind, digest)
+			files = files[1:]
+			continue
+		}
+		// the sorted paths under a directory are contiguous
+		dirPrefix := prefix + name + "/"
+		n := 1
+		for n < len(files) && strings.HasPrefix(files[n].Path, dirPrefix) {
+			n++
+		}
+		writeTreeEntry(h, name, 'd', manifestTreeHash(newHash, files[:n], dirPrefix))
+		files = files[n:]
+	}
+
+	return h.Sum(nil)
+}
+
+// manifestEntryHash returns the type and the hash of a file of the tree: a regular file hashes its size and content
+// hash, while a link hashes its target.
+func manifestEntryHash(newHash func() hash.Hash, file ManifestFile) (byte, []byte) {
+	h := newHash()
+	switch {
+	case file.Link != "":
+		h.Write([]byte(file.Link))
+		return 'l', h.Sum(nil)
+	case file.HardLink != "":
+		h.Write([]byte(file.HardLink))
+		return 'h', h.Sum(nil)
+	default:
+		_ = binary.Write(h, binary.BigEndian, file.Size)
+		h.Write(file.Hash)
+		return 'f', h.Sum(nil)
+	}
+}
+
+// writeTreeEntry writes an entry of a directory to its hash, the name being prefixed by its length, so the entries
+// can't be mistaken for each other.
+func writeTreeEntry(h hash.Hash, name string, kind byte, digest []byte) {
+	_ = binary.Write(h, binary.BigEndian, uint32(len(name)))
+	h.Write([]byte(name))
+	h.Write([]byte{kind})
+	h.Write(digest)
+}
+
+// ReadDirManifest reads a directory manifest, as written by App.ManifestDir.
+// It returns a non-nil error if the content is not a valid directory manifest.
+func ReadDirManifest(r io.Reader) (DirManifest, error) {
+	var m DirManifest
+	err := gob.NewDecoder(bufio.NewReader(r)).Decode(&m)
+	if err != nil {
+		return DirManifest{}, markError(ErrCorrupt, fmt.Errorf("reading the directory manifest: %w", err))
+	}
+	if len(m.Root) == 0 {
+		return DirManifest{}, markError(ErrCorrupt, errors.New("the directory manifest has no root hash"))
+	}
+	for i, file := range m.Files {
+		if !validDirPath(file.Path) {
+			return DirManifest{}, markError(ErrCorrupt, fmt.Errorf("invalid directory manifest file path: %q", file.Path))
+		}
+		if i > 0 && m.Files[i-1].Path >= file.Path {
+			return DirManifest{}, markError(ErrCorrupt, fmt.Errorf("%v: the directory manifest files are not sorted", file.Path))
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,153 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/md5" // nolint
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// readManifestFile reads the directory manifest at p.
+func readManifestFile(t *testing.T, p string) DirManifest {
+	t.Helper()
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m, err := ReadDirManifest(f)
+	if err != nil {
+		t.Fatalf("ReadDirManifest() error = %v", err)
+	}
+
+	return m
+}
+
+// manifestTree writes the files to a new directory, and returns its manifest.
+func manifestTree(t *testing.T, app *App, files map[string][]byte) DirManifest {
+	t.Helper()
+	root, output := t.TempDir(), filepath.Join(t.TempDir(), "manifest")
+	writeTree(t, root, files)
+	if err := app.ManifestDir(root, output); err != nil {
+		t.Fatalf("ManifestDir() error = %v", err)
+	}
+
+	return readManifestFile(t, output)
+}
+
+func TestApp_ManifestDir(t *testing.T) {
+	files := map[string][]byte{"a.txt": []byte("a"), "a/b": []byte("b"), "a/c/d": []byte("d"), "empty": nil}
+	m := manifestTree(t, New(0), files)
+	sum := func(content string) []byte {
+		h := md5.Sum([]byte(content)) // nolint
+		return h[:]
+	}
+	want := []ManifestFile{
+		{Path: "a.txt", Size: 1, Hash: sum("a")},
+		{Path: "a/b", Size: 1, Hash: sum("b")},
+		{Path: "a/c/d", Size: 1, Hash: sum("d")},
+		{Path: "empty", Hash: sum("")},
+	}
+	if diff := cmp.Diff(want, m.Files); diff != "" {
+		t.Errorf("ManifestDir() files \nDIFF: %v", diff)
+	}
+	if !m.InSync(&m) {
+		t.Errorf("InSync() of the same manifest = false, want true")
+	}
+
+	for _, tt := range []struct {
+		name  string
+		app   *App
+		files map[string][]byte
+		want  bool
+	}{
+		{name: "same tree", app: New(4), files: files, want: true},
+		{name: "changed content", app: New(0), files: map[string][]byte{"a.txt": []byte("a"), "a/b": []byte("x"), "a/c/d": []byte("d"), "empty": nil}},
+		{name: "moved file", app: New(0), files: map[string][]byte{"a.txt": []byte("a"), "a/b": []byte("b"), "a/d": []byte("d"), "empty": nil}},
+		{name: "missing file", app: New(0), files: map[string][]byte{"a.txt": []byte("a"), "a/b": []byte("b"), "a/c/d": []byte("d")}},
+		{name: "other hash", app: New(0, WithStrongHash(StrongHashSHA256)), files: files},
+		{name: "keyed hash", app: New(0, WithStrongHashKey([]byte("key"))), files: files},
+	} {
+		other := manifestTree(t, tt.app, tt.files)
+		if got := m.InSync(&other); got != tt.want {
+			t.Errorf("%v: InSync() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApp_ManifestDir_Links(t *testing.T) {
+	root := symlinkTree(t)
+	linkTree(t, root, map[string]string{"hard": "file"})
+	output := filepath.Join(t.TempDir(), "manifest")
+	if err := New(0).ManifestDir(root, output); err != nil {
+		t.Fatalf("ManifestDir() error = %v", err)
+	}
+	m := readManifestFile(t, output)
+	links := make(map[string]string)
+	for _, f := range m.Files {
+		links[f.Path] = f.Link + f.HardLink
+	}
+	want := map[string]string{"dangling": "missing", "dir/a": "", "dir.link": "dir", "file": "", "file.link": "file", "hard": "file"}
+	if diff := cmp.Diff(want, links); diff != "" {
+		t.Errorf("ManifestDir() links \nDIFF: %v", diff)
+	}
+
+	// retargeting a link changes the root
+	if err := os.Remove(filepath.Join(root, "file.link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("dir/a", filepath.Join(root, "file.link")); err != nil {
+		t.Fatal(err)
+	}
+	output = filepath.Join(t.TempDir(), "manifest")
+	if err := New(0).ManifestDir(root, output); err != nil {
+		t.Fatalf("ManifestDir() error = %v", err)
+	}
+	if other := readManifestFile(t, output); m.InSync(&other) {
+		t.Errorf("InSync() after retargeting a link = true, want false")
+	}
+}
+
+func TestApp_ManifestDir_Errors(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string][]byte{"file": []byte("content")})
+	output := filepath.Join(t.TempDir(), "manifest")
+	if err := New(0, WithFormat(FormatJSON)).ManifestDir(root, output); err == nil {
+		t.Errorf("ManifestDir() using the json format error = nil, want an error")
+	}
+	if err := New(0).ManifestDir(filepath.Join(root, "missing"), output); err == nil {
+		t.Errorf("ManifestDir() of a missing directory error = nil, want an error")
+	}
+	if err := os.WriteFile(output, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(0).ManifestDir(root, output); err == nil {
+		t.Errorf("ManifestDir() to an existing output error = nil, want an error")
+	}
+}
+
+func TestReadDirManifest_Invalid(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		manifest DirManifest
+	}{
+		{name: "no root", manifest: DirManifest{Files: []ManifestFile{{Path: "a"}}}},
+		{name: "escaping path", manifest: DirManifest{Root: []byte{1}, Files: []ManifestFile{{Path: "../a"}}}},
+		{name: "unsorted", manifest: DirManifest{Root: []byte{1}, Files: []ManifestFile{{Path: "b"}, {Path: "a"}}}},
+	} {
+		var buf bytes.Buffer
+		if err := gobEncoder(&buf).Encode(tt.manifest); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadDirManifest(&buf); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%v: ReadDirManifest() error = %v, want a %v error", tt.name, err, ErrCorrupt)
+		}
+	}
+	if _, err := ReadDirManifest(bytes.NewReader([]byte("garbage"))); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("ReadDirManifest() of garbage error = %v, want a %v error", err, ErrCorrupt)
+	}
+}
@@ -0,0 +1,102 @@
+package rdiff
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// Metrics holds the measurements of a Signature, SignatureAt, Delta, DeltaStream, Patch or Apply call, passed to
+// the function configured using WithMetrics once the call returns, ex: to export them as Prometheus counters and
+// histograms, see the rdiffmetrics package.
+type Metrics struct {
+	// Op is the name of the call: "signature", "delta" or "patch"
+	Op string
+	// Duration is the time spent by the call
+	Duration time.Duration
+	// InputBytes is the number of bytes hashed by a signature, or a delta: the size of the target, or of the source,
+	// or the number of target bytes copied by a patch
+	InputBytes int64
+	// OutputBytes is the number of bytes written: the size of the signature, of the delta, or of the rebuilt source
+	OutputBytes int64
+	// Delta holds the stats of a delta call, see LastDeltaStats, the zero value for the other calls, or if it failed
+	Delta DeltaStats
+	// Err is the error returned by the call, nil if it succeeded
+	Err error
+}
+
+// metricsCall measures a call, for the configured metrics function, and for the counters published by PublishExpvar.
+type metricsCall struct {
+	fn      func(Metrics)
+	start   time.Time
+	metrics Metrics
+	// expvar means the call is added to the counters published by PublishExpvar
+	expvar bool
+}
+
+// startCall starts measuring the call op, it returns nil if the App is not configured using WithMetrics, and the
+// counters are not published, see PublishExpvar. The methods of a nil call do nothing.
+func (a *App) startCall(op string) *metricsCall {
+	counted := expvarEnabled.Load()
+	if a.metrics == nil && !counted {
+		return nil
+	}
+
+	return &metricsCall{fn: a.metrics, expvar: counted, start: time.Now(), metrics: Metrics{Op: op}}
+}
+
+// input records the number of input bytes of the call.
+func (c *metricsCall) input(n int64) {
+	if c != nil {
+		c.metrics.InputBytes = n
+	}
+}
+
+// output returns w counting the bytes written as the output of the call.
+func (c *metricsCall) output(w io.Writer) io.Writer {
+	if c == nil {
+		return w
+	}
+
+	return &metricsWriter{w: w, n: &c.metrics.OutputBytes}
+}
+
+// done passes the metrics of the call, which returned err, to the metrics function, if any, and to the published
+// counters, the stats of a delta, or of a patch, being the last ones of the engine. A delta skipped as unchanged, see
+// WithSkipUnchanged, has its stats.
+func (c *metricsCall) done(r *rDiff, err error) {
+	if c == nil {
+		return
+	}
+	c.metrics.Duration = time.Since(c.start)
+	c.metrics.Err = err
+	if err == nil || errors.Is(err, ErrNoChanges) {
+		switch c.metrics.Op {
+		case "delta":
+			c.metrics.Delta = r.stats
+		case "patch":
+			s := r.patchStats
+			c.metrics.InputBytes = s.CopiedBytes
+			c.metrics.OutputBytes = s.CopiedBytes + s.LiteralBytes + s.ZeroBytes
+		}
+	}
+	if c.fn != nil {
+		c.fn(c.metrics)
+	}
+	if c.expvar {
+		countExpvar(c.metrics)
+	}
+}
+
+// metricsWriter counts the bytes written to w in n.
+type metricsWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (mw *metricsWriter) Write(p []byte) (int, error) {
+	n, err := mw.w.Write(p)
+	*mw.n += int64(n)
+
+	return n, err
+}
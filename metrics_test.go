@@ -0,0 +1,97 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/silviutanasa/rdiff/rollsum"
+)
+
+func TestApp_WithMetrics(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	source := append(bytes.Clone(target), "tail"...)
+	for name, data := range map[string][]byte{"target": target, "source": source} {
+		if err := os.WriteFile(path(name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []Metrics
+	app := New(64, WithMetrics(func(m Metrics) { got = append(got, m) }))
+	if err := app.Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(path("signature"), path("source"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Patch(path("target"), path("delta"), path("out")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(path("signature"), path("missing"), path("delta2")); err == nil {
+		t.Fatal("Delta() of a missing source error = nil, want an error")
+	}
+	if len(got) != 4 {
+		t.Fatalf("the metrics function received %v calls, want 4", len(got))
+	}
+	size := func(name string) int64 {
+		info, err := os.Stat(path(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+	for i, want := range []Metrics{
+		{Op: "signature", InputBytes: int64(len(target)), OutputBytes: size("signature")},
+		{Op: "delta", InputBytes: int64(len(source)), OutputBytes: size("delta"), Delta: app.LastDeltaStats()},
+		{Op: "patch", InputBytes: int64(len(target)), OutputBytes: int64(len(source))},
+		{Op: "delta"},
+	} {
+		m := got[i]
+		if m.Op != want.Op || m.InputBytes != want.InputBytes || m.OutputBytes != want.OutputBytes || m.Delta != want.Delta {
+			t.Errorf("the metrics of the call %v = %+v, want %+v", i, m, want)
+		}
+		if (m.Err != nil) != (i == 3) {
+			t.Errorf("the metrics of the call %v error = %v", i, m.Err)
+		}
+	}
+	if !errors.Is(got[3].Err, os.ErrNotExist) {
+		t.Errorf("the metrics of the failed call error = %v, want %v", got[3].Err, os.ErrNotExist)
+	}
+	if got[1].Delta.MatchedBlocks != 16 || got[1].Delta.LiteralBytes != 4 {
+		t.Errorf("the metrics of the delta stats = %+v, want 16 matched blocks, 4 literal bytes", got[1].Delta)
+	}
+}
+
+// constantSum is a rolling hash whose sum is always 0, so every window matches every block by its weak hash.
+type constantSum struct {
+	rollsum.RollingHash
+}
+
+func (constantSum) Sum() uint64 { return 0 }
+
+func TestRDiff_ComputeDelta_WeakHashCollisions(t *testing.T) {
+	target, source := []byte("aaaabbbbcccc"), []byte("xxbbbbyy")
+	r := newRDiff(4, constantSum{rollsum.NewAdler32()}, md5.New())
+	r.weakHashType = WeakHashCustom
+	sig, err := r.ComputeSignature(bytes.NewReader(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := r.ComputeDelta(bytes.NewReader(source), r.signatureHeader(), sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rebuild(target, 4, delta); !bytes.Equal(got, source) {
+		t.Errorf("ComputeDelta() rebuilds %q, want %q", got, source)
+	}
+	// "xxbb" and "xbbb" collide with the 3 blocks, "bbbb" with the block 0, before matching the block 1, and "yy"
+	// with the block 2
+	if r.stats.MatchedBlocks != 1 || r.stats.WeakHashCollisions != 8 {
+		t.Errorf("ComputeDelta() stats = %+v, want 1 matched block and 8 weak hash collisions", r.stats)
+	}
+}
@@ -0,0 +1,99 @@
+package rdiff
+
+// matchRun is the run of consecutive matches, in the source and in the target, the emitter holds while it's shorter
+// than the min match length.
+type matchRun struct {
+	// length is the number of matches of the run, including the ones already emitted, once it reached the min length
+	length int
+	// last is the block index of the last match of the run
+	last int
+	// blocks are the block indices of the held matches
+	blocks []int
+	// data is the source bytes of the held matches: the literal preceding the first one, of literal bytes, followed
+	// by the blocks
+	data    []byte
+	literal int
+}
+
+// holdMatch adds the match to the run of consecutive matches, dropping the previous run, if the match doesn't
+// continue it. It returns true if the match is held, because the run is still shorter than minMatch, otherwise the
+// held matches are emitted, and the match must be emitted by the caller.
+func (d *deltaEmitter) holdMatch(blIdx int, literal, block []byte) (bool, error) {
+	if d.minMatch <= 1 {
+		return false, nil
+	}
+	if len(literal) > 0 || d.run.length == 0 || blIdx != d.run.last+1 {
+		err := d.dropRun()
+		if err != nil {
+			return false, err
+		}
+	}
+	d.run.length++
+	d.run.last = blIdx
+	if d.run.length >= d.minMatch {
+		return false, d.commitRun()
+	}
+	if len(d.run.blocks) == 0 {
+		d.run.literal = len(literal)
+	}
+	d.run.blocks = append(d.run.blocks, blIdx)
+	d.run.data = append(append(d.run.data, literal...), block...)
+
+	return true, nil
+}
+
+// commitRun emits the held matches, the run having reached minMatch.
+func (d *deltaEmitter) commitRun() error {
+	literal := d.run.data[:d.run.literal]
+	for _, blIdx := range d.run.blocks {
+		err := d.emitMatch(blIdx, literal)
+		if err != nil {
+			return err
+		}
+		literal = nil
+	}
+	d.run.blocks, d.run.data = d.run.blocks[:0], d.run.data[:0]
+
+	return nil
+}
+
+// dropRun ends the run of consecutive matches, the held ones, if any, being sent as literal data.
+func (d *deltaEmitter) dropRun() error {
+	data := d.run.data
+	held := len(d.run.blocks) > 0
+	d.run.length, d.run.blocks, d.run.data = 0, d.run.blocks[:0], d.run.data[:0]
+	if !held {
+		return nil
+	}
+
+	return d.addLiteral(data)
+}
+
+// addLiteral emits the literal as new blocks, or adds it to the pending literal data, if the literals are coalesced,
+// in which case only the full blocks of maxLiteral bytes are emitted, so the pending data is bounded, or all of it,
+// once it reaches the memory budget, see WithMaxMemory.
+func (d *deltaEmitter) addLiteral(literal []byte) error {
+	if !d.coalesce {
+		return d.newBlocks(literal)
+	}
+	d.pending = append(d.pending, literal...)
+	if d.maxMemory > 0 && len(d.pending) >= d.maxMemory {
+		return d.flushPending()
+	}
+	if d.maxLiteral <= 0 || len(d.pending) < d.maxLiteral {
+		return nil
+	}
+	full := len(d.pending) - len(d.pending)%d.maxLiteral
+	err := d.newBlocks(d.pending[:full])
+	d.pending = d.pending[:copy(d.pending, d.pending[full:])]
+
+	return err
+}
+
+// flushPending emits the pending literal data, if any, as new blocks.
+func (d *deltaEmitter) flushPending() error {
+	err := d.newBlocks(d.pending)
+	d.pending = d.pending[:0]
+
+	return err
+}
@@ -0,0 +1,100 @@
+package rdiff
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+func TestRDiff_ComputeDelta_MinMatch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const blockSize = 100
+	target := make([]byte, 10*blockSize)
+	rnd.Read(target)
+	literal := func(n int) []byte {
+		p := make([]byte, n)
+		rnd.Read(p)
+		return p
+	}
+	// the source has a single block(2) matching in between literal runs, and a run of 4 blocks(5-8)
+	var source []byte
+	source = append(source, literal(250)...)
+	source = append(source, target[2*blockSize:3*blockSize]...)
+	source = append(source, literal(250)...)
+	source = append(source, target[5*blockSize:9*blockSize]...)
+	source = append(source, literal(50)...)
+	for _, tt := range []struct {
+		name        string
+		minMatch    int
+		coalesce    bool
+		maxMemory   int
+		concurrency int
+		wantMatched int64
+		wantOps     int
+	}{
+		{name: "default", wantMatched: 5, wantOps: 11},
+		{name: "min match", minMatch: 2, wantMatched: 4, wantOps: 12},
+		{name: "min match beyond the runs", minMatch: 5, wantMatched: 0, wantOps: 13},
+		{name: "parallel min match", minMatch: 2, concurrency: 2, wantMatched: 4, wantOps: 12},
+		{name: "memory budget", maxMemory: 100, wantMatched: 5, wantOps: 15},
+		// the spilled heads of the literal runs are emitted as they're read back, so the budget bounds the coalescing
+		{name: "coalesced memory budget", maxMemory: 100, coalesce: true, wantMatched: 5, wantOps: 15},
+		{name: "coalesced min match", minMatch: 2, coalesce: true, maxMemory: 100, wantMatched: 4, wantOps: 16},
+	} {
+		r := newTestRDiff(blockSize, rDiffE2EConfig{})
+		r.minMatch, r.coalesceLiterals, r.maxMemory, r.concurrency = tt.minMatch, tt.coalesce, tt.maxMemory, tt.concurrency
+		sig, err := r.ComputeSignature(bytes.NewReader(target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		delta, err := r.ComputeDelta(bytes.NewReader(source), r.signatureHeader(), sig)
+		if err != nil {
+			t.Fatalf("%v: ComputeDelta() error = %v", tt.name, err)
+		}
+		if got := rebuild(target, blockSize, delta); !bytes.Equal(got, source) {
+			t.Errorf("%v: ComputeDelta() doesn't rebuild the source", tt.name)
+		}
+		header := r.signatureHeader()
+		header.TargetSize = int64(len(target))
+		if err := ValidateDelta(delta, header); err != nil {
+			t.Errorf("%v: ValidateDelta() error = %v", tt.name, err)
+		}
+		if r.stats.MatchedBlocks != tt.wantMatched {
+			t.Errorf("%v: MatchedBlocks = %v, want %v", tt.name, r.stats.MatchedBlocks, tt.wantMatched)
+		}
+		if len(delta) != tt.wantOps {
+			t.Errorf("%v: ComputeDelta() has %v operations, want %v", tt.name, len(delta), tt.wantOps)
+		}
+	}
+}
+
+func TestDeltaEmitter_CoalesceMaxLiteral(t *testing.T) {
+	var ops []Operation
+	d := &deltaEmitter{
+		emit:       func(op Operation) error { ops = append(ops, op); return nil },
+		blocks:     1,
+		maxLiteral: 10,
+		coalesce:   true,
+	}
+	for _, n := range []int{4, 4, 4, 9} {
+		if err := d.literal(make([]byte, n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the pending literal data is emitted once it reaches the limit, in full operations
+	if len(ops) != 2 || len(d.pending) != 1 {
+		t.Fatalf("coalesced literals = %v operations, %v bytes pending, want 2 operations, 1 byte pending", len(ops), len(d.pending))
+	}
+	if err := d.finish(make([]byte, 3)); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, op := range ops {
+		got = append(got, fmt.Sprintf("%v:%v", op.Type, len(op.Data)))
+	}
+	if want := []string{"new:10", "new:10", "remove:0", "new:4"}; !slices.Equal(got, want) {
+		t.Errorf("coalesced literals = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,41 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+// errMmapUnsupported is returned by mmapFile on the platforms without memory mapped files support.
+var errMmapUnsupported = errors.New("memory mapped files are not supported on this platform")
+
+// inputReader returns a reader over the content of f, which has the given size, and a function releasing it, see
+// fileReader. The reads are limited by the configured rate limiter, if any.
+func (a *App) inputReader(f *os.File, size int64) (io.Reader, func() error) {
+	r, release := a.fileReader(f, size)
+
+	return a.limitReader(r), release
+}
+
+// fileReader returns a reader over the content of f, which has the given size, and a function releasing it.
+// A sparse computation reads the file skipping its holes, see holeReader. If the memory mapping is enabled, the content is mapped in memory, but if the mapping fails, for any reason
+// (ex: platform, filesystem, empty file), the file is streamed instead, and read ahead, if configured.
+func (a *App) fileReader(f *os.File, size int64) (io.Reader, func() error) {
+	if a.diffEngine.sparse {
+		return &holeReader{f: f, size: size}, func() error { return nil }
+	}
+	if a.mmap && size > 0 && size <= math.MaxInt {
+		data, err := mmapFile(f, int(size))
+		if err == nil {
+			return bytes.NewReader(data), func() error { return munmapFile(data) }
+		}
+	}
+	if a.readAhead > 0 {
+		p := newPrefetchReader(f, a.readAhead)
+		return p, p.Close
+	}
+
+	return f, func() error { return nil }
+}
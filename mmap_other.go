@@ -0,0 +1,15 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package rdiff
+
+import "os"
+
+// mmapFile always fails, so the input files are streamed.
+func mmapFile(_ *os.File, _ int) ([]byte, error) {
+	return nil, errMmapUnsupported
+}
+
+// munmapFile is never called, as mmapFile always fails.
+func munmapFile(_ []byte) error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package rdiff
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApp_WithMmap(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	target := make([]byte, 100000)
+	rnd.Read(target)
+	source := append([]byte("new data"), target[5000:]...)
+	for _, tt := range []struct {
+		name   string
+		target []byte
+		source []byte
+	}{
+		{name: "modified", target: target, source: source},
+		// an empty source can't be mapped, so it's streamed
+		{name: "empty source", target: target, source: nil},
+	} {
+		dir := t.TempDir()
+		targetPath, sourcePath := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+		if err := os.WriteFile(targetPath, tt.target, 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(sourcePath, tt.source, 0666); err != nil {
+			t.Fatal(err)
+		}
+		// the outputs of the streamed, mapped and read ahead inputs
+		var outputs [3][]byte
+		for i, opt := range []Option{WithMmap(false), WithMmap(true), WithReadAhead(2)} {
+			sig, delta := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+			app := New(0, opt)
+			if err := app.Signature(targetPath, sig); err != nil {
+				t.Fatalf("%v: Signature(%v) error = %v", tt.name, i, err)
+			}
+			if err := app.Delta(sig, sourcePath, delta); err != nil {
+				t.Fatalf("%v: Delta(%v) error = %v", tt.name, i, err)
+			}
+			sigData, err := os.ReadFile(sig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			deltaData, err := os.ReadFile(delta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outputs[i] = append(sigData, deltaData...)
+			_ = os.Remove(sig)
+			_ = os.Remove(delta)
+		}
+		if !bytes.Equal(outputs[0], outputs[1]) {
+			t.Errorf("%v: the mapped files outputs differ from the streamed ones", tt.name)
+		}
+		if !bytes.Equal(outputs[0], outputs[2]) {
+			t.Errorf("%v: the read ahead files outputs differ from the streamed ones", tt.name)
+		}
+	}
+}
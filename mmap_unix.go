@@ -0,0 +1,18 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package rdiff
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the first size bytes of f in memory, read only.
+func mmapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmapFile releases the memory mapped by mmapFile.
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,61 @@
+package rdiff
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// inputSnapshot is the size and the modification time of an input file when it's opened, so a call detects the
+// file being modified while it's read. A modification keeping both of them, within the file system time granularity,
+// is not detected.
+type inputSnapshot struct {
+	f    *os.File
+	info fs.FileInfo
+	r    io.Reader
+	// read is the number of bytes read from r
+	read int64
+}
+
+// newInputSnapshot returns the snapshot of f, which is the file being read.
+func newInputSnapshot(f *os.File) (*inputSnapshot, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return &inputSnapshot{f: f, info: info}, nil
+}
+
+// reader returns r counting the bytes read, so check detects a file which grew or shrank while it was read.
+func (s *inputSnapshot) reader(r io.Reader) io.Reader {
+	s.r = r
+
+	return s
+}
+
+func (s *inputSnapshot) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.read += int64(n)
+
+	return n, err
+}
+
+// check returns a non-nil error, matching ErrModified, if the file was modified since the snapshot, or if the
+// content read using the reader doesn't have the file size. It's called once the call read the whole file.
+func (s *inputSnapshot) check() error {
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != s.info.Size() || !info.ModTime().Equal(s.info.ModTime()) {
+		return markError(ErrModified, fmt.Errorf("%v was modified while it was read", s.f.Name()))
+	}
+	if s.r != nil && s.read != s.info.Size() {
+		err = fmt.Errorf("%v was modified while it was read, %v bytes were read out of %v", s.f.Name(), s.read, s.info.Size())
+		return markError(ErrModified, err)
+	}
+
+	return nil
+}
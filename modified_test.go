@@ -0,0 +1,101 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// appendOnce returns a progress function appending data to the file at path, on its first call, so the file is
+// modified while it's read.
+func appendOnce(t *testing.T, path string) func(Progress) {
+	done := false
+	return func(Progress) {
+		if done {
+			return
+		}
+		done = true
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer f.Close()
+		if _, err := f.WriteString("appended while it's read"); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestApp_ErrModified(t *testing.T) {
+	dir := t.TempDir()
+	target := bytes.Repeat([]byte("the target content, "), 1000)
+	targetPath, sourcePath := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	if err := os.WriteFile(targetPath, target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sourcePath, append([]byte("the source content, "), target...), 0666); err != nil {
+		t.Fatal(err)
+	}
+	sigPath, deltaPath := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	if err := New(64).Signature(targetPath, sigPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(64).Delta(sigPath, sourcePath, deltaPath); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func(a *App) error
+		// modified is the input modified by the call
+		modified string
+	}{
+		{name: "signature", modified: targetPath, call: func(a *App) error {
+			return a.Signature(targetPath, filepath.Join(dir, "signature2"))
+		}},
+		{name: "delta", modified: sourcePath, call: func(a *App) error {
+			return a.Delta(sigPath, sourcePath, filepath.Join(dir, "delta2"))
+		}},
+		{name: "patch", modified: targetPath, call: func(a *App) error {
+			return a.Patch(targetPath, deltaPath, filepath.Join(dir, "output"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(New(64, WithProgress(appendOnce(t, tt.modified))))
+			if !errors.Is(err, ErrModified) {
+				t.Errorf("the call error = %v, want %v", err, ErrModified)
+			}
+		})
+	}
+}
+
+func TestInputSnapshot_Check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input")
+	if err := os.WriteFile(path, []byte("the input content"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	s, err := newInputSnapshot(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.check(); err != nil {
+		t.Errorf("check() of an unmodified file error = %v", err)
+	}
+	// a short read means the content read is not the whole file
+	r := s.reader(f)
+	if _, err := r.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.check(); !errors.Is(err, ErrModified) {
+		t.Errorf("check() after a partial read error = %v, want %v", err, ErrModified)
+	}
+}
@@ -0,0 +1,509 @@
+package rdiff
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"io/fs"
+	"net/http"
+	"runtime"
+	"slices"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff/rollsum"
+)
+
+// Option configures an App instance, it's meant to be passed to New.
+type Option func(*App)
+
+// WithStrongHashSize configures the number of bytes, from the beginning of the strong hash digest, stored per block
+// in the signature. Smaller values produce smaller signature files, at the cost of a (tiny) higher collision risk.
+// A size <= 0 means the full digest is stored, which is also the default behaviour.
+// The size is recorded in the signature header, so the delta computation always uses the signature's size.
+func WithStrongHashSize(size int) Option {
+	return func(a *App) {
+		a.diffEngine.strongHashSize = max(size, 0)
+	}
+}
+
+// WithWeakHash configures the rolling hash algorithm used to compute the signature's weak hashes.
+// The algorithm is recorded in the signature header, and Delta refuses a signature computed with another algorithm.
+// Without this option, Delta adopts the signature's algorithm.
+// An unknown algorithm makes Signature and Delta return a non-nil error.
+func WithWeakHash(t WeakHashType) Option {
+	return func(a *App) {
+		a.diffEngine.weakHashType = t
+		a.diffEngine.weakHashPinned = true
+		// a nil weakHasher is reported by Signature and Delta
+		a.diffEngine.weakHasher, _ = newRollingHash(t)
+	}
+}
+
+// WithRollingHash configures a third party rolling hash as the weak hash, see the rollsum package.
+// The signature header records it as WeakHashCustom, so Delta refuses the signature unless it's configured
+// with a third party rolling hash too, but the rolling hash itself isn't recorded: a signature computed with
+// another third party rolling hash goes undetected, and only makes Delta find no matches, as every match is still
+// verified by the strong hash.
+// The rolling hash is used by a single operation at a time, so the App must not be used concurrently.
+func WithRollingHash(h rollsum.RollingHash) Option {
+	return func(a *App) {
+		a.diffEngine.weakHashType = WeakHashCustom
+		a.diffEngine.weakHashPinned = true
+		// a nil weakHasher is reported by Signature and Delta
+		a.diffEngine.weakHasher = h
+	}
+}
+
+// WithStrongHash configures the hash algorithm used to compute the signature's strong hashes.
+// The algorithm is recorded in the signature header, and Delta refuses a signature computed with another algorithm.
+// Without this option, Delta adopts the signature's algorithm.
+// An unknown algorithm makes Signature and Delta return a non-nil error.
+func WithStrongHash(t StrongHashType) Option {
+	return func(a *App) {
+		a.diffEngine.strongHashType = t
+		a.diffEngine.strongHashPinned = true
+		// a nil strongHasher is reported by Signature and Delta
+		a.diffEngine.strongHasher, _ = newStrongHash(t, a.diffEngine.strongHashKey)
+	}
+}
+
+// WithStrongHashKey keys the strong hash with an HMAC secret, which must be shared between the signature producer
+// and the delta consumer. It's meant for untrusted inputs, as it prevents an attacker from pre-computing blocks
+// colliding with the target's blocks. An empty key means the strong hash is not keyed, which is the default behaviour.
+// The signature header only records a key identifier, so the delta computation fails for a different key.
+func WithStrongHashKey(key []byte) Option {
+	return func(a *App) {
+		a.diffEngine.strongHashKey = slices.Clone(key)
+		// a nil strongHasher is reported by Signature and Delta
+		a.diffEngine.strongHasher, _ = newStrongHash(a.diffEngine.strongHashType, key)
+	}
+}
+
+// WithSigningKey signs the signatures and the deltas written by the Signature, SignatureAt, Delta and DeltaStream
+// calls using the Ed25519 private key: the Ed25519ph signature of their SHA-512 hash is appended to them, as a
+// trailer, so they're signed while they're streamed. The signed artifacts must be read by an App configured using
+// WithVerifyKey, or checked using VerifyArtifact, the other readers reporting the trailer as corrupt data.
+// An empty key means the artifacts are not signed, which is the default behaviour.
+func WithSigningKey(key ed25519.PrivateKey) Option {
+	return func(a *App) {
+		a.signingKey = nil
+		if len(key) > 0 {
+			a.signingKey = slices.Clone(key)
+		}
+	}
+}
+
+// WithVerifyKey makes the verification of the signatures read by the Delta and DeltaStream calls, and of the deltas
+// read by the Patch and Apply calls, mandatory: they must be signed by the private key of the Ed25519 public key,
+// see WithSigningKey, and they're verified before any of their content is used, so a delta is never partially
+// applied. The artifacts which are not signed, or whose signature isn't valid, return a non-nil error matching
+// ErrVerification. The artifacts which are not regular files(ex: the streamed ones) are staged to a temporary file
+// to be verified.
+// An empty key means the artifacts are not verified, which is the default behaviour.
+func WithVerifyKey(key ed25519.PublicKey) Option {
+	return func(a *App) {
+		a.verifyKey = nil
+		if len(key) > 0 {
+			a.verifyKey = slices.Clone(key)
+		}
+	}
+}
+
+// WithPassphrase encrypts the deltas written by the Delta and DeltaStream calls using the passphrase, and decrypts the
+// deltas read by the Patch and Apply calls, so the deltas of sensitive content can be stored and sent over untrusted
+// channels. The key is derived from the passphrase using scrypt, and the delta is encrypted using AES-256-GCM, in
+// authenticated chunks, while it's streamed, so a delta altered, truncated, or encrypted using another passphrase
+// returns a non-nil error matching ErrVerification. The encrypted deltas are signed once encrypted, see
+// WithSigningKey, and they must be read by an App configured to decrypt them, the other readers reporting them as
+// corrupt. The deltas which are not encrypted are rejected, returning a non-nil error matching ErrVerification.
+// An empty passphrase means the deltas are not encrypted, which is the default behaviour.
+func WithPassphrase(passphrase string) Option {
+	return func(a *App) {
+		a.passphrase = nil
+		if passphrase != "" {
+			a.passphrase = []byte(passphrase)
+		}
+	}
+}
+
+// WithRecipient encrypts the deltas written by the Delta and DeltaStream calls to the X25519 public key, the same way
+// WithPassphrase does, except for the key, which is agreed with an ephemeral key, so only the holder of the private
+// key can decrypt them, see WithIdentity. It takes precedence over WithPassphrase for the deltas written.
+// A nil key means the deltas are not encrypted to a key, which is the default behaviour.
+func WithRecipient(key *ecdh.PublicKey) Option {
+	return func(a *App) {
+		a.recipient = key
+	}
+}
+
+// WithIdentity decrypts the deltas read by the Patch and Apply calls, encrypted to the public key of the X25519
+// private key, see WithRecipient. The deltas which are not encrypted are rejected, returning a non-nil error matching
+// ErrVerification, as WithPassphrase does.
+// A nil key means the deltas encrypted to a key are not decrypted, which is the default behaviour.
+func WithIdentity(key *ecdh.PrivateKey) Option {
+	return func(a *App) {
+		a.identity = key
+	}
+}
+
+// WithConcurrency configures the number of workers used to compute a signature or a delta, every worker processing
+// its own segment of the input, while the output keeps the input order. A parallel delta may lose a few matches
+// across the segment boundaries, compared to a sequential one.
+// A value <= 0 means runtime.GOMAXPROCS(0) workers, and the default is 1, which means a sequential computation.
+// A custom weak hash, configured with WithRollingHash, always uses a sequential computation.
+func WithConcurrency(workers int) Option {
+	return func(a *App) {
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		a.diffEngine.concurrency = workers
+	}
+}
+
+// WithMmap configures the Signature and Delta calls to map the target and source files in memory, instead of
+// streaming them, which avoids copying their content and lets the OS page cache drive the read ahead.
+// If a file can't be mapped (ex: unsupported platform or filesystem), it's streamed, as by default.
+func WithMmap(enabled bool) Option {
+	return func(a *App) {
+		a.mmap = enabled
+	}
+}
+
+// WithMaxMemory configures the max size, in bytes, of the literal data kept in memory by a Delta call, so deltas
+// of arbitrarily divergent files can be computed with a bounded memory. Once a literal run reaches the budget, it's
+// spilled to a temporary file, and the run continues with an empty buffer. When the run ends, its spilled bytes are
+// read back by offset, a budget at a time, and written to the delta as new blocks, preceding the rest of the run.
+// A budget <= 0 means unlimited, which is also the default behaviour.
+func WithMaxMemory(bytes int) Option {
+	return func(a *App) {
+		a.diffEngine.maxMemory = bytes
+	}
+}
+
+// WithLiteralChunkSize configures the max size, in bytes, of the literal data of an operation of a computed delta,
+// ex: 4MiB, so a source having nothing in common with the target is sent as a sequence of new blocks, each one read,
+// and decoded, with a bounded memory. The literal run is emitted once it reaches the size, so it also bounds the
+// literal data kept in memory, like WithMaxMemory. The size is capped by the decode limit, see WithDecodeLimits.
+// A size <= 0 means the literal data is only split at the decode limit, which is also the default behaviour.
+func WithLiteralChunkSize(bytes int) Option {
+	return func(a *App) {
+		a.diffEngine.literalChunkSize = bytes
+	}
+}
+
+// WithDecodeLimits configures the limits of the signatures and deltas decoded by the calls, so a crafted artifact
+// can't exhaust the memory: the decoding fails as soon as a limit is exceeded, with an error matching ErrCorrupt.
+// The deltas computed split their literal data, so it doesn't exceed limits.MaxLiteral. A limit <= 0 means its
+// default, which is also the default behaviour.
+func WithDecodeLimits(limits DecodeLimits) Option {
+	return func(a *App) {
+		a.diffEngine.limits = limits
+	}
+}
+
+// WithSparse configures the calls for sparse files(ex: VM disk images): the inputs are read skipping their holes,
+// the zero blocks of a signature are hashed once, a Delta call sends the source runs of zero blocks as OpBlockZero
+// operations, instead of literal data, and a Patch call leaves them as holes in the output file, which is not
+// preallocated. The sparse delta computations are sequential, and they only run on the block boundaries following
+// a match, so a zero run not aligned to them may be sent partially as literal data.
+// A delta holding zero runs can't be applied by the versions without sparse support.
+func WithSparse(enabled bool) Option {
+	return func(a *App) {
+		a.diffEngine.sparse = enabled
+	}
+}
+
+// WithBlockReuse configures the delta computations to match a target block again, after its own operation, ex: for
+// a source repeating a block, or moving it backwards, so the repeated content is sent as an OpBlockCopy operation,
+// instead of literal data. The blocks are still matched in order first, an identical block after the last one
+// matched being preferred.
+// A delta reusing the blocks can't be applied by the versions without block reuse support.
+// By default, the blocks are matched once, in order.
+func WithBlockReuse(enabled bool) Option {
+	return func(a *App) {
+		a.diffEngine.blockReuse = enabled
+	}
+}
+
+// WithMinMatch configures the delta computations to only send the runs of at least blocks consecutive matched
+// blocks, in the source and in the target, as matches: a shorter run, ex: a single block matching in between
+// long literal runs, is sent as literal data, instead of fragmenting the delta. So a target having less than blocks
+// blocks is never matched.
+// A value <= 1 means every matched block is sent as a match, which is also the default behaviour.
+func WithMinMatch(blocks int) Option {
+	return func(a *App) {
+		a.diffEngine.minMatch = blocks
+	}
+}
+
+// WithCoalesceLiterals configures the delta computations to send the adjacent literal runs, ex: the ones split by
+// the short runs of matches, see WithMinMatch, as a single operation, up to the literal limit, see WithDecodeLimits.
+// The literal data is then held up to that limit, or up to the memory budget, see WithMaxMemory, if one is set, in
+// which case the literal runs spilled to disk are sent as they're read back, without coalescing them.
+// By default, every literal run is sent as soon as it's known.
+func WithCoalesceLiterals(enabled bool) Option {
+	return func(a *App) {
+		a.diffEngine.coalesceLiterals = enabled
+	}
+}
+
+// WithSecondPass configures the Signature and SignatureAt calls to also record the hashes of the target split in
+// blocks of blockSize bytes, which must be smaller than the signature's ones, and the delta computations to match
+// the literal regions of at least a block, against these smaller blocks, in a second pass: a block found is sent as
+// an OpBlockPart operation, instead of literal data. So a region changed in many places, every block having an edit,
+// still shares most of its content with the target, at the cost of a bigger signature, and the CPU time of hashing
+// the literal data again. The second pass is run only if the signature records its hashes, which needs a built-in
+// weak hash, see WithRollingHash, while the checkpointed and the directory signatures, and the librsync format, don't
+// record them.
+// A blockSize <= 0 disables the second pass, which is the default.
+func WithSecondPass(blockSize int) Option {
+	return func(a *App) {
+		a.diffEngine.secondPass = max(blockSize, 0)
+	}
+}
+
+// WithFileHash configures the Signature and SignatureAt calls to record the strong hash of the whole target, and the
+// Delta calls to hash the whole source first, if its size is the target's one, and the signature records the hash,
+// so an unchanged source is detected without running the rolling match: its delta keeps all the target blocks.
+// A changed source of the same size is then read twice.
+// By default, the hash is not recorded, nor checked.
+func WithFileHash(enabled bool) Option {
+	return func(a *App) {
+		a.fileHash = enabled
+	}
+}
+
+// WithSkipUnchanged configures the Delta calls to not write the delta file of a source which equals the target, so
+// a sync doesn't ship and apply a no-op delta: the call returns ErrNoChanges instead, and the source is reported as
+// unchanged by LastDeltaStats. The other delta calls are not affected, as their output is streamed.
+// By default, the delta of an unchanged source is written, like any other.
+func WithSkipUnchanged(enabled bool) Option {
+	return func(a *App) {
+		a.skipUnchanged = enabled
+	}
+}
+
+// WithGzip configures the Signature and Delta calls to diff the uncompressed content of the gzip files, as the
+// compression spreads any change over the rest of the file, leaving no blocks to match. The signature of a gzip
+// target hashes its uncompressed content, and the delta of a gzip source against it records the source's gzip header,
+// so Patch and Apply rebuild the uncompressed source, and compress it using the same header and compression level.
+// The rebuilt source has the same content, but its compressed bytes differ from the original ones unless it was
+// compressed the same way, ex: by this package. The rsyncable gzip targets (ex: compressed using gzip --rsyncable)
+// are detected, and diffed as they are, which rebuilds them byte for byte, their compressed stream resynchronizing
+// after every change. The gzip files are read twice, and the formats other than gob and JSON, which can't record the
+// framing, diff them as they are.
+// By default, the gzip files are diffed as they are.
+func WithGzip(enabled bool) Option {
+	return func(a *App) {
+		a.gzip = enabled
+	}
+}
+
+// WithReadAhead configures the Signature and Delta calls to read the streamed input files ahead, on a separate
+// goroutine, so the disk latency overlaps the hashing. The depth is the number of 256KiB buffers read ahead,
+// larger values help the high latency storage (ex: spinning disks, network filesystems).
+// A depth <= 0 disables the read ahead, which is also the default behaviour.
+func WithReadAhead(depth int) Option {
+	return func(a *App) {
+		a.readAhead = depth
+	}
+}
+
+// WithProgress configures a function receiving the progress of the Signature, Delta and Patch calls, which is
+// reported as the bytes of the target, source or output processed so far. The function is called synchronously,
+// from a single goroutine at a time, after every read or write, so it must be fast (ex: throttle the rendering).
+func WithProgress(fn func(Progress)) Option {
+	return func(a *App) {
+		a.progress = fn
+	}
+}
+
+// WithMetrics configures a function receiving the measurements of the Signature, SignatureAt, Delta, DeltaStream,
+// Patch and Apply calls, once they return, successfully or not, ex: the Observe method of an rdiffmetrics.Collector.
+// The function is called synchronously, by the goroutine of the call, so a function shared by the Apps used
+// concurrently, ex: through the options of a sync server, must be safe for concurrent use.
+// By default, the calls are not measured.
+func WithMetrics(fn func(Metrics)) Option {
+	return func(a *App) {
+		a.metrics = fn
+	}
+}
+
+// WithTraceContext configures the Signature, SignatureAt, Delta, DeltaStream, Patch and Apply calls to emit
+// OpenTelemetry spans, children of the span of ctx, using its tracer provider, so a context without a span records
+// nothing. A call has a span named after it: "rdiff.signature", "rdiff.delta" or "rdiff.patch", and a child span for
+// each of its stages: "read", of the signature of a delta or of the header of a delta applied, "signature", of the
+// target hashed, "encode", of the signature or of the delta written, "match", of the source matched against the
+// signature, which runs within "encode" as the delta is written while it's computed, and "apply".
+// The span of a call has the attributes rdiff.file.size, the size of the target of a signature or of a patch, or of
+// the source of a delta, rdiff.block.size and, for a successful delta, rdiff.match.ratio, the part of the source
+// not sent as literal data.
+// By default, the calls are not traced.
+func WithTraceContext(ctx context.Context) Option {
+	return func(a *App) {
+		a.traceCtx = ctx
+	}
+}
+
+// WithFormat configures the serialization of the signature and delta outputs, see Format.
+// The default is FormatGob, which is also the format the Delta and Patch calls read, except for FormatLibrsync.
+func WithFormat(f Format) Option {
+	return func(a *App) {
+		a.format = f
+	}
+}
+
+// WithInclude adds rsync-style include patterns to the tree operations(SignatureDir and DeltaDir), see WithExclude.
+// An included path is visited even if a later exclude pattern matches it.
+func WithInclude(patterns ...string) Option {
+	return func(a *App) {
+		a.pathFilter().add(true, patterns)
+	}
+}
+
+// WithExclude adds rsync-style exclude patterns to the tree operations(SignatureDir and DeltaDir), so they skip the
+// matching files and directories, ex: WithExclude(".git/", "*.o", "/build/", "cache/**").
+// The include and exclude patterns are checked in the order they're configured, against the path relative to the
+// root directory, and the first matching one decides, while a path which matches none is included.
+// A '*' matches anything but a slash, a '**' matches anything, a leading slash anchors the pattern to the root
+// directory, otherwise a pattern without a slash matches a name at any depth, and a trailing slash only matches
+// directories. The files under an excluded directory are skipped, whatever the later patterns.
+// An invalid pattern makes the tree operations return a non-nil error.
+func WithExclude(patterns ...string) Option {
+	return func(a *App) {
+		a.pathFilter().add(false, patterns)
+	}
+}
+
+// WithFileAttrs configures the file attributes DeltaDir records in the directory delta, and PatchDir restores on the
+// rebuilt files, see FileAttrs. PatchDir only restores the attributes which are both recorded and configured.
+// The default is FileAttrMode | FileAttrModTime, so the executables and the timestamps survive a tree sync.
+func WithFileAttrs(attrs FileAttrs) Option {
+	return func(a *App) {
+		a.attrs = attrs & fileAttrsAll
+	}
+}
+
+// WithSymlinks configures the handling of the symbolic links by the tree operations(SignatureDir and DeltaDir),
+// see SymlinkMode. The default is SymlinkRecord, and the same mode should be used for the signature and the delta.
+func WithSymlinks(m SymlinkMode) Option {
+	return func(a *App) {
+		a.symlinks = m
+	}
+}
+
+// WithRenameDetection configures DeltaDir to detect the new source files which were renamed, or moved, from deleted
+// target files, so they're rebuilt from the target files, instead of being sent in full. A new file is compared to
+// the deleted files closest in size, and it's renamed from the most similar one, if at least half of its content is
+// found in it. The detection is enabled by default, and disabling it saves the extra reads of the new files.
+func WithRenameDetection(enabled bool) Option {
+	return func(a *App) {
+		a.renames = enabled
+	}
+}
+
+// WithDirConcurrency configures the number of files processed concurrently by the tree operations(SignatureDir and
+// DeltaDir), every worker using its own engine, while the output keeps the files order, so it's the same as for
+// a sequential processing. It also bounds the number of files open at a time, to about 3 per worker.
+// A value <= 0 means runtime.GOMAXPROCS(0) workers, and the default is 1, which means a sequential processing.
+// A custom weak hash, configured with WithRollingHash, always uses a sequential processing.
+func WithDirConcurrency(workers int) Option {
+	return func(a *App) {
+		if workers <= 0 {
+			workers = runtime.GOMAXPROCS(0)
+		}
+		a.dirConcurrency = workers
+	}
+}
+
+// WithCheckpoint configures the Signature and Delta calls to save their state to the checkpointPath file, every
+// interval bytes of input, so a call interrupted by a crash or a preemption can be continued using App.Resume,
+// instead of starting over. The checkpoint file is removed once the call succeeds.
+// The checkpointed calls are sequential, they require the gob format, and they can't sign, verify, nor encrypt their
+// artifacts, see WithSigningKey and WithPassphrase. A signature checkpoint is written after any block, while a delta
+// one is written after a source block found in the target, so there isn't any checkpoint within a run of new data.
+// A path == "" or an interval <= 0 disables the checkpoints, which is also the default behaviour.
+func WithCheckpoint(checkpointPath string, interval int64) Option {
+	return func(a *App) {
+		a.checkpointPath = checkpointPath
+		a.checkpointInterval = interval
+	}
+}
+
+// WithRateLimit configures a token bucket limiting the bandwidth of the file IO: the bytes read from the target
+// and source files by Signature, Delta and the tree operations, and the bytes written to the output file by Patch,
+// every byte consuming a token. The limiter can be shared with other instances, or with the network transports,
+// so they share its bandwidth, ex: rate.NewLimiter(10<<20, 256<<10) for 10MiB/s with bursts of 256KiB.
+// A nil limiter means unlimited, which is also the default behaviour.
+func WithRateLimit(l *rate.Limiter) Option {
+	return func(a *App) {
+		a.limiter = l
+	}
+}
+
+// pathFilter returns the path filter of the tree operations, creating it if needed.
+func (a *App) pathFilter() *pathFilter {
+	if a.filter == nil {
+		a.filter = &pathFilter{}
+	}
+
+	return a.filter
+}
+
+// WithHTTPClient configures the HTTP client fetching the signatures located by http:// or https:// URLs, see Delta,
+// ex: one with a timeout, or with the credentials of the signature service.
+// A nil client means http.DefaultClient, which is also the default behaviour.
+func WithHTTPClient(c *http.Client) Option {
+	return func(a *App) {
+		a.client = c
+	}
+}
+
+// WithSignatureCache configures the cache of the signatures computed by Signature, so an unchanged target, having
+// the same path, size and modification time, isn't hashed again. The cache can be shared with other instances,
+// ex: the ones constructed for every request of a sync daemon, see SignatureCache.
+// A nil cache means the signatures are always computed, which is also the default behaviour.
+func WithSignatureCache(c *SignatureCache) Option {
+	return func(a *App) {
+		a.signatureCache = c
+	}
+}
+
+// WithOutputMode configures the permission bits of the output files created by Signature, Delta and Patch, including
+// the setuid, setgid and sticky bits, instead of 0666 masked by the umask, ex: 0600 for the outputs holding private
+// data. The mode isn't masked by the umask, and it's set on the temporary output as soon as it's created, before any
+// data is written to it, so the output never has other permissions, not even while it's partial.
+// A mode == 0 means the default permissions, which is also the default behaviour.
+func WithOutputMode(mode fs.FileMode) Option {
+	return func(a *App) {
+		a.outputMode = mode & fileModeBits
+	}
+}
+
+// WithTargetAttrs configures Patch to copy the attributes of the target file to the rebuilt output, among FileAttrMode
+// and FileAttrOwner, ex: so a patched executable keeps its executable bit, or a service file its restrictive
+// permissions and its owner, the other attributes being ignored. They're set on the temporary output as soon as it's
+// created, before any data is written to it, and the mode configured using WithOutputMode, if any, overrides the
+// target's one.
+// Copying the owner usually requires elevated privileges, and it's only supported on Unix.
+// The default is no attributes, so the output has the default permissions.
+func WithTargetAttrs(attrs FileAttrs) Option {
+	return func(a *App) {
+		a.targetAttrs = attrs & (FileAttrMode | FileAttrOwner)
+	}
+}
+
+// WithBasisCheck configures Patch, Apply, PatchInPlace and PatchDevice to check the target matches the signature file
+// (signaturePath) the delta was computed against, before applying the delta, so a delta is never applied to another
+// target, or to one modified since its signature was computed, which would rebuild a wrong output. BasisCheckSpot
+// checks the target size, and hashes a sample of its blocks, while BasisCheckFull hashes all of them, as Verify does.
+// A target which doesn't match returns a non-nil error matching ErrVerification, before any output is written.
+// The signature's hash algorithms and block size are adopted, unless configured, in which case they must match.
+// BasisCheckNone applies the delta without checking the target, which is also the default behaviour.
+func WithBasisCheck(signaturePath string, check BasisCheck) Option {
+	return func(a *App) {
+		a.basisSignaturePath = signaturePath
+		a.basisCheck = check
+	}
+}
@@ -0,0 +1,138 @@
+package rdiff
+
+import (
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// outputFile is an output file written under a temporary name, in the same directory, and renamed to its path
+// once complete, so a failed call doesn't leave a partial output behind, which would block its retry. Where
+// supported, the file is anonymous instead, see openAnonymous, and linked to its path once complete, so even a crash
+// doesn't leave it behind.
+type outputFile struct {
+	*os.File
+	path      string
+	anonymous bool
+}
+
+// createOutput creates the temporary file of the output at path, which must not exist. The file has the
+// permissions of the ones created by os.Create, unlike the ones created by os.CreateTemp.
+func createOutput(path string) (*outputFile, error) {
+	_, err := os.Lstat(path)
+	if err == nil {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrExist}
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	f, err := openAnonymous(filepath.Dir(path))
+	if err == nil {
+		return &outputFile{File: f, path: path, anonymous: true}, nil
+	}
+	if !errors.Is(err, errAnonymousUnsupported) {
+		return nil, err
+	}
+	dir, base := filepath.Split(path)
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, "."+base+"."+strconv.FormatUint(uint64(rand.Uint32()), 36)+".partial")
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, fs.ErrExist) && try < 100 {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &outputFile{File: f, path: path}, nil
+	}
+}
+
+// close syncs and closes the file, then renames it to the output path if the call succeeded, so if callErr is nil,
+// otherwise it removes it. The data is synced before the rename, so a crash can't leave the output path holding a file
+// whose data was lost. It returns callErr joined with the errors of syncing and closing the file.
+func (o *outputFile) close(callErr error) error {
+	if o.anonymous {
+		return o.closeAnonymous(callErr)
+	}
+	err := callErr
+	if err == nil {
+		err = o.Sync()
+	}
+	err = errors.Join(err, o.Close())
+	if err == nil {
+		// the output may have been created meanwhile, it's not replaced
+		if _, statErr := os.Lstat(o.path); statErr == nil {
+			err = &fs.PathError{Op: "rename", Path: o.path, Err: fs.ErrExist}
+		} else {
+			err = os.Rename(o.Name(), o.path)
+		}
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(o.Name()))
+	}
+
+	return nil
+}
+
+// closeAnonymous syncs the anonymous file, and links it to the output path, if the call succeeded, then closes it,
+// which frees it otherwise. The output is removed if closing the linked file fails.
+func (o *outputFile) closeAnonymous(callErr error) error {
+	if callErr != nil {
+		return errors.Join(callErr, o.Close())
+	}
+	err := o.Sync()
+	if err == nil {
+		err = linkAnonymous(o.File, o.path)
+	}
+	if err != nil {
+		return errors.Join(err, o.Close())
+	}
+	err = o.Close()
+	if err != nil {
+		return errors.Join(err, os.Remove(o.path))
+	}
+
+	return nil
+}
+
+// discard closes the file, and removes it, unless it's anonymous.
+func (o *outputFile) discard() error {
+	if o.anonymous {
+		return o.Close()
+	}
+
+	return errors.Join(o.Close(), os.Remove(o.Name()))
+}
+
+// createOutputFile creates the temporary file of the output at path, see createOutput, and sets its attributes, given
+// the info of the target file, if any, see setOutputAttrs, before any data is written to it, so the output never has
+// other permissions, not even while it's partial.
+func (a *App) createOutputFile(path string, target fs.FileInfo) (*outputFile, error) {
+	o, err := createOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	err = a.setOutputAttrs(o.File, target)
+	if err != nil {
+		return nil, errors.Join(err, o.discard())
+	}
+
+	return o, nil
+}
+
+// closeOutput closes the output file, see outputFile.close. The partial output of a call failing with an
+// *ApplyError is removed, and the error records it.
+func (a *App) closeOutput(o *outputFile, callErr error) error {
+	var applyErr *ApplyError
+	if errors.As(callErr, &applyErr) {
+		applyErr.RollbackErr = o.discard()
+		applyErr.RolledBack = applyErr.RollbackErr == nil
+		return callErr
+	}
+
+	return o.close(callErr)
+}
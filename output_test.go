@@ -0,0 +1,127 @@
+package rdiff
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// dirNames returns the names of the entries of dir.
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+
+	return names
+}
+
+func TestCreateOutput(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "output")
+	f, err := createOutput(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("content"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("the output exists before close(), error = %v", err)
+	}
+	if names := dirNames(t, dir); f.anonymous && len(names) != 0 {
+		t.Errorf("the directory holds %v before close(), want nothing, as the output is anonymous", names)
+	}
+	if err := f.close(nil); err != nil {
+		t.Fatalf("close() error = %v", err)
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "content" {
+		t.Errorf("the output = %q, %v, want %q", got, err, "content")
+	}
+	if _, err := createOutput(path); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("createOutput() of an existing output error = %v, want %v", err, fs.ErrExist)
+	}
+
+	// a failed call leaves nothing behind
+	failed := errors.New("failed")
+	f, err = createOutput(filepath.Join(dir, "failed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.close(failed); !errors.Is(err, failed) {
+		t.Errorf("close() error = %v, want %v", err, failed)
+	}
+	if names := dirNames(t, dir); len(names) != 1 || names[0] != "output" {
+		t.Errorf("the directory holds %v, want only the output", names)
+	}
+
+	// an output created meanwhile isn't replaced
+	f, err = createOutput(filepath.Join(dir, "raced"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "raced"), []byte("raced"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.close(nil); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("close() over an existing output error = %v, want %v", err, fs.ErrExist)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "raced")); err != nil || string(got) != "raced" {
+		t.Errorf("the existing output = %q, %v, want %q", got, err, "raced")
+	}
+}
+
+func TestCreateSpool(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	f, release, err := createSpool("rdiff-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("spilled"); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len("spilled"))
+	if _, err := f.ReadAt(got, 0); err != nil || string(got) != "spilled" {
+		t.Errorf("the spool = %q, %v, want %q", got, err, "spilled")
+	}
+	if err := release(); err != nil {
+		t.Fatalf("release() error = %v", err)
+	}
+	if names := dirNames(t, dir); len(names) != 0 {
+		t.Errorf("the temporary directory holds %v after release(), want nothing", names)
+	}
+}
+
+func TestApp_Delta_FailedOutput(t *testing.T) {
+	dir := t.TempDir()
+	sourcePath, sigPath, deltaPath := filepath.Join(dir, "source"), filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	if err := os.WriteFile(sourcePath, []byte("the source content"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sigPath, []byte("not a signature"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(4).Delta(sigPath, sourcePath, deltaPath); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Delta() error = %v, want %v", err, ErrCorrupt)
+	}
+	if names := dirNames(t, dir); len(names) != 2 {
+		t.Fatalf("the directory holds %v after a failed Delta(), want only the inputs", names)
+	}
+
+	// the retry isn't blocked by the failed call
+	os.Remove(sigPath)
+	if err := New(4).Signature(sourcePath, sigPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(4).Delta(sigPath, sourcePath, deltaPath); err != nil {
+		t.Errorf("Delta() retry error = %v", err)
+	}
+}
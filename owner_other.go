@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package rdiff
+
+import "io/fs"
+
+// fileOwner never finds the owner, so it's not recorded.
+func fileOwner(_ fs.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,414 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// parallelSegmentSize is the target size of the segments processed by a single worker, it's rounded to
+// a multiple of the block size and, even with the overlap of the delta segments, the segment buffers are pooled
+const parallelSegmentSize = 4 * MaxBlockSize
+
+// signatureSegment is a part of the target, made of consecutive blocks, hashed by a worker.
+type signatureSegment struct {
+	data *[]byte
+	// the worker writes the segment's signature here
+	out *signatureTable
+}
+
+// clone returns an engine with the same configuration, but with its own hashers and buffers, so it can be used
+// concurrently with r. It returns a non-nil error if the hashers can't be constructed(ex: a custom rolling hash).
+func (r *rDiff) clone() (*rDiff, error) {
+	weakHasher, err := newRollingHash(r.weakHashType)
+	if err != nil {
+		return nil, err
+	}
+	strongHasher, err := newStrongHash(r.strongHashType, r.strongHashKey)
+	if err != nil {
+		return nil, err
+	}
+	c := newRDiff(r.blockSize, weakHasher, strongHasher)
+	c.weakHashType, c.strongHashType = r.weakHashType, r.strongHashType
+	c.strongHashKey, c.strongHashSize = r.strongHashKey, r.strongHashSize
+	c.blockReuse = r.blockReuse
+
+	return c, nil
+}
+
+// parallel reports whether the computations run on multiple workers, which needs every worker to construct
+// its own hashers, so it's not possible for a custom weak hash.
+func (r *rDiff) parallel() bool {
+	return r.concurrency > 1 && r.weakHashType != WeakHashCustom && r.blockSize > 0
+}
+
+// workerEngines returns n clones of r, one for every worker.
+func (r *rDiff) workerEngines(n int) ([]*rDiff, error) {
+	engines := make([]*rDiff, n)
+	for i := range engines {
+		e, err := r.clone()
+		if err != nil {
+			return nil, err
+		}
+		engines[i] = e
+	}
+
+	return engines, nil
+}
+
+// segmentSize returns the size of the segments processed by a single worker, a multiple of the block size.
+func (r *rDiff) segmentSize() int {
+	return max(parallelSegmentSize/r.blockSize, 1) * r.blockSize
+}
+
+// computeSignatureParallel computes the same signature as ComputeSignature, but the target is read in segments
+// of multiple blocks, which are hashed concurrently by the given number of workers, while the output keeps
+// the blocks order. Every segment is read using io.ReadFull, so the block boundaries are the same as for
+// a sequential read of a file.
+func (r *rDiff) computeSignatureParallel(target io.Reader, workers int) (signatureTable, error) {
+	engines, err := r.workerEngines(workers)
+	if err != nil {
+		return signatureTable{}, err
+	}
+	segmentSize := r.segmentSize()
+
+	segments := make(chan signatureSegment, workers)
+	var wg sync.WaitGroup
+	for _, e := range engines {
+		wg.Add(1)
+		go func(e *rDiff) {
+			defer wg.Done()
+			for s := range segments {
+				*s.out = e.hashBlocks(*s.data)
+				putBuffer(s.data)
+			}
+		}(e)
+	}
+
+	// the segments are read sequentially, and their outputs are collected in the read order
+	var outputs []*signatureTable
+	var readErr error
+	for {
+		data := getBuffer(segmentSize)
+		n, err := io.ReadFull(target, *data)
+		*data = (*data)[:n]
+		if n > 0 {
+			out := new(signatureTable)
+			outputs = append(outputs, out)
+			segments <- signatureSegment{data: data, out: out}
+		} else {
+			putBuffer(data)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	close(segments)
+	wg.Wait()
+
+	var output signatureTable
+	for _, out := range outputs {
+		output.WeakHashes = append(output.WeakHashes, out.WeakHashes...)
+		output.StrongHashes = append(output.StrongHashes, out.StrongHashes...)
+	}
+
+	return output, readErr
+}
+
+// hashBlocks splits data in blocks of blockSize and returns their signature.
+func (r *rDiff) hashBlocks(data []byte) signatureTable {
+	blocks := (len(data) + r.blockSize - 1) / r.blockSize
+	out := signatureTable{
+		WeakHashes:   make([]uint64, 0, blocks),
+		StrongHashes: make([]byte, 0, blocks*r.effectiveStrongHashSize()),
+	}
+	for len(data) > 0 {
+		block := data[:min(len(data), r.blockSize)]
+		r.weakHasher.WriteAll(block)
+		out.WeakHashes = append(out.WeakHashes, r.weakHasher.Sum())
+		out.StrongHashes = r.appendStrongSum(out.StrongHashes, block)
+		data = data[len(block):]
+	}
+
+	return out
+}
+
+// ComputeSignatureAt computes the same signature as ComputeSignature, from a target of the given size, which is
+// read by offset, so the segments of the target are read and hashed concurrently by the configured workers,
+// without a sequential reading. It returns a non-nil error if the target can't be read up to size.
+func (r *rDiff) ComputeSignatureAt(target io.ReaderAt, size int64) (signatureTable, error) {
+	if r.blockSize <= 0 {
+		return signatureTable{}, fmt.Errorf("invalid block size: %v", r.blockSize)
+	}
+	engines := []*rDiff{r}
+	if r.parallel() {
+		var err error
+		engines, err = r.workerEngines(r.concurrency)
+		if err != nil {
+			return signatureTable{}, err
+		}
+	}
+	segmentSize := int64(r.segmentSize())
+	outputs := make([]signatureTable, (size+segmentSize-1)/segmentSize)
+	errs := make([]error, len(engines))
+	// the workers take the next segment to hash, until there are no more segments, or a read fails
+	var next atomic.Int64
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for i, e := range engines {
+		wg.Add(1)
+		go func(i int, e *rDiff) {
+			defer wg.Done()
+			data := getBuffer(int(segmentSize))
+			defer putBuffer(data)
+			for s := next.Add(1) - 1; s < int64(len(outputs)) && !failed.Load(); s = next.Add(1) - 1 {
+				off := s * segmentSize
+				buf := (*data)[:min(segmentSize, size-off)]
+				n, err := target.ReadAt(buf, off)
+				if n < len(buf) {
+					if err == nil || errors.Is(err, io.EOF) {
+						err = io.ErrUnexpectedEOF
+					}
+					errs[i] = fmt.Errorf("reading the target at offset %v: %w", off+int64(n), err)
+					failed.Store(true)
+					return
+				}
+				outputs[s] = e.hashBlocks(buf)
+			}
+		}(i, e)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return signatureTable{}, err
+	}
+
+	var output signatureTable
+	for _, out := range outputs {
+		output.WeakHashes = append(output.WeakHashes, out.WeakHashes...)
+		output.StrongHashes = append(output.StrongHashes, out.StrongHashes...)
+	}
+
+	return output, nil
+}
+
+// deltaSegment is a part of the source matched by a worker. Its data overlaps the next segment by blockSize-1 bytes,
+// so the windows starting at the end of the segment are complete, but only the matches starting before limit
+// belong to the segment.
+type deltaSegment struct {
+	data *[]byte
+	// offset is the position of the segment in the source
+	offset int
+	limit  int
+	// the worker writes the segment's matches here, then closes done
+	matches []segmentMatch
+	done    chan struct{}
+}
+
+// segmentMatch is a target block found by a worker, at offset in its segment.
+type segmentMatch struct {
+	offset     int
+	length     int
+	blockIndex int
+}
+
+// computeDeltaParallel passes the same kind of operations as computeDelta to the emitter, but the source
+// is read in overlapping segments, matched concurrently by the given number of workers, against the shared
+// search list. The segments are stitched in the source order: a match overlapping the previous match, or using
+// a block before the next expected one, without an identical block after it, is turned into literal data, unless
+// the blocks are reused. So the delta can differ from the sequential one around the segment boundaries, but it's
+// always consistent.
+func (r *rDiff) computeDeltaParallel(source io.Reader, searchList *searchList, emitter *deltaEmitter, workers int) error {
+	engines, err := r.workerEngines(workers)
+	if err != nil {
+		return err
+	}
+
+	segments := make(chan *deltaSegment, workers)
+	var wg sync.WaitGroup
+	for _, e := range engines {
+		wg.Add(1)
+		go func(e *rDiff) {
+			defer wg.Done()
+			// every worker tracks the next block in its current segment, the stitching tracks the global state
+			sl := *searchList
+			for s := range segments {
+				sl.next = 0
+				s.matches = e.findMatches(*s.data, s.limit, &sl)
+				close(s.done)
+			}
+		}(e)
+	}
+
+	// the reading runs ahead of the stitching, the pending segments are stitched in the read order
+	pending := make(chan *deltaSegment, workers)
+	var readErr error
+	go func() {
+		readErr = readDeltaSegments(source, r.segmentSize(), r.blockSize-1, func(s *deltaSegment) {
+			segments <- s
+			pending <- s
+		})
+		close(segments)
+		close(pending)
+	}()
+
+	st := deltaStitcher{engine: r, searchList: searchList, emitter: emitter}
+	var emitErr error
+	for s := range pending {
+		<-s.done
+		// after an emit error, the remaining segments are only drained
+		if emitErr == nil {
+			emitErr = st.add(s)
+		}
+		putBuffer(s.data)
+	}
+	wg.Wait()
+	for _, e := range engines {
+		r.stats.WeakHashCollisions += e.stats.WeakHashCollisions
+	}
+	if readErr != nil || emitErr != nil {
+		return errors.Join(readErr, emitErr)
+	}
+
+	return emitter.finish(st.literal)
+}
+
+// readDeltaSegments reads the source in segments of segmentSize bytes, plus the overlap with the next segment,
+// and passes them to emit, in order. The last segment has no overlap.
+// It returns a non-nil error in case source encounters a reading error, other than io.EOF.
+func readDeltaSegments(source io.Reader, segmentSize, overlap int, emit func(*deltaSegment)) error {
+	offset := 0
+	data := getBuffer(segmentSize + overlap)
+	// n is the number of bytes already in data, the overlap with the previous segment
+	n := 0
+	for {
+		read, err := io.ReadFull(source, (*data)[n:])
+		n += read
+		*data = (*data)[:n]
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			putBuffer(data)
+			return err
+		}
+		if err != nil {
+			if n == 0 {
+				putBuffer(data)
+				return nil
+			}
+			emit(&deltaSegment{data: data, offset: offset, limit: n, done: make(chan struct{})})
+			return nil
+		}
+
+		// the overlap is copied before the segment is emitted, as it's released once stitched
+		next := getBuffer(segmentSize + overlap)
+		copy(*next, (*data)[n-overlap:])
+		emit(&deltaSegment{data: data, offset: offset, limit: n - overlap, done: make(chan struct{})})
+		offset += n - overlap
+		data, n = next, overlap
+	}
+}
+
+// findMatches runs the rolling match loop over data, the same way computeDelta does over a source,
+// and returns the matches starting before limit.
+func (r *rDiff) findMatches(data []byte, limit int, searchList *searchList) []segmentMatch {
+	var matches []segmentMatch
+	// pos is the start of the current window
+	pos := 0
+	rolling := false
+	for {
+		n := r.blockSize
+		if !rolling {
+			if pos >= limit {
+				break
+			}
+			n = min(n, len(data)-pos)
+			r.weakHasher.WriteAll(data[pos : pos+n])
+		} else {
+			if pos+n >= len(data) || pos+1 >= limit {
+				break
+			}
+			r.weakHasher.Roll(data[pos+n])
+			pos++
+		}
+
+		if blIdx := r.searchBlock(searchList, r.weakHasher.Sum()); blIdx != -1 {
+			matches = append(matches, segmentMatch{offset: pos, length: n, blockIndex: blIdx})
+			pos += n
+			rolling = false
+
+			continue
+		}
+
+		rolling = true
+	}
+
+	return matches
+}
+
+// deltaStitcher merges the matches of the segments, in the source order, into a delta.
+type deltaStitcher struct {
+	engine     *rDiff
+	searchList *searchList
+	emitter    *deltaEmitter
+	// pos is the position in the source up to which the data was consumed, by matches or literals
+	pos int
+	// next is the lowest block index the stitching can accept, the workers' search lists have their own
+	next    int
+	literal []byte
+}
+
+func (st *deltaStitcher) add(s *deltaSegment) error {
+	data := *s.data
+	for _, m := range s.matches {
+		if s.offset+m.offset < st.pos {
+			continue
+		}
+		blIdx := st.claim(m.blockIndex)
+		if blIdx == -1 {
+			continue
+		}
+		st.literal = append(st.literal, data[st.pos-s.offset:m.offset]...)
+		err := st.emitter.match(blIdx, st.literal, data[m.offset:m.offset+m.length])
+		if err != nil {
+			return err
+		}
+		st.literal = st.literal[:0]
+		st.pos = s.offset + m.offset + m.length
+	}
+	if end := s.offset + s.limit; st.pos < end {
+		st.literal = append(st.literal, data[st.pos-s.offset:s.limit]...)
+		st.pos = end
+	}
+	var err error
+	st.literal, err = st.engine.flushLiteral(st.emitter, st.literal)
+
+	return err
+}
+
+// claim returns the block index if it's not before the next expected block, or the first identical block after
+// the next expected one. Otherwise, it returns the block index if the blocks are reused, so it's emitted as
+// a copy, or -1.
+func (st *deltaStitcher) claim(blIdx int) int {
+	if blIdx >= st.next {
+		st.next = blIdx + 1
+		return blIdx
+	}
+	sl := st.searchList
+	strongHash := sl.signature.strongHash(blIdx)
+	for _, e := range sl.candidates(sl.signature.WeakHashes[blIdx]) {
+		if e.blockIndex >= st.next && bytes.Equal(sl.signature.strongHash(e.blockIndex), strongHash) {
+			st.next = e.blockIndex + 1
+			return e.blockIndex
+		}
+	}
+	if st.engine.blockReuse {
+		return blIdx
+	}
+
+	return -1
+}
@@ -0,0 +1,155 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRDiff_ComputeSignature_Parallel(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	large := make([]byte, 2*parallelSegmentSize+12345)
+	rnd.Read(large)
+	for _, tt := range []struct {
+		blockSize int
+		target    []byte
+		workers   int
+	}{
+		{blockSize: 3, target: []byte{1, 2, 3, 4, 5, 6, 7}, workers: 2},
+		{blockSize: 3, target: []byte{1, 2, 3, 4, 5, 6}, workers: 4},
+		{blockSize: 700, target: large, workers: 3},
+		{blockSize: MaxBlockSize, target: large, workers: 8},
+		{blockSize: 5, target: nil, workers: 2},
+	} {
+		for _, weakHash := range []WeakHashType{WeakHashAdler32, WeakHashRabin, WeakHashBuzhash} {
+			cfg := rDiffE2EConfig{weakHash: weakHash, strongHash: StrongHashMD5, strongHashSize: 8}
+			seq := newTestRDiff(tt.blockSize, cfg)
+			want, err := seq.ComputeSignature(bytes.NewReader(tt.target))
+			if err != nil {
+				t.Fatalf("ComputeSignature() error = %v", err)
+			}
+			par := newTestRDiff(tt.blockSize, cfg)
+			par.concurrency = tt.workers
+			got, err := par.ComputeSignature(bytes.NewReader(tt.target))
+			if err != nil {
+				t.Fatalf("parallel ComputeSignature() error = %v", err)
+			}
+			if diff := cmp.Diff(got.blocks(SignatureHeader{}), want.blocks(SignatureHeader{})); diff != "" {
+				t.Errorf("parallel ComputeSignature(%v, %v workers) differs from the sequential one, \nDIFF: %v", weakHash, tt.workers, diff)
+			}
+		}
+	}
+}
+
+func TestRDiff_ComputeDelta_Parallel(t *testing.T) {
+	for _, cfg := range rDiffE2EConfigs {
+		for _, tt := range rDiffE2ETests {
+			// the inputs are smaller than a segment, so the delta must be the same as the sequential one
+			r := newTestRDiff(tt.in.blockSize, cfg)
+			r.concurrency = 4
+			sig, err := r.ComputeSignature(bytes.NewReader(tt.in.target))
+			if err != nil {
+				t.Fatalf("ComputeSignature() error = %v", err)
+			}
+			got, err := r.ComputeDelta(bytes.NewReader(tt.in.source), r.signatureHeader(), sig)
+			if err != nil {
+				t.Fatalf("parallel ComputeDelta(%+v) error = %v", cfg, err)
+			}
+			if diff := cmp.Diff(got, tt.out); diff != "" {
+				t.Errorf("parallel ComputeDelta(%+v) got = %v, want %v, \nDIFF: %v", cfg, got, tt.out, diff)
+			}
+		}
+	}
+}
+
+func TestRDiff_ComputeDelta_ParallelSegments(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const blockSize = 1000
+	target := make([]byte, 3*parallelSegmentSize+777)
+	rnd.Read(target)
+	// the source inserts data before, after, and across the segment boundaries
+	var source []byte
+	for off := 0; off < len(target); off += parallelSegmentSize / 3 {
+		insert := make([]byte, rnd.Intn(2*blockSize))
+		rnd.Read(insert)
+		source = append(source, insert...)
+		source = append(source, target[off:min(off+parallelSegmentSize/3, len(target))]...)
+	}
+	for _, tt := range []struct {
+		name   string
+		source []byte
+	}{
+		{name: "identical", source: target},
+		{name: "modified", source: source},
+	} {
+		r := newTestRDiff(blockSize, rDiffE2EConfig{weakHash: WeakHashAdler32})
+		r.concurrency = 3
+		sig, err := r.ComputeSignature(bytes.NewReader(target))
+		if err != nil {
+			t.Fatalf("ComputeSignature() error = %v", err)
+		}
+		got, err := r.ComputeDelta(bytes.NewReader(tt.source), r.signatureHeader(), sig)
+		if err != nil {
+			t.Fatalf("%v: parallel ComputeDelta() error = %v", tt.name, err)
+		}
+		// every source byte is either part of a matched block, or literal data
+		covered, matched := 0, 0
+		for _, op := range got {
+			covered += len(op.Data)
+			if op.Type == OpBlockKeep || op.Type == OpBlockUpdate {
+				covered += min(blockSize, len(target)-int(op.BlockIndex)*blockSize)
+				matched++
+			}
+		}
+		if covered != len(tt.source) {
+			t.Errorf("%v: parallel ComputeDelta() covers %v bytes, want %v", tt.name, covered, len(tt.source))
+		}
+		if tt.name == "identical" && matched != sig.len() {
+			t.Errorf("%v: parallel ComputeDelta() matched %v blocks, want %v", tt.name, matched, sig.len())
+		}
+		// every insertion splits at most a block, and every segment boundary loses at most a block
+		if want := sig.len() - 2*len(tt.source)/(parallelSegmentSize/3) - 2; matched < want {
+			t.Errorf("%v: parallel ComputeDelta() matched %v blocks, want at least %v", tt.name, matched, want)
+		}
+	}
+}
+
+func TestRDiff_ComputeSignatureAt(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	large := make([]byte, 2*parallelSegmentSize+12345)
+	rnd.Read(large)
+	for _, tt := range []struct {
+		blockSize int
+		target    []byte
+	}{
+		{blockSize: 3, target: []byte{1, 2, 3, 4, 5, 6, 7}},
+		{blockSize: 700, target: large},
+		{blockSize: MaxBlockSize, target: large},
+	} {
+		want, err := newTestRDiff(tt.blockSize, rDiffE2EConfig{}).ComputeSignature(bytes.NewReader(tt.target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, concurrency := range []int{0, 1, 4} {
+			r := newTestRDiff(tt.blockSize, rDiffE2EConfig{})
+			r.concurrency = concurrency
+			got, err := r.ComputeSignatureAt(bytes.NewReader(tt.target), int64(len(tt.target)))
+			if err != nil {
+				t.Fatalf("ComputeSignatureAt() error = %v", err)
+			}
+			if diff := cmp.Diff(got.blocks(SignatureHeader{}), want.blocks(SignatureHeader{})); diff != "" {
+				t.Errorf("ComputeSignatureAt(concurrency: %v) differs from ComputeSignature, \nDIFF: %v", concurrency, diff)
+			}
+		}
+		// the target is shorter than the size
+		r := newTestRDiff(tt.blockSize, rDiffE2EConfig{})
+		r.concurrency = 2
+		if _, err = r.ComputeSignatureAt(bytes.NewReader(tt.target), int64(len(tt.target))+1); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("ComputeSignatureAt() error = %v, want %v", err, io.ErrUnexpectedEOF)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package rdiff
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// pathRule is an include or exclude pattern of a pathFilter.
+type pathRule struct {
+	include bool
+	re      *regexp.Regexp
+	// dirOnly means the pattern only matches directories(it ends with a slash)
+	dirOnly bool
+}
+
+// pathFilter decides which paths of a directory tree are visited, using rsync-style include and exclude rules,
+// checked in order, the first matching rule deciding. A path which doesn't match any rule is included.
+// An excluded directory is not visited, so none of its files are included, whatever the later rules.
+type pathFilter struct {
+	rules []pathRule
+	// err joins the invalid pattern errors, it's reported by the tree operations
+	err error
+}
+
+// add compiles the patterns, as include or exclude rules, appending them to the filter.
+func (f *pathFilter) add(include bool, patterns []string) {
+	for _, pattern := range patterns {
+		re, dirOnly, err := compileGlob(pattern)
+		if err != nil {
+			f.err = errors.Join(f.err, err)
+			continue
+		}
+		f.rules = append(f.rules, pathRule{include: include, re: re, dirOnly: dirOnly})
+	}
+}
+
+// excluded reports whether the relative path(using forward slashes) of a file, or of a directory, is excluded.
+// It doesn't check the parent directories, see excludedPath. A nil filter excludes nothing.
+func (f *pathFilter) excluded(rel string, dir bool) bool {
+	if f == nil {
+		return false
+	}
+	for _, rule := range f.rules {
+		if rule.dirOnly && !dir {
+			continue
+		}
+		if rule.re.MatchString(rel) {
+			return !rule.include
+		}
+	}
+
+	return false
+}
+
+// excludedPath reports whether the relative path of a file, or any of its parent directories, is excluded.
+func (f *pathFilter) excludedPath(rel string) bool {
+	for i, c := range rel {
+		if c == '/' && f.excluded(rel[:i], true) {
+			return true
+		}
+	}
+
+	return f.excluded(rel, false)
+}
+
+// compileGlob converts an rsync-style pattern to a regular expression matching the relative paths:
+//   - '*' matches any run of characters except '/', '?' matches any character except '/', and '[...]' matches
+//     a character class, negated by a leading '!' or '^'
+//   - '**' matches any run of characters, including '/', and a '**/' matches zero or more directories
+//   - '\' escapes the next character
+//   - a leading '/' anchors the pattern to the root, otherwise it matches the end of the path, at a directory
+//     boundary, so a pattern without a slash matches the name of the file or directory, at any depth
+//   - a trailing '/' means the pattern only matches directories
+func compileGlob(pattern string) (*regexp.Regexp, bool, error) {
+	glob, dirOnly := strings.CutSuffix(pattern, "/")
+	glob, anchored := strings.CutPrefix(glob, "/")
+	if glob == "" {
+		return nil, false, fmt.Errorf("invalid pattern %q: empty", pattern)
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(glob); i++ {
+		n, err := writeGlobToken(&sb, glob[i:])
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		i += n - 1
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	return re, dirOnly, nil
+}
+
+// writeGlobToken writes the regular expression of the glob token starting glob, and returns its length.
+func writeGlobToken(sb *strings.Builder, glob string) (int, error) {
+	switch {
+	case strings.HasPrefix(glob, "**/"):
+		sb.WriteString("(?:.*/)?")
+		return 3, nil
+	case strings.HasPrefix(glob, "**"):
+		sb.WriteString(".*")
+		return 2, nil
+	case glob[0] == '*':
+		sb.WriteString("[^/]*")
+	case glob[0] == '?':
+		sb.WriteString("[^/]")
+	case glob[0] == '[':
+		return writeGlobClass(sb, glob)
+	case glob[0] == '\\':
+		if len(glob) < 2 {
+			return 0, errors.New("trailing escape")
+		}
+		sb.WriteString(regexp.QuoteMeta(glob[1:2]))
+		return 2, nil
+	default:
+		sb.WriteString(regexp.QuoteMeta(glob[:1]))
+	}
+
+	return 1, nil
+}
+
+// writeGlobClass writes the regular expression of the character class starting glob, and returns its length.
+func writeGlobClass(sb *strings.Builder, glob string) (int, error) {
+	i := 1
+	sb.WriteString("[")
+	if i < len(glob) && (glob[i] == '!' || glob[i] == '^') {
+		sb.WriteString("^")
+		i++
+	}
+	// a ']' right after the opening bracket is part of the class
+	if i < len(glob) && glob[i] == ']' {
+		sb.WriteString(`\]`)
+		i++
+	}
+	for ; i < len(glob); i++ {
+		switch glob[i] {
+		case ']':
+			sb.WriteString("]")
+			return i + 1, nil
+		case '\\', '[':
+			sb.WriteString(`\`)
+		}
+		sb.WriteByte(glob[i])
+	}
+
+	return 0, errors.New("unterminated character class")
+}
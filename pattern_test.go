@@ -0,0 +1,80 @@
+package rdiff
+
+import "testing"
+
+func TestCompileGlob(t *testing.T) {
+	for _, tt := range []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "*.o", path: "main.o", want: true},
+		{pattern: "*.o", path: "sub/dir/main.o", want: true},
+		{pattern: "*.o", path: "main.go", want: false},
+		{pattern: "main.?", path: "main.c", want: true},
+		{pattern: "main.?", path: "main.cc", want: false},
+		{pattern: "/build", path: "build", want: true},
+		{pattern: "/build", path: "sub/build", want: false},
+		{pattern: "build", path: "sub/build", want: true},
+		{pattern: "build", path: "subbuild", want: false},
+		{pattern: "sub/*.o", path: "sub/a.o", want: true},
+		{pattern: "sub/*.o", path: "x/sub/a.o", want: true},
+		{pattern: "sub/*.o", path: "sub/x/a.o", want: false},
+		{pattern: "sub/**.o", path: "sub/x/a.o", want: true},
+		{pattern: "/a/**/b", path: "a/b", want: true},
+		{pattern: "/a/**/b", path: "a/x/y/b", want: true},
+		{pattern: "/a/**/b", path: "ab", want: false},
+		{pattern: "cache/**", path: "cache/x/y", want: true},
+		{pattern: "cache/**", path: "cache", want: false},
+		{pattern: "[abc].txt", path: "b.txt", want: true},
+		{pattern: "[!abc].txt", path: "b.txt", want: false},
+		{pattern: "[!abc].txt", path: "d.txt", want: true},
+		{pattern: "[]].txt", path: "].txt", want: true},
+		{pattern: `\*.txt`, path: "*.txt", want: true},
+		{pattern: `\*.txt`, path: "a.txt", want: false},
+		{pattern: "a+b(1).txt", path: "a+b(1).txt", want: true},
+		{pattern: ".git/", path: ".git", want: true},
+	} {
+		re, _, err := compileGlob(tt.pattern)
+		if err != nil {
+			t.Fatalf("compileGlob(%q) error = %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("compileGlob(%q) matches %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCompileGlob_Invalid(t *testing.T) {
+	for _, pattern := range []string{"", "/", "//", "[abc", "a\\"} {
+		if _, _, err := compileGlob(pattern); err == nil {
+			t.Errorf("compileGlob(%q) error = nil, want an error", pattern)
+		}
+	}
+}
+
+func TestPathFilter_Excluded(t *testing.T) {
+	f := &pathFilter{}
+	f.add(true, []string{"keep.o", "/vendor/"})
+	f.add(false, []string{"*.o", "vendor/", ".git/"})
+	for _, tt := range []struct {
+		path string
+		want bool
+	}{
+		{path: "main.go", want: false},
+		{path: "main.o", want: true},
+		{path: "sub/keep.o", want: false},
+		{path: "vendor/lib.go", want: false},
+		{path: "sub/vendor/lib.go", want: true},
+		{path: ".git/HEAD", want: true},
+		// a trailing slash only matches directories
+		{path: ".git", want: false},
+	} {
+		if got := f.excludedPath(tt.path); got != tt.want {
+			t.Errorf("excludedPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+	if (*pathFilter)(nil).excludedPath("main.o") {
+		t.Errorf("excludedPath() of a nil filter = true, want false")
+	}
+}
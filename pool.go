@@ -0,0 +1,62 @@
+package rdiff
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// maxPooledBufferSize is the biggest buffer capacity kept by the pool, so a single huge literal run doesn't
+// stay in memory forever
+const maxPooledBufferSize = 8 * MaxBlockSize
+
+// bufferPool reuses the byte buffers across the signature and delta computations, of all the App instances,
+// so services diffing lots of files don't allocate new buffers for every call.
+var bufferPool = sync.Pool{
+	New: func() any {
+		return new([]byte)
+	},
+}
+
+// readBufferSize is the size of the buffered readers, used to feed the rolling loop from memory
+const readBufferSize = 2 * MaxBlockSize
+
+// readerPool reuses the buffered readers across the delta computations.
+var readerPool = sync.Pool{
+	New: func() any {
+		return bufio.NewReaderSize(nil, readBufferSize)
+	},
+}
+
+// getBuffer returns a pooled buffer of length size, it must be given back using putBuffer.
+func getBuffer(size int) *[]byte {
+	bp := bufferPool.Get().(*[]byte)
+	if cap(*bp) < size {
+		*bp = make([]byte, size)
+	}
+	*bp = (*bp)[:size]
+
+	return bp
+}
+
+// putBuffer gives the buffer back to the pool, the buffer must not be used afterward.
+func putBuffer(bp *[]byte) {
+	if cap(*bp) > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(bp)
+}
+
+// getReader returns a pooled buffered reader, reading from r, it must be given back using putReader.
+func getReader(r io.Reader) *bufio.Reader {
+	br := readerPool.Get().(*bufio.Reader)
+	br.Reset(r)
+
+	return br
+}
+
+// putReader gives the reader back to the pool, without retaining the underlying reader.
+func putReader(br *bufio.Reader) {
+	br.Reset(nil)
+	readerPool.Put(br)
+}
@@ -0,0 +1,56 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/md5"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/silviutanasa/rdiff/rollsum"
+)
+
+func TestGetBuffer(t *testing.T) {
+	for _, size := range []int{0, 1, 700, MaxBlockSize, maxPooledBufferSize + 1} {
+		bp := getBuffer(size)
+		if len(*bp) != size {
+			t.Errorf("getBuffer(%v) len = %v", size, len(*bp))
+		}
+		putBuffer(bp)
+	}
+}
+
+// TestBufferPool_Concurrent runs several engines concurrently, sharing the pool, and checks their results
+// are not affected by each other.
+func TestBufferPool_Concurrent(t *testing.T) {
+	target := []byte{1, 2, 3, 4, 5, 6, 1, 2, 3, 7, 8}
+	source := []byte{11, 5, 22, 1, 2, 3, 88, 4, 5, 6, 1, 2, 3, 7, 8, 9, 10, 11, 12, 13, 14, 15, 29}
+	want := rDiffE2ETests[0].out
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := newRDiff(3, rollsum.NewAdler32(), md5.New())
+			for j := 0; j < 100; j++ {
+				sig, err := r.ComputeSignature(bytes.NewReader(target))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				got, err := r.ComputeDelta(bytes.NewReader(source), r.signatureHeader(), sig)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if diff := cmp.Diff(got, want); diff != "" {
+					t.Errorf("concurrent delta got = %v, want %v, \nDIFF: %v", got, want, diff)
+					return
+				}
+				r.Reset()
+			}
+		}()
+	}
+	wg.Wait()
+}
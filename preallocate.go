@@ -0,0 +1,33 @@
+package rdiff
+
+import (
+	"errors"
+	"os"
+)
+
+// errAllocateUnsupported is returned by allocate if the platform, or the filesystem, can't reserve the space upfront.
+var errAllocateUnsupported = errors.New("space preallocation is not supported")
+
+// preallocate reserves size bytes for the empty file f, and sets its size, so the following writes don't extend it.
+// Where the space can't be reserved upfront, it only sets the size.
+func preallocate(f *os.File, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var allocErr error
+	err = rc.Control(func(fd uintptr) {
+		allocErr = allocate(fd, size)
+	})
+	if err != nil {
+		return err
+	}
+	if errors.Is(allocErr, errAllocateUnsupported) {
+		return f.Truncate(size)
+	}
+
+	return allocErr
+}
@@ -0,0 +1,17 @@
+package rdiff
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocate reserves the space using fallocate, which fails with ENOSPC if there is not enough space.
+func allocate(fd uintptr, size int64) error {
+	err := unix.Fallocate(int(fd), 0, 0, size)
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.ENOSYS) {
+		return errAllocateUnsupported
+	}
+
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package rdiff
+
+// allocate can't reserve the space upfront on this platform.
+func allocate(_ uintptr, _ int64) error {
+	return errAllocateUnsupported
+}
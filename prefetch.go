@@ -0,0 +1,111 @@
+package rdiff
+
+import (
+	"errors"
+	"io"
+)
+
+// prefetchChunkSize is the size of the buffers read ahead by a prefetchReader
+const prefetchChunkSize = 2 * MaxBlockSize
+
+// prefetchChunk is a buffer filled by the prefetch goroutine, the data is buf[:n].
+type prefetchChunk struct {
+	buf *[]byte
+	n   int
+	err error
+}
+
+// prefetchReader reads ahead the underlying reader on a separate goroutine, using a ring of depth buffers, so the
+// reading latency overlaps the hashing/matching of the previously read data. It must be closed, to stop the goroutine.
+type prefetchReader struct {
+	// filled holds the read buffers, in order
+	filled chan prefetchChunk
+	// free holds the buffers ready to be filled
+	free chan *[]byte
+	done chan struct{}
+	// exited is closed when the goroutine returns
+	exited chan struct{}
+	// cur is the chunk being read, and data its unread part
+	cur  prefetchChunk
+	data []byte
+}
+
+func newPrefetchReader(r io.Reader, depth int) *prefetchReader {
+	p := &prefetchReader{
+		filled: make(chan prefetchChunk, depth),
+		free:   make(chan *[]byte, depth+1),
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	for i := 0; i < depth; i++ {
+		p.free <- getBuffer(prefetchChunkSize)
+	}
+	go p.run(r)
+
+	return p
+}
+
+// run fills the free buffers, until the underlying reader returns an error(including io.EOF), or the reader is closed.
+func (p *prefetchReader) run(r io.Reader) {
+	defer close(p.exited)
+	for {
+		var buf *[]byte
+		select {
+		case buf = <-p.free:
+		case <-p.done:
+			return
+		}
+		n, err := io.ReadFull(r, *buf)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		select {
+		case p.filled <- prefetchChunk{buf: buf, n: n, err: err}:
+		case <-p.done:
+			putBuffer(buf)
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read reads the prefetched data, it blocks only if the goroutine didn't fill the next buffer yet.
+func (p *prefetchReader) Read(b []byte) (int, error) {
+	for len(p.data) == 0 {
+		if p.cur.err != nil {
+			return 0, p.cur.err
+		}
+		if p.cur.buf != nil {
+			// free has room for all the buffers, so it never blocks
+			p.free <- p.cur.buf
+		}
+		p.cur = <-p.filled
+		p.data = (*p.cur.buf)[:p.cur.n]
+	}
+	n := copy(b, p.data)
+	p.data = p.data[n:]
+
+	return n, nil
+}
+
+// Close stops the goroutine, waiting for its current read, and releases the buffers.
+// The reader must not be used afterward.
+func (p *prefetchReader) Close() error {
+	close(p.done)
+	<-p.exited
+	if p.cur.buf != nil {
+		putBuffer(p.cur.buf)
+	}
+	close(p.filled)
+	for c := range p.filled {
+		putBuffer(c.buf)
+	}
+	close(p.free)
+	for buf := range p.free {
+		putBuffer(buf)
+	}
+
+	return nil
+}
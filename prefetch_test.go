@@ -0,0 +1,48 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+)
+
+func TestPrefetchReader(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, size := range []int{0, 1, prefetchChunkSize, 3*prefetchChunkSize + 5} {
+		content := make([]byte, size)
+		rnd.Read(content)
+		for _, depth := range []int{1, 2, 8} {
+			p := newPrefetchReader(iotest.HalfReader(bytes.NewReader(content)), depth)
+			if err := iotest.TestReader(p, content); err != nil {
+				t.Errorf("prefetchReader(size: %v, depth: %v) error = %v", size, depth, err)
+			}
+			_ = p.Close()
+		}
+	}
+}
+
+func TestPrefetchReader_Error(t *testing.T) {
+	wantErr := errors.New("read error")
+	content := make([]byte, prefetchChunkSize+10)
+	p := newPrefetchReader(io.MultiReader(bytes.NewReader(content), iotest.ErrReader(wantErr)), 2)
+	defer p.Close()
+	got, err := io.ReadAll(p)
+	if !errors.Is(err, wantErr) || len(got) != len(content) {
+		t.Errorf("prefetchReader read %v bytes, error = %v, want %v bytes, error = %v", len(got), err, len(content), wantErr)
+	}
+}
+
+func TestPrefetchReader_CloseEarly(t *testing.T) {
+	content := make([]byte, 10*prefetchChunkSize)
+	p := newPrefetchReader(bytes.NewReader(content), 2)
+	if _, err := p.Read(make([]byte, 10)); err != nil {
+		t.Fatalf("prefetchReader.Read() error = %v", err)
+	}
+	// the goroutine is blocked on a full ring, Close must stop it anyway
+	if err := p.Close(); err != nil {
+		t.Errorf("prefetchReader.Close() error = %v", err)
+	}
+}
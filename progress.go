@@ -0,0 +1,64 @@
+package rdiff
+
+import "io"
+
+// Progress reports the progress of a Signature, Delta, Patch, ManifestDir, Verify or EstimateDelta call.
+type Progress struct {
+	// Phase is the name of the running call: "signature", "delta", "patch", "manifest", "verify" or "estimate"
+	Phase string
+	// Done is the number of bytes processed so far, out of Total
+	Done  int64
+	Total int64
+}
+
+// progressReader reports the bytes read from r, as the progress of the phase.
+type progressReader struct {
+	r        io.Reader
+	progress Progress
+	fn       func(Progress)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.progress.Done += int64(n)
+		pr.fn(pr.progress)
+	}
+
+	return n, err
+}
+
+// progressWriter reports the bytes written to w, as the progress of the phase.
+type progressWriter struct {
+	w        io.Writer
+	progress Progress
+	fn       func(Progress)
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	if n > 0 {
+		pw.progress.Done += int64(n)
+		pw.fn(pw.progress)
+	}
+
+	return n, err
+}
+
+// withReadProgress returns r reporting its reads to the configured progress function, if any.
+func (a *App) withReadProgress(r io.Reader, phase string, total int64) io.Reader {
+	if a.progress == nil {
+		return r
+	}
+
+	return &progressReader{r: r, progress: Progress{Phase: phase, Total: total}, fn: a.progress}
+}
+
+// withWriteProgress returns w reporting its writes to the configured progress function, if any.
+func (a *App) withWriteProgress(w io.Writer, phase string, total int64) io.Writer {
+	if a.progress == nil {
+		return w
+	}
+
+	return &progressWriter{w: w, progress: Progress{Phase: phase, Total: total}, fn: a.progress}
+}
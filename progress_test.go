@@ -0,0 +1,41 @@
+package rdiff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApp_WithProgress(t *testing.T) {
+	dir := t.TempDir()
+	target, source := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	sig, delta, output := filepath.Join(dir, "signature"), filepath.Join(dir, "delta"), filepath.Join(dir, "output")
+	if err := os.WriteFile(target, bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7}, 1000), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(source, bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6, 7}, 1000), 0666); err != nil {
+		t.Fatal(err)
+	}
+	last := map[string]Progress{}
+	app := New(100, WithProgress(func(p Progress) {
+		if prev, ok := last[p.Phase]; ok && p.Done < prev.Done {
+			t.Errorf("%v progress went back from %v to %v", p.Phase, prev.Done, p.Done)
+		}
+		last[p.Phase] = p
+	}))
+	if err := app.Signature(target, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(sig, source, delta); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Patch(target, delta, output); err != nil {
+		t.Fatal(err)
+	}
+	for phase, total := range map[string]int64{"signature": 7000, "delta": 8000, "patch": 8000} {
+		if got := last[phase]; got.Done != total || got.Total != total {
+			t.Errorf("%v last progress = %+v, want %v bytes done out of %v", phase, got, total, total)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package rdiff
+
+import (
+	"context"
+	"io"
+
+	"github.com/silviutanasa/rdiff/internal/ratelimit"
+)
+
+// limitReader returns r limited by the configured rate limiter, if any.
+func (a *App) limitReader(r io.Reader) io.Reader {
+	return ratelimit.Reader(context.Background(), r, a.limiter)
+}
+
+// limitWriter returns w limited by the configured rate limiter, if any.
+func (a *App) limitWriter(w io.Writer) io.Writer {
+	return ratelimit.Writer(context.Background(), w, a.limiter)
+}
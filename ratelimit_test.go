@@ -0,0 +1,50 @@
+package rdiff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestApp_WithRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	target := bytes.Repeat([]byte("the target content, "), 3200)
+	source := append([]byte("the source content, "), target...)
+	targetPath, sourcePath := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	if err := os.WriteFile(targetPath, target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sourcePath, source, 0666); err != nil {
+		t.Fatal(err)
+	}
+	sig, delta, output := filepath.Join(dir, "signature"), filepath.Join(dir, "delta"), filepath.Join(dir, "output")
+	const bytesPerSecond, burst = 4 << 20, 4 << 10
+	app := New(512, WithRateLimit(rate.NewLimiter(bytesPerSecond, burst)))
+
+	start := time.Now()
+	if err := app.Signature(targetPath, sig); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(sig, sourcePath, delta); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Patch(targetPath, delta, output); err != nil {
+		t.Fatal(err)
+	}
+	// the target and the source are read, and the output is written, through the limiter
+	limited := int64(len(target) + 2*len(source) - burst)
+	if elapsed, want := time.Since(start), time.Duration(limited*int64(time.Second)/bytesPerSecond); elapsed < want {
+		t.Errorf("the calls took %v, want at least %v", elapsed, want)
+	}
+	got, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, source) {
+		t.Errorf("the output has %v bytes, which differ from the %v source bytes", len(got), len(source))
+	}
+}
@@ -1,10 +1,14 @@
 package rdiff
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
+	"fmt"
 	"hash"
 	"io"
-	"slices"
+
+	"github.com/silviutanasa/rdiff/rollsum"
 )
 
 // OpType represents a block operation/instruction, useful to recompute the target, based on source.
@@ -17,39 +21,135 @@ const (
 	OpBlockUpdate
 	// OpBlockRemove means there is no match for a target block in the source
 	OpBlockRemove
-	// OpBlockNew means there is a literal block in the source that doesn't have any match in the target - new data
+	// OpBlockNew means there is a literal block in the source that doesn't have any match in the target - new data,
+	// at its position in the source: it's the trailing literal, or a literal split because it reached the memory
+	// budget, or the max literal length, in between the other operations
 	OpBlockNew
+	// OpBlockZero means there is a run of Zeros zero bytes in the source, which carries no data, it's only emitted
+	// by a sparse delta computation, see WithSparse, in between the other operations
+	OpBlockZero
+	// OpBlockCopy means there is a match in the target for a block already kept, updated or removed, so it's
+	// copied again, preceded by the literal data, if any; it's only emitted by a delta computation reusing the
+	// blocks, see WithBlockReuse, in between the other operations
+	OpBlockCopy
+	// OpBlockPart means there is a match in the target for a smaller block, of DeltaHeader.SecondPassBlockSize bytes,
+	// found in a literal region, so it's copied, preceded by the literal data, if any; it's only emitted by a delta
+	// computation running a second pass, see WithSecondPass, in between the other operations
+	OpBlockPart
 )
 
+// String returns the name of the operation type.
+func (t OpType) String() string {
+	switch t {
+	case OpBlockKeep:
+		return "keep"
+	case OpBlockUpdate:
+		return "update"
+	case OpBlockRemove:
+		return "remove"
+	case OpBlockNew:
+		return "new"
+	case OpBlockZero:
+		return "zero"
+	case OpBlockCopy:
+		return "copy"
+	case OpBlockPart:
+		return "part"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// copiesBlock reports whether the operations of the type are followed, in the source, by their target block.
+func (t OpType) copiesBlock() bool {
+	return t == OpBlockKeep || t == OpBlockUpdate || t == OpBlockCopy
+}
+
 // Block represents a chunk of data(bytes) used by the target to split its data.
 type Block struct {
 	StrongHash []byte
-	WeakHash   uint32
+	// WeakHash holds the rolling hash of the block, the 32 bits rolling hashes are zero extended
+	WeakHash uint64
+	// Offset is the offset of the block in the target, and Length its size, in bytes, so the short last block is
+	// represented exactly. They are set by the readers if the SignatureHeader records the block size, and the target
+	// size, otherwise they are 0, the blocks being located by their index.
+	Offset int64 `json:",omitempty"`
+	Length int   `json:",omitempty"`
 }
 
 // Operation represents an instruction given by the source to the target, in order to allow the target to update its content.
+// The operations of a delta are in the source order, which is also the target blocks order, as the blocks are only
+// matched in order, so the source is rebuilt in a single pass, by writing, for every operation, its Data, followed by
+// the target block, if it's kept, updated or copied, or the second pass block of a part, or its zero run.
 type Operation struct {
 	Type OpType
 	// the index of the block from the target, for OpBlockNew -1 is used to enforce that the BlockIndex
 	// is not important in this case
-	BlockIndex int
+	BlockIndex int64
 	// additional literal data, if the block was modified, or a new block if the Block was not matched (BlockIndex == 0)
 	Data []byte
+	// Zeros is the number of zero bytes of an OpBlockZero
+	Zeros int64 `json:",omitempty"`
 }
 
-// blockData is used to compute the block search list(map[uint32][]blockData)
-type blockData struct {
-	strongHash []byte
-	blockIndex int
+type rDiff struct {
+	blockSize int
+	// blockSizePinned means the block size was explicitly configured, so it can't be adopted from a signature
+	blockSizePinned bool
+	weakHashType    WeakHashType
+	// weakHashPinned means the weak hash was explicitly configured, so it can't be adopted from a signature
+	weakHashPinned bool
+	weakHasher     rollsum.RollingHash
+	strongHashType StrongHashType
+	// strongHashPinned means the strong hash was explicitly configured, so it can't be adopted from a signature
+	strongHashPinned bool
+	strongHasher     hash.Hash
+	// the HMAC key of the strong hasher, empty if the strong hash is not keyed
+	strongHashKey []byte
+	// the number of strong hash bytes to store/compare per block, 0 means the full digest
+	strongHashSize int
+	// the max size of the literal data kept in memory by the delta computation, 0 means unlimited
+	maxMemory int
+	// the number of workers used by the parallel computations, values <= 1 mean a sequential computation
+	concurrency int
+	// sparse means the zero blocks of the source are emitted as zero runs, and the inputs are read skipping
+	// their holes
+	sparse bool
+	// blockReuse means a target block can be matched again, after its own operation, see WithBlockReuse
+	blockReuse bool
+	// literalChunkSize is the max length of the literal data of a computed operation, see WithLiteralChunkSize
+	literalChunkSize int
+	// minMatch is the min number of consecutive matched blocks sent as matches, see WithMinMatch
+	minMatch int
+	// coalesceLiterals means the adjacent literal runs are sent as a single one, see WithCoalesceLiterals
+	coalesceLiterals bool
+	// secondPass is the block size of the second pass hashes recorded by the signatures, and it enables the second
+	// pass of the delta computations, see WithSecondPass, 0 means none
+	secondPass int
+	// stats of the last delta computation
+	stats DeltaStats
+	// patchStats of the last delta application
+	patchStats PatchStats
+	// windowBuf is reused to read the rolling window content, on every weak hash match
+	windowBuf []byte
+	// sumBuf is reused to compute the strong hash, on every weak hash match
+	sumBuf []byte
+	// zeroBlock holds the hashes of a zero block of zeroBlock.size bytes, computed once by a sparse signature
+	zeroBlock zeroBlockSums
+	// checkpoint resumes the computations and receives their checkpoints, nil if they're not checkpointed
+	checkpoint *checkpointHook
+	// limits bound the signatures and deltas decoded, and the literal data of the delta operations computed
+	limits DecodeLimits
 }
 
-type rDiff struct {
-	blockSize    int
-	weakHasher   *adler32RollingHash
-	strongHasher hash.Hash
+// zeroBlockSums are the hashes of a block of zeros.
+type zeroBlockSums struct {
+	size   int
+	weak   uint64
+	strong []byte
 }
 
-func newRDiff(blockSize int, weakHasher *adler32RollingHash, strongHasher hash.Hash) *rDiff {
+func newRDiff(blockSize int, weakHasher rollsum.RollingHash, strongHasher hash.Hash) *rDiff {
 	return &rDiff{
 		blockSize:    blockSize,
 		weakHasher:   weakHasher,
@@ -57,132 +157,375 @@ func newRDiff(blockSize int, weakHasher *adler32RollingHash, strongHasher hash.H
 	}
 }
 
-// ComputeSignature computes the signature of a target and returns a []Block, based on the blockSize.
-// Every Block contains the weak hash and strong hash.
-// It returns a non-nil error in case target encounters a reading error, other than io.EOF.
-func (r *rDiff) ComputeSignature(target io.Reader) ([]Block, error) {
-	var output []Block
-	block := make([]byte, r.blockSize)
+// ComputeSignature computes the signature of a target and returns it in columnar form, based on the blockSize.
+// Every block has a weak hash and a strong hash.
+// It returns a non-nil error in case target encounters a reading error, other than io.EOF. The target is read
+// using io.ReadFull, so its short reads don't change the block boundaries.
+// With more than one worker configured, the blocks are hashed concurrently, unless the weak hash is a custom one,
+// which can't be constructed for every worker.
+func (r *rDiff) ComputeSignature(target io.Reader) (signatureTable, error) {
+	if r.parallel() && r.checkpoint == nil {
+		return r.computeSignatureParallel(target, r.concurrency)
+	}
+
+	output, offset := r.checkpoint.signatureStart()
+	blockBuf := getBuffer(r.blockSize)
+	defer putBuffer(blockBuf)
+	block := *blockBuf
 	// it's enough a single Reset call, as the WriteAll method acts like a Reset and Write.
 	r.weakHasher.Reset()
 	for {
-		n, err := target.Read(block)
-		if n == 0 && err == io.EOF {
+		// a short read is not a block boundary, only the last block of the target can be shorter
+		n, err := io.ReadFull(target, block)
+		// a zero block size reads nothing, ex: the signature of an empty target
+		if err == io.EOF || n == 0 {
 			break
 		}
-		if err != nil && err != io.EOF {
+		if err != nil && err != io.ErrUnexpectedEOF {
 			return output, err
 		}
 
-		block = block[:n]
-		r.strongHasher.Reset()
-		_, _ = r.strongHasher.Write(block)
-		// it doesn't need reset, as it's always rewriting the digest
-		r.weakHasher.WriteAll(block)
-		bl := Block{
-			StrongHash: r.strongHasher.Sum(nil),
-			WeakHash:   r.weakHasher.Sum32(),
+		output = r.appendBlockSums(output, block[:n])
+		offset += int64(n)
+		saveErr := r.checkpoint.saveSignature(offset, output)
+		if saveErr != nil || err == io.ErrUnexpectedEOF {
+			return output, saveErr
 		}
-		output = append(output, bl)
 	}
 
 	return output, nil
 }
 
-// ComputeDelta computes the instruction list(operations list) based on the target's blockList
+// appendBlockSums appends the hashes of the block to the signature t and returns the extended signature.
+func (r *rDiff) appendBlockSums(t signatureTable, block []byte) signatureTable {
+	if r.sparse && len(block) == r.blockSize && isZero(block) {
+		t.WeakHashes, t.StrongHashes = r.appendZeroBlockSums(t.WeakHashes, t.StrongHashes)
+		return t
+	}
+	// it doesn't need reset, as it's always rewriting the digest
+	r.weakHasher.WriteAll(block)
+	t.WeakHashes = append(t.WeakHashes, r.weakHasher.Sum())
+	t.StrongHashes = r.appendStrongSum(t.StrongHashes, block)
+
+	return t
+}
+
+// ComputeDelta computes the instruction list(operations list) based on the target's signature
 // to be able to update its content to match the source.
-func (r *rDiff) ComputeDelta(source io.Reader, blockList []Block) ([]Operation, error) {
-	tempDelta := make(map[int]Operation, len(blockList))
-	searchList := computeSearchList(blockList)
-	block := make([]byte, r.blockSize)
-	var literal []byte
+// The header describes the parameters the signature was computed with, and it's negotiated against the engine
+// configuration before anything else, returning a non-nil error if they are not compatible.
+// With more than one worker configured, the source is split in segments, matched concurrently against the signature,
+// unless the weak hash is a custom one, or the computation is sparse.
+func (r *rDiff) ComputeDelta(source io.Reader, header SignatureHeader, signature signatureTable) ([]Operation, error) {
+	// signature.len()+1 is used to cover the max possible size: all target blocks + 1 extra literal block(if any)
+	delta := make([]Operation, 0, signature.len()+1)
+	err := r.ComputeDeltaFunc(source, header, signature, func(op Operation) error {
+		delta = append(delta, op)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return delta, nil
+}
+
+// ComputeDeltaFunc computes the same operations as ComputeDelta, but instead of collecting them, it passes them
+// to emit, in their final order, as soon as they are known, so the memory used doesn't depend on the source size,
+// but only on the largest literal run, or on the memory budget, if configured: the head of a literal run reaching
+// the budget is spilled to a temporary file, and emitted as new blocks, read back by offset, once the run ends.
+// The target blocks are matched in order, so a block matched in the source before a block with a lower index is sent
+// as literal data.
+// It returns the first non-nil error returned by emit.
+// The engine computing the delta is a copy negotiated against the header, see negotiated, and its stats are copied
+// back once it returns.
+func (r *rDiff) ComputeDeltaFunc(source io.Reader, header SignatureHeader, signature signatureTable, emit func(Operation) error) error {
+	n, err := r.negotiated(header)
+	if err != nil {
+		return err
+	}
+	err = n.computeDeltaFunc(source, header, signature, emit)
+	r.stats = n.stats
+
+	return err
+}
+
+// computeDeltaFunc is ComputeDeltaFunc, run on the engine negotiated against the header of the signature.
+func (r *rDiff) computeDeltaFunc(source io.Reader, header SignatureHeader, signature signatureTable, emit func(Operation) error) error {
+	err := signature.validate(r.strongHashSize)
+	if err != nil {
+		return err
+	}
+	secondPass, err := r.newSecondPassMatcher(header)
+	if err != nil {
+		return err
+	}
+	searchList := computeSearchList(&signature)
+	r.stats = DeltaStats{SearchListMemory: searchList.memory(), MapSearchListMemory: searchList.mapMemory()}
+	emitter := &deltaEmitter{
+		emit:       r.countingEmit(emit),
+		blocks:     int64(signature.len()),
+		maxLiteral: r.maxLiteral(),
+		minMatch:   r.minMatch,
+		coalesce:   r.coalesceLiterals,
+		secondPass: secondPass,
+		maxMemory:  r.maxMemory,
+	}
+	r.checkpoint.resumeDelta(searchList, emitter, &r.stats)
+	if r.parallel() && !r.sparse && r.checkpoint == nil {
+		err = r.computeDeltaParallel(source, searchList, emitter, r.concurrency)
+	} else {
+		err = r.computeDelta(source, searchList, emitter)
+	}
+	err = errors.Join(err, emitter.closeSpill())
+	r.stats.Unchanged = err == nil && r.stats.unchanged(emitter.blocks)
+
+	return err
+}
+
+// computeDelta runs the rolling match loop over the source, passing the operations to the emitter.
+// The source is buffered, so the rolling mode reads a byte at a time from memory, instead of the source.
+func (r *rDiff) computeDelta(source io.Reader, searchList *searchList, emitter *deltaEmitter) error {
+	reader := getReader(source)
+	defer putReader(reader)
+	blockBuf := getBuffer(r.blockSize)
+	defer putBuffer(blockBuf)
+	block := *blockBuf
+	literalBuf := getBuffer(0)
+	literal := *literalBuf
+	defer func() {
+		// the literal may have grown, so the pool gets the grown buffer
+		*literalBuf = literal[:0]
+		putBuffer(literalBuf)
+	}()
 	// it's enough a single Reset call, as the WriteAll method acts like a Reset and Write.
 	r.weakHasher.Reset()
 	rolling := false
+	// zeros is the number of trailing zero bytes read, used by the sparse computations
+	zeros := 0
 	for {
-		n, err := r.read(source, block, rolling)
+		n, err := r.read(reader, block, rolling)
 		if n == 0 && err == io.EOF {
 			break
 		}
 		if err != nil && err != io.EOF {
-			return nil, err
+			return err
 		}
 
 		block = block[:n]
+		emitter.offset += int64(n)
+		zeros = r.trailingZeros(zeros, block)
 		if !rolling {
 			r.weakHasher.WriteAll(block)
 		} else {
 			oldest := r.weakHasher.Roll(block[0])
 			literal = append(literal, oldest)
+			literal, err = r.flushLiteral(emitter, literal)
+			if err != nil {
+				return err
+			}
 		}
 
-		if blIdx := r.searchBlock(searchList, r.weakHasher.Sum32()); blIdx != -1 {
+		if blIdx := r.searchBlock(searchList, r.weakHasher.Sum()); blIdx != -1 {
 			rolling = false
 
-			tempDelta[blIdx] = createOperation(blIdx, literal)
+			err = emitter.match(blIdx, literal, r.windowBuf)
+			if err != nil {
+				return err
+			}
 			literal = literal[:0]
 
 			continue
 		}
+		if r.zeroWindowFull(zeros, n, rolling) {
+			rolling = false
+			literal, err = r.zeroWindow(emitter, literal)
+			if err != nil {
+				return err
+			}
+			continue
+		}
 
 		rolling = true
 	}
 
-	r.updateDeltaWithLiteralBlockOperation(tempDelta, rolling, literal)
-
-	return computeFinalDelta(blockList, tempDelta), nil
-}
-func (r *rDiff) updateDeltaWithLiteralBlockOperation(delta map[int]Operation, rolling bool, literal []byte) {
-	// the last read block will not be added to the delta if it was not matched in the target,
+	// the last read block will not be emitted if it was not matched in the target,
 	// so we need to add it to the literal collection
 	if rolling {
-		l := r.weakHasher.GetWindowContent()
-		literal = append(literal, l...)
+		literal = r.weakHasher.AppendWindowContent(literal)
 	}
-	// collecting leftovers literals into a single new block
-	if len(literal) > 0 {
-		op := Operation{
-			Type:       OpBlockNew,
-			BlockIndex: -1,
-		}
-		op.Data = append(op.Data, literal...)
-		delta[-1] = op
+
+	return emitter.finish(literal)
+}
+
+// Reset resets the hashers, releases the buffers retained between calls and clears the stats of the last calls.
+func (r *rDiff) Reset() {
+	if r.weakHasher != nil {
+		r.weakHasher.Reset()
+	}
+	if r.strongHasher != nil {
+		r.strongHasher.Reset()
+	}
+	r.windowBuf, r.sumBuf = nil, nil
+	r.stats, r.patchStats = DeltaStats{}, PatchStats{}
+}
+
+// checkHashers returns a non-nil error if the configured hash algorithms are unknown.
+func (r *rDiff) checkHashers() error {
+	if r.weakHasher == nil {
+		return fmt.Errorf("unknown weak hash type: %v", r.weakHashType)
+	}
+	if r.strongHasher == nil {
+		return fmt.Errorf("unknown strong hash type: %v", r.strongHashType)
 	}
+
+	return nil
 }
-func (r *rDiff) read(reader io.Reader, block []byte, rolling bool) (int, error) {
+func (r *rDiff) read(reader *bufio.Reader, block []byte, rolling bool) (int, error) {
 	// adjusting reading size to block of bytes or single byte
-	// after a found match in the target, we need to read up to a full block
-	// if rolling is in place, then we read up to a single byte
+	// after a found match in the target, we need to read a full block, or what's left of the source
+	// if rolling is in place, then we read a single byte
 	if !rolling {
-		block = block[:r.blockSize]
-	} else {
-		block = block[:1]
+		n, err := io.ReadFull(reader, block[:r.blockSize])
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+
+		return n, err
+	}
+	b, err := reader.ReadByte()
+	if err != nil {
+		return 0, err
 	}
+	block[0] = b
 
-	return reader.Read(block)
+	return 1, nil
 }
-func (r *rDiff) searchBlock(searchList map[uint32][]blockData, weakHash uint32) int {
-	if bl, found := searchList[weakHash]; found {
-		r.strongHasher.Reset()
-		currBlockContent := r.weakHasher.GetWindowContent()
-		// nolint
-		r.strongHasher.Write(currBlockContent)
-		strongHash := r.strongHasher.Sum(nil)
-		blFoundIdx := slices.IndexFunc(bl, func(el blockData) bool { return bytes.Equal(el.strongHash, strongHash) })
-		if blFoundIdx != -1 {
-			blockIndex := bl[blFoundIdx].blockIndex
-			//remove the strong hash from the list, because if we have identical blocks in the target,
-			//then we'll always match the same block
-			searchList[weakHash] = slices.Delete(bl, blFoundIdx, blFoundIdx+1)
-
-			return blockIndex
+func (r *rDiff) searchBlock(searchList *searchList, weakHash uint64) int {
+	var strongHash []byte
+	// reused is the first matching block before the next expected one, returned if there is none after it
+	reused := -1
+	for _, e := range searchList.candidates(weakHash) {
+		//skip the blocks before the next expected one, they are either already matched, or the delta
+		//would be out of order, and if we have identical blocks in the target, we'll match the first one after,
+		//unless the blocks are reused
+		if e.blockIndex < searchList.next && (!r.blockReuse || reused != -1) {
+			continue
+		}
+		// the strong hash is computed only once, and only if there is a candidate
+		if strongHash == nil {
+			r.windowBuf = r.weakHasher.AppendWindowContent(r.windowBuf[:0])
+			r.sumBuf = r.appendStrongSum(r.sumBuf[:0], r.windowBuf)
+			strongHash = r.sumBuf
+		}
+		if !bytes.Equal(searchList.signature.strongHash(e.blockIndex), strongHash) {
+			r.stats.WeakHashCollisions++
+			continue
+		}
+		if e.blockIndex < searchList.next {
+			reused = e.blockIndex
+			continue
 		}
+		searchList.next = e.blockIndex + 1
+
+		return e.blockIndex
 	}
 
-	return -1
+	return reused
 }
 
-func createOperation(index int, lit []byte) Operation {
+// appendStrongSum appends the strong hash of p, truncated to the configured strong hash size, to dst
+// and returns the extended buffer.
+func (r *rDiff) appendStrongSum(dst, p []byte) []byte {
+	r.strongHasher.Reset()
+	_, _ = r.strongHasher.Write(p)
+	n := len(dst)
+
+	return r.strongHasher.Sum(dst)[:n+r.effectiveStrongHashSize()]
+}
+
+// effectiveStrongHashSize returns the number of strong hash bytes stored/compared per block.
+func (r *rDiff) effectiveStrongHashSize() int {
+	if r.strongHashSize <= 0 || r.strongHashSize > r.strongHasher.Size() {
+		return r.strongHasher.Size()
+	}
+
+	return r.strongHashSize
+}
+
+// trailingZeros returns the number of trailing zero bytes read, for a sparse computation, given the previous one,
+// zeros, and the bytes just read, p. It's capped to the block size, so it's the size of the window once it's all
+// zeros.
+func (r *rDiff) trailingZeros(zeros int, p []byte) int {
+	if !r.sparse {
+		return 0
+	}
+	i := len(p)
+	for i > 0 && p[i-1] == 0 {
+		i--
+	}
+	if i > 0 {
+		zeros = 0
+	}
+
+	return min(zeros+len(p)-i, r.blockSize)
+}
+
+// zeroWindowFull reports whether the window is a full block of zeros, for a sparse computation, given the trailing
+// zero bytes read, and the size of the last read, which is the window if it's not rolling.
+func (r *rDiff) zeroWindowFull(zeros, n int, rolling bool) bool {
+	return r.sparse && zeros >= r.blockSize && (rolling || n == r.blockSize)
+}
+
+// zeroWindow emits the literal preceding the window, which is a block of zeros not matched in the target, as a new
+// block, then adds the window to the zero run of the emitter, so the zeros are not accumulated as literal data.
+// It returns the literal buffer to continue with, the next block being read after the window.
+func (r *rDiff) zeroWindow(emitter *deltaEmitter, literal []byte) ([]byte, error) {
+	err := emitter.literal(literal)
+	if err != nil {
+		return literal[:0], err
+	}
+
+	return literal[:0], emitter.addZeros(int64(r.blockSize))
+}
+
+// blockOffset returns the offset of the block index of a target of targetSize bytes, split in blocks of blockSize
+// bytes, and false if the index is out of the target, so a crafted index can't overflow the offset.
+func blockOffset(index int64, blockSize int, targetSize int64) (int64, bool) {
+	if index < 0 || blockSize <= 0 || index >= (targetSize+int64(blockSize)-1)/int64(blockSize) {
+		return 0, false
+	}
+
+	return index * int64(blockSize), true
+}
+
+// targetLayout locates the target bytes copied by the operations, in a target of size bytes: the blocks of blockSize
+// bytes, and the second pass blocks, of partSize bytes, see WithSecondPass.
+type targetLayout struct {
+	size      int64
+	blockSize int
+	partSize  int
+}
+
+// extent returns the offset and the length of the target bytes copied by op, and false if op doesn't copy any, or if
+// its block is out of the target.
+func (l targetLayout) extent(op Operation) (int64, int64, bool) {
+	size := l.blockSize
+	switch {
+	case op.Type == OpBlockPart:
+		size = l.partSize
+	case !op.Type.copiesBlock():
+		return 0, 0, false
+	}
+	off, ok := blockOffset(op.BlockIndex, size, l.size)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return off, min(int64(size), l.size-off), true
+}
+
+func createOperation(index int64, lit []byte) Operation {
 	opType := OpBlockKeep
 	if len(lit) > 0 {
 		opType = OpBlockUpdate
@@ -196,34 +539,222 @@ func createOperation(index int, lit []byte) Operation {
 	return op
 }
 
-func computeSearchList(blockList []Block) map[uint32][]blockData {
-	sl := make(map[uint32][]blockData, len(blockList))
-	for i, block := range blockList {
-		sl[block.WeakHash] = append(sl[block.WeakHash], blockData{strongHash: block.StrongHash, blockIndex: i})
+// flushLiteral emits the literal as new data, if it reached the literal chunk size, or spills it to a temporary file,
+// if it reached the memory budget, see WithMaxMemory, and returns the literal buffer to continue with.
+func (r *rDiff) flushLiteral(emitter *deltaEmitter, literal []byte) ([]byte, error) {
+	switch {
+	case r.literalChunkSize > 0 && len(literal) >= r.maxLiteral():
+		return literal[:0], emitter.literal(literal)
+	case r.maxMemory > 0 && len(literal) >= r.maxMemory:
+		return literal[:0], emitter.spillLiteral(literal)
+	default:
+		return literal, nil
+	}
+}
+
+// maxLiteral returns the max length of the literal data of a computed operation: the literal chunk size, if it's
+// configured, up to the decode limit, so the delta can be read back.
+func (r *rDiff) maxLiteral() int {
+	limit := r.limits.withDefaults().MaxLiteral
+	if r.literalChunkSize > 0 {
+		return min(r.literalChunkSize, limit)
 	}
 
-	return sl
+	return limit
 }
 
-func computeFinalDelta(target []Block, delta map[int]Operation) []Operation {
-	// len(target)+1 is used to cover the max possible size: all target blocks + 1 extra literal block(if any)
-	output := make([]Operation, 0, len(target)+1)
-	for i := range target {
-		op, ok := delta[i]
-		if !ok {
-			removed := Operation{
-				Type:       OpBlockRemove,
-				BlockIndex: i,
-			}
-			output = append(output, removed)
+// deltaEmitter emits the operations in their final order: a single operation for every target block, ascending,
+// followed by the leftovers literal, if any.
+type deltaEmitter struct {
+	emit func(Operation) error
+	// blocks is the number of target blocks
+	blocks int64
+	// next is the index of the next target block to emit
+	next int64
+	// zeros is the size of the zero run preceding the next operation, emitted as a single OpBlockZero
+	zeros int64
+	// offset is the number of source bytes read, and checkpoint receives it after every match, if not nil, as the
+	// source before it is fully emitted
+	offset     int64
+	checkpoint func(offset int64, next int64) error
+	// maxLiteral is the max length of the literal data of an operation, the longer literals being split
+	maxLiteral int
+	// minMatch is the min length of a run of consecutive matches, the shorter runs being held in run, and sent as
+	// literal data, see WithMinMatch
+	minMatch int
+	run      matchRun
+	// coalesce means the literal data is held in pending, and merged with the following literal data, instead of
+	// being emitted at its position, see WithCoalesceLiterals
+	coalesce bool
+	pending  []byte
+	// secondPass matches the literal data against the smaller blocks of the signature, nil if there is no second
+	// pass, see WithSecondPass
+	secondPass *secondPassMatcher
+	// maxMemory is the max size of the literal data kept in memory, the head of a longer literal run being held in
+	// spill, see WithMaxMemory
+	maxMemory int
+	spill     *literalSpill
+}
 
-			continue
+// match emits the operations of the target blocks up to blIdx, the skipped ones being removed, and blIdx
+// being preceded in the source by the literal data. The block holds the source bytes matching blIdx, they are
+// only used if the match is part of a run shorter than minMatch.
+func (d *deltaEmitter) match(blIdx int, literal, block []byte) error {
+	err := d.flushSpill()
+	if err != nil {
+		return err
+	}
+	held, err := d.holdMatch(blIdx, literal, block)
+	if err != nil || held {
+		return err
+	}
+	err = d.emitMatch(blIdx, literal)
+	if err != nil || d.checkpoint == nil {
+		return err
+	}
+
+	return d.checkpoint(d.offset, d.next)
+}
+
+// emitMatch emits the operations of the target blocks up to blIdx, preceded by the pending literal data, if any.
+// A block before the next one to emit is reused, so it's emitted as an OpBlockCopy, see WithBlockReuse.
+func (d *deltaEmitter) emitMatch(blIdx int, literal []byte) error {
+	reused := int64(blIdx) < d.next
+	err := d.remove(int64(blIdx))
+	if err != nil {
+		return err
+	}
+	if len(d.pending) > 0 {
+		d.pending = append(d.pending, literal...)
+		literal, d.pending = d.pending, d.pending[:0]
+	}
+	literal, err = d.refineLiteral(literal)
+	if err != nil {
+		return err
+	}
+	// the literal exceeding the limit precedes the block as new blocks
+	if split := len(literal) - d.maxLiteral; d.maxLiteral > 0 && split > 0 {
+		err = d.sendNew(literal[:split])
+		if err != nil {
+			return err
+		}
+		literal = literal[split:]
+	}
+	op := createOperation(int64(blIdx), literal)
+	if reused {
+		op.Type = OpBlockCopy
+	} else {
+		d.next = int64(blIdx) + 1
+	}
+
+	return d.send(op)
+}
+
+// finish emits the remaining target blocks as removed, and the leftovers literal as a new block, or the zero run.
+func (d *deltaEmitter) finish(literal []byte) error {
+	err := d.remove(d.blocks)
+	if err != nil {
+		return err
+	}
+	err = d.literal(literal)
+	if err != nil {
+		return err
+	}
+	err = d.flushPending()
+	if err != nil {
+		return err
+	}
+
+	return d.flushZeros()
+}
+
+// literal emits the literal, if any, at the current position, after the held run of matches, if any, or adds it to
+// the pending literal data, if the literals are coalesced.
+func (d *deltaEmitter) literal(literal []byte) error {
+	err := d.flushSpill()
+	if err == nil {
+		err = d.dropRun()
+	}
+	if err != nil {
+		return err
+	}
+
+	return d.addLiteral(literal)
+}
+
+// addZeros adds n zero bytes to the zero run, after the held run of matches, and the pending literal data, if any.
+func (d *deltaEmitter) addZeros(n int64) error {
+	err := d.dropRun()
+	if err == nil {
+		err = d.flushPending()
+	}
+	d.zeros += n
+
+	return err
+}
+
+// newBlocks emits the literal, if any, at the current position, as the second pass operations of the blocks found in
+// it, if any, and new blocks.
+func (d *deltaEmitter) newBlocks(literal []byte) error {
+	literal, err := d.refineLiteral(literal)
+	if err != nil {
+		return err
+	}
+
+	return d.sendNew(literal)
+}
+
+// sendNew emits the literal, if any, as new blocks, at the current position, each one of at most maxLiteral bytes.
+func (d *deltaEmitter) sendNew(literal []byte) error {
+	for len(literal) > 0 {
+		n := len(literal)
+		if d.maxLiteral > 0 {
+			n = min(n, d.maxLiteral)
+		}
+		op := Operation{
+			Type:       OpBlockNew,
+			BlockIndex: -1,
+		}
+		op.Data = append(op.Data, literal[:n]...)
+		err := d.send(op)
+		if err != nil {
+			return err
 		}
-		output = append(output, op)
+		literal = literal[n:]
 	}
-	if extra, ok := delta[-1]; ok {
-		output = append(output, extra)
+
+	return nil
+}
+
+// remove emits the target blocks from next up to end(exclusive) as removed.
+func (d *deltaEmitter) remove(end int64) error {
+	for ; d.next < end; d.next++ {
+		err := d.send(Operation{Type: OpBlockRemove, BlockIndex: d.next})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send emits the zero run, if any, followed by op.
+func (d *deltaEmitter) send(op Operation) error {
+	err := d.flushZeros()
+	if err != nil {
+		return err
+	}
+
+	return d.emit(op)
+}
+
+// flushZeros emits the zero run, if any.
+func (d *deltaEmitter) flushZeros() error {
+	if d.zeros == 0 {
+		return nil
 	}
+	op := Operation{Type: OpBlockZero, BlockIndex: -1, Zeros: d.zeros}
+	d.zeros = 0
 
-	return output
+	return d.emit(op)
 }
@@ -3,9 +3,17 @@ package rdiff
 import (
 	"bytes"
 	"crypto/md5"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
+	"testing/iotest"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/silviutanasa/rdiff/rollsum"
 )
 
 var rDiffE2ETests = []struct {
@@ -66,6 +74,34 @@ var rDiffE2ETests = []struct {
 			{Type: OpBlockKeep, BlockIndex: 3},
 		},
 	},
+	{
+		// the target blocks are matched in order, so the blocks moved before a matched block are literal data
+		in: inE2E{
+			blockSize: 2,
+			target:    []byte{1, 2, 3, 4, 5, 6, 7, 8},
+			source:    []byte{1, 2, 7, 8, 3, 4, 5, 6},
+		},
+		out: []Operation{
+			{Type: OpBlockKeep, BlockIndex: 0},
+			{Type: OpBlockRemove, BlockIndex: 1},
+			{Type: OpBlockRemove, BlockIndex: 2},
+			{Type: OpBlockKeep, BlockIndex: 3},
+			{Type: OpBlockNew, BlockIndex: -1, Data: []byte{3, 4, 5, 6}},
+		},
+	},
+	{
+		// identical target blocks are matched in order
+		in: inE2E{
+			blockSize: 2,
+			target:    []byte{1, 2, 1, 2, 1, 2},
+			source:    []byte{1, 2, 9, 1, 2},
+		},
+		out: []Operation{
+			{Type: OpBlockKeep, BlockIndex: 0},
+			{Type: OpBlockUpdate, BlockIndex: 1, Data: []byte{9}},
+			{Type: OpBlockRemove, BlockIndex: 2},
+		},
+	},
 	{
 		in: inE2E{
 			blockSize: 3,
@@ -97,6 +133,39 @@ var rDiffE2ETests = []struct {
 	},
 }
 
+type rDiffE2EConfig struct {
+	weakHash       WeakHashType
+	strongHash     StrongHashType
+	strongHashSize int
+}
+
+var rDiffE2EConfigs = []rDiffE2EConfig{
+	{weakHash: WeakHashAdler32},
+	{weakHash: WeakHashAdler32, strongHash: StrongHashSHA256},
+	{weakHash: WeakHashAdler32, strongHashSize: 4},
+	{weakHash: WeakHashRabin},
+	{weakHash: WeakHashRabin, strongHashSize: 4},
+	{weakHash: WeakHashBuzhash},
+	{weakHash: WeakHashBuzhash, strongHashSize: 4},
+	{weakHash: WeakHashAdler64},
+	{weakHash: WeakHashAdler64, strongHashSize: 4},
+	{weakHash: WeakHashCRC32C},
+	{weakHash: WeakHashCRC32C, strongHashSize: 4},
+	{weakHash: WeakHashLibrsync, strongHash: StrongHashMD4},
+	{weakHash: WeakHashRabinKarp, strongHash: StrongHashBLAKE2b},
+	{weakHash: WeakHashRabinKarp, strongHash: StrongHashBLAKE2b, strongHashSize: 8},
+}
+
+// newTestRDiff returns an engine configured with the given hashes, the same way the App options configure it.
+func newTestRDiff(blockSize int, cfg rDiffE2EConfig) *rDiff {
+	weakHasher, _ := newRollingHash(cfg.weakHash)
+	strongHasher, _ := newStrongHash(cfg.strongHash, nil)
+	r := newRDiff(blockSize, weakHasher, strongHasher)
+	r.weakHashType, r.strongHashType, r.strongHashSize = cfg.weakHash, cfg.strongHash, cfg.strongHashSize
+
+	return r
+}
+
 type inE2E struct {
 	blockSize int
 	target    []byte
@@ -120,25 +189,190 @@ type inE2E struct {
 // to 'be together', joke aside ComputeDelta has no purpose if the ComputeSignature is not previously called.
 // The approach also well covers both methods (ex: if the ComputeSignature has bugs, it will cause ComputeDelta
 // to return bad results also), so there is no downside, only upsides.
+// The whole suite runs for every weak hash, and for several strong hash configurations.
 func TestRDiffE2E(t *testing.T) {
+	for _, cfg := range rDiffE2EConfigs {
+		for _, tt := range rDiffE2ETests {
+			inp := tt.in
+			r := newTestRDiff(inp.blockSize, cfg)
+			sig, err := r.ComputeSignature(bytes.NewReader(inp.target))
+			var got []Operation
+			if err == nil {
+				got, err = r.ComputeDelta(bytes.NewReader(inp.source), r.signatureHeader(), sig)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("rDiff E2E(%+v) error = %v, wantErr %v", cfg, err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(got, tt.out); diff != "" {
+				t.Errorf("rDiff E2E(%+v) got = %v, want %v, \nDIFF: %v", cfg, got, tt.out, diff)
+			}
+		}
+	}
+}
+
+func TestRDiff_ComputeSignature_StrongHashSize(t *testing.T) {
+	for _, tt := range []struct {
+		in  int
+		out int
+	}{
+		{in: 0, out: md5.Size},
+		{in: 4, out: 4},
+		{in: md5.Size, out: md5.Size},
+		{in: md5.Size + 1, out: md5.Size},
+	} {
+		r := newRDiff(3, rollsum.NewAdler32(), md5.New())
+		r.strongHashSize = tt.in
+		sig, err := r.ComputeSignature(bytes.NewReader([]byte{1, 2, 3, 4, 5, 6, 7}))
+		if err != nil {
+			t.Fatalf("ComputeSignature() error = %v", err)
+		}
+		for _, bl := range sig.blocks(r.signatureHeader()) {
+			if len(bl.StrongHash) != tt.out {
+				t.Errorf("ComputeSignature() strong hash size = %v, want %v", len(bl.StrongHash), tt.out)
+			}
+		}
+		if got := r.signatureHeader().StrongHashSize; got != tt.out {
+			t.Errorf("signatureHeader().StrongHashSize = %v, want %v", got, tt.out)
+		}
+	}
+}
+
+func TestRDiff_ComputeDeltaFunc_EmitError(t *testing.T) {
+	r := newTestRDiff(2, rDiffE2EConfig{})
+	sig, err := r.ComputeSignature(bytes.NewReader([]byte{1, 2, 3, 4, 5, 6}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, concurrency := range []int{1, 2} {
+		r.concurrency = concurrency
+		wantErr := errors.New("emit error")
+		emitted := 0
+		err = r.ComputeDeltaFunc(bytes.NewReader([]byte{1, 2, 3, 4, 5, 6}), r.signatureHeader(), sig, func(Operation) error {
+			emitted++
+			return wantErr
+		})
+		if !errors.Is(err, wantErr) || emitted != 1 {
+			t.Errorf("ComputeDeltaFunc(concurrency: %v) error = %v, emitted %v, want %v after 1 operation", concurrency, err, emitted, wantErr)
+		}
+	}
+}
+
+// TestRDiff_ComputeDelta_ShortReads checks the delta doesn't depend on how the source returns its data.
+func TestRDiff_ComputeDelta_ShortReads(t *testing.T) {
+	for _, tt := range rDiffE2ETests {
+		for _, wrap := range []func(io.Reader) io.Reader{iotest.OneByteReader, iotest.HalfReader, iotest.DataErrReader} {
+			r := newTestRDiff(tt.in.blockSize, rDiffE2EConfig{})
+			sig, err := r.ComputeSignature(bytes.NewReader(tt.in.target))
+			if err != nil {
+				t.Fatalf("ComputeSignature() error = %v", err)
+			}
+			got, err := r.ComputeDelta(wrap(bytes.NewReader(tt.in.source)), r.signatureHeader(), sig)
+			if err != nil {
+				t.Fatalf("ComputeDelta() error = %v", err)
+			}
+			if diff := cmp.Diff(got, tt.out); diff != "" {
+				t.Errorf("ComputeDelta() got = %v, want %v, \nDIFF: %v", got, tt.out, diff)
+			}
+		}
+	}
+}
+
+// TestRDiff_ComputeSignature_ShortReads checks the signature doesn't depend on how the target returns its data.
+func TestRDiff_ComputeSignature_ShortReads(t *testing.T) {
 	for _, tt := range rDiffE2ETests {
-		inp := tt.in
-		r := rDiff{
-			blockSize:    inp.blockSize,
-			weakHasher:   newAdler32RollingHash(),
-			strongHasher: md5.New(),
+		r := newTestRDiff(tt.in.blockSize, rDiffE2EConfig{})
+		want, err := r.ComputeSignature(bytes.NewReader(tt.in.target))
+		if err != nil {
+			t.Fatalf("ComputeSignature() error = %v", err)
 		}
-		sig, err := r.ComputeSignature(bytes.NewReader(inp.target))
-		var got []Operation
-		if err == nil {
-			got, err = r.ComputeDelta(bytes.NewReader(inp.source), sig)
+		for _, wrap := range []func(io.Reader) io.Reader{iotest.OneByteReader, iotest.HalfReader, iotest.DataErrReader} {
+			got, err := r.ComputeSignature(wrap(bytes.NewReader(tt.in.target)))
+			if err != nil {
+				t.Fatalf("ComputeSignature() error = %v", err)
+			}
+			if diff := cmp.Diff(got, want); diff != "" {
+				t.Errorf("ComputeSignature() of short reads got = %v, want %v, \nDIFF: %v", got, want, diff)
+			}
 		}
-		if (err != nil) != tt.wantErr {
-			t.Errorf("rDiff E2E error = %v, wantErr %v", err, tt.wantErr)
-			return
+	}
+}
+
+func TestBlockOffset(t *testing.T) {
+	tests := []struct {
+		index      int64
+		blockSize  int
+		targetSize int64
+		want       int64
+		wantOK     bool
+	}{
+		{index: 0, blockSize: 4, targetSize: 10, want: 0, wantOK: true},
+		{index: 2, blockSize: 4, targetSize: 10, want: 8, wantOK: true},
+		{index: 3, blockSize: 4, targetSize: 10},
+		{index: -1, blockSize: 4, targetSize: 10},
+		{index: 1 << 40, blockSize: 1 << 10, targetSize: 1 << 51, want: 1 << 50, wantOK: true},
+		{index: math.MaxInt64, blockSize: MaxBlockSize, targetSize: math.MaxInt64 - MaxBlockSize},
+	}
+	for _, tt := range tests {
+		got, ok := blockOffset(tt.index, tt.blockSize, tt.targetSize)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("blockOffset(%+v) = %v, %v, want %v, %v", tt, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// BenchmarkRDiff_ComputeDelta_NoMatch measures the worst case of the delta computation, where the source
+// has nothing in common with the target, so the window rolls over every single source byte.
+func BenchmarkRDiff_ComputeDelta_NoMatch(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	target, source := make([]byte, 1<<20), make([]byte, 1<<20)
+	rnd.Read(target)
+	rnd.Read(source)
+	r := newRDiff(64, rollsum.NewAdler32(), md5.New())
+	sig, err := r.ComputeSignature(bytes.NewReader(target))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(source)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err = r.ComputeDelta(bytes.NewReader(source), r.signatureHeader(), sig)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRDiff_ComputeDelta_NoMatchFile is the same as BenchmarkRDiff_ComputeDelta_NoMatch, but the source
+// is a file, so it also measures the cost of the reads.
+func BenchmarkRDiff_ComputeDelta_NoMatchFile(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	target, source := make([]byte, 1<<20), make([]byte, 1<<20)
+	rnd.Read(target)
+	rnd.Read(source)
+	sourcePath := filepath.Join(b.TempDir(), "source")
+	err := os.WriteFile(sourcePath, source, 0666)
+	if err != nil {
+		b.Fatal(err)
+	}
+	r := newRDiff(64, rollsum.NewAdler32(), md5.New())
+	sig, err := r.ComputeSignature(bytes.NewReader(target))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(source)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f, err := os.Open(sourcePath)
+		if err != nil {
+			b.Fatal(err)
 		}
-		if diff := cmp.Diff(got, tt.out); diff != "" {
-			t.Errorf("rDiff E2E got = %v, want %v, \nDIFF: %v", got, tt.out, diff)
+		_, err = r.ComputeDelta(f, r.signatureHeader(), sig)
+		_ = f.Close()
+		if err != nil {
+			b.Fatal(err)
 		}
 	}
 }
@@ -0,0 +1,122 @@
+package rdiffdaemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+)
+
+// Client sends jobs to a server, over a connection it keeps open, one job at a time. It's safe for concurrent use,
+// the concurrent jobs waiting their turn: a client opening several connections runs several jobs at once.
+type Client struct {
+	// mu serializes the requests, as the responses are read in order
+	mu   sync.Mutex
+	conn net.Conn
+	dec  *json.Decoder
+}
+
+// Dial connects to the server listening on the Unix socket at path, and returns the Client sending it jobs.
+func Dial(ctx context.Context, path string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewClient(conn), nil
+}
+
+// NewClient returns the Client sending jobs to the server over conn, ex: a connection dialed by the caller, which is
+// closed by Client.Close.
+func NewClient(conn net.Conn) *Client {
+	return &Client{conn: conn, dec: json.NewDecoder(bufio.NewReader(conn))}
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Signature computes the signature of the target file to the signature file, see rdiff.App.Signature. The relative
+// paths are resolved against the working directory of the caller.
+func (c *Client) Signature(ctx context.Context, targetFilePath, signatureFilePath string) error {
+	_, err := c.Do(ctx, Request{Op: OpSignature, Args: []string{targetFilePath, signatureFilePath}})
+
+	return err
+}
+
+// Delta computes the delta of the source file against the signature file to the delta file, see rdiff.App.Delta.
+// The relative paths are resolved against the working directory of the caller.
+func (c *Client) Delta(ctx context.Context, signatureFilePath, sourceFilePath, deltaFilePath string) error {
+	_, err := c.Do(ctx, Request{Op: OpDelta, Args: []string{signatureFilePath, sourceFilePath, deltaFilePath}})
+
+	return err
+}
+
+// Patch applies the delta file to the target file, and writes the output file, see rdiff.App.Patch. The relative
+// paths are resolved against the working directory of the caller.
+func (c *Client) Patch(ctx context.Context, targetFilePath, deltaFilePath, outputFilePath string) error {
+	_, err := c.Do(ctx, Request{Op: OpPatch, Args: []string{targetFilePath, deltaFilePath, outputFilePath}})
+
+	return err
+}
+
+// Invalidate drops the signatures of the target file cached by the server, ex: after it's rewritten keeping its size
+// and modification time.
+func (c *Client) Invalidate(ctx context.Context, targetFilePath string) error {
+	_, err := c.Do(ctx, Request{Op: OpInvalidate, Args: []string{targetFilePath}})
+
+	return err
+}
+
+// Status returns the status of the server.
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	resp, err := c.Do(ctx, Request{Op: OpStatus})
+	if err != nil {
+		return Status{}, err
+	}
+	if resp.Status == nil {
+		return Status{}, fmt.Errorf("%w: the status response has no status", errProtocol)
+	}
+
+	return *resp.Status, nil
+}
+
+// Do sends the request, after making its paths absolute, and returns the response. A failure reported by the server
+// returns a non-nil *RemoteError. If ctx is done before the response is received, the connection is closed, as the
+// response of the abandoned job would be read by the next one, and ctx.Err() is returned.
+func (c *Client) Do(ctx context.Context, req Request) (Response, error) {
+	args := make([]string, len(req.Args))
+	for i, p := range req.Args {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return Response{}, err
+		}
+		args[i] = abs
+	}
+	req.Args = args
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop := context.AfterFunc(ctx, func() { c.conn.Close() })
+	defer stop()
+	var resp Response
+	err := json.NewEncoder(c.conn).Encode(req)
+	if err == nil {
+		err = c.dec.Decode(&resp)
+	}
+	if ctx.Err() != nil {
+		return Response{}, ctx.Err()
+	}
+	if err != nil {
+		return Response{}, err
+	}
+	if resp.Error != "" {
+		return Response{}, &RemoteError{Kind: resp.Kind, Message: resp.Error}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,100 @@
+package rdiffdaemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+func TestClient(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := bytes.Repeat([]byte("0123456789abcdef"), 256)
+	source := append(bytes.Clone(target[:2000]), []byte("a change")...)
+	source = append(source, target[2000:]...)
+	for name, data := range map[string][]byte{"target": target, "source": source} {
+		if err := os.WriteFile(path(name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	c, err := Dial(ctx, newTestServer(t, NewServer(64, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Signature(ctx, path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Delta(ctx, path("signature"), path("source"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Patch(ctx, path("target"), path("delta"), path("out")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path("out")); !bytes.Equal(got, source) {
+		t.Error("Patch() doesn't rebuild the source")
+	}
+	// the signature of the unchanged target is cached
+	if _, err := c.Do(ctx, Request{Op: OpSignature, Args: []string{path("target"), path("signature.json")}, Format: rdiff.FormatJSON}); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := c.Status(ctx); err != nil || st.CachedSignatures != 1 || st.MaxJobs != 2 {
+		t.Errorf("Status() = %+v, %v, want 1 cached signature, and 2 max jobs", st, err)
+	}
+	if err := c.Invalidate(ctx, path("target")); err != nil {
+		t.Fatal(err)
+	}
+	if st, err := c.Status(ctx); err != nil || st.CachedSignatures != 0 {
+		t.Errorf("Status() = %+v, %v, want no cached signature", st, err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	if err := os.WriteFile(path("target"), bytes.Repeat([]byte("0123456789abcdef"), 256), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("corrupt"), []byte("not a delta"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	c, err := Dial(ctx, newTestServer(t, NewServer(64, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	tests := []struct {
+		name string
+		fn   func() error
+		want error
+	}{
+		{name: "missing target", fn: func() error { return c.Signature(ctx, path("missing"), path("s1")) }, want: fs.ErrNotExist},
+		{name: "existing output", fn: func() error { return c.Signature(ctx, path("target"), path("corrupt")) }, want: fs.ErrExist},
+		{name: "corrupt delta", fn: func() error { return c.Patch(ctx, path("target"), path("corrupt"), path("o1")) }, want: rdiff.ErrCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fn()
+			var remote *RemoteError
+			if !errors.Is(err, tt.want) || !errors.As(err, &remote) {
+				t.Errorf("error = %v, want a remote error matching %v", err, tt.want)
+			}
+		})
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := c.Signature(canceled, path("target"), path("s2")); !errors.Is(err, context.Canceled) {
+		t.Errorf("Signature() with a canceled context error = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,80 @@
+package rdiffdaemon
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// errProtocol reports a malformed, or unexpected, request or response.
+var errProtocol = errors.New("rdiffdaemon: protocol error")
+
+// ErrorKind is the kind of a failure reported by a response.
+type ErrorKind string
+
+const (
+	// KindError reports a failure which has no specific kind
+	KindError ErrorKind = "error"
+	// KindInvalid reports an invalid request, ex: an unknown operation, or a relative path
+	KindInvalid ErrorKind = "invalid"
+	// KindNotFound reports a missing input file
+	KindNotFound ErrorKind = "not_found"
+	// KindExists reports an output file which already exists
+	KindExists ErrorKind = "exists"
+	// KindCorrupt reports a malformed signature or delta, see rdiff.ErrCorrupt
+	KindCorrupt ErrorKind = "corrupt"
+	// KindVerification reports an input which doesn't verify, see rdiff.ErrVerification
+	KindVerification ErrorKind = "verification"
+	// KindModified reports an input modified while it was read, see rdiff.ErrModified, so the job can be retried
+	KindModified ErrorKind = "modified"
+)
+
+// kindErrors are the errors matched by the kinds of the failures.
+var kindErrors = map[ErrorKind]error{
+	KindNotFound:     fs.ErrNotExist,
+	KindExists:       fs.ErrExist,
+	KindCorrupt:      rdiff.ErrCorrupt,
+	KindVerification: rdiff.ErrVerification,
+	KindModified:     rdiff.ErrModified,
+}
+
+// RemoteError is a failure reported by the server.
+// It matches the error of its kind, using errors.Is, ex: a KindNotFound error matches fs.ErrNotExist, and
+// a KindCorrupt one matches rdiff.ErrCorrupt.
+type RemoteError struct {
+	Kind    ErrorKind
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("rdiffdaemon: %v: %v", e.Kind, e.Message)
+}
+
+// Unwrap returns the error matched by the kind, if any.
+func (e *RemoteError) Unwrap() error {
+	return kindErrors[e.Kind]
+}
+
+// newErrorResponse returns the response reporting err to the client. The server is local, so the messages are
+// reported as they are, including the paths.
+func newErrorResponse(err error) Response {
+	kind := KindError
+	switch {
+	case errors.Is(err, errProtocol):
+		kind = KindInvalid
+	case errors.Is(err, rdiff.ErrModified):
+		kind = KindModified
+	case errors.Is(err, fs.ErrNotExist):
+		kind = KindNotFound
+	case errors.Is(err, fs.ErrExist):
+		kind = KindExists
+	case errors.Is(err, rdiff.ErrCorrupt):
+		kind = KindCorrupt
+	case errors.Is(err, rdiff.ErrVerification):
+		kind = KindVerification
+	}
+
+	return Response{Error: err.Error(), Kind: kind}
+}
@@ -0,0 +1,229 @@
+// Package rdiffdaemon provides a long-running rdiff server, and its client, for the local processes: they send
+// the signature, delta and patch jobs of their files over a Unix socket, instead of running a rdiff process per call,
+// and the server keeps the signatures of the unchanged targets in memory, see rdiff.SignatureCache:
+//
+//	l, err := net.Listen("unix", "/run/rdiff.sock")
+//	err = rdiffdaemon.NewServer(rdiff.DefaultBlockSize, 4).Serve(l)
+//
+//	c, err := rdiffdaemon.Dial(ctx, "/run/rdiff.sock")
+//	err = c.Signature(ctx, "basis", "basis.sig")
+//
+// A connection carries any number of requests, one at a time: every request is a JSON object, and it's answered by
+// a JSON object, on a line of its own, see Request and Response. The files are named by absolute paths, as the server
+// and the clients don't share the working directory, and they're opened by the server, so it must be allowed to read
+// and write them. The server runs up to the configured number of jobs at once, the other ones waiting their turn.
+package rdiffdaemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync/atomic"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// DefaultCacheSize is the size, in bytes, of the hashes held by the signature cache of a new Server.
+const DefaultCacheSize = 256 << 20
+
+// The operations of the requests.
+const (
+	// OpSignature computes the signature of Args[0], the target, to Args[1]
+	OpSignature = "signature"
+	// OpDelta computes the delta of Args[1], the source, against the signature Args[0], to Args[2]
+	OpDelta = "delta"
+	// OpPatch applies the delta Args[1] to Args[0], the target, and writes the output to Args[2]
+	OpPatch = "patch"
+	// OpInvalidate drops the cached signatures of Args[0], see rdiff.SignatureCache.Invalidate
+	OpInvalidate = "invalidate"
+	// OpStatus returns the status of the server, see Status
+	OpStatus = "status"
+)
+
+// opArgs is the number of file arguments of every operation.
+var opArgs = map[string]int{OpSignature: 2, OpDelta: 3, OpPatch: 3, OpInvalidate: 1, OpStatus: 0}
+
+// Request is a job sent to the server.
+type Request struct {
+	Op string `json:"op"`
+	// Args are the absolute paths of the files of the operation, the output being the last one
+	Args []string `json:"args,omitempty"`
+	// BlockSize is the block size of the job, the server's one if <= 0, it must be the same for all the jobs run on
+	// the same target
+	BlockSize int `json:"block_size,omitempty"`
+	// Format is the format of the files written, and read, gob by default, see rdiff.WithFormat
+	Format rdiff.Format `json:"format,omitempty"`
+}
+
+// Response is the answer to a request: a failure, if Error is not empty, or the result of the operation.
+type Response struct {
+	Error string `json:"error,omitempty"`
+	// Kind is the kind of the failure, see RemoteError
+	Kind   ErrorKind `json:"kind,omitempty"`
+	Status *Status   `json:"status,omitempty"`
+}
+
+// Status is the status of a server, returned by OpStatus.
+type Status struct {
+	// Jobs is the number of jobs running, and MaxJobs the number of jobs which can run at once
+	Jobs    int `json:"jobs"`
+	MaxJobs int `json:"max_jobs"`
+	// CachedSignatures is the number of signatures held by the cache
+	CachedSignatures int `json:"cached_signatures"`
+}
+
+// Server runs the jobs sent by the clients.
+type Server struct {
+	// Cache holds the signatures computed by the jobs, NewServer sets one of DefaultCacheSize bytes, nil means the
+	// signatures are not cached. It must be set before the Server serves its first connection.
+	Cache *rdiff.SignatureCache
+
+	blockSize int
+	opts      []rdiff.Option
+	// slots limits the number of jobs running at once, and running counts them
+	slots   chan struct{}
+	running atomic.Int64
+}
+
+// NewServer constructs a Server, and returns a pointer to it.
+// The blockSize is the block size of the jobs, unless the request sets one, and maxJobs is the number of jobs running at once, <= 0 meaning runtime.GOMAXPROCS(0). The opts
+// configure the rdiff.App running every job, ex: the hashes.
+func NewServer(blockSize int, maxJobs int, opts ...rdiff.Option) *Server {
+	if maxJobs <= 0 {
+		maxJobs = runtime.GOMAXPROCS(0)
+	}
+
+	return &Server{
+		Cache:     rdiff.NewSignatureCache(DefaultCacheSize),
+		blockSize: blockSize,
+		opts:      opts,
+		slots:     make(chan struct{}, maxJobs),
+	}
+}
+
+// Serve accepts the connections on the listener, serving every one on its own goroutine, until the listener fails,
+// ex: it's closed, and it returns its error.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn answers the requests of a connection, until the client closes it, then closes it. It returns a non-nil
+// error if the connection fails, or if it carries a malformed request, which is answered before closing it, while
+// the failed jobs are only reported to the client.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+	dec := json.NewDecoder(bufio.NewReader(conn))
+	enc := json.NewEncoder(conn)
+	for {
+		var req Request
+		err := dec.Decode(&req)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			err = fmt.Errorf("%w: %w", errProtocol, err)
+			_ = enc.Encode(newErrorResponse(err))
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		err = enc.Encode(s.do(req))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// do runs the job, and returns its response.
+func (s *Server) do(req Request) Response {
+	err := checkRequest(req)
+	if err != nil {
+		return newErrorResponse(err)
+	}
+	switch req.Op {
+	case OpInvalidate:
+		if s.Cache != nil {
+			s.Cache.Invalidate(req.Args[0])
+		}
+		return Response{}
+	case OpStatus:
+		return Response{Status: s.status()}
+	}
+	s.slots <- struct{}{}
+	s.running.Add(1)
+	defer func() {
+		s.running.Add(-1)
+		<-s.slots
+	}()
+	err = s.run(req)
+	if err != nil {
+		return newErrorResponse(err)
+	}
+
+	return Response{}
+}
+
+// checkRequest returns a non-nil error if the operation is unknown, or if it doesn't have its number of absolute
+// paths.
+func checkRequest(req Request) error {
+	n, ok := opArgs[req.Op]
+	if !ok {
+		return fmt.Errorf("%w: unknown operation: %q", errProtocol, req.Op)
+	}
+	if len(req.Args) != n {
+		return fmt.Errorf("%w: the %v operation expects %v files, got %v", errProtocol, req.Op, n, len(req.Args))
+	}
+	for _, p := range req.Args {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("%w: the path is not absolute: %q", errProtocol, p)
+		}
+	}
+
+	return nil
+}
+
+// run runs the signature, delta or patch job, using a new rdiff.App.
+func (s *Server) run(req Request) error {
+	blockSize := req.BlockSize
+	if blockSize <= 0 {
+		blockSize = s.blockSize
+	}
+	opts := append(slices.Clip(s.opts), rdiff.WithFormat(req.Format))
+	if s.Cache != nil {
+		opts = append(opts, rdiff.WithSignatureCache(s.Cache))
+	}
+	app := rdiff.New(blockSize, opts...)
+	switch req.Op {
+	case OpSignature:
+		return app.Signature(req.Args[0], req.Args[1])
+	case OpDelta:
+		return app.Delta(req.Args[0], req.Args[1], req.Args[2])
+	default:
+		return app.Patch(req.Args[0], req.Args[1], req.Args[2])
+	}
+}
+
+// status returns the status of the server.
+func (s *Server) status() *Status {
+	st := &Status{Jobs: int(s.running.Load()), MaxJobs: cap(s.slots)}
+	if s.Cache != nil {
+		st.CachedSignatures = s.Cache.Len()
+	}
+
+	return st
+}
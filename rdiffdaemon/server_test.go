@@ -0,0 +1,116 @@
+package rdiffdaemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestServer serves the jobs on a new Unix socket, using the server, and returns the socket path.
+func newTestServer(t *testing.T, s *Server) string {
+	t.Helper()
+	// the socket paths are limited to about 100 bytes, which t.TempDir may exceed
+	dir, err := os.MkdirTemp("", "rdiffd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	return path
+}
+
+func TestServer_ServeConn(t *testing.T) {
+	path := newTestServer(t, NewServer(4, 1))
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	tests := []struct {
+		name    string
+		request string
+		want    ErrorKind
+	}{
+		{name: "status", request: `{"op":"status"}`},
+		{name: "unknown operation", request: `{"op":"rm","args":["/a"]}`, want: KindInvalid},
+		{name: "relative path", request: `{"op":"invalidate","args":["a"]}`, want: KindInvalid},
+		{name: "missing args", request: `{"op":"signature","args":["/a"]}`, want: KindInvalid},
+		{name: "missing target", request: `{"op":"signature","args":["/missing/a","/missing/b"]}`, want: KindNotFound},
+		{name: "malformed", request: `{"op":}`, want: KindInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := conn.Write([]byte(tt.request + "\n")); err != nil {
+				t.Fatal(err)
+			}
+			line, err := r.ReadBytes('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			var resp Response
+			if err := json.Unmarshal(line, &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Kind != tt.want {
+				t.Errorf("response = %+v, want the kind %q", resp, tt.want)
+			}
+		})
+	}
+	// the connection is closed after a malformed request
+	if _, err := r.ReadByte(); err == nil {
+		t.Error("the connection is open after a malformed request")
+	}
+}
+
+func TestServer_MaxJobs(t *testing.T) {
+	s := NewServer(4, 2)
+	s.Cache = nil
+	path := newTestServer(t, s)
+	c, err := Dial(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// the slots are taken, as if 2 jobs were running
+	s.slots <- struct{}{}
+	s.slots <- struct{}{}
+	s.running.Add(2)
+	st, err := c.Status(context.Background())
+	if err != nil || st != (Status{Jobs: 2, MaxJobs: 2}) {
+		t.Fatalf("Status() = %+v, %v, want 2 jobs, out of 2", st, err)
+	}
+	done := make(chan error)
+	go func() {
+		other, err := Dial(context.Background(), path)
+		if err == nil {
+			defer other.Close()
+			err = other.Signature(context.Background(), "/missing/target", "/missing/signature")
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("the job ran while the slots are taken, error = %v", err)
+	default:
+	}
+	<-s.slots
+	s.running.Add(-1)
+	if err := <-done; !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "/missing/target") {
+		t.Errorf("Signature() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
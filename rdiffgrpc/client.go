@@ -0,0 +1,173 @@
+package rdiffgrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/internal/syncfile"
+	"github.com/silviutanasa/rdiff/rdiffgrpc/rdiffpb"
+)
+
+// Client syncs files with a Sync service, served by a Server.
+type Client struct {
+	// Sync sends the calls
+	Sync rdiffpb.SyncClient
+	// BlockSize is the block size of the local signatures, if <= 0 it's rdiff.DefaultBlockSize, reduced for the local
+	// files smaller than 2 blocks
+	BlockSize int
+	// Options configure the rdiff.App computing the local signatures and deltas, and applying the deltas,
+	// ex: the hashes
+	Options []rdiff.Option
+	// Limiter limits the bandwidth of the streamed data, both ways, every byte consuming a token, nil means unlimited
+	Limiter *rate.Limiter
+}
+
+// NewClient constructs a Client sending the calls on the connection, and returns a pointer to it.
+func NewClient(cc grpc.ClientConnInterface, opts ...rdiff.Option) *Client {
+	return &Client{Sync: rdiffpb.NewSyncClient(cc), Options: opts}
+}
+
+// Pull updates the local file(localPath) to match the remote one(remotePath): it streams the signature of the local
+// file, receives the delta of the remote file against it, and applies it, so only the parts of the remote file which
+// differ are transferred. The local file is replaced atomically, keeping its permissions.
+// The local file must exist, and be non-empty, otherwise a non-nil error is returned, as it is for a failed call,
+// see Server.
+func (c *Client) Pull(ctx context.Context, remotePath, localPath string) error {
+	f, size, err := syncfile.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stream, err := c.Sync.ComputeDelta(ctx)
+	if err != nil {
+		return err
+	}
+	blockSize := c.blockSize(size)
+	err = stream.Send(&rdiffpb.ComputeDeltaRequest{Path: remotePath, BlockSize: int32(blockSize)})
+	if err != nil {
+		return err
+	}
+	// the signature is streamed while the delta is received, a failure cancels the call, with its cause
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := c.sendSignature(stream, rdiff.New(blockSize, c.Options...), f, size)
+		if err != nil {
+			cancel(err)
+		}
+	}()
+	delta := newChunkReader(stream.Context(), c.Limiter, nil, func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		return chunk.GetData(), err
+	})
+	err = syncfile.Apply(localPath, delta, rdiff.New(blockSize, c.Options...))
+	cancel(nil)
+	<-done
+	if err != nil {
+		if cause := context.Cause(ctx); !errors.Is(cause, context.Canceled) {
+			return cause
+		}
+		return fmt.Errorf("applying the delta of %v: %w", remotePath, err)
+	}
+
+	return nil
+}
+
+// sendSignature streams the signature of the local file, then closes the sending side of the stream.
+// A stream ended by the server is not an error, as the receiving side reports it.
+func (c *Client) sendSignature(stream rdiffpb.Sync_ComputeDeltaClient, app *rdiff.App, f io.ReaderAt, size int64) error {
+	w := newChunkWriter(stream.Context(), c.Limiter, func(data []byte) error {
+		return stream.Send(&rdiffpb.ComputeDeltaRequest{Data: data})
+	})
+	err := app.SignatureAt(f, size, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
+
+// Push updates the remote file(remotePath) to match the local one(localPath): it receives the signature of the remote
+// file, and streams the delta of the local file against it, which the server applies, so only the parts of the local
+// file which differ are transferred. The remote file is replaced atomically, keeping its permissions.
+// It returns the size of the rebuilt remote file, or a non-nil error if the local file doesn't exist, or for a failed
+// call, see Server.
+func (c *Client) Push(ctx context.Context, localPath, remotePath string) (int64, error) {
+	f, size, err := syncfile.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	signature, blockSize, err := c.remoteSignature(ctx, remotePath)
+	if err != nil {
+		return 0, err
+	}
+	deltaStream, err := c.Sync.ApplyDelta(ctx)
+	if err != nil {
+		return 0, err
+	}
+	err = deltaStream.Send(&rdiffpb.ApplyDeltaRequest{Path: remotePath})
+	if err != nil {
+		return 0, err
+	}
+	w := newChunkWriter(deltaStream.Context(), c.Limiter, func(data []byte) error {
+		return deltaStream.Send(&rdiffpb.ApplyDeltaRequest{Data: data})
+	})
+	err = rdiff.New(blockSize, c.Options...).DeltaStream(signature, f, size, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	// a stream ended by the server is reported by CloseAndRecv
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	resp, err := deltaStream.CloseAndRecv()
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.GetSize(), nil
+}
+
+// remoteSignature returns the reader of the signature of the remote file, streamed by the server, and its block size.
+func (c *Client) remoteSignature(ctx context.Context, remotePath string) (io.Reader, int, error) {
+	stream, err := c.Sync.GetSignature(ctx, &rdiffpb.GetSignatureRequest{Path: remotePath})
+	if err != nil {
+		return nil, 0, err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return nil, 0, err
+	}
+	signature := newChunkReader(stream.Context(), c.Limiter, first.GetData(), func() ([]byte, error) {
+		chunk, err := stream.Recv()
+		return chunk.GetData(), err
+	})
+
+	return signature, int(first.GetBlockSize()), nil
+}
+
+// blockSize returns the block size of the signature of a local file of the given size.
+func (c *Client) blockSize(size int64) int {
+	if c.BlockSize > 0 {
+		return c.BlockSize
+	}
+
+	return int(max(min(rdiff.DefaultBlockSize, size/2), 1))
+}
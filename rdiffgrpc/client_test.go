@@ -0,0 +1,157 @@
+package rdiffgrpc
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// localFile writes a local file, and returns its path.
+func localFile(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "local")
+	if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestClient_Pull(t *testing.T) {
+	remote := strings.Repeat("the remote content, which is newer than the local one, ", 2000)
+	sync, _ := newTestClient(t, map[string]string{"dir/file": remote})
+	local := localFile(t, "the local content, which is older")
+	c := &Client{Sync: sync}
+	if err := c.Pull(context.Background(), "dir/file", local); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != remote {
+		t.Errorf("the local content after Pull() has %v bytes, want %v", len(got), len(remote))
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the local file mode after Pull() = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	// the client block size is used by the server
+	c = &Client{Sync: sync, BlockSize: 3, Options: []rdiff.Option{rdiff.WithStrongHash(rdiff.StrongHashSHA256)}}
+	local = localFile(t, "the local content")
+	if err := c.Pull(context.Background(), "dir/file", local); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != remote {
+		t.Errorf("the local content after Pull() has %v bytes, want %v", len(got), len(remote))
+	}
+}
+
+func TestClient_Push(t *testing.T) {
+	sync, root := newTestClient(t, map[string]string{"dir/file": "the remote content, which is older"})
+	local := strings.Repeat("the local content, which is newer than the remote one, ", 2000)
+	c := &Client{Sync: sync}
+	size, err := c.Push(context.Background(), localFile(t, local), "dir/file")
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if size != int64(len(local)) {
+		t.Errorf("Push() size = %v, want %v", size, len(local))
+	}
+	got, err := os.ReadFile(filepath.Join(root, "dir", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != local {
+		t.Errorf("the remote content after Push() has %v bytes, want %v", len(got), len(local))
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	sync, _ := newTestClient(t, map[string]string{"file": "the remote content"})
+	pinned, _ := newTestClient(t, map[string]string{"file": "the remote content"}, rdiff.WithWeakHash(rdiff.WeakHashRabin))
+	for _, tt := range []struct {
+		name string
+		call func() error
+		code codes.Code
+		kind error
+	}{
+		{name: "pull missing remote", call: func() error {
+			return (&Client{Sync: sync}).Pull(context.Background(), "missing", localFile(t, "local"))
+		}, code: codes.NotFound},
+		{name: "pull other weak hash", call: func() error {
+			return (&Client{Sync: pinned}).Pull(context.Background(), "file", localFile(t, "local"))
+		}, code: codes.FailedPrecondition},
+		{name: "pull missing local", call: func() error {
+			return (&Client{Sync: sync}).Pull(context.Background(), "file", filepath.Join(t.TempDir(), "missing"))
+		}, code: codes.Unknown, kind: os.ErrNotExist},
+		{name: "pull empty local", call: func() error {
+			return (&Client{Sync: sync}).Pull(context.Background(), "file", localFile(t, ""))
+		}, code: codes.Unknown},
+		{name: "push missing remote", call: func() error {
+			_, err := (&Client{Sync: sync}).Push(context.Background(), localFile(t, "local"), "missing")
+			return err
+		}, code: codes.NotFound},
+		{name: "push other weak hash", call: func() error {
+			_, err := (&Client{Sync: pinned, Options: []rdiff.Option{rdiff.WithWeakHash(rdiff.WeakHashAdler32)}}).
+				Push(context.Background(), localFile(t, "local"), "file")
+			return err
+		}, code: codes.Unknown, kind: rdiff.ErrVerification},
+	} {
+		err := tt.call()
+		if err == nil {
+			t.Errorf("%v: error = nil, want non-nil", tt.name)
+			continue
+		}
+		if status.Code(err) != tt.code {
+			t.Errorf("%v: error = %v, want the %v code", tt.name, err, tt.code)
+		}
+		if tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Errorf("%v: error = %v, want %v", tt.name, err, tt.kind)
+		}
+	}
+}
+
+func TestClient_Limiter(t *testing.T) {
+	root := t.TempDir()
+	remote := strings.Repeat("the remote content, which is newer than the local one, ", 2000)
+	if err := os.WriteFile(filepath.Join(root, "file"), []byte(remote), 0640); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(root, testBlockSize)
+	s.Limiter = rate.NewLimiter(10<<20, 512)
+	sync := dialTestServer(t, s)
+
+	// the bursts are smaller than the messages
+	c := &Client{Sync: sync, Limiter: rate.NewLimiter(10<<20, 512)}
+	local := localFile(t, "the local content, which is older")
+	if err := c.Pull(context.Background(), "file", local); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != remote {
+		t.Errorf("the local content after Pull() has %v bytes, want %v", len(got), len(remote))
+	}
+	pushed := remote + "pushed"
+	if err := os.WriteFile(local, []byte(pushed), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Push(context.Background(), local, "file"); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "file")); string(got) != pushed {
+		t.Errorf("the remote content after Push() has %v bytes, want %v", len(got), len(pushed))
+	}
+}
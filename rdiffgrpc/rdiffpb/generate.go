@@ -0,0 +1,5 @@
+// Package rdiffpb holds the protocol buffers messages, and the gRPC client and server, of the rdiffgrpc Sync service,
+// generated from sync.proto, using buf, protoc-gen-go and protoc-gen-go-grpc.
+package rdiffpb
+
+//go:generate buf generate
@@ -0,0 +1,301 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: sync.proto
+
+package rdiffpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	Sync_GetSignature_FullMethodName = "/rdiff.v1.Sync/GetSignature"
+	Sync_ComputeDelta_FullMethodName = "/rdiff.v1.Sync/ComputeDelta"
+	Sync_ApplyDelta_FullMethodName   = "/rdiff.v1.Sync/ApplyDelta"
+)
+
+// SyncClient is the client API for Sync service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Sync serves the signatures of the files under a root directory, computes their deltas against the signatures
+// streamed by the clients, and applies the deltas streamed to them, so the files are synced between services
+// by transferring only their differences. The files are identified by their path, relative to the root, using
+// forward slashes.
+type SyncClient interface {
+	// GetSignature streams the signature of a file, as written by rdiff.App.SignatureAt, the first chunk holding
+	// its block size.
+	GetSignature(ctx context.Context, in *GetSignatureRequest, opts ...grpc.CallOption) (Sync_GetSignatureClient, error)
+	// ComputeDelta receives the signature of the client's version of a file, the first message holding the path and
+	// the block size, and streams the delta of the file against it, as written by rdiff.App.DeltaStream.
+	ComputeDelta(ctx context.Context, opts ...grpc.CallOption) (Sync_ComputeDeltaClient, error)
+	// ApplyDelta receives a delta, the first message holding the path, and applies it to the file, which is replaced
+	// by the rebuilt source, atomically.
+	ApplyDelta(ctx context.Context, opts ...grpc.CallOption) (Sync_ApplyDeltaClient, error)
+}
+
+type syncClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSyncClient(cc grpc.ClientConnInterface) SyncClient {
+	return &syncClient{cc}
+}
+
+func (c *syncClient) GetSignature(ctx context.Context, in *GetSignatureRequest, opts ...grpc.CallOption) (Sync_GetSignatureClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Sync_ServiceDesc.Streams[0], Sync_GetSignature_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &syncGetSignatureClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Sync_GetSignatureClient interface {
+	Recv() (*Chunk, error)
+	grpc.ClientStream
+}
+
+type syncGetSignatureClient struct {
+	grpc.ClientStream
+}
+
+func (x *syncGetSignatureClient) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *syncClient) ComputeDelta(ctx context.Context, opts ...grpc.CallOption) (Sync_ComputeDeltaClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Sync_ServiceDesc.Streams[1], Sync_ComputeDelta_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &syncComputeDeltaClient{ClientStream: stream}
+	return x, nil
+}
+
+type Sync_ComputeDeltaClient interface {
+	Send(*ComputeDeltaRequest) error
+	Recv() (*Chunk, error)
+	grpc.ClientStream
+}
+
+type syncComputeDeltaClient struct {
+	grpc.ClientStream
+}
+
+func (x *syncComputeDeltaClient) Send(m *ComputeDeltaRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *syncComputeDeltaClient) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *syncClient) ApplyDelta(ctx context.Context, opts ...grpc.CallOption) (Sync_ApplyDeltaClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Sync_ServiceDesc.Streams[2], Sync_ApplyDelta_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &syncApplyDeltaClient{ClientStream: stream}
+	return x, nil
+}
+
+type Sync_ApplyDeltaClient interface {
+	Send(*ApplyDeltaRequest) error
+	CloseAndRecv() (*ApplyDeltaResponse, error)
+	grpc.ClientStream
+}
+
+type syncApplyDeltaClient struct {
+	grpc.ClientStream
+}
+
+func (x *syncApplyDeltaClient) Send(m *ApplyDeltaRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *syncApplyDeltaClient) CloseAndRecv() (*ApplyDeltaResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ApplyDeltaResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SyncServer is the server API for Sync service.
+// All implementations must embed UnimplementedSyncServer
+// for forward compatibility
+//
+// Sync serves the signatures of the files under a root directory, computes their deltas against the signatures
+// streamed by the clients, and applies the deltas streamed to them, so the files are synced between services
+// by transferring only their differences. The files are identified by their path, relative to the root, using
+// forward slashes.
+type SyncServer interface {
+	// GetSignature streams the signature of a file, as written by rdiff.App.SignatureAt, the first chunk holding
+	// its block size.
+	GetSignature(*GetSignatureRequest, Sync_GetSignatureServer) error
+	// ComputeDelta receives the signature of the client's version of a file, the first message holding the path and
+	// the block size, and streams the delta of the file against it, as written by rdiff.App.DeltaStream.
+	ComputeDelta(Sync_ComputeDeltaServer) error
+	// ApplyDelta receives a delta, the first message holding the path, and applies it to the file, which is replaced
+	// by the rebuilt source, atomically.
+	ApplyDelta(Sync_ApplyDeltaServer) error
+	mustEmbedUnimplementedSyncServer()
+}
+
+// UnimplementedSyncServer must be embedded to have forward compatible implementations.
+type UnimplementedSyncServer struct {
+}
+
+func (UnimplementedSyncServer) GetSignature(*GetSignatureRequest, Sync_GetSignatureServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetSignature not implemented")
+}
+func (UnimplementedSyncServer) ComputeDelta(Sync_ComputeDeltaServer) error {
+	return status.Errorf(codes.Unimplemented, "method ComputeDelta not implemented")
+}
+func (UnimplementedSyncServer) ApplyDelta(Sync_ApplyDeltaServer) error {
+	return status.Errorf(codes.Unimplemented, "method ApplyDelta not implemented")
+}
+func (UnimplementedSyncServer) mustEmbedUnimplementedSyncServer() {}
+
+// UnsafeSyncServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SyncServer will
+// result in compilation errors.
+type UnsafeSyncServer interface {
+	mustEmbedUnimplementedSyncServer()
+}
+
+func RegisterSyncServer(s grpc.ServiceRegistrar, srv SyncServer) {
+	s.RegisterService(&Sync_ServiceDesc, srv)
+}
+
+func _Sync_GetSignature_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetSignatureRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SyncServer).GetSignature(m, &syncGetSignatureServer{ServerStream: stream})
+}
+
+type Sync_GetSignatureServer interface {
+	Send(*Chunk) error
+	grpc.ServerStream
+}
+
+type syncGetSignatureServer struct {
+	grpc.ServerStream
+}
+
+func (x *syncGetSignatureServer) Send(m *Chunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Sync_ComputeDelta_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SyncServer).ComputeDelta(&syncComputeDeltaServer{ServerStream: stream})
+}
+
+type Sync_ComputeDeltaServer interface {
+	Send(*Chunk) error
+	Recv() (*ComputeDeltaRequest, error)
+	grpc.ServerStream
+}
+
+type syncComputeDeltaServer struct {
+	grpc.ServerStream
+}
+
+func (x *syncComputeDeltaServer) Send(m *Chunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *syncComputeDeltaServer) Recv() (*ComputeDeltaRequest, error) {
+	m := new(ComputeDeltaRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Sync_ApplyDelta_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SyncServer).ApplyDelta(&syncApplyDeltaServer{ServerStream: stream})
+}
+
+type Sync_ApplyDeltaServer interface {
+	SendAndClose(*ApplyDeltaResponse) error
+	Recv() (*ApplyDeltaRequest, error)
+	grpc.ServerStream
+}
+
+type syncApplyDeltaServer struct {
+	grpc.ServerStream
+}
+
+func (x *syncApplyDeltaServer) SendAndClose(m *ApplyDeltaResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *syncApplyDeltaServer) Recv() (*ApplyDeltaRequest, error) {
+	m := new(ApplyDeltaRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Sync_ServiceDesc is the grpc.ServiceDesc for Sync service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Sync_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "rdiff.v1.Sync",
+	HandlerType: (*SyncServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetSignature",
+			Handler:       _Sync_GetSignature_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ComputeDelta",
+			Handler:       _Sync_ComputeDelta_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ApplyDelta",
+			Handler:       _Sync_ApplyDelta_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "sync.proto",
+}
@@ -0,0 +1,189 @@
+// Package rdiffgrpc provides a gRPC Sync service, see the rdiffpb package, serving the signatures of the files under
+// a root directory, computing their deltas against the signatures streamed by the clients, and applying the deltas
+// streamed to them, so the files are synced between services by transferring only their differences:
+//
+//	s := grpc.NewServer()
+//	rdiffpb.RegisterSyncServer(s, rdiffgrpc.NewServer("/srv/files", 4096))
+//
+// A client pulls a file using Client.Pull, which streams the signature of its own version, and applies the delta
+// received, and pushes a file using Client.Push, which streams the delta of its own version against the signature
+// received.
+package rdiffgrpc
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/internal/syncfile"
+	"github.com/silviutanasa/rdiff/rdiffgrpc/rdiffpb"
+)
+
+// errInvalidArgument is matched by the errors caused by an invalid request, which are reported with their message.
+var errInvalidArgument = errors.New("invalid argument")
+
+// Server implements the rdiffpb.SyncServer for the files under its root directory.
+// The requested path, relative to the root, identifies the file, it can't escape the root, while the symbolic links
+// under the root are followed.
+// The errors are reported using the status code: NotFound for a missing file, InvalidArgument for an invalid path,
+// or a corrupt input, FailedPrecondition for an input which doesn't verify(see rdiff.ErrVerification), and Internal
+// for the other errors.
+type Server struct {
+	rdiffpb.UnimplementedSyncServer
+	// Limiter limits the bandwidth of the streamed data, both ways, every byte consuming a token, so all the calls
+	// share it, nil means unlimited. It must be set before the Server serves its first call.
+	Limiter *rate.Limiter
+
+	root      string
+	blockSize int
+	opts      []rdiff.Option
+	// mu serializes the deltas applications, so concurrent uploads don't replace a file with each other's outputs
+	mu sync.Mutex
+}
+
+// NewServer constructs a Server for the files under root, and returns a pointer to it.
+// The blockSize must be the block size of the signatures it serves, > 0, and the opts configure the rdiff.App
+// handling every call, ex: the hashes.
+func NewServer(root string, blockSize int, opts ...rdiff.Option) *Server {
+	return &Server{root: root, blockSize: blockSize, opts: opts}
+}
+
+// GetSignature implements rdiffpb.SyncServer.
+func (s *Server) GetSignature(req *rdiffpb.GetSignatureRequest, stream rdiffpb.Sync_GetSignatureServer) error {
+	return statusError(s.signature(req.GetPath(), stream))
+}
+
+// signature streams the signature of the file at the requested path, after a chunk holding its block size.
+func (s *Server) signature(requested string, stream rdiffpb.Sync_GetSignatureServer) error {
+	f, size, err := s.open(requested)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = stream.Send(&rdiffpb.Chunk{BlockSize: int32(s.blockSize)})
+	if err != nil {
+		return err
+	}
+	w := newChunkWriter(stream.Context(), s.Limiter, func(data []byte) error {
+		return stream.Send(&rdiffpb.Chunk{Data: data})
+	})
+	err = rdiff.New(s.blockSize, s.opts...).SignatureAt(f, size, w)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// ComputeDelta implements rdiffpb.SyncServer.
+func (s *Server) ComputeDelta(stream rdiffpb.Sync_ComputeDeltaServer) error {
+	return statusError(s.delta(stream))
+}
+
+// delta streams the delta of the file at the path of the first message against the signature received.
+func (s *Server) delta(stream rdiffpb.Sync_ComputeDeltaServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	blockSize := int(first.GetBlockSize())
+	if blockSize <= 0 || blockSize > rdiff.MaxBlockSize {
+		return fmt.Errorf("%w: invalid block size: %v", errInvalidArgument, blockSize)
+	}
+	f, size, err := s.open(first.GetPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	signature := newChunkReader(stream.Context(), s.Limiter, first.GetData(), func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetData(), err
+	})
+	w := newChunkWriter(stream.Context(), s.Limiter, func(data []byte) error {
+		return stream.Send(&rdiffpb.Chunk{Data: data})
+	})
+	err = rdiff.New(blockSize, s.opts...).DeltaStream(signature, f, size, w)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// ApplyDelta implements rdiffpb.SyncServer.
+func (s *Server) ApplyDelta(stream rdiffpb.Sync_ApplyDeltaServer) error {
+	size, err := s.apply(stream)
+	if err != nil {
+		return statusError(err)
+	}
+
+	return stream.SendAndClose(&rdiffpb.ApplyDeltaResponse{Size: size})
+}
+
+// apply applies the delta received to the file at the path of the first message, which is replaced by the rebuilt
+// source, and returns its size.
+func (s *Server) apply(stream rdiffpb.Sync_ApplyDeltaServer) (int64, error) {
+	first, err := stream.Recv()
+	if err != nil {
+		return 0, err
+	}
+	p, err := syncfile.Resolve(s.root, first.GetPath())
+	if err != nil {
+		return 0, err
+	}
+	delta := newChunkReader(stream.Context(), s.Limiter, first.GetData(), func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetData(), err
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err = syncfile.Apply(p, delta, rdiff.New(s.blockSize, s.opts...))
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+// open opens the file at the requested path.
+func (s *Server) open(requested string) (*os.File, int64, error) {
+	p, err := syncfile.Resolve(s.root, requested)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return syncfile.Open(p)
+}
+
+// statusError returns the status error reporting err, nil if err is nil. The errors caused by a status error, ex:
+// a canceled stream, report it.
+func statusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if st, ok := status.FromError(err); ok {
+		return st.Err()
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syncfile.ErrNotRegular):
+		// the file system errors hold the server paths
+		return status.Error(codes.NotFound, "file not found")
+	case errors.Is(err, errInvalidArgument), errors.Is(err, syncfile.ErrInvalidPath), errors.Is(err, rdiff.ErrCorrupt):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, rdiff.ErrVerification):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, "internal error")
+	}
+}
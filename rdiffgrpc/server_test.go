@@ -0,0 +1,225 @@
+package rdiffgrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/rdiffgrpc/rdiffpb"
+)
+
+const testBlockSize = 4
+
+// newTestClient serves the files of a new root directory, using a Server configured with opts, and returns
+// a client connected to it, and the root.
+func newTestClient(t *testing.T, files map[string]string, opts ...rdiff.Option) (rdiffpb.SyncClient, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dialTestServer(t, NewServer(root, testBlockSize, opts...)), root
+}
+
+// dialTestServer serves the server in memory, and returns a client connected to it.
+func dialTestServer(t *testing.T, s *Server) rdiffpb.SyncClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	rdiffpb.RegisterSyncServer(srv, s)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return rdiffpb.NewSyncClient(conn)
+}
+
+// getSignature returns the signature of the remote file, and its block size.
+func getSignature(t *testing.T, c rdiffpb.SyncClient, path string) ([]byte, int32, error) {
+	t.Helper()
+	stream, err := c.GetSignature(context.Background(), &rdiffpb.GetSignatureRequest{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signature []byte
+	var blockSize int32
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return signature, blockSize, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if chunk.GetBlockSize() != 0 {
+			blockSize = chunk.GetBlockSize()
+		}
+		signature = append(signature, chunk.GetData()...)
+	}
+}
+
+// applyDelta streams the delta to the remote file, split in messages of n bytes.
+func applyDelta(t *testing.T, c rdiffpb.SyncClient, path string, delta []byte, n int) (int64, error) {
+	t.Helper()
+	stream, err := c.ApplyDelta(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&rdiffpb.ApplyDeltaRequest{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+	for len(delta) > 0 {
+		data := delta[:min(n, len(delta))]
+		if err := stream.Send(&rdiffpb.ApplyDeltaRequest{Data: data}); err != nil {
+			break
+		}
+		delta = delta[len(data):]
+	}
+	resp, err := stream.CloseAndRecv()
+
+	return resp.GetSize(), err
+}
+
+func TestServer_Sync(t *testing.T) {
+	c, root := newTestClient(t, map[string]string{"dir/file": "the target content"})
+	signature, blockSize, err := getSignature(t, c, "dir/file")
+	if err != nil {
+		t.Fatalf("GetSignature() error = %v", err)
+	}
+	if blockSize != testBlockSize {
+		t.Errorf("GetSignature() block size = %v, want %v", blockSize, testBlockSize)
+	}
+
+	const source = "the source content, updated"
+	var delta bytes.Buffer
+	err = rdiff.New(int(blockSize)).DeltaStream(bytes.NewReader(signature), strings.NewReader(source), int64(len(source)), &delta)
+	if err != nil {
+		t.Fatalf("DeltaStream() error = %v", err)
+	}
+	size, err := applyDelta(t, c, "dir/file", delta.Bytes(), 5)
+	if err != nil {
+		t.Fatalf("ApplyDelta() error = %v", err)
+	}
+	if size != int64(len(source)) {
+		t.Errorf("ApplyDelta() size = %v, want %v", size, len(source))
+	}
+	got, err := os.ReadFile(filepath.Join(root, "dir", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != source {
+		t.Errorf("the file content after ApplyDelta() = %q, want %q", got, source)
+	}
+	info, err := os.Stat(filepath.Join(root, "dir", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("the file mode after ApplyDelta() = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	c, root := newTestClient(t, map[string]string{"file": "the target content", "dir/a": "a"})
+	for _, tt := range []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{name: "missing file", call: func() error {
+			_, _, err := getSignature(t, c, "missing")
+			return err
+		}, want: codes.NotFound},
+		{name: "directory", call: func() error {
+			_, _, err := getSignature(t, c, "dir")
+			return err
+		}, want: codes.NotFound},
+		{name: "escaping path", call: func() error {
+			_, _, err := getSignature(t, c, "dir/../../file")
+			return err
+		}, want: codes.InvalidArgument},
+		{name: "corrupt delta", call: func() error {
+			_, err := applyDelta(t, c, "file", []byte("garbage"), 3)
+			return err
+		}, want: codes.InvalidArgument},
+		{name: "missing target", call: func() error {
+			_, err := applyDelta(t, c, "missing", []byte("garbage"), 3)
+			return err
+		}, want: codes.NotFound},
+		{name: "signature without block size", call: func() error {
+			return computeDelta(c, &rdiffpb.ComputeDeltaRequest{Path: "file", Data: []byte("garbage")})
+		}, want: codes.InvalidArgument},
+		{name: "corrupt signature", call: func() error {
+			return computeDelta(c, &rdiffpb.ComputeDeltaRequest{Path: "file", BlockSize: testBlockSize, Data: []byte("garbage")})
+		}, want: codes.InvalidArgument},
+	} {
+		err := tt.call()
+		if status.Code(err) != tt.want {
+			t.Errorf("%v: error = %v, want the %v code", tt.name, err, tt.want)
+		}
+		if err != nil && strings.Contains(err.Error(), root) {
+			t.Errorf("%v: the error %q holds the root path", tt.name, err)
+		}
+	}
+
+	// the corrupt delta doesn't replace the file
+	got, err := os.ReadFile(filepath.Join(root, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "the target content" {
+		t.Errorf("the file content after a failed ApplyDelta() = %q", got)
+	}
+}
+
+// computeDelta sends a single ComputeDelta message, and returns the error of the call.
+func computeDelta(c rdiffpb.SyncClient, req *rdiffpb.ComputeDeltaRequest) error {
+	stream, err := c.ComputeDelta(context.Background())
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(req); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		_, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package rdiffgrpc
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff/internal/ratelimit"
+)
+
+// chunkSize is the max size of the data of a streamed message.
+const chunkSize = 32 << 10
+
+// chunkReader reads the data of the messages of a stream, received by recv, which returns io.EOF at the end of
+// the stream.
+type chunkReader struct {
+	recv func() ([]byte, error)
+	buf  []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		data, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// newChunkReader returns a reader of the data of the messages of a stream, the first one holding buf, and the next
+// ones being received by recv, see chunkReader. Its bandwidth is limited by l, if not nil, until ctx is done.
+func newChunkReader(ctx context.Context, l *rate.Limiter, buf []byte, recv func() ([]byte, error)) io.Reader {
+	return ratelimit.Reader(ctx, &chunkReader{recv: recv, buf: buf}, l)
+}
+
+// chunkSender sends the data written to it as messages of at most chunkSize bytes, using send, which must not
+// retain the data.
+type chunkSender struct {
+	send func([]byte) error
+}
+
+func (s *chunkSender) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		data := p[n:min(n+chunkSize, len(p))]
+		err := s.send(data)
+		if err != nil {
+			return n, err
+		}
+		n += len(data)
+	}
+
+	return n, nil
+}
+
+// newChunkWriter returns a writer buffering the data written to it in chunks, sent using send, which must be
+// flushed at the end. Its bandwidth is limited by l, if not nil, until ctx is done.
+func newChunkWriter(ctx context.Context, l *rate.Limiter, send func([]byte) error) *bufio.Writer {
+	return bufio.NewWriterSize(ratelimit.Writer(ctx, &chunkSender{send: send}, l), chunkSize)
+}
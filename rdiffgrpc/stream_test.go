@@ -0,0 +1,65 @@
+package rdiffgrpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestChunkWriter(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		writes []int
+		want   []int
+	}{
+		{name: "small writes", writes: []int{10, 20}, want: []int{30}},
+		{name: "one chunk", writes: []int{chunkSize}, want: []int{chunkSize}},
+		{name: "large write", writes: []int{2*chunkSize + 1}, want: []int{chunkSize, chunkSize, 1}},
+		{name: "no writes", want: nil},
+	} {
+		var got []int
+		var data []byte
+		w := newChunkWriter(context.Background(), nil, func(p []byte) error {
+			got = append(got, len(p))
+			data = append(data, p...)
+			return nil
+		})
+		var want []byte
+		for i, n := range tt.writes {
+			p := bytes.Repeat([]byte{byte(i)}, n)
+			want = append(want, p...)
+			if _, err := w.Write(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%v: chunk sizes = %v, want %v", tt.name, got, tt.want)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("%v: the chunks don't hold the written data", tt.name)
+		}
+
+		// the chunks are read back in order
+		chunks := [][]byte{}
+		for off := 0; off < len(data); off += chunkSize {
+			chunks = append(chunks, data[off:min(off+chunkSize, len(data))])
+		}
+		r := &chunkReader{recv: func() ([]byte, error) {
+			if len(chunks) == 0 {
+				return nil, io.EOF
+			}
+			chunk := chunks[0]
+			chunks = chunks[1:]
+			return chunk, nil
+		}}
+		read, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(read, want) {
+			t.Errorf("%v: ReadAll() = %v bytes, %v, want %v bytes", tt.name, len(read), err, len(want))
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package rdiffhttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/internal/ratelimit"
+	"github.com/silviutanasa/rdiff/internal/syncfile"
+)
+
+// maxErrorMessage is the max size of the error message read from a response which is not successful.
+const maxErrorMessage = 1 << 10
+
+// StatusError is returned by Pull for a response which is not successful.
+// A 422 Unprocessable Entity status, reporting an input which doesn't verify, matches rdiff.ErrVerification, using
+// errors.Is.
+type StatusError struct {
+	Code int
+	// Message is the beginning of the response body, which is the error message of a Handler
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%v %v: %v", e.Code, http.StatusText(e.Code), e.Message)
+}
+
+// Unwrap returns rdiff.ErrVerification for a 422 status, nil otherwise.
+func (e *StatusError) Unwrap() error {
+	if e.Code == http.StatusUnprocessableEntity {
+		return rdiff.ErrVerification
+	}
+
+	return nil
+}
+
+// Client pulls files from the endpoints served by a Handler. The zero value is ready to use.
+type Client struct {
+	// HTTPClient sends the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// BlockSize is the block size of the local signatures, if <= 0 it's rdiff.DefaultBlockSize, reduced for the local
+	// files smaller than 2 blocks
+	BlockSize int
+	// Options configure the rdiff.App computing the signature, and applying the delta, ex: the hashes
+	Options []rdiff.Option
+	// Limiter limits the bandwidth of the signature uploads and of the delta downloads, every byte consuming a token,
+	// nil means unlimited
+	Limiter *rate.Limiter
+}
+
+// Pull updates the local file to match the remote one, served by a Handler at url, using the zero Client,
+// see Client.Pull.
+func Pull(ctx context.Context, url, localPath string) error {
+	return (&Client{}).Pull(ctx, url, localPath)
+}
+
+// Pull updates the local file(localPath) to match the remote one, served by a Handler at url: it posts the signature
+// of the local file, receives the delta of the remote file against it, and applies it, so only the parts of the
+// remote file which differ are transferred. The local file is replaced atomically, keeping its permissions.
+// The local file must exist, and be non-empty, otherwise a non-nil error is returned, as it is for a response which
+// is not successful, see StatusError.
+func (c *Client) Pull(ctx context.Context, url, localPath string) error {
+	f, size, err := syncfile.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	blockSize := c.blockSize(size)
+	// the signature is streamed to the request body
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(rdiff.New(blockSize, c.Options...).SignatureAt(f, size, pw))
+	}()
+	defer func() {
+		pr.Close()
+		<-done
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, ratelimit.Reader(ctx, pr, c.Limiter))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", SignatureContentType)
+	req.Header.Set(BlockSizeHeader, strconv.Itoa(blockSize))
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorMessage))
+		return &StatusError{Code: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	delta := ratelimit.Reader(ctx, resp.Body, c.Limiter)
+	err = syncfile.Apply(localPath, delta, rdiff.New(blockSize, c.Options...))
+	if err != nil {
+		return fmt.Errorf("applying the delta from %v: %w", url, err)
+	}
+
+	return nil
+}
+
+// blockSize returns the block size of the signature of a local file of the given size.
+func (c *Client) blockSize(size int64) int {
+	if c.BlockSize > 0 {
+		return c.BlockSize
+	}
+
+	return int(max(min(rdiff.DefaultBlockSize, size/2), 1))
+}
+
+// httpClient returns the configured HTTP client, or the default one.
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+
+	return c.HTTPClient
+}
@@ -0,0 +1,131 @@
+package rdiffhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// localFile writes a local file, and returns its path.
+func localFile(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "local")
+	if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestPull(t *testing.T) {
+	const remote = "the remote content, which is newer than the local one"
+	srv, _ := newTestServer(t, map[string]string{"dir/file": remote})
+	local := localFile(t, "the local content, which is older")
+	if err := Pull(context.Background(), srv.URL+"/dir/file", local); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != remote {
+		t.Errorf("the local content after Pull() = %q, want %q", got, remote)
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the local file mode after Pull() = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	// the client block size is used by the server
+	c := &Client{BlockSize: 3, Options: []rdiff.Option{rdiff.WithStrongHash(rdiff.StrongHashSHA256)}}
+	local = localFile(t, "the local content")
+	if err := c.Pull(context.Background(), srv.URL+"/dir/file", local); err != nil {
+		t.Fatalf("Client.Pull() error = %v", err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != remote {
+		t.Errorf("the local content after Client.Pull() = %q, want %q", got, remote)
+	}
+}
+
+func TestPull_Errors(t *testing.T) {
+	srv, _ := newTestServer(t, map[string]string{"file": "the remote content"})
+	pinned := httptest.NewServer(New(t.TempDir(), testBlockSize, rdiff.WithWeakHash(rdiff.WeakHashRabin)))
+	defer pinned.Close()
+	if err := os.WriteFile(filepath.Join(pinned.Config.Handler.(*Handler).root, "file"), []byte("remote"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		url   string
+		local string
+		code  int
+		kind  error
+	}{
+		{name: "missing remote", url: srv.URL + "/missing", local: localFile(t, "local"), code: http.StatusNotFound},
+		{name: "other weak hash", url: pinned.URL + "/file", local: localFile(t, "local"), code: http.StatusUnprocessableEntity, kind: rdiff.ErrVerification},
+		{name: "missing local", url: srv.URL + "/file", local: filepath.Join(t.TempDir(), "missing"), kind: os.ErrNotExist},
+		{name: "empty local", url: srv.URL + "/file", local: localFile(t, "")},
+	} {
+		err := Pull(context.Background(), tt.url, tt.local)
+		if err == nil {
+			t.Errorf("%v: Pull() error = nil, want an error", tt.name)
+			continue
+		}
+		var se *StatusError
+		if tt.code != 0 && (!errors.As(err, &se) || se.Code != tt.code) {
+			t.Errorf("%v: Pull() error = %v, want a %v status", tt.name, err, tt.code)
+		}
+		if tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Errorf("%v: Pull() error = %v, want a %v error", tt.name, err, tt.kind)
+		}
+		if se != nil && strings.Contains(se.Message, os.TempDir()) {
+			t.Errorf("%v: Pull() error message %q holds a server path", tt.name, se.Message)
+		}
+	}
+}
+
+func TestPull_Canceled(t *testing.T) {
+	srv, _ := newTestServer(t, map[string]string{"file": "the remote content"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	local := localFile(t, "local")
+	if err := Pull(ctx, srv.URL+"/file", local); !errors.Is(err, context.Canceled) {
+		t.Errorf("Pull() error = %v, want %v", err, context.Canceled)
+	}
+	if got, _ := os.ReadFile(local); string(got) != "local" {
+		t.Errorf("the local content after a canceled Pull() = %q", got)
+	}
+}
+
+func TestPull_Limiter(t *testing.T) {
+	root := t.TempDir()
+	remote := strings.Repeat("the remote content, which is newer than the local one, ", 2000)
+	if err := os.WriteFile(filepath.Join(root, "file"), []byte(remote), 0640); err != nil {
+		t.Fatal(err)
+	}
+	h := New(root, testBlockSize)
+	h.Limiter = rate.NewLimiter(10<<20, 512)
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c := &Client{Limiter: rate.NewLimiter(10<<20, 512)}
+	local := localFile(t, "the local content, which is older")
+	if err := c.Pull(context.Background(), srv.URL+"/file", local); err != nil {
+		t.Fatalf("Client.Pull() error = %v", err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != remote {
+		t.Errorf("the local content after Client.Pull() has %v bytes, want %v", len(got), len(remote))
+	}
+}
@@ -0,0 +1,187 @@
+// Package rdiffhttp provides an http.Handler serving the signatures of the files under a root directory, applying
+// the deltas posted to them, and computing their deltas against the posted signatures, so any Go HTTP server can be
+// a delta-sync endpoint:
+//
+//	http.Handle("/files/", http.StripPrefix("/files/", rdiffhttp.New("/srv/files", 4096)))
+//
+// A client pushes a file by downloading its signature (GET), computing the delta of its own version against it,
+// using rdiff.App.Delta, and uploading the delta (POST), which the handler applies, replacing the file atomically.
+// A client pulls a file using Pull, which uploads the signature of its own version, and applies the delta received.
+package rdiffhttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/internal/ratelimit"
+	"github.com/silviutanasa/rdiff/internal/syncfile"
+)
+
+const (
+	// BlockSizeHeader is the header holding the block size of a signature: the one served by GET, which the
+	// delta computation must use, or the one posted by Pull.
+	BlockSizeHeader = "Rdiff-Block-Size"
+	// SignatureContentType is the content type of the signatures, served by GET, or posted by Pull.
+	SignatureContentType = "application/x-rdiff-signature"
+	// DeltaContentType is the content type of the deltas responded to Pull.
+	DeltaContentType = "application/x-rdiff-delta"
+)
+
+// errBadRequest is matched by the errors caused by an invalid request, which are reported with their message.
+var errBadRequest = errors.New("bad request")
+
+// Handler serves the signatures of the files under its root directory, applies the deltas posted to them, and
+// computes their deltas against the posted signatures.
+// The request path, relative to the root, identifies the file, it can't escape the root, while the symbolic links
+// under the root are followed. The methods are:
+//   - GET (and HEAD) responds with the signature of the file, as written by rdiff.App.SignatureAt
+//   - POST of a SignatureContentType body, with its block size in the BlockSizeHeader, responds with the delta
+//     of the file against the signature, as written by rdiff.App.DeltaStream, see Pull
+//   - POST of any other body applies the delta in the request body, as written by rdiff.App.Delta, to the file,
+//     which is replaced by the rebuilt source, and responds with 204 No Content
+//
+// The errors are reported using the status code: 404 for a missing file, 400 for an invalid path, or a corrupt
+// input, 422 for an input which doesn't verify(see rdiff.ErrVerification), 405 for another method, and 500 for the
+// other errors.
+type Handler struct {
+	// Limiter limits the bandwidth of the request and response bodies, every byte consuming a token, so all the
+	// requests share it, nil means unlimited. It must be set before the Handler serves its first request.
+	Limiter *rate.Limiter
+
+	root      string
+	blockSize int
+	opts      []rdiff.Option
+	// mu serializes the deltas applications, so concurrent uploads don't replace a file with each other's outputs
+	mu sync.Mutex
+}
+
+// New constructs a Handler for the files under root, and returns a pointer to it.
+// The blockSize must be the block size of the signatures and deltas, > 0, and the opts configure the rdiff.App
+// handling every request, ex: the hashes.
+func New(root string, blockSize int, opts ...rdiff.Option) *Handler {
+	return &Handler{root: root, blockSize: blockSize, opts: opts}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p, err := syncfile.Resolve(h.root, r.URL.Path)
+	if err == nil {
+		err = h.serve(p, w, r)
+	}
+	if err != nil {
+		code := statusCode(err)
+		msg := err.Error()
+		if code == http.StatusNotFound || code == http.StatusInternalServerError {
+			// the file system errors hold the server paths
+			msg = http.StatusText(code)
+		}
+		http.Error(w, msg, code)
+	}
+}
+
+// serve serves the request for the file at p.
+func (h *Handler) serve(p string, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return h.signature(p, w, r)
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == SignatureContentType {
+		return h.delta(p, w, r)
+	}
+	err := h.apply(p, ratelimit.Reader(r.Context(), r.Body, h.Limiter))
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// signature writes the signature of the file at p to w, or only its headers, for a HEAD request.
+func (h *Handler) signature(p string, w http.ResponseWriter, r *http.Request) error {
+	f, size, err := syncfile.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", SignatureContentType)
+	w.Header().Set(BlockSizeHeader, strconv.Itoa(h.blockSize))
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	return rdiff.New(h.blockSize, h.opts...).SignatureAt(f, size, ratelimit.Writer(r.Context(), w, h.Limiter))
+}
+
+// delta writes the delta of the file at p against the signature in the request body to w. An error occurring
+// after the delta is partially written aborts the response, so the client doesn't receive a truncated delta.
+func (h *Handler) delta(p string, w http.ResponseWriter, r *http.Request) error {
+	blockSize, err := strconv.Atoi(r.Header.Get(BlockSizeHeader))
+	if err != nil || blockSize <= 0 || blockSize > rdiff.MaxBlockSize {
+		return fmt.Errorf("%w: invalid %v: %q", errBadRequest, BlockSizeHeader, r.Header.Get(BlockSizeHeader))
+	}
+	f, size, err := syncfile.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", DeltaContentType)
+	dw := &deltaWriter{w: ratelimit.Writer(r.Context(), w, h.Limiter)}
+	signature := ratelimit.Reader(r.Context(), r.Body, h.Limiter)
+	err = rdiff.New(blockSize, h.opts...).DeltaStream(signature, f, size, dw)
+	if err != nil && dw.written {
+		panic(http.ErrAbortHandler)
+	}
+
+	return err
+}
+
+// deltaWriter records whether a delta response was written.
+type deltaWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (dw *deltaWriter) Write(p []byte) (int, error) {
+	dw.written = true
+
+	return dw.w.Write(p)
+}
+
+// apply applies the delta to the file at p, which is replaced by the rebuilt source.
+func (h *Handler) apply(p string, delta io.Reader) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return syncfile.Apply(p, delta, rdiff.New(h.blockSize, h.opts...))
+}
+
+// statusCode returns the HTTP status code reporting err.
+func statusCode(err error) int {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syncfile.ErrNotRegular):
+		return http.StatusNotFound
+	case errors.Is(err, errBadRequest), errors.Is(err, syncfile.ErrInvalidPath), errors.Is(err, rdiff.ErrCorrupt):
+		return http.StatusBadRequest
+	case errors.Is(err, rdiff.ErrVerification):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
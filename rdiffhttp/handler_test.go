@@ -0,0 +1,211 @@
+package rdiffhttp
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+const testBlockSize = 4
+
+// newTestServer serves the files of a new root directory, and returns the server and the root.
+func newTestServer(t *testing.T, files map[string]string) (*httptest.Server, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv := httptest.NewServer(New(root, testBlockSize))
+	t.Cleanup(srv.Close)
+
+	return srv, root
+}
+
+// testDelta computes the delta of source against the signature.
+func testDelta(t *testing.T, signature []byte, source string) []byte {
+	t.Helper()
+	dir := t.TempDir()
+	sigPath, sourcePath, deltaPath := filepath.Join(dir, "signature"), filepath.Join(dir, "source"), filepath.Join(dir, "delta")
+	if err := os.WriteFile(sigPath, signature, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sourcePath, []byte(source), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := rdiff.New(testBlockSize).Delta(sigPath, sourcePath, deltaPath); err != nil {
+		t.Fatalf("Delta() error = %v", err)
+	}
+	delta, err := os.ReadFile(deltaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return delta
+}
+
+func TestHandler_Sync(t *testing.T) {
+	srv, root := newTestServer(t, map[string]string{"dir/file": "the target content"})
+	resp, err := http.Get(srv.URL + "/dir/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(BlockSizeHeader) != "4" {
+		t.Fatalf("GET status = %v, block size = %q, want 200 and 4", resp.Status, resp.Header.Get(BlockSizeHeader))
+	}
+	if _, _, err := rdiff.ReadSignature(bytes.NewReader(signature)); err != nil {
+		t.Fatalf("ReadSignature() error = %v", err)
+	}
+
+	const source = "the source content, updated"
+	resp, err = http.Post(srv.URL+"/dir/file", "application/octet-stream", bytes.NewReader(testDelta(t, signature, source)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST status = %v, want %v", resp.Status, http.StatusNoContent)
+	}
+	got, err := os.ReadFile(filepath.Join(root, "dir", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != source {
+		t.Errorf("the file content after POST = %q, want %q", got, source)
+	}
+	info, err := os.Stat(filepath.Join(root, "dir", "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("the file mode after POST = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+	entries, err := os.ReadDir(filepath.Join(root, "dir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("the directory holds %v files after POST, want 1", len(entries))
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	srv, root := newTestServer(t, map[string]string{"file": "the target content", "dir/a": "a"})
+	for _, tt := range []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		// signature posts the body as a signature, with the block size header
+		signature bool
+		blockSize string
+		want      int
+	}{
+		{name: "missing file", method: http.MethodGet, path: "/missing", want: http.StatusNotFound},
+		{name: "directory", method: http.MethodGet, path: "/dir", want: http.StatusNotFound},
+		{name: "root", method: http.MethodGet, path: "/", want: http.StatusBadRequest},
+		{name: "escaping path", method: http.MethodGet, path: "/dir/../../file", want: http.StatusBadRequest},
+		{name: "method", method: http.MethodDelete, path: "/file", want: http.StatusMethodNotAllowed},
+		{name: "corrupt delta", method: http.MethodPost, path: "/file", body: "garbage", want: http.StatusBadRequest},
+		{name: "missing target", method: http.MethodPost, path: "/missing", body: "garbage", want: http.StatusNotFound},
+		{name: "signature without block size", method: http.MethodPost, path: "/file", body: "garbage", signature: true, want: http.StatusBadRequest},
+		{name: "corrupt signature", method: http.MethodPost, path: "/file", body: "garbage", signature: true, blockSize: "4", want: http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest(tt.method, srv.URL, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the path is not cleaned by the client
+		req.URL.Opaque = tt.path
+		if tt.signature {
+			req.Header.Set("Content-Type", SignatureContentType)
+			req.Header.Set(BlockSizeHeader, tt.blockSize)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%v: status = %v, want %v", tt.name, resp.Status, tt.want)
+		}
+		if strings.Contains(string(body), root) {
+			t.Errorf("%v: the response %q holds the root path", tt.name, body)
+		}
+	}
+
+	// the corrupt delta doesn't replace the file
+	got, err := os.ReadFile(filepath.Join(root, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "the target content" {
+		t.Errorf("the file content after a failed POST = %q", got)
+	}
+}
+
+func TestHandler_Verification(t *testing.T) {
+	srv, root := newTestServer(t, map[string]string{"file": "the target content"})
+	var delta bytes.Buffer
+	// the delta header records a source size which the operations don't rebuild
+	app := rdiff.New(testBlockSize)
+	var signature bytes.Buffer
+	if err := app.SignatureAt(strings.NewReader("the target content"), 18, &signature); err != nil {
+		t.Fatal(err)
+	}
+	d := testDelta(t, signature.Bytes(), "the target content")
+	header, ops, err := rdiff.ReadDelta(bytes.NewReader(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header.SourceSize++
+	writeGob(t, &delta, header, ops)
+	resp, err := http.Post(srv.URL+"/file", "application/octet-stream", &delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("POST status = %v, want %v", resp.Status, http.StatusUnprocessableEntity)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("the root holds %v files after a failed POST, want 1", len(entries))
+	}
+}
+
+// writeGob writes a delta, as a gob encoded header, followed by the operations.
+func writeGob(t *testing.T, w io.Writer, header rdiff.DeltaHeader, ops []rdiff.Operation) {
+	t.Helper()
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range ops {
+		if err := enc.Encode(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
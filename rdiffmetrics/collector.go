@@ -0,0 +1,190 @@
+// Package rdiffmetrics aggregates the measurements of the rdiff calls, see rdiff.WithMetrics, as Prometheus counters
+// and histograms, served in the text exposition format, so a long-running sync service can be scraped without
+// depending on a Prometheus client library:
+//
+//	c := rdiffmetrics.NewCollector()
+//	http.Handle("/metrics", c)
+//	http.Handle("/files/", http.StripPrefix("/files/", rdiffhttp.New("/srv/files", 4096, rdiff.WithMetrics(c.Observe))))
+//
+// The metrics are labeled by the name of the call, op: "signature", "delta" or "patch".
+package rdiffmetrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// ContentType is the content type of the text exposition format served by a Collector.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// DurationBuckets are the upper bounds, in seconds, of the buckets of the calls durations.
+	DurationBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+	// DeltaSizeBuckets are the upper bounds, in bytes, of the buckets of the deltas sizes.
+	DeltaSizeBuckets = []float64{1 << 10, 16 << 10, 256 << 10, 1 << 20, 16 << 20, 256 << 20, 1 << 30}
+)
+
+// Collector aggregates the measurements of the calls passed to Observe, and serves them as Prometheus metrics.
+// It's safe for concurrent use, so it can observe the Apps of a sync server, which run concurrently.
+type Collector struct {
+	mu sync.Mutex
+	// calls is the number of calls, by op and result: "ok" or "error", a delta skipped as unchanged being ok
+	calls     map[[2]string]uint64
+	durations map[string]*histogram
+	input     map[string]int64
+	output    map[string]int64
+	deltaSize *histogram
+	delta     rdiff.DeltaStats
+}
+
+// NewCollector returns a Collector without measurements.
+func NewCollector() *Collector {
+	return &Collector{
+		calls:     make(map[[2]string]uint64),
+		durations: make(map[string]*histogram),
+		input:     make(map[string]int64),
+		output:    make(map[string]int64),
+		deltaSize: newHistogram(DeltaSizeBuckets),
+	}
+}
+
+// Observe adds the measurements of a call, it's meant to be configured using rdiff.WithMetrics.
+func (c *Collector) Observe(m rdiff.Metrics) {
+	result := "ok"
+	if m.Err != nil && !errors.Is(m.Err, rdiff.ErrNoChanges) {
+		result = "error"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls[[2]string{m.Op, result}]++
+	d, ok := c.durations[m.Op]
+	if !ok {
+		d = newHistogram(DurationBuckets)
+		c.durations[m.Op] = d
+	}
+	d.observe(m.Duration.Seconds())
+	c.input[m.Op] += m.InputBytes
+	c.output[m.Op] += m.OutputBytes
+	if m.Op != "delta" || result != "ok" {
+		return
+	}
+	c.deltaSize.observe(float64(m.OutputBytes))
+	c.delta.MatchedBlocks += m.Delta.MatchedBlocks
+	c.delta.LiteralBytes += m.Delta.LiteralBytes
+	c.delta.WeakHashCollisions += m.Delta.WeakHashCollisions
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_ = c.Write(w)
+}
+
+// Write writes the metrics to w, in the Prometheus text exposition format.
+func (c *Collector) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	writeHeader(bw, "rdiff_calls_total", "counter", "The number of calls, by result.")
+	keys := make([][2]string, 0, len(c.calls))
+	for k := range c.calls {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b [2]string) int {
+		return slices.Compare(a[:], b[:])
+	})
+	for _, k := range keys {
+		fmt.Fprintf(bw, "rdiff_calls_total{op=%q,result=%q} %v\n", k[0], k[1], c.calls[k])
+	}
+	writeHeader(bw, "rdiff_call_duration_seconds", "histogram", "The duration of the calls.")
+	for _, op := range sortedKeys(c.durations) {
+		c.durations[op].write(bw, "rdiff_call_duration_seconds", fmt.Sprintf("op=%q", op))
+	}
+	writeOpCounter(bw, "rdiff_input_bytes_total", "The bytes hashed by the signatures and the deltas, and copied from the targets by the patches.", c.input)
+	writeOpCounter(bw, "rdiff_output_bytes_total", "The bytes written by the calls.", c.output)
+	writeHeader(bw, "rdiff_delta_size_bytes", "histogram", "The size of the deltas computed.")
+	c.deltaSize.write(bw, "rdiff_delta_size_bytes", "")
+	writeCounter(bw, "rdiff_matched_blocks_total", "The target blocks matched by the deltas.", c.delta.MatchedBlocks)
+	writeCounter(bw, "rdiff_literal_bytes_total", "The source bytes sent as literal data by the deltas.", c.delta.LiteralBytes)
+	writeCounter(bw, "rdiff_weak_hash_collisions_total", "The weak hash matches of the deltas not confirmed by the strong hash.", c.delta.WeakHashCollisions)
+
+	return bw.Flush()
+}
+
+// writeHeader writes the HELP and TYPE lines of the metric name.
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", name, help, name, typ)
+}
+
+// writeCounter writes a counter without labels.
+func writeCounter(w io.Writer, name, help string, v int64) {
+	writeHeader(w, name, "counter", help)
+	fmt.Fprintf(w, "%v %v\n", name, v)
+}
+
+// writeOpCounter writes a counter labeled by op.
+func writeOpCounter(w io.Writer, name, help string, values map[string]int64) {
+	writeHeader(w, name, "counter", help)
+	for _, op := range sortedKeys(values) {
+		fmt.Fprintf(w, "%v{op=%q} %v\n", name, op, values[op])
+	}
+}
+
+// sortedKeys returns the keys of m, sorted, so the metrics are written in a stable order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+// histogram counts the observations by bucket, the last bucket being +Inf.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// observe adds v to the first bucket it doesn't exceed, if any, and to the +Inf one.
+func (h *histogram) observe(v float64) {
+	if i, _ := slices.BinarySearch(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// write writes the cumulative buckets, the sum and the count of the histogram, with the labels, if any.
+func (h *histogram) write(w io.Writer, name, labels string) {
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%v_bucket{%v%vle=%q} %v\n", name, labels, sep, strconv.FormatFloat(bound, 'f', -1, 64), cumulative)
+	}
+	fmt.Fprintf(w, "%v_bucket{%v%vle=\"+Inf\"} %v\n", name, labels, sep, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%v_sum%v %v\n%v_count%v %v\n", name, labels, strconv.FormatFloat(h.sum, 'f', -1, 64), name, labels, h.count)
+}
@@ -0,0 +1,53 @@
+package rdiffmetrics
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	c.Observe(rdiff.Metrics{Op: "signature", Duration: 2 * time.Millisecond, InputBytes: 100, OutputBytes: 10})
+	c.Observe(rdiff.Metrics{
+		Op: "delta", Duration: 20 * time.Millisecond, InputBytes: 100, OutputBytes: 2000,
+		Delta: rdiff.DeltaStats{MatchedBlocks: 3, LiteralBytes: 7, WeakHashCollisions: 1},
+	})
+	c.Observe(rdiff.Metrics{Op: "delta", Duration: time.Second, Err: rdiff.ErrNoChanges, Delta: rdiff.DeltaStats{MatchedBlocks: 4}})
+	c.Observe(rdiff.Metrics{Op: "delta", Err: errors.New("failed"), Delta: rdiff.DeltaStats{MatchedBlocks: 100}})
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE rdiff_calls_total counter\n",
+		`rdiff_calls_total{op="delta",result="error"} 1` + "\n",
+		`rdiff_calls_total{op="delta",result="ok"} 2` + "\n",
+		`rdiff_calls_total{op="signature",result="ok"} 1` + "\n",
+		"# TYPE rdiff_call_duration_seconds histogram\n",
+		`rdiff_call_duration_seconds_bucket{op="delta",le="0.001"} 1` + "\n",
+		`rdiff_call_duration_seconds_bucket{op="delta",le="0.05"} 2` + "\n",
+		`rdiff_call_duration_seconds_bucket{op="delta",le="+Inf"} 3` + "\n",
+		`rdiff_call_duration_seconds_count{op="delta"} 3` + "\n",
+		`rdiff_call_duration_seconds_sum{op="signature"} 0.002` + "\n",
+		`rdiff_input_bytes_total{op="delta"} 100` + "\n",
+		`rdiff_output_bytes_total{op="signature"} 10` + "\n",
+		`rdiff_delta_size_bytes_bucket{le="1024"} 1` + "\n",
+		`rdiff_delta_size_bytes_bucket{le="16384"} 2` + "\n",
+		"rdiff_delta_size_bytes_count 2\n",
+		"rdiff_matched_blocks_total 7\n",
+		"rdiff_literal_bytes_total 7\n",
+		"rdiff_weak_hash_collisions_total 1\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("the metrics don't contain %q:\n%v", want, body)
+		}
+	}
+}
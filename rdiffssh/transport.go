@@ -0,0 +1,189 @@
+// Package rdiffssh runs the rdifftcp protocol over SSH, so the files can be delta-synced with the hosts reachable
+// only via SSH, the same way rsync does: every operation runs the remote rdiff command, serving a directory on its
+// standard input and output(rdiff serve -stdio), on a new session of the SSH connection.
+//
+//	conn, err := ssh.Dial("tcp", "host:22", config)
+//	c := rdiffssh.NewClient(conn)
+//	err = c.Pull(ctx, "/srv/files", "app.bin", "app.bin")
+//
+// The addr of the rdifftcp.Client calls is the remote directory, and the paths are relative to it.
+package rdiffssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/silviutanasa/rdiff/rdifftcp"
+)
+
+const (
+	// DefaultCommand is the remote command serving a directory, whose path is appended to it.
+	DefaultCommand = "rdiff serve -stdio"
+	// maxStderr is the max size of the remote command's standard error kept to explain its failure
+	maxStderr = 1 << 10
+	// closeTimeout is how long a closed session waits for the remote command to exit
+	closeTimeout = 5 * time.Second
+)
+
+// Transport opens the rdifftcp connections as sessions of an SSH connection, running the remote command.
+type Transport struct {
+	// Client is the SSH connection to the remote host
+	Client *ssh.Client
+	// Command is the remote command serving a directory on its standard input and output, which can hold flags,
+	// ex: "/usr/local/bin/rdiff serve -stdio -block-size 4096", DefaultCommand if empty
+	Command string
+}
+
+// NewClient returns an rdifftcp.Client syncing the files with the remote host of the SSH connection, using
+// DefaultCommand.
+func NewClient(client *ssh.Client) *rdifftcp.Client {
+	return &rdifftcp.Client{Dial: (&Transport{Client: client}).Dial}
+}
+
+// Dial runs the remote command, serving the remote directory(root), on a new session, and returns the connection
+// to its standard input and output, see rdifftcp.Client.Dial. If the remote command fails(ex: it's not installed),
+// the connection reads return its exit status and standard error.
+func (t *Transport) Dial(ctx context.Context, root string) (io.ReadWriteCloser, error) {
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+	s, err := t.Client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	c, err := newSessionConn(s)
+	if err != nil {
+		return nil, errors.Join(err, s.Close())
+	}
+	command := t.Command
+	if command == "" {
+		command = DefaultCommand
+	}
+	err = s.Start(command + " " + shellQuote(root))
+	if err != nil {
+		return nil, errors.Join(err, s.Close())
+	}
+	go c.wait()
+
+	return c, nil
+}
+
+// sessionConn is the connection to the standard input and output of the remote command.
+type sessionConn struct {
+	s      *ssh.Session
+	stdin  io.WriteCloser
+	stdout io.Reader
+	stderr *limitedBuffer
+	// done is closed when the remote command exited, err being its failure
+	done chan struct{}
+	err  error
+	once sync.Once
+}
+
+// newSessionConn returns the connection to the standard input and output of the command run by the session.
+func newSessionConn(s *ssh.Session) (*sessionConn, error) {
+	stdin, err := s.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := s.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	c := &sessionConn{s: s, stdin: stdin, stdout: stdout, stderr: &limitedBuffer{}, done: make(chan struct{})}
+	s.Stderr = c.stderr
+
+	return c, nil
+}
+
+// wait waits for the remote command to exit, and records its failure.
+func (c *sessionConn) wait() {
+	defer close(c.done)
+	err := c.s.Wait()
+	if err != nil {
+		c.err = fmt.Errorf("the remote command failed: %w", err)
+		if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+			c.err = fmt.Errorf("%w: %v", c.err, msg)
+		}
+	}
+}
+
+// Read reads the standard output of the remote command, which ends with its failure, if any.
+func (c *sessionConn) Read(p []byte) (int, error) {
+	n, err := c.stdout.Read(p)
+	if errors.Is(err, io.EOF) {
+		err = c.exitError(err)
+	}
+
+	return n, err
+}
+
+// Write writes to the standard input of the remote command, which fails with its failure, if it exited.
+func (c *sessionConn) Write(p []byte) (int, error) {
+	n, err := c.stdin.Write(p)
+	if err != nil {
+		err = c.exitError(err)
+	}
+
+	return n, err
+}
+
+// exitError returns the failure of the remote command, which closed its standard input or output, if any,
+// otherwise err.
+func (c *sessionConn) exitError(err error) error {
+	<-c.done
+	if c.err != nil {
+		return c.err
+	}
+
+	return err
+}
+
+// Close closes the standard input of the remote command, waits for it to exit, for up to closeTimeout, and closes
+// the session.
+func (c *sessionConn) Close() error {
+	c.once.Do(func() {
+		c.stdin.Close()
+		select {
+		case <-c.done:
+		case <-time.After(closeTimeout):
+		}
+		c.s.Close()
+	})
+
+	return nil
+}
+
+// limitedBuffer keeps the first maxStderr bytes written to it.
+type limitedBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p[:min(len(p), maxStderr-len(b.buf))]...)
+
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return string(b.buf)
+}
+
+// shellQuote quotes s for a POSIX shell, which runs the remote command.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,188 @@
+package rdiffssh
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/silviutanasa/rdiff/rdifftcp"
+)
+
+// newTestHost runs an SSH server, which serves the exec requests of DefaultCommand using an rdifftcp.Server, and
+// fails the other commands, like a shell would, and returns a client connected to it.
+func newTestHost(t *testing.T) *ssh.Client {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(conn, config)
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+		User:            "test",
+		HostKeyCallback: ssh.FixedHostKey(signer.PublicKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+// serveSSH serves the sessions of an SSH connection.
+func serveSSH(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, reqs, err := newCh.Accept()
+		if err != nil {
+			continue
+		}
+		go serveSession(ch, reqs)
+	}
+}
+
+// serveSession runs the command of the exec request of a session.
+func serveSession(ch ssh.Channel, reqs <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range reqs {
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+		var payload struct{ Command string }
+		if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+			req.Reply(false, nil)
+			return
+		}
+		req.Reply(true, nil)
+		status := runCommand(ch, payload.Command)
+		ch.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, status))
+		return
+	}
+}
+
+// runCommand runs DefaultCommand, and returns its exit status.
+func runCommand(ch ssh.Channel, command string) uint32 {
+	quoted, ok := strings.CutPrefix(command, DefaultCommand+" ")
+	if !ok {
+		fmt.Fprintf(ch.Stderr(), "sh: 1: %v: not found\n", strings.Fields(command)[0])
+		return 127
+	}
+	root := strings.ReplaceAll(strings.Trim(quoted, "'"), `'\''`, "'")
+	if err := rdifftcp.NewServer(root, 4).ServeStream(ch, ch); err != nil {
+		fmt.Fprintf(ch.Stderr(), "rdiff serve: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+func TestTransport(t *testing.T) {
+	client := newTestHost(t)
+	// the directory path is quoted for the remote shell
+	root := filepath.Join(t.TempDir(), "it's a dir")
+	if err := os.Mkdir(root, 0777); err != nil {
+		t.Fatal(err)
+	}
+	remote := strings.Repeat("the remote content, which is newer than the local one, ", 100)
+	if err := os.WriteFile(filepath.Join(root, "file"), []byte(remote), 0600); err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(t.TempDir(), "local")
+	if err := os.WriteFile(local, []byte("the local content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(client)
+	if err := c.Pull(context.Background(), root, "file", local); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != remote {
+		t.Errorf("the local content after Pull() has %v bytes, want %v", len(got), len(remote))
+	}
+
+	if err := os.WriteFile(local, []byte("the local content, pushed"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	size, err := c.Push(context.Background(), root, local, "file")
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "file")); string(got) != "the local content, pushed" || size != int64(len(got)) {
+		t.Errorf("the remote content after Push() = %q, size = %v", got, size)
+	}
+
+	err = c.Pull(context.Background(), root, "missing", local)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Pull() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestTransport_CommandFailure(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "local")
+	if err := os.WriteFile(local, []byte("the local content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := &rdifftcp.Client{Dial: (&Transport{Client: newTestHost(t), Command: "missing-rdiff serve -stdio"}).Dial}
+	err := c.Pull(context.Background(), t.TempDir(), "file", local)
+	var exitErr *ssh.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitStatus() != 127 {
+		t.Fatalf("Pull() error = %v, want the 127 exit status", err)
+	}
+	if !strings.Contains(err.Error(), "missing-rdiff: not found") {
+		t.Errorf("Pull() error = %v, want the remote standard error", err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want string
+	}{
+		{s: "/srv/files", want: `'/srv/files'`},
+		{s: "it's", want: `'it'\''s'`},
+		{s: "$HOME; rm -rf /", want: `'$HOME; rm -rf /'`},
+	} {
+		if got := shellQuote(tt.s); got != tt.want {
+			t.Errorf("shellQuote(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package rdifftcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/internal/ratelimit"
+	"github.com/silviutanasa/rdiff/internal/syncfile"
+)
+
+// failureTimeout is how long a client waits for the error frame explaining a failed write, on a connection
+// supporting the read deadlines.
+const failureTimeout = time.Second
+
+// Client syncs files with the servers. The zero value is ready to use.
+type Client struct {
+	// Dial opens a connection to the server at addr, running a single operation, ex: a remote process serving it on
+	// its standard input and output, see the rdiffssh package. If nil, a TCP connection is opened using Dialer.
+	Dial func(ctx context.Context, addr string) (io.ReadWriteCloser, error)
+	// Dialer opens the TCP connections, a zero net.Dialer if nil
+	Dialer *net.Dialer
+	// BlockSize is the proposed block size: for a pull, it's the block size of the local signature, if <= 0 it's
+	// rdiff.DefaultBlockSize, reduced for the local files smaller than 2 blocks, and for a push, if <= 0, the server
+	// uses its own
+	BlockSize int
+	// WeakHash and StrongHash are the proposed hashes, the rdiff defaults by default
+	WeakHash   rdiff.WeakHashType
+	StrongHash rdiff.StrongHashType
+	// Options configure the rdiff.App computing the local signatures and deltas, and applying the deltas, ex: a strong
+	// hash key, while the hashes are negotiated
+	Options []rdiff.Option
+	// Limiter limits the bandwidth of the connections, both ways, every byte consuming a token, nil means unlimited
+	Limiter *rate.Limiter
+}
+
+// Pull updates the local file to match the remote one, served by the server at addr, using the zero Client,
+// see Client.Pull.
+func Pull(ctx context.Context, addr, remotePath, localPath string) error {
+	return (&Client{}).Pull(ctx, addr, remotePath, localPath)
+}
+
+// Pull updates the local file(localPath) to match the remote one(remotePath), served by the server at addr: it streams
+// the signature of the local file, receives the delta of the remote file against it, and applies it, so only the parts
+// of the remote file which differ are transferred. The local file is replaced atomically, keeping its permissions.
+// The local file must exist, and be non-empty, otherwise a non-nil error is returned, as it is for a failure reported
+// by the server, see RemoteError.
+func (c *Client) Pull(ctx context.Context, addr, remotePath, localPath string) error {
+	f, size, err := syncfile.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	conn, err := c.dial(ctx, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	s := newStream(ctx, conn, c.Limiter)
+	h, err := c.handshake(s.rw, hello{op: opPull, blockSize: c.blockSize(size), path: remotePath})
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	app := rdiff.New(h.blockSize, c.options(h)...)
+	err = writeData(s.rw.Writer, func(w io.Writer) error {
+		return app.SignatureAt(f, size, w)
+	})
+	if err != nil {
+		return contextError(ctx, s.failure(err))
+	}
+	err = syncfile.Apply(localPath, &dataReader{r: s.rw}, app)
+	if err != nil {
+		return contextError(ctx, fmt.Errorf("applying the delta of %v: %w", remotePath, err))
+	}
+
+	return nil
+}
+
+// Push updates the remote file(remotePath), served by the server at addr, to match the local one(localPath): it
+// receives the signature of the remote file, and streams the delta of the local file against it, which the server
+// applies, so only the parts of the local file which differ are transferred. The remote file is replaced atomically,
+// keeping its permissions.
+// It returns the size of the rebuilt remote file, or a non-nil error if the local file doesn't exist, or for
+// a failure reported by the server, see RemoteError.
+func (c *Client) Push(ctx context.Context, addr, localPath, remotePath string) (int64, error) {
+	f, size, err := syncfile.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	conn, err := c.dial(ctx, addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	s := newStream(ctx, conn, c.Limiter)
+	h, err := c.handshake(s.rw, hello{op: opPush, blockSize: max(c.BlockSize, 0), path: remotePath})
+	if err != nil {
+		return 0, contextError(ctx, err)
+	}
+	n, err := push(s, rdiff.New(h.blockSize, c.options(h)...), f, size)
+
+	return n, contextError(ctx, err)
+}
+
+// push streams the delta of the local file against the signature received, and returns the size of the rebuilt
+// remote file.
+func push(s *stream, app *rdiff.App, f io.Reader, size int64) (int64, error) {
+	signature := &dataReader{r: s.rw}
+	err := writeData(s.rw.Writer, func(w io.Writer) error {
+		err := app.DeltaStream(signature, f, size, w)
+		if err != nil {
+			return err
+		}
+		// the signature is read up to its end frame
+		_, err = io.Copy(io.Discard, signature)
+		return err
+	})
+	if err != nil {
+		return 0, s.failure(err)
+	}
+	var buf []byte
+	payload, err := expectFrame(s.rw, &buf, frameDone)
+	if err != nil {
+		return 0, err
+	}
+	if len(payload) != 8 {
+		return 0, fmt.Errorf("%w: invalid done frame", errProtocol)
+	}
+
+	return int64(binary.BigEndian.Uint64(payload)), nil
+}
+
+// handshake sends the hello, and returns the parameters accepted by the server, which must be for the same operation.
+func (c *Client) handshake(rw *bufio.ReadWriter, h hello) (hello, error) {
+	h.weakHash, h.strongHash = c.WeakHash, c.StrongHash
+	err := writeFrame(rw, frameHello, h.marshal(false))
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		return hello{}, err
+	}
+	var buf []byte
+	payload, err := expectFrame(rw, &buf, frameAccept)
+	if err != nil {
+		return hello{}, err
+	}
+	accepted, err := unmarshalHello(payload, true)
+	if err != nil {
+		return hello{}, err
+	}
+	if accepted.op != h.op || accepted.blockSize <= 0 || accepted.blockSize > rdiff.MaxBlockSize {
+		return hello{}, fmt.Errorf("%w: invalid accept frame", errProtocol)
+	}
+
+	return accepted, nil
+}
+
+// options returns the options of the rdiff.App running the operation, using the negotiated hashes.
+func (c *Client) options(h hello) []rdiff.Option {
+	return append(slices.Clip(c.Options), rdiff.WithWeakHash(h.weakHash), rdiff.WithStrongHash(h.strongHash))
+}
+
+// blockSize returns the block size of the signature of a local file of the given size.
+func (c *Client) blockSize(size int64) int {
+	if c.BlockSize > 0 {
+		return c.BlockSize
+	}
+
+	return int(max(min(rdiff.DefaultBlockSize, size/2), 1))
+}
+
+// dial opens a connection to the server at addr.
+func (c *Client) dial(ctx context.Context, addr string) (io.ReadWriteCloser, error) {
+	if c.Dial != nil {
+		return c.Dial(ctx, addr)
+	}
+	d := c.Dialer
+	if d == nil {
+		d = &net.Dialer{}
+	}
+
+	return d.DialContext(ctx, "tcp", addr)
+}
+
+// stream is the client side of a connection.
+type stream struct {
+	conn io.ReadWriteCloser
+	rw   *bufio.ReadWriter
+	// w records the failed writes to the connection
+	w *connWriter
+}
+
+// newStream returns the stream of the connection, its bandwidth being limited by l, if not nil, until ctx is done.
+func newStream(ctx context.Context, conn io.ReadWriteCloser, l *rate.Limiter) *stream {
+	w := &connWriter{w: ratelimit.Writer(ctx, conn, l)}
+	r := bufio.NewReader(ratelimit.Reader(ctx, conn, l))
+
+	return &stream{conn: conn, rw: bufio.NewReadWriter(r, bufio.NewWriter(w)), w: w}
+}
+
+// failure returns the error reported by the server, which explains a failed write to the connection, if it's read
+// in time, otherwise err.
+func (s *stream) failure(err error) error {
+	if s.w.err == nil {
+		return err
+	}
+	if d, ok := s.conn.(interface{ SetReadDeadline(time.Time) error }); ok {
+		_ = d.SetReadDeadline(time.Now().Add(failureTimeout))
+	}
+	var buf []byte
+	for {
+		_, _, rerr := readFrame(s.rw, &buf)
+		var remote *RemoteError
+		if errors.As(rerr, &remote) {
+			return remote
+		}
+		if rerr != nil {
+			return err
+		}
+	}
+}
+
+// connWriter records the error of the writes to the connection.
+type connWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (cw *connWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	if err != nil {
+		cw.err = err
+	}
+
+	return n, err
+}
+
+// contextError returns the error of the context, if it's done, as it's the cause of the failure, otherwise err.
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
@@ -0,0 +1,221 @@
+package rdifftcp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// localFile writes a local file, and returns its path.
+func localFile(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "local")
+	if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestClient_Pull(t *testing.T) {
+	remote := strings.Repeat("the remote content, which is newer than the local one, ", 2000)
+	addr, _ := newTestServer(t, map[string]string{"dir/file": remote})
+	local := localFile(t, "the local content, which is older")
+	if err := Pull(context.Background(), addr, "dir/file", local); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	got, err := os.ReadFile(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != remote {
+		t.Errorf("the local content after Pull() has %v bytes, want %v", len(got), len(remote))
+	}
+	info, err := os.Stat(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the local file mode after Pull() = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	// the proposed block size and hashes are used by the server
+	c := &Client{BlockSize: 3, WeakHash: rdiff.WeakHashRabinKarp, StrongHash: rdiff.StrongHashBLAKE2b}
+	local = localFile(t, "the local content")
+	if err := c.Pull(context.Background(), addr, "dir/file", local); err != nil {
+		t.Fatalf("Client.Pull() error = %v", err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != remote {
+		t.Errorf("the local content after Client.Pull() has %v bytes, want %v", len(got), len(remote))
+	}
+}
+
+func TestClient_Push(t *testing.T) {
+	addr, root := newTestServer(t, map[string]string{"dir/file": "the remote content, which is older"})
+	local := strings.Repeat("the local content, which is newer than the remote one, ", 2000)
+	for _, c := range []*Client{{}, {BlockSize: 16, WeakHash: rdiff.WeakHashCRC32C, StrongHash: rdiff.StrongHashSHA256}} {
+		size, err := c.Push(context.Background(), addr, localFile(t, local), "dir/file")
+		if err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+		if size != int64(len(local)) {
+			t.Errorf("Push() size = %v, want %v", size, len(local))
+		}
+		got, err := os.ReadFile(filepath.Join(root, "dir", "file"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != local {
+			t.Errorf("the remote content after Push() has %v bytes, want %v", len(got), len(local))
+		}
+		local = "the local content, which is shorter now"
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	addr, _ := newTestServer(t, map[string]string{"file": "the remote content"})
+	keyed, _ := newTestServer(t, map[string]string{"file": "the remote content"}, rdiff.WithStrongHashKey([]byte("secret")))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tt := range []struct {
+		name string
+		call func() error
+		code ErrorCode
+		kind error
+	}{
+		{name: "pull missing remote", call: func() error {
+			return Pull(context.Background(), addr, "missing", localFile(t, "local"))
+		}, code: CodeNotFound, kind: os.ErrNotExist},
+		{name: "pull other key", call: func() error {
+			return Pull(context.Background(), keyed, "file", localFile(t, "local"))
+		}, code: CodeVerification, kind: rdiff.ErrVerification},
+		{name: "pull missing local", call: func() error {
+			return Pull(context.Background(), addr, "file", filepath.Join(t.TempDir(), "missing"))
+		}, kind: os.ErrNotExist},
+		{name: "pull empty local", call: func() error {
+			return Pull(context.Background(), addr, "file", localFile(t, ""))
+		}},
+		{name: "pull canceled", call: func() error {
+			return Pull(ctx, addr, "file", localFile(t, "local"))
+		}, kind: context.Canceled},
+		{name: "push missing remote", call: func() error {
+			_, err := (&Client{}).Push(context.Background(), addr, localFile(t, "local"), "missing")
+			return err
+		}, code: CodeNotFound, kind: os.ErrNotExist},
+		{name: "push other key", call: func() error {
+			_, err := (&Client{}).Push(context.Background(), keyed, localFile(t, "local"), "file")
+			return err
+		}, kind: rdiff.ErrVerification},
+	} {
+		err := tt.call()
+		if err == nil {
+			t.Errorf("%v: error = nil, want non-nil", tt.name)
+			continue
+		}
+		var remote *RemoteError
+		if tt.code != CodeInternal && (!errors.As(err, &remote) || remote.Code != tt.code) {
+			t.Errorf("%v: error = %v, want the %v code", tt.name, err, tt.code)
+		}
+		if tt.kind != nil && !errors.Is(err, tt.kind) {
+			t.Errorf("%v: error = %v, want %v", tt.name, err, tt.kind)
+		}
+	}
+}
+
+// pipeConn is a client connection to a Server serving a stream, over pipes.
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+	done chan error
+}
+
+// Close closes the client side of the stream, and waits for the server to finish.
+func (c *pipeConn) Close() error {
+	c.WriteCloser.Close()
+	return <-c.done
+}
+
+func TestClient_Dial(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "file"), []byte("the remote content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var served []error
+	c := &Client{Dial: func(_ context.Context, addr string) (io.ReadWriteCloser, error) {
+		if addr != "stream" {
+			t.Errorf("Dial() addr = %q, want %q", addr, "stream")
+		}
+		clientR, serverW := io.Pipe()
+		serverR, clientW := io.Pipe()
+		conn := &pipeConn{Reader: clientR, WriteCloser: clientW, done: make(chan error, 1)}
+		go func() {
+			err := NewServer(root, testBlockSize).ServeStream(serverR, serverW)
+			// the process serving the stream exits
+			serverW.Close()
+			serverR.Close()
+			served = append(served, err)
+			conn.done <- nil
+		}()
+		return conn, nil
+	}}
+
+	local := localFile(t, "the local content")
+	if err := c.Pull(context.Background(), "stream", "file", local); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != "the remote content" {
+		t.Errorf("the local content after Pull() = %q", got)
+	}
+	err := c.Pull(context.Background(), "stream", "missing", local)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Pull() error = %v, want %v", err, os.ErrNotExist)
+	}
+	if len(served) != 2 || served[0] != nil || !errors.Is(served[1], os.ErrNotExist) {
+		t.Errorf("ServeStream() errors = %v, want nil and %v", served, os.ErrNotExist)
+	}
+}
+
+func TestClient_Limiter(t *testing.T) {
+	root := t.TempDir()
+	remote := strings.Repeat("the remote content, which is newer than the local one, ", 2000)
+	if err := os.WriteFile(filepath.Join(root, "file"), []byte(remote), 0640); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := NewServer(root, testBlockSize)
+	s.Limiter = rate.NewLimiter(10<<20, 512)
+	go s.Serve(l)
+
+	// the bursts are smaller than the frames
+	c := &Client{Limiter: rate.NewLimiter(10<<20, 512)}
+	local := localFile(t, "the local content, which is older")
+	if err := c.Pull(context.Background(), l.Addr().String(), "file", local); err != nil {
+		t.Fatalf("Pull() error = %v", err)
+	}
+	if got, _ := os.ReadFile(local); string(got) != remote {
+		t.Errorf("the local content after Pull() has %v bytes, want %v", len(got), len(remote))
+	}
+	pushed := remote + "pushed"
+	if err := os.WriteFile(local, []byte(pushed), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Push(context.Background(), l.Addr().String(), local, "file"); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "file")); string(got) != pushed {
+		t.Errorf("the remote content after Push() has %v bytes, want %v", len(got), len(pushed))
+	}
+}
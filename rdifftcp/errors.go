@@ -0,0 +1,93 @@
+package rdifftcp
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/internal/syncfile"
+)
+
+// ErrorCode is the kind of a failure reported by an error frame.
+type ErrorCode byte
+
+const (
+	// CodeInternal reports an unexpected failure
+	CodeInternal ErrorCode = iota
+	// CodeNotFound reports a missing file, or one which is not a regular file
+	CodeNotFound
+	// CodeInvalid reports an invalid request, ex: an unsupported hash, an invalid path, or a corrupt input
+	CodeInvalid
+	// CodeVerification reports an input which doesn't verify, see rdiff.ErrVerification
+	CodeVerification
+)
+
+// String returns the name of the error code.
+func (c ErrorCode) String() string {
+	switch c {
+	case CodeInternal:
+		return "internal error"
+	case CodeNotFound:
+		return "not found"
+	case CodeInvalid:
+		return "invalid request"
+	case CodeVerification:
+		return "verification failed"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(c))
+	}
+}
+
+// RemoteError is a failure reported by the peer, using an error frame.
+// A CodeNotFound error matches fs.ErrNotExist, and a CodeVerification one matches rdiff.ErrVerification, using
+// errors.Is.
+type RemoteError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote: %v: %v", e.Code, e.Message)
+}
+
+// Unwrap returns the error matched by the error code, if any.
+func (e *RemoteError) Unwrap() error {
+	switch e.Code {
+	case CodeNotFound:
+		return fs.ErrNotExist
+	case CodeVerification:
+		return rdiff.ErrVerification
+	default:
+		return nil
+	}
+}
+
+// remoteError returns the RemoteError reporting err to the peer. The messages of the file system and unexpected
+// errors are not reported, as they hold the server paths.
+func remoteError(err error) *RemoteError {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syncfile.ErrNotRegular):
+		return &RemoteError{Code: CodeNotFound, Message: "file not found"}
+	case errors.Is(err, errProtocol), errors.Is(err, syncfile.ErrInvalidPath), errors.Is(err, rdiff.ErrCorrupt):
+		return &RemoteError{Code: CodeInvalid, Message: err.Error()}
+	case errors.Is(err, rdiff.ErrVerification):
+		return &RemoteError{Code: CodeVerification, Message: err.Error()}
+	default:
+		return &RemoteError{Code: CodeInternal, Message: "internal error"}
+	}
+}
+
+// marshal returns the payload of the error frame: the code, followed by the message.
+func (e *RemoteError) marshal() []byte {
+	return append([]byte{byte(e.Code)}, e.Message...)
+}
+
+// unmarshalRemoteError parses the payload of an error frame.
+func unmarshalRemoteError(b []byte) error {
+	if len(b) == 0 {
+		return fmt.Errorf("%w: empty error frame", errProtocol)
+	}
+
+	return &RemoteError{Code: ErrorCode(b[0]), Message: string(b[1:])}
+}
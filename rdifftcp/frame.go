@@ -0,0 +1,239 @@
+package rdifftcp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// frameType identifies the payload of a frame.
+type frameType byte
+
+const (
+	// frameHello opens a connection, see hello
+	frameHello frameType = 'H'
+	// frameAccept answers a hello with the negotiated parameters, see hello
+	frameAccept frameType = 'A'
+	// frameData holds a part of a signature or a delta
+	frameData frameType = 'D'
+	// frameEnd ends a signature or a delta
+	frameEnd frameType = 'E'
+	// frameDone answers an applied delta with the size of the rebuilt file
+	frameDone frameType = 'K'
+	// frameError reports a failure, see RemoteError, and it ends the connection
+	frameError frameType = 'X'
+)
+
+const (
+	// magic starts the hello payload
+	magic = "RDIF"
+	// version is the protocol version
+	version = 1
+	// maxFrame is the max payload size of a frame
+	maxFrame = 1 << 20
+	// dataSize is the max payload size of the data frames written
+	dataSize = 32 << 10
+)
+
+// errProtocol is matched by the errors caused by a peer which doesn't follow the protocol.
+var errProtocol = errors.New("protocol error")
+
+// operation is the operation requested by a hello.
+type operation byte
+
+const (
+	// opPull asks for the delta of the server's file against the client's signature
+	opPull operation = 'P'
+	// opPush asks for the server's signature, to apply the client's delta to the server's file
+	opPush operation = 'U'
+)
+
+// hello holds the parameters of an operation: the client proposes them, and the server answers with the accepted
+// ones. Its payload is the magic, the version, the operation, the block size(uint32), the weak and strong hashes,
+// and the file path, the accept payload being the same, without the magic and the path.
+type hello struct {
+	op         operation
+	blockSize  int
+	weakHash   rdiff.WeakHashType
+	strongHash rdiff.StrongHashType
+	path       string
+}
+
+// marshal returns the payload of the hello, or of the accept, which doesn't hold the magic and the path.
+func (h hello) marshal(accept bool) []byte {
+	var b []byte
+	if !accept {
+		b = append(b, magic...)
+	}
+	b = append(b, version, byte(h.op))
+	b = binary.BigEndian.AppendUint32(b, uint32(h.blockSize))
+	b = append(b, byte(h.weakHash), byte(h.strongHash))
+	if !accept {
+		b = append(b, h.path...)
+	}
+
+	return b
+}
+
+// unmarshalHello parses the payload of a hello, or of an accept.
+func unmarshalHello(b []byte, accept bool) (hello, error) {
+	if !accept {
+		if len(b) < len(magic) || string(b[:len(magic)]) != magic {
+			return hello{}, fmt.Errorf("%w: not an rdiff connection", errProtocol)
+		}
+		b = b[len(magic):]
+	}
+	if len(b) < 8 {
+		return hello{}, fmt.Errorf("%w: truncated hello", errProtocol)
+	}
+	if b[0] != version {
+		return hello{}, fmt.Errorf("%w: unsupported version: %v", errProtocol, b[0])
+	}
+	h := hello{
+		op:         operation(b[1]),
+		blockSize:  int(binary.BigEndian.Uint32(b[2:6])),
+		weakHash:   rdiff.WeakHashType(b[6]),
+		strongHash: rdiff.StrongHashType(b[7]),
+	}
+	if !accept {
+		h.path = string(b[8:])
+	}
+
+	return h, nil
+}
+
+// writeFrame writes a frame: its type, its payload size(uint32) and its payload.
+func writeFrame(w io.Writer, t frameType, payload []byte) error {
+	var header [5]byte
+	header[0] = byte(t)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	_, err := w.Write(header[:])
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+
+	return err
+}
+
+// readFrame reads a frame, and returns its type and its payload, which is only valid until the next call, as it
+// reuses buf, or a non-nil error. An error frame is returned as a *RemoteError.
+func readFrame(r io.Reader, buf *[]byte) (frameType, []byte, error) {
+	var header [5]byte
+	_, err := io.ReadFull(r, header[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrame {
+		return 0, nil, fmt.Errorf("%w: the frame size(%v) exceeds %v", errProtocol, size, maxFrame)
+	}
+	if cap(*buf) < int(size) {
+		*buf = make([]byte, size)
+	}
+	payload := (*buf)[:size]
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, nil, noEOF(err)
+	}
+	t := frameType(header[0])
+	if t == frameError {
+		return 0, nil, unmarshalRemoteError(payload)
+	}
+
+	return t, payload, nil
+}
+
+// expectFrame reads a frame of type t, and returns its payload.
+func expectFrame(r io.Reader, buf *[]byte, t frameType) ([]byte, error) {
+	got, payload, err := readFrame(r, buf)
+	if err != nil {
+		return nil, noEOF(err)
+	}
+	if got != t {
+		return nil, fmt.Errorf("%w: unexpected frame %q, want %q", errProtocol, got, t)
+	}
+
+	return payload, nil
+}
+
+// noEOF returns io.ErrUnexpectedEOF for io.EOF, as a connection can't end in the middle of an operation.
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// dataReader reads the data frames of a signature or a delta, until the end frame, when it returns io.EOF.
+type dataReader struct {
+	r    io.Reader
+	buf  []byte
+	data []byte
+	done bool
+}
+
+func (d *dataReader) Read(p []byte) (int, error) {
+	for len(d.data) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		t, payload, err := readFrame(d.r, &d.buf)
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		switch t {
+		case frameData:
+			d.data = payload
+		case frameEnd:
+			d.done = true
+		default:
+			return 0, fmt.Errorf("%w: unexpected frame %q in a data stream", errProtocol, t)
+		}
+	}
+	n := copy(p, d.data)
+	d.data = d.data[n:]
+
+	return n, nil
+}
+
+// dataSender writes the data written to it as data frames of at most dataSize bytes.
+type dataSender struct {
+	w io.Writer
+}
+
+func (s *dataSender) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		data := p[n:min(n+dataSize, len(p))]
+		err := writeFrame(s.w, frameData, data)
+		if err != nil {
+			return n, err
+		}
+		n += len(data)
+	}
+
+	return n, nil
+}
+
+// writeData writes the data produced by fn as data frames, followed by the end frame, to w, which is flushed.
+func writeData(w *bufio.Writer, fn func(io.Writer) error) error {
+	bw := bufio.NewWriterSize(&dataSender{w: w}, dataSize)
+	err := fn(bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = writeFrame(w, frameEnd, nil)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+
+	return err
+}
@@ -0,0 +1,97 @@
+package rdifftcp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+func TestHello(t *testing.T) {
+	h := hello{op: opPush, blockSize: 4096, weakHash: rdiff.WeakHashRabin, strongHash: rdiff.StrongHashSHA256, path: "dir/file"}
+	for _, accept := range []bool{false, true} {
+		got, err := unmarshalHello(h.marshal(accept), accept)
+		if err != nil {
+			t.Fatalf("unmarshalHello(accept: %v) error = %v", accept, err)
+		}
+		want := h
+		if accept {
+			want.path = ""
+		}
+		if got != want {
+			t.Errorf("unmarshalHello(accept: %v) = %+v, want %+v", accept, got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		name    string
+		payload []byte
+	}{
+		{name: "empty", payload: nil},
+		{name: "other protocol", payload: []byte("GET / HTTP/1.1")},
+		{name: "truncated", payload: []byte(magic + "\x01P")},
+		{name: "other version", payload: append([]byte(magic+"\x02"), h.marshal(true)[1:]...)},
+	} {
+		_, err := unmarshalHello(tt.payload, false)
+		if !errors.Is(err, errProtocol) {
+			t.Errorf("%v: unmarshalHello() error = %v, want %v", tt.name, err, errProtocol)
+		}
+	}
+}
+
+func TestFrames(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), dataSize/4)
+	var stream bytes.Buffer
+	bw := bufio.NewWriter(&stream)
+	err := writeData(bw, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("writeData() error = %v", err)
+	}
+	if err := writeFrame(&stream, frameError, (&RemoteError{Code: CodeVerification, Message: "bad"}).marshal()); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &dataReader{r: &stream}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("ReadAll() read %v bytes, want %v", len(got), len(data))
+	}
+	var buf []byte
+	_, _, err = readFrame(&stream, &buf)
+	if diff := cmp.Diff(&RemoteError{Code: CodeVerification, Message: "bad"}, err); diff != "" {
+		t.Errorf("readFrame() error mismatch (-want +got):\n%s", diff)
+	}
+	if !errors.Is(err, rdiff.ErrVerification) {
+		t.Errorf("readFrame() error = %v, want %v", err, rdiff.ErrVerification)
+	}
+}
+
+func TestFrames_Errors(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		stream string
+		want   error
+	}{
+		{name: "truncated stream", stream: "D\x00\x00\x00\x02a", want: io.ErrUnexpectedEOF},
+		{name: "missing end", stream: "D\x00\x00\x00\x01a", want: io.ErrUnexpectedEOF},
+		{name: "unexpected frame", stream: "K\x00\x00\x00\x00", want: errProtocol},
+		{name: "frame too large", stream: "D\xff\xff\xff\xff", want: errProtocol},
+	} {
+		_, err := io.ReadAll(&dataReader{r: strings.NewReader(tt.stream)})
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%v: ReadAll() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package rdifftcp provides a framed TCP protocol syncing the files under a root directory, with a server and
+// a client, for the environments where the HTTP or gRPC overhead, or dependencies, are unwanted:
+//
+//	l, err := net.Listen("tcp", ":7373")
+//	err = rdifftcp.NewServer("/srv/files", 4096).Serve(l)
+//
+// Every frame is a type byte, a payload size(uint32, big endian) and the payload. A connection runs a single
+// operation, which starts with a handshake: the client sends a hello frame, proposing the operation, the block size
+// and the hashes, and the server answers with an accept frame, holding the accepted ones, which both sides use, or
+// with an error frame. The operations are:
+//   - pull: the client streams the signature of its own version of the file, as data frames followed by an end frame,
+//     and the server streams the delta of its file against it, the same way, see Client.Pull
+//   - push: the server streams the signature of its file, the client streams the delta of its own version against
+//     it, and the server applies it, replacing the file atomically, then answers with a done frame, see Client.Push
+//
+// A failure is reported by an error frame, see RemoteError, which ends the connection.
+package rdifftcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/internal/ratelimit"
+	"github.com/silviutanasa/rdiff/internal/syncfile"
+)
+
+// lingerTimeout is how long a server connection which failed is drained, after the error frame, so the client
+// reads the error frame, instead of a connection reset.
+const lingerTimeout = time.Second
+
+// Server serves the files under its root directory to the clients.
+// The requested path, relative to the root, using forward slashes, identifies the file, it can't escape the root,
+// while the symbolic links under the root are followed.
+type Server struct {
+	// Limiter limits the bandwidth of the connections, both ways, every byte consuming a token, so all the
+	// connections share it, nil means unlimited. It must be set before the Server serves its first connection.
+	Limiter *rate.Limiter
+
+	root      string
+	blockSize int
+	opts      []rdiff.Option
+	// mu serializes the deltas applications, so concurrent pushes don't replace a file with each other's outputs
+	mu sync.Mutex
+}
+
+// NewServer constructs a Server for the files under root, and returns a pointer to it.
+// The blockSize is the block size of the signatures it serves, > 0, unless the client proposes one, and the opts
+// configure the rdiff.App handling every connection, ex: a strong hash key, while the hashes are negotiated.
+func NewServer(root string, blockSize int, opts ...rdiff.Option) *Server {
+	return &Server{root: root, blockSize: blockSize, opts: opts}
+}
+
+// Serve accepts the connections on the listener, serving every one on its own goroutine, until the listener fails,
+// ex: it's closed, and it returns its error. The failures of the connections are reported to the clients.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves the operation of a connection, then closes it, and returns the failure reported to the client,
+// if any.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+	rw := s.readWriter(conn, conn)
+	reported, err := s.serveStream(rw)
+	if reported {
+		linger(conn, rw)
+	}
+
+	return err
+}
+
+// ServeStream serves the operation of a stream, ex: the standard input and output of a process run by a remote
+// client, see the rdiffssh package, and returns the failure reported to the client, if any.
+func (s *Server) ServeStream(r io.Reader, w io.Writer) error {
+	_, err := s.serveStream(s.readWriter(r, w))
+
+	return err
+}
+
+// readWriter returns the buffered stream of r and w, limited by the configured limiter, if any.
+func (s *Server) readWriter(r io.Reader, w io.Writer) *bufio.ReadWriter {
+	ctx := context.Background()
+
+	return bufio.NewReadWriter(
+		bufio.NewReader(ratelimit.Reader(ctx, r, s.Limiter)), bufio.NewWriter(ratelimit.Writer(ctx, w, s.Limiter)),
+	)
+}
+
+// serveStream serves the operation, and reports its failure, if any, to the client, using an error frame, unless
+// it's reported by the client. It returns whether the error frame was written, and the failure.
+func (s *Server) serveStream(rw *bufio.ReadWriter) (bool, error) {
+	err := s.serve(rw)
+	if err == nil {
+		return false, nil
+	}
+	var remote *RemoteError
+	if errors.As(err, &remote) {
+		return false, err
+	}
+	// the error frame is written if the stream still works
+	reported := writeFrame(rw, frameError, remoteError(err).marshal()) == nil && rw.Flush() == nil
+
+	return reported, err
+}
+
+// linger closes the writing side of the connection, and drains it, for up to lingerTimeout, so the client reads
+// the last frames, which closing a connection holding unread data would discard.
+func linger(conn net.Conn, r io.Reader) {
+	cw, ok := conn.(interface{ CloseWrite() error })
+	if !ok || cw.CloseWrite() != nil {
+		return
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(lingerTimeout))
+	_, _ = io.Copy(io.Discard, r)
+}
+
+// serve runs the handshake, then the requested operation.
+func (s *Server) serve(rw *bufio.ReadWriter) error {
+	var buf []byte
+	payload, err := expectFrame(rw, &buf, frameHello)
+	if err != nil {
+		return err
+	}
+	h, err := unmarshalHello(payload, false)
+	if err != nil {
+		return err
+	}
+	h, err = s.negotiate(h)
+	if err != nil {
+		return err
+	}
+	p, err := syncfile.Resolve(s.root, h.path)
+	if err != nil {
+		return err
+	}
+	f, size, err := syncfile.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = writeFrame(rw, frameAccept, h.marshal(true))
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		return err
+	}
+	app := rdiff.New(h.blockSize, s.options(h)...)
+	if h.op == opPull {
+		return writeData(rw.Writer, func(w io.Writer) error {
+			return app.DeltaStream(&dataReader{r: rw}, f, size, w)
+		})
+	}
+
+	return s.push(rw, app, p, f, size)
+}
+
+// negotiate returns the accepted parameters of the hello, or a non-nil error if they can't be accepted.
+// A pull uses the block size of the client's signature, while a push uses the proposed one, if any, otherwise
+// the server's, and both use the proposed hashes, if they're known.
+func (s *Server) negotiate(h hello) (hello, error) {
+	switch h.op {
+	case opPull:
+	case opPush:
+		if h.blockSize == 0 {
+			h.blockSize = s.blockSize
+		}
+	default:
+		return hello{}, fmt.Errorf("%w: unknown operation: %q", errProtocol, h.op)
+	}
+	if h.blockSize <= 0 || h.blockSize > rdiff.MaxBlockSize {
+		return hello{}, fmt.Errorf("%w: invalid block size: %v", errProtocol, h.blockSize)
+	}
+	var weak rdiff.WeakHashType
+	if weak.UnmarshalText([]byte(h.weakHash.String())) != nil {
+		return hello{}, fmt.Errorf("%w: unsupported weak hash: %v", errProtocol, h.weakHash)
+	}
+	var strong rdiff.StrongHashType
+	if strong.UnmarshalText([]byte(h.strongHash.String())) != nil {
+		return hello{}, fmt.Errorf("%w: unsupported strong hash: %v", errProtocol, h.strongHash)
+	}
+
+	return h, nil
+}
+
+// options returns the options of the rdiff.App running the operation, using the negotiated hashes.
+func (s *Server) options(h hello) []rdiff.Option {
+	return append(slices.Clip(s.opts), rdiff.WithWeakHash(h.weakHash), rdiff.WithStrongHash(h.strongHash))
+}
+
+// push streams the signature of the file at p, then applies the delta received, and answers with the size of the
+// rebuilt file.
+func (s *Server) push(rw *bufio.ReadWriter, app *rdiff.App, p string, f *os.File, size int64) error {
+	err := writeData(rw.Writer, func(w io.Writer) error {
+		return app.SignatureAt(f, size, w)
+	})
+	if err != nil {
+		return err
+	}
+	delta := &dataReader{r: rw}
+	s.mu.Lock()
+	err = syncfile.Apply(p, delta, app)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	// the delta is read up to its end frame
+	_, err = io.Copy(io.Discard, delta)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	err = writeFrame(rw, frameDone, binary.BigEndian.AppendUint64(nil, uint64(info.Size())))
+	if err != nil {
+		return err
+	}
+
+	return rw.Flush()
+}
@@ -0,0 +1,112 @@
+package rdifftcp
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+const testBlockSize = 4
+
+// newTestServer serves the files of a new root directory, using a Server configured with opts, and returns its
+// address, and the root.
+func newTestServer(t *testing.T, files map[string]string, opts ...rdiff.Option) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go NewServer(root, testBlockSize, opts...).Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	return l.Addr().String(), root
+}
+
+// handshake sends the hello to the server at addr, and returns the accepted parameters, or the server's error.
+func handshake(t *testing.T, addr string, h hello) (hello, error) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	return (&Client{WeakHash: h.weakHash, StrongHash: h.strongHash}).
+		handshake(bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), h)
+}
+
+func TestServer_Negotiate(t *testing.T) {
+	addr, root := newTestServer(t, map[string]string{"file": "the target content", "dir/a": "a"})
+	for _, tt := range []struct {
+		name  string
+		hello hello
+		want  hello
+		code  ErrorCode
+	}{
+		{
+			name:  "pull",
+			hello: hello{op: opPull, blockSize: 7, weakHash: rdiff.WeakHashBuzhash, strongHash: rdiff.StrongHashSHA1, path: "file"},
+			want:  hello{op: opPull, blockSize: 7, weakHash: rdiff.WeakHashBuzhash, strongHash: rdiff.StrongHashSHA1},
+		},
+		{
+			name:  "push with the server block size",
+			hello: hello{op: opPush, path: "/file"},
+			want:  hello{op: opPush, blockSize: testBlockSize},
+		},
+		{name: "pull without block size", hello: hello{op: opPull, path: "file"}, code: CodeInvalid},
+		{name: "too large block size", hello: hello{op: opPush, blockSize: rdiff.MaxBlockSize + 1, path: "file"}, code: CodeInvalid},
+		{name: "unknown operation", hello: hello{op: 'Z', blockSize: 4, path: "file"}, code: CodeInvalid},
+		{name: "custom weak hash", hello: hello{op: opPush, weakHash: rdiff.WeakHashCustom, path: "file"}, code: CodeInvalid},
+		{name: "unknown strong hash", hello: hello{op: opPush, strongHash: 100, path: "file"}, code: CodeInvalid},
+		{name: "escaping path", hello: hello{op: opPush, path: "dir/../../file"}, code: CodeInvalid},
+		{name: "missing file", hello: hello{op: opPush, path: "missing"}, code: CodeNotFound},
+		{name: "directory", hello: hello{op: opPush, path: "dir"}, code: CodeNotFound},
+	} {
+		got, err := handshake(t, addr, tt.hello)
+		var remote *RemoteError
+		switch {
+		case tt.code == CodeInternal && err != nil:
+			t.Errorf("%v: handshake() error = %v", tt.name, err)
+		case tt.code == CodeInternal && got != tt.want:
+			t.Errorf("%v: handshake() = %+v, want %+v", tt.name, got, tt.want)
+		case tt.code != CodeInternal && (!errors.As(err, &remote) || remote.Code != tt.code):
+			t.Errorf("%v: handshake() error = %v, want the %v code", tt.name, err, tt.code)
+		case err != nil && strings.Contains(err.Error(), root):
+			t.Errorf("%v: the error %q holds the root path", tt.name, err)
+		}
+	}
+}
+
+func TestServer_NotRdiff(t *testing.T) {
+	addr, _ := newTestServer(t, map[string]string{"file": "the target content"})
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	var buf []byte
+	_, _, err = readFrame(bufio.NewReader(conn), &buf)
+	var remote *RemoteError
+	if !errors.As(err, &remote) || remote.Code != CodeInvalid {
+		t.Errorf("readFrame() error = %v, want the %v code", err, CodeInvalid)
+	}
+}
@@ -0,0 +1,239 @@
+package rdiffws
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coder/websocket"
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/internal/syncfile"
+)
+
+// Event reports a local file updated by Client.Sync, or a failure, which doesn't stop the sync.
+type Event struct {
+	// Path is the path of the file, relative to the synced directory, using forward slashes, empty for the failures
+	// which are not related to a file
+	Path string
+	// Err is the failure, nil for a file updated by a delta, a failure reported by the server being a RemoteError
+	Err error
+}
+
+// Client keeps a local directory in sync with a Server, see Sync. The zero value is ready to use.
+type Client struct {
+	// DialOptions configure the WebSocket handshake, ex: the HTTP headers, nil means the defaults
+	DialOptions *websocket.DialOptions
+	// BlockSize is the block size of the local signatures, if <= 0 it's decided for every file, see
+	// rdiff.DynamicBlockSize
+	BlockSize int
+	// Options configure the rdiff.App computing the signatures, and applying the deltas, ex: the hashes
+	Options []rdiff.Option
+	// Limiter limits the bandwidth of the connection, both ways, every byte consuming a token, nil means unlimited
+	Limiter *rate.Limiter
+	// MaxMessageSize is the max size of a delta received, DefaultMaxMessageSize if <= 0
+	MaxMessageSize int64
+}
+
+// Sync keeps the files under the local directory(dir) up to date with the ones served by a Server at url, a ws://
+// or wss:// URL, over a single connection, until ctx is done, and returns ctx.Err(), or until the connection fails,
+// and returns a non-nil error, so the caller decides when to reconnect.
+// It watches dir, see rdiff.App.Watch, and sends the signature of every file, then of every change, and applies
+// the deltas pushed by the server, replacing the files atomically, keeping their permissions. A delta computed
+// against a signature which is no longer the last one of its file is dropped, as the server pushes a new one.
+// The fn function, if not nil, receives the files updated, and the failures.
+func (c *Client) Sync(ctx context.Context, url, dir string, fn func(Event)) error {
+	if fn == nil {
+		fn = func(Event) {}
+	}
+	signatureDir, err := os.MkdirTemp("", "rdiffws-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(signatureDir)
+	conn, _, err := websocket.Dial(ctx, url, c.DialOptions)
+	if err != nil {
+		return err
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(maxMessageSize(c.MaxMessageSize))
+	cs := &clientSession{
+		client:       c,
+		peer:         peer{conn: conn, limiter: c.Limiter},
+		dir:          dir,
+		signatureDir: signatureDir,
+		fn:           fn,
+		files:        make(map[string]*localFile),
+	}
+	err = cs.run(ctx)
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if websocket.CloseStatus(err) == -1 {
+		conn.Close(closeStatus(err), "")
+	}
+
+	return err
+}
+
+// localFile is the state of a local file, when its last signature was sent.
+type localFile struct {
+	seq     uint64
+	modTime time.Time
+	size    int64
+}
+
+// clientSession is the state of a Sync call.
+type clientSession struct {
+	client       *Client
+	peer         peer
+	dir          string
+	signatureDir string
+	fn           func(Event)
+	// files holds the local files whose signatures were sent, by their paths relative to dir, using forward slashes
+	files map[string]*localFile
+	seq   uint64
+}
+
+// run sends the signatures of the files changed, and applies the deltas received, until ctx is done, or the
+// connection fails.
+func (cs *clientSession) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	changes := make(chan rdiff.WatchEvent)
+	watchErr := make(chan error, 1)
+	go func() {
+		app := rdiff.New(cs.client.BlockSize, cs.client.Options...)
+		watchErr <- app.Watch(ctx, cs.dir, cs.signatureDir, func(ev rdiff.WatchEvent) {
+			select {
+			case changes <- ev:
+			case <-ctx.Done():
+			}
+		})
+	}()
+	// the watch must end before its signature directory is removed
+	defer func() {
+		cancel()
+		<-watchErr
+	}()
+	messages := make(chan received)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- cs.receive(ctx, messages)
+	}()
+	for {
+		var err error
+		select {
+		case err = <-watchErr:
+			watchErr <- err
+			return err
+		case err = <-readErr:
+			return err
+		case ev := <-changes:
+			err = cs.send(ctx, ev)
+		case r := <-messages:
+			cs.handle(r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// receive reads the messages, and passes them to the messages channel, until the connection fails.
+func (cs *clientSession) receive(ctx context.Context, messages chan<- received) error {
+	for {
+		m, payload, err := cs.peer.read(ctx)
+		if err != nil {
+			return err
+		}
+		if m.Type != TypeDelta && m.Type != TypeError {
+			return fmt.Errorf("%w: unexpected %v message", errProtocol, m.Type)
+		}
+		select {
+		case messages <- received{m: m, payload: payload}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// send sends the signature of the file changed, or reports it was removed, or reports the failure of the change.
+func (cs *clientSession) send(ctx context.Context, ev rdiff.WatchEvent) error {
+	path := filepath.ToSlash(ev.Path)
+	if ev.Err != nil && !ev.Removed {
+		cs.fn(Event{Path: path, Err: ev.Err})
+		return nil
+	}
+	if ev.Removed {
+		delete(cs.files, path)
+		return cs.peer.write(ctx, Message{Type: TypeRemove, Path: path}, nil)
+	}
+	f, signature, err := cs.signature(ev.Path)
+	if err != nil {
+		cs.fn(Event{Path: path, Err: err})
+		return nil
+	}
+	cs.seq++
+	f.seq = cs.seq
+	cs.files[path] = f
+	m := Message{Type: TypeSignature, Path: path, Seq: f.seq, BlockSize: cs.blockSize(f.size)}
+
+	return cs.peer.write(ctx, m, signature)
+}
+
+// signature returns the state of the local file, and its signature, written by Watch. The file is stat'ed after
+// the signature was computed, so a later change of the file is detected, see handle.
+func (cs *clientSession) signature(rel string) (*localFile, []byte, error) {
+	info, err := os.Stat(filepath.Join(cs.dir, rel))
+	if err != nil {
+		return nil, nil, err
+	}
+	signature, err := os.ReadFile(filepath.Join(cs.signatureDir, rel))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &localFile{modTime: info.ModTime(), size: info.Size()}, signature, nil
+}
+
+// handle applies a delta received, unless it's stale, or reports a failure.
+func (cs *clientSession) handle(r received) {
+	if r.m.Type == TypeError {
+		cs.fn(Event{Path: r.m.Path, Err: &RemoteError{Code: r.m.Code, Message: r.m.Error}})
+		return
+	}
+	f := cs.files[r.m.Path]
+	if f == nil || f.seq != r.m.Seq {
+		return
+	}
+	p, err := syncfile.Resolve(cs.dir, r.m.Path)
+	if err != nil {
+		cs.fn(Event{Path: r.m.Path, Err: err})
+		return
+	}
+	info, err := os.Stat(p)
+	if err != nil || !info.ModTime().Equal(f.modTime) || info.Size() != f.size {
+		// the file changed, its new signature is about to be sent
+		return
+	}
+	// the file must not match the signature any longer, until its new signature is sent
+	f.seq = 0
+	err = syncfile.Apply(p, bytes.NewReader(r.payload), rdiff.New(r.m.BlockSize, cs.client.Options...))
+	if err != nil {
+		err = fmt.Errorf("applying the delta: %w", err)
+	}
+	cs.fn(Event{Path: r.m.Path, Err: err})
+}
+
+// blockSize returns the block size of the signature of a local file of the given size.
+func (cs *clientSession) blockSize(size int64) int {
+	if cs.client.BlockSize > 0 {
+		return cs.client.BlockSize
+	}
+
+	return rdiff.DynamicBlockSize(size)
+}
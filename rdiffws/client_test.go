@@ -0,0 +1,156 @@
+package rdiffws
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// startSync runs Client.Sync of dir in the background, until the test ends, and returns its events.
+func startSync(t *testing.T, c *Client, url, dir string) <-chan Event {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan Event, 100)
+	done := make(chan error)
+	go func() {
+		done <- c.Sync(ctx, url, dir, func(ev Event) { events <- ev })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Sync() error = %v, want %v", err, context.Canceled)
+		}
+	})
+
+	return events
+}
+
+// waitEvent returns the first event for path, failing the test after a timeout.
+func waitEvent(t *testing.T, events <-chan Event, path string) Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Path == path {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("Sync(): no event for %v", path)
+			return Event{}
+		}
+	}
+}
+
+// waitEvents returns the first events for the paths, in any order, failing the test after a timeout.
+func waitEvents(t *testing.T, events <-chan Event, paths ...string) map[string]Event {
+	t.Helper()
+	got := make(map[string]Event)
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(paths) {
+		select {
+		case ev := <-events:
+			if _, ok := got[ev.Path]; !ok && slices.Contains(paths, ev.Path) {
+				got[ev.Path] = ev
+			}
+		case <-timeout:
+			t.Fatalf("Sync(): got the events %v, want the ones of %v", got, paths)
+		}
+	}
+
+	return got
+}
+
+// checkSynced checks the event of the update of the local file at path, and its content.
+func checkSynced(t *testing.T, ev Event, dir, path, want string) {
+	t.Helper()
+	if ev.Err != nil {
+		t.Fatalf("Sync(): the update of %v failed: %v", path, ev.Err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Sync(): the %v content has %v bytes, want %v", path, len(got), len(want))
+	}
+}
+
+func TestClient_Sync(t *testing.T) {
+	remote := strings.Repeat("the remote content, which is newer than the local one, ", 2000)
+	url, root := newTestServer(t, map[string]string{
+		"file":        remote,
+		"dir/file":    "the remote content of the sub-directory file",
+		"remote-only": "the remote content of a file the client doesn't have",
+	})
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "file"), "the local content, which is older")
+	writeFile(t, filepath.Join(dir, "dir", "file"), "the local content of the sub-directory file")
+	writeFile(t, filepath.Join(dir, "local-only"), "the local content of a file the server doesn't have")
+	events := startSync(t, &Client{}, url, dir)
+	got := waitEvents(t, events, "file", "dir/file", "local-only")
+	checkSynced(t, got["file"], dir, "file", remote)
+	checkSynced(t, got["dir/file"], dir, "dir/file", "the remote content of the sub-directory file")
+	if ev := got["local-only"]; !errors.Is(ev.Err, fs.ErrNotExist) {
+		t.Errorf("Sync(): the local-only file event error = %v, want %v", ev.Err, fs.ErrNotExist)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "remote-only")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Sync() created the remote-only file, want it missing")
+	}
+
+	// a change of the server file is pushed
+	remote = strings.Replace(remote, "newer", "changed", 1)
+	writeFile(t, filepath.Join(root, "file"), remote)
+	checkSynced(t, waitEvent(t, events, "file"), dir, "file", remote)
+
+	// a change of the local file is reverted
+	writeFile(t, filepath.Join(dir, "dir", "file"), "the local content, changed")
+	checkSynced(t, waitEvent(t, events, "dir/file"), dir, "dir/file", "the remote content of the sub-directory file")
+}
+
+func TestClient_Sync_Errors(t *testing.T) {
+	url, _ := newTestServer(t, nil)
+	notWebSocket := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(notWebSocket.Close)
+	tests := []struct {
+		name string
+		url  string
+		dir  string
+	}{
+		{name: "not a WebSocket server", url: "ws" + strings.TrimPrefix(notWebSocket.URL, "http"), dir: t.TempDir()},
+		{name: "missing directory", url: url, dir: filepath.Join(t.TempDir(), "missing")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := (&Client{}).Sync(ctx, tt.url, tt.dir, nil); err == nil || errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Sync() error = %v, want a failure", err)
+			}
+		})
+	}
+}
+
+func TestClient_Limiter(t *testing.T) {
+	remote := strings.Repeat("the remote content, which is newer than the local one, ", 200)
+	url, _ := newTestServer(t, map[string]string{"file": remote})
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "file"), "the local content, which is older")
+	start := time.Now()
+	events := startSync(t, &Client{Limiter: rate.NewLimiter(64<<10, 1<<10)}, url, dir)
+	checkSynced(t, waitEvent(t, events, "file"), dir, "file", remote)
+	// the delta holds the remote content, which exceeds the burst
+	if elapsed, want := time.Since(start), time.Duration(len(remote)-1<<10)*time.Second/(64<<10); elapsed < want {
+		t.Errorf("Sync() took %v, want at least %v", elapsed, want)
+	}
+}
@@ -0,0 +1,185 @@
+package rdiffws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/coder/websocket"
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/internal/ratelimit"
+	"github.com/silviutanasa/rdiff/internal/syncfile"
+)
+
+// The message types.
+const (
+	// TypeSignature is the type of the messages holding the signature of a client file, sent by the client
+	TypeSignature = "signature"
+	// TypeRemove is the type of the messages reporting a client file which was removed, sent by the client
+	TypeRemove = "remove"
+	// TypeDelta is the type of the messages holding the delta of a server file, pushed by the server
+	TypeDelta = "delta"
+	// TypeError is the type of the messages reporting a failure, sent by the server
+	TypeError = "error"
+)
+
+// DefaultMaxMessageSize is the max size of a signature, or delta, received, if not configured.
+const DefaultMaxMessageSize = 64 << 20
+
+// errProtocol is matched by the errors of the messages which don't follow the protocol.
+var errProtocol = errors.New("protocol error")
+
+// Message is the JSON text message in front of every exchange, the signature and delta ones being followed by
+// a binary message, holding the signature, as written by rdiff.App.SignatureAt, or the delta, as written by
+// rdiff.App.DeltaStream.
+type Message struct {
+	// Type is the message type, ex: TypeSignature
+	Type string `json:"type"`
+	// Path is the path of the file, relative to the synced directory, using forward slashes
+	Path string `json:"path,omitempty"`
+	// Seq identifies a signature sent by the client, it's echoed by the delta computed against it
+	Seq uint64 `json:"seq,omitempty"`
+	// BlockSize is the block size of the signature, and of the delta computed against it
+	BlockSize int `json:"blockSize,omitempty"`
+	// Code is the kind of the failure reported by an error message
+	Code ErrorCode `json:"code,omitempty"`
+	// Error is the message of the failure reported by an error message
+	Error string `json:"error,omitempty"`
+}
+
+// hasPayload reports whether the message is followed by a binary message.
+func (m Message) hasPayload() bool {
+	return m.Type == TypeSignature || m.Type == TypeDelta
+}
+
+// ErrorCode is the kind of a failure reported by an error message.
+type ErrorCode string
+
+const (
+	// CodeInternal reports an unexpected failure
+	CodeInternal ErrorCode = "internal"
+	// CodeNotFound reports a missing file, or one which is not a regular file
+	CodeNotFound ErrorCode = "not_found"
+	// CodeInvalid reports an invalid message, ex: an invalid path, or a corrupt signature
+	CodeInvalid ErrorCode = "invalid"
+	// CodeVerification reports a signature which doesn't verify, see rdiff.ErrVerification
+	CodeVerification ErrorCode = "verification"
+)
+
+// RemoteError is a failure reported by the server, using an error message.
+// A CodeNotFound error matches fs.ErrNotExist, and a CodeVerification one matches rdiff.ErrVerification, using
+// errors.Is.
+type RemoteError struct {
+	Code    ErrorCode
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote: %v: %v", e.Code, e.Message)
+}
+
+// Unwrap returns the error matched by the error code, if any.
+func (e *RemoteError) Unwrap() error {
+	switch e.Code {
+	case CodeNotFound:
+		return fs.ErrNotExist
+	case CodeVerification:
+		return rdiff.ErrVerification
+	default:
+		return nil
+	}
+}
+
+// errorMessage returns the error message reporting err for the file at path. The messages of the file system and
+// unexpected errors are not reported, as they hold the server paths.
+func errorMessage(path string, err error) Message {
+	m := Message{Type: TypeError, Path: path}
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, syncfile.ErrNotRegular):
+		m.Code, m.Error = CodeNotFound, "file not found"
+	case errors.Is(err, errProtocol), errors.Is(err, syncfile.ErrInvalidPath), errors.Is(err, rdiff.ErrCorrupt):
+		m.Code, m.Error = CodeInvalid, err.Error()
+	case errors.Is(err, rdiff.ErrVerification):
+		m.Code, m.Error = CodeVerification, err.Error()
+	default:
+		m.Code, m.Error = CodeInternal, "internal error"
+	}
+
+	return m
+}
+
+// peer exchanges the messages over a WebSocket connection, its bandwidth limited by the limiter, if not nil.
+type peer struct {
+	conn    *websocket.Conn
+	limiter *rate.Limiter
+}
+
+// write writes m, followed by the payload, if m has one.
+func (p *peer) write(ctx context.Context, m Message, payload []byte) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	err = p.conn.Write(ctx, websocket.MessageText, data)
+	if err != nil || !m.hasPayload() {
+		return err
+	}
+	w, err := p.conn.Writer(ctx, websocket.MessageBinary)
+	if err != nil {
+		return err
+	}
+	_, err = ratelimit.Writer(ctx, w, p.limiter).Write(payload)
+
+	return errors.Join(err, w.Close())
+}
+
+// read reads a message, and its payload, if it has one.
+func (p *peer) read(ctx context.Context) (Message, []byte, error) {
+	typ, data, err := p.conn.Read(ctx)
+	if err != nil {
+		return Message{}, nil, err
+	}
+	if typ != websocket.MessageText {
+		return Message{}, nil, fmt.Errorf("%w: a binary message without a text message in front", errProtocol)
+	}
+	var m Message
+	err = json.Unmarshal(data, &m)
+	if err != nil {
+		return Message{}, nil, fmt.Errorf("%w: %w", errProtocol, err)
+	}
+	if !m.hasPayload() {
+		return m, nil, nil
+	}
+	typ, r, err := p.conn.Reader(ctx)
+	if err != nil {
+		return Message{}, nil, err
+	}
+	if typ != websocket.MessageBinary {
+		return Message{}, nil, fmt.Errorf("%w: the %v message is not followed by a binary message", errProtocol, m.Type)
+	}
+	var payload bytes.Buffer
+	_, err = io.Copy(&payload, ratelimit.Reader(ctx, r, p.limiter))
+	if err != nil {
+		return Message{}, nil, err
+	}
+
+	return m, payload.Bytes(), nil
+}
+
+// closeStatus returns the close status reporting the err which ended a connection.
+func closeStatus(err error) websocket.StatusCode {
+	switch {
+	case err == nil, errors.Is(err, context.Canceled):
+		return websocket.StatusNormalClosure
+	case errors.Is(err, errProtocol):
+		return websocket.StatusPolicyViolation
+	default:
+		return websocket.StatusInternalError
+	}
+}
@@ -0,0 +1,287 @@
+// Package rdiffws provides a WebSocket live sync channel, keeping the files of a client directory up to date with
+// the ones under a server root directory, over a persistent connection, opened by the client, so it suits the
+// browser-adjacent tooling, and the long-lived agents behind NAT:
+//
+//	http.Handle("/sync", rdiffws.NewServer("/srv/files"))
+//
+// Every exchange is a JSON text message, see Message, the signature and delta ones being followed by a binary
+// message holding their payload:
+//   - signature: the client sends the signature of a file, when it connects, and every time the file changes,
+//     the path relative to its directory identifying the server file
+//   - remove: the client reports a file which was removed, which the server stops tracking
+//   - delta: the server pushes the delta of its file against the last signature received, every time they differ,
+//     ex: when the server file changes, and the client applies it
+//   - error: the server reports a failure related to a file, see RemoteError
+//
+// The server doesn't push the files the client doesn't have, as their signatures are missing.
+package rdiffws
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/coder/websocket"
+	"golang.org/x/time/rate"
+
+	"github.com/silviutanasa/rdiff"
+	"github.com/silviutanasa/rdiff/internal/syncfile"
+)
+
+// DefaultPollInterval is the interval of checking the tracked server files for changes, if not configured.
+const DefaultPollInterval = time.Second
+
+// Server is an http.Handler accepting the WebSocket connections of the clients, and pushing them the deltas of the
+// files under its root directory, see Client.Sync.
+// The path of a file, relative to the root, using forward slashes, identifies it, it can't escape the root, while
+// the symbolic links under the root are followed. Its fields must be set before it serves its first connection.
+type Server struct {
+	// Limiter limits the bandwidth of the connections, both ways, every byte consuming a token, so all the
+	// connections share it, nil means unlimited
+	Limiter *rate.Limiter
+	// PollInterval is the interval of checking the files tracked by a connection for changes, DefaultPollInterval
+	// if <= 0
+	PollInterval time.Duration
+	// MaxMessageSize is the max size of a signature received, DefaultMaxMessageSize if <= 0
+	MaxMessageSize int64
+	// AcceptOptions configure the WebSocket handshake, ex: the origins of the browser clients which are allowed,
+	// nil meaning the same origin only
+	AcceptOptions *websocket.AcceptOptions
+
+	root string
+	opts []rdiff.Option
+}
+
+// NewServer constructs a Server for the files under root, and returns a pointer to it.
+// The opts configure the rdiff.App computing every delta, ex: the hashes, which must match the clients' ones, while
+// the block size is the one of the signature received.
+func NewServer(root string, opts ...rdiff.Option) *Server {
+	return &Server{root: root, opts: opts}
+}
+
+// ServeHTTP implements http.Handler, it accepts a WebSocket connection, and serves it until it's closed.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Accept(w, r, s.AcceptOptions)
+	if err != nil {
+		// Accept responded with the error
+		return
+	}
+	defer conn.CloseNow()
+	conn.SetReadLimit(maxMessageSize(s.MaxMessageSize))
+	ss := &session{
+		server: s,
+		peer:   peer{conn: conn, limiter: s.Limiter},
+		files:  make(map[string]*trackedFile),
+	}
+	err = ss.serve(r.Context())
+	if websocket.CloseStatus(err) == -1 {
+		conn.Close(closeStatus(err), "")
+	}
+}
+
+// pollInterval returns the configured poll interval, or the default one.
+func (s *Server) pollInterval() time.Duration {
+	if s.PollInterval <= 0 {
+		return DefaultPollInterval
+	}
+
+	return s.PollInterval
+}
+
+// trackedFile is a server file tracked by a connection.
+type trackedFile struct {
+	// p is the path of the server file
+	p string
+	// signature is the last signature of the client file, and seq and blockSize its properties
+	signature []byte
+	seq       uint64
+	blockSize int
+	// checked means the server file was compared against the signature, when it had modTime and size, -1 if it
+	// failed, so it's compared again only after a change, or a new signature
+	checked bool
+	modTime time.Time
+	size    int64
+}
+
+// changed records the state of the server file, as returned by os.Stat, and reports whether it changed since the
+// file was last compared, a failure being reported once.
+func (f *trackedFile) changed(info fs.FileInfo, err error) bool {
+	size, modTime := int64(-1), time.Time{}
+	if err == nil {
+		size, modTime = info.Size(), info.ModTime()
+	}
+	if f.checked && size == f.size && modTime.Equal(f.modTime) {
+		return false
+	}
+	f.checked, f.size, f.modTime = true, size, modTime
+
+	return true
+}
+
+// session is the state of a connection.
+type session struct {
+	server *Server
+	peer   peer
+	// files holds the tracked files, by their paths relative to the root
+	files map[string]*trackedFile
+}
+
+// received is a message received by a session.
+type received struct {
+	m       Message
+	payload []byte
+}
+
+// serve tracks the files of the signatures received, and pushes their deltas, until the connection is closed.
+func (ss *session) serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	messages := make(chan received)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- ss.receive(ctx, messages)
+	}()
+	ticker := time.NewTicker(ss.server.pollInterval())
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case err = <-errc:
+			return err
+		case r := <-messages:
+			err = ss.handle(ctx, r)
+		case <-ticker.C:
+			err = ss.poll(ctx)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// receive reads the messages, and passes them to the messages channel, until the connection fails.
+func (ss *session) receive(ctx context.Context, messages chan<- received) error {
+	for {
+		m, payload, err := ss.peer.read(ctx)
+		if err != nil {
+			return err
+		}
+		if m.Type != TypeSignature && m.Type != TypeRemove {
+			return fmt.Errorf("%w: unexpected %v message", errProtocol, m.Type)
+		}
+		select {
+		case messages <- received{m: m, payload: payload}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handle tracks the file of a signature received, and pushes its delta, or stops tracking a removed file.
+func (ss *session) handle(ctx context.Context, r received) error {
+	if r.m.Type == TypeRemove {
+		delete(ss.files, r.m.Path)
+		return nil
+	}
+	p, err := syncfile.Resolve(ss.server.root, r.m.Path)
+	if err == nil && (r.m.BlockSize <= 0 || r.m.BlockSize > rdiff.MaxBlockSize) {
+		err = fmt.Errorf("%w: invalid block size: %v", errProtocol, r.m.BlockSize)
+	}
+	if err != nil {
+		delete(ss.files, r.m.Path)
+		return ss.peer.write(ctx, errorMessage(r.m.Path, err), nil)
+	}
+	f := &trackedFile{p: p, signature: r.payload, seq: r.m.Seq, blockSize: r.m.BlockSize}
+	ss.files[r.m.Path] = f
+
+	return ss.push(ctx, r.m.Path, f)
+}
+
+// poll pushes the deltas of the tracked files which changed.
+func (ss *session) poll(ctx context.Context) error {
+	for path, f := range ss.files {
+		err := ss.push(ctx, path, f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// push pushes the delta of the server file against the signature of the client file, unless they were already
+// compared, or they match, in which case the delta keeps every block. The failures of the file are reported to
+// the client, once per change, while the error returned ends the connection.
+func (ss *session) push(ctx context.Context, path string, f *trackedFile) error {
+	info, err := os.Stat(f.p)
+	if !f.changed(info, err) {
+		return nil
+	}
+	var delta []byte
+	if err == nil {
+		delta, err = ss.delta(f)
+	}
+	if err != nil {
+		return ss.peer.write(ctx, errorMessage(path, err), nil)
+	}
+	if delta == nil {
+		return nil
+	}
+	m := Message{Type: TypeDelta, Path: path, Seq: f.seq, BlockSize: f.blockSize}
+
+	return ss.peer.write(ctx, m, delta)
+}
+
+// delta returns the delta of the server file against the signature of the client file, or nil if they match.
+func (ss *session) delta(f *trackedFile) ([]byte, error) {
+	file, size, err := syncfile.Open(f.p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var delta bytes.Buffer
+	app := rdiff.New(f.blockSize, ss.server.opts...)
+	err = app.DeltaStream(bytes.NewReader(f.signature), file, size, &delta)
+	if err != nil {
+		return nil, err
+	}
+	stats := app.LastDeltaStats()
+	if stats.LiteralBytes == 0 && stats.ZeroBytes == 0 && unchanged(f.signature, delta.Bytes()) {
+		return nil, nil
+	}
+
+	return delta.Bytes(), nil
+}
+
+// unchanged reports whether the delta keeps every block of the signature, in place, so applying it doesn't change
+// the target.
+func unchanged(signature, delta []byte) bool {
+	sigHeader, blocks, err := rdiff.ReadSignature(bytes.NewReader(signature))
+	if err != nil {
+		return false
+	}
+	header, ops, err := rdiff.ReadDelta(bytes.NewReader(delta))
+	if err != nil || header.SourceSize != sigHeader.TargetSize || len(ops) != len(blocks) {
+		return false
+	}
+	for i, op := range ops {
+		if op.Type != rdiff.OpBlockKeep || op.BlockIndex != int64(i) || len(op.Data) > 0 || op.Zeros > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// maxMessageSize returns the configured max message size, or the default one.
+func maxMessageSize(size int64) int64 {
+	if size <= 0 {
+		return DefaultMaxMessageSize
+	}
+
+	return size
+}
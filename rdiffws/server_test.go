@@ -0,0 +1,231 @@
+package rdiffws
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+const testBlockSize = 4
+
+// newTestServer serves the files of a new root directory, polled every few milliseconds, and returns the ws://
+// URL of the server and the root.
+func newTestServer(t *testing.T, files map[string]string) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		writeFile(t, filepath.Join(root, filepath.FromSlash(name)), content)
+	}
+	s := NewServer(root)
+	s.PollInterval = 10 * time.Millisecond
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), root
+}
+
+// writeFile writes the file at p, creating its directory, and changing its modification time, so the change is
+// detected even if the file system time granularity is coarse.
+func writeFile(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		t.Fatal(err)
+	}
+	info, statErr := os.Stat(p)
+	if err := os.WriteFile(p, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if statErr == nil {
+		modTime := info.ModTime().Add(time.Second)
+		if err := os.Chtimes(p, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// dialTestPeer opens a connection to the server at url.
+func dialTestPeer(t *testing.T, url string) *peer {
+	t.Helper()
+	conn, _, err := websocket.Dial(context.Background(), url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+	conn.SetReadLimit(DefaultMaxMessageSize)
+
+	return &peer{conn: conn}
+}
+
+// testSignature returns the signature of content.
+func testSignature(t *testing.T, content string) []byte {
+	t.Helper()
+	var signature bytes.Buffer
+	err := rdiff.New(testBlockSize).SignatureAt(strings.NewReader(content), int64(len(content)), &signature)
+	if err != nil {
+		t.Fatalf("SignatureAt() error = %v", err)
+	}
+
+	return signature.Bytes()
+}
+
+// readTimeout reads a message, received before the timeout, which otherwise closes the connection.
+func readTimeout(t *testing.T, p *peer, timeout time.Duration) (Message, []byte, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return p.read(ctx)
+}
+
+// applyDelta applies the delta to target, and returns the output.
+func applyDelta(t *testing.T, target string, delta []byte) string {
+	t.Helper()
+	var output bytes.Buffer
+	err := rdiff.New(testBlockSize).Apply(strings.NewReader(target), int64(len(target)), bytes.NewReader(delta), &output)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	return output.String()
+}
+
+func TestServer_Push(t *testing.T) {
+	remote := strings.Repeat("the remote content, which is newer than the local one, ", 100)
+	url, root := newTestServer(t, map[string]string{"dir/file": remote})
+	p := dialTestPeer(t, url)
+	ctx := context.Background()
+	local := "the local content, which is older"
+	m := Message{Type: TypeSignature, Path: "dir/file", Seq: 1, BlockSize: testBlockSize}
+	if err := p.write(ctx, m, testSignature(t, local)); err != nil {
+		t.Fatal(err)
+	}
+	got, delta, err := readTimeout(t, p, 5*time.Second)
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+	want := Message{Type: TypeDelta, Path: "dir/file", Seq: 1, BlockSize: testBlockSize}
+	if got != want {
+		t.Fatalf("read() = %+v, want %+v", got, want)
+	}
+	if local = applyDelta(t, local, delta); local != remote {
+		t.Fatalf("the local content after applying the delta has %v bytes, want %v", len(local), len(remote))
+	}
+
+	// the delta of a file matching the signature is not pushed
+	m.Seq = 2
+	if err := p.write(ctx, m, testSignature(t, local)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, err := readTimeout(t, p, 100*time.Millisecond); err == nil {
+		t.Fatalf("read() of an unchanged file = %+v, want no message", got)
+	}
+
+	// a change of the server file is pushed, the read timeout closed the connection, so the signature is sent again
+	p = dialTestPeer(t, url)
+	if err := p.write(ctx, m, testSignature(t, local)); err != nil {
+		t.Fatal(err)
+	}
+	remote = "the remote content, changed"
+	writeFile(t, filepath.Join(root, "dir", "file"), remote)
+	got, delta, err = readTimeout(t, p, 5*time.Second)
+	if err != nil || got.Type != TypeDelta || got.Seq != 2 {
+		t.Fatalf("read() after a change = %+v, %v, want a delta of the signature 2", got, err)
+	}
+	if local = applyDelta(t, local, delta); local != remote {
+		t.Errorf("the local content after applying the delta = %q, want %q", local, remote)
+	}
+}
+
+func TestServer_Errors(t *testing.T) {
+	url, root := newTestServer(t, map[string]string{"file": "the remote content"})
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		m         Message
+		signature []byte
+		want      ErrorCode
+	}{
+		{name: "missing file", m: Message{Path: "missing", BlockSize: testBlockSize}, want: CodeNotFound},
+		{name: "directory", m: Message{Path: "dir", BlockSize: testBlockSize}, want: CodeNotFound},
+		{name: "escaping path", m: Message{Path: "../file", BlockSize: testBlockSize}, want: CodeInvalid},
+		{name: "invalid block size", m: Message{Path: "file", BlockSize: -1}, want: CodeInvalid},
+		{name: "corrupt signature", m: Message{Path: "file", BlockSize: testBlockSize}, signature: []byte("corrupt"), want: CodeInvalid},
+	}
+	p := dialTestPeer(t, url)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.m.Type = TypeSignature
+			if tt.signature == nil {
+				tt.signature = testSignature(t, "the local content")
+			}
+			if err := p.write(context.Background(), tt.m, tt.signature); err != nil {
+				t.Fatal(err)
+			}
+			got, _, err := readTimeout(t, p, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Type != TypeError || got.Path != tt.m.Path || got.Code != tt.want {
+				t.Errorf("read() = %+v, want a %v error for %v", got, tt.want, tt.m.Path)
+			}
+			if strings.Contains(got.Error, root) {
+				t.Errorf("the error message %q holds the server path", got.Error)
+			}
+		})
+	}
+}
+
+func TestServer_ProtocolError(t *testing.T) {
+	url, _ := newTestServer(t, nil)
+	for _, send := range []func(p *peer) error{
+		func(p *peer) error {
+			return p.conn.Write(context.Background(), websocket.MessageBinary, []byte("payload"))
+		},
+		func(p *peer) error {
+			return p.conn.Write(context.Background(), websocket.MessageText, []byte("not JSON"))
+		},
+		func(p *peer) error {
+			return p.write(context.Background(), Message{Type: TypeDelta, Path: "file"}, []byte("delta"))
+		},
+	} {
+		p := dialTestPeer(t, url)
+		if err := send(p); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := readTimeout(t, p, 5*time.Second)
+		if status := websocket.CloseStatus(err); status != websocket.StatusPolicyViolation {
+			t.Errorf("read() after a protocol error = %v, want the status %v", err, websocket.StatusPolicyViolation)
+		}
+	}
+}
+
+func TestRemoteError(t *testing.T) {
+	tests := []struct {
+		code ErrorCode
+		want error
+	}{
+		{code: CodeNotFound, want: fs.ErrNotExist},
+		{code: CodeVerification, want: rdiff.ErrVerification},
+		{code: CodeInvalid},
+		{code: CodeInternal},
+	}
+	for _, tt := range tests {
+		err := &RemoteError{Code: tt.code, Message: "message"}
+		if got := errors.Unwrap(err); got != tt.want {
+			t.Errorf("errors.Unwrap(%v) = %v, want %v", err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package rdiff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// blockSizeHeader is the HTTP response header holding the block size of a signature fetched from a URL, ex: the one
+// served by the rdiffhttp package, which is adopted by the engine.
+const blockSizeHeader = "Rdiff-Block-Size"
+
+// isURL reports whether the location is an http:// or https:// URL.
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// openSignature opens the signature at the location, which is a file path, or an http:// or https:// URL, fetched
+// using a GET request, the response being streamed.
+func (a *App) openSignature(location string) (io.ReadCloser, error) {
+	if !isURL(location) {
+		return os.Open(location)
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	err = a.adoptSignatureResponse(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching the signature %v: %w", location, err)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{a.limitReader(resp.Body), resp.Body}, nil
+}
+
+// adoptSignatureResponse returns a non-nil error for a response which is not successful, a 404 Not Found status
+// matching fs.ErrNotExist, using errors.Is. The block size of the response header, if any, is adopted by the engine.
+func (a *App) adoptSignatureResponse(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%v: %w", resp.Status, fs.ErrNotExist)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("unexpected status: %v", resp.Status)
+	}
+	header := resp.Header.Get(blockSizeHeader)
+	if header == "" {
+		return nil
+	}
+	blockSize, err := strconv.Atoi(header)
+	if err != nil || blockSize <= 0 || blockSize > MaxBlockSize {
+		return fmt.Errorf("invalid %v header: %q", blockSizeHeader, header)
+	}
+	a.diffEngine.blockSize = blockSize
+
+	return nil
+}
+
+// httpClient returns the configured HTTP client, or the default one.
+func (a *App) httpClient() *http.Client {
+	if a.client == nil {
+		return http.DefaultClient
+	}
+
+	return a.client
+}
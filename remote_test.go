@@ -0,0 +1,106 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// countingTransport counts the requests sent using http.DefaultTransport.
+type countingTransport struct {
+	requests int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests++
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestApp_Delta_SignatureURL(t *testing.T) {
+	dir := t.TempDir()
+	target := bytes.Repeat([]byte("the target content, "), 100)
+	source := append([]byte("the source content, "), target...)
+	targetPath, sourcePath := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	if err := os.WriteFile(targetPath, target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(sourcePath, source, 0666); err != nil {
+		t.Fatal(err)
+	}
+	const blockSize = 16
+	sigPath := filepath.Join(dir, "signature")
+	if err := New(blockSize).Signature(targetPath, sigPath); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/signature", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(blockSizeHeader, strconv.Itoa(blockSize))
+		http.ServeFile(w, r, sigPath)
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, sigPath)
+	})
+	mux.HandleFunc("/invalid-block-size", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(blockSizeHeader, "0")
+		http.ServeFile(w, r, sigPath)
+	})
+	mux.HandleFunc("/failing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "failing", http.StatusInternalServerError)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name string
+		path string
+		app  *App
+		// wantErr is the error matched, or nil for any error
+		wantErr error
+		fail    bool
+	}{
+		{name: "adopted block size", path: "/signature", app: New(0)},
+		{name: "configured block size", path: "/plain", app: New(blockSize)},
+		{name: "checkpointed", path: "/signature", app: New(0, WithCheckpoint(filepath.Join(dir, "checkpoint"), 64))},
+		{name: "missing", path: "/missing", app: New(blockSize), fail: true, wantErr: fs.ErrNotExist},
+		{name: "failing", path: "/failing", app: New(blockSize), fail: true},
+		{name: "invalid block size", path: "/invalid-block-size", app: New(blockSize), fail: true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &countingTransport{}
+			WithHTTPClient(&http.Client{Transport: transport})(tt.app)
+			deltaPath := filepath.Join(dir, "delta"+strconv.Itoa(i))
+			err := tt.app.Delta(srv.URL+tt.path, sourcePath, deltaPath)
+			if transport.requests != 1 {
+				t.Errorf("Delta() sent %v requests, want 1", transport.requests)
+			}
+			if tt.fail {
+				if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Errorf("Delta() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Delta() error = %v", err)
+			}
+			outputPath := filepath.Join(dir, "output"+strconv.Itoa(i))
+			if err := New(blockSize).Patch(targetPath, deltaPath, outputPath); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(outputPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, source) {
+				t.Errorf("the output has %v bytes, which differ from the %v source bytes", len(got), len(source))
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package rdiff
+
+import (
+	"cmp"
+	"errors"
+	"io"
+	"os"
+	"slices"
+)
+
+const (
+	// renameCandidates is the max number of deleted target files probed for a new source file, the closest in size
+	renameCandidates = 4
+	// renameMinSimilarity is the min share of a new source file found in a deleted target file, for a rename
+	renameMinSimilarity = 0.5
+)
+
+// errRenameMismatch stops probing a deleted target file, once too much of the source file is not found in it.
+var errRenameMismatch = errors.New("the source file is not similar to the target file")
+
+// renameCandidates returns the target files which a new source file may be renamed from: the deleted regular files,
+// which are not hard links, and are not empty.
+func (a *App) renameCandidates(signatures map[string]dirSignatureFile, deleted []string) []dirSignatureFile {
+	if !a.renames {
+		return nil
+	}
+	var candidates []dirSignatureFile
+	for _, name := range deleted {
+		sig := signatures[name]
+		if sig.entry.Link == "" && sig.entry.HardLink == "" && sig.table.len() > 0 {
+			candidates = append(candidates, sig)
+		}
+	}
+
+	return candidates
+}
+
+// findRename returns the deleted target file the source file f, of the given size, was renamed from: the most similar
+// of the candidates closest in size, if at least renameMinSimilarity of the source is found in it.
+func (a *App) findRename(f *os.File, size int64, candidates []dirSignatureFile) (dirSignatureFile, bool, error) {
+	if size == 0 || len(candidates) == 0 {
+		return dirSignatureFile{}, false, nil
+	}
+	var closest []dirSignatureFile
+	for _, sig := range candidates {
+		targetSize := sig.entry.Header.TargetSize
+		if float64(min(size, targetSize)) >= renameMinSimilarity*float64(max(size, targetSize)) {
+			closest = append(closest, sig)
+		}
+	}
+	slices.SortStableFunc(closest, func(x, y dirSignatureFile) int {
+		return cmp.Compare(sizeDistance(size, x.entry.Header.TargetSize), sizeDistance(size, y.entry.Header.TargetSize))
+	})
+
+	var best dirSignatureFile
+	bestSimilarity := 0.0
+	for _, sig := range closest[:min(len(closest), renameCandidates)] {
+		similarity, err := a.similarity(f, size, sig)
+		if err != nil {
+			return dirSignatureFile{}, false, err
+		}
+		if similarity >= renameMinSimilarity && similarity > bestSimilarity {
+			best, bestSimilarity = sig, similarity
+		}
+	}
+
+	return best, bestSimilarity > 0, nil
+}
+
+// similarity returns the share of the source file f found in a target file, by computing their delta, which stops
+// as soon as the share drops below renameMinSimilarity, then it's 0.
+func (a *App) similarity(f *os.File, size int64, sig dirSignatureFile) (float64, error) {
+	blockSize := a.diffEngine.blockSize
+	defer func() { a.diffEngine.blockSize = blockSize }()
+	a.diffEngine.blockSize = sig.entry.BlockSize
+
+	maxLiteral := int64(float64(size) * (1 - renameMinSimilarity))
+	var literal int64
+	err := a.diffEngine.ComputeDeltaFunc(io.NewSectionReader(f, 0, size), sig.entry.Header, sig.table, func(op Operation) error {
+		literal += int64(len(op.Data))
+		if literal > maxLiteral {
+			return errRenameMismatch
+		}
+		return nil
+	})
+	if errors.Is(err, errRenameMismatch) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return 1 - float64(a.diffEngine.stats.LiteralBytes)/float64(size), nil
+}
+
+// sizeDistance returns the absolute difference of the sizes.
+func sizeDistance(x, y int64) int64 {
+	if x > y {
+		return x - y
+	}
+
+	return y - x
+}
@@ -0,0 +1,91 @@
+package rdiff
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestApp_DeltaDir_Renames(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+		return b
+	}
+	refactored, moved, replaced := random(20000), random(5000), random(5000)
+	edited := append(append(append([]byte{}, refactored[:8000]...), "edit"...), refactored[8000:]...)
+	target, source := t.TempDir(), t.TempDir()
+	writeTree(t, target, map[string][]byte{"old/refactored": refactored, "moved": moved, "replaced": replaced})
+	sourceFiles := map[string][]byte{"new/refactored": edited, "sub/moved": moved, "unrelated": random(5000)}
+	writeTree(t, source, sourceFiles)
+
+	output, files := patchDirAttrs(t, New(0), target, source)
+	type change struct {
+		Change      FileChange
+		RenamedFrom string
+	}
+	changes := make(map[string]change)
+	for _, file := range files {
+		changes[file.Path] = change{Change: file.Change, RenamedFrom: file.RenamedFrom}
+	}
+	want := map[string]change{
+		"new/refactored": {Change: FileRenamed, RenamedFrom: "old/refactored"},
+		"sub/moved":      {Change: FileRenamed, RenamedFrom: "moved"},
+		"unrelated":      {Change: FileNew},
+		"old/refactored": {Change: FileDeleted},
+		"moved":          {Change: FileDeleted},
+		"replaced":       {Change: FileDeleted},
+	}
+	if diff := cmp.Diff(want, changes); diff != "" {
+		t.Errorf("ReadDirDelta() changes \nDIFF: %v", diff)
+	}
+	if diff := cmp.Diff(sourceFiles, readTree(t, output), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("PatchDir() output differs from the source \nDIFF: %v", diff)
+	}
+	for _, file := range files {
+		if file.Change != FileRenamed {
+			continue
+		}
+		var literal int
+		for _, op := range file.Operations {
+			literal += len(op.Data)
+		}
+		if literal > 2*file.BlockSize {
+			t.Errorf("ReadDirDelta() renamed %v has %v literal bytes, want at most %v", file.Path, literal, 2*file.BlockSize)
+		}
+	}
+}
+
+func TestApp_DeltaDir_NoRenames(t *testing.T) {
+	content := bytes.Repeat([]byte("renamed content "), 100)
+	target, source := t.TempDir(), t.TempDir()
+	writeTree(t, target, map[string][]byte{"old": content})
+	writeTree(t, source, map[string][]byte{"new": content})
+	dir := t.TempDir()
+	signature, delta := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	app := New(16, WithRenameDetection(false))
+	if err := app.SignatureDir(target, signature); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.DeltaDir(signature, source, delta); err != nil {
+		t.Fatalf("DeltaDir() error = %v", err)
+	}
+	f, err := os.Open(delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	_, files, err := ReadDirDelta(f)
+	if err != nil {
+		t.Fatalf("ReadDirDelta() error = %v", err)
+	}
+	if len(files) != 2 || files[0].Path != "new" || files[0].Change != FileNew {
+		t.Errorf("ReadDirDelta() files = %+v, want new as new", files)
+	}
+}
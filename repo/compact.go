@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+// Compact bounds the chains of deltas of the file at p to maxChain deltas, > 0, so materializing any version applies
+// maxChain deltas at most, whatever the length of its history: a version whose chain is longer is re-anchored, its
+// delta being replaced by its delta against the full copy its chain starts from, which squashes the deltas in
+// between, and the following versions chain from it. The versions are all kept, so the snapshots listing them are
+// unaffected, while the squashed delta is usually bigger than the one it replaces.
+// It returns the number of deltas replaced, a failure keeping the ones replaced before it. A file which is not backed
+// up returns a non-nil error matching fs.ErrNotExist.
+func (r *Repo) Compact(p string, maxChain int) (int, error) {
+	if maxChain <= 0 {
+		return 0, fmt.Errorf("invalid max chain: %v", maxChain)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	meta, err := r.readMeta(p)
+	if err != nil {
+		return 0, err
+	}
+	// depth is the number of deltas of the chain of every version, and anchor the full copy it starts from
+	depth, anchor := make([]int, len(meta.Versions)), make([]int, len(meta.Versions))
+	replaced := 0
+	for i, v := range meta.Versions {
+		if v.Full {
+			anchor[i] = i
+			continue
+		}
+		if v.Base < 0 || v.Base >= i {
+			return replaced, fmt.Errorf("%w: the version %v of %v has the base %v", rdiff.ErrCorrupt, i, meta.Path, v.Base)
+		}
+		depth[i], anchor[i] = depth[v.Base]+1, anchor[v.Base]
+		if depth[i] <= maxChain {
+			continue
+		}
+		err = r.rebase(meta, i, anchor[i])
+		if err != nil {
+			return replaced, fmt.Errorf("re-anchoring the version %v: %w", i, err)
+		}
+		depth[i] = 1
+		replaced++
+	}
+
+	return replaced, nil
+}
+
+// rebase replaces the delta of the version by its delta against the base version, which is a full copy, and updates
+// the meta of the file. The new delta is written before the meta lists it, and the replaced one is removed after, so
+// a failure leaves the chain as it was.
+func (r *Repo) rebase(meta *fileMeta, version, base int) error {
+	dir := r.fileDir(meta.Path)
+	a := r.newApp()
+	full, err := os.Open(filepath.Join(dir, fullName(base)))
+	if err != nil {
+		return err
+	}
+	defer full.Close()
+	var signature bytes.Buffer
+	err = a.SignatureAt(full, meta.Versions[base].Size, &signature)
+	if err != nil {
+		return err
+	}
+	source, err := r.materialize(meta, version)
+	if err != nil {
+		return err
+	}
+	defer r.discard(source)
+	size := meta.Versions[version].Size
+	err = writeFile(filepath.Join(dir, deltaName(base, version)), func(w io.Writer) error {
+		return a.DeltaStream(&signature, source, size, w)
+	})
+	if err != nil {
+		return err
+	}
+	replaced := deltaName(meta.Versions[version].Base, version)
+	meta.Versions[version].Base = base
+	err = writeJSON(filepath.Join(dir, metaFile), meta)
+	if err != nil {
+		return err
+	}
+	// the replaced delta is no longer listed, a failure to remove it only wastes its space
+	_ = os.Remove(filepath.Join(dir, replaced))
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// chainLength returns the number of deltas of the chain of the version.
+func chainLength(versions []Version, version int) int {
+	n := 0
+	for v := versions[version]; !v.Full; v = versions[v.Base] {
+		n++
+	}
+
+	return n
+}
+
+func TestRepo_Compact(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "file")
+	rnd := rand.New(rand.NewSource(1))
+	versions := [][]byte{make([]byte, 30*testBlockSize)}
+	rnd.Read(versions[0])
+	r, err := Open(filepath.Join(dir, "repo"), testBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if i > 0 {
+			v := bytes.Clone(versions[i-1])
+			v[rnd.Intn(len(v))] ^= 0xFF
+			versions = append(versions, v)
+		}
+		writeVersion(t, p, versions[i], time.Unix(int64(i)*10, 0))
+		if _, err := r.Snapshot(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the chains of the versions 4 and 7 exceed 3 deltas
+	replaced, err := r.Compact(p, 3)
+	if err != nil || replaced != 2 {
+		t.Errorf("Compact() = %v, %v, want 2 deltas replaced", replaced, err)
+	}
+	vs, err := r.Versions(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range versions {
+		if n := chainLength(vs, i); n > 3 {
+			t.Errorf("the version %v has a chain of %v deltas, want up to 3", i, n)
+		}
+		var out bytes.Buffer
+		if err := r.Materialize(p, i, &out); err != nil || !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("Materialize(%v) error = %v, equal %v", i, err, bytes.Equal(out.Bytes(), want))
+		}
+	}
+	deltas, err := filepath.Glob(filepath.Join(r.fileDir(p), "*.delta"))
+	if err != nil || len(deltas) != 9 {
+		t.Errorf("the repository holds %v deltas, %v, want 9", len(deltas), err)
+	}
+	if replaced, err := r.Compact(p, 3); err != nil || replaced != 0 {
+		t.Errorf("Compact() of a compacted file = %v, %v, want 0 deltas replaced", replaced, err)
+	}
+
+	// the versions backed up after a compaction chain from the compacted ones
+	versions = append(versions, append(bytes.Clone(versions[9]), "appended"...))
+	writeVersion(t, p, versions[10], time.Unix(100, 0))
+	if _, err := r.Snapshot(p); err != nil {
+		t.Fatal(err)
+	}
+	if replaced, err := r.Compact(p, 1); err != nil || replaced != 7 {
+		t.Errorf("Compact() to differential deltas = %v, %v, want 7 deltas replaced", replaced, err)
+	}
+	var out bytes.Buffer
+	if err := r.Materialize(p, 10, &out); err != nil || !bytes.Equal(out.Bytes(), versions[10]) {
+		t.Errorf("Materialize(10) error = %v, equal %v", err, bytes.Equal(out.Bytes(), versions[10]))
+	}
+}
+
+func TestRepo_CompactErrors(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Open(filepath.Join(dir, "repo"), testBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Compact(filepath.Join(dir, "missing"), 3); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Compact() of a file which is not backed up error = %v, want %v", err, fs.ErrNotExist)
+	}
+	p := filepath.Join(dir, "file")
+	if err := os.WriteFile(p, make([]byte, 4*testBlockSize), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Snapshot(p); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Compact(p, 0); err == nil {
+		t.Error("Compact() with a max chain of 0 error = nil, want non-nil")
+	}
+}
@@ -0,0 +1,484 @@
+// Package repo is an incremental backup repository built on rdiff: the first backup of a file stores a full copy
+// of it, and every following one stores the delta of the new version against the signature of the previous one,
+// so a file changing a little between the backups costs a little storage. The versions which don't span more than
+// a block are stored as full copies, as they don't have a signature. A snapshot records the versions of a set
+// of files backed up together, and any version of a file can be rebuilt, by applying its chain of deltas to the
+// full copy:
+//
+//	r, err := repo.Open("/srv/backups", 4096)
+//	...
+//	snap, err := r.Snapshot("/etc/app.conf", "/var/lib/app/data.db")
+//	...
+//	err = r.Materialize("/var/lib/app/data.db", snap.Files["/var/lib/app/data.db"], w)
+//
+// The chains of deltas grow with the history of the files, so they're bounded by Compact.
+package repo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/silviutanasa/rdiff"
+)
+
+const (
+	configFile   = "repo.json"
+	filesDir     = "files"
+	snapshotsDir = "snapshots"
+	tmpDir       = "tmp"
+
+	// metaFile lists the versions of a backed up file
+	metaFile = "meta.json"
+)
+
+// config is the content of the configuration file of a repository.
+type config struct {
+	BlockSize int
+}
+
+// Version is a version of a backed up file.
+type Version struct {
+	// Number is the position of the version in the chain of the file, from 0
+	Number  int
+	Size    int64
+	ModTime time.Time
+	// Full tells whether the version is stored as a full copy, rather than as a delta against its Base version,
+	// which is the previous one, unless the chain of deltas was compacted, see Repo.Compact
+	Full bool
+	Base int
+	// Time is when the version was backed up
+	Time time.Time
+}
+
+// Snapshot is a set of files backed up together, see Repo.Snapshot.
+type Snapshot struct {
+	// ID numbers the snapshots of a repository, from 1, in the order they were taken
+	ID   int
+	Time time.Time
+	// Files are the version numbers of the files, by absolute path
+	Files map[string]int
+}
+
+// fileMeta is the content of the meta file of a backed up file.
+type fileMeta struct {
+	Path     string
+	Versions []Version
+}
+
+// Repo is a directory holding the versions of the files backed up, see Open.
+// It's safe for concurrent use, but not by several processes.
+type Repo struct {
+	dir  string
+	conf config
+	opts []rdiff.Option
+	mu   sync.Mutex
+}
+
+// Open opens the repository in dir, creating it if it doesn't exist. The files are split in blocks of blockSize
+// bytes, > 0, for their signatures and deltas, and the opts configure the rdiff App computing and applying them, so
+// they must be the same every time the repository is opened. An existing repository adopts its block size if
+// blockSize <= 0, otherwise the block sizes must match, and a non-nil error is returned if they don't.
+func Open(dir string, blockSize int, opts ...rdiff.Option) (*Repo, error) {
+	for _, d := range []string{filesDir, snapshotsDir, tmpDir} {
+		err := os.MkdirAll(filepath.Join(dir, d), 0777)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r := &Repo{dir: dir, opts: opts}
+	data, err := os.ReadFile(filepath.Join(dir, configFile))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if blockSize <= 0 || blockSize > rdiff.MaxBlockSize {
+			return nil, fmt.Errorf("invalid repository block size: %v", blockSize)
+		}
+		r.conf.BlockSize = blockSize
+		return r, writeJSON(filepath.Join(dir, configFile), r.conf)
+	case err != nil:
+		return nil, err
+	}
+	err = json.Unmarshal(data, &r.conf)
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading the repository configuration: %w", rdiff.ErrCorrupt, err)
+	}
+	if blockSize > 0 && blockSize != r.conf.BlockSize {
+		return nil, fmt.Errorf("the repository block size is %v, not %v", r.conf.BlockSize, blockSize)
+	}
+
+	return r, nil
+}
+
+// newApp returns the App computing, and applying, the deltas of the repository.
+func (r *Repo) newApp() *rdiff.App {
+	return rdiff.New(r.conf.BlockSize, r.opts...)
+}
+
+// Snapshot backs up the files at paths, and records their versions in a new snapshot, which it returns. A file
+// having the size, and the modification time, of its latest version is not backed up again, the snapshot listing
+// its latest version.
+// If a file is modified while it's backed up, a non-nil error matching rdiff.ErrModified is returned. A failure
+// doesn't record the snapshot, while the files backed up before it keep their new versions.
+func (r *Repo) Snapshot(paths ...string) (Snapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snap := Snapshot{Time: time.Now(), Files: make(map[string]int, len(paths))}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return Snapshot{}, err
+		}
+		snap.Files[abs], err = r.backup(abs, snap.Time)
+		if err != nil {
+			return Snapshot{}, fmt.Errorf("backing up %v: %w", abs, err)
+		}
+	}
+	snapshots, err := r.snapshotIDs()
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap.ID = 1
+	if len(snapshots) > 0 {
+		snap.ID = snapshots[len(snapshots)-1] + 1
+	}
+
+	return snap, writeJSON(r.snapshotPath(snap.ID), snap)
+}
+
+// Snapshots returns the snapshots of the repository, the oldest first.
+func (r *Repo) Snapshots() ([]Snapshot, error) {
+	ids, err := r.snapshotIDs()
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]Snapshot, 0, len(ids))
+	for _, id := range ids {
+		var snap Snapshot
+		err = readJSON(r.snapshotPath(id), &snap)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	return snapshots, nil
+}
+
+// Versions returns the versions of the file at p, the oldest first. A file which is not backed up returns a non-nil
+// error matching fs.ErrNotExist.
+func (r *Repo) Versions(p string) ([]Version, error) {
+	meta, err := r.readMeta(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return meta.Versions, nil
+}
+
+// Materialize rebuilds the version of the file at p, and writes it to w, by applying the chain of deltas of the
+// version to the full copy it starts from, the intermediate versions being written to temporary files. A file, or
+// a version, which is not backed up returns a non-nil error matching fs.ErrNotExist.
+func (r *Repo) Materialize(p string, version int, w io.Writer) error {
+	meta, err := r.readMeta(p)
+	if err != nil {
+		return err
+	}
+	if version < 0 || version >= len(meta.Versions) {
+		return fmt.Errorf("the version %v of %v: %w", version, meta.Path, fs.ErrNotExist)
+	}
+	f, err := r.materialize(meta, version)
+	if err != nil {
+		return err
+	}
+	defer r.discard(f)
+	_, err = io.Copy(w, f)
+
+	return err
+}
+
+// materialize returns the file holding the version, positioned at its start: its full copy, or a temporary file
+// otherwise, which is removed by discard.
+func (r *Repo) materialize(meta *fileMeta, version int) (*os.File, error) {
+	dir := r.fileDir(meta.Path)
+	chain := []int{version}
+	for v := meta.Versions[version]; !v.Full; v = meta.Versions[v.Base] {
+		// the bases precede their versions, so a chain ends
+		if v.Base < 0 || v.Base >= v.Number {
+			return nil, fmt.Errorf("%w: the version %v of %v has the base %v", rdiff.ErrCorrupt, v.Number, meta.Path, v.Base)
+		}
+		chain = append(chain, v.Base)
+	}
+	slices.Reverse(chain)
+	current, err := os.Open(filepath.Join(dir, fullName(chain[0])))
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(chain); i++ {
+		base, v := meta.Versions[chain[i-1]], chain[i]
+		next, err := r.applyDelta(current, base.Size, filepath.Join(dir, deltaName(base.Number, v)))
+		r.discard(current)
+		if err != nil {
+			return nil, fmt.Errorf("applying the delta of the version %v: %w", v, err)
+		}
+		current = next
+	}
+
+	return current, nil
+}
+
+// applyDelta applies the delta file to the target, which has the given size, and returns a temporary file holding
+// the output, positioned at its start.
+func (r *Repo) applyDelta(target *os.File, size int64, deltaPath string) (*os.File, error) {
+	delta, err := os.Open(deltaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer delta.Close()
+	out, err := os.CreateTemp(filepath.Join(r.dir, tmpDir), "materialize-*")
+	if err != nil {
+		return nil, err
+	}
+	err = r.newApp().Apply(target, size, delta, out)
+	if err == nil {
+		_, err = out.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		r.discard(out)
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// discard closes f, and removes it if it's a temporary file of the repository.
+func (r *Repo) discard(f *os.File) {
+	if f == nil {
+		return
+	}
+	f.Close()
+	if filepath.Dir(f.Name()) == filepath.Join(r.dir, tmpDir) {
+		os.Remove(f.Name())
+	}
+}
+
+// backup backs up the file at p, unless it's unchanged since its latest version, and returns the number of its
+// version. The caller must hold the lock.
+func (r *Repo) backup(p string, now time.Time) (int, error) {
+	meta, err := r.readMeta(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		meta, err = &fileMeta{Path: p}, os.MkdirAll(r.fileDir(p), 0777)
+	}
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	n := len(meta.Versions)
+	if n > 0 && meta.Versions[n-1].Size == info.Size() && meta.Versions[n-1].ModTime.Equal(info.ModTime()) {
+		return n - 1, nil
+	}
+	err = r.writeVersion(meta, f, info)
+	if err != nil {
+		return 0, err
+	}
+	meta.Versions = append(meta.Versions, Version{
+		Number:  n,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Full:    !r.hasSignature(meta.Versions),
+		Base:    n - 1,
+		Time:    now,
+	})
+	err = writeJSON(filepath.Join(r.fileDir(p), metaFile), meta)
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		// only the signature of the latest version is needed, by the delta of the next one
+		_ = os.Remove(filepath.Join(r.fileDir(p), signatureName(n-1)))
+	}
+
+	return n, nil
+}
+
+// writeVersion writes the content of the next version of the file, which is f: its delta against the signature of
+// the latest version, if it has one, or its full copy otherwise, and its own signature, if it spans more than
+// a block. f must be unchanged since its info was read, otherwise a non-nil error matching rdiff.ErrModified is
+// returned.
+// The files written are not listed by the meta of the file until it's updated, so a failure doesn't alter its
+// versions.
+func (r *Repo) writeVersion(meta *fileMeta, f *os.File, info fs.FileInfo) error {
+	dir := r.fileDir(meta.Path)
+	n := len(meta.Versions)
+	a := r.newApp()
+	content := io.NewSectionReader(f, 0, info.Size())
+	var err error
+	if r.hasSignature(meta.Versions) {
+		err = writeFile(filepath.Join(dir, deltaName(n-1, n)), func(w io.Writer) error {
+			return r.writeDelta(a, filepath.Join(dir, signatureName(n-1)), content, w)
+		})
+	} else {
+		err = writeFile(filepath.Join(dir, fullName(n)), func(w io.Writer) error {
+			_, err := io.Copy(w, content)
+			return err
+		})
+	}
+	if err == nil && info.Size() > int64(r.conf.BlockSize) {
+		err = writeFile(filepath.Join(dir, signatureName(n)), func(w io.Writer) error {
+			return a.SignatureAt(f, info.Size(), w)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	// the delta and the signature must describe the same content
+	now, err := f.Stat()
+	if err == nil && (now.Size() != info.Size() || !now.ModTime().Equal(info.ModTime())) {
+		err = fmt.Errorf("%w: %v was modified while it was backed up", rdiff.ErrModified, meta.Path)
+	}
+
+	return err
+}
+
+// hasSignature reports whether the latest of the versions has a signature, which it doesn't if it doesn't span more
+// than a block, as rdiff splits the files in 2 blocks at least.
+func (r *Repo) hasSignature(versions []Version) bool {
+	return len(versions) > 0 && versions[len(versions)-1].Size > int64(r.conf.BlockSize)
+}
+
+// writeDelta writes the delta of the source against the signature file to w.
+func (r *Repo) writeDelta(a *rdiff.App, signaturePath string, source *io.SectionReader, w io.Writer) error {
+	signature, err := os.Open(signaturePath)
+	if err != nil {
+		return err
+	}
+	defer signature.Close()
+
+	return a.DeltaStream(signature, source, source.Size(), w)
+}
+
+// readMeta reads the meta file of the file at p, or returns a non-nil error matching fs.ErrNotExist if it's not
+// backed up.
+func (r *Repo) readMeta(p string) (*fileMeta, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return nil, err
+	}
+	meta := &fileMeta{}
+	err = readJSON(filepath.Join(r.fileDir(abs), metaFile), meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// fileDir returns the directory of the file at the absolute path p, named after the hash of the path.
+func (r *Repo) fileDir(p string) string {
+	sum := sha256.Sum256([]byte(p))
+
+	return filepath.Join(r.dir, filesDir, hex.EncodeToString(sum[:]))
+}
+
+// snapshotIDs returns the identifiers of the snapshots, sorted.
+func (r *Repo) snapshotIDs() ([]int, error) {
+	entries, err := os.ReadDir(filepath.Join(r.dir, snapshotsDir))
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, e := range entries {
+		var id int
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if _, err := fmt.Sscanf(name, "%d", &id); ok && err == nil && snapshotName(id) == e.Name() {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+// snapshotPath returns the path of the snapshot id.
+func (r *Repo) snapshotPath(id int) string {
+	return filepath.Join(r.dir, snapshotsDir, snapshotName(id))
+}
+
+func snapshotName(id int) string {
+	return fmt.Sprintf("%06d.json", id)
+}
+
+// signatureName returns the name of the signature file of the version.
+func signatureName(version int) string {
+	return fmt.Sprintf("%06d.sig", version)
+}
+
+// fullName returns the name of the full copy of the version.
+func fullName(version int) string {
+	return fmt.Sprintf("%06d.full", version)
+}
+
+// deltaName returns the name of the delta file of the version, against the base version.
+func deltaName(base, version int) string {
+	return fmt.Sprintf("%06d-%06d.delta", base, version)
+}
+
+// writeFile writes the file at p using write, to a temporary file which replaces p once complete, so a failure
+// doesn't leave a partial file behind, nor alter p.
+func writeFile(p string, write func(io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	err = errors.Join(err, f.Close())
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(f.Name()))
+	}
+
+	return nil
+}
+
+// writeJSON writes the JSON encoding of v to the file at p, see writeFile.
+func writeJSON(p string, v any) error {
+	return writeFile(p, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(v)
+	})
+}
+
+// readJSON decodes the JSON file at p into v.
+func readJSON(p string, v any) error {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("%w: reading %v: %w", rdiff.ErrCorrupt, p, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testBlockSize = 64
+
+// writeVersion writes data to the file at p, with a modification time distinct from the previous versions.
+func writeVersion(t *testing.T, p string, data []byte, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(p, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(p, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRepo(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	rnd := rand.New(rand.NewSource(1))
+	versions := make([][]byte, 4)
+	versions[0] = make([]byte, 20*testBlockSize+7)
+	rnd.Read(versions[0])
+	for i := 1; i < len(versions); i++ {
+		// every version alters a byte, and appends some
+		versions[i] = append(bytes.Clone(versions[i-1]), byte(i), byte(i))
+		versions[i][i*testBlockSize] ^= 0xFF
+	}
+	writeVersion(t, b, []byte("b content"), time.Unix(1000, 0))
+
+	r, err := Open(filepath.Join(dir, "repo"), testBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshots []Snapshot
+	for i, v := range versions {
+		writeVersion(t, a, v, time.Unix(int64(i)*10, 0))
+		snap, err := r.Snapshot(a, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap.ID != i+1 || snap.Files[a] != i || snap.Files[b] != 0 {
+			t.Errorf("Snapshot() = %+v, want the snapshot %v, listing the version %v of a, and 0 of b", snap, i+1, i)
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	// the repository is reopened, adopting its block size
+	r, err = Open(filepath.Join(dir, "repo"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := r.Snapshots()
+	if err != nil || len(got) != len(snapshots) {
+		t.Fatalf("Snapshots() = %v snapshots, %v, want %v", len(got), err, len(snapshots))
+	}
+	for i := range got {
+		if got[i].ID != snapshots[i].ID || !reflect.DeepEqual(got[i].Files, snapshots[i].Files) {
+			t.Errorf("Snapshots()[%v] = %+v, want %+v", i, got[i], snapshots[i])
+		}
+	}
+	vs, err := r.Versions(a)
+	if err != nil || len(vs) != len(versions) || vs[3].Size != int64(len(versions[3])) || !vs[2].ModTime.Equal(time.Unix(20, 0)) {
+		t.Errorf("Versions() = %+v, %v, want %v versions", vs, err, len(versions))
+	}
+	for i, want := range versions {
+		var out bytes.Buffer
+		if err := r.Materialize(a, i, &out); err != nil || !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("Materialize(a, %v) error = %v, equal %v", i, err, bytes.Equal(out.Bytes(), want))
+		}
+	}
+	var out bytes.Buffer
+	if err := r.Materialize(b, 0, &out); err != nil || out.String() != "b content" {
+		t.Errorf("Materialize(b, 0) = %q, %v, want %q", out.String(), err, "b content")
+	}
+	// the deltas are stored, not the full versions, and only the latest signature is kept
+	files, err := filepath.Glob(filepath.Join(r.fileDir(a), "*"))
+	if err != nil || len(files) != 1+3+1+1 {
+		t.Errorf("the repository holds the files %v for a, %v, want the full copy, 3 deltas, a signature and the meta", files, err)
+	}
+	tmp, err := os.ReadDir(filepath.Join(dir, "repo", tmpDir))
+	if err != nil || len(tmp) != 0 {
+		t.Errorf("the repository holds %v temporary files, %v, want none", len(tmp), err)
+	}
+}
+
+func TestRepo_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Open(filepath.Join(dir, "new"), 0); err == nil {
+		t.Error("Open() of a new repository without a block size error = nil, want non-nil")
+	}
+	r, err := Open(filepath.Join(dir, "repo"), testBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(filepath.Join(dir, "repo"), 2*testBlockSize); err == nil {
+		t.Error("Open() with another block size error = nil, want non-nil")
+	}
+	p := filepath.Join(dir, "file")
+	writeVersion(t, p, []byte("content"), time.Unix(1000, 0))
+	if _, err := r.Snapshot(p, filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Snapshot() of a missing file error = %v, want %v", err, fs.ErrNotExist)
+	}
+	if snapshots, err := r.Snapshots(); err != nil || len(snapshots) != 0 {
+		t.Errorf("Snapshots() = %v, %v, want none after a failed snapshot", snapshots, err)
+	}
+	if err := r.Materialize(p, 1, &bytes.Buffer{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Materialize() of a missing version error = %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := r.Versions(filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Versions() of a file which is not backed up error = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestRepo_FullCopies(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "file")
+	big := bytes.Repeat([]byte("0123456789abcdef"), 3*testBlockSize/16)
+	versions := [][]byte{[]byte("small"), big, append(bytes.Clone(big), "more"...), []byte("tiny"), big}
+	r, err := Open(filepath.Join(dir, "repo"), testBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range versions {
+		writeVersion(t, p, v, time.Unix(int64(i)*10, 0))
+		if _, err := r.Snapshot(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	vs, err := r.Versions(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the versions following the ones spanning a single block don't have a signature to be a delta against
+	wantFull := []bool{true, true, false, false, true}
+	for i, want := range versions {
+		if vs[i].Full != wantFull[i] {
+			t.Errorf("the version %v is full = %v, want %v", i, vs[i].Full, wantFull[i])
+		}
+		var out bytes.Buffer
+		if err := r.Materialize(p, i, &out); err != nil || !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("Materialize(%v) error = %v, equal %v", i, err, bytes.Equal(out.Bytes(), want))
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package rollsum
+
+// M is the modulo for the Adler32 hash computation
+const M = 65521
+
+// Adler32 is the rsync like Adler32 rolling checksum, computed over a sliding window.
+type Adler32 struct {
+	// component of Adler32 sum
+	a uint32
+	// component of Adler32 sum
+	b uint32
+	// component of Adler32 sum, the window size
+	// it's cheaper to store it instead of computing it every time, based on the window
+	n uint32
+	// the window for the rolling hash computation, implemented as a circular buffer with head pointing to the oldest byte
+	window []byte
+	head   int
+}
+
+// NewAdler32 constructs an Adler32 rolling hash and returns a pointer to it.
+func NewAdler32() *Adler32 {
+	rol := Adler32{
+		a: 1,
+		b: 0,
+	}
+
+	return &rol
+}
+
+// WriteAll writes p []byte to the window.
+// As the window is a circular buffer of fixed size, successive calls will overwrite each other's data.
+func (r *Adler32) WriteAll(p []byte) {
+	bufSize := len(p)
+	if bufSize == 0 {
+		return
+	}
+	if bufSize != int(r.n) {
+		r.window = make([]byte, bufSize)
+		r.n = uint32(bufSize)
+	}
+	copy(r.window, p)
+	r.head = 0
+
+	r.a, r.b = adler32Update(1, 0, p)
+}
+
+// Roll adds a new byte to the window, removes the oldest one, and computes the new hash components(a, b)
+// Roll returns the removed/'popped out' byte.
+// It panics if the window is not initialized, so before any Roll call, there should be at least one WriteAll call.
+func (r *Adler32) Roll(b byte) byte {
+	enter := uint32(b)
+	l := r.window[r.head]
+	leave := uint32(l)
+
+	r.window[r.head] = b
+	r.head++
+	if r.head == len(r.window) {
+		r.head = 0
+	}
+
+	r.a = (r.a + M + enter - leave) % M
+	r.b = (r.b + (r.n*leave/M+1)*M + r.a - (r.n * leave) - 1) % M
+
+	return l
+}
+
+// Sum32 computes the Adler32 sum for the window
+func (r *Adler32) Sum32() uint32 {
+	return r.b<<16 | r.a&0xffff
+}
+
+// Sum returns the Adler32 sum for the window, zero extended
+func (r *Adler32) Sum() uint64 {
+	return uint64(r.Sum32())
+}
+
+// WindowLen returns the window size, which is the size of the last WriteAll input, 0 if there was none.
+func (r *Adler32) WindowLen() int {
+	return int(r.n)
+}
+
+// Reset resets the internal state
+func (r *Adler32) Reset() {
+	r.a = 1
+	r.b = 0
+	r.n = 0
+	r.window = nil
+	r.head = 0
+}
+
+// GetWindowContent returns the data from the internal rolling window.
+// It allocates a new slice on every call, see AppendWindowContent for an allocation free alternative.
+func (r *Adler32) GetWindowContent() []byte {
+	if r.window == nil {
+		return nil
+	}
+
+	return r.AppendWindowContent(make([]byte, 0, r.n))
+}
+
+// AppendWindowContent appends the data from the internal rolling window to dst and returns the extended buffer.
+// It doesn't allocate if dst has enough capacity to hold the window.
+func (r *Adler32) AppendWindowContent(dst []byte) []byte {
+	dst = append(dst, r.window[r.head:]...)
+
+	return append(dst, r.window[:r.head]...)
+}
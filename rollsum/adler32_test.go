@@ -1,4 +1,4 @@
-package rdiff
+package rollsum
 
 import (
 	"bytes"
@@ -63,7 +63,7 @@ func sum32ByAdlerByWriteAndRoll(b []byte) uint32 {
 	q := []byte("\x00")
 	q = append(q, b...)
 
-	rollingHasher := newAdler32RollingHash()
+	rollingHasher := NewAdler32()
 	rollingHasher.WriteAll(q[:len(q)-1])
 	rollingHasher.Roll(q[len(q)-1])
 
@@ -142,7 +142,7 @@ var testGetWindowContent = []struct {
 
 // TestAdler32RollingHash_GetWindowContent tests both Reset and GetWindowContent.
 func TestAdler32RollingHash_GetWindowContent(t *testing.T) {
-	rh := newAdler32RollingHash()
+	rh := NewAdler32()
 	for _, g := range testGetWindowContent {
 		inp := g.in
 
@@ -165,7 +165,7 @@ func BenchmarkRolling64B(b *testing.B) {
 		window[i] = byte(i)
 	}
 
-	h := newAdler32RollingHash()
+	h := NewAdler32()
 	h.WriteAll(window)
 
 	b.ResetTimer()
@@ -174,3 +174,45 @@ func BenchmarkRolling64B(b *testing.B) {
 		h.Sum32()
 	}
 }
+
+func BenchmarkWriteAll4KB(b *testing.B) {
+	b.SetBytes(4096)
+	b.ReportAllocs()
+	block := make([]byte, 4096)
+	for i := range block {
+		block[i] = byte(i)
+	}
+
+	h := NewAdler32()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.WriteAll(block)
+		h.Sum32()
+	}
+}
+
+// TestAdler32RollingHash_AppendWindowContent checks the window content and that a buffer with enough capacity
+// is reused, without allocations.
+func TestAdler32RollingHash_AppendWindowContent(t *testing.T) {
+	rh := NewAdler32()
+	for _, g := range testGetWindowContent {
+		inp := g.in
+
+		rh.Reset()
+		rh.WriteAll(inp.write)
+		for _, v := range inp.roll {
+			rh.Roll(v)
+		}
+		buf := make([]byte, 0, len(inp.write))
+		if got := rh.AppendWindowContent(buf); !bytes.Equal(got, g.out) {
+			t.Errorf("AppendWindowContent(): expected %v, got %v", g.out, got)
+		}
+		allocs := testing.AllocsPerRun(10, func() {
+			buf = rh.AppendWindowContent(buf[:0])
+		})
+		if allocs != 0 {
+			t.Errorf("AppendWindowContent(): expected 0 allocations, got %v", allocs)
+		}
+	}
+}
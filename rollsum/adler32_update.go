@@ -0,0 +1,59 @@
+package rollsum
+
+import "encoding/binary"
+
+// adler32NMax is the largest n such that 255n(n+1)/2 + (n+1)(M-1) <= 2^32-1, and it's also a multiple of 16.
+// It's the number of bytes that can be processed before applying the modulo, without overflowing uint32.
+const adler32NMax = 5552
+
+const (
+	// adler32LaneMask selects the even bytes of a 64 bits word into 4 lanes of 16 bits
+	adler32LaneMask = 0x00ff00ff00ff00ff
+	// adler32LaneSum multiplied with a lanes word, sums all the lanes into the top lane
+	adler32LaneSum = 0x0001000100010001
+	// adler32EvenWeights multiplied with the even bytes lanes, sums them weighted by 8, 6, 4, 2 into the top lane
+	adler32EvenWeights = 0x0008000600040002
+	// adler32OddWeights multiplied with the odd bytes lanes, sums them weighted by 7, 5, 3, 1 into the top lane
+	adler32OddWeights = 0x0007000500030001
+)
+
+// adler32Update updates the Adler32 components(a, b) with p and returns them.
+// The bytes are processed 16 at a time, with the modulo deferred for adler32NMax bytes: for every 8 bytes word,
+// a contributes 8 times to b and the i-th byte contributes (8-i) times, and both the sum and the weighted sum
+// of the bytes are computed in parallel, using 16 bits lanes of a 64 bits word(SWAR), so the sequential
+// dependency between the components is resolved once per chunk, instead of once per byte.
+func adler32Update(a, b uint32, p []byte) (uint32, uint32) {
+	for len(p) > 0 {
+		var q []byte
+		if len(p) > adler32NMax {
+			p, q = p[:adler32NMax], p[adler32NMax:]
+		}
+		for len(p) >= 16 {
+			x1, x2 := binary.LittleEndian.Uint64(p), binary.LittleEndian.Uint64(p[8:])
+			s11, s21 := adler32Word(x1)
+			s12, s22 := adler32Word(x2)
+			b += 16*a + 8*s11 + s21 + s22
+			a += s11 + s12
+			p = p[16:]
+		}
+		for _, x := range p {
+			a += uint32(x)
+			b += a
+		}
+		a %= M
+		b %= M
+		p = q
+	}
+
+	return a, b
+}
+
+// adler32Word returns the sum of the 8 bytes of x and their sum weighted by 8, 7, ..., 1, in little endian order.
+// Every lane sum fits in 16 bits(255*(8+6+4+2) < 1<<16), so the lanes never overflow into each other.
+func adler32Word(x uint64) (uint32, uint32) {
+	even, odd := x&adler32LaneMask, (x>>8)&adler32LaneMask
+	s1 := uint32(((even + odd) * adler32LaneSum) >> 48)
+	s2 := uint32((even*adler32EvenWeights)>>48) + uint32((odd*adler32OddWeights)>>48)
+
+	return s1, s2
+}
@@ -0,0 +1,55 @@
+package rollsum
+
+import (
+	"hash/adler32"
+	"math/rand"
+	"testing"
+)
+
+// TestAdler32Update checks the unrolled implementation against the standard library, for lengths covering
+// partial chunks, full chunks and the deferred modulo boundaries.
+func TestAdler32Update(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	lengths := []int{0, 1, 15, 16, 17, 31, 32, 100, adler32NMax - 1, adler32NMax, adler32NMax + 1, 3*adler32NMax + 7, 1 << 17}
+	for _, fill := range []func(p []byte){
+		func(p []byte) { rnd.Read(p) },
+		func(p []byte) {
+			for i := range p {
+				p[i] = 0xff
+			}
+		},
+	} {
+		for _, l := range lengths {
+			p := make([]byte, l)
+			fill(p)
+			a, b := adler32Update(1, 0, p)
+			if got, want := b<<16|a, adler32.Checksum(p); got != want {
+				t.Errorf("adler32Update() for length %v = 0x%x, want 0x%x", l, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkAdler32Update4KB(b *testing.B) {
+	b.SetBytes(4096)
+	block := make([]byte, 4096)
+	for i := range block {
+		block[i] = byte(i)
+	}
+
+	for i := 0; i < b.N; i++ {
+		adler32Update(1, 0, block)
+	}
+}
+
+func BenchmarkAdler32Classic4KB(b *testing.B) {
+	b.SetBytes(4096)
+	block := make([]byte, 4096)
+	for i := range block {
+		block[i] = byte(i)
+	}
+
+	for i := 0; i < b.N; i++ {
+		adler32.Checksum(block)
+	}
+}
@@ -0,0 +1,103 @@
+package rollsum
+
+// M64 is the modulo for the Adler64 hash computation, the largest prime smaller than 2^32
+const M64 = 4294967291
+
+// adler64ChunkSize is the number of bytes processed by WriteAll before applying the modulo, small enough
+// to never overflow uint64
+const adler64ChunkSize = 1 << 16
+
+// Adler64 is a 64 bits wide Adler/Fletcher variant, with both components computed modulo M64.
+// For big blocks, the 16 bits components of Adler32 wrap around many times, producing lots of weak hash
+// false positives, each costing a strong hash computation, while the 32 bits components keep them rare.
+type Adler64 struct {
+	// component of Adler64 sum, the sum of the window bytes
+	a uint64
+	// component of Adler64 sum, the sum of the window bytes weighted by their distance to the end of the window
+	b uint64
+	// the window for the rolling hash computation, implemented as a circular buffer with head pointing to the oldest byte
+	window []byte
+	head   int
+}
+
+// NewAdler64 constructs a Adler64 rolling hash and returns a pointer to it.
+func NewAdler64() *Adler64 {
+	return &Adler64{}
+}
+
+// WriteAll writes p []byte to the window, replacing the previous window content.
+func (r *Adler64) WriteAll(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	if len(p) != len(r.window) {
+		r.window = make([]byte, len(p))
+	}
+	copy(r.window, p)
+	r.head = 0
+
+	r.a, r.b = 0, 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), adler64ChunkSize)]
+		for _, x := range chunk {
+			r.a += uint64(x)
+			r.b += r.a
+		}
+		r.a %= M64
+		r.b %= M64
+		p = p[len(chunk):]
+	}
+}
+
+// Roll adds a new byte to the window, removes the oldest one, and computes the new hash components(a, b)
+// Roll returns the removed/'popped out' byte.
+// It panics if the window is not initialized, so before any Roll call, there should be at least one WriteAll call.
+func (r *Adler64) Roll(b byte) byte {
+	leave := r.window[r.head]
+	r.window[r.head] = b
+	r.head++
+	if r.head == len(r.window) {
+		r.head = 0
+	}
+
+	r.a = (r.a + M64 - uint64(leave) + uint64(b)) % M64
+	r.b = (r.b + M64 - uint64(len(r.window))*uint64(leave)%M64 + r.a) % M64
+
+	return leave
+}
+
+// Sum computes the Adler64 sum for the window
+func (r *Adler64) Sum() uint64 {
+	return r.b<<32 | r.a
+}
+
+// WindowLen returns the window size, which is the size of the last WriteAll input, 0 if there was none.
+func (r *Adler64) WindowLen() int {
+	return len(r.window)
+}
+
+// Reset resets the internal state
+func (r *Adler64) Reset() {
+	r.a = 0
+	r.b = 0
+	r.window = nil
+	r.head = 0
+}
+
+// GetWindowContent returns the data from the internal rolling window.
+// It allocates a new slice on every call, see AppendWindowContent for an allocation free alternative.
+func (r *Adler64) GetWindowContent() []byte {
+	if r.window == nil {
+		return nil
+	}
+
+	return r.AppendWindowContent(make([]byte, 0, len(r.window)))
+}
+
+// AppendWindowContent appends the data from the internal rolling window to dst and returns the extended buffer.
+// It doesn't allocate if dst has enough capacity to hold the window.
+func (r *Adler64) AppendWindowContent(dst []byte) []byte {
+	dst = append(dst, r.window[r.head:]...)
+
+	return append(dst, r.window[:r.head]...)
+}
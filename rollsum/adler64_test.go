@@ -0,0 +1,81 @@
+package rollsum
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+var testsAdler64Roll = []struct {
+	window int
+	in     []byte
+}{
+	{window: 1, in: []byte("abcdefgh")},
+	{window: 3, in: []byte("abcdefghij")},
+	{window: 16, in: []byte("Discard medicine more than two years old.")},
+	{window: 70, in: bytes.Repeat([]byte("He who has a shady past knows that nice guys finish last."), 10)},
+	{window: 5, in: bytes.Repeat([]byte{0xff}, 100)},
+	{window: adler64ChunkSize + 3, in: bytes.Repeat([]byte{0xff, 0x00, 0x7f}, adler64ChunkSize)},
+}
+
+// TestAdler64RollingHash_Roll checks that rolling over the data produces the same hash as writing
+// the whole window from scratch.
+func TestAdler64RollingHash_Roll(t *testing.T) {
+	for _, tt := range testsAdler64Roll {
+		p := tt.in
+		rolling := NewAdler64()
+		rolling.WriteAll(p[:tt.window])
+		classic := NewAdler64()
+		for i := tt.window; i < len(p); i++ {
+			if got := rolling.Roll(p[i]); got != p[i-tt.window] {
+				t.Errorf("Roll() returned %v, want %v", got, p[i-tt.window])
+			}
+			// rehashing the big windows at every position is too slow
+			if tt.window > 1000 && i%1000 != 0 && i != len(p)-1 {
+				continue
+			}
+			classic.WriteAll(p[i-tt.window+1 : i+1])
+			if rolling.Sum() != classic.Sum() {
+				t.Errorf("window %v at %v: rolling sum 0x%x, want 0x%x", tt.window, i, rolling.Sum(), classic.Sum())
+			}
+			if got := rolling.GetWindowContent(); !bytes.Equal(got, p[i-tt.window+1:i+1]) {
+				t.Errorf("GetWindowContent() differs at %v", i)
+			}
+		}
+	}
+}
+
+// TestAdler64RollingHash_Distinct checks there are no collisions for random blocks.
+func TestAdler64RollingHash_Distinct(t *testing.T) {
+	const blocks = 1 << 13
+	rnd := rand.New(rand.NewSource(1))
+	block := make([]byte, 2048)
+	h := NewAdler64()
+	seen := make(map[uint64]struct{}, blocks)
+	for i := 0; i < blocks; i++ {
+		rnd.Read(block)
+		h.WriteAll(block)
+		seen[h.Sum()] = struct{}{}
+	}
+	if len(seen) != blocks {
+		t.Errorf("Adler64 produced %v distinct hashes for %v distinct blocks", len(seen), blocks)
+	}
+}
+
+func BenchmarkAdler64Rolling64B(b *testing.B) {
+	b.SetBytes(1024)
+	b.ReportAllocs()
+	window := make([]byte, 64)
+	for i := range window {
+		window[i] = byte(i)
+	}
+
+	h := NewAdler64()
+	h.WriteAll(window)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Roll(byte(i))
+		h.Sum()
+	}
+}
@@ -0,0 +1,108 @@
+package rollsum
+
+import "math/bits"
+
+// buzhashTable maps every byte to a pseudo random 32 bits value.
+// It's generated with a fixed seed, so it never changes between runs, versions or platforms,
+// as signatures computed with it must remain valid.
+var buzhashTable = computeBuzhashTable(0x9E3779B97F4A7C15)
+
+// Buzhash is a cyclic polynomial(buzhash) rolling hash.
+// Every byte is mixed through a substitution table, and the roll operation only needs rotations and XORs,
+// so it's cheaper than the modular arithmetic of Adler32, while having a better mixing per byte.
+type Buzhash struct {
+	digest uint32
+	// the window for the rolling hash computation, implemented as a circular buffer with head pointing to the oldest byte
+	window []byte
+	head   int
+}
+
+// NewBuzhash constructs a Buzhash rolling hash and returns a pointer to it.
+func NewBuzhash() *Buzhash {
+	return &Buzhash{}
+}
+
+// WriteAll writes p []byte to the window, replacing the previous window content.
+func (r *Buzhash) WriteAll(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	if len(p) != len(r.window) {
+		r.window = make([]byte, len(p))
+	}
+	copy(r.window, p)
+	r.head = 0
+
+	r.digest = 0
+	for _, b := range p {
+		r.digest = bits.RotateLeft32(r.digest, 1) ^ buzhashTable[b]
+	}
+}
+
+// Roll adds a new byte to the window, removes the oldest one, and recomputes the hash.
+// Roll returns the removed/'popped out' byte.
+// It panics if the window is not initialized, so before any Roll call, there should be at least one WriteAll call.
+func (r *Buzhash) Roll(b byte) byte {
+	leave := r.window[r.head]
+	r.window[r.head] = b
+	r.head = (r.head + 1) % len(r.window)
+
+	// the oldest byte was rotated once for every byte written after it, so len(window) times after this roll
+	r.digest = bits.RotateLeft32(r.digest, 1) ^ bits.RotateLeft32(buzhashTable[leave], len(r.window)) ^ buzhashTable[b]
+
+	return leave
+}
+
+// Sum32 returns the hash of the window content
+func (r *Buzhash) Sum32() uint32 {
+	return r.digest
+}
+
+// Sum returns the hash of the window content, zero extended
+func (r *Buzhash) Sum() uint64 {
+	return uint64(r.digest)
+}
+
+// WindowLen returns the window size, which is the size of the last WriteAll input, 0 if there was none.
+func (r *Buzhash) WindowLen() int {
+	return len(r.window)
+}
+
+// Reset resets the internal state
+func (r *Buzhash) Reset() {
+	r.digest = 0
+	r.window = nil
+	r.head = 0
+}
+
+// GetWindowContent returns the data from the internal rolling window.
+// It allocates a new slice on every call, see AppendWindowContent for an allocation free alternative.
+func (r *Buzhash) GetWindowContent() []byte {
+	if r.window == nil {
+		return nil
+	}
+
+	return r.AppendWindowContent(make([]byte, 0, len(r.window)))
+}
+
+// AppendWindowContent appends the data from the internal rolling window to dst and returns the extended buffer.
+// It doesn't allocate if dst has enough capacity to hold the window.
+func (r *Buzhash) AppendWindowContent(dst []byte) []byte {
+	dst = append(dst, r.window[r.head:]...)
+
+	return append(dst, r.window[:r.head]...)
+}
+
+// computeBuzhashTable generates the substitution table using the splitmix64 generator.
+func computeBuzhashTable(seed uint64) [256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		seed += 0x9E3779B97F4A7C15
+		z := seed
+		z = (z ^ z>>30) * 0xBF58476D1CE4E5B9
+		z = (z ^ z>>27) * 0x94D049BB133111EB
+		t[i] = uint32(z ^ z>>31)
+	}
+
+	return t
+}
@@ -0,0 +1,79 @@
+package rollsum
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testsBuzhashRoll = []struct {
+	window int
+	in     string
+}{
+	{window: 1, in: "abcdefgh"},
+	{window: 3, in: "abcdefghij"},
+	{window: 16, in: "Discard medicine more than two years old."},
+	{window: 32, in: string(bytes.Repeat([]byte("I wouldn't marry him with a ten foot pole."), 5))},
+	{window: 70, in: string(bytes.Repeat([]byte("He who has a shady past knows that nice guys finish last."), 10))},
+	{window: 5, in: string(bytes.Repeat([]byte{0xff}, 100))},
+}
+
+// TestBuzhashRollingHash_Roll checks that rolling over the data produces the same hash as writing
+// the whole window from scratch, at every position.
+func TestBuzhashRollingHash_Roll(t *testing.T) {
+	for _, tt := range testsBuzhashRoll {
+		p := []byte(tt.in)
+		rolling := NewBuzhash()
+		rolling.WriteAll(p[:tt.window])
+		classic := NewBuzhash()
+		for i := tt.window; i < len(p); i++ {
+			if got := rolling.Roll(p[i]); got != p[i-tt.window] {
+				t.Errorf("Roll() returned %v, want %v", got, p[i-tt.window])
+			}
+			classic.WriteAll(p[i-tt.window+1 : i+1])
+			if rolling.Sum32() != classic.Sum32() {
+				t.Errorf("window %v at %v: rolling sum 0x%x, want 0x%x", tt.window, i, rolling.Sum32(), classic.Sum32())
+			}
+			if got := rolling.GetWindowContent(); !bytes.Equal(got, p[i-tt.window+1:i+1]) {
+				t.Errorf("GetWindowContent() = %v, want %v", got, p[i-tt.window+1:i+1])
+			}
+		}
+	}
+}
+
+// TestBuzhashTable guards against accidental changes of the substitution table, which would invalidate
+// every existing buzhash signature.
+func TestBuzhashTable(t *testing.T) {
+	if buzhashTable[0] != 0xa1b965f4 || buzhashTable[255] != 0xb7c7534d {
+		t.Errorf("buzhashTable changed: [0] = 0x%x, [255] = 0x%x", buzhashTable[0], buzhashTable[255])
+	}
+	h := NewBuzhash()
+	h.WriteAll([]byte("abcdefghij"))
+	if got, want := h.Sum32(), uint32(0xb40e672a); got != want {
+		t.Errorf("Sum32() = 0x%x, want 0x%x", got, want)
+	}
+	seen := make(map[uint32]struct{}, len(buzhashTable))
+	for _, v := range buzhashTable {
+		seen[v] = struct{}{}
+	}
+	if len(seen) != len(buzhashTable) {
+		t.Errorf("buzhashTable contains %v distinct values, want %v", len(seen), len(buzhashTable))
+	}
+}
+
+func BenchmarkBuzhashRolling64B(b *testing.B) {
+	b.SetBytes(1024)
+	b.ReportAllocs()
+	window := make([]byte, 64)
+	for i := range window {
+		window[i] = byte(i)
+	}
+
+	h := NewBuzhash()
+	h.WriteAll(window)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Roll(byte(i))
+		h.Sum32()
+	}
+}
@@ -0,0 +1,127 @@
+package rollsum
+
+import "hash/crc32"
+
+// crc32cTable is the Castagnoli polynomial table, the standard library uses the SSE4.2/ARMv8 CRC instructions
+// for it, where available
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CRC32C is a CRC32C(Castagnoli) checksum, computed over a sliding window.
+// The full window(block) checksum is delegated to the standard library, which is hardware accelerated on most
+// platforms, making it the fastest option when rolling is not needed, ex: for the signature computation.
+// The checksum is the raw CRC, without the initial and final inversions, as it makes it linear, so rolling
+// is only about removing the oldest byte's contribution.
+type CRC32C struct {
+	digest uint32
+	// the window for the rolling hash computation, implemented as a circular buffer with head pointing to the oldest byte
+	window []byte
+	head   int
+	// outTable removes the contribution of the oldest byte from the digest, and it depends on the window size,
+	// so it's recomputed only when the window size changes
+	outTable [256]uint32
+}
+
+// NewCRC32C constructs a CRC32C rolling hash and returns a pointer to it.
+func NewCRC32C() *CRC32C {
+	return &CRC32C{}
+}
+
+// WriteAll writes p []byte to the window, replacing the previous window content.
+func (r *CRC32C) WriteAll(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	if len(p) != len(r.window) {
+		r.window = make([]byte, len(p))
+		r.outTable = computeCRC32COutTable(len(p))
+	}
+	copy(r.window, p)
+	r.head = 0
+
+	r.digest = crc32cRaw(p)
+}
+
+// Roll adds a new byte to the window, removes the oldest one, and recomputes the checksum.
+// Roll returns the removed/'popped out' byte.
+// It panics if the window is not initialized, so before any Roll call, there should be at least one WriteAll call.
+func (r *CRC32C) Roll(b byte) byte {
+	leave := r.window[r.head]
+	r.window[r.head] = b
+	r.head++
+	if r.head == len(r.window) {
+		r.head = 0
+	}
+
+	r.digest = crc32cTable[byte(r.digest)^b] ^ r.digest>>8 ^ r.outTable[leave]
+
+	return leave
+}
+
+// Sum32 returns the raw CRC32C checksum of the window content
+func (r *CRC32C) Sum32() uint32 {
+	return r.digest
+}
+
+// Sum returns the raw CRC32C checksum of the window content, zero extended
+func (r *CRC32C) Sum() uint64 {
+	return uint64(r.digest)
+}
+
+// WindowLen returns the window size, which is the size of the last WriteAll input, 0 if there was none.
+func (r *CRC32C) WindowLen() int {
+	return len(r.window)
+}
+
+// Reset resets the internal state
+func (r *CRC32C) Reset() {
+	r.digest = 0
+	r.window = nil
+	r.head = 0
+}
+
+// GetWindowContent returns the data from the internal rolling window.
+// It allocates a new slice on every call, see AppendWindowContent for an allocation free alternative.
+func (r *CRC32C) GetWindowContent() []byte {
+	if r.window == nil {
+		return nil
+	}
+
+	return r.AppendWindowContent(make([]byte, 0, len(r.window)))
+}
+
+// AppendWindowContent appends the data from the internal rolling window to dst and returns the extended buffer.
+// It doesn't allocate if dst has enough capacity to hold the window.
+func (r *CRC32C) AppendWindowContent(dst []byte) []byte {
+	dst = append(dst, r.window[r.head:]...)
+
+	return append(dst, r.window[:r.head]...)
+}
+
+// crc32cRaw computes the CRC32C of p, without the initial and final inversions.
+// crc32.Update inverts the crc both before and after the computation, so passing an inverted zero value and
+// inverting the result undoes them.
+func crc32cRaw(p []byte) uint32 {
+	return ^crc32.Update(^uint32(0), crc32cTable, p)
+}
+
+// computeCRC32COutTable computes, for every byte b, the raw CRC32C of b followed by windowSize zero bytes,
+// which is the contribution of the oldest byte of a window, after a new byte was appended.
+// The raw CRC is linear, so only the 8 single bit bytes are actually hashed, and the others are combined from them.
+func computeCRC32COutTable(windowSize int) [256]uint32 {
+	var t [256]uint32
+	buf := make([]byte, windowSize+1)
+	for bit := 0; bit < 8; bit++ {
+		buf[0] = 1 << bit
+		t[1<<bit] = crc32cRaw(buf)
+	}
+	for b := range t {
+		if b&(b-1) == 0 {
+			continue
+		}
+		// the lowest set bit, combined with the already computed remaining bits
+		low := b & -b
+		t[b] = t[low] ^ t[b^low]
+	}
+
+	return t
+}
@@ -0,0 +1,89 @@
+package rollsum
+
+import (
+	"bytes"
+	"hash/crc32"
+	"testing"
+)
+
+var testsCRC32CRoll = []struct {
+	window int
+	in     []byte
+}{
+	{window: 1, in: []byte("abcdefgh")},
+	{window: 3, in: []byte("abcdefghij")},
+	{window: 16, in: []byte("Discard medicine more than two years old.")},
+	{window: 70, in: bytes.Repeat([]byte("He who has a shady past knows that nice guys finish last."), 10)},
+	{window: 5, in: bytes.Repeat([]byte{0xff}, 100)},
+}
+
+// TestCRC32CRollingHash_Roll checks that rolling over the data produces the same checksum as writing
+// the whole window from scratch, at every position.
+func TestCRC32CRollingHash_Roll(t *testing.T) {
+	for _, tt := range testsCRC32CRoll {
+		p := tt.in
+		rolling := NewCRC32C()
+		rolling.WriteAll(p[:tt.window])
+		classic := NewCRC32C()
+		for i := tt.window; i < len(p); i++ {
+			if got := rolling.Roll(p[i]); got != p[i-tt.window] {
+				t.Errorf("Roll() returned %v, want %v", got, p[i-tt.window])
+			}
+			classic.WriteAll(p[i-tt.window+1 : i+1])
+			if rolling.Sum32() != classic.Sum32() {
+				t.Errorf("window %v at %v: rolling sum 0x%x, want 0x%x", tt.window, i, rolling.Sum32(), classic.Sum32())
+			}
+			if got := rolling.GetWindowContent(); !bytes.Equal(got, p[i-tt.window+1:i+1]) {
+				t.Errorf("GetWindowContent() = %v, want %v", got, p[i-tt.window+1:i+1])
+			}
+		}
+	}
+}
+
+// TestCRC32CRaw checks the raw checksum against the standard CRC32C, which only adds the initial and final inversions.
+func TestCRC32CRaw(t *testing.T) {
+	p := []byte("The days of the digital watch are numbered.  -Tom Stoppard")
+	// the raw CRC of the inverted first 4 bytes equals the standard CRC, without the final inversion
+	q := bytes.Clone(p)
+	for i := 0; i < 4; i++ {
+		q[i] = ^q[i]
+	}
+	if got, want := crc32cRaw(q), ^crc32.Checksum(p, crc32.MakeTable(crc32.Castagnoli)); got != want {
+		t.Errorf("crc32cRaw() = 0x%x, want 0x%x", got, want)
+	}
+}
+
+func BenchmarkCRC32CWriteAll4KB(b *testing.B) {
+	b.SetBytes(4096)
+	b.ReportAllocs()
+	block := make([]byte, 4096)
+	for i := range block {
+		block[i] = byte(i)
+	}
+
+	h := NewCRC32C()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.WriteAll(block)
+		h.Sum()
+	}
+}
+
+func BenchmarkCRC32CRolling64B(b *testing.B) {
+	b.SetBytes(1024)
+	b.ReportAllocs()
+	window := make([]byte, 64)
+	for i := range window {
+		window[i] = byte(i)
+	}
+
+	h := NewCRC32C()
+	h.WriteAll(window)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Roll(byte(i))
+		h.Sum()
+	}
+}
@@ -0,0 +1,95 @@
+package rollsum
+
+// librsyncCharOffset is added to every byte by the librsync rolling checksum
+const librsyncCharOffset = 31
+
+// Librsync is the librsync rolling checksum(rollsum), the rsync checksum with a byte offset, computed over
+// a sliding window. It's the weak hash of the librsync signatures with the MD4 and BLAKE2 magics.
+type Librsync struct {
+	// the checksum components, librsync keeps them modulo 2^16
+	s1 uint16
+	s2 uint16
+	// the window for the rolling hash computation, implemented as a circular buffer with head pointing to the oldest byte
+	window []byte
+	head   int
+}
+
+// NewLibrsync constructs a librsync rolling checksum and returns a pointer to it.
+func NewLibrsync() *Librsync {
+	return &Librsync{}
+}
+
+// WriteAll writes p []byte to the window, replacing the previous window content.
+func (r *Librsync) WriteAll(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	if len(p) != len(r.window) {
+		r.window = make([]byte, len(p))
+	}
+	copy(r.window, p)
+	r.head = 0
+
+	r.s1, r.s2 = 0, 0
+	for _, b := range p {
+		r.s1 += uint16(b) + librsyncCharOffset
+		r.s2 += r.s1
+	}
+}
+
+// Roll adds a new byte to the window, removes the oldest one, and recomputes the checksum.
+// Roll returns the removed/'popped out' byte.
+// It panics if the window is not initialized, so before any Roll call, there should be at least one WriteAll call.
+func (r *Librsync) Roll(b byte) byte {
+	leave := r.window[r.head]
+	r.window[r.head] = b
+	r.head++
+	if r.head == len(r.window) {
+		r.head = 0
+	}
+
+	r.s1 += uint16(b) - uint16(leave)
+	r.s2 += r.s1 - uint16(len(r.window))*(uint16(leave)+librsyncCharOffset)
+
+	return leave
+}
+
+// Sum32 returns the checksum of the window, as librsync computes it
+func (r *Librsync) Sum32() uint32 {
+	return uint32(r.s2)<<16 | uint32(r.s1)
+}
+
+// Sum returns the checksum of the window, zero extended
+func (r *Librsync) Sum() uint64 {
+	return uint64(r.Sum32())
+}
+
+// WindowLen returns the window size, which is the size of the last WriteAll input, 0 if there was none.
+func (r *Librsync) WindowLen() int {
+	return len(r.window)
+}
+
+// Reset resets the internal state
+func (r *Librsync) Reset() {
+	r.s1, r.s2 = 0, 0
+	r.window = nil
+	r.head = 0
+}
+
+// GetWindowContent returns the data from the internal rolling window.
+// It allocates a new slice on every call, see AppendWindowContent for an allocation free alternative.
+func (r *Librsync) GetWindowContent() []byte {
+	if r.window == nil {
+		return nil
+	}
+
+	return r.AppendWindowContent(make([]byte, 0, len(r.window)))
+}
+
+// AppendWindowContent appends the data from the internal rolling window to dst and returns the extended buffer.
+// It doesn't allocate if dst has enough capacity to hold the window.
+func (r *Librsync) AppendWindowContent(dst []byte) []byte {
+	dst = append(dst, r.window[r.head:]...)
+
+	return append(dst, r.window[:r.head]...)
+}
@@ -0,0 +1,57 @@
+package rollsum
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testsLibrsyncRoll = []struct {
+	window int
+	in     []byte
+}{
+	{window: 1, in: []byte("abcdefgh")},
+	{window: 3, in: []byte("abcdefghij")},
+	{window: 16, in: []byte("Discard medicine more than two years old.")},
+	{window: 70, in: bytes.Repeat([]byte("He who has a shady past knows that nice guys finish last."), 10)},
+	{window: 5, in: bytes.Repeat([]byte{0xff}, 100)},
+}
+
+// TestLibrsyncRollingHash_Roll checks that rolling over the data produces the same hash as writing
+// the whole window from scratch, at every position.
+func TestLibrsyncRollingHash_Roll(t *testing.T) {
+	for _, tt := range testsLibrsyncRoll {
+		p := tt.in
+		rolling := NewLibrsync()
+		rolling.WriteAll(p[:tt.window])
+		classic := NewLibrsync()
+		for i := tt.window; i < len(p); i++ {
+			if got := rolling.Roll(p[i]); got != p[i-tt.window] {
+				t.Errorf("Roll() returned %v, want %v", got, p[i-tt.window])
+			}
+			classic.WriteAll(p[i-tt.window+1 : i+1])
+			if rolling.Sum32() != classic.Sum32() {
+				t.Errorf("window %v at %v: rolling sum 0x%x, want 0x%x", tt.window, i, rolling.Sum32(), classic.Sum32())
+			}
+			if got := rolling.GetWindowContent(); !bytes.Equal(got, p[i-tt.window+1:i+1]) {
+				t.Errorf("GetWindowContent() = %v, want %v", got, p[i-tt.window+1:i+1])
+			}
+		}
+	}
+}
+
+// TestLibrsync_Sum32 checks the hash against values computed with the librsync definition.
+func TestLibrsync_Sum32(t *testing.T) {
+	for _, tt := range []struct {
+		out uint32
+		in  string
+	}{
+		{0x03040183, "abc"},
+		{0xa71413f8, "Discard medicine more than two years old."},
+	} {
+		h := NewLibrsync()
+		h.WriteAll([]byte(tt.in))
+		if got := h.Sum32(); got != tt.out {
+			t.Errorf("Sum32(%q) = 0x%x, want 0x%x", tt.in, got, tt.out)
+		}
+	}
+}
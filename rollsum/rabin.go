@@ -0,0 +1,176 @@
+package rollsum
+
+import "math/bits"
+
+// rabinPolynomial is an irreducible polynomial of degree 53 over GF(2), used as the Rabin fingerprint modulus.
+const rabinPolynomial = 0x3DA3358B4DC173
+
+// rabinDegree is the degree of rabinPolynomial
+const rabinDegree = 53
+
+// rabinShift is used to extract the byte "overflowing" the polynomial degree after appending a new byte
+const rabinShift = rabinDegree - 8
+
+// rabinModTable is used to reduce the fingerprint modulo rabinPolynomial, when appending a byte.
+// It only depends on the polynomial, so it's computed once.
+var rabinModTable = computeRabinModTable()
+
+// Rabin is a Rabin fingerprint, computed over a sliding window, using polynomial arithmetic over GF(2).
+// Compared to Adler32 it has a much better distribution for small windows, so it produces fewer spurious weak hash hits.
+type Rabin struct {
+	digest uint64
+	// the window for the rolling hash computation, implemented as a circular buffer with head pointing to the oldest byte
+	window []byte
+	head   int
+	// outTable removes the contribution of the oldest byte from the digest, and it depends on the window size,
+	// so it's recomputed only when the window size changes
+	outTable [256]uint64
+}
+
+// NewRabin constructs a Rabin rolling hash and returns a pointer to it.
+func NewRabin() *Rabin {
+	return &Rabin{}
+}
+
+// WriteAll writes p []byte to the window, replacing the previous window content.
+func (r *Rabin) WriteAll(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	if len(p) != len(r.window) {
+		r.window = make([]byte, len(p))
+		r.outTable = computeRabinOutTable(len(p))
+	}
+	copy(r.window, p)
+	r.head = 0
+
+	r.digest = 0
+	for _, b := range p {
+		r.digest = rabinAppend(r.digest, b)
+	}
+}
+
+// Roll adds a new byte to the window, removes the oldest one, and recomputes the fingerprint.
+// Roll returns the removed/'popped out' byte.
+// It panics if the window is not initialized, so before any Roll call, there should be at least one WriteAll call.
+func (r *Rabin) Roll(b byte) byte {
+	leave := r.window[r.head]
+	r.window[r.head] = b
+	r.head = (r.head + 1) % len(r.window)
+
+	r.digest ^= r.outTable[leave]
+	r.digest = rabinAppend(r.digest, b)
+
+	return leave
+}
+
+// Sum32 folds the fingerprint to 32 bits
+func (r *Rabin) Sum32() uint32 {
+	return uint32(r.digest) ^ uint32(r.digest>>32)
+}
+
+// Sum returns the 32 bits folded fingerprint, zero extended
+func (r *Rabin) Sum() uint64 {
+	return uint64(r.Sum32())
+}
+
+// WindowLen returns the window size, which is the size of the last WriteAll input, 0 if there was none.
+func (r *Rabin) WindowLen() int {
+	return len(r.window)
+}
+
+// Reset resets the internal state
+func (r *Rabin) Reset() {
+	r.digest = 0
+	r.window = nil
+	r.head = 0
+}
+
+// GetWindowContent returns the data from the internal rolling window.
+// It allocates a new slice on every call, see AppendWindowContent for an allocation free alternative.
+func (r *Rabin) GetWindowContent() []byte {
+	if r.window == nil {
+		return nil
+	}
+
+	return r.AppendWindowContent(make([]byte, 0, len(r.window)))
+}
+
+// AppendWindowContent appends the data from the internal rolling window to dst and returns the extended buffer.
+// It doesn't allocate if dst has enough capacity to hold the window.
+func (r *Rabin) AppendWindowContent(dst []byte) []byte {
+	dst = append(dst, r.window[r.head:]...)
+
+	return append(dst, r.window[:r.head]...)
+}
+
+// rabinAppend appends a byte to the fingerprint digest, which means digest*x^8 + b mod rabinPolynomial.
+func rabinAppend(digest uint64, b byte) uint64 {
+	index := digest >> rabinShift
+	digest <<= 8
+	digest |= uint64(b)
+
+	return digest ^ rabinModTable[index]
+}
+
+func computeRabinModTable() [256]uint64 {
+	var t [256]uint64
+	for b := range t {
+		// the XOR with b<<rabinDegree clears the overflowing bits, while the mod value reduces them
+		t[b] = polMod(uint64(b)<<rabinDegree, rabinPolynomial) | uint64(b)<<rabinDegree
+	}
+
+	return t
+}
+
+// computeRabinOutTable computes b*x^(8*(windowSize-1)) mod rabinPolynomial for every byte b,
+// which is the contribution of the oldest byte of a window to the fingerprint.
+func computeRabinOutTable(windowSize int) [256]uint64 {
+	var t [256]uint64
+	// x^(8*(windowSize-1)) mod rabinPolynomial, computed by square and multiply
+	shift := uint64(1)
+	base := uint64(2)
+	for e := 8 * (windowSize - 1); e > 0; e >>= 1 {
+		if e&1 == 1 {
+			shift = polMulMod(shift, base, rabinPolynomial)
+		}
+		base = polMulMod(base, base, rabinPolynomial)
+	}
+	for b := range t {
+		t[b] = polMulMod(uint64(b), shift, rabinPolynomial)
+	}
+
+	return t
+}
+
+// polMod computes x mod p, where both are polynomials over GF(2).
+func polMod(x, p uint64) uint64 {
+	dp := polDeg(p)
+	for d := polDeg(x); d >= dp; d = polDeg(x) {
+		x ^= p << (d - dp)
+	}
+
+	return x
+}
+
+// polMulMod computes a*b mod p, where all of them are polynomials over GF(2) and a, b are already reduced modulo p.
+func polMulMod(a, b, p uint64) uint64 {
+	dp := polDeg(p)
+	var res uint64
+	for ; a > 0; a >>= 1 {
+		if a&1 == 1 {
+			res ^= b
+		}
+		b <<= 1
+		if b>>dp&1 == 1 {
+			b ^= p
+		}
+	}
+
+	return res
+}
+
+// polDeg returns the degree of the polynomial x, or -1 for the zero polynomial.
+func polDeg(x uint64) int {
+	return bits.Len64(x) - 1
+}
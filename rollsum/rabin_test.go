@@ -0,0 +1,70 @@
+package rollsum
+
+import (
+	"bytes"
+	"testing"
+)
+
+var testsRabinRoll = []struct {
+	window int
+	in     string
+}{
+	{window: 1, in: "abcdefgh"},
+	{window: 3, in: "abcdefghij"},
+	{window: 16, in: "Discard medicine more than two years old."},
+	{window: 64, in: string(bytes.Repeat([]byte("He who has a shady past knows that nice guys finish last."), 10))},
+	{window: 5, in: string(bytes.Repeat([]byte{0xff}, 100))},
+}
+
+// TestRabinRollingHash_Roll checks that rolling over the data produces the same fingerprint as writing
+// the whole window from scratch, at every position.
+func TestRabinRollingHash_Roll(t *testing.T) {
+	for _, tt := range testsRabinRoll {
+		p := []byte(tt.in)
+		rolling := NewRabin()
+		rolling.WriteAll(p[:tt.window])
+		classic := NewRabin()
+		for i := tt.window; i < len(p); i++ {
+			if got := rolling.Roll(p[i]); got != p[i-tt.window] {
+				t.Errorf("Roll() returned %v, want %v", got, p[i-tt.window])
+			}
+			classic.WriteAll(p[i-tt.window+1 : i+1])
+			if rolling.Sum32() != classic.Sum32() {
+				t.Errorf("window %v at %v: rolling sum 0x%x, want 0x%x", tt.window, i, rolling.Sum32(), classic.Sum32())
+			}
+			if got := rolling.GetWindowContent(); !bytes.Equal(got, p[i-tt.window+1:i+1]) {
+				t.Errorf("GetWindowContent() = %v, want %v", got, p[i-tt.window+1:i+1])
+			}
+		}
+	}
+}
+
+func TestRabinRollingHash_Distribution(t *testing.T) {
+	seen := make(map[uint32]struct{})
+	h := NewRabin()
+	for i := 0; i < 1<<16; i++ {
+		h.WriteAll([]byte{byte(i), byte(i >> 8)})
+		seen[h.Sum32()] = struct{}{}
+	}
+	if len(seen) != 1<<16 {
+		t.Errorf("Sum32() produced %v distinct values for %v distinct 2 bytes windows", len(seen), 1<<16)
+	}
+}
+
+func BenchmarkRabinRolling64B(b *testing.B) {
+	b.SetBytes(1024)
+	b.ReportAllocs()
+	window := make([]byte, 64)
+	for i := range window {
+		window[i] = byte(i)
+	}
+
+	h := NewRabin()
+	h.WriteAll(window)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Roll(byte(i))
+		h.Sum32()
+	}
+}
@@ -0,0 +1,100 @@
+package rollsum
+
+const (
+	// rabinKarpSeed is the hash of an empty window
+	rabinKarpSeed = 1
+	// rabinKarpMult is the multiplier of the polynomial, modulo 2^32
+	rabinKarpMult = 0x08104225
+	// rabinKarpAdj removes the seed contribution of the byte leaving the window, it's rabinKarpMult-1
+	rabinKarpAdj = 0x08104224
+)
+
+// RabinKarp is the librsync RabinKarp rolling hash, a polynomial hash modulo 2^32, computed over a sliding window.
+// It's the weak hash of the librsync signatures with the RabinKarp magics, which are the librsync default.
+type RabinKarp struct {
+	hash uint32
+	// mult is rabinKarpMult^window size, the multiplier of the byte leaving the window
+	mult uint32
+	// the window for the rolling hash computation, implemented as a circular buffer with head pointing to the oldest byte
+	window []byte
+	head   int
+}
+
+// NewRabinKarp constructs a RabinKarp rolling hash and returns a pointer to it.
+func NewRabinKarp() *RabinKarp {
+	return &RabinKarp{hash: rabinKarpSeed, mult: 1}
+}
+
+// WriteAll writes p []byte to the window, replacing the previous window content.
+func (r *RabinKarp) WriteAll(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	if len(p) != len(r.window) {
+		r.window = make([]byte, len(p))
+	}
+	copy(r.window, p)
+	r.head = 0
+
+	r.hash, r.mult = rabinKarpSeed, 1
+	for _, b := range p {
+		r.hash = r.hash*rabinKarpMult + uint32(b)
+		r.mult *= rabinKarpMult
+	}
+}
+
+// Roll adds a new byte to the window, removes the oldest one, and recomputes the hash.
+// Roll returns the removed/'popped out' byte.
+// It panics if the window is not initialized, so before any Roll call, there should be at least one WriteAll call.
+func (r *RabinKarp) Roll(b byte) byte {
+	leave := r.window[r.head]
+	r.window[r.head] = b
+	r.head++
+	if r.head == len(r.window) {
+		r.head = 0
+	}
+
+	r.hash = r.hash*rabinKarpMult + uint32(b) - r.mult*(uint32(leave)+rabinKarpAdj)
+
+	return leave
+}
+
+// Sum32 returns the hash of the window, as librsync computes it
+func (r *RabinKarp) Sum32() uint32 {
+	return r.hash
+}
+
+// Sum returns the hash of the window, zero extended
+func (r *RabinKarp) Sum() uint64 {
+	return uint64(r.Sum32())
+}
+
+// WindowLen returns the window size, which is the size of the last WriteAll input, 0 if there was none.
+func (r *RabinKarp) WindowLen() int {
+	return len(r.window)
+}
+
+// Reset resets the internal state
+func (r *RabinKarp) Reset() {
+	r.hash, r.mult = rabinKarpSeed, 1
+	r.window = nil
+	r.head = 0
+}
+
+// GetWindowContent returns the data from the internal rolling window.
+// It allocates a new slice on every call, see AppendWindowContent for an allocation free alternative.
+func (r *RabinKarp) GetWindowContent() []byte {
+	if r.window == nil {
+		return nil
+	}
+
+	return r.AppendWindowContent(make([]byte, 0, len(r.window)))
+}
+
+// AppendWindowContent appends the data from the internal rolling window to dst and returns the extended buffer.
+// It doesn't allocate if dst has enough capacity to hold the window.
+func (r *RabinKarp) AppendWindowContent(dst []byte) []byte {
+	dst = append(dst, r.window[r.head:]...)
+
+	return append(dst, r.window[:r.head]...)
+}
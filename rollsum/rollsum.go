@@ -0,0 +1,32 @@
+// Package rollsum provides rolling hashes: hashes computed over a fixed size window of bytes, which can slide
+// over the data one byte at a time, updating the hash in constant time.
+// They are the weak hashes used by rdiff to find block candidates, but they are also useful on their own,
+// ex: for content defined chunking or deduplication.
+package rollsum
+
+// RollingHash is a hash computed over a window of bytes, which can slide over the data one byte at a time.
+type RollingHash interface {
+	// WriteAll replaces the window content with p, the window size becomes len(p)
+	WriteAll(p []byte)
+	// Roll slides the window over b and returns the byte that left the window.
+	// It panics if there was no WriteAll call before it.
+	Roll(b byte) byte
+	// Sum returns the hash of the window content, 32 bits hashes are zero extended
+	Sum() uint64
+	// WindowLen returns the window size
+	WindowLen() int
+	// Reset resets the internal state
+	Reset()
+	// AppendWindowContent appends the window content, oldest byte first, to dst and returns the extended buffer
+	AppendWindowContent(dst []byte) []byte
+}
+
+var (
+	_ RollingHash = (*Adler32)(nil)
+	_ RollingHash = (*Adler64)(nil)
+	_ RollingHash = (*Rabin)(nil)
+	_ RollingHash = (*Buzhash)(nil)
+	_ RollingHash = (*CRC32C)(nil)
+	_ RollingHash = (*Librsync)(nil)
+	_ RollingHash = (*RabinKarp)(nil)
+)
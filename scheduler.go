@@ -0,0 +1,245 @@
+package rdiff
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrSchedulerClosed is returned by Scheduler.Submit once the scheduler is closed.
+var ErrSchedulerClosed = errors.New("the scheduler is closed")
+
+// JobType identifies the App call run by a Job.
+type JobType byte
+
+const (
+	// JobSignature computes the signature of Files[0], the target, to Files[1], see App.Signature
+	JobSignature JobType = iota
+	// JobDelta computes the delta of Files[1], the source, against the signature Files[0], to Files[2], see App.Delta
+	JobDelta
+	// JobPatch applies the delta Files[1] to Files[0], the target, and writes the output to Files[2], see App.Patch
+	JobPatch
+)
+
+// String returns the name of the job type.
+func (t JobType) String() string {
+	switch t {
+	case JobSignature:
+		return "signature"
+	case JobDelta:
+		return "delta"
+	case JobPatch:
+		return "patch"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// jobFiles is the number of files of every job type.
+var jobFiles = [...]int{JobSignature: 2, JobDelta: 3, JobPatch: 3}
+
+// Job is a signature, delta or patch run by a Scheduler.
+type Job struct {
+	Type JobType
+	// Files are the files of the App call, the output being the last one, see the job types
+	Files []string
+	// Priority orders the queued jobs, the higher ones running first, the jobs of the same priority running in the
+	// submission order
+	Priority int
+	// Retries is the number of times a failed job is run again, unless its error matches ErrCorrupt or
+	// ErrVerification, which would fail again, and RetryDelay is the delay of the first retry, doubled for every
+	// following one
+	Retries    int
+	RetryDelay time.Duration
+	// Done is called with the result of the job, on the goroutine of the worker which ran it, if not nil
+	Done func(JobResult)
+}
+
+// JobResult is the outcome of a job.
+type JobResult struct {
+	Job Job
+	// Err is the error of the last attempt, or the error of the context of the job, if it's done before the job
+	// completes
+	Err error
+	// Attempts is the number of times the job ran, 0 if its context was done before it started
+	Attempts int
+	// Elapsed is the time elapsed from the start of the first attempt to the end of the last one
+	Elapsed time.Duration
+}
+
+// Scheduler runs the jobs submitted to it on a bounded pool of workers, every job using its own App, so a batch
+// of files is processed concurrently, with priorities and retries, see Job.
+// It's safe for concurrent use.
+type Scheduler struct {
+	blockSize int
+	opts      []Option
+
+	mu sync.Mutex
+	// ready signals the workers waiting for a job, or for the scheduler to close
+	ready  *sync.Cond
+	queue  jobQueue
+	seq    uint64
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewScheduler constructs a Scheduler running up to workers jobs at once, workers <= 0 meaning 1, and returns
+// a pointer to it. Every job runs on an App constructed by New, using the blockSize and the opts.
+// The Scheduler must be closed, see Scheduler.Close, so its workers exit.
+func NewScheduler(workers int, blockSize int, opts ...Option) *Scheduler {
+	s := &Scheduler{blockSize: blockSize, opts: opts}
+	s.ready = sync.NewCond(&s.mu)
+	for i := 0; i < max(workers, 1); i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+
+	return s
+}
+
+// Submit queues the job, which runs once a worker is available, and the jobs of a higher priority ran. The job is
+// skipped if ctx is done before it starts, and it's not retried once ctx is done, while a running attempt completes,
+// as the App calls can't be interrupted: the result then holds the context error.
+// It returns a non-nil error if the job is not valid, or ErrSchedulerClosed if the Scheduler is closed, in which
+// cases Done is not called.
+func (s *Scheduler) Submit(ctx context.Context, job Job) error {
+	if int(job.Type) >= len(jobFiles) {
+		return fmt.Errorf("invalid job type: %v", job.Type)
+	}
+	if len(job.Files) != jobFiles[job.Type] {
+		return fmt.Errorf("the %v job expects %v files, got %v", job.Type, jobFiles[job.Type], len(job.Files))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrSchedulerClosed
+	}
+	heap.Push(&s.queue, &queuedJob{ctx: ctx, job: job, seq: s.seq})
+	s.seq++
+	s.ready.Signal()
+
+	return nil
+}
+
+// Close stops accepting jobs, and waits for the queued and the running jobs to complete.
+func (s *Scheduler) Close() {
+	s.mu.Lock()
+	s.closed = true
+	s.ready.Broadcast()
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// work runs the queued jobs, until the scheduler is closed, and its queue is empty.
+func (s *Scheduler) work() {
+	defer s.wg.Done()
+	for {
+		s.mu.Lock()
+		for s.queue.Len() == 0 && !s.closed {
+			s.ready.Wait()
+		}
+		if s.queue.Len() == 0 {
+			s.mu.Unlock()
+			return
+		}
+		q := heap.Pop(&s.queue).(*queuedJob)
+		s.mu.Unlock()
+		result := s.run(q.ctx, q.job)
+		if q.job.Done != nil {
+			q.job.Done(result)
+		}
+	}
+}
+
+// run runs the job, and its retries, and returns its result.
+func (s *Scheduler) run(ctx context.Context, job Job) JobResult {
+	result := JobResult{Job: job}
+	start := time.Now()
+	delay := job.RetryDelay
+	for {
+		if result.Err = ctx.Err(); result.Err != nil {
+			break
+		}
+		result.Attempts++
+		result.Err = s.runOnce(job)
+		if !retryable(result.Err) || result.Attempts > job.Retries {
+			break
+		}
+		if result.Err = sleepContext(ctx, delay); result.Err != nil {
+			break
+		}
+		delay *= 2
+	}
+	if result.Attempts > 0 {
+		result.Elapsed = time.Since(start)
+	}
+
+	return result
+}
+
+// runOnce runs the App call of the job, on a new App.
+func (s *Scheduler) runOnce(job Job) error {
+	a := New(s.blockSize, s.opts...)
+	f := job.Files
+	switch job.Type {
+	case JobSignature:
+		return a.Signature(f[0], f[1])
+	case JobDelta:
+		return a.Delta(f[0], f[1], f[2])
+	default:
+		return a.Patch(f[0], f[1], f[2])
+	}
+}
+
+// retryable reports whether a job which failed with err may succeed if it's run again.
+func retryable(err error) bool {
+	return err != nil && !errors.Is(err, ErrCorrupt) && !errors.Is(err, ErrVerification)
+}
+
+// sleepContext waits for d, and returns nil, or ctx.Err() if ctx is done before.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queuedJob is a job waiting for a worker, with its context, and its submission order.
+type queuedJob struct {
+	ctx context.Context
+	job Job
+	seq uint64
+}
+
+// jobQueue is a heap of the queued jobs, the highest priority first, then the first submitted one.
+type jobQueue []*queuedJob
+
+func (q jobQueue) Len() int { return len(q) }
+
+func (q jobQueue) Less(i, j int) bool {
+	if q[i].job.Priority != q[j].job.Priority {
+		return q[i].job.Priority > q[j].job.Priority
+	}
+
+	return q[i].seq < q[j].seq
+}
+
+func (q jobQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *jobQueue) Push(x any) { *q = append(*q, x.(*queuedJob)) }
+
+func (q *jobQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+
+	return last
+}
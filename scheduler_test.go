@@ -0,0 +1,158 @@
+package rdiff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestScheduler(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	for i := 0; i < 8; i++ {
+		if err := os.WriteFile(path(fmt.Sprint("target", i)), bytes.Repeat([]byte{byte(i)}, 1000+i), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewScheduler(3, 64)
+	var mu sync.Mutex
+	var results []JobResult
+	done := func(r JobResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, r)
+	}
+	for i := 0; i < 8; i++ {
+		job := Job{Type: JobSignature, Files: []string{path(fmt.Sprint("target", i)), path(fmt.Sprint("signature", i))}, Done: done}
+		if err := s.Submit(context.Background(), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	if len(results) != 8 {
+		t.Fatalf("%v jobs completed, want 8", len(results))
+	}
+	for _, r := range results {
+		if r.Err != nil || r.Attempts != 1 {
+			t.Errorf("the job %v: error = %v, attempts = %v, want 1 successful attempt", r.Job.Files, r.Err, r.Attempts)
+		}
+		f, err := os.Open(r.Job.Files[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := ReadSignature(f); err != nil {
+			t.Errorf("ReadSignature() error = %v", err)
+		}
+		f.Close()
+	}
+	if err := s.Submit(context.Background(), Job{Type: JobSignature, Files: []string{"a", "b"}}); !errors.Is(err, ErrSchedulerClosed) {
+		t.Errorf("Submit() after Close() error = %v, want %v", err, ErrSchedulerClosed)
+	}
+}
+
+func TestScheduler_Priority(t *testing.T) {
+	dir := t.TempDir()
+	s := NewScheduler(1, 64)
+	defer s.Close()
+	// the worker is held by the first job, until the other ones are queued
+	started, gate := make(chan struct{}), make(chan struct{})
+	var order []int
+	var wg sync.WaitGroup
+	submit := func(id, priority int, done func(JobResult)) {
+		t.Helper()
+		wg.Add(1)
+		job := Job{
+			Type:     JobSignature,
+			Files:    []string{filepath.Join(dir, "missing"), filepath.Join(dir, fmt.Sprint(id))},
+			Priority: priority,
+			Done: func(r JobResult) {
+				defer wg.Done()
+				if done != nil {
+					done(r)
+				}
+				order = append(order, id)
+			},
+		}
+		if err := s.Submit(context.Background(), job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	submit(0, 0, func(JobResult) {
+		close(started)
+		<-gate
+	})
+	<-started
+	submit(1, 0, nil)
+	submit(2, 5, nil)
+	submit(3, 0, nil)
+	submit(4, 5, nil)
+	close(gate)
+	wg.Wait()
+	if want := []int{0, 2, 4, 1, 3}; fmt.Sprint(order) != fmt.Sprint(want) {
+		t.Errorf("the jobs ran in the order %v, want %v", order, want)
+	}
+}
+
+func TestScheduler_Retries(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	if err := os.WriteFile(path("source"), bytes.Repeat([]byte("source"), 100), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path("corrupt"), []byte("not a signature"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		signature    string
+		wantErr      error
+		wantAttempts int
+	}{
+		{name: "missing signature", ctx: context.Background(), signature: path("missing"), wantErr: fs.ErrNotExist, wantAttempts: 3},
+		{name: "corrupt signature", ctx: context.Background(), signature: path("corrupt"), wantErr: ErrCorrupt, wantAttempts: 1},
+		{name: "canceled", ctx: canceled, signature: path("missing"), wantErr: context.Canceled, wantAttempts: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewScheduler(1, 64)
+			var result JobResult
+			job := Job{
+				Type:       JobDelta,
+				Files:      []string{tt.signature, path("source"), path(tt.name + ".delta")},
+				Retries:    2,
+				RetryDelay: 1,
+				Done:       func(r JobResult) { result = r },
+			}
+			if err := s.Submit(tt.ctx, job); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+			if !errors.Is(result.Err, tt.wantErr) || result.Attempts != tt.wantAttempts {
+				t.Errorf("result = %v, %v attempts, want %v, %v attempts", result.Err, result.Attempts, tt.wantErr, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestScheduler_SubmitErrors(t *testing.T) {
+	s := NewScheduler(1, 64)
+	defer s.Close()
+	for _, job := range []Job{
+		{Type: JobDelta, Files: []string{"a", "b"}},
+		{Type: JobType(9), Files: []string{"a", "b"}},
+	} {
+		if err := s.Submit(context.Background(), job); err == nil {
+			t.Errorf("Submit(%v) error = nil, want non-nil", job.Type)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package rdiff
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+	"unsafe"
+)
+
+const (
+	// searchListMinTagBits and searchListMaxTagBits bound the size of the first level table, which grows
+	// with the number of blocks, up to rsync's 16 bits tag
+	searchListMinTagBits = 8
+	searchListMaxTagBits = 16
+	// searchListTagMul mixes the weak hash before extracting the tag, so the buckets are evenly used,
+	// even for the 32 bits weak hashes
+	searchListTagMul = 0xD6E8FEB86659FD93
+)
+
+// searchEntry is a block reference from the second level table of the searchList
+type searchEntry struct {
+	weakHash   uint64
+	blockIndex int
+}
+
+// searchList indexes the target blocks by weak hash, using rsync's two level table: the first level maps the tag
+// (the top bits of the mixed weak hash) to a range of the second level, which holds the block references sorted
+// by tag, weak hash and block index. Compared to a map of slices, it's made of 3 allocations, regardless of the
+// number of blocks, and the entries with the same tag are contiguous in memory.
+type searchList struct {
+	// filter rejects most of the weak hashes not in blocks, cheaper than a lookup
+	filter weakHashFilter
+	// tags[t] is the index of the first entry with the tag t, and tags[t+1] is the end of its range
+	tags    []int32
+	entries []searchEntry
+	// tagShift extracts the tag from the top of a mixed weak hash
+	tagShift  uint
+	signature *signatureTable
+	// next is the lowest block index a search can match, as the delta is emitted in the target blocks order
+	next int
+}
+
+func computeSearchList(signature *signatureTable) *searchList {
+	weakHashes := signature.WeakHashes
+	tagBits := min(max(bits.Len(uint(len(weakHashes))), searchListMinTagBits), searchListMaxTagBits)
+	sl := &searchList{
+		filter:    newWeakHashFilter(weakHashes),
+		tags:      make([]int32, 1<<tagBits+1),
+		entries:   make([]searchEntry, len(weakHashes)),
+		tagShift:  uint(64 - tagBits),
+		signature: signature,
+	}
+	// counting sort by tag: count the entries per tag, turn the counts into range starts, then place the entries
+	// in the block index order, so every range is already sorted by block index
+	for _, weakHash := range weakHashes {
+		sl.tags[sl.tag(weakHash)+1]++
+	}
+	for t := 1; t < len(sl.tags); t++ {
+		sl.tags[t] += sl.tags[t-1]
+	}
+	next := slices.Clone(sl.tags[:len(sl.tags)-1])
+	for i, weakHash := range weakHashes {
+		t := sl.tag(weakHash)
+		sl.entries[next[t]] = searchEntry{weakHash: weakHash, blockIndex: i}
+		next[t]++
+	}
+	// the ranges are small, and a stable sort keeps the block index order for the same weak hash
+	for t := 0; t < len(sl.tags)-1; t++ {
+		slices.SortStableFunc(sl.entries[sl.tags[t]:sl.tags[t+1]], func(a, b searchEntry) int {
+			return cmp.Compare(a.weakHash, b.weakHash)
+		})
+	}
+
+	return sl
+}
+
+// candidates returns the entries having the weakHash, in the block index order.
+func (sl *searchList) candidates(weakHash uint64) []searchEntry {
+	if !sl.filter.mayContain(weakHash) {
+		return nil
+	}
+	t := sl.tag(weakHash)
+	bucket := sl.entries[sl.tags[t]:sl.tags[t+1]]
+	start, found := slices.BinarySearchFunc(bucket, weakHash, func(e searchEntry, h uint64) int {
+		return cmp.Compare(e.weakHash, h)
+	})
+	if !found {
+		return nil
+	}
+	end := start + 1
+	for end < len(bucket) && bucket[end].weakHash == weakHash {
+		end++
+	}
+
+	return bucket[start:end]
+}
+
+// memory returns the memory used, in bytes, by the searchList, without the signature it references.
+func (sl *searchList) memory() int64 {
+	return int64(len(sl.filter.bits))*int64(unsafe.Sizeof(uint64(0))) +
+		int64(len(sl.tags))*int64(unsafe.Sizeof(int32(0))) +
+		int64(len(sl.entries))*int64(unsafe.Sizeof(searchEntry{}))
+}
+
+// mapMemory estimates the memory, in bytes, a map of the weak hashes to the slices of their block references would
+// use to index the same blocks, the search structure the searchList replaced: the map buckets of 8 entries, sized
+// for a block per weak hash at the load factor of 6.5 entries, and a slice per weak hash, grown by append, plus the
+// same filter.
+func (sl *searchList) mapMemory() int64 {
+	const (
+		// a strong hash slice and a block index
+		blockDataSize = int64(unsafe.Sizeof([]byte(nil)) + unsafe.Sizeof(int(0)))
+		// 8 top hashes, 8 keys, 8 slice headers and the overflow pointer
+		bucketSize = 8 + 8*int64(unsafe.Sizeof(uint64(0))+unsafe.Sizeof([]byte(nil))) + int64(unsafe.Sizeof(uintptr(0)))
+	)
+	memory := int64(len(sl.filter.bits)) * int64(unsafe.Sizeof(uint64(0)))
+	// the entries with the same weak hash are contiguous, as they share the tag
+	for i := 0; i < len(sl.entries); {
+		end := i + 1
+		for end < len(sl.entries) && sl.entries[end].weakHash == sl.entries[i].weakHash {
+			end++
+		}
+		memory += int64(1<<bits.Len(uint(end-i-1))) * blockDataSize
+		i = end
+	}
+	buckets := int64(1)
+	for float64(len(sl.entries)) > 6.5*float64(buckets) {
+		buckets <<= 1
+	}
+
+	return memory + buckets*bucketSize
+}
+
+func (sl *searchList) tag(weakHash uint64) uint64 {
+	return (weakHash * searchListTagMul) >> sl.tagShift
+}
@@ -0,0 +1,101 @@
+package rdiff
+
+import (
+	"math/rand"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSearchList_candidates(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, blocks := range []int{0, 1, 10, 1000, 100000} {
+		sig := signatureTable{WeakHashes: make([]uint64, blocks)}
+		want := make(map[uint64][]int)
+		for i := range sig.WeakHashes {
+			// a small range of hashes, so there are duplicates
+			sig.WeakHashes[i] = uint64(rnd.Intn(blocks/2 + 1))
+			want[sig.WeakHashes[i]] = append(want[sig.WeakHashes[i]], i)
+		}
+		sl := computeSearchList(&sig)
+		for h := uint64(0); h < uint64(blocks/2+2); h++ {
+			var got []int
+			for _, e := range sl.candidates(h) {
+				if e.weakHash != h {
+					t.Fatalf("%v blocks: candidates(%v) returned weak hash %v", blocks, h, e.weakHash)
+				}
+				got = append(got, e.blockIndex)
+			}
+			if diff := cmp.Diff(got, want[h]); diff != "" {
+				t.Errorf("%v blocks: candidates(%v) got = %v, want %v, \nDIFF: %v", blocks, h, got, want[h], diff)
+			}
+			if !slices.IsSorted(got) {
+				t.Errorf("%v blocks: candidates(%v) = %v is not sorted by block index", blocks, h, got)
+			}
+		}
+	}
+}
+
+// TestSearchList_memory compares the reported memory with the measured heap growth.
+func TestSearchList_memory(t *testing.T) {
+	sig := signatureTable{WeakHashes: make([]uint64, 1<<18)}
+	for i := range sig.WeakHashes {
+		sig.WeakHashes[i] = uint64(i) * 7919
+	}
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	sl := computeSearchList(&sig)
+	runtime.ReadMemStats(&after)
+
+	allocated := int64(after.TotalAlloc - before.TotalAlloc)
+	if got := sl.memory(); got > allocated || got < allocated/2 {
+		t.Errorf("memory() = %v, allocated %v", got, allocated)
+	}
+}
+
+// TestSearchList_mapMemory compares the estimated memory of the map index with the measured heap growth of one.
+func TestSearchList_mapMemory(t *testing.T) {
+	type blockData struct {
+		strongHash []byte
+		blockIndex int
+	}
+	sig := signatureTable{WeakHashes: make([]uint64, 1<<18)}
+	for i := range sig.WeakHashes {
+		// a weak hash shared by 2 blocks, every 16 blocks
+		sig.WeakHashes[i] = uint64(i-i%16/15) * 7919
+	}
+	sl := computeSearchList(&sig)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	blocks := make(map[uint64][]blockData, len(sig.WeakHashes))
+	for i, weakHash := range sig.WeakHashes {
+		blocks[weakHash] = append(blocks[weakHash], blockData{blockIndex: i})
+	}
+	runtime.ReadMemStats(&after)
+
+	allocated := int64(after.TotalAlloc-before.TotalAlloc) + int64(len(sl.filter.bits))*8
+	if got := sl.mapMemory(); got > allocated || got < allocated/2 {
+		t.Errorf("mapMemory() = %v, allocated %v", got, allocated)
+	}
+	if sl.mapMemory() <= sl.memory() {
+		t.Errorf("mapMemory() = %v, want more than memory() = %v", sl.mapMemory(), sl.memory())
+	}
+	runtime.KeepAlive(blocks)
+}
+
+func BenchmarkComputeSearchList(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	sig := signatureTable{WeakHashes: make([]uint64, 1<<20)}
+	for i := range sig.WeakHashes {
+		sig.WeakHashes[i] = uint64(rnd.Uint32())
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		computeSearchList(&sig)
+	}
+}
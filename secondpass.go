@@ -0,0 +1,251 @@
+package rdiff
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/silviutanasa/rdiff/rollsum"
+)
+
+// table returns the columnar view of the second pass hashes.
+func (s *SecondPassSignature) table() signatureTable {
+	return signatureTable{WeakHashes: s.WeakHashes, StrongHashes: s.StrongHashes}
+}
+
+// validateSecondPass returns a non-nil error if the second pass hashes of the header, if any, are not consistent with
+// it, or if they exceed the limits.
+func validateSecondPass(header SignatureHeader, limits DecodeLimits) error {
+	s := header.SecondPass
+	if s == nil {
+		return nil
+	}
+	if s.BlockSize <= 0 || (header.BlockSize > 0 && s.BlockSize >= header.BlockSize) {
+		return markError(ErrCorrupt, fmt.Errorf("invalid second pass block size: %v", s.BlockSize))
+	}
+	err := limits.checkBlocks(len(s.WeakHashes))
+	if err != nil {
+		return err
+	}
+	t := s.table()
+	err = t.validate(header.StrongHashSize)
+	if err != nil {
+		return markError(ErrCorrupt, fmt.Errorf("second pass: %w", err))
+	}
+	if want := (header.TargetSize + int64(s.BlockSize) - 1) / int64(s.BlockSize); header.TargetSize > 0 && int64(t.len()) != want {
+		return markError(ErrCorrupt, fmt.Errorf("the second pass has %v blocks, the target has %v", t.len(), want))
+	}
+
+	return nil
+}
+
+// secondPassSigner computes the second pass hashes of the target written to it, see WithSecondPass.
+type secondPassSigner struct {
+	weak       rollsum.RollingHash
+	strong     hash.Hash
+	strongSize int
+	// block holds the target bytes of the block being hashed
+	block []byte
+	sig   SecondPassSignature
+}
+
+// newSecondPassSigner returns the signer of the second pass hashes, or nil if the engine is not configured using
+// WithSecondPass. The second pass blocks must be smaller than the signature's ones, and the weak hash must be a
+// built-in one, as a custom one can't be constructed for the second pass.
+func (r *rDiff) newSecondPassSigner() (*secondPassSigner, error) {
+	if r.secondPass <= 0 {
+		return nil, nil
+	}
+	if r.secondPass >= r.blockSize {
+		return nil, fmt.Errorf("the second pass block size(%v) must be smaller than the block size(%v)", r.secondPass, r.blockSize)
+	}
+	weak, err := newRollingHash(r.weakHashType)
+	if err != nil {
+		return nil, fmt.Errorf("the second pass: %w", err)
+	}
+	strong, err := newStrongHash(r.strongHashType, r.strongHashKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &secondPassSigner{
+		weak:       weak,
+		strong:     strong,
+		strongSize: r.effectiveStrongHashSize(),
+		block:      make([]byte, 0, r.secondPass),
+		sig:        SecondPassSignature{BlockSize: r.secondPass},
+	}, nil
+}
+
+// Write hashes every full block of p, the leftover being held until the next Write, or until signature.
+func (s *secondPassSigner) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		free := cap(s.block) - len(s.block)
+		s.block = append(s.block, p[:min(free, len(p))]...)
+		p = p[min(free, len(p)):]
+		if len(s.block) == cap(s.block) {
+			s.appendBlock()
+		}
+	}
+
+	return n, nil
+}
+
+// appendBlock appends the hashes of the block held to the signature.
+func (s *secondPassSigner) appendBlock() {
+	s.weak.WriteAll(s.block)
+	s.sig.WeakHashes = append(s.sig.WeakHashes, s.weak.Sum())
+	s.strong.Reset()
+	_, _ = s.strong.Write(s.block)
+	n := len(s.sig.StrongHashes)
+	s.sig.StrongHashes = s.strong.Sum(s.sig.StrongHashes)[:n+s.strongSize]
+	s.block = s.block[:0]
+}
+
+// signature returns the second pass hashes of the target written, including its short last block, if any.
+func (s *secondPassSigner) signature() *SecondPassSignature {
+	if len(s.block) > 0 {
+		s.appendBlock()
+	}
+
+	return &s.sig
+}
+
+// secondPassAt returns the second pass hashes of the target, which has the given size, or nil if the engine is not
+// configured using WithSecondPass.
+func (r *rDiff) secondPassAt(target io.ReaderAt, targetSize int64) (*SecondPassSignature, error) {
+	s, err := r.newSecondPassSigner()
+	if err != nil || s == nil {
+		return nil, err
+	}
+	_, err = io.Copy(s, io.NewSectionReader(target, 0, targetSize))
+	if err != nil {
+		return nil, fmt.Errorf("hashing the target: %w", err)
+	}
+
+	return s.signature(), nil
+}
+
+// secondPassMatcher matches the literal regions of a delta against the second pass hashes of the signature.
+type secondPassMatcher struct {
+	blockSize int
+	// full is the number of full blocks, a short last block can't be matched by a full window
+	full       int
+	table      signatureTable
+	search     *searchList
+	weak       rollsum.RollingHash
+	strong     hash.Hash
+	strongSize int
+	sum        []byte
+	// minLiteral is the min length of a literal region matched again, the shorter ones are sent as they are
+	minLiteral int
+}
+
+// newSecondPassMatcher returns the matcher of the second pass hashes of the signature having the header, or nil if
+// the engine is not configured using WithSecondPass, or if the signature doesn't record them. The header must be
+// negotiated, so the engine hashes are the signature's ones.
+func (r *rDiff) newSecondPassMatcher(header SignatureHeader) (*secondPassMatcher, error) {
+	s := header.SecondPass
+	if r.secondPass <= 0 || s == nil {
+		return nil, nil
+	}
+	err := validateSecondPass(header, r.limits)
+	if err != nil {
+		return nil, err
+	}
+	weak, err := newRollingHash(r.weakHashType)
+	if err != nil {
+		return nil, fmt.Errorf("the second pass: %w", err)
+	}
+	strong, err := newStrongHash(r.strongHashType, r.strongHashKey)
+	if err != nil {
+		return nil, err
+	}
+	m := &secondPassMatcher{
+		blockSize:  s.BlockSize,
+		full:       len(s.WeakHashes),
+		table:      s.table(),
+		weak:       weak,
+		strong:     strong,
+		strongSize: r.strongHashSize,
+		minLiteral: r.blockSize,
+	}
+	if header.TargetSize%int64(s.BlockSize) != 0 {
+		m.full--
+	}
+	m.search = computeSearchList(&m.table)
+
+	return m, nil
+}
+
+// find returns the index of a full block having the hashes of the window, which has the weak hash weakHash, or -1 if
+// there is none. The blocks can be matched any number of times, in any order.
+func (m *secondPassMatcher) find(weakHash uint64, window []byte) int {
+	var strongHash []byte
+	for _, e := range m.search.candidates(weakHash) {
+		if e.blockIndex >= m.full {
+			continue
+		}
+		if strongHash == nil {
+			m.strong.Reset()
+			_, _ = m.strong.Write(window)
+			m.sum = m.strong.Sum(m.sum[:0])[:m.strongSize]
+			strongHash = m.sum
+		}
+		if bytes.Equal(m.table.strongHash(e.blockIndex), strongHash) {
+			return e.blockIndex
+		}
+	}
+
+	return -1
+}
+
+// refineLiteral matches the literal against the second pass blocks, if it's at least minLiteral bytes, and emits an
+// OpBlockPart operation for every block found, preceded by the literal data before it. It returns the trailing
+// literal data, not matched, to be emitted by the caller.
+func (d *deltaEmitter) refineLiteral(literal []byte) ([]byte, error) {
+	m := d.secondPass
+	if m == nil || len(literal) < m.minLiteral {
+		return literal, nil
+	}
+	start, rolled := 0, false
+	for i := 0; i+m.blockSize <= len(literal); {
+		window := literal[i : i+m.blockSize]
+		if rolled {
+			m.weak.Roll(window[m.blockSize-1])
+		} else {
+			m.weak.WriteAll(window)
+		}
+		blIdx := m.find(m.weak.Sum(), window)
+		if blIdx == -1 {
+			i, rolled = i+1, true
+			continue
+		}
+		err := d.emitPart(blIdx, literal[start:i])
+		if err != nil {
+			return nil, err
+		}
+		i += m.blockSize
+		start, rolled = i, false
+	}
+
+	return literal[start:], nil
+}
+
+// emitPart emits the OpBlockPart of the second pass block blIdx, preceded by the literal data, the literal exceeding
+// the limit preceding it as new blocks.
+func (d *deltaEmitter) emitPart(blIdx int, literal []byte) error {
+	if split := len(literal) - d.maxLiteral; d.maxLiteral > 0 && split > 0 {
+		err := d.sendNew(literal[:split])
+		if err != nil {
+			return err
+		}
+		literal = literal[split:]
+	}
+	op := Operation{Type: OpBlockPart, BlockIndex: int64(blIdx)}
+	op.Data = append(op.Data, literal...)
+
+	return d.send(op)
+}
@@ -0,0 +1,142 @@
+package rdiff
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestApp_WithSecondPass(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	rnd := rand.New(rand.NewSource(1))
+	const blockSize, partSize = 64, 16
+	target := make([]byte, 20*blockSize+10)
+	rnd.Read(target)
+	// every block of the source has an edit, so no block matches, while most of their second pass blocks do
+	source := bytes.Clone(target)
+	for off := 5; off < len(source); off += blockSize {
+		source[off] ^= 0xFF
+	}
+	for name, data := range map[string][]byte{"target": target, "source": source} {
+		if err := os.WriteFile(path(name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := New(blockSize, WithSecondPass(partSize)).Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	var sigAt bytes.Buffer
+	if err := New(blockSize, WithSecondPass(partSize)).SignatureAt(bytes.NewReader(target), int64(len(target)), &sigAt); err != nil {
+		t.Fatal(err)
+	}
+	sigData, err := os.ReadFile(path("signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, blocks, err := ReadSignature(bytes.NewReader(sigData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.SecondPass == nil || header.SecondPass.BlockSize != partSize || len(header.SecondPass.WeakHashes) != 81 {
+		t.Fatalf("Signature() second pass = %+v, want 81 blocks of %v bytes", header.SecondPass, partSize)
+	}
+	headerAt, _, err := ReadSignature(&sigAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(headerAt.SecondPass, header.SecondPass) {
+		t.Errorf("SignatureAt() second pass differs from the Signature() one")
+	}
+	if err := ValidateSignature(blocks, header); err != nil {
+		t.Errorf("ValidateSignature() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		opts      []Option
+		wantParts bool
+	}{
+		{name: "delta", wantParts: false},
+		{name: "second pass", opts: []Option{WithSecondPass(1)}, wantParts: true},
+		{name: "parallel second pass", opts: []Option{WithSecondPass(1), WithConcurrency(2)}, wantParts: true},
+	} {
+		app := New(0, tt.opts...)
+		delta := path(tt.name + ".delta")
+		if err := app.Delta(path("signature"), path("source"), delta); err != nil {
+			t.Fatalf("%v: Delta() error = %v", tt.name, err)
+		}
+		stats := app.LastDeltaStats()
+		if (stats.PartBlocks > 0) != tt.wantParts || stats.MatchedBlocks != 0 {
+			t.Errorf("%v: LastDeltaStats() = %+v, want parts %v", tt.name, stats, tt.wantParts)
+		}
+		if tt.wantParts && stats.LiteralBytes >= int64(len(source))/2 {
+			t.Errorf("%v: LiteralBytes = %v, want less than half of the source", tt.name, stats.LiteralBytes)
+		}
+		deltaData, err := os.ReadFile(delta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ops, err := ReadDelta(bytes.NewReader(deltaData))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateDelta(ops, header); err != nil {
+			t.Errorf("%v: ValidateDelta() error = %v", tt.name, err)
+		}
+		if err := New(blockSize).Patch(path("target"), delta, path(tt.name+".out")); err != nil {
+			t.Fatalf("%v: Patch() error = %v", tt.name, err)
+		}
+		if got, _ := os.ReadFile(path(tt.name + ".out")); !bytes.Equal(got, source) {
+			t.Errorf("%v: Patch() doesn't rebuild the source", tt.name)
+		}
+	}
+
+	var vcdiff bytes.Buffer
+	app := New(0, WithSecondPass(1), WithFormat(FormatVCDIFF))
+	if err := app.DeltaStream(bytes.NewReader(sigData), bytes.NewReader(source), int64(len(source)), &vcdiff); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := vcdiffDecode(target, vcdiff.Bytes()); err != nil || !bytes.Equal(got, source) {
+		t.Errorf("the VCDIFF delta doesn't rebuild the source, error = %v", err)
+	}
+
+	if err := New(blockSize, WithSecondPass(blockSize)).Signature(path("target"), path("too_big")); err == nil {
+		t.Errorf("Signature() with second pass blocks of the block size error = nil, want an error")
+	}
+}
+
+func TestValidateSignature_SecondPass(t *testing.T) {
+	header := SignatureHeader{StrongHashSize: 4, BlockSize: 8, TargetSize: 20}
+	blocks := make([]Block, 3)
+	for i := range blocks {
+		blocks[i].StrongHash = make([]byte, 4)
+	}
+	secondPass := func(blockSize, n, strongHashSize int) *SecondPassSignature {
+		return &SecondPassSignature{BlockSize: blockSize, WeakHashes: make([]uint64, n), StrongHashes: make([]byte, n*strongHashSize)}
+	}
+	tests := []struct {
+		name       string
+		secondPass *SecondPassSignature
+		fail       bool
+	}{
+		{name: "none"},
+		{name: "valid", secondPass: secondPass(4, 5, 4)},
+		{name: "block size", secondPass: secondPass(8, 3, 4), fail: true},
+		{name: "zero block size", secondPass: secondPass(0, 5, 4), fail: true},
+		{name: "missing block", secondPass: secondPass(4, 4, 4), fail: true},
+		{name: "strong hash size", secondPass: secondPass(4, 5, 2), fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := header
+			h.SecondPass = tt.secondPass
+			if err := ValidateSignature(blocks, h); tt.fail != (err != nil) {
+				t.Errorf("ValidateSignature() error = %v, fail %v", err, tt.fail)
+			}
+		})
+	}
+}
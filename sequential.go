@@ -0,0 +1,17 @@
+package rdiff
+
+import "os"
+
+// openSequential opens the file for reading, like os.Open, and hints the OS the file is going to be read
+// sequentially, so it can read ahead more aggressively. The hint is best effort, its failure is ignored.
+func openSequential(name string) (*os.File, error) {
+	f, err := openSequentialFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if rc, err := f.SyscallConn(); err == nil {
+		_ = rc.Control(adviseSequential)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,16 @@
+package rdiff
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func openSequentialFile(name string) (*os.File, error) {
+	return os.Open(name)
+}
+
+// adviseSequential turns the read ahead on, using fcntl(F_RDAHEAD).
+func adviseSequential(fd uintptr) {
+	_, _ = unix.FcntlInt(fd, unix.F_RDAHEAD, 1)
+}
@@ -0,0 +1,16 @@
+package rdiff
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func openSequentialFile(name string) (*os.File, error) {
+	return os.Open(name)
+}
+
+// adviseSequential issues posix_fadvise(POSIX_FADV_SEQUENTIAL) for the whole file.
+func adviseSequential(fd uintptr) {
+	_ = unix.Fadvise(int(fd), 0, 0, unix.FADV_SEQUENTIAL)
+}
@@ -0,0 +1,12 @@
+//go:build !(darwin || linux || windows)
+
+package rdiff
+
+import "os"
+
+func openSequentialFile(name string) (*os.File, error) {
+	return os.Open(name)
+}
+
+// adviseSequential does nothing, there is no sequential access hint on this platform.
+func adviseSequential(_ uintptr) {}
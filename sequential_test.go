@@ -0,0 +1,30 @@
+package rdiff
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenSequential(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte{1, 2, 3}, 0666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := openSequential(path)
+	if err != nil {
+		t.Fatalf("openSequential() error = %v", err)
+	}
+	defer f.Close()
+	got, err := io.ReadAll(f)
+	if err != nil || string(got) != string([]byte{1, 2, 3}) {
+		t.Errorf("openSequential() content = %v, error = %v, want %v", got, err, []byte{1, 2, 3})
+	}
+
+	_, err = openSequential(filepath.Join(t.TempDir(), "missing"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("openSequential() error = %v, want %v", err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,34 @@
+package rdiff
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// openSequentialFile opens the file with FILE_FLAG_SEQUENTIAL_SCAN, as Windows takes the hint only at open time.
+// The file is shared for reading, writing and deleting, as os.Open does, so the files held open by other processes,
+// ex: logs, or databases, can be read too, and a long path is given in its extended-length form, see longPath.
+func openSequentialFile(name string) (*os.File, error) {
+	path, err := windows.UTF16PtrFromString(longPath(name))
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	h, err := windows.CreateFile(
+		path,
+		windows.GENERIC_READ,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil,
+		windows.OPEN_EXISTING,
+		windows.FILE_ATTRIBUTE_NORMAL|windows.FILE_FLAG_SEQUENTIAL_SCAN,
+		0,
+	)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return os.NewFile(uintptr(h), name), nil
+}
+
+// adviseSequential does nothing, the hint was given when the file was opened.
+func adviseSequential(_ uintptr) {}
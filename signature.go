@@ -0,0 +1,171 @@
+package rdiff
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// signatureTable is the columnar representation of a signature: the weak hashes in one array, and the strong hashes
+// concatenated in another one, so a signature of any size takes 2 allocations, instead of one per block.
+// It's also the serialized form of the blocks, following the SignatureHeader.
+type signatureTable struct {
+	WeakHashes   []uint64
+	StrongHashes []byte
+}
+
+// newSignatureTable converts the blocks to the columnar representation.
+// All the blocks must have the same strong hash size, otherwise a non-nil error is returned.
+func newSignatureTable(blocks []Block) (signatureTable, error) {
+	var t signatureTable
+	if len(blocks) == 0 {
+		return t, nil
+	}
+	size := len(blocks[0].StrongHash)
+	t.WeakHashes = make([]uint64, 0, len(blocks))
+	t.StrongHashes = make([]byte, 0, len(blocks)*size)
+	for i, bl := range blocks {
+		if len(bl.StrongHash) != size {
+			return signatureTable{}, fmt.Errorf(
+				"the block %v strong hash size(%v) differs from the first block's one(%v)", i, len(bl.StrongHash), size,
+			)
+		}
+		t.WeakHashes = append(t.WeakHashes, bl.WeakHash)
+		t.StrongHashes = append(t.StrongHashes, bl.StrongHash...)
+	}
+
+	return t, nil
+}
+
+// len returns the number of blocks
+func (t *signatureTable) len() int {
+	return len(t.WeakHashes)
+}
+
+// strongHashSize returns the size of a single strong hash
+func (t *signatureTable) strongHashSize() int {
+	if len(t.WeakHashes) == 0 {
+		return 0
+	}
+
+	return len(t.StrongHashes) / len(t.WeakHashes)
+}
+
+// strongHash returns the strong hash of the i-th block, as a view over the table
+func (t *signatureTable) strongHash(i int) []byte {
+	size := t.strongHashSize()
+
+	return t.StrongHashes[i*size : (i+1)*size : (i+1)*size]
+}
+
+// validate checks the table is consistent with the expected strong hash size, which must be a supported one if
+// the table has blocks, so a crafted size can't overflow the expected number of strong hash bytes.
+func (t *signatureTable) validate(strongHashSize int) error {
+	if t.len() > 0 && (strongHashSize <= 0 || strongHashSize > maxStrongHashSize) {
+		return fmt.Errorf("malformed signature: invalid strong hash size: %v", strongHashSize)
+	}
+	if len(t.StrongHashes) != len(t.WeakHashes)*strongHashSize {
+		return fmt.Errorf(
+			"malformed signature: %v strong hash bytes for %v blocks of %v bytes strong hashes",
+			len(t.StrongHashes),
+			len(t.WeakHashes),
+			strongHashSize,
+		)
+	}
+
+	return nil
+}
+
+// blocks converts the table to a []Block, located in the target described by the header, the strong hashes are
+// views over the table, not copies.
+func (t *signatureTable) blocks(header SignatureHeader) []Block {
+	if t.len() == 0 {
+		return nil
+	}
+	out := make([]Block, t.len())
+	for i := range out {
+		out[i] = t.block(i, header)
+	}
+
+	return out
+}
+
+// block returns the i-th block, located in the target described by the header, see blockExtent.
+func (t *signatureTable) block(i int, header SignatureHeader) Block {
+	off, length := blockExtent(int64(i), header)
+
+	return Block{StrongHash: t.strongHash(i), WeakHash: t.WeakHashes[i], Offset: off, Length: length}
+}
+
+// blockExtent returns the offset and the length of the i-th block of the target described by the header, or 0, 0
+// if the header doesn't record the block and the target sizes, or if the block is out of the target.
+func blockExtent(i int64, header SignatureHeader) (int64, int) {
+	off, ok := blockOffset(i, header.BlockSize, header.TargetSize)
+	if !ok {
+		return 0, 0
+	}
+
+	return off, int(min(int64(header.BlockSize), header.TargetSize-off))
+}
+
+// writeSignature serializes the header and the table, using gob encoding.
+func writeSignature(w io.Writer, header SignatureHeader, t signatureTable) error {
+	enc := gob.NewEncoder(w)
+	err := enc.Encode(header)
+	if err != nil {
+		return err
+	}
+
+	return enc.Encode(t)
+}
+
+// readSignature deserializes a header and a table, written by writeSignature, within the limits.
+func readSignature(r io.Reader, limits DecodeLimits) (SignatureHeader, signatureTable, error) {
+	dec := gob.NewDecoder(limits.signatureReader(r))
+	var header SignatureHeader
+	err := dec.Decode(&header)
+	if err != nil {
+		return SignatureHeader{}, signatureTable{}, markError(ErrCorrupt, err)
+	}
+	t, err := readSignatureTable(dec, header, limits)
+	if err != nil {
+		return SignatureHeader{}, signatureTable{}, err
+	}
+
+	return header, t, nil
+}
+
+// readSignatureTable deserializes the table following the header, and validates it against the header, and the
+// limits.
+func readSignatureTable(dec *gob.Decoder, header SignatureHeader, limits DecodeLimits) (signatureTable, error) {
+	var t signatureTable
+	err := dec.Decode(&t)
+	if err != nil {
+		return signatureTable{}, markError(ErrCorrupt, err)
+	}
+	err = limits.checkBlocks(t.len())
+	if err != nil {
+		return signatureTable{}, err
+	}
+	err = t.validate(header.StrongHashSize)
+	if err != nil {
+		return signatureTable{}, markError(ErrCorrupt, err)
+	}
+	err = validateSecondPass(header, limits)
+	if err != nil {
+		return signatureTable{}, err
+	}
+
+	return t, nil
+}
+
+// ReadSignature reads a signature, as written by App.Signature, and returns its header and blocks.
+// It returns a non-nil error if the content is not a valid signature, or if it exceeds the default DecodeLimits.
+func ReadSignature(r io.Reader) (SignatureHeader, []Block, error) {
+	header, t, err := readSignature(r, DecodeLimits{})
+	if err != nil {
+		return SignatureHeader{}, nil, err
+	}
+
+	return header, t.blocks(header), nil
+}
@@ -0,0 +1,142 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/silviutanasa/rdiff/rollsum"
+)
+
+var testsSignatureTable = []struct {
+	in      []Block
+	wantErr bool
+}{
+	{in: nil},
+	{in: []Block{{StrongHash: []byte{1, 2}, WeakHash: 1}}},
+	{in: []Block{{StrongHash: []byte{1, 2}, WeakHash: 1}, {StrongHash: []byte{3, 4}, WeakHash: 1 << 40}}},
+	{in: []Block{{StrongHash: []byte{1, 2}, WeakHash: 1}, {StrongHash: []byte{3}, WeakHash: 2}}, wantErr: true},
+}
+
+// TestSignatureTable_RoundTrip converts blocks to the columnar form, serializes them and reads them back.
+func TestSignatureTable_RoundTrip(t *testing.T) {
+	for _, tt := range testsSignatureTable {
+		table, err := newSignatureTable(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newSignatureTable(%v) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		header := SignatureHeader{StrongHashSize: table.strongHashSize()}
+		var buf bytes.Buffer
+		if err := writeSignature(&buf, header, table); err != nil {
+			t.Fatalf("writeSignature() error = %v", err)
+		}
+		gotHeader, got, err := ReadSignature(&buf)
+		if err != nil {
+			t.Fatalf("ReadSignature() error = %v", err)
+		}
+		if diff := cmp.Diff(gotHeader, header); diff != "" {
+			t.Errorf("ReadSignature() header got = %v, want %v, \nDIFF: %v", gotHeader, header, diff)
+		}
+		if diff := cmp.Diff(got, tt.in); diff != "" {
+			t.Errorf("ReadSignature() blocks got = %v, want %v, \nDIFF: %v", got, tt.in, diff)
+		}
+	}
+}
+
+func TestReadSignature_BlockExtents(t *testing.T) {
+	table := signatureTable{WeakHashes: make([]uint64, 3), StrongHashes: make([]byte, 3*md5.Size)}
+	for _, tt := range []struct {
+		name   string
+		header SignatureHeader
+		want   [][2]int64
+	}{
+		{name: "short last block", header: SignatureHeader{BlockSize: 3, TargetSize: 7}, want: [][2]int64{{0, 3}, {3, 3}, {6, 1}}},
+		{name: "full last block", header: SignatureHeader{BlockSize: 3, TargetSize: 9}, want: [][2]int64{{0, 3}, {3, 3}, {6, 3}}},
+		{name: "unknown target size", header: SignatureHeader{BlockSize: 3}, want: [][2]int64{{0, 0}, {0, 0}, {0, 0}}},
+	} {
+		tt.header.StrongHashSize = md5.Size
+		var buf bytes.Buffer
+		if err := writeSignature(&buf, tt.header, table); err != nil {
+			t.Fatalf("writeSignature() error = %v", err)
+		}
+		_, blocks, err := ReadSignature(&buf)
+		if err != nil {
+			t.Fatalf("%v: ReadSignature() error = %v", tt.name, err)
+		}
+		var got [][2]int64
+		for _, b := range blocks {
+			got = append(got, [2]int64{b.Offset, int64(b.Length)})
+		}
+		if diff := cmp.Diff(got, tt.want); diff != "" {
+			t.Errorf("%v: ReadSignature() block extents = %v, want %v", tt.name, got, tt.want)
+		}
+		if err := ValidateSignature(blocks, tt.header); err != nil {
+			t.Errorf("%v: ValidateSignature() error = %v", tt.name, err)
+		}
+	}
+}
+
+func TestReadSignature_Malformed(t *testing.T) {
+	var buf bytes.Buffer
+	table := signatureTable{WeakHashes: []uint64{1, 2}, StrongHashes: []byte{1, 2, 3}}
+	if err := writeSignature(&buf, SignatureHeader{StrongHashSize: 2}, table); err != nil {
+		t.Fatalf("writeSignature() error = %v", err)
+	}
+	if _, _, err := ReadSignature(&buf); err == nil {
+		t.Errorf("ReadSignature() expected an error for inconsistent strong hashes")
+	}
+	if _, _, err := ReadSignature(bytes.NewReader([]byte("not a signature"))); err == nil {
+		t.Errorf("ReadSignature() expected an error for garbage input")
+	}
+}
+
+func BenchmarkRDiff_ComputeSignature(b *testing.B) {
+	target := make([]byte, 1<<20)
+	for i := range target {
+		target[i] = byte(i * 7)
+	}
+	r := newRDiff(64, rollsum.NewAdler32(), md5.New())
+	b.SetBytes(int64(len(target)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.ComputeSignature(bytes.NewReader(target)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// FuzzReadSignature checks a malformed signature is reported as corrupt, without panicking.
+func FuzzReadSignature(f *testing.F) {
+	for _, n := range []int{0, 1, 3} {
+		table := signatureTable{WeakHashes: make([]uint64, n), StrongHashes: make([]byte, n*md5.Size)}
+		var buf bytes.Buffer
+		if err := writeSignature(&buf, SignatureHeader{StrongHashSize: md5.Size, BlockSize: 4, TargetSize: int64(4 * n)}, table); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes())
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		header, blocks, err := ReadSignature(bytes.NewReader(data))
+		if err != nil {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Errorf("ReadSignature() error = %v, want %v", err, ErrCorrupt)
+			}
+			return
+		}
+		for i, b := range blocks {
+			if len(b.StrongHash) != header.StrongHashSize {
+				t.Errorf("ReadSignature() block %v has a %v bytes strong hash, want %v", i, len(b.StrongHash), header.StrongHashSize)
+			}
+			if b.Offset < 0 || b.Length < 0 || b.Offset+int64(b.Length) > max(header.TargetSize, 0) {
+				t.Errorf("ReadSignature() block %v has %v bytes at %v, out of the target size(%v)", i, b.Length, b.Offset, header.TargetSize)
+			}
+		}
+	})
+}
@@ -0,0 +1,150 @@
+package rdiff
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// SignatureCache is an in-memory LRU cache of the signatures computed by Signature, keyed by the path, the size and
+// the modification time of the target, so repeatedly signing an unchanged target, ex: the basis files of a sync
+// daemon, doesn't hash it again. The signatures are cached before they're serialized, so they're reused whatever
+// the format, while the hashing configuration is part of the key.
+// A target modified without changing its size, nor its modification time, is not detected: Invalidate drops its
+// signatures explicitly.
+// It's safe for concurrent use, and it can be shared by several App instances, see WithSignatureCache.
+type SignatureCache struct {
+	mu sync.Mutex
+	// maxBytes caps the size of the cached hashes, and size is their current size
+	maxBytes int64
+	size     int64
+	// lru orders the entries from the most recently used one, and entries indexes them by key
+	lru     *list.List
+	entries map[signatureCacheKey]*list.Element
+}
+
+// signatureCacheKey identifies a target file, in the state it was signed in, and the configuration of the hashes.
+type signatureCacheKey struct {
+	path    string
+	size    int64
+	modTime int64
+	config  string
+}
+
+// signatureCacheEntry is a signature cached, and the size of its hashes.
+type signatureCacheEntry struct {
+	key       signatureCacheKey
+	header    SignatureHeader
+	signature signatureTable
+	size      int64
+}
+
+// NewSignatureCache constructs a signature cache holding up to maxBytes bytes of hashes, evicting the least recently
+// used signatures beyond it. A signature bigger than maxBytes is not cached.
+func NewSignatureCache(maxBytes int64) *SignatureCache {
+	return &SignatureCache{maxBytes: maxBytes, lru: list.New(), entries: make(map[signatureCacheKey]*list.Element)}
+}
+
+// Invalidate drops the signatures of the target file at path, whatever the configuration they were computed with.
+func (c *SignatureCache) Invalidate(path string) {
+	path = absCachePath(path)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, e := range c.entries {
+		if key.path == path {
+			c.remove(e)
+		}
+	}
+}
+
+// Purge drops all the signatures.
+func (c *SignatureCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	clear(c.entries)
+	c.size = 0
+}
+
+// Len returns the number of signatures cached.
+func (c *SignatureCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// get returns the signature cached for the key, if any, marking it as the most recently used one.
+func (c *SignatureCache) get(key signatureCacheKey) (SignatureHeader, signatureTable, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return SignatureHeader{}, signatureTable{}, false
+	}
+	c.lru.MoveToFront(e)
+	entry := e.Value.(*signatureCacheEntry)
+
+	return entry.header, entry.signature, true
+}
+
+// put caches the signature for the key, evicting the least recently used signatures until the cache fits maxBytes.
+func (c *SignatureCache) put(key signatureCacheKey, header SignatureHeader, signature signatureTable) {
+	size := signatureCacheSize(header, signature)
+	if size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		c.remove(e)
+	}
+	c.entries[key] = c.lru.PushFront(&signatureCacheEntry{key: key, header: header, signature: signature, size: size})
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops the entry. The caller must hold the lock.
+func (c *SignatureCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*signatureCacheEntry)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+}
+
+// signatureCacheSize returns the size of the hashes of a signature, which is the memory it holds.
+func signatureCacheSize(header SignatureHeader, signature signatureTable) int64 {
+	size := 8*len(signature.WeakHashes) + len(signature.StrongHashes) + len(header.FileHash)
+	if header.SecondPass != nil {
+		size += 8*len(header.SecondPass.WeakHashes) + len(header.SecondPass.StrongHashes)
+	}
+
+	return int64(size)
+}
+
+// absCachePath returns the absolute path of a target, so the same file is cached once whatever the working
+// directory of the calls.
+func absCachePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+
+	return abs
+}
+
+// signatureCacheKey returns the cache key of the signature of the target file at path, described by info, computed
+// using the App's configuration.
+func (a *App) signatureCacheKey(path string, info os.FileInfo) signatureCacheKey {
+	r := a.diffEngine
+	config := fmt.Sprintf(
+		"%v/%v/%v/%x/%v/%v/%v/%v",
+		r.weakHashType, r.strongHashType, r.effectiveStrongHashSize(), strongHashKeyID(r.strongHashKey),
+		r.blockSize, r.secondPass, a.fileHash, a.gzip,
+	)
+
+	return signatureCacheKey{path: absCachePath(path), size: info.Size(), modTime: info.ModTime().UnixNano(), config: config}
+}
@@ -0,0 +1,111 @@
+package rdiff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignatureCache(t *testing.T) {
+	signature := signatureTable{WeakHashes: make([]uint64, 4), StrongHashes: make([]byte, 32)}
+	key := func(path string) signatureCacheKey { return signatureCacheKey{path: absCachePath(path)} }
+	// every signature holds 64 bytes of hashes, so the cache holds 2 of them
+	c := NewSignatureCache(150)
+	c.put(key("a"), SignatureHeader{}, signature)
+	c.put(key("b"), SignatureHeader{}, signature)
+	if _, _, ok := c.get(key("a")); !ok {
+		t.Fatal("get(a) = false, want true")
+	}
+	c.put(key("c"), SignatureHeader{}, signature)
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "a", want: true},
+		{path: "b", want: false},
+		{path: "c", want: true},
+	}
+	for _, tt := range tests {
+		if _, _, ok := c.get(key(tt.path)); ok != tt.want {
+			t.Errorf("get(%v) = %v, want %v", tt.path, ok, tt.want)
+		}
+	}
+	c.Invalidate("a")
+	if _, _, ok := c.get(key("a")); ok || c.Len() != 1 {
+		t.Errorf("after Invalidate(a), get(a) = %v, Len() = %v, want false, 1", ok, c.Len())
+	}
+	c.put(key("big"), SignatureHeader{}, signatureTable{StrongHashes: make([]byte, 151)})
+	if c.Len() != 1 {
+		t.Errorf("Len() = %v after caching a signature bigger than the cache, want 1", c.Len())
+	}
+	c.Purge()
+	if c.Len() != 0 || c.size != 0 {
+		t.Errorf("after Purge(), Len() = %v, size = %v, want 0, 0", c.Len(), c.size)
+	}
+}
+
+func TestApp_WithSignatureCache(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := bytes.Repeat([]byte("0123456789abcdef"), 256)
+	if err := os.WriteFile(path("target"), target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewSignatureCache(1 << 20)
+	signature := func(name string, opts ...Option) []byte {
+		t.Helper()
+		if err := New(64, append(opts, WithSignatureCache(cache))...).Signature(path("target"), path(name)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	want := signature("s1")
+	if got := signature("s2"); !bytes.Equal(got, want) || cache.Len() != 1 {
+		t.Fatalf("the cached signature differs, or Len() = %v, want 1", cache.Len())
+	}
+	// another configuration is cached apart
+	if signature("s3", WithFormat(FormatJSON)); cache.Len() != 1 {
+		t.Errorf("Len() = %v after signing in another format, want 1", cache.Len())
+	}
+	if signature("s4", WithFileHash(true)); cache.Len() != 2 {
+		t.Errorf("Len() = %v after signing with a file hash, want 2", cache.Len())
+	}
+
+	// a change keeping the size and the modification time is only seen once the target is invalidated
+	info, err := os.Stat(path("target"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := bytes.Repeat([]byte("fedcba9876543210"), 256)
+	if err := os.WriteFile(path("target"), changed, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path("target"), info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got := signature("s5"); !bytes.Equal(got, want) {
+		t.Error("the signature of the unchanged size and modification time is not the cached one")
+	}
+	cache.Invalidate(path("target"))
+	if got := signature("s6"); bytes.Equal(got, want) {
+		t.Error("the signature of the invalidated target is the cached one")
+	}
+
+	// a new modification time is a cache miss
+	if err := os.WriteFile(path("target"), target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path("target"), info.ModTime(), info.ModTime().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if got := signature("s7"); !bytes.Equal(got, want) {
+		t.Error("the signature of the modified target is not recomputed")
+	}
+}
@@ -0,0 +1,388 @@
+package rdiff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// SignatureService keeps the signatures of the files under a set of directories up to date, in memory, and serves
+// them on demand, so a peer asking for the signature of a file to sync doesn't wait for the whole file to be hashed.
+// Its methods are safe for concurrent use.
+type SignatureService struct {
+	blockSize int
+	opts      []Option
+	dirs      []string
+
+	mu sync.Mutex
+	// entries holds the signatures of the files, by absolute path
+	entries map[string]*serviceEntry
+	// pending holds the changed files, and the time of their last change
+	pending map[string]time.Time
+}
+
+// serviceEntry is the signature of a file, and the changes made to the file since it was computed.
+type serviceEntry struct {
+	// mu serializes the updates of the signature, the fields are guarded by the service's mutex, and the signature
+	// and the error of its last update are written with both held
+	mu        sync.Mutex
+	signature []byte
+	err       error
+	// info is the file's info when the signature was computed
+	info fs.FileInfo
+	// dirty means the file changed, full that its changes are unknown, so its whole signature must be computed
+	// again, otherwise ranges are its changed ranges
+	dirty  bool
+	full   bool
+	ranges []Range
+}
+
+// NewSignatureService returns a SignatureService maintaining the signatures of the files under dirs, which are
+// computed as by New(blockSize, opts...), the block size being decided for every file if it's dynamic.
+// It returns a non-nil error if dirs is empty, or if a directory can't be resolved.
+func NewSignatureService(dirs []string, blockSize int, opts ...Option) (*SignatureService, error) {
+	if len(dirs) == 0 {
+		return nil, errors.New("no directory to watch")
+	}
+	s := &SignatureService{
+		blockSize: blockSize,
+		opts:      opts,
+		entries:   make(map[string]*serviceEntry),
+		pending:   make(map[string]time.Time),
+	}
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		s.dirs = append(s.dirs, abs)
+	}
+
+	return s, nil
+}
+
+// Run watches the directories, and keeps the signatures up to date, until ctx is done, and returns ctx.Err().
+// It first computes the signatures of all the files, then it updates the signature of a file every time the file
+// changes, once it's left unchanged for a while, and drops it when the file is removed. The updates failing are
+// retried on the next change of their files, and their errors are returned by WriteSignature meanwhile.
+// It returns a non-nil error if a directory can't be watched.
+func (s *SignatureService) Run(ctx context.Context) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+	for _, dir := range s.dirs {
+		err = s.scan(fsw, dir)
+		if err != nil {
+			return err
+		}
+	}
+	s.flush(time.Now())
+
+	return s.loop(ctx, fsw)
+}
+
+// Changed tells the service the file at path was modified in the changed ranges only, ex: as tracked by the writer of
+// the file, so its signature is updated by hashing the blocks overlapping them, see UpdateSignature, instead of the
+// whole file. The ranges must cover every write made to the file since its previous update, and they must be
+// reported before the writes are made: a write seen before its ranges are reported, like any change which is not a
+// write, has the whole signature of the file computed again.
+func (s *SignatureService) Changed(path string, changed ...Range) error {
+	abs, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entry(abs)
+	e.dirty = true
+	e.ranges = append(e.ranges, changed...)
+	s.pending[abs] = time.Now()
+
+	return nil
+}
+
+// WriteSignature writes the current signature of the file at path, which must be under one of the watched
+// directories, to output. A file changed since its signature was last updated, or not seen yet, has its signature
+// updated first, so the signature matches the file as it is when WriteSignature is called.
+// It returns a non-nil error matching fs.ErrNotExist if the file doesn't exist, and the error of the last update of
+// the signature, if it failed.
+func (s *SignatureService) WriteSignature(path string, output io.Writer) error {
+	abs, err := s.resolve(path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	e := s.entry(abs)
+	s.mu.Unlock()
+	signature, err := s.update(abs, e)
+	if err != nil {
+		return err
+	}
+	_, err = output.Write(signature)
+
+	return err
+}
+
+// Len returns the number of files whose signatures are held.
+func (s *SignatureService) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.entries)
+}
+
+// resolve returns the absolute path of path, which must be under one of the watched directories.
+func (s *SignatureService) resolve(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range s.dirs {
+		if strings.HasPrefix(abs, dir+string(filepath.Separator)) {
+			return abs, nil
+		}
+	}
+
+	return "", fmt.Errorf("%v is not under a watched directory", path)
+}
+
+// entry returns the entry of the file, a new one being dirty, it must be called with the mutex held.
+func (s *SignatureService) entry(abs string) *serviceEntry {
+	e, ok := s.entries[abs]
+	if !ok {
+		e = &serviceEntry{dirty: true, full: true}
+		s.entries[abs] = e
+	}
+
+	return e
+}
+
+// loop processes the file system events until ctx is done.
+func (s *SignatureService) loop(ctx context.Context, fsw *fsnotify.Watcher) error {
+	timer := time.NewTimer(watchDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return errors.New("the file system watcher was closed")
+			}
+			s.handle(fsw, ev)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return errors.New("the file system watcher was closed")
+			}
+			s.handleError(fsw, err)
+		case now := <-timer.C:
+			s.flush(now)
+		}
+		s.schedule(timer)
+	}
+}
+
+// handle records the file changed by ev, a new directory is watched and scanned right away. A write keeps the
+// changed ranges reported for the file, if any, the other changes require its whole signature to be computed again.
+func (s *SignatureService) handle(fsw *fsnotify.Watcher, ev fsnotify.Event) {
+	if ev.Op == fsnotify.Chmod {
+		return
+	}
+	if ev.Has(fsnotify.Create) {
+		info, err := os.Lstat(ev.Name)
+		if err == nil && info.IsDir() {
+			// a directory which can't be watched has its files' signatures computed on demand only
+			_ = s.scan(fsw, ev.Name)
+			return
+		}
+	}
+	if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+		s.changedTree(ev.Name)
+	}
+	s.changed(ev.Name, ev.Has(fsnotify.Write))
+}
+
+// changed marks the file at abs as changed, its whole signature being computed again unless the change is a write
+// whose ranges were reported.
+func (s *SignatureService) changed(abs string, write bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.entry(abs)
+	if write && !e.dirty && e.current(abs) {
+		// the write was seen by an update made on demand
+		return
+	}
+	e.dirty = true
+	e.full = e.full || !write || len(e.ranges) == 0
+	s.pending[abs] = time.Now()
+}
+
+// changedTree marks the files under abs, a directory which was moved or removed, as changed, so their signatures are
+// dropped.
+func (s *SignatureService) changedTree(abs string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prefix := abs + string(filepath.Separator)
+	for p, e := range s.entries {
+		if strings.HasPrefix(p, prefix) {
+			e.dirty, e.full = true, true
+			s.pending[p] = time.Now()
+		}
+	}
+}
+
+// handleError recovers the events lost by an overflow by scanning the directories again.
+func (s *SignatureService) handleError(fsw *fsnotify.Watcher, err error) {
+	if !errors.Is(err, fsnotify.ErrEventOverflow) {
+		return
+	}
+	for _, dir := range s.dirs {
+		_ = s.scan(fsw, dir)
+	}
+}
+
+// schedule resets the timer to the time the first pending file is due.
+func (s *SignatureService) schedule(timer *time.Timer) {
+	s.mu.Lock()
+	var first time.Time
+	for _, t := range s.pending {
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+	}
+	s.mu.Unlock()
+	if first.IsZero() {
+		return
+	}
+	timer.Stop()
+	select {
+	case <-timer.C:
+	default:
+	}
+	timer.Reset(time.Until(first.Add(watchDelay)))
+}
+
+// flush updates the signatures of the pending files left unchanged for watchDelay.
+func (s *SignatureService) flush(now time.Time) {
+	s.mu.Lock()
+	due := make(map[string]*serviceEntry)
+	for abs, t := range s.pending {
+		if now.Sub(t) < watchDelay {
+			continue
+		}
+		delete(s.pending, abs)
+		due[abs] = s.entry(abs)
+	}
+	s.mu.Unlock()
+	for abs, e := range due {
+		// the error is kept by the entry, and returned by WriteSignature
+		_, _ = s.update(abs, e)
+	}
+}
+
+// scan watches root and its sub-directories, and marks their files as changed, so their signatures are computed
+// again, on the next flush.
+func (s *SignatureService) scan(fsw *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return fsw.Add(path)
+		}
+		if d.Type().IsRegular() {
+			s.changed(path, false)
+		}
+		return nil
+	})
+}
+
+// update brings the signature of the file up to date, if it's dirty, or if the file's size or modification time
+// changed since it was computed, ex: if its change is not seen yet, and returns it. The signature of a removed file
+// is dropped.
+func (s *SignatureService) update(abs string, e *serviceEntry) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s.mu.Lock()
+	dirty, full, ranges := e.takeChanges(abs)
+	s.mu.Unlock()
+	if !dirty {
+		return e.signature, e.err
+	}
+
+	signature, info, err := s.computeSignature(abs, e.signature, full, ranges)
+	s.mu.Lock()
+	if errors.Is(err, fs.ErrNotExist) && s.entries[abs] == e && !e.dirty {
+		delete(s.entries, abs)
+	}
+	e.signature, e.info, e.err = signature, info, err
+	s.mu.Unlock()
+
+	return signature, err
+}
+
+// takeChanges returns whether the signature must be updated, whether its whole signature must be computed again, and
+// the changed ranges otherwise, and resets them, it must be called with the service's mutex held. A change not seen
+// yet can't be updated incrementally, as its ranges are unknown.
+func (e *serviceEntry) takeChanges(abs string) (dirty, full bool, ranges []Range) {
+	dirty, full, ranges = e.dirty || !e.current(abs), e.full || !e.dirty || e.signature == nil || e.err != nil, e.ranges
+	e.dirty, e.full, e.ranges = false, false, nil
+
+	return dirty, full, ranges
+}
+
+// current reports whether the file has the size and the modification time it had when its signature was computed,
+// it must be called with the service's mutex held.
+func (e *serviceEntry) current(abs string) bool {
+	if e.info == nil {
+		return false
+	}
+	info, err := os.Stat(abs)
+
+	return err == nil && info.Size() == e.info.Size() && info.ModTime().Equal(e.info.ModTime())
+}
+
+// computeSignature returns the signature of the file, computed again if full, otherwise updated from the previous
+// one, given the changed ranges, and the file's info, as it was before it was read.
+func (s *SignatureService) computeSignature(abs string, previous []byte, full bool, changed []Range) ([]byte, fs.FileInfo, error) {
+	f, err := os.Open(abs)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("%v is not a regular file", abs)
+	}
+	var out bytes.Buffer
+	a := New(s.blockSize, s.opts...)
+	if !full {
+		err = a.UpdateSignature(bytes.NewReader(previous), f, info.Size(), changed, &out)
+		if err == nil {
+			return out.Bytes(), info, nil
+		}
+		// the signature can't always be updated, ex: if it records the hash of the whole file
+		out.Reset()
+	}
+	err = a.SignatureAt(f, info.Size(), &out)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return out.Bytes(), info, nil
+}
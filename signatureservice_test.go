@@ -0,0 +1,146 @@
+package rdiff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testWatchBlockSize = 32
+
+// startSignatureService runs the service in the background, until the test ends.
+func startSignatureService(t *testing.T, s *SignatureService) {
+	t.Helper()
+	delay := watchDelay
+	watchDelay = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+		}
+		watchDelay = delay
+	})
+}
+
+// checkServedSignature checks the service serves the signature of the file at path as it is.
+func checkServedSignature(t *testing.T, s *SignatureService, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want, got bytes.Buffer
+	if err := New(testWatchBlockSize).SignatureAt(bytes.NewReader(data), int64(len(data)), &want); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteSignature(path, &got); err != nil {
+		t.Fatalf("WriteSignature(%v) error = %v", path, err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("WriteSignature(%v) doesn't match the file", path)
+	}
+}
+
+func TestSignatureService(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	a := filepath.Join(dirs[0], "a")
+	b := filepath.Join(dirs[1], "sub", "b")
+	if err := os.MkdirAll(filepath.Dir(b), 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{a, b} {
+		if err := os.WriteFile(p, randomBytes(1, 20*testWatchBlockSize), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := NewSignatureService(dirs, testWatchBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startSignatureService(t, s)
+	for deadline := time.Now().Add(5 * time.Second); s.Len() < 2; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Len() = %v, want 2", s.Len())
+		}
+	}
+	checkServedSignature(t, s, a)
+	checkServedSignature(t, s, b)
+
+	// a change not reported is served right away, the whole signature being computed again
+	if err := os.WriteFile(a, randomBytes(2, 30*testWatchBlockSize), 0666); err != nil {
+		t.Fatal(err)
+	}
+	checkServedSignature(t, s, a)
+
+	// a reported change updates the signature incrementally
+	f, err := os.OpenFile(b, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Changed(b, Range{Offset: 100, Length: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("12345"), 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * watchDelay)
+	checkServedSignature(t, s, b)
+
+	// a new file is served, a removed one is not
+	c := filepath.Join(dirs[0], "c")
+	if err := os.WriteFile(c, randomBytes(3, 10*testWatchBlockSize), 0666); err != nil {
+		t.Fatal(err)
+	}
+	checkServedSignature(t, s, c)
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteSignature(a, &bytes.Buffer{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("WriteSignature() of a removed file error = %v, want %v", err, fs.ErrNotExist)
+	}
+	if err := s.WriteSignature(filepath.Join(t.TempDir(), "other"), &bytes.Buffer{}); err == nil {
+		t.Error("WriteSignature() of a file which is not watched error = nil, want non-nil")
+	}
+}
+
+func TestSignatureService_Changed(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "file")
+	data := randomBytes(1, 50*testWatchBlockSize)
+	if err := os.WriteFile(p, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSignatureService([]string{dir}, testWatchBlockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without Run, the signatures are computed on demand, and the reported changes are applied to them
+	checkServedSignature(t, s, p)
+	copy(data[10*testWatchBlockSize:], "changed")
+	data = append(data, "appended"...)
+	if err := os.WriteFile(p, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Changed(p, Range{Offset: 10 * testWatchBlockSize, Length: 7}); err != nil {
+		t.Fatal(err)
+	}
+	checkServedSignature(t, s, p)
+
+	if err := s.Changed(filepath.Join(t.TempDir(), "other")); err == nil {
+		t.Error("Changed() of a file which is not watched error = nil, want non-nil")
+	}
+	if _, err := NewSignatureService(nil, testWatchBlockSize); err == nil {
+		t.Error("NewSignatureService() without directories error = nil, want non-nil")
+	}
+}
@@ -0,0 +1,137 @@
+package rdiff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Range is a range of bytes of a file: Length bytes, starting at Offset.
+type Range struct {
+	Offset int64
+	Length int64
+}
+
+// UpdateSignature updates the signature of a target, read from signature, after the target was modified in the
+// changed ranges only, ex: the ranges written since the signature was computed, as tracked by a journal, and writes
+// the updated signature to output, in the configured format. The target, which now has targetSize bytes, is read by
+// offset, and only its blocks overlapping a changed range are hashed again, along with the blocks following the end
+// of the shorter of the previous target and the new one, if its size changed, so a large target changing a little
+// isn't read again.
+// The signature must record its block size, and its target size, and it can't record hashes of the whole target,
+// see WithFileHash and WithSecondPass, nor be the signature of a gzip target, see WithGzip, otherwise a non-nil error
+// is returned, as its signature must be computed again. The signature's hash algorithms must match the configured
+// ones(if any), as for a delta.
+// A changed range left out makes the updated signature list the previous hashes of its blocks, which don't match the
+// target, so the deltas computed against it are not valid.
+func (a *App) UpdateSignature(signature io.Reader, target io.ReaderAt, targetSize int64, changed []Range, output io.Writer) error {
+	err := a.checkSignatureHashers()
+	if err != nil {
+		return err
+	}
+	header, table, err := a.readSignature(signature)
+	if err != nil {
+		return err
+	}
+	err = checkUpdatable(header)
+	if err != nil {
+		return err
+	}
+	r, err := a.diffEngine.negotiated(header)
+	if err != nil {
+		return err
+	}
+	if targetSize <= 0 {
+		return errors.New("the target is empty")
+	}
+	bs, err := decideBlockSize(header.BlockSize, targetSize)
+	if err != nil {
+		return err
+	}
+	dirty, err := dirtyBlocks(header.TargetSize, targetSize, bs, changed)
+	if err != nil {
+		return err
+	}
+	table, err = r.rehashBlocks(table, target, targetSize, dirty)
+	if err != nil {
+		return err
+	}
+	header.TargetSize = targetSize
+
+	return a.writeSignature(output, header, table)
+}
+
+// checkUpdatable returns a non-nil error if the signature having the header can't be updated by UpdateSignature.
+func checkUpdatable(header SignatureHeader) error {
+	switch {
+	case header.BlockSize <= 0 || header.TargetSize <= 0:
+		return errors.New("the signature doesn't record its block size, and its target size, so it can't be updated")
+	case header.FileHash != nil || header.SecondPass != nil:
+		return errors.New("the signature records hashes of the whole target, so it can't be updated")
+	case header.Gunzipped:
+		return errors.New("the signature of a gzip target can't be updated")
+	default:
+		return nil
+	}
+}
+
+// dirtyBlocks returns the blocks of blockSize bytes of the target, which had oldSize bytes, and now has newSize
+// bytes, which must be hashed again, in the order of the target: the ones overlapping the changed ranges, and the
+// ones following the end of the shorter of the old target and the new one.
+func dirtyBlocks(oldSize, newSize int64, blockSize int, changed []Range) ([]bool, error) {
+	bs := int64(blockSize)
+	dirty := make([]bool, (newSize+bs-1)/bs)
+	for _, r := range changed {
+		if r.Offset < 0 || r.Length < 0 {
+			return nil, fmt.Errorf("invalid changed range: %v bytes at %v", r.Length, r.Offset)
+		}
+		// the changed ranges of the old target which are truncated are ignored
+		for i := r.Offset / bs; i < int64(len(dirty)) && i*bs < r.Offset+r.Length; i++ {
+			dirty[i] = true
+		}
+	}
+	if oldSize != newSize {
+		for i := min(oldSize, newSize) / bs; i < int64(len(dirty)); i++ {
+			dirty[i] = true
+		}
+	}
+
+	return dirty, nil
+}
+
+// rehashBlocks returns the table of the target, which has the given size, given the previous table t: the dirty
+// blocks are hashed again, the other ones keep their previous hashes, and the blocks of t following the end of
+// the target are dropped.
+func (r *rDiff) rehashBlocks(t signatureTable, target io.ReaderAt, size int64, dirty []bool) (signatureTable, error) {
+	strongSize := r.effectiveStrongHashSize()
+	n := min(t.len(), len(dirty))
+	out := signatureTable{
+		WeakHashes:   append(make([]uint64, 0, len(dirty)), t.WeakHashes[:n]...),
+		StrongHashes: append(make([]byte, 0, len(dirty)*strongSize), t.StrongHashes[:n*strongSize]...),
+	}
+	buf := getBuffer(r.blockSize)
+	defer putBuffer(buf)
+	var block signatureTable
+	for i, d := range dirty {
+		if !d {
+			continue
+		}
+		off := int64(i) * int64(r.blockSize)
+		p := (*buf)[:min(int64(r.blockSize), size-off)]
+		_, err := target.ReadAt(p, off)
+		if err != nil && !(errors.Is(err, io.EOF) && off+int64(len(p)) == size) {
+			return signatureTable{}, fmt.Errorf("reading the target block %v: %w", i, err)
+		}
+		block = r.appendBlockSums(signatureTable{WeakHashes: block.WeakHashes[:0], StrongHashes: block.StrongHashes[:0]}, p)
+		if i < len(out.WeakHashes) {
+			out.WeakHashes[i] = block.WeakHashes[0]
+			copy(out.StrongHashes[i*strongSize:], block.StrongHashes)
+			continue
+		}
+		// the blocks following the end of the old target are all dirty, so they're appended in order
+		out.WeakHashes = append(out.WeakHashes, block.WeakHashes[0])
+		out.StrongHashes = append(out.StrongHashes, block.StrongHashes...)
+	}
+
+	return out, nil
+}
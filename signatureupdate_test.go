@@ -0,0 +1,144 @@
+package rdiff
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// countingReaderAt counts the bytes read from an io.ReaderAt.
+type countingReaderAt struct {
+	r    *bytes.Reader
+	read int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	c.read += int64(n)
+
+	return n, err
+}
+
+func TestApp_UpdateSignature(t *testing.T) {
+	const blockSize = 64
+	rnd := rand.New(rand.NewSource(1))
+	target := make([]byte, 100*blockSize+10)
+	rnd.Read(target)
+	write := func(data []byte, off int, p string) []byte {
+		out := bytes.Clone(data)
+		return append(out[:off], append([]byte(p), out[min(off+len(p), len(out)):]...)...)
+	}
+
+	tests := []struct {
+		name     string
+		modified []byte
+		changed  []Range
+		maxRead  int64
+	}{
+		{
+			name:     "unchanged",
+			modified: target,
+		},
+		{
+			name:     "ranges spanning blocks",
+			modified: write(write(target, 10, "x"), 3*blockSize-2, "across"),
+			changed:  []Range{{Offset: 10, Length: 1}, {Offset: 3*blockSize - 2, Length: 6}},
+			maxRead:  3 * blockSize,
+		},
+		{
+			name:     "appended",
+			modified: append(write(target, 50*blockSize, "y"), bytes.Repeat([]byte("z"), 3*blockSize)...),
+			changed:  []Range{{Offset: 50 * blockSize, Length: 1}},
+			maxRead:  6 * blockSize,
+		},
+		{
+			name:     "truncated",
+			modified: target[:40*blockSize+5],
+			// a change of the truncated end is ignored
+			changed: []Range{{Offset: 60 * blockSize, Length: 10}},
+			maxRead: blockSize,
+		},
+		{
+			name:     "truncated at a block boundary",
+			modified: target[:40*blockSize],
+			maxRead:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var signature, want, got bytes.Buffer
+			if err := New(blockSize).SignatureAt(bytes.NewReader(target), int64(len(target)), &signature); err != nil {
+				t.Fatal(err)
+			}
+			if err := New(blockSize).SignatureAt(bytes.NewReader(tt.modified), int64(len(tt.modified)), &want); err != nil {
+				t.Fatal(err)
+			}
+			r := &countingReaderAt{r: bytes.NewReader(tt.modified)}
+			if err := New(0).UpdateSignature(&signature, r, int64(len(tt.modified)), tt.changed, &got); err != nil {
+				t.Fatal(err)
+			}
+			if r.read > tt.maxRead {
+				t.Errorf("UpdateSignature() read %v bytes, want up to %v", r.read, tt.maxRead)
+			}
+			wantHeader, wantBlocks, err := ReadSignature(&want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotHeader, gotBlocks, err := ReadSignature(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(wantHeader, gotHeader); diff != "" {
+				t.Errorf("UpdateSignature() header mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(wantBlocks, gotBlocks); diff != "" {
+				t.Errorf("UpdateSignature() blocks mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApp_UpdateSignatureErrors(t *testing.T) {
+	const blockSize = 64
+	target := bytes.Repeat([]byte("0123456789abcdef"), 16)
+	signature := func(opts ...Option) *bytes.Buffer {
+		t.Helper()
+		var b bytes.Buffer
+		if err := New(blockSize, opts...).SignatureAt(bytes.NewReader(target), int64(len(target)), &b); err != nil {
+			t.Fatal(err)
+		}
+		return &b
+	}
+	var unsized bytes.Buffer
+	header := New(blockSize).diffEngine.signatureHeader()
+	if err := writeSignature(&unsized, header, signatureTable{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		app       *App
+		signature *bytes.Buffer
+		size      int64
+		changed   []Range
+	}{
+		{name: "file hash", app: New(blockSize), signature: signature(WithFileHash(true)), size: int64(len(target))},
+		{name: "second pass", app: New(blockSize), signature: signature(WithSecondPass(16)), size: int64(len(target))},
+		{name: "unknown target size", app: New(blockSize), signature: &unsized, size: int64(len(target))},
+		{name: "other block size", app: New(32), signature: signature(), size: int64(len(target))},
+		{name: "other strong hash", app: New(0, WithStrongHash(StrongHashSHA256)), signature: signature(), size: int64(len(target))},
+		{name: "negative range", app: New(0), signature: signature(), size: int64(len(target)), changed: []Range{{Offset: -1, Length: 2}}},
+		{name: "single block target", app: New(0), signature: signature(), size: blockSize},
+		{name: "empty target", app: New(0), signature: signature(), size: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.app.UpdateSignature(tt.signature, bytes.NewReader(target), tt.size, tt.changed, &bytes.Buffer{})
+			if err == nil {
+				t.Error("UpdateSignature() error = nil, want non-nil")
+			}
+		})
+	}
+}
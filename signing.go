@@ -0,0 +1,110 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// artifactTrailerMagic starts the trailer of a signed artifact, followed by its Ed25519 signature.
+var artifactTrailerMagic = []byte("rdiffsig")
+
+// artifactTrailerSize is the size of the trailer of a signed artifact.
+var artifactTrailerSize = int64(len(artifactTrailerMagic) + ed25519.SignatureSize)
+
+// artifactSignOptions sign the SHA-512 hash of the artifacts, using Ed25519ph, so they are signed while they're
+// streamed.
+var artifactSignOptions = &ed25519.Options{Hash: crypto.SHA512}
+
+// signedOutput returns the writer of an artifact written to w, and the function appending its signature, once it's
+// complete, if the App is configured using WithSigningKey. Otherwise, it returns w, and a no-op function.
+func (a *App) signedOutput(w io.Writer) (io.Writer, func() error) {
+	if a.signingKey == nil {
+		return w, func() error { return nil }
+	}
+	h := sha512.New()
+
+	return io.MultiWriter(w, h), func() error {
+		return writeArtifactTrailer(w, a.signingKey, h)
+	}
+}
+
+// writeArtifactTrailer writes the trailer signing the artifact hashed by h to w.
+func writeArtifactTrailer(w io.Writer, key ed25519.PrivateKey, h hash.Hash) error {
+	sig, err := key.Sign(nil, h.Sum(nil), artifactSignOptions)
+	if err != nil {
+		return fmt.Errorf("signing the artifact: %w", err)
+	}
+	_, err = w.Write(append(bytes.Clone(artifactTrailerMagic), sig...))
+
+	return err
+}
+
+// VerifyArtifact verifies the artifact r, which has the given size, was signed by the private key of the public key,
+// see WithSigningKey, and returns the size of its content, without the signature. An artifact which isn't signed,
+// or whose signature isn't valid, returns a non-nil error matching ErrVerification.
+func VerifyArtifact(key ed25519.PublicKey, r io.ReaderAt, size int64) (int64, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return 0, fmt.Errorf("invalid Ed25519 public key size: %v", len(key))
+	}
+	trailer := make([]byte, artifactTrailerSize)
+	if size >= artifactTrailerSize {
+		_, err := r.ReadAt(trailer, size-artifactTrailerSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+	}
+	if size < artifactTrailerSize || !bytes.HasPrefix(trailer, artifactTrailerMagic) {
+		return 0, markError(ErrVerification, errors.New("the artifact is not signed"))
+	}
+	contentSize := size - artifactTrailerSize
+	h := sha512.New()
+	n, err := io.Copy(h, io.NewSectionReader(r, 0, contentSize))
+	if err != nil {
+		return 0, err
+	}
+	if n != contentSize {
+		return 0, markError(ErrModified, errors.New("the artifact was truncated while it was read"))
+	}
+	err = ed25519.VerifyWithOptions(key, h.Sum(nil), trailer[len(artifactTrailerMagic):], artifactSignOptions)
+	if err != nil {
+		return 0, markError(ErrVerification, fmt.Errorf("the artifact signature is not valid: %w", err))
+	}
+
+	return contentSize, nil
+}
+
+// verifiedArtifact verifies the artifact r, if the App is configured using WithVerifyKey, and returns the reader of its
+// content, without the signature, and a function releasing it. The artifact is spooled to a temporary file, even a
+// regular file, which could be rewritten once verified, and it's verified there, before any of its content is used,
+// so the content used is always the one verified. Without a key, it returns r, and a no-op function.
+func (a *App) verifiedArtifact(r io.Reader) (io.Reader, func() error, error) {
+	if a.verifyKey == nil {
+		return r, func() error { return nil }, nil
+	}
+
+	return a.spoolArtifact(r)
+}
+
+// spoolArtifact copies the artifact r to a temporary file, and verifies it, see verifiedArtifact.
+func (a *App) spoolArtifact(r io.Reader) (io.Reader, func() error, error) {
+	f, release, err := createSpool("rdiff-verify-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		return nil, nil, errors.Join(err, release())
+	}
+	size, err := VerifyArtifact(a.verifyKey, f, n)
+	if err != nil {
+		return nil, nil, errors.Join(err, release())
+	}
+
+	return io.NewSectionReader(f, 0, size), release, nil
+}
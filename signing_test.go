@@ -0,0 +1,117 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testSigningKey returns the Ed25519 key derived from the seed byte.
+func testSigningKey(seed byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+}
+
+func TestApp_WithSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := bytes.Repeat([]byte("0123456789abcdef"), 256)
+	source := append(bytes.Clone(target[:2000]), []byte("a change")...)
+	source = append(source, target[2000:]...)
+	for name, data := range map[string][]byte{"target": target, "source": source} {
+		if err := os.WriteFile(path(name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := testSigningKey(1)
+	app := New(64, WithSigningKey(key), WithVerifyKey(key.Public().(ed25519.PublicKey)))
+	if err := app.Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(path("signature"), path("source"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Patch(path("target"), path("delta"), path("out")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path("out")); !bytes.Equal(got, source) {
+		t.Error("Patch() doesn't rebuild the source")
+	}
+
+	// the streamed artifacts are staged to be verified
+	signature, err := os.ReadFile(path("signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var delta, out bytes.Buffer
+	if err := app.DeltaStream(bytes.NewReader(signature), bytes.NewReader(source), int64(len(source)), &delta); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Apply(bytes.NewReader(target), int64(len(target)), &delta, &out); err != nil || !bytes.Equal(out.Bytes(), source) {
+		t.Errorf("Apply() doesn't rebuild the source, error = %v", err)
+	}
+	if size, err := VerifyArtifact(key.Public().(ed25519.PublicKey), bytes.NewReader(signature), int64(len(signature))); err != nil || size != int64(len(signature))-artifactTrailerSize {
+		t.Errorf("VerifyArtifact() = %v, %v, want %v", size, err, int64(len(signature))-artifactTrailerSize)
+	}
+}
+
+func TestApp_WithVerifyKey_Errors(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := bytes.Repeat([]byte("0123456789abcdef"), 256)
+	if err := os.WriteFile(path("target"), target, 0666); err != nil {
+		t.Fatal(err)
+	}
+	key, other := testSigningKey(1), testSigningKey(2)
+	signer := New(64, WithSigningKey(key))
+	if err := signer.Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(64).Signature(path("target"), path("unsigned.signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Delta(path("unsigned.signature"), path("target"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+	delta, err := os.ReadFile(path("delta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta[len(delta)/2] ^= 0xFF
+	if err := os.WriteFile(path("tampered.delta"), delta, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := New(64, WithVerifyKey(key.Public().(ed25519.PublicKey)))
+	tests := []struct {
+		name string
+		fn   func() error
+		want error
+	}{
+		{name: "unsigned signature", fn: func() error { return verifier.Delta(path("unsigned.signature"), path("target"), path("d1")) }, want: ErrVerification},
+		{name: "tampered delta", fn: func() error { return verifier.Patch(path("target"), path("tampered.delta"), path("o1")) }, want: ErrVerification},
+		{name: "other key", fn: func() error {
+			return New(64, WithVerifyKey(other.Public().(ed25519.PublicKey))).Patch(path("target"), path("delta"), path("o2"))
+		}, want: ErrVerification},
+		{name: "streamed tampered delta", fn: func() error {
+			return verifier.Apply(bytes.NewReader(target), int64(len(target)), bytes.NewReader(delta), &bytes.Buffer{})
+		}, want: ErrVerification},
+		{name: "checkpointed", fn: func() error {
+			return New(64, WithSigningKey(key), WithCheckpoint(path("checkpoint"), 1024)).Signature(path("target"), path("s1"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fn()
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	// nothing is written by a delta which isn't verified
+	if _, err := os.Stat(path("o1")); err == nil {
+		t.Error("Patch() of a tampered delta wrote the output")
+	}
+}
@@ -0,0 +1,94 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// blockKey identifies the content of a block, by its hashes.
+type blockKey struct {
+	weak   uint64
+	strong string
+}
+
+// Similarity returns the fraction of the blocks shared by the signatures a and b, as returned by ReadSignature,
+// from 0, nothing in common, to 1, the same blocks, ignoring their order: the number of blocks of a also found in b,
+// every block of b being counted once, divided by the number of blocks of the largest signature. So it's a cheap
+// estimate of how well one file works as the basis of a delta for the other one, or a near-duplicate detection,
+// without computing a delta. The signatures must be computed with the same hashes, and block size, see
+// App.Similarity for the files. Two empty signatures are the same.
+func Similarity(a, b []Block) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	counts := make(map[blockKey]int, len(b))
+	for _, bl := range b {
+		counts[blockKey{weak: bl.WeakHash, strong: string(bl.StrongHash)}]++
+	}
+	shared := 0
+	for _, bl := range a {
+		key := blockKey{weak: bl.WeakHash, strong: string(bl.StrongHash)}
+		if counts[key] > 0 {
+			counts[key]--
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(max(len(a), len(b)))
+}
+
+// Similarity returns the fraction of the blocks shared by the signature files, see Similarity, as written by
+// Signature, in the configured format.
+// It returns a non-nil error if the signatures are computed with different hashes, or block sizes, as their blocks
+// can't be compared.
+func (a *App) Similarity(signaturePathA, signaturePathB string) (float64, error) {
+	headerA, sigA, err := a.loadSignature(signaturePathA)
+	if err != nil {
+		return 0, err
+	}
+	headerB, sigB, err := a.loadSignature(signaturePathB)
+	if err != nil {
+		return 0, err
+	}
+	err = checkComparable(headerA, headerB)
+	if err != nil {
+		return 0, err
+	}
+
+	return Similarity(sigA.blocks(headerA), sigB.blocks(headerB)), nil
+}
+
+// loadSignature reads the signature file, in the configured format.
+func (a *App) loadSignature(signaturePath string) (SignatureHeader, signatureTable, error) {
+	signatureFile, err := a.openSignature(signaturePath)
+	if err != nil {
+		return SignatureHeader{}, signatureTable{}, err
+	}
+	header, sig, err := a.readSignature(signatureFile)
+	err = errors.Join(err, signatureFile.Close())
+	if err != nil {
+		return SignatureHeader{}, signatureTable{}, fmt.Errorf("reading the signature %v: %w", signaturePath, err)
+	}
+
+	return header, sig, nil
+}
+
+// checkComparable returns a non-nil error if the blocks of the signatures having the headers a and b can't be
+// compared: the hashes differ, or the block sizes, if both are recorded.
+func checkComparable(a, b SignatureHeader) error {
+	if a.WeakHash != b.WeakHash || a.StrongHash != b.StrongHash || a.StrongHashSize != b.StrongHashSize {
+		return fmt.Errorf(
+			"the signatures hashes differ: %v, %v(%v bytes) and %v, %v(%v bytes)",
+			a.WeakHash, a.StrongHash, a.StrongHashSize, b.WeakHash, b.StrongHash, b.StrongHashSize,
+		)
+	}
+	if !bytes.Equal(a.StrongHashKeyID, b.StrongHashKeyID) {
+		return errors.New("the signatures strong hashes are keyed differently")
+	}
+	if a.BlockSize > 0 && b.BlockSize > 0 && a.BlockSize != b.BlockSize {
+		return fmt.Errorf("the signatures block sizes differ: %v and %v", a.BlockSize, b.BlockSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package rdiff
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSimilarity(t *testing.T) {
+	block := func(weak uint64, strong byte) Block {
+		return Block{WeakHash: weak, StrongHash: []byte{strong}}
+	}
+	tests := []struct {
+		name string
+		a, b []Block
+		want float64
+	}{
+		{name: "empty", want: 1},
+		{name: "one empty", a: []Block{block(1, 1)}, want: 0},
+		{name: "same", a: []Block{block(1, 1), block(2, 2)}, b: []Block{block(1, 1), block(2, 2)}, want: 1},
+		{name: "reordered", a: []Block{block(1, 1), block(2, 2)}, b: []Block{block(2, 2), block(1, 1)}, want: 1},
+		{name: "half", a: []Block{block(1, 1), block(2, 2)}, b: []Block{block(1, 1), block(3, 3)}, want: 0.5},
+		{name: "same weak hash", a: []Block{block(1, 1)}, b: []Block{block(1, 2)}, want: 0},
+		{name: "repeated block counted once", a: []Block{block(1, 1), block(1, 1)}, b: []Block{block(1, 1), block(2, 2)}, want: 0.5},
+		{name: "larger signature", a: []Block{block(1, 1)}, b: []Block{block(1, 1), block(2, 2), block(3, 3), block(4, 4)}, want: 0.25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Similarity(tt.a, tt.b); got != tt.want {
+				t.Errorf("Similarity() = %v, want %v", got, tt.want)
+			}
+			if got := Similarity(tt.b, tt.a); got != tt.want {
+				t.Errorf("Similarity() of the swapped signatures = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApp_Similarity(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	write := func(name, content string) {
+		if err := os.WriteFile(path(name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a", "0123456789abcdef")
+	write("b", "0123xxxx89abyyyy")
+	for _, sig := range []struct {
+		name, file string
+		app        *App
+	}{
+		{name: "a.sig", file: "a", app: New(4)},
+		{name: "b.sig", file: "b", app: New(4)},
+		{name: "b.sig8", file: "b", app: New(8)},
+		{name: "b.sha256", file: "b", app: New(4, WithStrongHash(StrongHashSHA256))},
+	} {
+		if err := sig.app.Signature(path(sig.file), path(sig.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := New(0).Similarity(path("a.sig"), path("b.sig"))
+	if err != nil || got != 0.5 {
+		t.Errorf("Similarity() = %v, %v, want 0.5", got, err)
+	}
+	for _, other := range []string{"b.sig8", "b.sha256"} {
+		if _, err := New(0).Similarity(path("a.sig"), path(other)); err == nil {
+			t.Errorf("Similarity() of %v error = nil, want an error", other)
+		}
+	}
+	if _, err := New(0).Similarity(path("a.sig"), path("missing")); err == nil {
+		t.Errorf("Similarity() of a missing signature error = nil, want an error")
+	}
+}
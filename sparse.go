@@ -0,0 +1,165 @@
+package rdiff
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// zeroChunk is written, as many times as needed, for the zero runs which can't be left as holes.
+var zeroChunk = make([]byte, 64<<10)
+
+// isZero reports whether p holds only zeros.
+func isZero(p []byte) bool {
+	for len(p) >= len(zeroChunk) {
+		if !bytes.Equal(p[:len(zeroChunk)], zeroChunk) {
+			return false
+		}
+		p = p[len(zeroChunk):]
+	}
+
+	return bytes.Equal(p, zeroChunk[:len(p)])
+}
+
+// appendZeroBlockSums appends the weak and strong hashes of a zero block to the signature columns, computing them
+// only for the first zero block of the block size.
+func (r *rDiff) appendZeroBlockSums(weak []uint64, strong []byte) ([]uint64, []byte) {
+	if r.zeroBlock.size != r.blockSize || r.zeroBlock.strong == nil {
+		block := make([]byte, r.blockSize)
+		r.weakHasher.WriteAll(block)
+		r.zeroBlock = zeroBlockSums{size: r.blockSize, weak: r.weakHasher.Sum(), strong: r.appendStrongSum(nil, block)}
+	}
+
+	return append(weak, r.zeroBlock.weak), append(strong, r.zeroBlock.strong...)
+}
+
+// zeroChunks passes n zero bytes to fn, in chunks, stopping at the first non-nil error.
+func zeroChunks(n int64, fn func([]byte) error) error {
+	for n > 0 {
+		c := min(n, int64(len(zeroChunk)))
+		err := fn(zeroChunk[:c])
+		if err != nil {
+			return err
+		}
+		n -= c
+	}
+
+	return nil
+}
+
+// zeroWriter is implemented by the outputs which write the zero runs without writing their bytes, ex: as holes.
+type zeroWriter interface {
+	WriteZeros(n int64) error
+}
+
+// writeZeros writes n zero bytes to w, using its WriteZeros method, if it's a zeroWriter.
+func writeZeros(w io.Writer, n int64) error {
+	if zw, ok := w.(zeroWriter); ok {
+		return zw.WriteZeros(n)
+	}
+
+	return zeroChunks(n, func(p []byte) error {
+		_, err := w.Write(p)
+		return err
+	})
+}
+
+// applyZeros writes the zero run of an OpBlockZero.
+func (r *rDiff) applyZeros(op Operation, output io.Writer) error {
+	if op.Zeros <= 0 || len(op.Data) != 0 {
+		return markError(ErrCorrupt, fmt.Errorf("invalid zero run: %v bytes, with %v bytes of data", op.Zeros, len(op.Data)))
+	}
+	err := writeZeros(output, op.Zeros)
+	if err != nil {
+		return err
+	}
+	r.patchStats.ZeroBytes += op.Zeros
+
+	return nil
+}
+
+// sparseWriter buffers the writes to a new file, leaving the zero runs as holes, by seeking over them.
+type sparseWriter struct {
+	f *os.File
+	// bw buffers the writes to the file, through the progress, if any
+	bw *bufio.Writer
+	// off is the size of the file written so far, including the holes
+	off int64
+	// hole means the file ends with a hole, so it's extended to off by Flush
+	hole bool
+}
+
+func (w *sparseWriter) Write(p []byte) (int, error) {
+	n, err := w.bw.Write(p)
+	w.off += int64(n)
+	if n > 0 {
+		w.hole = false
+	}
+
+	return n, err
+}
+
+// WriteZeros skips n bytes, leaving a hole.
+func (w *sparseWriter) WriteZeros(n int64) error {
+	err := w.bw.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = w.f.Seek(n, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	w.off += n
+	w.hole = true
+
+	return nil
+}
+
+// Flush writes the buffered data, and extends the file to its size, if it ends with a hole.
+func (w *sparseWriter) Flush() error {
+	err := w.bw.Flush()
+	if err != nil || !w.hole {
+		return err
+	}
+
+	return w.f.Truncate(w.off)
+}
+
+// holeReader reads a file, which has the given size, returning the zeros of its holes without reading them.
+// The holes are located using SEEK_DATA and SEEK_HOLE, where the platform supports them, otherwise the whole file
+// is read as data.
+type holeReader struct {
+	f    *os.File
+	size int64
+	off  int64
+	// holeEnd is the end of the hole at off, if any, and dataEnd is the end of the data region following it
+	holeEnd int64
+	dataEnd int64
+}
+
+func (r *holeReader) Read(p []byte) (int, error) {
+	if r.off >= r.size {
+		return 0, io.EOF
+	}
+	if r.off >= r.holeEnd && r.off >= r.dataEnd {
+		r.holeEnd, r.dataEnd = nextData(r.f, r.off, r.size)
+		// a region not moving forward is read as data, up to the end of the file
+		r.dataEnd = max(r.dataEnd, r.holeEnd+1, r.off+1)
+	}
+	if r.off < r.holeEnd {
+		n := int(min(int64(len(p)), r.holeEnd-r.off))
+		clear(p[:n])
+		r.off += int64(n)
+		return n, nil
+	}
+	n, err := r.f.ReadAt(p[:min(int64(len(p)), r.dataEnd-r.off)], r.off)
+	r.off += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+
+	return n, err
+}
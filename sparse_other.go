@@ -0,0 +1,11 @@
+//go:build !(darwin || freebsd || linux)
+
+package rdiff
+
+import "os"
+
+// nextData returns the data region of the file, at or after off, which is the rest of the file, as the platform
+// doesn't locate the holes.
+func nextData(_ *os.File, off, size int64) (int64, int64) {
+	return off, size
+}
@@ -0,0 +1,183 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// sparseFile writes a file holding the data regions at their offsets, the rest of its size being holes, where
+// the filesystem supports them.
+func sparseFile(t *testing.T, p string, size int64, data map[int64][]byte) []byte {
+	t.Helper()
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	content := make([]byte, size)
+	for off, d := range data {
+		if _, err := f.WriteAt(d, off); err != nil {
+			t.Fatal(err)
+		}
+		copy(content[off:], d)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatal(err)
+	}
+
+	return content
+}
+
+func TestIsZero(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		p    []byte
+		want bool
+	}{
+		{name: "empty", p: nil, want: true},
+		{name: "zeros", p: make([]byte, 3*len(zeroChunk)+5), want: true},
+		{name: "first byte", p: append([]byte{1}, make([]byte, len(zeroChunk))...)},
+		{name: "last byte", p: append(make([]byte, 2*len(zeroChunk)), 1)},
+	} {
+		if got := isZero(tt.p); got != tt.want {
+			t.Errorf("%v: isZero() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHoleReader(t *testing.T) {
+	const size = 1 << 20
+	for _, tt := range []struct {
+		name string
+		data map[int64][]byte
+	}{
+		{name: "no data"},
+		{name: "leading hole", data: map[int64][]byte{size - 10: []byte("end")}},
+		{name: "middle hole", data: map[int64][]byte{0: []byte("start"), size - 3: []byte("end")}},
+		{name: "trailing hole", data: map[int64][]byte{5: bytes.Repeat([]byte("x"), 100000)}},
+	} {
+		p := filepath.Join(t.TempDir(), "file")
+		want := sparseFile(t, p, size, tt.data)
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(&holeReader{f: f, size: size})
+		f.Close()
+		if err != nil {
+			t.Fatalf("%v: holeReader.Read() error = %v", tt.name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%v: holeReader.Read() differs from the file content", tt.name)
+		}
+	}
+}
+
+func TestApp_Sparse(t *testing.T) {
+	const blockSize, size = 1024, 4 << 20
+	dir := t.TempDir()
+	target, source := filepath.Join(dir, "target"), filepath.Join(dir, "source")
+	head, tail := bytes.Repeat([]byte("head"), 1000), bytes.Repeat([]byte("tail"), 1000)
+	sparseFile(t, target, 64<<10, map[int64][]byte{0: head, 32 << 10: tail})
+	want := sparseFile(t, source, size, map[int64][]byte{0: head, 2 << 20: tail})
+
+	app := New(blockSize, WithSparse(true))
+	signature, delta := filepath.Join(dir, "signature"), filepath.Join(dir, "delta")
+	if err := app.Signature(target, signature); err != nil {
+		t.Fatalf("Signature() error = %v", err)
+	}
+	if err := app.Delta(signature, source, delta); err != nil {
+		t.Fatalf("Delta() error = %v", err)
+	}
+	stats := app.LastDeltaStats()
+	if stats.ZeroBytes < size-(64<<10) || stats.LiteralBytes > int64(len(tail)+blockSize) {
+		t.Errorf("Delta() stats = %+v, want the zeros sent as zero runs", stats)
+	}
+
+	// a patch without the sparse option writes the zeros
+	for _, sparse := range []bool{true, false} {
+		output := filepath.Join(t.TempDir(), "output")
+		if err := New(blockSize, WithSparse(sparse)).Patch(target, delta, output); err != nil {
+			t.Fatalf("sparse %v: Patch() error = %v", sparse, err)
+		}
+		got, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("sparse %v: Patch() output differs from the source", sparse)
+		}
+		if sparse && runtime.GOOS == "linux" {
+			f, err := os.Open(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the zeros following the head are a hole
+			if _, end := nextData(f, 0, size); end >= 2<<20 {
+				t.Errorf("Patch() output data ends at %v, want a hole", end)
+			}
+			f.Close()
+		}
+	}
+
+	// the sparse signature is the same
+	plain := filepath.Join(dir, "signature.plain")
+	if err := New(blockSize).Signature(target, plain); err != nil {
+		t.Fatalf("Signature() error = %v", err)
+	}
+	got, err := os.ReadFile(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSig, err := os.ReadFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, wantSig) {
+		t.Errorf("Signature() of a sparse app differs from the default one")
+	}
+}
+
+func TestApp_Sparse_Formats(t *testing.T) {
+	const blockSize = 4
+	target := []byte("abcdefgh")
+	source := append(append([]byte("abcd"), make([]byte, 3*blockSize)...), "efgh"...)
+	var sig bytes.Buffer
+	if err := New(blockSize).SignatureAt(bytes.NewReader(target), int64(len(target)), &sig); err != nil {
+		t.Fatal(err)
+	}
+	app := New(blockSize, WithSparse(true), WithFormat(FormatVCDIFF))
+	var delta bytes.Buffer
+	if err := app.delta(&sig, bytes.NewReader(source), DeltaHeader{SourceSize: int64(len(source))}, &delta); err != nil {
+		t.Fatalf("delta() error = %v", err)
+	}
+	if app.LastDeltaStats().ZeroBytes != 3*blockSize {
+		t.Errorf("delta() stats = %+v, want %v zero bytes", app.LastDeltaStats(), 3*blockSize)
+	}
+	got, err := vcdiffDecode(target, delta.Bytes())
+	if err != nil {
+		t.Fatalf("applying the VCDIFF delta error = %v", err)
+	}
+	if !bytes.Equal(got, source) {
+		t.Errorf("the VCDIFF delta rebuilt %q, want %q", got, source)
+	}
+}
+
+func TestApp_Apply_InvalidZeros(t *testing.T) {
+	for _, op := range []Operation{
+		{Type: OpBlockZero, BlockIndex: -1},
+		{Type: OpBlockZero, BlockIndex: -1, Zeros: -1},
+		{Type: OpBlockZero, BlockIndex: -1, Zeros: 1, Data: []byte{0}},
+	} {
+		a := New(4)
+		err := a.Apply(bytes.NewReader(nil), 0, bytes.NewReader(deltaBytes(t, DeltaHeader{SourceSize: 1}, []Operation{op})), io.Discard)
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Apply(%+v) error = %v, want a %v error", op, err, ErrCorrupt)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+//go:build darwin || freebsd || linux
+
+package rdiff
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// nextData returns the start and the end of the first data region of the file, which has the given size, at
+// or after off, using SEEK_DATA and SEEK_HOLE. A filesystem without holes support reports the file as a single
+// data region, and the errors are ignored, reading the file as data.
+func nextData(f *os.File, off, size int64) (int64, int64) {
+	start, err := f.Seek(off, unix.SEEK_DATA)
+	if errors.Is(err, unix.ENXIO) {
+		// there's no data after off
+		return size, size
+	}
+	if err != nil {
+		return off, size
+	}
+	end, err := f.Seek(start, unix.SEEK_HOLE)
+	if err != nil {
+		return start, size
+	}
+
+	return min(start, size), min(end, size)
+}
@@ -0,0 +1,65 @@
+package rdiff
+
+import "os"
+
+// literalSpill holds the head of a literal run exceeding the memory budget, see WithMaxMemory, in a temporary file,
+// so only the tail of the run is kept in memory. The file is reused by the following runs, every run starting at
+// the offset 0.
+type literalSpill struct {
+	f       *os.File
+	release func() error
+	// size is the number of bytes of the current run spilled to the file
+	size int64
+}
+
+// spillLiteral appends the literal to the spilled head of the literal run, creating the spill file on the first
+// call. The spilled bytes are emitted, by offset, once the run ends, see flushSpill.
+func (d *deltaEmitter) spillLiteral(literal []byte) error {
+	if d.spill == nil {
+		f, release, err := createSpool("rdiff-literal-*")
+		if err != nil {
+			return err
+		}
+		d.spill = &literalSpill{f: f, release: release}
+	}
+	n, err := d.spill.f.WriteAt(literal, d.spill.size)
+	d.spill.size += int64(n)
+
+	return err
+}
+
+// flushSpill emits the spilled head of the literal run, if any, as new blocks, reading it back from the spill file
+// a chunk of maxMemory bytes at a time, and emitting every chunk as it's read, so it's never held in memory, even if
+// the literals are coalesced. It follows the held run of matches, and the pending literal data, if any, and it
+// precedes the tail of the run, held by the caller.
+func (d *deltaEmitter) flushSpill() error {
+	if d.spill == nil || d.spill.size == 0 {
+		return nil
+	}
+	err := d.dropRun()
+	if err == nil {
+		err = d.flushPending()
+	}
+	chunk := make([]byte, min(d.spill.size, int64(max(d.maxMemory, 1))))
+	for off := int64(0); err == nil && off < d.spill.size; off += int64(len(chunk)) {
+		chunk = chunk[:min(int64(len(chunk)), d.spill.size-off)]
+		_, err = d.spill.f.ReadAt(chunk, off)
+		if err == nil {
+			err = d.newBlocks(chunk)
+		}
+	}
+	d.spill.size = 0
+
+	return err
+}
+
+// closeSpill removes the spill file, if any.
+func (d *deltaEmitter) closeSpill() error {
+	if d.spill == nil {
+		return nil
+	}
+	err := d.spill.release()
+	d.spill = nil
+
+	return err
+}
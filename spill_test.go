@@ -0,0 +1,123 @@
+package rdiff
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestDeltaEmitter_Spill(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	var ops []Operation
+	d := &deltaEmitter{
+		emit:      func(op Operation) error { ops = append(ops, op); return nil },
+		blocks:    2,
+		maxMemory: 4,
+	}
+	// the literal run preceding the block 0 reaches the budget 3 times, and ends with a tail kept in memory
+	for _, p := range []string{"abcd", "efgh", "ij"} {
+		if err := d.spillLiteral([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(ops) != 0 {
+		t.Fatalf("spillLiteral() emitted %v operations, want none until the run ends", len(ops))
+	}
+	if err := d.match(0, []byte("kl"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.spillLiteral([]byte("mnop")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.finish([]byte("q")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.closeSpill(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, op := range ops {
+		got = append(got, fmt.Sprintf("%v:%s", op.Type, op.Data))
+	}
+	want := []string{"new:abcd", "new:efgh", "new:ij", "update:kl", "remove:", "new:mnop", "new:q"}
+	if !slices.Equal(got, want) {
+		t.Errorf("the operations = %v, want %v", got, want)
+	}
+	if names := dirNames(t, dir); len(names) != 0 {
+		t.Errorf("the temporary directory holds %v after closeSpill(), want nothing", names)
+	}
+}
+
+func TestDeltaEmitter_SpillCoalesced(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	var ops []Operation
+	d := &deltaEmitter{
+		emit:      func(op Operation) error { ops = append(ops, op); return nil },
+		blocks:    2,
+		coalesce:  true,
+		maxMemory: 4,
+	}
+	// the pending literal precedes the spilled head of the run, which isn't held in memory again
+	if err := d.addLiteral([]byte("ab")); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"cdef", "ghij"} {
+		if err := d.spillLiteral([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.match(0, []byte("kl"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.pending) != 0 {
+		t.Errorf("the emitter holds %q after the match, want nothing", d.pending)
+	}
+	if err := d.finish(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.closeSpill(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, op := range ops {
+		got = append(got, fmt.Sprintf("%v:%s", op.Type, op.Data))
+	}
+	want := []string{"new:ab", "new:cdef", "new:ghij", "update:kl", "remove:"}
+	if !slices.Equal(got, want) {
+		t.Errorf("the operations = %v, want %v", got, want)
+	}
+}
+
+func TestApp_WithMaxMemory_CoalesceLiterals(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	const blockSize, maxMemory = 64, 1 << 10
+	target := randomBytes(1, 64<<10)
+	// the source has nothing in common with the target but a few blocks, so its literal runs exceed the budget
+	source := randomBytes(2, 256<<10)
+	copy(source[100<<10:], target[:4*blockSize])
+	copy(source[200<<10:], target[32<<10:32<<10+blockSize])
+	r := New(blockSize, WithMaxMemory(maxMemory), WithCoalesceLiterals(true)).diffEngine
+	sig, err := r.ComputeSignature(bytes.NewReader(target))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []Operation
+	err = r.ComputeDeltaFunc(bytes.NewReader(source), r.signatureHeader(), sig, func(op Operation) error {
+		// the literal data of an operation is the pending data and the tail of the run, both under the budget
+		if len(op.Data) >= 2*maxMemory {
+			t.Fatalf("an operation holds %v bytes of literal data, over the memory budget of %v", len(op.Data), maxMemory)
+		}
+		ops = append(ops, op)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rebuild(target, blockSize, ops); !bytes.Equal(got, source) {
+		t.Error("the delta doesn't rebuild the source")
+	}
+}
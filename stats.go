@@ -0,0 +1,75 @@
+package rdiff
+
+// DeltaStats holds statistics about a delta computation.
+type DeltaStats struct {
+	// SearchListMemory is the memory used, in bytes, to index the signature blocks for the weak hash lookups
+	SearchListMemory int64
+	// MapSearchListMemory is the estimated memory, in bytes, a map of the weak hashes to the lists of their blocks,
+	// the index used before the two level table of SearchListMemory, would use for the same signature, so the two can
+	// be compared
+	MapSearchListMemory int64
+	// MatchedBlocks is the number of target blocks found in the source, so they are not part of the delta
+	MatchedBlocks int64
+	// ReusedBlocks is the number of MatchedBlocks found again in the source, after their own operation, see
+	// WithBlockReuse
+	ReusedBlocks int64
+	// LiteralBytes is the number of source bytes not found in the target, sent as data by the delta
+	LiteralBytes int64
+	// ZeroBytes is the number of source bytes sent as zero runs by a sparse delta, see WithSparse
+	ZeroBytes int64
+	// WeakHashCollisions is the number of target blocks whose weak hash matched a window of the source, but not
+	// their strong hash, so their strong hash was computed for nothing
+	WeakHashCollisions int64
+	// PartBlocks is the number of second pass blocks found in the literal regions of the source, see WithSecondPass
+	PartBlocks int64
+	// Unchanged means the delta only keeps the target blocks, all of them, so the source equals the target, and
+	// applying the delta is a no-op, see WithSkipUnchanged
+	Unchanged bool
+}
+
+// PatchStats holds statistics about a delta application.
+type PatchStats struct {
+	// CopiedBlocks is the number of target blocks copied to the output
+	CopiedBlocks int64
+	// CopiedBytes is the number of bytes copied from the target to the output
+	CopiedBytes int64
+	// LiteralBytes is the number of bytes written to the output from the delta data
+	LiteralBytes int64
+	// ZeroBytes is the number of bytes written to the output from the delta zero runs
+	ZeroBytes int64
+}
+
+// unchanged reports whether the delta of a target of the given number of blocks only keeps them: every target block
+// has a single operation, so a delta without data, nor reused blocks, matching all of them only keeps them.
+func (s DeltaStats) unchanged(blocks int64) bool {
+	return s.MatchedBlocks == blocks && s.ReusedBlocks == 0 && s.PartBlocks == 0 && s.LiteralBytes == 0 && s.ZeroBytes == 0
+}
+
+// LastDeltaStats returns the statistics of the last Delta call.
+func (a *App) LastDeltaStats() DeltaStats {
+	return a.diffEngine.stats
+}
+
+// LastPatchStats returns the statistics of the last Patch or Apply call.
+func (a *App) LastPatchStats() PatchStats {
+	return a.diffEngine.patchStats
+}
+
+// countingEmit returns an emit function which records the delta stats of the operations, before passing them to emit.
+func (r *rDiff) countingEmit(emit func(Operation) error) func(Operation) error {
+	return func(op Operation) error {
+		r.stats.LiteralBytes += int64(len(op.Data))
+		r.stats.ZeroBytes += op.Zeros
+		if op.Type.copiesBlock() {
+			r.stats.MatchedBlocks++
+		}
+		switch op.Type {
+		case OpBlockCopy:
+			r.stats.ReusedBlocks++
+		case OpBlockPart:
+			r.stats.PartBlocks++
+		}
+
+		return emit(op)
+	}
+}
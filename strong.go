@@ -0,0 +1,117 @@
+package rdiff
+
+import (
+	"crypto/hmac"
+	"crypto/md5"  // nolint
+	"crypto/sha1" // nolint
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/md4" // nolint
+)
+
+// strongHashKeyIDSize is the number of bytes used to identify a strong hash key
+const strongHashKeyIDSize = 8
+
+// maxStrongHashSize is the size, in bytes, of the longest strong hash supported
+const maxStrongHashSize = 32
+
+// StrongHashType identifies the hash algorithm used to compute the Block.StrongHash.
+type StrongHashType byte
+
+const (
+	// StrongHashMD5 is the default strong hash, it's fast and good enough to confirm a weak hash match.
+	StrongHashMD5 StrongHashType = iota
+	// StrongHashSHA1 is the SHA-1 hash.
+	StrongHashSHA1
+	// StrongHashSHA256 is the SHA-256 hash, it's slower but collision resistant.
+	StrongHashSHA256
+	// StrongHashMD4 is the MD4 hash, the strong hash of the librsync MD4 signatures, it's not collision resistant.
+	StrongHashMD4
+	// StrongHashBLAKE2b is the 256 bits BLAKE2b hash, the strong hash of the default librsync signatures.
+	StrongHashBLAKE2b
+)
+
+// String returns the name of the strong hash algorithm.
+func (t StrongHashType) String() string {
+	switch t {
+	case StrongHashMD5:
+		return "md5"
+	case StrongHashSHA1:
+		return "sha1"
+	case StrongHashSHA256:
+		return "sha256"
+	case StrongHashMD4:
+		return "md4"
+	case StrongHashBLAKE2b:
+		return "blake2b"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler, using the name of the strong hash algorithm.
+func (t StrongHashType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, it accepts the names returned by String,
+// and returns a non-nil error for an unknown name.
+func (t *StrongHashType) UnmarshalText(text []byte) error {
+	for _, h := range []StrongHashType{StrongHashMD5, StrongHashSHA1, StrongHashSHA256, StrongHashMD4, StrongHashBLAKE2b} {
+		if string(text) == h.String() {
+			*t = h
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown strong hash: %q", text)
+}
+
+// newStrongHash constructs the strong hash identified by t, used to confirm the weak hash matches,
+// or returns a non-nil error if t is unknown.
+// A non-empty key means the hash is keyed, using HMAC, so its values can't be predicted without knowing the key.
+func newStrongHash(t StrongHashType, key []byte) (hash.Hash, error) {
+	var h func() hash.Hash
+	switch t {
+	case StrongHashMD5:
+		h = md5.New
+	case StrongHashSHA1:
+		h = sha1.New
+	case StrongHashSHA256:
+		h = sha256.New
+	case StrongHashMD4:
+		h = md4.New
+	case StrongHashBLAKE2b:
+		h = newBLAKE2b256
+	default:
+		return nil, fmt.Errorf("unknown strong hash type: %v", t)
+	}
+	if len(key) == 0 {
+		return h(), nil
+	}
+
+	return hmac.New(h, key), nil
+}
+
+// newBLAKE2b256 returns an unkeyed 256 bits BLAKE2b hash, the key of an HMAC is applied on top of it.
+func newBLAKE2b256() hash.Hash {
+	h, _ := blake2b.New256(nil)
+
+	return h
+}
+
+// strongHashKeyID derives a short identifier from the strong hash key, allowing the delta computation to detect
+// a key mismatch with the signature, without revealing the key.
+// It returns nil for an empty key.
+func strongHashKeyID(key []byte) []byte {
+	if len(key) == 0 {
+		return nil
+	}
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte("rdiff strong hash key id"))
+
+	return mac.Sum(nil)[:strongHashKeyIDSize]
+}
@@ -0,0 +1,86 @@
+package rdiff
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewStrongHash(t *testing.T) {
+	data := []byte{1, 2, 3, 4, 5, 6, 7}
+	sum := func(key []byte) []byte {
+		h, _ := newStrongHash(StrongHashMD5, key)
+		h.Write(data)
+		return h.Sum(nil)
+	}
+
+	if !bytes.Equal(sum(nil), sum([]byte{})) {
+		t.Errorf("newStrongHash(): an empty key must produce an un-keyed hash")
+	}
+	if bytes.Equal(sum(nil), sum([]byte("secret"))) {
+		t.Errorf("newStrongHash(): a keyed hash must differ from the un-keyed one")
+	}
+	if bytes.Equal(sum([]byte("secret")), sum([]byte("other"))) {
+		t.Errorf("newStrongHash(): different keys must produce different hashes")
+	}
+	if !bytes.Equal(sum([]byte("secret")), sum([]byte("secret"))) {
+		t.Errorf("newStrongHash(): the same key must produce the same hash")
+	}
+}
+
+var testsNewStrongHashType = []struct {
+	in      StrongHashType
+	size    int
+	wantErr bool
+}{
+	{in: StrongHashMD5, size: 16},
+	{in: StrongHashSHA1, size: 20},
+	{in: StrongHashSHA256, size: 32},
+	{in: StrongHashMD4, size: 16},
+	{in: StrongHashBLAKE2b, size: 32},
+	{in: StrongHashType(255), wantErr: true},
+}
+
+func TestNewStrongHash_Type(t *testing.T) {
+	for _, tt := range testsNewStrongHashType {
+		for _, key := range [][]byte{nil, []byte("secret")} {
+			h, err := newStrongHash(tt.in, key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newStrongHash(%v) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+				continue
+			}
+			if err == nil && h.Size() != tt.size {
+				t.Errorf("newStrongHash(%v) size = %v, want %v", tt.in, h.Size(), tt.size)
+			}
+		}
+	}
+}
+
+func TestStrongHashKeyID(t *testing.T) {
+	if got := strongHashKeyID(nil); got != nil {
+		t.Errorf("strongHashKeyID(nil) = %v, want nil", got)
+	}
+	id := strongHashKeyID([]byte("secret"))
+	if len(id) != strongHashKeyIDSize {
+		t.Errorf("strongHashKeyID() size = %v, want %v", len(id), strongHashKeyIDSize)
+	}
+	if !bytes.Equal(id, strongHashKeyID([]byte("secret"))) {
+		t.Errorf("strongHashKeyID() is not deterministic")
+	}
+	if bytes.Equal(id, strongHashKeyID([]byte("other"))) {
+		t.Errorf("strongHashKeyID() must differ for different keys")
+	}
+}
+
+func TestStrongHashType_UnmarshalText(t *testing.T) {
+	for _, tt := range testsNewStrongHashType {
+		var got StrongHashType
+		text, _ := tt.in.MarshalText()
+		err := got.UnmarshalText(text)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("UnmarshalText(%q) error = %v, wantErr %v", text, err, tt.wantErr)
+		}
+		if err == nil && got != tt.in {
+			t.Errorf("UnmarshalText(%q) = %v, want %v", text, got, tt.in)
+		}
+	}
+}
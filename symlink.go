@@ -0,0 +1,32 @@
+package rdiff
+
+import "fmt"
+
+// SymlinkMode is the handling of the symbolic links by the tree operations, see WithSymlinks.
+type SymlinkMode byte
+
+const (
+	// SymlinkRecord records the symbolic links as links, holding their target path, which PatchDir recreates
+	// as is, whether the target is relative or absolute, and whether it exists or not.
+	SymlinkRecord SymlinkMode = iota
+	// SymlinkFollow records the files and directories the symbolic links point to, at the link paths, so they're
+	// rebuilt as regular files and directories. A link to one of its parent directories, which is a loop, is skipped,
+	// while a dangling link makes the tree operations return a non-nil error.
+	SymlinkFollow
+	// SymlinkSkip skips the symbolic links.
+	SymlinkSkip
+)
+
+// String returns the name of the symbolic links mode.
+func (m SymlinkMode) String() string {
+	switch m {
+	case SymlinkRecord:
+		return "record"
+	case SymlinkFollow:
+		return "follow"
+	case SymlinkSkip:
+		return "skip"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(m))
+	}
+}
@@ -0,0 +1,168 @@
+package rdiff
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// symlinkTree creates a tree holding a file, a link to it, a dangling link, and a link to a directory.
+func symlinkTree(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the symbolic links require privileges")
+	}
+	root := t.TempDir()
+	writeTree(t, root, map[string][]byte{"file": []byte("content"), "dir/a": []byte("a")})
+	for link, target := range map[string]string{"file.link": "file", "dangling": "missing", "dir.link": "dir"} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+func TestApp_SignatureDir_Symlinks(t *testing.T) {
+	root := symlinkTree(t)
+	for _, tt := range []struct {
+		mode  SymlinkMode
+		links map[string]string
+	}{
+		{
+			mode:  SymlinkRecord,
+			links: map[string]string{"dangling": "missing", "dir/a": "", "dir.link": "dir", "file": "", "file.link": "file"},
+		},
+		{mode: SymlinkSkip, links: map[string]string{"dir/a": "", "file": ""}},
+	} {
+		output := filepath.Join(t.TempDir(), "signature")
+		if err := New(4, WithSymlinks(tt.mode)).SignatureDir(root, output); err != nil {
+			t.Fatalf("%v: SignatureDir() error = %v", tt.mode, err)
+		}
+		links := make(map[string]string)
+		for _, f := range readDirSignatureFile(t, output) {
+			links[f.Path] = f.Link
+		}
+		if diff := cmp.Diff(tt.links, links); diff != "" {
+			t.Errorf("%v: SignatureDir() links \nDIFF: %v", tt.mode, diff)
+		}
+	}
+
+	// the dangling link can't be followed
+	if err := New(4, WithSymlinks(SymlinkFollow)).SignatureDir(root, filepath.Join(t.TempDir(), "signature")); err == nil {
+		t.Errorf("SignatureDir() following a dangling link error = nil, want an error")
+	}
+}
+
+func TestApp_SignatureDir_FollowSymlinks(t *testing.T) {
+	root := symlinkTree(t)
+	if err := os.Remove(filepath.Join(root, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	// the loop is skipped
+	if err := os.Symlink("..", filepath.Join(root, "dir", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(t.TempDir(), "signature")
+	if err := New(4, WithSymlinks(SymlinkFollow)).SignatureDir(root, output); err != nil {
+		t.Fatalf("SignatureDir() error = %v", err)
+	}
+	var got []string
+	for _, f := range readDirSignatureFile(t, output) {
+		got = append(got, f.Path)
+	}
+	if diff := cmp.Diff([]string{"dir.link/a", "dir/a", "file", "file.link"}, got); diff != "" {
+		t.Errorf("SignatureDir() files \nDIFF: %v", diff)
+	}
+}
+
+func TestApp_PatchDir_Symlinks(t *testing.T) {
+	target, source := symlinkTree(t), symlinkTree(t)
+	if err := os.Remove(filepath.Join(source, "dir.link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(source, "file.link")); err != nil {
+		t.Fatal(err)
+	}
+	// a link to another file, and a link replacing a directory link
+	if err := os.Symlink("dir/a", filepath.Join(source, "file.link")); err != nil {
+		t.Fatal(err)
+	}
+	writeTree(t, source, map[string][]byte{"dir.link": []byte("now a file")})
+	if err := os.Symlink("file", filepath.Join(source, "new.link")); err != nil {
+		t.Fatal(err)
+	}
+
+	output, files := patchDirAttrs(t, New(4), target, source)
+	changes := make(map[string]FileChange)
+	for _, file := range files {
+		changes[file.Path] = file.Change
+	}
+	want := map[string]FileChange{
+		"dangling":  FileUnchanged,
+		"dir/a":     FileUnchanged,
+		"dir.link":  FileNew,
+		"file":      FileUnchanged,
+		"file.link": FileChanged,
+		"new.link":  FileNew,
+	}
+	if diff := cmp.Diff(want, changes); diff != "" {
+		t.Errorf("ReadDirDelta() changes \nDIFF: %v", diff)
+	}
+	for link, want := range map[string]string{"dangling": "missing", "file.link": "dir/a", "new.link": "file"} {
+		if got, err := os.Readlink(filepath.Join(output, link)); err != nil || got != want {
+			t.Errorf("PatchDir() link %v = %v, %v, want %v", link, got, err, want)
+		}
+	}
+	if got, err := os.ReadFile(filepath.Join(output, "dir.link")); err != nil || string(got) != "now a file" {
+		t.Errorf("PatchDir() dir.link = %q, %v, want the new file", got, err)
+	}
+}
+
+func TestApp_PatchDir_UnderSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the symbolic links require privileges")
+	}
+	dir := t.TempDir()
+	outside := t.TempDir()
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range []any{
+		DirDeltaHeader{SourceFiles: 2, SourceBytes: 1},
+		dirDeltaRecord{Entry: &fileDeltaEntry{Path: "escape", Change: FileNew, Link: outside}},
+		dirDeltaRecord{Entry: &fileDeltaEntry{Path: "escape/file", Change: FileNew, SourceSize: 1}},
+		dirDeltaRecord{Op: &Operation{Type: OpBlockNew, BlockIndex: -1, Data: []byte{1}}},
+	} {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	delta := filepath.Join(dir, "delta")
+	if err := os.WriteFile(delta, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	err := New(4).PatchDir(t.TempDir(), delta, filepath.Join(dir, "output"))
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("PatchDir() error = %v, want a %v error", err, ErrCorrupt)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "file")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("PatchDir() wrote through the link, stat error = %v", err)
+	}
+}
+
+func TestSymlinkMode_String(t *testing.T) {
+	for m, want := range map[SymlinkMode]string{
+		SymlinkRecord: "record", SymlinkFollow: "follow", SymlinkSkip: "skip", SymlinkMode(9): "unknown(9)",
+	} {
+		if got := m.String(); got != want {
+			t.Errorf("String() = %v, want %v", got, want)
+		}
+	}
+}
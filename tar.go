@@ -0,0 +1,527 @@
+package rdiff
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// tarBlockSize is the size of the blocks of a tar archive, the headers and the data of its members being aligned
+// to it.
+const tarBlockSize = 512
+
+// TarSignatureHeader starts a tar signature, as written by App.SignatureTar.
+// Its fields differ from the other headers ones, so the artifacts can't be mistaken for each other.
+type TarSignatureHeader struct {
+	// Members is the number of member signatures following the header
+	Members int
+}
+
+// tarSignatureEntry is serialized in front of the signature table of every member of a tar signature, its header
+// recording the block size of the member, and the size of its data, padded to the tar block size.
+type tarSignatureEntry struct {
+	Name   string
+	Header SignatureHeader
+}
+
+// TarDeltaHeader starts a tar delta, as written by App.DeltaTar.
+// Its fields differ from the other headers ones, so the artifacts can't be mistaken for each other.
+type TarDeltaHeader struct {
+	// SourceTarSize is the size of the source archive, in bytes, which is the size of the output of the patch
+	SourceTarSize int64
+}
+
+// tarDeltaSection starts a section of a tar delta, which rebuilds the next Size bytes of the source archive:
+// the data of a member, from the data of the target member named Target, or, for an empty Target, the literal
+// bytes of the operations, ex: the headers of the members, or the data of a new member.
+type tarDeltaSection struct {
+	Target    string
+	Size      int64
+	BlockSize int
+}
+
+// tarDeltaRecord is a value of a tar delta, following the header: a section, or an operation of the last section.
+type tarDeltaRecord struct {
+	Section *tarDeltaSection
+	Op      *Operation
+}
+
+// tarMember is a member of a tar archive, located by scanTar.
+type tarMember struct {
+	name string
+	// dataStart is the offset of the data of the member, following its headers, and end is the offset of the end of
+	// its data, padded to the tar block size
+	dataStart, end int64
+}
+
+// size returns the size of the data of the member, padded to the tar block size.
+func (m tarMember) size() int64 {
+	return m.end - m.dataStart
+}
+
+// SignatureTar computes the signature of the tar archive(targetPath), member by member, and writes it to an output
+// file(outputPath), as a tar signature, which DeltaTar computes the delta of a source archive against.
+// Every member has its own signature, of its data, so the blocks are aligned to the members boundaries, and the block
+// size is decided per member, if it's dynamic. The members without data, ex: the directories, have no signature.
+// The archive file must exist, and the output file must not exist, otherwise a non-nil error is returned.
+// The tar signature is gob encoded, so the other formats return a non-nil error.
+func (a *App) SignatureTar(targetPath string, outputPath string) error {
+	if a.format != FormatGob {
+		return fmt.Errorf("the %v format can't encode a tar signature", a.format)
+	}
+	err := a.checkSignatureHashers()
+	if err != nil {
+		return err
+	}
+	target, size, err := openTar(targetPath)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	members, err := scanTar(target, size)
+	if err != nil {
+		return err
+	}
+	output, err := os.OpenFile(outputPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	err = a.signatureTar(target, members, output)
+
+	return errors.Join(err, output.Close())
+}
+
+// signatureTar serializes the header, then the entry and the signature table of every member having data.
+func (a *App) signatureTar(target io.ReaderAt, members []tarMember, output io.Writer) error {
+	signed := make([]tarMember, 0, len(members))
+	for _, m := range members {
+		if m.size() > 0 && m.name != "" {
+			signed = append(signed, m)
+		}
+	}
+	bw := bufio.NewWriter(output)
+	enc := gob.NewEncoder(bw)
+	err := enc.Encode(TarSignatureHeader{Members: len(signed)})
+	if err != nil {
+		return err
+	}
+	blockSize := a.diffEngine.blockSize
+	defer func() { a.diffEngine.blockSize = blockSize }()
+	for _, m := range signed {
+		a.diffEngine.blockSize = blockSize
+		if blockSize <= 0 {
+			a.diffEngine.blockSize = int(computeDynamicBlockSize(m.size()))
+		}
+		t, err := a.diffEngine.ComputeSignature(io.NewSectionReader(target, m.dataStart, m.size()))
+		if err != nil {
+			return fmt.Errorf("%v: %w", m.name, err)
+		}
+		entry := tarSignatureEntry{Name: m.name, Header: a.diffEngine.signatureHeader()}
+		entry.Header.TargetSize = m.size()
+		err = enc.Encode(entry)
+		if err != nil {
+			return err
+		}
+		err = enc.Encode(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// tarSignatureMember is a member signature of a tar signature.
+type tarSignatureMember struct {
+	header SignatureHeader
+	table  signatureTable
+}
+
+// readTarSignature deserializes a tar signature, and returns its member signatures by name, the last one of the
+// members having the same name, which overwrites the others when the archive is extracted. The signature tables are
+// bounded by the limits.
+func readTarSignature(r io.Reader, limits DecodeLimits) (map[string]tarSignatureMember, error) {
+	dec := gob.NewDecoder(limits.signatureReader(bufio.NewReader(r)))
+	var header TarSignatureHeader
+	err := dec.Decode(&header)
+	if err != nil {
+		return nil, markError(ErrCorrupt, fmt.Errorf("reading the tar signature header: %w", err))
+	}
+	if header.Members < 0 {
+		return nil, markError(ErrCorrupt, fmt.Errorf("invalid tar signature members count: %v", header.Members))
+	}
+	members := make(map[string]tarSignatureMember)
+	for i := 0; i < header.Members; i++ {
+		var entry tarSignatureEntry
+		err = dec.Decode(&entry)
+		if err != nil {
+			return nil, markError(ErrCorrupt, fmt.Errorf("reading the tar signature member %v: %w", i, err))
+		}
+		h := entry.Header
+		if entry.Name == "" || h.BlockSize <= 0 || h.BlockSize > MaxBlockSize || h.TargetSize <= 0 {
+			return nil, markError(ErrCorrupt, fmt.Errorf("invalid tar signature member %v: %q", i, entry.Name))
+		}
+		t, err := readSignatureTable(dec, h, limits)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", entry.Name, err)
+		}
+		members[entry.Name] = tarSignatureMember{header: h, table: t}
+	}
+
+	return members, nil
+}
+
+// DeltaTar computes the delta between the tar signature of a target archive(tarSignatureFilePath), as written by
+// SignatureTar, and a source archive(sourcePath), member by member, and writes it to a delta file(deltaFilePath),
+// which PatchTar applies to the target archive.
+// The data of every source member is matched against the data of the target member of the same name, wherever it is
+// in the target archive, so the members moved, or whose headers changed, ex: their modification time, keep their
+// blocks, while the headers, and the data of the new members, are sent as they are. The source archive is rebuilt
+// byte for byte.
+// The signature file and the source archive must exist, and the delta file must not exist, otherwise a non-nil error
+// is returned. The tar delta is gob encoded, so the other formats return a non-nil error.
+func (a *App) DeltaTar(tarSignatureFilePath string, sourcePath string, deltaFilePath string) error {
+	if a.format != FormatGob {
+		return fmt.Errorf("the %v format can't encode a tar delta", a.format)
+	}
+	err := a.diffEngine.checkHashers()
+	if err != nil {
+		return err
+	}
+	signatureFile, err := os.Open(tarSignatureFilePath)
+	if err != nil {
+		return err
+	}
+	signatures, err := readTarSignature(signatureFile, a.diffEngine.limits)
+	err = errors.Join(err, signatureFile.Close())
+	if err != nil {
+		return err
+	}
+	source, size, err := openTar(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	members, err := scanTar(source, size)
+	if err != nil {
+		return err
+	}
+	deltaFile, err := os.OpenFile(deltaFilePath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(deltaFile)
+	err = a.deltaTar(signatures, source, size, members, gob.NewEncoder(bw))
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	return errors.Join(err, deltaFile.Close())
+}
+
+// deltaTar serializes the header, then the sections rebuilding the source archive, which has the given size and
+// members: the headers of every member, followed by its data, and the end of the archive.
+func (a *App) deltaTar(signatures map[string]tarSignatureMember, source io.ReaderAt, size int64, members []tarMember, enc recordEncoder) error {
+	err := enc.Encode(TarDeltaHeader{SourceTarSize: size})
+	if err != nil {
+		return err
+	}
+	var off int64
+	for _, m := range members {
+		err = writeTarLiteral(enc, io.NewSectionReader(source, off, m.dataStart-off))
+		if err != nil {
+			return err
+		}
+		err = a.tarMemberDelta(enc, io.NewSectionReader(source, m.dataStart, m.size()), m.name, signatures)
+		if err != nil {
+			return fmt.Errorf("%v: %w", m.name, err)
+		}
+		off = m.end
+	}
+
+	return writeTarLiteral(enc, io.NewSectionReader(source, off, size-off))
+}
+
+// tarMemberDelta serializes the section rebuilding the data of a source member, from the target member of the same
+// name, if any, or as literal bytes.
+func (a *App) tarMemberDelta(enc recordEncoder, data *io.SectionReader, name string, signatures map[string]tarSignatureMember) error {
+	sig, ok := signatures[name]
+	if !ok || data.Size() == 0 {
+		return writeTarLiteral(enc, data)
+	}
+	err := enc.Encode(tarDeltaRecord{Section: &tarDeltaSection{Target: name, Size: data.Size(), BlockSize: sig.header.BlockSize}})
+	if err != nil {
+		return err
+	}
+	blockSize := a.diffEngine.blockSize
+	defer func() { a.diffEngine.blockSize = blockSize }()
+	a.diffEngine.blockSize = sig.header.BlockSize
+
+	return a.diffEngine.ComputeDeltaFunc(data, sig.header, sig.table, func(op Operation) error {
+		return enc.Encode(tarDeltaRecord{Op: &op})
+	})
+}
+
+// writeTarLiteral serializes the literal section of the bytes of r, if any, as OpBlockNew operations.
+func writeTarLiteral(enc recordEncoder, r *io.SectionReader) error {
+	if r.Size() == 0 {
+		return nil
+	}
+	err := enc.Encode(tarDeltaRecord{Section: &tarDeltaSection{Size: r.Size()}})
+	if err != nil {
+		return err
+	}
+	bufp := getBuffer(dirLiteralSize)
+	defer putBuffer(bufp)
+	for {
+		n, err := io.ReadFull(r, *bufp)
+		if n > 0 {
+			encErr := enc.Encode(tarDeltaRecord{Op: &Operation{Type: OpBlockNew, BlockIndex: -1, Data: (*bufp)[:n]}})
+			if encErr != nil {
+				return encErr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// PatchTar applies a tar delta(deltaFilePath), as written by DeltaTar, to the target archive(targetPath), and writes
+// the rebuilt source archive to an output file(outputPath).
+// The target archive and the delta file must exist, and the output file must not exist, otherwise a non-nil error is
+// returned. A target archive which doesn't match the delta makes it return a non-nil error, as well.
+func (a *App) PatchTar(targetPath string, deltaFilePath string, outputPath string) error {
+	target, size, err := openTar(targetPath)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	members, err := scanTar(target, size)
+	if err != nil {
+		return err
+	}
+	deltaFile, err := os.Open(deltaFilePath)
+	if err != nil {
+		return err
+	}
+	defer deltaFile.Close()
+	output, err := os.OpenFile(outputPath, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(output)
+	p := &tarPatcher{app: a, target: target, members: make(map[string]tarMember), cw: &countingWriter{w: bw}}
+	for _, m := range members {
+		p.members[m.name] = m
+	}
+	err = p.patch(deltaFile)
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	return errors.Join(err, output.Close())
+}
+
+// tarPatcher rebuilds the sections of a tar delta, one at a time.
+type tarPatcher struct {
+	app     *App
+	target  io.ReaderAt
+	members map[string]tarMember
+	cw      *countingWriter
+	// section is the section being rebuilt, nil if none, and end is the output size it ends at
+	section *tarDeltaSection
+	end     int64
+	// data is the data of the target member of the section, and layout its blocks, if it's not a literal one
+	data   io.ReaderAt
+	layout targetLayout
+	// ops is the number of operations read so far, bounded by the limits
+	ops int64
+}
+
+// patch reads the tar delta, and applies its sections.
+func (p *tarPatcher) patch(r io.Reader) error {
+	limits := p.app.diffEngine.limits
+	dec := gob.NewDecoder(limits.deltaReader(bufio.NewReader(r)))
+	var header TarDeltaHeader
+	err := dec.Decode(&header)
+	if err != nil {
+		return markError(ErrCorrupt, fmt.Errorf("reading the tar delta header: %w", err))
+	}
+	blockBuf := getBuffer(MaxBlockSize)
+	defer putBuffer(blockBuf)
+	for {
+		var rec tarDeltaRecord
+		err = dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return markError(ErrCorrupt, fmt.Errorf("reading the tar delta: %w", err))
+		}
+		err = p.record(rec, *blockBuf)
+		if err != nil {
+			return err
+		}
+	}
+	err = p.finish()
+	if err != nil {
+		return err
+	}
+	if p.cw.n != header.SourceTarSize {
+		return markError(
+			ErrVerification,
+			fmt.Errorf("the tar delta rebuilt %v bytes, but the source archive has %v bytes", p.cw.n, header.SourceTarSize),
+		)
+	}
+
+	return nil
+}
+
+// record starts a section, or applies an operation of the section being rebuilt.
+func (p *tarPatcher) record(rec tarDeltaRecord, blockBuf []byte) error {
+	switch {
+	case rec.Section != nil && rec.Op == nil:
+		err := p.finish()
+		if err != nil {
+			return err
+		}
+		return p.start(*rec.Section)
+	case rec.Op != nil && rec.Section == nil && p.section != nil:
+		p.ops++
+		err := p.app.diffEngine.limits.checkOperation(p.ops, *rec.Op)
+		if err != nil {
+			return err
+		}
+		return p.apply(*rec.Op, blockBuf)
+	default:
+		return markError(ErrCorrupt, errors.New("invalid tar delta record"))
+	}
+}
+
+// start validates a section, and locates the data of its target member, unless it's a literal one.
+func (p *tarPatcher) start(s tarDeltaSection) error {
+	if s.Size <= 0 || (s.Target == "" && s.BlockSize != 0) || (s.Target != "" && (s.BlockSize <= 0 || s.BlockSize > MaxBlockSize)) {
+		return markError(ErrCorrupt, fmt.Errorf("invalid tar delta section: %+v", s))
+	}
+	p.section, p.end = &s, p.cw.n+s.Size
+	p.data = nil
+	if s.Target == "" {
+		return nil
+	}
+	m, ok := p.members[s.Target]
+	if !ok {
+		return markError(ErrVerification, fmt.Errorf("%v: the target archive has no such member", s.Target))
+	}
+	p.data = io.NewSectionReader(p.target, m.dataStart, m.size())
+	p.layout = targetLayout{size: m.size(), blockSize: s.BlockSize}
+
+	return nil
+}
+
+// apply applies an operation of the section being rebuilt, a literal section only having OpBlockNew operations.
+func (p *tarPatcher) apply(op Operation, blockBuf []byte) error {
+	if p.data == nil {
+		if op.Type != OpBlockNew {
+			return markError(ErrCorrupt, fmt.Errorf("invalid operation type for a literal tar section: %v", op.Type))
+		}
+		_, err := p.cw.Write(op.Data)
+		return err
+	}
+	err := p.app.diffEngine.applyOperation(p.data, p.layout, op, blockBuf, p.cw)
+	if err != nil {
+		return fmt.Errorf("%v: %w", p.section.Target, err)
+	}
+
+	return nil
+}
+
+// finish checks the section being rebuilt, if any, has its size.
+func (p *tarPatcher) finish() error {
+	s := p.section
+	if s == nil {
+		return nil
+	}
+	p.section = nil
+	if p.cw.n != p.end {
+		return markError(ErrVerification, fmt.Errorf(
+			"the tar delta section of %v rebuilt %v bytes, but it has %v bytes", s.Target, p.cw.n-(p.end-s.Size), s.Size,
+		))
+	}
+
+	return nil
+}
+
+// openTar opens the archive file at p, and returns it along with its size.
+func openTar(p string) (*os.File, int64, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, errors.Join(err, f.Close())
+	}
+
+	return f, info.Size(), nil
+}
+
+// scanTar locates the members of the tar archive, which has the given size, without reading their data, except for
+// the sparse files.
+func scanTar(r io.ReaderAt, size int64) ([]tarMember, error) {
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+	var members []tarMember
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return members, nil
+		}
+		if err != nil {
+			return nil, markError(ErrCorrupt, fmt.Errorf("reading the tar archive: %w", err))
+		}
+		m := tarMember{name: hdr.Name}
+		m.dataStart, _ = sr.Seek(0, io.SeekCurrent)
+		stored, err := tarStoredSize(hdr, tr, sr, m.dataStart)
+		if err != nil {
+			return nil, markError(ErrCorrupt, fmt.Errorf("reading the tar archive member %v: %w", hdr.Name, err))
+		}
+		m.end = m.dataStart + (stored+tarBlockSize-1)/tarBlockSize*tarBlockSize
+		if m.end > size {
+			return nil, markError(ErrCorrupt, fmt.Errorf("the tar archive member %v is truncated", hdr.Name))
+		}
+		members = append(members, m)
+	}
+}
+
+// tarStoredSize returns the number of bytes stored in the archive for the data of the member having the header hdr,
+// which starts at dataStart: none for the types having no data, the size of the fragments of a sparse file, which
+// are read through to be found out, and the size recorded by the header, otherwise.
+func tarStoredSize(hdr *tar.Header, tr *tar.Reader, sr *io.SectionReader, dataStart int64) (int64, error) {
+	switch hdr.Typeflag {
+	case tar.TypeLink, tar.TypeSymlink, tar.TypeChar, tar.TypeBlock, tar.TypeDir, tar.TypeFifo:
+		return 0, nil
+	}
+	sparse := hdr.Typeflag == tar.TypeGNUSparse
+	for k := range hdr.PAXRecords {
+		sparse = sparse || strings.HasPrefix(k, "GNU.sparse.")
+	}
+	if !sparse {
+		return hdr.Size, nil
+	}
+	_, err := io.Copy(io.Discard, tr)
+	if err != nil {
+		return 0, err
+	}
+	pos, err := sr.Seek(0, io.SeekCurrent)
+
+	return pos - dataStart, err
+}
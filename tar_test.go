@@ -0,0 +1,149 @@
+package rdiff
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tarFile is a member of a test tar archive, a directory if data is nil.
+type tarFile struct {
+	name    string
+	data    []byte
+	modTime time.Time
+}
+
+// writeTestTar writes the tar archive of the files at p.
+func writeTestTar(t *testing.T, p string, files ...tarFile) {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data)), ModTime: f.modTime, Typeflag: tar.TypeReg}
+		if f.data == nil {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestApp_DeltaTar(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	rnd := rand.New(rand.NewSource(1))
+	data := func(n int) []byte {
+		b := make([]byte, n)
+		rnd.Read(b)
+		return b
+	}
+	a, b, c, d := data(5000), data(3000), data(7000), data(1000)
+	changed := bytes.Clone(c)
+	changed[100] ^= 0xFF
+	then, now := time.Unix(1700000000, 0), time.Unix(1800000000, 0)
+	writeTestTar(t, path("target.tar"),
+		tarFile{name: "dir/", modTime: then},
+		tarFile{name: "dir/a", data: a, modTime: then},
+		tarFile{name: "dir/b", data: b, modTime: then},
+		tarFile{name: "dir/c", data: c, modTime: then},
+		tarFile{name: "deleted", data: data(2000), modTime: then},
+	)
+	// the members are reordered, and their headers changed, c changed, d is new, and deleted is deleted
+	writeTestTar(t, path("source.tar"),
+		tarFile{name: "dir/", modTime: now},
+		tarFile{name: "new/d", data: d, modTime: now},
+		tarFile{name: "dir/c", data: changed, modTime: now},
+		tarFile{name: "dir/b", data: b, modTime: now},
+		tarFile{name: "dir/a", data: a, modTime: now},
+	)
+
+	app := New(256)
+	if err := app.SignatureTar(path("target.tar"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.DeltaTar(path("signature"), path("source.tar"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.PatchTar(path("target.tar"), path("delta"), path("out.tar")); err != nil {
+		t.Fatal(err)
+	}
+	source, err := os.ReadFile(path("source.tar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path("out.tar")); !bytes.Equal(got, source) {
+		t.Fatal("PatchTar() doesn't rebuild the source archive")
+	}
+
+	// the delta holds the headers, the new member, and the changed block, while a plain delta loses the blocks
+	// misaligned by the headers, and by the reordering
+	info, err := os.Stat(path("delta"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := int64(len(d) + 10*tarBlockSize + 256 + 1024); info.Size() > max {
+		t.Errorf("the tar delta has %v bytes, want at most %v", info.Size(), max)
+	}
+	if err := app.Signature(path("target.tar"), path("plain.signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(path("plain.signature"), path("source.tar"), path("plain.delta")); err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := os.Stat(path("plain.delta")); err != nil || plain.Size() <= info.Size() {
+		t.Errorf("the plain delta has %v bytes, want more than the tar delta, error = %v", plain.Size(), err)
+	}
+}
+
+func TestApp_DeltaTar_Errors(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	writeTestTar(t, path("target.tar"), tarFile{name: "a", data: bytes.Repeat([]byte("a"), 1000)})
+	writeTestTar(t, path("other.tar"), tarFile{name: "b", data: bytes.Repeat([]byte("a"), 1000)})
+	if err := os.WriteFile(path("corrupt"), []byte("not a tar signature"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	app := New(256)
+	if err := app.SignatureTar(path("target.tar"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.DeltaTar(path("signature"), path("target.tar"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		fn   func() error
+		want error
+	}{
+		{name: "corrupt signature", fn: func() error { return app.DeltaTar(path("corrupt"), path("target.tar"), path("d1")) }, want: ErrCorrupt},
+		{name: "not a tar", fn: func() error { return app.SignatureTar(path("corrupt"), path("s1")) }, want: ErrCorrupt},
+		{name: "corrupt delta", fn: func() error { return app.PatchTar(path("target.tar"), path("corrupt"), path("o1")) }, want: ErrCorrupt},
+		{name: "other target", fn: func() error { return app.PatchTar(path("other.tar"), path("delta"), path("o2")) }, want: ErrVerification},
+		{name: "existing output", fn: func() error { return app.SignatureTar(path("target.tar"), path("signature")) }, want: os.ErrExist},
+		{name: "json format", fn: func() error { return New(256, WithFormat(FormatJSON)).SignatureTar(path("target.tar"), path("s2")) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fn()
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
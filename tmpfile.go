@@ -0,0 +1,29 @@
+package rdiff
+
+import (
+	"errors"
+	"os"
+)
+
+// errAnonymousUnsupported is returned by openAnonymous if the platform, or the filesystem, can't create anonymous
+// files.
+var errAnonymousUnsupported = errors.New("anonymous files are not supported")
+
+// createSpool creates a temporary file, in the temporary directory, for the data spilled to disk, and returns it,
+// along with a function closing and removing it. The file is anonymous where supported, see openAnonymous, so a
+// crash never leaves it behind, otherwise it's named after pattern, as os.CreateTemp does.
+func createSpool(pattern string) (*os.File, func() error, error) {
+	f, err := openAnonymous(os.TempDir())
+	if err == nil {
+		return f, f.Close, nil
+	}
+	if !errors.Is(err, errAnonymousUnsupported) {
+		return nil, nil, err
+	}
+	f, err = os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return f, func() error { return errors.Join(f.Close(), os.Remove(f.Name())) }, nil
+}
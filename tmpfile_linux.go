@@ -0,0 +1,50 @@
+package rdiff
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// openAnonymous opens a new file in dir, using O_TMPFILE, which has no name, so it's freed once it's closed, unless
+// it's linked to a path, see linkAnonymous. The file has the permissions of the ones created by os.Create.
+func openAnonymous(dir string) (*os.File, error) {
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_RDWR|unix.O_CLOEXEC, 0666)
+	// the kernels and the filesystems without O_TMPFILE fail with either of these
+	if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EISDIR) || errors.Is(err, unix.EINVAL) {
+		return nil, errAnonymousUnsupported
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: err}
+	}
+
+	return os.NewFile(uintptr(fd), filepath.Join(dir, "(anonymous)")), nil
+}
+
+// linkAnonymous links the anonymous file f to path, which must not exist, using linkat, so it never replaces a file.
+func linkAnonymous(f *os.File, path string) error {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var linkErr error
+	err = rc.Control(func(fd uintptr) {
+		linkErr = unix.Linkat(unix.AT_FDCWD, "/proc/self/fd/"+strconv.Itoa(int(fd)), unix.AT_FDCWD, path, unix.AT_SYMLINK_FOLLOW)
+		if errors.Is(linkErr, unix.ENOENT) {
+			// without /proc, the file descriptor is linked itself, which needs CAP_DAC_READ_SEARCH
+			linkErr = unix.Linkat(int(fd), "", unix.AT_FDCWD, path, unix.AT_EMPTY_PATH)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if linkErr != nil {
+		return &os.LinkError{Op: "link", Old: f.Name(), New: path, Err: linkErr}
+	}
+
+	return nil
+}
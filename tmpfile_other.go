@@ -0,0 +1,15 @@
+//go:build !linux
+
+package rdiff
+
+import "os"
+
+// openAnonymous can't create anonymous files on this platform.
+func openAnonymous(_ string) (*os.File, error) {
+	return nil, errAnonymousUnsupported
+}
+
+// linkAnonymous can't link anonymous files on this platform.
+func linkAnonymous(_ *os.File, _ string) error {
+	return errAnonymousUnsupported
+}
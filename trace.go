@@ -0,0 +1,93 @@
+package rdiff
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope of the spans, see WithTraceContext.
+const tracerName = "github.com/silviutanasa/rdiff"
+
+// The attributes of the spans of the calls, see WithTraceContext.
+const (
+	attrFileSize   = attribute.Key("rdiff.file.size")
+	attrBlockSize  = attribute.Key("rdiff.block.size")
+	attrMatchRatio = attribute.Key("rdiff.match.ratio")
+)
+
+// traceSpan is the span of a call, or of a stage of a call, see WithTraceContext.
+type traceSpan struct {
+	a    *App
+	span trace.Span
+	// parent is the context of the span in progress when the span started, restored once it ends
+	parent context.Context
+	// op is the name of the call, for the span of a call, see startCallSpan
+	op string
+	// size is the size of the input of the call
+	size int64
+}
+
+// startSpan starts the span name, a child of the span in progress, which it replaces until it ends. It returns nil if
+// the App is not configured using WithTraceContext. The methods of a nil span do nothing.
+func (a *App) startSpan(name string) *traceSpan {
+	if a.traceCtx == nil {
+		return nil
+	}
+	tracer := trace.SpanFromContext(a.traceCtx).TracerProvider().Tracer(tracerName)
+	ctx, span := tracer.Start(a.traceCtx, name)
+	s := &traceSpan{a: a, span: span, parent: a.traceCtx}
+	a.traceCtx = ctx
+
+	return s
+}
+
+// startCallSpan starts the span of the call op, see startSpan.
+func (a *App) startCallSpan(op string) *traceSpan {
+	s := a.startSpan("rdiff." + op)
+	if s != nil {
+		s.op = op
+	}
+
+	return s
+}
+
+// input records the size of the input file of the call.
+func (s *traceSpan) input(n int64) {
+	if s != nil {
+		s.size = n
+		s.span.SetAttributes(attrFileSize.Int64(n))
+	}
+}
+
+// done records the block size of the engine, which is decided by a signature call, or configured, and, for a delta, the
+// ratio of the source matched, then ends the span of the call, which returned err.
+func (s *traceSpan) done(r *rDiff, err error) {
+	if s == nil {
+		return
+	}
+	if r.blockSize > 0 {
+		s.span.SetAttributes(attrBlockSize.Int(r.blockSize))
+	}
+	if s.op == "delta" && s.size > 0 && (err == nil || errors.Is(err, ErrNoChanges)) {
+		s.span.SetAttributes(attrMatchRatio.Float64(1 - float64(r.stats.LiteralBytes)/float64(s.size)))
+	}
+	s.end(err)
+}
+
+// end ends the span, which returned err, a delta skipped as unchanged not being an error, and restores its parent
+// as the span in progress.
+func (s *traceSpan) end(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil && !errors.Is(err, ErrNoChanges) {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+	s.a.traceCtx = s.parent
+}
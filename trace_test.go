@@ -0,0 +1,125 @@
+package rdiff
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// spanRecorder is a tracer provider recording the spans, in the order they end.
+type spanRecorder struct {
+	noop.TracerProvider
+	ended []*recordedSpan
+}
+
+func (r *spanRecorder) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return recordingTracer{r: r}
+}
+
+type recordingTracer struct {
+	noop.Tracer
+	r *spanRecorder
+}
+
+func (t recordingTracer) Start(ctx context.Context, name string, _ ...trace.SpanStartOption) (context.Context, trace.Span) {
+	s := &recordedSpan{r: t.r, name: name, attrs: make(map[attribute.Key]attribute.Value)}
+	if parent, ok := trace.SpanFromContext(ctx).(*recordedSpan); ok {
+		s.parent = parent.name
+	}
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+type recordedSpan struct {
+	noop.Span
+	r            *spanRecorder
+	name, parent string
+	attrs        map[attribute.Key]attribute.Value
+	status       codes.Code
+	err          error
+}
+
+func (s *recordedSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+func (s *recordedSpan) SetStatus(code codes.Code, _ string)           { s.status = code }
+func (s *recordedSpan) RecordError(err error, _ ...trace.EventOption) { s.err = err }
+func (s *recordedSpan) End(...trace.SpanEndOption)                    { s.r.ended = append(s.r.ended, s) }
+func (s *recordedSpan) TracerProvider() trace.TracerProvider          { return s.r }
+
+func TestApp_WithTraceContext(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	target := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	source := append(bytes.Clone(target[:512]), make([]byte, 512)...)
+	for name, data := range map[string][]byte{"target": target, "source": source} {
+		if err := os.WriteFile(path(name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorder := &spanRecorder{}
+	ctx, root := recorder.Tracer("test").Start(context.Background(), "sync")
+	app := New(64, WithTraceContext(ctx))
+	if err := app.Signature(path("target"), path("signature")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Delta(path("signature"), path("source"), path("delta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Patch(path("target"), path("delta"), path("out")); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Patch(path("target"), path("missing"), path("out2")); err == nil {
+		t.Fatal("Patch() of a missing delta error = nil, want an error")
+	}
+	root.End()
+
+	var got []string
+	for _, s := range recorder.ended {
+		got = append(got, s.parent+"/"+s.name)
+	}
+	want := []string{
+		"rdiff.signature/signature", "rdiff.signature/encode", "sync/rdiff.signature",
+		"rdiff.delta/read", "encode/match", "rdiff.delta/encode", "sync/rdiff.delta",
+		"rdiff.patch/read", "rdiff.patch/apply", "sync/rdiff.patch",
+		"sync/rdiff.patch",
+		"/sync",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("the spans = %v, want %v", got, want)
+	}
+	if s := recorder.ended[2]; s.attrs[attrFileSize].AsInt64() != int64(len(target)) || s.attrs[attrBlockSize].AsInt64() != 64 {
+		t.Errorf("the signature span attributes = %v", s.attrs)
+	}
+	if s := recorder.ended[6]; s.attrs[attrFileSize].AsInt64() != int64(len(source)) || s.attrs[attrMatchRatio].AsFloat64() != 0.5 {
+		t.Errorf("the delta span attributes = %v, want a match ratio of 0.5", s.attrs)
+	}
+	for i, s := range recorder.ended {
+		if failed := i == 10; (s.status == codes.Error) != failed || (s.err != nil) != failed {
+			t.Errorf("the span %v status = %v, error = %v, want failed %v", s.name, s.status, s.err, failed)
+		}
+	}
+}
+
+func TestApp_WithTraceContext_NoSpan(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "target"), []byte("content"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	app := New(0, WithTraceContext(context.Background()))
+	if err := app.Signature(filepath.Join(dir, "target"), filepath.Join(dir, "signature")); err != nil {
+		t.Fatal(err)
+	}
+	if app.traceCtx != context.Background() {
+		t.Errorf("the trace context is not restored once the call returns")
+	}
+}
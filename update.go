@@ -0,0 +1,234 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// UpdateManifest describes the deltas of a software update, the way a TUF targets file does: a client checks the
+// installed version is the basis of the delta it picks, the delta is the one published, and the rebuilt version is
+// the expected one. It's written, signed, by App.WriteUpdateManifest, and read by ReadUpdateManifest.
+type UpdateManifest struct {
+	// Version increases with every manifest published, so a client can reject a manifest older than the last one
+	// it accepted, which would roll it back
+	Version int64
+	// Expires is when the manifest stops being valid, so a client can't be kept on a stale one
+	Expires time.Time
+	Patches []UpdatePatch
+}
+
+// UpdatePatch is a delta of an update manifest, from the basis version to the new one.
+type UpdatePatch struct {
+	// Name is the name of the delta, ex: its path relative to the manifest
+	Name string
+	// From is the basis version, which must be installed to apply the delta, and To is the version it rebuilds
+	From string
+	To   string
+	// FromSize and FromHash are the size, and the SHA-256 hash, of the basis, and the same goes for the rebuilt
+	// version, and for the delta
+	FromSize  int64
+	FromHash  []byte
+	ToSize    int64
+	ToHash    []byte
+	DeltaSize int64
+	DeltaHash []byte
+}
+
+// UpdateFiles locates the files of a delta produced for an update manifest, see App.WriteUpdateManifest.
+type UpdateFiles struct {
+	// Name is the name of the delta in the manifest, the base name of DeltaPath if empty
+	Name string
+	// From is the basis version, and BasisPath its file, the target of the delta
+	From      string
+	BasisPath string
+	// To is the new version, and VersionPath its file, the source of the delta
+	To          string
+	VersionPath string
+	DeltaPath   string
+}
+
+// signedUpdateManifest is the serialization of an update manifest: the JSON encoding of the manifest, and its
+// signatures, computed over the exact bytes of the encoding.
+type signedUpdateManifest struct {
+	Signed     json.RawMessage   `json:"signed"`
+	Signatures []updateSignature `json:"signatures"`
+}
+
+// updateSignature is an Ed25519 signature of an update manifest, by the key identified by KeyID: the hex encoded
+// SHA-256 hash of the public key.
+type updateSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"`
+}
+
+// WriteUpdateManifest hashes the files of the deltas, and writes the manifest describing them, signed using the key
+// configured by WithSigningKey, which is required, to output. The version and the expiry protect the clients from
+// the rollback and the freeze attacks, see UpdateManifest.
+// The manifest is JSON encoded, whatever the configured format, as it's meant to be read by the update clients.
+func (a *App) WriteUpdateManifest(files []UpdateFiles, version int64, expires time.Time, output io.Writer) error {
+	if a.signingKey == nil {
+		return errors.New("the update manifest requires a signing key, see WithSigningKey")
+	}
+	m := UpdateManifest{Version: version, Expires: expires.UTC(), Patches: make([]UpdatePatch, 0, len(files))}
+	for _, f := range files {
+		p, err := newUpdatePatch(f)
+		if err != nil {
+			return fmt.Errorf("the delta %v: %w", f.DeltaPath, err)
+		}
+		m.Patches = append(m.Patches, p)
+	}
+	signed, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	public := a.signingKey.Public().(ed25519.PublicKey)
+	envelope := signedUpdateManifest{
+		Signed:     signed,
+		Signatures: []updateSignature{{KeyID: updateKeyID(public), Sig: ed25519.Sign(a.signingKey, signed)}},
+	}
+
+	return json.NewEncoder(output).Encode(envelope)
+}
+
+// newUpdatePatch hashes the files of a delta.
+func newUpdatePatch(f UpdateFiles) (UpdatePatch, error) {
+	p := UpdatePatch{Name: f.Name, From: f.From, To: f.To}
+	if p.Name == "" {
+		p.Name = filepath.Base(f.DeltaPath)
+	}
+	var err error
+	p.FromSize, p.FromHash, err = hashUpdateFile(f.BasisPath)
+	if err != nil {
+		return UpdatePatch{}, err
+	}
+	p.ToSize, p.ToHash, err = hashUpdateFile(f.VersionPath)
+	if err != nil {
+		return UpdatePatch{}, err
+	}
+	p.DeltaSize, p.DeltaHash, err = hashUpdateFile(f.DeltaPath)
+
+	return p, err
+}
+
+// hashUpdateFile returns the size and the SHA-256 hash of the file at p.
+func hashUpdateFile(p string) (int64, []byte, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return n, h.Sum(nil), nil
+}
+
+// updateKeyID returns the identifier of the public key signing an update manifest.
+func updateKeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// ReadUpdateManifest reads an update manifest, as written by App.WriteUpdateManifest, and verifies it's signed by the
+// Ed25519 public key, and it's not expired at now, otherwise it returns a non-nil error matching ErrVerification.
+// A manifest which can't be decoded returns a non-nil error matching ErrCorrupt.
+// The caller must still reject a manifest whose version is lower than the last one it accepted.
+func ReadUpdateManifest(r io.Reader, key ed25519.PublicKey, now time.Time) (UpdateManifest, error) {
+	if len(key) != ed25519.PublicKeySize {
+		return UpdateManifest{}, fmt.Errorf("invalid Ed25519 public key size: %v", len(key))
+	}
+	var envelope signedUpdateManifest
+	err := json.NewDecoder(r).Decode(&envelope)
+	if err != nil {
+		return UpdateManifest{}, markError(ErrCorrupt, fmt.Errorf("reading the update manifest: %w", err))
+	}
+	if !envelope.signedBy(key) {
+		return UpdateManifest{}, markError(ErrVerification, errors.New("the update manifest is not signed by the key"))
+	}
+	var m UpdateManifest
+	err = json.Unmarshal(envelope.Signed, &m)
+	if err != nil {
+		return UpdateManifest{}, markError(ErrCorrupt, fmt.Errorf("reading the update manifest: %w", err))
+	}
+	if !now.Before(m.Expires) {
+		return UpdateManifest{}, markError(ErrVerification, fmt.Errorf("the update manifest expired at %v", m.Expires))
+	}
+
+	return m, nil
+}
+
+// signedBy reports whether the manifest holds a valid signature by the key.
+func (s *signedUpdateManifest) signedBy(key ed25519.PublicKey) bool {
+	id := updateKeyID(key)
+	for _, sig := range s.Signatures {
+		if sig.KeyID == id && ed25519.Verify(key, s.Signed, sig.Sig) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find returns the patch of the manifest from the basis version to the new one, or false if there isn't any.
+func (m *UpdateManifest) Find(from, to string) (UpdatePatch, bool) {
+	for _, p := range m.Patches {
+		if p.From == from && p.To == to {
+			return p, true
+		}
+	}
+
+	return UpdatePatch{}, false
+}
+
+// PatchUpdate applies the delta file(deltaFilePath) of the patch, as listed by a verified update manifest, to the
+// installed file(installedFilePath), and writes the rebuilt version to a new output file(outputFilePath), the same
+// way Patch does. The installed file must be the basis of the patch, and the delta the one listed, which are checked
+// before applying it, and the rebuilt version must have the listed hash, otherwise the output is removed: these
+// mismatches return a non-nil error matching ErrVerification.
+func (a *App) PatchUpdate(p UpdatePatch, installedFilePath, deltaFilePath, outputFilePath string) error {
+	err := checkUpdateFile(installedFilePath, p.FromSize, p.FromHash, "the installed file is not the basis of the delta")
+	if err != nil {
+		return err
+	}
+	err = checkUpdateFile(deltaFilePath, p.DeltaSize, p.DeltaHash, "the delta is not the one listed by the manifest")
+	if err != nil {
+		return err
+	}
+	err = a.Patch(installedFilePath, deltaFilePath, outputFilePath)
+	if err != nil {
+		return err
+	}
+	err = checkUpdateFile(outputFilePath, p.ToSize, p.ToHash, "the rebuilt file is not the listed version")
+	if err != nil {
+		return errors.Join(err, os.Remove(outputFilePath))
+	}
+
+	return nil
+}
+
+// checkUpdateFile returns a non-nil error matching ErrVerification, having the message, if the file at p doesn't have
+// the size and the hash.
+func checkUpdateFile(p string, size int64, hash []byte, message string) error {
+	n, sum, err := hashUpdateFile(p)
+	if err != nil {
+		return err
+	}
+	if n != size || !bytes.Equal(sum, hash) {
+		return markError(ErrVerification, fmt.Errorf("%v: %v", message, filepath.Base(p)))
+	}
+
+	return nil
+}
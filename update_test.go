@@ -0,0 +1,100 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApp_WriteUpdateManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := func(name string) string { return filepath.Join(dir, name) }
+	versions := map[string][]byte{
+		"v1": bytes.Repeat([]byte("version 1 "), 500),
+		"v2": bytes.Repeat([]byte("version 2 "), 500),
+		"v3": append(bytes.Repeat([]byte("version 2 "), 500), "and 3"...),
+	}
+	for name, data := range versions {
+		if err := os.WriteFile(path(name), data, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	key := testSigningKey(1)
+	public := key.Public().(ed25519.PublicKey)
+	app := New(64, WithSigningKey(key))
+	var files []UpdateFiles
+	for _, from := range []string{"v1", "v2"} {
+		if err := New(64).Signature(path(from), path(from+".sig")); err != nil {
+			t.Fatal(err)
+		}
+		if err := New(64).Delta(path(from+".sig"), path("v3"), path(from+"-v3.delta")); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, UpdateFiles{From: from, BasisPath: path(from), To: "v3", VersionPath: path("v3"), DeltaPath: path(from + "-v3.delta")})
+	}
+	now := time.Unix(1700000000, 0)
+	var manifest bytes.Buffer
+	if err := app.WriteUpdateManifest(files, 7, now.Add(time.Hour), &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ReadUpdateManifest(bytes.NewReader(manifest.Bytes()), public, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != 7 || len(m.Patches) != 2 {
+		t.Fatalf("ReadUpdateManifest() = %+v, want version 7, and 2 patches", m)
+	}
+	p, ok := m.Find("v2", "v3")
+	if !ok || p.Name != "v2-v3.delta" {
+		t.Fatalf("Find() = %+v, %v, want the v2-v3.delta patch", p, ok)
+	}
+	if err := New(64).PatchUpdate(p, path("v2"), path("v2-v3.delta"), path("out")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path("out")); !bytes.Equal(got, versions["v3"]) {
+		t.Error("PatchUpdate() doesn't rebuild the new version")
+	}
+	if _, ok := m.Find("v3", "v1"); ok {
+		t.Error("Find() of a missing patch = true, want false")
+	}
+
+	tests := []struct {
+		name string
+		fn   func() error
+		want error
+	}{
+		{name: "other key", fn: func() error {
+			_, err := ReadUpdateManifest(bytes.NewReader(manifest.Bytes()), testSigningKey(2).Public().(ed25519.PublicKey), now)
+			return err
+		}, want: ErrVerification},
+		{name: "tampered", fn: func() error {
+			tampered := bytes.Replace(manifest.Bytes(), []byte(`"Version":7`), []byte(`"Version":8`), 1)
+			_, err := ReadUpdateManifest(bytes.NewReader(tampered), public, now)
+			return err
+		}, want: ErrVerification},
+		{name: "expired", fn: func() error {
+			_, err := ReadUpdateManifest(bytes.NewReader(manifest.Bytes()), public, now.Add(time.Hour))
+			return err
+		}, want: ErrVerification},
+		{name: "corrupt", fn: func() error {
+			_, err := ReadUpdateManifest(bytes.NewReader([]byte("{")), public, now)
+			return err
+		}, want: ErrCorrupt},
+		{name: "other basis", fn: func() error { return New(64).PatchUpdate(p, path("v1"), path("v2-v3.delta"), path("o1")) }, want: ErrVerification},
+		{name: "other delta", fn: func() error { return New(64).PatchUpdate(p, path("v2"), path("v1-v3.delta"), path("o2")) }, want: ErrVerification},
+		{name: "no signing key", fn: func() error { return New(64).WriteUpdateManifest(files, 1, now, &bytes.Buffer{}) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.fn()
+			if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Errorf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package rdiff
+
+import "fmt"
+
+// ValidateSignature checks the structural invariants of a signature, as returned by ReadSignature, or built by
+// a third party: the hash algorithms are known, the sizes are in range, every strong hash has the size recorded
+// by the header, and, if the header records the target and the block sizes, there is a block for every target block.
+// The offsets and the lengths of the blocks, if set, must be the ones of the target blocks, and the second pass
+// hashes, if any, must be consistent with the header, see WithSecondPass.
+// It doesn't check the hashes match the target, see App.Delta for that.
+// It returns a non-nil error matching ErrCorrupt for the first invariant which doesn't hold.
+func ValidateSignature(blocks []Block, header SignatureHeader) error {
+	err := validateSignatureHeader(header)
+	if err != nil {
+		return markError(ErrCorrupt, err)
+	}
+	for i, b := range blocks {
+		if len(b.StrongHash) != header.StrongHashSize {
+			err = fmt.Errorf("the block %v strong hash has %v bytes, want %v", i, len(b.StrongHash), header.StrongHashSize)
+			return markError(ErrCorrupt, err)
+		}
+		err = validateBlockExtent(i, b, header)
+		if err != nil {
+			return markError(ErrCorrupt, err)
+		}
+	}
+	if n, ok := targetBlocks(header); ok && int64(len(blocks)) != n {
+		err = fmt.Errorf("the signature has %v blocks, but its target has %v blocks", len(blocks), n)
+		return markError(ErrCorrupt, err)
+	}
+
+	return nil
+}
+
+// validateSignatureHeader checks the hash algorithms are known, and the sizes are in range.
+func validateSignatureHeader(header SignatureHeader) error {
+	if header.WeakHash != WeakHashCustom {
+		if _, err := newRollingHash(header.WeakHash); err != nil {
+			return err
+		}
+	}
+	strongHasher, err := newStrongHash(header.StrongHash, nil)
+	if err != nil {
+		return err
+	}
+	if header.StrongHashSize <= 0 || header.StrongHashSize > strongHasher.Size() {
+		return fmt.Errorf("the strong hash size(%v) is out of the supported range [1, %v]", header.StrongHashSize, strongHasher.Size())
+	}
+	if n := len(header.StrongHashKeyID); n != 0 && n != strongHashKeyIDSize {
+		return fmt.Errorf("the strong hash key id has %v bytes, want %v", n, strongHashKeyIDSize)
+	}
+	if n := len(header.FileHash); n != 0 && n != strongHasher.Size() {
+		return fmt.Errorf("the file hash has %v bytes, want %v", n, strongHasher.Size())
+	}
+
+	return validateSignatureSizes(header)
+}
+
+// validateSignatureSizes checks the block and the target sizes are in range, 0 meaning unknown, and so are the second
+// pass ones, if any.
+func validateSignatureSizes(header SignatureHeader) error {
+	if header.BlockSize < 0 || header.BlockSize > MaxBlockSize {
+		return fmt.Errorf("invalid block size: %v", header.BlockSize)
+	}
+	if header.TargetSize < 0 {
+		return fmt.Errorf("invalid target size: %v", header.TargetSize)
+	}
+
+	return validateSecondPass(header, DecodeLimits{})
+}
+
+// validateBlockExtent checks the offset and the length of the i-th block, if they are set, locate the i-th block
+// of the target described by the header, as the blocks have the fixed size of the header, except the last one.
+func validateBlockExtent(i int, b Block, header SignatureHeader) error {
+	if b.Offset == 0 && b.Length == 0 {
+		return nil
+	}
+	off, length := blockExtent(int64(i), header)
+	if b.Offset != off || b.Length != length {
+		return fmt.Errorf("the block %v has %v bytes at %v, want %v bytes at %v", i, b.Length, b.Offset, length, off)
+	}
+
+	return nil
+}
+
+// targetBlocks returns the number of blocks of the target described by the header, and false if it's unknown,
+// because the header doesn't record the target size, or the block size.
+func targetBlocks(header SignatureHeader) (int64, bool) {
+	if header.BlockSize <= 0 || header.TargetSize <= 0 {
+		return 0, false
+	}
+
+	return (header.TargetSize + int64(header.BlockSize) - 1) / int64(header.BlockSize), true
+}
+
+// ValidateDelta checks the structural invariants of the operations of a delta, as returned by ReadDelta, computed
+// against a signature having the header: the operation types are known, the block indices are in range, the
+// target blocks have a single operation each, in ascending order, a copy only refers to a block having its
+// operation before it, a part only refers to a second pass block of the header, if it records them, and the literal
+// data doesn't exceed DefaultMaxLiteral. If the header records the target and
+// the block sizes, every target block must have an operation. It doesn't check the delta rebuilds the source, see
+// App.Patch for that.
+// It returns a non-nil error matching ErrCorrupt for the first invariant which doesn't hold.
+func ValidateDelta(ops []Operation, header SignatureHeader) error {
+	blocks, known := targetBlocks(header)
+	var next int64
+	for i, op := range ops {
+		err := validateOperation(op, header)
+		if err != nil {
+			return markError(ErrCorrupt, fmt.Errorf("the operation %v: %w", i, err))
+		}
+		next, err = validateBlockIndex(op, next)
+		if err != nil {
+			return markError(ErrCorrupt, fmt.Errorf("the operation %v: %w", i, err))
+		}
+		if known && next > blocks {
+			return markError(ErrCorrupt, fmt.Errorf("the operation %v block index %v is beyond the %v target blocks", i, op.BlockIndex, blocks))
+		}
+	}
+	if known && next != blocks {
+		return markError(ErrCorrupt, fmt.Errorf("the delta has operations for %v of the %v target blocks", next, blocks))
+	}
+
+	return nil
+}
+
+// validateBlockIndex checks the block index of op, given the next target block expecting its operation, and
+// returns the next one after op.
+func validateBlockIndex(op Operation, next int64) (int64, error) {
+	switch {
+	case op.Type == OpBlockNew || op.Type == OpBlockZero || op.Type == OpBlockPart:
+		return next, nil
+	case op.Type == OpBlockCopy && (op.BlockIndex < 0 || op.BlockIndex >= next):
+		return next, fmt.Errorf("a copy of the block %v, before its operation", op.BlockIndex)
+	case op.Type == OpBlockCopy:
+		return next, nil
+	case op.BlockIndex != next:
+		return next, fmt.Errorf("the block index %v, want %v", op.BlockIndex, next)
+	default:
+		return next + 1, nil
+	}
+}
+
+// validateOperation checks the fields of op are consistent with its type, and, for a part, with the second pass
+// blocks of the header.
+func validateOperation(op Operation, header SignatureHeader) error {
+	if len(op.Data) > DefaultMaxLiteral {
+		return fmt.Errorf("%v literal bytes, more than the limit of %v", len(op.Data), DefaultMaxLiteral)
+	}
+	switch op.Type {
+	case OpBlockKeep, OpBlockUpdate, OpBlockRemove, OpBlockCopy:
+		return validateBlockOperation(op)
+	case OpBlockNew, OpBlockZero:
+		return validateRunOperation(op)
+	case OpBlockPart:
+		return validatePartOperation(op, header)
+	default:
+		return fmt.Errorf("invalid operation type: %v", op.Type)
+	}
+}
+
+// validateBlockOperation checks the fields of an operation of a target block: only an update has literal data,
+// and a copy may have it.
+func validateBlockOperation(op Operation) error {
+	if op.Zeros != 0 {
+		return fmt.Errorf("a %v operation with %v zeros", op.Type, op.Zeros)
+	}
+	if op.Type != OpBlockCopy && (len(op.Data) > 0) != (op.Type == OpBlockUpdate) {
+		return fmt.Errorf("a %v operation with %v literal bytes", op.Type, len(op.Data))
+	}
+
+	return nil
+}
+
+// validatePartOperation checks a part refers to a second pass block, if the header records them, and has no zeros.
+func validatePartOperation(op Operation, header SignatureHeader) error {
+	if op.Zeros != 0 {
+		return fmt.Errorf("a %v operation with %v zeros", op.Type, op.Zeros)
+	}
+	if op.BlockIndex < 0 || (header.SecondPass != nil && op.BlockIndex >= int64(len(header.SecondPass.WeakHashes))) {
+		return fmt.Errorf("a %v of the second pass block %v, out of the target", op.Type, op.BlockIndex)
+	}
+
+	return nil
+}
+
+// validateRunOperation checks the fields of an operation which doesn't refer to a target block: a new block has
+// literal data, and a zero run has zeros.
+func validateRunOperation(op Operation) error {
+	if op.BlockIndex != -1 {
+		return fmt.Errorf("a %v operation with the block index %v", op.Type, op.BlockIndex)
+	}
+	if op.Type == OpBlockNew && (len(op.Data) == 0 || op.Zeros != 0) {
+		return fmt.Errorf("a new operation with %v literal bytes, and %v zeros", len(op.Data), op.Zeros)
+	}
+	if op.Type == OpBlockZero && (op.Zeros <= 0 || len(op.Data) > 0) {
+		return fmt.Errorf("a zero operation with %v zeros, and %v literal bytes", op.Zeros, len(op.Data))
+	}
+
+	return nil
+}
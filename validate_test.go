@@ -0,0 +1,150 @@
+package rdiff
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"testing"
+)
+
+func TestValidateSignature(t *testing.T) {
+	valid := SignatureHeader{StrongHashSize: md5.Size, BlockSize: 4, TargetSize: 10}
+	blocks := func(n, size int) []Block {
+		out := make([]Block, n)
+		for i := range out {
+			out[i].StrongHash = make([]byte, size)
+		}
+		return out
+	}
+	// located sets the offset and the length of every block, from the extents pairs
+	located := func(blocks []Block, extents ...int) []Block {
+		for i := range blocks {
+			blocks[i].Offset, blocks[i].Length = int64(extents[2*i]), extents[2*i+1]
+		}
+		return blocks
+	}
+	with := func(fn func(h *SignatureHeader)) SignatureHeader {
+		h := valid
+		fn(&h)
+		return h
+	}
+	tests := []struct {
+		name   string
+		blocks []Block
+		header SignatureHeader
+		fail   bool
+	}{
+		{name: "valid", blocks: blocks(3, md5.Size), header: valid},
+		{name: "unknown sizes", blocks: blocks(5, 4), header: SignatureHeader{StrongHashSize: 4}},
+		{name: "custom weak hash", blocks: blocks(3, md5.Size), header: with(func(h *SignatureHeader) { h.WeakHash = WeakHashCustom })},
+		{name: "unknown weak hash", blocks: blocks(3, md5.Size), header: with(func(h *SignatureHeader) { h.WeakHash = 100 }), fail: true},
+		{name: "unknown strong hash", blocks: blocks(3, md5.Size), header: with(func(h *SignatureHeader) { h.StrongHash = 100 }), fail: true},
+		{name: "strong hash size too big", blocks: blocks(3, md5.Size+1), header: with(func(h *SignatureHeader) { h.StrongHashSize = md5.Size + 1 }), fail: true},
+		{name: "strong hash size zero", blocks: blocks(3, 0), header: with(func(h *SignatureHeader) { h.StrongHashSize = 0 }), fail: true},
+		{name: "file hash", blocks: blocks(3, md5.Size), header: with(func(h *SignatureHeader) { h.FileHash = make([]byte, md5.Size) })},
+		{name: "file hash size", blocks: blocks(3, md5.Size), header: with(func(h *SignatureHeader) { h.FileHash = []byte{1} }), fail: true},
+		{name: "strong hash key id size", blocks: blocks(3, md5.Size), header: with(func(h *SignatureHeader) { h.StrongHashKeyID = []byte{1} }), fail: true},
+		{name: "block size", blocks: blocks(3, md5.Size), header: with(func(h *SignatureHeader) { h.BlockSize = MaxBlockSize + 1 }), fail: true},
+		{name: "target size", blocks: blocks(3, md5.Size), header: with(func(h *SignatureHeader) { h.TargetSize = -1 }), fail: true},
+		{name: "strong hash of another size", blocks: append(blocks(2, md5.Size), Block{StrongHash: []byte{1}}), header: valid, fail: true},
+		{name: "missing block", blocks: blocks(2, md5.Size), header: valid, fail: true},
+		{name: "located blocks", blocks: located(blocks(3, md5.Size), 0, 4, 4, 4, 8, 2), header: valid},
+		{name: "wrong offset", blocks: located(blocks(3, md5.Size), 0, 4, 5, 4, 8, 2), header: valid, fail: true},
+		{name: "wrong last length", blocks: located(blocks(3, md5.Size), 0, 4, 4, 4, 8, 4), header: valid, fail: true},
+		{name: "located blocks of an unknown target", blocks: located(blocks(1, 4), 0, 4), header: SignatureHeader{StrongHashSize: 4}, fail: true},
+		{name: "extra block", blocks: blocks(4, md5.Size), header: valid, fail: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSignature(tt.blocks, tt.header)
+			if tt.fail != (err != nil) || (err != nil && !errors.Is(err, ErrCorrupt)) {
+				t.Errorf("ValidateSignature() error = %v, fail %v", err, tt.fail)
+			}
+		})
+	}
+}
+
+func TestValidateDelta(t *testing.T) {
+	// the target has 3 blocks
+	header := SignatureHeader{StrongHashSize: md5.Size, BlockSize: 4, TargetSize: 10}
+	tests := []struct {
+		name   string
+		ops    []Operation
+		header SignatureHeader
+		fail   bool
+	}{
+		{name: "valid", header: header, ops: []Operation{
+			{Type: OpBlockNew, BlockIndex: -1, Data: []byte{1}},
+			{Type: OpBlockKeep, BlockIndex: 0},
+			{Type: OpBlockZero, BlockIndex: -1, Zeros: 4},
+			{Type: OpBlockUpdate, BlockIndex: 1, Data: []byte{2}},
+			{Type: OpBlockRemove, BlockIndex: 2},
+			{Type: OpBlockNew, BlockIndex: -1, Data: []byte{3}},
+		}},
+		{name: "copies", header: header, ops: []Operation{
+			{Type: OpBlockKeep, BlockIndex: 0},
+			{Type: OpBlockCopy, BlockIndex: 0},
+			{Type: OpBlockRemove, BlockIndex: 1},
+			{Type: OpBlockCopy, BlockIndex: 1, Data: []byte{1}},
+			{Type: OpBlockKeep, BlockIndex: 2},
+		}},
+		{name: "unknown target", ops: []Operation{{Type: OpBlockKeep, BlockIndex: 0}}},
+		{name: "empty target", header: SignatureHeader{BlockSize: 4}, ops: []Operation{{Type: OpBlockNew, BlockIndex: -1, Data: []byte{1}}}},
+		{name: "unknown type", ops: []Operation{{Type: OpBlockCopy + 1, BlockIndex: -1}}, fail: true},
+		{name: "keep with data", ops: []Operation{{Type: OpBlockKeep, BlockIndex: 0, Data: []byte{1}}}, fail: true},
+		{name: "update without data", ops: []Operation{{Type: OpBlockUpdate, BlockIndex: 0}}, fail: true},
+		{name: "remove with zeros", ops: []Operation{{Type: OpBlockRemove, BlockIndex: 0, Zeros: 1}}, fail: true},
+		{name: "new with a block index", ops: []Operation{{Type: OpBlockNew, BlockIndex: 0, Data: []byte{1}}}, fail: true},
+		{name: "new without data", ops: []Operation{{Type: OpBlockNew, BlockIndex: -1}}, fail: true},
+		{name: "zero without zeros", ops: []Operation{{Type: OpBlockZero, BlockIndex: -1}}, fail: true},
+		{name: "zero with data", ops: []Operation{{Type: OpBlockZero, BlockIndex: -1, Zeros: 1, Data: []byte{1}}}, fail: true},
+		{name: "literal too long", ops: []Operation{{Type: OpBlockNew, BlockIndex: -1, Data: make([]byte, DefaultMaxLiteral+1)}}, fail: true},
+		{name: "skipped block", ops: []Operation{{Type: OpBlockKeep, BlockIndex: 1}}, fail: true},
+		{name: "repeated block", ops: []Operation{{Type: OpBlockKeep, BlockIndex: 0}, {Type: OpBlockKeep, BlockIndex: 0}}, fail: true},
+		{name: "copy before the block operation", ops: []Operation{{Type: OpBlockCopy, BlockIndex: 0}}, fail: true},
+		{name: "copy with zeros", ops: []Operation{{Type: OpBlockKeep, BlockIndex: 0}, {Type: OpBlockCopy, BlockIndex: 0, Zeros: 1}}, fail: true},
+		{name: "part", ops: []Operation{{Type: OpBlockPart, BlockIndex: 5, Data: []byte{1}}, {Type: OpBlockKeep, BlockIndex: 0}}},
+		{name: "part with zeros", ops: []Operation{{Type: OpBlockPart, BlockIndex: 0, Zeros: 1}}, fail: true},
+		{name: "part beyond the second pass", header: SignatureHeader{SecondPass: &SecondPassSignature{BlockSize: 2, WeakHashes: make([]uint64, 5)}}, fail: true, ops: []Operation{
+			{Type: OpBlockPart, BlockIndex: 5},
+		}},
+		{name: "negative block index", ops: []Operation{{Type: OpBlockKeep, BlockIndex: -1}}, fail: true},
+		{name: "block beyond the target", header: SignatureHeader{BlockSize: 4, TargetSize: 4}, fail: true, ops: []Operation{
+			{Type: OpBlockKeep, BlockIndex: 0},
+			{Type: OpBlockKeep, BlockIndex: 1},
+		}},
+		{name: "missing block", header: header, fail: true, ops: []Operation{
+			{Type: OpBlockKeep, BlockIndex: 0},
+			{Type: OpBlockKeep, BlockIndex: 1},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDelta(tt.ops, tt.header)
+			if tt.fail != (err != nil) || (err != nil && !errors.Is(err, ErrCorrupt)) {
+				t.Errorf("ValidateDelta() error = %v, fail %v", err, tt.fail)
+			}
+		})
+	}
+}
+
+func TestValidate_ComputedArtifacts(t *testing.T) {
+	for _, tt := range rDiffE2ETests {
+		if tt.wantErr {
+			continue
+		}
+		r := newTestRDiff(tt.in.blockSize, rDiffE2EConfigs[0])
+		sig, err := r.ComputeSignature(bytes.NewReader(tt.in.target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := r.signatureHeader()
+		header.TargetSize = int64(len(tt.in.target))
+		if err := ValidateSignature(sig.blocks(header), header); err != nil {
+			t.Errorf("ValidateSignature() of a computed signature error = %v", err)
+		}
+		if err := ValidateDelta(tt.out, header); err != nil {
+			t.Errorf("ValidateDelta(%v) of a computed delta error = %v", tt.out, err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package rdiff
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+const (
+	// vcdiffMaxWindowData is the max size of the literal data of a window, so the decoders' window limits
+	// are not reached
+	vcdiffMaxWindowData = 1 << 20
+	// vcdiffSource is the Win_Indicator bit of the windows copying from the source file
+	vcdiffSource = 0x01
+	// vcdiffAdd and vcdiffCopy are the default code table instructions with the size in the instructions section:
+	// ADD and COPY, using the VCD_SELF address mode
+	vcdiffAdd  = 1
+	vcdiffCopy = 19
+)
+
+// vcdiffHeader is the VCDIFF magic, version 0, and the Hdr_Indicator, without secondary compression
+// or application data.
+var vcdiffHeader = []byte{0xD6, 0xC3, 0xC4, 0x00, 0x00}
+
+// writeDeltaVCDIFF computes the delta using compute, and serializes its operations as they are emitted, as VCDIFF
+// windows: an operation is encoded as a window adding its data, then copying its target block, which is the source
+// segment of the window, so only the target blocks layout is needed to encode a delta.
+func writeDeltaVCDIFF(w io.Writer, layout targetLayout, compute func(emit func(Operation) error) error) error {
+	bw := bufio.NewWriter(w)
+	_, err := bw.Write(vcdiffHeader)
+	if err != nil {
+		return err
+	}
+	err = compute(func(op Operation) error {
+		return writeVCDIFFOperation(bw, layout, op)
+	})
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// writeVCDIFFOperation writes the windows of op, the data bigger than vcdiffMaxWindowData being split
+// in multiple windows.
+func writeVCDIFFOperation(w io.Writer, layout targetLayout, op Operation) error {
+	if op.Type == OpBlockZero {
+		// the zero runs are added as literal data, RFC 3284 having no fill instruction outside the RUN ones
+		return zeroChunks(op.Zeros, func(p []byte) error { return writeVCDIFFWindow(w, p, 0, 0) })
+	}
+	data := op.Data
+	for len(data) > vcdiffMaxWindowData {
+		err := writeVCDIFFWindow(w, data[:vcdiffMaxWindowData], 0, 0)
+		if err != nil {
+			return err
+		}
+		data = data[vcdiffMaxWindowData:]
+	}
+	if !op.Type.copiesBlock() && op.Type != OpBlockPart {
+		return writeVCDIFFWindow(w, data, 0, 0)
+	}
+	off, length, ok := layout.extent(op)
+	if !ok {
+		return fmt.Errorf("the block %v is out of the target size(%v), the signature must record the target size", op.BlockIndex, layout.size)
+	}
+
+	return writeVCDIFFWindow(w, data, off, length)
+}
+
+// writeVCDIFFWindow writes a window adding data, followed by copying copyLen bytes of the source, from copyOff.
+// Empty windows are not written.
+func writeVCDIFFWindow(w io.Writer, data []byte, copyOff, copyLen int64) error {
+	if len(data) == 0 && copyLen == 0 {
+		return nil
+	}
+	var inst, addr []byte
+	if len(data) > 0 {
+		inst = append(inst, vcdiffAdd)
+		inst = appendVCDIFFInt(inst, uint64(len(data)))
+	}
+	if copyLen > 0 {
+		inst = append(inst, vcdiffCopy)
+		inst = appendVCDIFFInt(inst, uint64(copyLen))
+		// the source segment is the copied block, so the address is always its start
+		addr = appendVCDIFFInt(addr, 0)
+	}
+
+	// the delta encoding: the target window length, the Delta_Indicator, and the sections lengths
+	enc := appendVCDIFFInt(nil, uint64(int64(len(data))+copyLen))
+	enc = append(enc, 0)
+	enc = appendVCDIFFInt(enc, uint64(len(data)))
+	enc = appendVCDIFFInt(enc, uint64(len(inst)))
+	enc = appendVCDIFFInt(enc, uint64(len(addr)))
+
+	var header []byte
+	if copyLen > 0 {
+		header = append(header, vcdiffSource)
+		header = appendVCDIFFInt(header, uint64(copyLen))
+		header = appendVCDIFFInt(header, uint64(copyOff))
+	} else {
+		header = append(header, 0)
+	}
+	header = appendVCDIFFInt(header, uint64(len(enc)+len(data)+len(inst)+len(addr)))
+
+	for _, p := range [][]byte{header, enc, data, inst, addr} {
+		_, err := w.Write(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendVCDIFFInt appends v as a VCDIFF integer: base 128, most significant digit first, every digit except
+// the last one having the high bit set.
+func appendVCDIFFInt(b []byte, v uint64) []byte {
+	var digits [10]byte
+	i := len(digits) - 1
+	digits[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		digits[i] = byte(v&0x7f) | 0x80
+	}
+
+	return append(b, digits[i:]...)
+}
@@ -0,0 +1,140 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// vcdiffDecode applies a VCDIFF delta to source, it supports the subset of VCDIFF written by writeDeltaVCDIFF:
+// no secondary compression, the default code table, and the ADD/COPY instructions with the size in the
+// instructions section.
+func vcdiffDecode(source, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	header := make([]byte, len(vcdiffHeader))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, vcdiffHeader) {
+		return nil, fmt.Errorf("invalid header: %v", header)
+	}
+	var target []byte
+	for r.Len() > 0 {
+		indicator, _ := r.ReadByte()
+		var segment []byte
+		if indicator&vcdiffSource != 0 {
+			size, pos := readVCDIFFInt(r), readVCDIFFInt(r)
+			if pos+size > uint64(len(source)) {
+				return nil, errors.New("source segment out of range")
+			}
+			segment = source[pos : pos+size]
+		}
+		_ = readVCDIFFInt(r)
+		windowLen := readVCDIFFInt(r)
+		if deltaIndicator, _ := r.ReadByte(); deltaIndicator != 0 {
+			return nil, errors.New("compressed sections are not supported")
+		}
+		sections := make([][]byte, 3)
+		lens := []uint64{readVCDIFFInt(r), readVCDIFFInt(r), readVCDIFFInt(r)}
+		for i := range sections {
+			sections[i] = make([]byte, lens[i])
+			if _, err := io.ReadFull(r, sections[i]); err != nil {
+				return nil, err
+			}
+		}
+		data, inst, addr := sections[0], bytes.NewReader(sections[1]), bytes.NewReader(sections[2])
+		window := []byte{}
+		for inst.Len() > 0 {
+			opcode, _ := inst.ReadByte()
+			size := readVCDIFFInt(inst)
+			switch opcode {
+			case vcdiffAdd:
+				window, data = append(window, data[:size]...), data[size:]
+			case vcdiffCopy:
+				a := readVCDIFFInt(addr)
+				if a+size > uint64(len(segment)) {
+					return nil, errors.New("copy out of the source segment")
+				}
+				window = append(window, segment[a:a+size]...)
+			default:
+				return nil, fmt.Errorf("unsupported opcode: %v", opcode)
+			}
+		}
+		if uint64(len(window)) != windowLen {
+			return nil, fmt.Errorf("window length %v, want %v", len(window), windowLen)
+		}
+		target = append(target, window...)
+	}
+
+	return target, nil
+}
+
+func readVCDIFFInt(r io.ByteReader) uint64 {
+	var v uint64
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return v
+		}
+		v = v<<7 | uint64(b&0x7f)
+		if b&0x80 == 0 {
+			return v
+		}
+	}
+}
+
+func TestAppendVCDIFFInt(t *testing.T) {
+	for _, tt := range []struct {
+		in  uint64
+		out []byte
+	}{
+		{in: 0, out: []byte{0}},
+		{in: 127, out: []byte{0x7f}},
+		{in: 128, out: []byte{0x81, 0x00}},
+		// the RFC 3284 example
+		{in: 123456789, out: []byte{0xBA, 0xEF, 0x9A, 0x15}},
+	} {
+		if got := appendVCDIFFInt(nil, tt.in); !bytes.Equal(got, tt.out) {
+			t.Errorf("appendVCDIFFInt(%v) = %x, want %x", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestWriteDeltaVCDIFF(t *testing.T) {
+	tests := rDiffE2ETests
+	rnd := rand.New(rand.NewSource(1))
+	large := make([]byte, 3*vcdiffMaxWindowData)
+	rnd.Read(large)
+	tests = append(tests, struct {
+		in      inE2E
+		out     []Operation
+		wantErr bool
+	}{
+		in:  inE2E{blockSize: 10, target: large[:20], source: append(large[100:], large[:20]...)},
+		out: []Operation{{Type: OpBlockUpdate, BlockIndex: 0, Data: large[100:]}, {Type: OpBlockKeep, BlockIndex: 1}},
+	})
+	for _, tt := range tests {
+		if tt.in.blockSize <= 0 {
+			continue
+		}
+		var buf bytes.Buffer
+		err := writeDeltaVCDIFF(&buf, targetLayout{size: int64(len(tt.in.target)), blockSize: tt.in.blockSize}, func(emit func(Operation) error) error {
+			for _, op := range tt.out {
+				if err := emit(op); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("writeDeltaVCDIFF() error = %v", err)
+		}
+		got, err := vcdiffDecode(tt.in.target, buf.Bytes())
+		if err != nil {
+			t.Fatalf("vcdiffDecode() error = %v", err)
+		}
+		if !bytes.Equal(got, tt.in.source) {
+			t.Errorf("vcdiffDecode() = %v, want %v", got, tt.in.source)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Verify checks the target file(targetFilePath) still matches its signature file(signaturePath), as written by
+// Signature, by hashing the target again, so it's a cheap scrub of the data stored alongside its signature.
+// It returns true if every block matches, otherwise false and the indices of the blocks which don't, ascending:
+// the changed ones, and the ones the target gained or lost since the signature was computed.
+// The signature's hash algorithms and block size are adopted, unless configured, in which case they must match,
+// the same way Delta does. A signature which doesn't record its block size requires it to be configured.
+// If the target is modified while it's read, a non-nil error matching ErrModified is returned.
+func (a *App) Verify(targetFilePath string, signaturePath string) (bool, []int64, error) {
+	err := a.diffEngine.checkHashers()
+	if err != nil {
+		return false, nil, err
+	}
+	header, sig, err := a.loadSignature(signaturePath)
+	if err != nil {
+		return false, nil, err
+	}
+	r, err := a.diffEngine.negotiated(header)
+	if err != nil {
+		return false, nil, err
+	}
+	if r.blockSize <= 0 {
+		return false, nil, errors.New("the signature doesn't record its block size, it must be configured")
+	}
+
+	target, err := a.verifySignature(r, targetFilePath)
+	if err != nil {
+		return false, nil, err
+	}
+	mismatches := mismatchedBlocks(&sig, &target)
+
+	return len(mismatches) == 0, mismatches, nil
+}
+
+// verifySignature computes the signature of the target file, using the engine r, negotiated against the signature.
+func (a *App) verifySignature(r *rDiff, targetFilePath string) (signatureTable, error) {
+	targetFile, err := openSequential(targetFilePath)
+	if err != nil {
+		return signatureTable{}, err
+	}
+	snapshot, err := newInputSnapshot(targetFile)
+	if err != nil {
+		return signatureTable{}, errors.Join(err, targetFile.Close())
+	}
+	targetSize := snapshot.info.Size()
+	target, release := a.inputReader(targetFile, targetSize)
+	target = a.withReadProgress(snapshot.reader(target), "verify", targetSize)
+	sig, err := r.ComputeSignature(target)
+	if err == nil {
+		err = snapshot.check()
+	}
+	err = errors.Join(err, release(), targetFile.Close())
+	if err != nil {
+		return signatureTable{}, fmt.Errorf("hashing the target: %w", err)
+	}
+
+	return sig, nil
+}
+
+// mismatchedBlocks returns the indices of the blocks which differ between the signature and the target ones,
+// including the blocks only one of them has.
+func mismatchedBlocks(sig, target *signatureTable) []int64 {
+	var out []int64
+	for i := 0; i < max(sig.len(), target.len()); i++ {
+		if i >= sig.len() || i >= target.len() ||
+			sig.WeakHashes[i] != target.WeakHashes[i] || !bytes.Equal(sig.strongHash(i), target.strongHash(i)) {
+			out = append(out, int64(i))
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,78 @@
+package rdiff
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestApp_Verify(t *testing.T) {
+	dir := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4)
+	targetPath, sigPath := filepath.Join(dir, "target"), filepath.Join(dir, "signature")
+	if err := os.WriteFile(targetPath, content, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(16, WithStrongHash(StrongHashSHA256)).Signature(targetPath, sigPath); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := append([]byte{}, content...)
+	edited[20] = 'x'
+	tests := []struct {
+		name   string
+		target []byte
+		want   []int64
+	}{
+		{name: "unchanged", target: content},
+		{name: "edited", target: edited, want: []int64{1}},
+		{name: "truncated", target: content[:40], want: []int64{2, 3}},
+		{name: "appended", target: append(append([]byte{}, content...), "tail"...), want: []int64{4}},
+		{name: "empty", want: []int64{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := os.WriteFile(targetPath, tt.target, 0666); err != nil {
+				t.Fatal(err)
+			}
+			// the block size, and the hash algorithms, are adopted from the signature
+			ok, got, err := New(0).Verify(targetPath, sigPath)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if ok != (len(tt.want) == 0) {
+				t.Errorf("Verify() = %v, want %v", ok, len(tt.want) == 0)
+			}
+			if diff := cmp.Diff(got, tt.want); diff != "" {
+				t.Errorf("Verify() mismatches = %v, want %v\nDIFF: %v", got, tt.want, diff)
+			}
+		})
+	}
+}
+
+func TestApp_Verify_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	targetPath, sigPath := filepath.Join(dir, "target"), filepath.Join(dir, "signature")
+	if err := os.WriteFile(targetPath, bytes.Repeat([]byte("content "), 10), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(16).Signature(targetPath, sigPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := New(32).Verify(targetPath, sigPath); !errors.Is(err, ErrVerification) {
+		t.Errorf("Verify() with another block size error = %v, want %v", err, ErrVerification)
+	}
+	if _, _, err := New(0, WithStrongHash(StrongHashSHA1)).Verify(targetPath, sigPath); !errors.Is(err, ErrVerification) {
+		t.Errorf("Verify() with another strong hash error = %v, want %v", err, ErrVerification)
+	}
+	if _, _, err := New(0).Verify(targetPath, targetPath); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Verify() of an invalid signature error = %v, want %v", err, ErrCorrupt)
+	}
+	if _, _, err := New(0).Verify(filepath.Join(dir, "missing"), sigPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Verify() of a missing target error = %v, want %v", err, os.ErrNotExist)
+	}
+}
@@ -0,0 +1,271 @@
+package rdiff
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay is the time a file must be left unchanged before its signature is recomputed, so a file being written
+// is not hashed after every write.
+var watchDelay = 200 * time.Millisecond
+
+// WatchEvent describes a signature update made by Watch.
+type WatchEvent struct {
+	// Path is the path of the changed file, relative to the watched directory, empty for the errors which are not
+	// related to a file
+	Path string
+	// Removed means the file was removed, and so was its signature
+	Removed bool
+	// Err is the error of the update, if any
+	Err error
+}
+
+// Watch keeps the signatures of the files under dir up to date, until ctx is done, and returns ctx.Err().
+// The signature of a file is written to signatureDir, at the file's path relative to dir, so the signatures of the
+// sub-directories are written to the matching sub-directories of signatureDir.
+// It first computes the signatures which are missing, or older than their files, then it recomputes the signature
+// of a file every time the file changes, and removes it when the file is removed, without rescanning dir.
+// Each signature is written to a temporary file, then renamed, so a reader never sees a partial signature.
+// The fn function, if not nil, receives every update, including the failed ones, which don't stop the watch.
+// The signatures are computed one at a time, so the App must not be used concurrently until Watch returns.
+// It returns a non-nil error if dir can't be watched.
+func (a *App) Watch(ctx context.Context, dir, signatureDir string, fn func(WatchEvent)) error {
+	if fn == nil {
+		fn = func(WatchEvent) {}
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	signatureDir, err = filepath.Abs(signatureDir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(signatureDir, 0777)
+	if err != nil {
+		return err
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+
+	w := &watcher{
+		app:          a,
+		dir:          dir,
+		signatureDir: signatureDir,
+		fsw:          fsw,
+		fn:           fn,
+		pending:      make(map[string]time.Time),
+	}
+	err = w.scan(dir)
+	if err != nil {
+		return err
+	}
+
+	return w.loop(ctx)
+}
+
+// watcher is the state of a Watch call.
+type watcher struct {
+	app          *App
+	dir          string
+	signatureDir string
+	fsw          *fsnotify.Watcher
+	fn           func(WatchEvent)
+	// pending holds the changed files, relative to dir, and the time of their last change
+	pending map[string]time.Time
+}
+
+// loop processes the file system events until ctx is done.
+func (w *watcher) loop(ctx context.Context) error {
+	timer := time.NewTimer(watchDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return errors.New("the file system watcher was closed")
+			}
+			w.handle(ev)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return errors.New("the file system watcher was closed")
+			}
+			w.handleError(err)
+		case now := <-timer.C:
+			w.flush(now)
+		}
+		w.schedule(timer)
+	}
+}
+
+// handle records the file changed by ev, a new directory is watched and scanned right away.
+func (w *watcher) handle(ev fsnotify.Event) {
+	rel, ok := w.rel(ev.Name)
+	if !ok || ev.Op == fsnotify.Chmod {
+		return
+	}
+	if ev.Has(fsnotify.Create) {
+		info, err := os.Lstat(ev.Name)
+		if err == nil && info.IsDir() {
+			w.report(rel, w.scan(ev.Name))
+			return
+		}
+	}
+	w.pending[rel] = time.Now()
+}
+
+// handleError reports a watcher error, the events lost by an overflow are recovered by scanning dir again.
+func (w *watcher) handleError(err error) {
+	if errors.Is(err, fsnotify.ErrEventOverflow) {
+		err = w.scan(w.dir)
+	}
+	w.report("", err)
+}
+
+// schedule resets the timer to the time the first pending file is due.
+func (w *watcher) schedule(timer *time.Timer) {
+	if len(w.pending) == 0 {
+		return
+	}
+	var first time.Time
+	for _, t := range w.pending {
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+	}
+	timer.Stop()
+	select {
+	case <-timer.C:
+	default:
+	}
+	timer.Reset(time.Until(first.Add(watchDelay)))
+}
+
+// flush updates the signatures of the pending files left unchanged for watchDelay.
+func (w *watcher) flush(now time.Time) {
+	for rel, t := range w.pending {
+		if now.Sub(t) < watchDelay {
+			continue
+		}
+		delete(w.pending, rel)
+		w.update(rel)
+	}
+}
+
+// scan watches root and its sub-directories, and updates the signatures which are missing or older than their files.
+func (w *watcher) scan(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, ok := w.rel(path)
+		if !ok {
+			return filepath.SkipDir
+		}
+		if d.IsDir() {
+			return w.fsw.Add(path)
+		}
+		if d.Type().IsRegular() && w.stale(rel) {
+			w.update(rel)
+		}
+		return nil
+	})
+}
+
+// stale reports whether the signature of the file is missing or older than the file.
+func (w *watcher) stale(rel string) bool {
+	info, err := os.Stat(filepath.Join(w.dir, rel))
+	if err != nil {
+		return true
+	}
+	sigInfo, err := os.Stat(filepath.Join(w.signatureDir, rel))
+
+	return err != nil || sigInfo.ModTime().Before(info.ModTime())
+}
+
+// update recomputes the signature of the file, or removes it if the file no longer exists, and reports it.
+func (w *watcher) update(rel string) {
+	signaturePath := filepath.Join(w.signatureDir, rel)
+	info, err := os.Stat(filepath.Join(w.dir, rel))
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, err := os.Lstat(signaturePath); err == nil {
+			w.fn(WatchEvent{Path: rel, Removed: true, Err: os.RemoveAll(signaturePath)})
+		}
+		return
+	}
+	if err == nil && !info.Mode().IsRegular() {
+		return
+	}
+	if err == nil {
+		err = w.app.replaceSignature(filepath.Join(w.dir, rel), signaturePath)
+	}
+	w.fn(WatchEvent{Path: rel, Err: err})
+}
+
+// report reports a non-nil err.
+func (w *watcher) report(rel string, err error) {
+	if err != nil {
+		w.fn(WatchEvent{Path: rel, Err: err})
+	}
+}
+
+// rel returns the path relative to dir, it returns false for the paths under signatureDir, which must not be watched
+// when signatureDir is a sub-directory of dir.
+func (w *watcher) rel(path string) (string, bool) {
+	if path == w.signatureDir || strings.HasPrefix(path, w.signatureDir+string(filepath.Separator)) {
+		return "", false
+	}
+	rel, err := filepath.Rel(w.dir, path)
+	if err != nil {
+		return "", false
+	}
+
+	return rel, true
+}
+
+// replaceSignature computes the signature of the target file into a temporary file, then renames it to
+// signaturePath, replacing the previous signature. The block size is decided for every target, if it's dynamic.
+func (a *App) replaceSignature(targetFilePath, signaturePath string) error {
+	blockSize := a.diffEngine.blockSize
+	defer func() { a.diffEngine.blockSize = blockSize }()
+
+	target, err := os.Open(targetFilePath)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	info, err := target.Stat()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(signaturePath), 0777)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(signaturePath), "."+filepath.Base(signaturePath)+".*")
+	if err != nil {
+		return err
+	}
+	err = a.SignatureAt(target, info.Size(), tmp)
+	err = errors.Join(err, tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), signaturePath)
+	}
+	if err != nil {
+		return errors.Join(err, os.Remove(tmp.Name()))
+	}
+
+	return nil
+}
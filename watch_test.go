@@ -0,0 +1,165 @@
+package rdiff
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// startWatch runs Watch in the background, until the test ends, and returns its events.
+func startWatch(t *testing.T, app *App, dir, signatureDir string) <-chan WatchEvent {
+	t.Helper()
+	delay := watchDelay
+	watchDelay = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan WatchEvent, 100)
+	done := make(chan error)
+	go func() {
+		done <- app.Watch(ctx, dir, signatureDir, func(ev WatchEvent) { events <- ev })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Watch() error = %v, want %v", err, context.Canceled)
+		}
+		watchDelay = delay
+	})
+
+	return events
+}
+
+// waitWatchEvent returns the first event for path, failing the test after a timeout.
+func waitWatchEvent(t *testing.T, events <-chan WatchEvent, path string) WatchEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Path == path {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("Watch(): no event for %v", path)
+			return WatchEvent{}
+		}
+	}
+}
+
+// checkWatchSignature checks the signature of path describes a target of the given size.
+func checkWatchSignature(t *testing.T, signatureDir, path string, size int64) {
+	t.Helper()
+	f, err := os.Open(filepath.Join(signatureDir, path))
+	if err != nil {
+		t.Fatalf("Watch(): %v", err)
+	}
+	defer f.Close()
+	header, _, err := ReadSignature(f)
+	if err != nil {
+		t.Fatalf("ReadSignature(%v) error = %v", path, err)
+	}
+	if header.TargetSize != size {
+		t.Errorf("Watch(): the %v signature target size = %v, want %v", path, header.TargetSize, size)
+	}
+}
+
+func TestApp_Watch(t *testing.T) {
+	dir := t.TempDir()
+	signatureDir := filepath.Join(t.TempDir(), "signatures")
+	writeFile := func(name string, size int) {
+		err := os.WriteFile(filepath.Join(dir, name), bytes.Repeat([]byte("abcdefgh"), size/8), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("existing", 64)
+	events := startWatch(t, New(16), dir, signatureDir)
+
+	if ev := waitWatchEvent(t, events, "existing"); ev.Err != nil || ev.Removed {
+		t.Fatalf("Watch() initial event = %+v", ev)
+	}
+	checkWatchSignature(t, signatureDir, "existing", 64)
+
+	writeFile("existing", 128)
+	if ev := waitWatchEvent(t, events, "existing"); ev.Err != nil || ev.Removed {
+		t.Fatalf("Watch() change event = %+v", ev)
+	}
+	checkWatchSignature(t, signatureDir, "existing", 128)
+
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(filepath.Join("sub", "new"), 32)
+	if ev := waitWatchEvent(t, events, filepath.Join("sub", "new")); ev.Err != nil || ev.Removed {
+		t.Fatalf("Watch() sub-directory event = %+v", ev)
+	}
+	checkWatchSignature(t, signatureDir, filepath.Join("sub", "new"), 32)
+
+	if err := os.Remove(filepath.Join(dir, "existing")); err != nil {
+		t.Fatal(err)
+	}
+	if ev := waitWatchEvent(t, events, "existing"); ev.Err != nil || !ev.Removed {
+		t.Fatalf("Watch() remove event = %+v", ev)
+	}
+	if _, err := os.Stat(filepath.Join(signatureDir, "existing")); !os.IsNotExist(err) {
+		t.Errorf("Watch(): the signature of a removed file must be removed, got %v", err)
+	}
+}
+
+func TestApp_Watch_SkipsFreshSignatures(t *testing.T) {
+	dir := t.TempDir()
+	signatureDir := filepath.Join(dir, "signatures")
+	for _, name := range []string{"fresh", "stale"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("some content"), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := New(4)
+	if err := app.replaceSignature(filepath.Join(dir, "fresh"), filepath.Join(signatureDir, "fresh")); err != nil {
+		t.Fatal(err)
+	}
+	// the signature directory is inside the watched one, so it must not be watched
+	events := startWatch(t, app, dir, signatureDir)
+
+	if ev := waitWatchEvent(t, events, "stale"); ev.Err != nil {
+		t.Fatalf("Watch() initial event = %+v", ev)
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("Watch() unexpected event = %+v", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestApp_replaceSignature_DynamicBlockSize(t *testing.T) {
+	dir := t.TempDir()
+	app := New(0)
+	for _, size := range []int{100, 10} {
+		target := filepath.Join(dir, "target")
+		if err := os.WriteFile(target, make([]byte, size), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.replaceSignature(target, filepath.Join(dir, "signature")); err != nil {
+			t.Fatalf("replaceSignature() error = %v", err)
+		}
+		f, err := os.Open(filepath.Join(dir, "signature"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, blocks, err := ReadSignature(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the dynamic block size is half of a small target
+		if len(blocks) != 2 {
+			t.Errorf("replaceSignature(%v bytes) blocks = %v, want 2", size, len(blocks))
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("replaceSignature() left %v files, want 2", len(entries))
+	}
+}
@@ -0,0 +1,106 @@
+package rdiff
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/silviutanasa/rdiff/rollsum"
+)
+
+// M is the modulo for the Adler32 hash computation.
+//
+// Deprecated: use rollsum.M instead.
+const M = rollsum.M
+
+// WeakHashType identifies the rolling hash algorithm used to compute the Block.WeakHash.
+type WeakHashType byte
+
+const (
+	// WeakHashAdler32 is the rsync like Adler32 rolling checksum, and it's the default weak hash.
+	WeakHashAdler32 WeakHashType = iota
+	// WeakHashRabin is a Rabin fingerprint, with a better distribution than Adler32 for small blocks.
+	WeakHashRabin
+	// WeakHashBuzhash is a cyclic polynomial hash, with a good mixing per byte and a cheap roll operation.
+	WeakHashBuzhash
+	// WeakHashAdler64 is a 64 bits Adler/Fletcher variant, producing far fewer false positives for big blocks.
+	WeakHashAdler64
+	// WeakHashCRC32C is a CRC32C checksum, hardware accelerated for full blocks, making the signature computation fast.
+	WeakHashCRC32C
+	// WeakHashLibrsync is the librsync rolling checksum, the weak hash of the librsync MD4 and BLAKE2 signatures.
+	WeakHashLibrsync
+	// WeakHashRabinKarp is the librsync RabinKarp rolling hash, the weak hash of the default librsync signatures.
+	WeakHashRabinKarp
+	// WeakHashCustom identifies a third party rolling hash, configured using WithRollingHash.
+	// The signature doesn't record which one was used, so a delta computation configured with another one isn't
+	// detected, see WithRollingHash.
+	WeakHashCustom WeakHashType = 255
+)
+
+// String returns the name of the weak hash algorithm.
+func (t WeakHashType) String() string {
+	switch t {
+	case WeakHashAdler32:
+		return "adler32"
+	case WeakHashRabin:
+		return "rabin"
+	case WeakHashBuzhash:
+		return "buzhash"
+	case WeakHashAdler64:
+		return "adler64"
+	case WeakHashCRC32C:
+		return "crc32c"
+	case WeakHashLibrsync:
+		return "librsync"
+	case WeakHashRabinKarp:
+		return "rabinkarp"
+	case WeakHashCustom:
+		return "custom"
+	default:
+		return fmt.Sprintf("unknown(%d)", byte(t))
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler, using the name of the weak hash algorithm.
+func (t WeakHashType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, it accepts the names returned by String, except for
+// the custom weak hash, which can only be configured using WithRollingHash, and returns a non-nil error
+// for an unknown name.
+func (t *WeakHashType) UnmarshalText(text []byte) error {
+	for _, h := range []WeakHashType{
+		WeakHashAdler32, WeakHashRabin, WeakHashBuzhash, WeakHashAdler64, WeakHashCRC32C, WeakHashLibrsync, WeakHashRabinKarp,
+	} {
+		if string(text) == h.String() {
+			*t = h
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown weak hash: %q", text)
+}
+
+// newRollingHash constructs the rolling hash identified by t, or returns a non-nil error if t is unknown.
+func newRollingHash(t WeakHashType) (rollsum.RollingHash, error) {
+	switch t {
+	case WeakHashAdler32:
+		return rollsum.NewAdler32(), nil
+	case WeakHashRabin:
+		return rollsum.NewRabin(), nil
+	case WeakHashBuzhash:
+		return rollsum.NewBuzhash(), nil
+	case WeakHashAdler64:
+		return rollsum.NewAdler64(), nil
+	case WeakHashCRC32C:
+		return rollsum.NewCRC32C(), nil
+	case WeakHashLibrsync:
+		return rollsum.NewLibrsync(), nil
+	case WeakHashRabinKarp:
+		return rollsum.NewRabinKarp(), nil
+	case WeakHashCustom:
+		return nil, errors.New("a custom weak hash must be configured using WithRollingHash")
+	default:
+		return nil, fmt.Errorf("unknown weak hash type: %v", t)
+	}
+}
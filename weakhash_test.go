@@ -0,0 +1,33 @@
+package rdiff
+
+import "testing"
+
+func TestWeakHashType_UnmarshalText(t *testing.T) {
+	for _, tt := range []struct {
+		in      string
+		out     WeakHashType
+		wantErr bool
+	}{
+		{in: "adler32", out: WeakHashAdler32},
+		{in: "rabin", out: WeakHashRabin},
+		{in: "buzhash", out: WeakHashBuzhash},
+		{in: "adler64", out: WeakHashAdler64},
+		{in: "crc32c", out: WeakHashCRC32C},
+		{in: "librsync", out: WeakHashLibrsync},
+		{in: "rabinkarp", out: WeakHashRabinKarp},
+		{in: "custom", wantErr: true},
+		{in: "md5", wantErr: true},
+	} {
+		var got WeakHashType
+		err := got.UnmarshalText([]byte(tt.in))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("UnmarshalText(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if err == nil && got != tt.out {
+			t.Errorf("UnmarshalText(%q) = %v, want %v", tt.in, got, tt.out)
+		}
+		if text, _ := tt.out.MarshalText(); err == nil && string(text) != tt.in {
+			t.Errorf("MarshalText(%v) = %q, want %q", tt.out, text, tt.in)
+		}
+	}
+}